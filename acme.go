@@ -0,0 +1,156 @@
+package handlers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// acmeChallengePrefix is the path under which ACME HTTP-01 challenges are
+// served (RFC 8555, section 8.3).
+const acmeChallengePrefix = "/.well-known/acme-challenge/"
+
+// ErrACMETokenNotFound is returned by an ACMETokenStore for unknown tokens.
+var ErrACMETokenNotFound = errors.New("handlers: ACME token not found")
+
+// ACMETokenStore provides the key authorizations of pending ACME HTTP-01
+// challenges.
+type ACMETokenStore interface {
+	// KeyAuthorization returns the key authorization for token, or
+	// ErrACMETokenNotFound.
+	KeyAuthorization(token string) (string, error)
+}
+
+// ACMETokenFunc is an adapter to use a function as an ACMETokenStore.
+type ACMETokenFunc func(token string) (string, error)
+
+// KeyAuthorization calls f(token).
+func (f ACMETokenFunc) KeyAuthorization(token string) (string, error) {
+	return f(token)
+}
+
+// ACMETokenDir is an ACMETokenStore reading the key authorization for each
+// token from the file of the same name in a directory, as written by ACME
+// clients in webroot mode.
+type ACMETokenDir string
+
+// KeyAuthorization reads the file named token.
+func (d ACMETokenDir) KeyAuthorization(token string) (string, error) {
+	b, err := ioutil.ReadFile(filepath.Join(string(d), token))
+	if os.IsNotExist(err) {
+		return "", ErrACMETokenNotFound
+	}
+	if err != nil {
+		return "", err
+	}
+	return strings.TrimSpace(string(b)), nil
+}
+
+// ACMEOption represents a functional option for configuring
+// ACMEChallengeHandler.
+type ACMEOption func(*acmeChallenge) error
+
+type acmeChallenge struct {
+	store    ACMETokenStore
+	fallback http.Handler
+	code     int
+}
+
+// ACMEFallback sets the handler serving the requests which aren't ACME
+// challenges, instead of redirecting them to HTTPS.
+func ACMEFallback(h http.Handler) ACMEOption {
+	return func(a *acmeChallenge) error {
+		a.fallback = h
+		return nil
+	}
+}
+
+// ACMERedirectCode sets the status code of the redirects to HTTPS. It
+// defaults to 301 Moved Permanently.
+func ACMERedirectCode(code int) ACMEOption {
+	return func(a *acmeChallenge) error {
+		a.code = code
+		return nil
+	}
+}
+
+// ACMEChallengeHandler returns a handler answering ACME HTTP-01 challenges
+// under /.well-known/acme-challenge/ with the key authorizations provided by
+// store, for servers doing their own certificate issuance. All other requests
+// are redirected to the same URL over HTTPS, unless ACMEFallback is given.
+//
+// Example:
+//
+//	acme := handlers.ACMEChallengeHandler(handlers.ACMETokenDir("/var/lib/acme/challenges"))
+//	go http.ListenAndServe(":80", acme)
+//	http.ListenAndServeTLS(":443", certFile, keyFile, r)
+func ACMEChallengeHandler(store ACMETokenStore, opts ...ACMEOption) http.Handler {
+	a := &acmeChallenge{store: store, code: http.StatusMovedPermanently}
+	for _, option := range opts {
+		option(a)
+	}
+	return a
+}
+
+func (a *acmeChallenge) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("acme_challenge", w, r)
+	defer end()
+
+	if !strings.HasPrefix(r.URL.Path, acmeChallengePrefix) {
+		if a.fallback != nil {
+			a.fallback.ServeHTTP(w, r)
+			return
+		}
+		host := r.Host
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+			if strings.Contains(host, ":") {
+				host = "[" + host + "]"
+			}
+		}
+		http.Redirect(w, r, "https://"+host+r.URL.RequestURI(), a.code)
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		w.Header().Set("Allow", "GET, HEAD")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+		return
+	}
+	token := strings.TrimPrefix(r.URL.Path, acmeChallengePrefix)
+	if !isACMEToken(token) {
+		http.NotFound(w, r)
+		return
+	}
+	keyAuth, err := a.store.KeyAuthorization(token)
+	if errors.Is(err, ErrACMETokenNotFound) {
+		http.NotFound(w, r)
+		return
+	}
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/plain")
+	w.Header().Set("Cache-Control", "no-store")
+	w.Write([]byte(keyAuth))
+}
+
+// isACMEToken reports whether token is made of base64url characters, which
+// also guarantees it is safe to use as a file name.
+func isACMEToken(token string) bool {
+	if token == "" {
+		return false
+	}
+	for i := 0; i < len(token); i++ {
+		c := token[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '-' || c == '_') {
+			return false
+		}
+	}
+	return true
+}
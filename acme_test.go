@@ -0,0 +1,71 @@
+package handlers
+
+import (
+	"errors"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"path/filepath"
+	"testing"
+)
+
+func TestACMEChallengeHandler(t *testing.T) {
+	dir := t.TempDir()
+	if err := ioutil.WriteFile(filepath.Join(dir, "tok-EN_1"), []byte("tok-EN_1.thumbprint\n"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	handler := ACMEChallengeHandler(ACMETokenDir(dir))
+
+	tests := []struct {
+		method   string
+		target   string
+		code     int
+		body     string
+		location string
+	}{
+		{"GET", "/.well-known/acme-challenge/tok-EN_1", http.StatusOK, "tok-EN_1.thumbprint", ""},
+		{"GET", "/.well-known/acme-challenge/unknown", http.StatusNotFound, "", ""},
+		{"GET", "/.well-known/acme-challenge/..%2Fsecret", http.StatusNotFound, "", ""},
+		{"POST", "/.well-known/acme-challenge/tok-EN_1", http.StatusMethodNotAllowed, "", ""},
+		{"GET", "http://example.com:80/a/b?c=d", http.StatusMovedPermanently, "", "https://example.com/a/b?c=d"},
+	}
+	for _, test := range tests {
+		r := newRequest(test.method, test.target)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%s %s: wrong status, got %d want %d", test.method, test.target, rec.Code, test.code)
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%s %s: wrong body, got %q want %q", test.method, test.target, rec.Body.String(), test.body)
+		}
+		if loc := rec.Header().Get("Location"); loc != test.location {
+			t.Errorf("%s %s: wrong location, got %q want %q", test.method, test.target, loc, test.location)
+		}
+	}
+}
+
+func TestACMEChallengeHandlerFunc(t *testing.T) {
+	store := ACMETokenFunc(func(token string) (string, error) {
+		if token == "broken" {
+			return "", errors.New("store down")
+		}
+		return "", ErrACMETokenNotFound
+	})
+	fallback := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+	handler := ACMEChallengeHandler(store, ACMEFallback(fallback))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/.well-known/acme-challenge/broken"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("wrong status: got %d want %d", rec.Code, http.StatusInternalServerError)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("fallback not used: got %d", rec.Code)
+	}
+}
@@ -0,0 +1,218 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const defaultAPIVersionHeader = "X-API-Version"
+
+// APIVersionOption represents a functional option for configuring the
+// APIVersions middleware.
+type APIVersionOption func(*apiVersions) error
+
+type apiVersions struct {
+	h          http.Handler
+	supported  []string
+	def        string
+	header     string
+	param      string
+	stripPaths bool
+}
+
+// apiVersion is stored in the request context by APIVersions.
+type apiVersion string
+
+// APIVersionDefault sets the version of requests which don't ask for one. It
+// defaults to the first supported version.
+func APIVersionDefault(version string) APIVersionOption {
+	return func(v *apiVersions) error {
+		v.def = normalizeAPIVersion(version)
+		return nil
+	}
+}
+
+// APIVersionHeader sets the request header carrying the version,
+// "X-API-Version" by default. An empty name disables it.
+func APIVersionHeader(name string) APIVersionOption {
+	return func(v *apiVersions) error {
+		v.header = name
+		return nil
+	}
+}
+
+// APIVersionMediaTypeParam sets the parameter of the Accept header media
+// types carrying the version, as in "application/json; version=2", "version"
+// by default. An empty name disables it.
+func APIVersionMediaTypeParam(name string) APIVersionOption {
+	return func(v *apiVersions) error {
+		v.param = name
+		return nil
+	}
+}
+
+// APIVersionKeepPath leaves the version segment in request paths, for
+// routers matching on it.
+func APIVersionKeepPath() APIVersionOption {
+	return func(v *apiVersions) error {
+		v.stripPaths = false
+		return nil
+	}
+}
+
+// APIVersions is HTTP middleware determining the API version requested, among
+// the supported ones. The version is taken from, by order of precedence:
+//
+//   - a leading path segment, as in "/v2/users", which is stripped as by
+//     StripPrefix so that routes don't depend on the version;
+//   - the X-API-Version header;
+//   - the "version" parameter of the media types in the Accept header, as in
+//     "application/json; version=2".
+//
+// Versions are compared without "v" prefix and case, so "v2", "V2" and "2"
+// are the same version. The normalized version is stored in the request
+// context, where it is retrieved with APIVersion, and echoed in the
+// X-API-Version response header. Requests for an unsupported version are
+// answered with 400 Bad Request, with the list of supported versions.
+//
+// Example:
+//
+//	versions := handlers.APIVersions([]string{"1", "2"}, handlers.APIVersionDefault("2"))
+//	mux.HandleFunc("GET /users", func(w http.ResponseWriter, r *http.Request) {
+//		if handlers.APIVersion(r) == "1" {
+//			...
+//		}
+//	})
+//	http.ListenAndServe(":1123", versions(mux))
+func APIVersions(supported []string, opts ...APIVersionOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		v := newAPIVersions(supported)
+		v.h = h
+		for _, option := range opts {
+			option(v)
+		}
+		return v
+	}
+}
+
+// NewAPIVersions is like APIVersions, but returns an error if there are no
+// supported versions, the default version isn't supported or an option is
+// invalid.
+func NewAPIVersions(supported []string, opts ...APIVersionOption) (func(http.Handler) http.Handler, error) {
+	if len(supported) == 0 {
+		return nil, errors.New("handlers: no supported API version")
+	}
+	v := newAPIVersions(supported)
+	for _, option := range opts {
+		if err := option(v); err != nil {
+			return nil, err
+		}
+	}
+	if !v.isSupported(v.def) {
+		return nil, fmt.Errorf("handlers: unsupported default API version %q", v.def)
+	}
+	return APIVersions(supported, opts...), nil
+}
+
+func newAPIVersions(supported []string) *apiVersions {
+	v := &apiVersions{header: defaultAPIVersionHeader, param: "version", stripPaths: true}
+	for _, s := range supported {
+		v.supported = append(v.supported, normalizeAPIVersion(s))
+	}
+	if len(v.supported) > 0 {
+		v.def = v.supported[0]
+	}
+	return v
+}
+
+func (v *apiVersions) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("api_version", w, r)
+	defer end()
+
+	h := w.Header()
+	if v.header != "" {
+		h.Add("Vary", v.header)
+	}
+	if v.param != "" {
+		h.Add("Vary", "Accept")
+	}
+
+	version, prefix := v.fromPath(r.URL.Path)
+	if version == "" && v.header != "" {
+		version = normalizeAPIVersion(r.Header.Get(v.header))
+	}
+	if version == "" && v.param != "" {
+		version = v.fromAccept(r.Header.Values("Accept"))
+	}
+	if version == "" {
+		version = v.def
+	}
+
+	if !v.isSupported(version) {
+		detail := fmt.Sprintf("unsupported API version %q, supported versions: %s", version, strings.Join(v.supported, ", "))
+		if !writeProblem(w, r, http.StatusBadRequest, detail) {
+			http.Error(w, detail, http.StatusBadRequest)
+		}
+		return
+	}
+
+	h.Set(defaultAPIVersionHeader, version)
+	r = WithValue(r, apiVersion(version))
+	if prefix != "" && v.stripPaths {
+		StripPrefix(prefix, v.h).ServeHTTP(w, r)
+		return
+	}
+	v.h.ServeHTTP(w, r)
+}
+
+// fromPath returns the version in the first segment of path, and the segment
+// as a prefix.
+func (v *apiVersions) fromPath(path string) (string, string) {
+	seg := strings.TrimPrefix(path, "/")
+	if i := strings.IndexByte(seg, '/'); i >= 0 {
+		seg = seg[:i]
+	}
+	if len(seg) < 2 || (seg[0] != 'v' && seg[0] != 'V') || seg[1] < '0' || seg[1] > '9' {
+		return "", ""
+	}
+	return normalizeAPIVersion(seg), "/" + seg
+}
+
+// fromAccept returns the version parameter of the first media type of the
+// Accept header which has one.
+func (v *apiVersions) fromAccept(accept []string) string {
+	for _, value := range accept {
+		for _, mt := range strings.Split(value, ",") {
+			if _, params, err := mime.ParseMediaType(mt); err == nil && params[v.param] != "" {
+				return normalizeAPIVersion(params[v.param])
+			}
+		}
+	}
+	return ""
+}
+
+func (v *apiVersions) isSupported(version string) bool {
+	for _, s := range v.supported {
+		if s == version {
+			return true
+		}
+	}
+	return false
+}
+
+func normalizeAPIVersion(version string) string {
+	version = strings.ToLower(strings.TrimSpace(version))
+	if len(version) > 1 && version[0] == 'v' && version[1] >= '0' && version[1] <= '9' {
+		version = version[1:]
+	}
+	return version
+}
+
+// APIVersion returns the API version of r determined by APIVersions, without
+// "v" prefix, or an empty string.
+func APIVersion(r *http.Request) string {
+	return APIVersionFromContext(r.Context())
+}
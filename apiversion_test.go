@@ -0,0 +1,78 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestAPIVersions(t *testing.T) {
+	var version, path string
+	h := APIVersions([]string{"v1", "v2"}, APIVersionDefault("2"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		version, path = APIVersion(r), r.URL.Path
+	}))
+
+	tests := []struct {
+		path, header, accept string
+		code                 int
+		version, downstream  string
+	}{
+		{"/v1/users", "", "", http.StatusOK, "1", "/users"},
+		{"/V2/users", "1", "", http.StatusOK, "2", "/users"},
+		{"/users", "v1", "", http.StatusOK, "1", "/users"},
+		{"/users", "", "text/html, application/json; version=1", http.StatusOK, "1", "/users"},
+		{"/users", "", "", http.StatusOK, "2", "/users"},
+		{"/videos", "", "", http.StatusOK, "2", "/videos"},
+		{"/v3/users", "", "", http.StatusBadRequest, "", ""},
+		{"/users", "beta", "", http.StatusBadRequest, "", ""},
+	}
+	for _, test := range tests {
+		version, path = "", ""
+		r := newRequest("GET", test.path)
+		if test.header != "" {
+			r.Header.Set("X-API-Version", test.header)
+		}
+		if test.accept != "" {
+			r.Header.Set("Accept", test.accept)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%s: wrong status: got %d want %d", test.path, rec.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			if !strings.Contains(rec.Body.String(), "supported versions: 1, 2") {
+				t.Errorf("%s: supported versions not listed: %q", test.path, rec.Body.String())
+			}
+			continue
+		}
+		if version != test.version || path != test.downstream || rec.Header().Get("X-API-Version") != test.version {
+			t.Errorf("%s: got version %q path %q, want %q %q", test.path, version, path, test.version, test.downstream)
+		}
+	}
+}
+
+func TestAPIVersionsKeepPath(t *testing.T) {
+	var path string
+	h := APIVersions([]string{"1"}, APIVersionKeepPath())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/v1/users"))
+	if path != "/v1/users" {
+		t.Fatalf("wrong path: %q", path)
+	}
+}
+
+func TestNewAPIVersions(t *testing.T) {
+	if _, err := NewAPIVersions(nil); err == nil {
+		t.Error("no error without versions")
+	}
+	if _, err := NewAPIVersions([]string{"1"}, APIVersionDefault("2")); err == nil {
+		t.Error("no error for an unsupported default")
+	}
+	if _, err := NewAPIVersions([]string{"1", "2"}, APIVersionDefault("v2")); err != nil {
+		t.Error(err)
+	}
+}
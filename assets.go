@@ -0,0 +1,339 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io/fs"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// precompressedEncodings lists the supported precompressed variants by order
+// of preference, with their file name extension.
+var precompressedEncodings = []struct {
+	encoding, ext string
+}{
+	{"br", ".br"},
+	{"gzip", ".gz"},
+}
+
+// AssetOption represents a functional option for configuring AssetHandler.
+type AssetOption func(*assetServer) error
+
+type assetServer struct {
+	fsys        fs.FS
+	prefix      string
+	fingerprint bool
+	manifest    string
+	assets      map[string]*asset
+	names       map[string]string // fingerprinted names by logical name
+	immutable   map[string]bool   // fingerprinted names
+}
+
+// asset is a file served by AssetHandler, and its precompressed variants.
+type asset struct {
+	contentType string
+	variants    map[string]*assetVariant // by content coding, "" for identity
+}
+
+type assetVariant struct {
+	data []byte
+	etag string
+}
+
+// AssetHandler returns a handler serving the files of fsys, typically an
+// embed.FS, for single-binary deployments.
+//
+// Files are read when the handler is created, and their ETag computed from
+// their content, since embedded files have no modification time. When a
+// file has precompressed variants, with the same name and a .br or .gz
+// extension, the best variant accepted by the client (per Accept-Encoding)
+// is served with the corresponding Content-Encoding. Directories are served
+// their index.html file. Conditional and range requests are supported.
+//
+// Example:
+//
+//	//go:embed static
+//	var static embed.FS
+//
+//	sub, _ := fs.Sub(static, "static")
+//	http.Handle("/static/", handlers.AssetHandler(sub, handlers.AssetStripPrefix("/static")))
+func AssetHandler(fsys fs.FS, opts ...AssetOption) http.Handler {
+	s, _ := newAssetServer(fsys, opts...)
+	return s
+}
+
+// newAssetServer loads the files of fsys, returning the first error of the
+// options or of the manifest.
+func newAssetServer(fsys fs.FS, opts ...AssetOption) (*assetServer, error) {
+	s := &assetServer{
+		fsys:      fsys,
+		assets:    map[string]*asset{},
+		names:     map[string]string{},
+		immutable: map[string]bool{},
+	}
+	var firstErr error
+	for _, option := range opts {
+		if err := option(s); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	}
+	fs.WalkDir(fsys, ".", func(name string, d fs.DirEntry, err error) error {
+		if err != nil || d.IsDir() || name == s.manifest {
+			return nil
+		}
+		s.load(name)
+		return nil
+	})
+	if s.manifest != "" {
+		if err := s.loadManifest(); err != nil && firstErr == nil {
+			firstErr = err
+		}
+	} else if s.fingerprint {
+		for name, a := range s.assets {
+			fingerprinted := fingerprintName(name, a.variants[""].data)
+			s.names[name] = fingerprinted
+			s.immutable[fingerprinted] = true
+		}
+		for name, fingerprinted := range s.names {
+			s.assets[fingerprinted] = s.assets[name]
+		}
+	}
+	return s, firstErr
+}
+
+// AssetStripPrefix removes prefix from request paths before looking up files,
+// as http.StripPrefix does. Paths not starting with prefix, followed by a slash
+// or nothing, are answered with 404 Not Found.
+func AssetStripPrefix(prefix string) AssetOption {
+	return func(s *assetServer) error {
+		s.prefix = strings.TrimSuffix(prefix, "/")
+		return nil
+	}
+}
+
+// AssetFingerprint also serves each file under a fingerprinted name, with a
+// hash of its content inserted before its extension, e.g. app.3f2a9b1c04de.js
+// for app.js. Fingerprinted names are served with CacheImmutable caching, and
+// resolved from the logical names by Assets.URL.
+func AssetFingerprint() AssetOption {
+	return func(s *assetServer) error {
+		s.fingerprint = true
+		return nil
+	}
+}
+
+// AssetManifest takes the fingerprinted names of the files from the named
+// manifest file of fsys, written by a bundler which fingerprints the files
+// itself, instead of computing them. The manifest is a JSON object mapping
+// logical names to fingerprinted names, either directly or in the file
+// member of an object, as in Vite manifests:
+//
+//	{"app.js": "app.3f2a9b1c.js", "main.css": {"file": "assets/main.8e1c.css"}}
+//
+// The manifest itself isn't served.
+func AssetManifest(name string) AssetOption {
+	return func(s *assetServer) error {
+		s.manifest = name
+		if !fs.ValidPath(name) {
+			return fmt.Errorf("handlers: invalid asset manifest name %q", name)
+		}
+		return nil
+	}
+}
+
+// Assets serves files as AssetHandler does, and resolves logical file names
+// to the URLs of their fingerprinted versions, for templates.
+type Assets struct {
+	s *assetServer
+}
+
+// NewAssets returns an Assets serving the files of fsys. Fingerprinting is
+// enabled unless an AssetManifest is given. It returns an error if an option
+// is invalid, or the manifest can't be read or lists missing files.
+//
+// Example:
+//
+//	//go:embed static
+//	var static embed.FS
+//
+//	sub, _ := fs.Sub(static, "static")
+//	assets, err := handlers.NewAssets(sub, handlers.AssetStripPrefix("/static"))
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	http.Handle("/static/", assets)
+//	tmpl := template.New("page").Funcs(template.FuncMap{"asset": assets.URL})
+//	// {{asset "app.js"}} renders as /static/app.3f2a9b1c04de.js
+func NewAssets(fsys fs.FS, opts ...AssetOption) (*Assets, error) {
+	s, err := newAssetServer(fsys, append([]AssetOption{AssetFingerprint()}, opts...)...)
+	if err != nil {
+		return nil, err
+	}
+	return &Assets{s: s}, nil
+}
+
+func (a *Assets) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	a.s.ServeHTTP(w, r)
+}
+
+// URL returns the URL path of the fingerprinted version of the named file,
+// below the prefix set with AssetStripPrefix. Names without fingerprinted
+// version are returned as is, below the prefix.
+func (a *Assets) URL(name string) string {
+	name = strings.TrimPrefix(name, "/")
+	if fingerprinted, ok := a.s.names[name]; ok {
+		name = fingerprinted
+	}
+	return a.s.prefix + "/" + name
+}
+
+// loadManifest reads the fingerprinted names of the files from the manifest.
+func (s *assetServer) loadManifest() error {
+	data, err := fs.ReadFile(s.fsys, s.manifest)
+	if err != nil {
+		return fmt.Errorf("handlers: reading asset manifest: %w", err)
+	}
+	var manifest map[string]json.RawMessage
+	if err := json.Unmarshal(data, &manifest); err != nil {
+		return fmt.Errorf("handlers: invalid asset manifest %s: %w", s.manifest, err)
+	}
+	for name, raw := range manifest {
+		var entry struct {
+			File string `json:"file"`
+		}
+		if err := json.Unmarshal(raw, &entry.File); err != nil {
+			if err := json.Unmarshal(raw, &entry); err != nil || entry.File == "" {
+				return fmt.Errorf("handlers: invalid asset manifest entry %q", name)
+			}
+		}
+		fingerprinted := strings.TrimPrefix(entry.File, "/")
+		if _, ok := s.assets[fingerprinted]; !ok {
+			return fmt.Errorf("handlers: asset manifest entry %q: file %q not found", name, entry.File)
+		}
+		s.names[strings.TrimPrefix(name, "/")] = fingerprinted
+		s.immutable[fingerprinted] = true
+	}
+	return nil
+}
+
+// fingerprintName inserts a hash of data before the extension of name.
+func fingerprintName(name string, data []byte) string {
+	sum := sha256.Sum256(data)
+	ext := path.Ext(name)
+	return strings.TrimSuffix(name, ext) + "." + hex.EncodeToString(sum[:6]) + ext
+}
+
+// load reads the file name, unless it is a precompressed variant, and its
+// variants.
+func (s *assetServer) load(name string) {
+	for _, pe := range precompressedEncodings {
+		if strings.HasSuffix(name, pe.ext) {
+			if _, err := fs.Stat(s.fsys, strings.TrimSuffix(name, pe.ext)); err == nil {
+				return
+			}
+		}
+	}
+
+	data, err := fs.ReadFile(s.fsys, name)
+	if err != nil {
+		return
+	}
+	a := &asset{
+		contentType: mime.TypeByExtension(path.Ext(name)),
+		variants:    map[string]*assetVariant{"": {data: data, etag: computeETag(data, false)}},
+	}
+	if a.contentType == "" {
+		a.contentType = http.DetectContentType(data)
+	}
+	for _, pe := range precompressedEncodings {
+		if data, err := fs.ReadFile(s.fsys, name+pe.ext); err == nil {
+			a.variants[pe.encoding] = &assetVariant{data: data, etag: computeETag(data, false)}
+		}
+	}
+	s.assets[name] = a
+}
+
+func (s *assetServer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("assets", w, r)
+	defer end()
+
+	p := r.URL.Path
+	if s.prefix != "" {
+		// The prefix must be a whole number of path segments: "/static"
+		// doesn't match "/staticfoo".
+		p = strings.TrimPrefix(p, s.prefix)
+		if len(p) == len(r.URL.Path) || p != "" && p[0] != '/' {
+			http.NotFound(w, r)
+			return
+		}
+	}
+
+	name := strings.TrimPrefix(path.Clean("/"+p), "/")
+	if name == "" || strings.HasSuffix(p, "/") {
+		name = path.Join(name, "index.html")
+	}
+	a, ok := s.assets[name]
+	if !ok {
+		http.NotFound(w, r)
+		return
+	}
+
+	h := w.Header()
+	v := a.variants[""]
+	if len(a.variants) > 1 {
+		h.Add("Vary", acceptEncoding)
+		accepted := parseAcceptEncoding(r.Header.Get(acceptEncoding))
+		for _, pe := range precompressedEncodings {
+			if variant, ok := a.variants[pe.encoding]; ok && accepted[pe.encoding] > 0 {
+				v = variant
+				h.Set("Content-Encoding", pe.encoding)
+				break
+			}
+		}
+	}
+	h.Set("Content-Type", a.contentType)
+	h.Set(etagHeader, v.etag)
+	if s.immutable[name] {
+		h.Set("Cache-Control", CacheImmutable)
+	}
+	http.ServeContent(w, r, "", time.Time{}, bytes.NewReader(v.data))
+}
+
+// parseAcceptEncoding returns the quality values of the content codings listed
+// in an Accept-Encoding header. A "*" entry applies to codings not listed.
+func parseAcceptEncoding(v string) map[string]float64 {
+	accepted := map[string]float64{}
+	for _, part := range strings.Split(v, ",") {
+		params := strings.Split(part, ";")
+		coding := strings.ToLower(strings.TrimSpace(params[0]))
+		if coding == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		accepted[coding] = q
+	}
+	if q, ok := accepted["*"]; ok {
+		for _, pe := range precompressedEncodings {
+			if _, ok := accepted[pe.encoding]; !ok {
+				accepted[pe.encoding] = q
+			}
+		}
+	}
+	return accepted
+}
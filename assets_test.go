@@ -0,0 +1,177 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+)
+
+func TestAssetHandler(t *testing.T) {
+	fsys := fstest.MapFS{
+		"index.html":      {Data: []byte("<html>home</html>")},
+		"app.js":          {Data: []byte("plain js")},
+		"app.js.br":       {Data: []byte("brotli js")},
+		"app.js.gz":       {Data: []byte("gzip js")},
+		"docs/index.html": {Data: []byte("<html>docs</html>")},
+		"data.gz":         {Data: []byte("an archive")},
+	}
+	handler := AssetHandler(fsys, AssetStripPrefix("/static/"))
+
+	tests := []struct {
+		path           string
+		acceptEncoding string
+		code           int
+		body           string
+		encoding       string
+	}{
+		{"/static/app.js", "", http.StatusOK, "plain js", ""},
+		{"/static/app.js", "gzip, deflate", http.StatusOK, "gzip js", "gzip"},
+		{"/static/app.js", "gzip, br", http.StatusOK, "brotli js", "br"},
+		{"/static/app.js", "br;q=0, gzip", http.StatusOK, "gzip js", "gzip"},
+		{"/static/app.js", "*", http.StatusOK, "brotli js", "br"},
+		{"/static/", "", http.StatusOK, "<html>home</html>", ""},
+		{"/static/docs/", "", http.StatusOK, "<html>docs</html>", ""},
+		{"/static/data.gz", "gzip", http.StatusOK, "an archive", ""},
+		{"/static/app.js.br", "", http.StatusNotFound, "", ""},
+		{"/static/missing.js", "", http.StatusNotFound, "", ""},
+		{"/app.js", "", http.StatusNotFound, "", ""},
+		{"/staticapp.js", "", http.StatusNotFound, "", ""},
+	}
+
+	etags := map[string]bool{}
+	for _, test := range tests {
+		r := newRequest("GET", test.path)
+		if test.acceptEncoding != "" {
+			r.Header.Set(acceptEncoding, test.acceptEncoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		if rec.Code != test.code {
+			t.Errorf("%s (%s): bad status: got %d want %d", test.path, test.acceptEncoding, rec.Code, test.code)
+			continue
+		}
+		if test.code != http.StatusOK {
+			continue
+		}
+		if rec.Body.String() != test.body {
+			t.Errorf("%s (%s): bad body: got %q want %q", test.path, test.acceptEncoding, rec.Body.String(), test.body)
+		}
+		if got := rec.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s (%s): bad Content-Encoding: got %q want %q", test.path, test.acceptEncoding, got, test.encoding)
+		}
+		if test.path == "/static/app.js" {
+			if rec.Header().Get("Content-Type") != "text/javascript; charset=utf-8" || rec.Header().Get("Vary") != acceptEncoding {
+				t.Errorf("%s (%s): bad headers: %v", test.path, test.acceptEncoding, rec.Header())
+			}
+			etags[rec.Header().Get(etagHeader)] = true
+		}
+	}
+	if len(etags) != 3 {
+		t.Errorf("variants don't have distinct ETags: %v", etags)
+	}
+
+	r := newRequest("GET", "/static/app.js")
+	r.Header.Set("If-None-Match", computeETag([]byte("plain js"), false))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("bad status for a conditional request: got %d want %d", rec.Code, http.StatusNotModified)
+	}
+}
+
+func TestAssetsFingerprint(t *testing.T) {
+	fsys := fstest.MapFS{
+		"app.js":    {Data: []byte("plain js")},
+		"app.js.gz": {Data: []byte("gzip js")},
+		"css/site":  {Data: []byte("body {}")},
+	}
+	assets, err := NewAssets(fsys, AssetStripPrefix("/static/"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	url := assets.URL("app.js")
+	if want := "/static/" + fingerprintName("app.js", []byte("plain js")); url != want || !strings.HasPrefix(url, "/static/app.") || !strings.HasSuffix(url, ".js") {
+		t.Fatalf("bad URL: got %q want %q", url, want)
+	}
+	if got := assets.URL("/css/site"); !strings.HasPrefix(got, "/static/css/site.") {
+		t.Errorf("bad URL for a name without extension: %q", got)
+	}
+	if got := assets.URL("missing.js"); got != "/static/missing.js" {
+		t.Errorf("bad URL for a missing file: %q", got)
+	}
+
+	tests := []struct {
+		path, acceptEncoding, body, cacheControl string
+	}{
+		{url, "", "plain js", CacheImmutable},
+		{url, "gzip", "gzip js", CacheImmutable},
+		{"/static/app.js", "", "plain js", ""},
+	}
+	for _, test := range tests {
+		r := newRequest("GET", test.path)
+		r.Header.Set(acceptEncoding, test.acceptEncoding)
+		rec := httptest.NewRecorder()
+		assets.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK || rec.Body.String() != test.body {
+			t.Errorf("%s (%s): got %d %q want %q", test.path, test.acceptEncoding, rec.Code, rec.Body.String(), test.body)
+		}
+		if got := rec.Header().Get("Cache-Control"); got != test.cacheControl {
+			t.Errorf("%s: bad Cache-Control: got %q want %q", test.path, got, test.cacheControl)
+		}
+	}
+}
+
+func TestAssetsManifest(t *testing.T) {
+	fsys := fstest.MapFS{
+		"manifest.json":         {Data: []byte(`{"app.js": "app.1a2b3c.js", "main.css": {"file": "/assets/main.4d5e.css"}}`)},
+		"app.1a2b3c.js":         {Data: []byte("js")},
+		"assets/main.4d5e.css":  {Data: []byte("css")},
+		"assets/unlisted.9f.js": {Data: []byte("unlisted")},
+	}
+	assets, err := NewAssets(fsys, AssetManifest("manifest.json"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	for name, want := range map[string]string{
+		"app.js":   "/app.1a2b3c.js",
+		"main.css": "/assets/main.4d5e.css",
+		"other.js": "/other.js",
+	} {
+		if got := assets.URL(name); got != want {
+			t.Errorf("%s: bad URL: got %q want %q", name, got, want)
+		}
+	}
+
+	for path, cacheControl := range map[string]string{
+		"/assets/main.4d5e.css":  CacheImmutable,
+		"/assets/unlisted.9f.js": "",
+	} {
+		rec := httptest.NewRecorder()
+		assets.ServeHTTP(rec, newRequest("GET", path))
+		if rec.Code != http.StatusOK || rec.Header().Get("Cache-Control") != cacheControl {
+			t.Errorf("%s: got %d %v", path, rec.Code, rec.Header())
+		}
+	}
+	rec := httptest.NewRecorder()
+	assets.ServeHTTP(rec, newRequest("GET", "/manifest.json"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("manifest served: %d", rec.Code)
+	}
+
+	for _, manifest := range []string{`{"app.js": "app.0000.js"}`, `{"app.js": 1}`, `[]`} {
+		fsys["manifest.json"] = &fstest.MapFile{Data: []byte(manifest)}
+		if _, err := NewAssets(fsys, AssetManifest("manifest.json")); err == nil {
+			t.Errorf("%s: no error", manifest)
+		}
+	}
+	if _, err := NewAssets(fsys, AssetManifest("missing.json")); err == nil {
+		t.Error("no error for a missing manifest")
+	}
+	if _, err := NewAssets(fsys, AssetManifest("../manifest.json")); err == nil {
+		t.Error("no error for an invalid manifest name")
+	}
+}
@@ -0,0 +1,338 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	defaultMaxFailures = 5
+	defaultEjectFor    = 30 * time.Second
+)
+
+// BalanceStrategy is the way LoadBalancer picks the upstream of a request.
+type BalanceStrategy int
+
+const (
+	// RoundRobin sends requests to each upstream in turn.
+	RoundRobin BalanceStrategy = iota
+	// LeastConnections sends requests to the upstream with the fewest
+	// requests in flight, which suits requests of uneven duration.
+	LeastConnections
+)
+
+// ProxyBalance sets the strategy LoadBalancer uses to pick upstreams,
+// RoundRobin by default.
+func ProxyBalance(strategy BalanceStrategy) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.strategy = strategy
+		if strategy != RoundRobin && strategy != LeastConnections {
+			return fmt.Errorf("handlers: invalid balance strategy %d", strategy)
+		}
+		return nil
+	}
+}
+
+// ProxyPassiveHealthCheck makes LoadBalancer eject an upstream for ejectFor
+// after maxFailures consecutive failed requests: requests which couldn't be
+// proxied, or were answered with 502, 503 or 504. Once back, a single failure
+// ejects it again, until a request succeeds. It defaults to 5 failures and 30
+// seconds; a zero maxFailures disables ejection.
+func ProxyPassiveHealthCheck(maxFailures int, ejectFor time.Duration) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.maxFailures = maxFailures
+		p.ejectFor = ejectFor
+		if maxFailures < 0 || ejectFor < 0 {
+			return fmt.Errorf("handlers: invalid passive health check of %d failures for %v", maxFailures, ejectFor)
+		}
+		return nil
+	}
+}
+
+// ProxyStickyCookie pins each client to an upstream with the named cookie,
+// set for ttl, or for the browser session if ttl is zero, so that stateful
+// upstreams receive the repeat requests of their clients. The cookie
+// identifies the upstream by a hash of its URL. Clients pinned to an ejected
+// upstream are pinned to another one.
+func ProxyStickyCookie(name string, ttl time.Duration) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.stickyCookie = name
+		p.stickyTTL = ttl
+		if name == "" || ttl < 0 {
+			return fmt.Errorf("handlers: invalid sticky cookie %q with TTL %v", name, ttl)
+		}
+		return nil
+	}
+}
+
+// ProxyStickyHash routes the requests with the same key to the same upstream,
+// by rendezvous hashing, so that few keys move when upstreams are added,
+// removed or ejected. The key defaults to the client IP address, see
+// ClientIP. With ProxyStickyCookie, the hash picks the upstream of new
+// clients.
+func ProxyStickyHash(key func(r *http.Request) string) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.stickyKey = key
+		if key == nil {
+			p.stickyKey = ClientIP
+		}
+		return nil
+	}
+}
+
+// LoadBalancer is a reverse proxy spreading requests over several upstreams.
+type LoadBalancer struct {
+	upstreams    []*upstream
+	strategy     BalanceStrategy
+	maxFailures  int
+	ejectFor     time.Duration
+	stickyCookie string
+	stickyTTL    time.Duration
+	stickyKey    func(*http.Request) string
+	next         uint64
+}
+
+type upstream struct {
+	url   *url.URL
+	id    string // hash of url, for sticky cookies and hashing
+	proxy *reverseProxy
+
+	active, requests, failures, ejections int64
+
+	mu           sync.Mutex
+	consecutive  int
+	ejectedUntil time.Time
+}
+
+// UpstreamStats reports the traffic served by an upstream of a LoadBalancer.
+type UpstreamStats struct {
+	URL string `json:"url"`
+	// Active is the number of requests in flight.
+	Active   int64 `json:"active"`
+	Requests int64 `json:"requests"`
+	// Failures counts the requests which couldn't be proxied, or were
+	// answered with 502, 503 or 504.
+	Failures  int64 `json:"failures"`
+	Ejections int64 `json:"ejections"`
+	// Ejected reports whether the upstream is currently ejected.
+	Ejected bool `json:"ejected"`
+}
+
+// NewLoadBalancer returns a reverse proxy spreading requests over targets,
+// each proxied as by ReverseProxy with opts, which also configure the
+// strategy, client affinity and health checking of the balancer. Requests are
+// only retried against the upstream they were sent to, per ProxyRetries.
+//
+// Upstreams failing repeatedly are ejected for a while, per
+// ProxyPassiveHealthCheck. When all are ejected, requests are spread over all
+// of them regardless, rather than refused.
+//
+// It returns an error if there are no targets, one of them isn't an absolute
+// URL, or an option is invalid.
+//
+// Example:
+//
+//	var targets []*url.URL
+//	for _, addr := range []string{"http://10.0.0.12:8080", "http://10.0.0.13:8080"} {
+//		u, _ := url.Parse(addr)
+//		targets = append(targets, u)
+//	}
+//	lb, err := handlers.NewLoadBalancer(targets,
+//		handlers.ProxyBalance(handlers.LeastConnections),
+//		handlers.ProxyPassiveHealthCheck(3, 10*time.Second),
+//		handlers.ProxyTimeout(5*time.Second),
+//	)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	http.ListenAndServe(":1123", handlers.ProxyHeaders(lb))
+func NewLoadBalancer(targets []*url.URL, opts ...ReverseProxyOption) (*LoadBalancer, error) {
+	if len(targets) == 0 {
+		return nil, errors.New("handlers: no load balancer targets")
+	}
+	p := newReverseProxyConfig()
+	for _, option := range opts {
+		if err := option(p); err != nil {
+			return nil, err
+		}
+	}
+	lb := &LoadBalancer{
+		strategy:     p.strategy,
+		maxFailures:  p.maxFailures,
+		ejectFor:     p.ejectFor,
+		stickyCookie: p.stickyCookie,
+		stickyTTL:    p.stickyTTL,
+		stickyKey:    p.stickyKey,
+	}
+	for _, target := range targets {
+		if target == nil || target.Scheme == "" || target.Host == "" {
+			return nil, fmt.Errorf("handlers: invalid proxy target %v", target)
+		}
+		h := fnv.New64a()
+		h.Write([]byte(target.String()))
+		lb.upstreams = append(lb.upstreams, &upstream{
+			url:   target,
+			id:    strconv.FormatUint(h.Sum64(), 36),
+			proxy: newReverseProxy(target, opts...),
+		})
+	}
+	return lb, nil
+}
+
+func (lb *LoadBalancer) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("load_balancer", w, r)
+	defer end()
+
+	u := lb.route(w, r, time.Now())
+	atomic.AddInt64(&u.active, 1)
+	atomic.AddInt64(&u.requests, 1)
+	status := 0
+	ww, finish := beforeWriteHeader(w, func(code int) { status = code })
+	defer func() {
+		finish()
+		atomic.AddInt64(&u.active, -1)
+		lb.observe(u, status, time.Now())
+	}()
+	u.proxy.ServeHTTP(ww, r)
+}
+
+// route returns the upstream of r, per the affinity settings, and pins the
+// client to it with the sticky cookie.
+func (lb *LoadBalancer) route(w http.ResponseWriter, r *http.Request, now time.Time) *upstream {
+	var u *upstream
+	if lb.stickyCookie != "" {
+		if cookie, err := r.Cookie(lb.stickyCookie); err == nil {
+			for _, candidate := range lb.upstreams {
+				if candidate.id == cookie.Value && !candidate.ejected(now) {
+					return candidate
+				}
+			}
+		}
+	}
+	if lb.stickyKey != nil {
+		u = lb.hash(lb.stickyKey(r), now)
+	} else {
+		u = lb.pick(now)
+	}
+	if lb.stickyCookie != "" {
+		cookie := &http.Cookie{
+			Name:     lb.stickyCookie,
+			Value:    u.id,
+			Path:     "/",
+			Secure:   r.TLS != nil,
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		}
+		if lb.stickyTTL > 0 {
+			cookie.MaxAge = int(lb.stickyTTL / time.Second)
+		}
+		http.SetCookie(w, cookie)
+	}
+	return u
+}
+
+// hash returns the healthy upstream with the highest rendezvous hash score
+// for key, or the one with the highest score if all are ejected.
+func (lb *LoadBalancer) hash(key string, now time.Time) *upstream {
+	var best, bestHealthy *upstream
+	var bestScore, bestHealthyScore uint64
+	for _, u := range lb.upstreams {
+		h := fnv.New64a()
+		h.Write([]byte(u.id))
+		h.Write([]byte{0})
+		h.Write([]byte(key))
+		// FNV-1a mixes the last bytes poorly into the high bits
+		// compared here, hence the splitmix64 finalizer.
+		score := h.Sum64()
+		score = (score ^ score>>30) * 0xbf58476d1ce4e5b9
+		score = (score ^ score>>27) * 0x94d049bb133111eb
+		score ^= score >> 31
+		if best == nil || score > bestScore {
+			best, bestScore = u, score
+		}
+		if (bestHealthy == nil || score > bestHealthyScore) && !u.ejected(now) {
+			bestHealthy, bestHealthyScore = u, score
+		}
+	}
+	if bestHealthy != nil {
+		return bestHealthy
+	}
+	return best
+}
+
+// pick returns the upstream of the next request.
+func (lb *LoadBalancer) pick(now time.Time) *upstream {
+	n := len(lb.upstreams)
+	start := int((atomic.AddUint64(&lb.next, 1) - 1) % uint64(n))
+	var best *upstream
+	for _, healthyOnly := range []bool{true, false} {
+		for i := 0; i < n; i++ {
+			u := lb.upstreams[(start+i)%n]
+			if healthyOnly && u.ejected(now) {
+				continue
+			}
+			if lb.strategy == RoundRobin {
+				return u
+			}
+			if best == nil || atomic.LoadInt64(&u.active) < atomic.LoadInt64(&best.active) {
+				best = u
+			}
+		}
+		if best != nil {
+			return best
+		}
+	}
+	return best
+}
+
+// observe records the outcome of a request proxied to u.
+func (lb *LoadBalancer) observe(u *upstream, status int, now time.Time) {
+	failed := status == http.StatusBadGateway || status == http.StatusServiceUnavailable || status == http.StatusGatewayTimeout
+	if failed {
+		atomic.AddInt64(&u.failures, 1)
+	}
+	if lb.maxFailures == 0 {
+		return
+	}
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	if !failed {
+		u.consecutive = 0
+		return
+	}
+	u.consecutive++
+	if u.consecutive >= lb.maxFailures && !now.Before(u.ejectedUntil) {
+		u.ejectedUntil = now.Add(lb.ejectFor)
+		atomic.AddInt64(&u.ejections, 1)
+	}
+}
+
+func (u *upstream) ejected(now time.Time) bool {
+	u.mu.Lock()
+	defer u.mu.Unlock()
+	return now.Before(u.ejectedUntil)
+}
+
+// Stats returns the statistics of the upstreams, in the order of the targets.
+func (lb *LoadBalancer) Stats() []UpstreamStats {
+	now := time.Now()
+	stats := make([]UpstreamStats, len(lb.upstreams))
+	for i, u := range lb.upstreams {
+		stats[i] = UpstreamStats{
+			URL:       u.url.String(),
+			Active:    atomic.LoadInt64(&u.active),
+			Requests:  atomic.LoadInt64(&u.requests),
+			Failures:  atomic.LoadInt64(&u.failures),
+			Ejections: atomic.LoadInt64(&u.ejections),
+			Ejected:   u.ejected(now),
+		}
+	}
+	return stats
+}
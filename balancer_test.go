@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+func newBalancerTest(t *testing.T, backends ...http.HandlerFunc) []*url.URL {
+	var targets []*url.URL
+	for _, backend := range backends {
+		s := httptest.NewServer(backend)
+		t.Cleanup(s.Close)
+		u, _ := url.Parse(s.URL)
+		targets = append(targets, u)
+	}
+	return targets
+}
+
+func namedBackend(name string) http.HandlerFunc {
+	return func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	}
+}
+
+func TestLoadBalancerRoundRobin(t *testing.T) {
+	targets := newBalancerTest(t, namedBackend("a"), namedBackend("b"), namedBackend("c"))
+	lb, err := NewLoadBalancer(targets)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var got string
+	for i := 0; i < 6; i++ {
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, newRequest("GET", "/"))
+		got += rec.Body.String()
+	}
+	if got != "abcabc" {
+		t.Errorf("wrong rotation: %q", got)
+	}
+	for i, stats := range lb.Stats() {
+		if stats.URL != targets[i].String() || stats.Requests != 2 || stats.Active != 0 || stats.Failures != 0 {
+			t.Errorf("%d: wrong stats: %+v", i, stats)
+		}
+	}
+}
+
+func TestLoadBalancerEjection(t *testing.T) {
+	targets := newBalancerTest(t, namedBackend("a"), func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	})
+	lb, _ := NewLoadBalancer(targets, ProxyPassiveHealthCheck(2, time.Hour))
+
+	var got string
+	for i := 0; i < 8; i++ {
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, newRequest("GET", "/"))
+		if rec.Code == http.StatusOK {
+			got += rec.Body.String()
+		} else {
+			got += "!"
+		}
+	}
+	if got != "a!a!aaaa" {
+		t.Errorf("wrong responses: %q", got)
+	}
+	stats := lb.Stats()
+	if stats[1].Failures != 2 || stats[1].Ejections != 1 || !stats[1].Ejected || stats[0].Ejected {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+
+	// With every upstream ejected, requests are still spread over them.
+	lb.upstreams[0].ejectedUntil = time.Now().Add(time.Hour)
+	if u := lb.pick(time.Now()); u == nil {
+		t.Fatal("no upstream picked")
+	}
+
+	// Once back, an upstream is ejected again by a single failure.
+	u := lb.upstreams[1]
+	now := time.Now().Add(2 * time.Hour)
+	if u.ejected(now) {
+		t.Fatal("upstream still ejected")
+	}
+	lb.observe(u, http.StatusBadGateway, now)
+	if !u.ejected(now) {
+		t.Fatal("upstream not ejected again")
+	}
+	lb.observe(u, http.StatusOK, now.Add(2*time.Hour))
+	lb.observe(u, http.StatusBadGateway, now.Add(2*time.Hour))
+	if u.ejected(now.Add(2 * time.Hour)) {
+		t.Fatal("upstream ejected after a success and a single failure")
+	}
+}
+
+func TestLoadBalancerLeastConnections(t *testing.T) {
+	release := make(chan struct{})
+	started := make(chan struct{})
+	targets := newBalancerTest(t, func(w http.ResponseWriter, r *http.Request) {
+		started <- struct{}{}
+		<-release
+		w.Write([]byte("slow"))
+	}, namedBackend("b"), namedBackend("c"))
+	lb, _ := NewLoadBalancer(targets, ProxyBalance(LeastConnections))
+
+	var wg sync.WaitGroup
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		lb.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	}()
+	<-started
+
+	for i := 0; i < 4; i++ {
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, newRequest("GET", "/"))
+		if rec.Body.String() == "slow" {
+			t.Fatal("request sent to the busy upstream")
+		}
+	}
+	if stats := lb.Stats(); stats[0].Active != 1 || stats[1].Requests+stats[2].Requests != 4 {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+	close(release)
+	wg.Wait()
+}
+
+func TestLoadBalancerUnreachable(t *testing.T) {
+	down, _ := url.Parse("http://127.0.0.1:1")
+	lb, _ := NewLoadBalancer([]*url.URL{down}, ProxyPassiveHealthCheck(1, time.Minute))
+	rec := httptest.NewRecorder()
+	lb.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("wrong status: got %d want %d", rec.Code, http.StatusBadGateway)
+	}
+	if stats := lb.Stats()[0]; stats.Failures != 1 || !stats.Ejected {
+		t.Errorf("wrong stats: %+v", stats)
+	}
+}
+
+func TestNewLoadBalancer(t *testing.T) {
+	target, _ := url.Parse("http://127.0.0.1:8080")
+	relative, _ := url.Parse("/api")
+	tests := []struct {
+		targets []*url.URL
+		opts    []ReverseProxyOption
+		ok      bool
+	}{
+		{[]*url.URL{target}, []ReverseProxyOption{ProxyBalance(LeastConnections), ProxyPassiveHealthCheck(0, 0)}, true},
+		{nil, nil, false},
+		{[]*url.URL{target, relative}, nil, false},
+		{[]*url.URL{target, nil}, nil, false},
+		{[]*url.URL{target}, []ReverseProxyOption{ProxyBalance(BalanceStrategy(7))}, false},
+		{[]*url.URL{target}, []ReverseProxyOption{ProxyPassiveHealthCheck(-1, time.Second)}, false},
+		{[]*url.URL{target}, []ReverseProxyOption{ProxyTimeout(-time.Second)}, false},
+	}
+	for i, test := range tests {
+		if _, err := NewLoadBalancer(test.targets, test.opts...); (err == nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
+
+func TestLoadBalancerStickyCookie(t *testing.T) {
+	targets := newBalancerTest(t, namedBackend("a"), namedBackend("b"), namedBackend("c"))
+	lb, _ := NewLoadBalancer(targets, ProxyStickyCookie("upstream", time.Hour))
+
+	rec := httptest.NewRecorder()
+	lb.ServeHTTP(rec, newRequest("GET", "/"))
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "upstream" || cookies[0].MaxAge != 3600 || !cookies[0].HttpOnly {
+		t.Fatalf("wrong cookies: %v", cookies)
+	}
+	pinned := rec.Body.String()
+
+	for i := 0; i < 4; i++ {
+		r := newRequest("GET", "/")
+		r.AddCookie(cookies[0])
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, r)
+		if rec.Body.String() != pinned || rec.Header().Get("Set-Cookie") != "" {
+			t.Fatalf("request %d not pinned: got %q want %q, %v", i, rec.Body.String(), pinned, rec.Header())
+		}
+	}
+
+	// Clients pinned to an ejected upstream move to another one.
+	for _, u := range lb.upstreams {
+		if u.id == cookies[0].Value {
+			u.ejectedUntil = time.Now().Add(time.Hour)
+		}
+	}
+	r := newRequest("GET", "/")
+	r.AddCookie(cookies[0])
+	rec = httptest.NewRecorder()
+	lb.ServeHTTP(rec, r)
+	moved := rec.Result().Cookies()
+	if rec.Body.String() == pinned || len(moved) != 1 || moved[0].Value == cookies[0].Value {
+		t.Fatalf("client not moved: %q, %v", rec.Body.String(), moved)
+	}
+}
+
+func TestLoadBalancerStickyHash(t *testing.T) {
+	targets := newBalancerTest(t, namedBackend("a"), namedBackend("b"), namedBackend("c"), namedBackend("d"))
+	lb, _ := NewLoadBalancer(targets, ProxyStickyHash(nil))
+
+	serve := func(ip string) string {
+		r := newRequest("GET", "/")
+		r.RemoteAddr = ip + ":1234"
+		rec := httptest.NewRecorder()
+		lb.ServeHTTP(rec, r)
+		return rec.Body.String()
+	}
+	assigned := map[string]string{}
+	used := map[string]bool{}
+	for i := 0; i < 40; i++ {
+		ip := "192.0.2." + strconv.Itoa(i)
+		assigned[ip] = serve(ip)
+		used[assigned[ip]] = true
+		if again := serve(ip); again != assigned[ip] {
+			t.Fatalf("%s: moved from %q to %q", ip, assigned[ip], again)
+		}
+	}
+	if len(used) < 3 {
+		t.Errorf("keys not spread: %v", used)
+	}
+
+	// Ejecting an upstream only moves its own clients.
+	lb.upstreams[0].ejectedUntil = time.Now().Add(time.Hour)
+	for ip, name := range assigned {
+		got := serve(ip)
+		if name == "a" && got == "a" || name != "a" && got != name {
+			t.Errorf("%s: got %q, was %q", ip, got, name)
+		}
+	}
+}
@@ -0,0 +1,818 @@
+package handlers
+
+import (
+	"bytes"
+	"container/list"
+	"context"
+	"fmt"
+	"io"
+	"math/rand"
+	"net/http"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+)
+
+const (
+	defaultCacheMaxBytes      = 64 << 20
+	defaultCacheMaxEntrySize  = 1 << 20
+	defaultCacheRefreshJitter = time.Second
+	cacheStatusHeader         = "X-Cache"
+)
+
+// CachedResponse is a response stored by the response cache.
+type CachedResponse struct {
+	StatusCode int
+	Header     http.Header
+	Body       []byte
+	// StoredAt is the time the response was generated.
+	StoredAt time.Time
+	// Expires is the time the response becomes stale.
+	Expires time.Time
+	// StaleWhileRevalidate and StaleIfError are the durations past Expires
+	// during which the response may still be served while it is refreshed,
+	// or when the handler fails (RFC 5861).
+	StaleWhileRevalidate time.Duration
+	StaleIfError         time.Duration
+	// Vary lists the request headers the response varies on. An entry with
+	// a Vary list but no status code is an index pointing to the variants
+	// of a resource, which are stored under secondary keys.
+	Vary []string
+}
+
+func (cr *CachedResponse) isVaryIndex() bool {
+	return cr.StatusCode == 0 && len(cr.Vary) > 0
+}
+
+// size returns an estimate of the memory used by the response.
+func (cr *CachedResponse) size() int {
+	n := len(cr.Body) + 64
+	for k, values := range cr.Header {
+		n += len(k)
+		for _, v := range values {
+			n += len(v)
+		}
+	}
+	return n
+}
+
+// storageTTL returns for how long the response must be kept, including the
+// periods during which it may be served stale.
+func (cr *CachedResponse) storageTTL() time.Duration {
+	stale := cr.StaleWhileRevalidate
+	if cr.StaleIfError > stale {
+		stale = cr.StaleIfError
+	}
+	return time.Until(cr.Expires) + stale
+}
+
+// CacheOption represents a functional option for configuring the response
+// cache middleware.
+type CacheOption func(*responseCache) error
+
+type responseCache struct {
+	h            http.Handler
+	backend      cacheBackend
+	maxEntrySize int
+	defaultTTL   time.Duration
+	jitter       time.Duration
+
+	keyFunc        func(*http.Request) string
+	keyQuery       []string
+	keyIgnoreQuery []string
+	keyHeaders     []string
+	keyCookies     []string
+
+	name     string
+	metrics  *cacheMetrics
+	observer func(*http.Request, string)
+
+	mu         sync.Mutex
+	refreshing map[string]bool
+}
+
+// ResponseCache is HTTP middleware caching complete responses to GET and HEAD
+// requests in a size-bounded, in-memory LRU cache keyed by method and URL (see
+// the CacheKey options to customize the key), or in a shared store configured
+// with CacheWithStore. Cache hits are served without invoking the wrapped
+// handler, replaying the stored status, headers and body, with an Age header.
+// Only the headers set by the wrapped handler are stored: those set by
+// middlewares wrapping the cache, such as a request ID, are left to them.
+//
+// Freshness is controlled by the handler with the Cache-Control (s-maxage,
+// then max-age) or Expires response headers, as for a shared HTTP cache:
+// responses marked no-store, no-cache or private are never stored, and
+// responses without explicit freshness are only stored when a default TTL is
+// configured. Requests carrying an Authorization header or a no-cache or
+// no-store directive bypass the cache.
+//
+// Responses with a Vary header are cached per combination of the values of
+// the request headers it names, so that e.g. compressed and uncompressed
+// variants don't poison each other. Responses with "Vary: *" aren't cached.
+//
+// The stale-while-revalidate and stale-if-error extensions (RFC 5861) are
+// supported: within the stale-while-revalidate window, a stale response is
+// served immediately while a single background request, delayed by a random
+// jitter to spread the load, refreshes it. Within the stale-if-error window,
+// a stale response is served instead of a 5xx response from the handler.
+//
+// Every response gets an X-Cache header with the value HIT, MISS, STALE or
+// BYPASS.
+//
+// Example:
+//
+//	cache := handlers.ResponseCache(handlers.CacheMaxBytes(256 << 20))
+//	http.ListenAndServe(":1123", cache(r))
+func ResponseCache(opts ...CacheOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		c := &responseCache{
+			h:            h,
+			backend:      newLRUStore(defaultCacheMaxBytes),
+			maxEntrySize: defaultCacheMaxEntrySize,
+			jitter:       defaultCacheRefreshJitter,
+			refreshing:   map[string]bool{},
+		}
+		for _, option := range opts {
+			option(c)
+		}
+		c.metrics = &cacheMetrics{backend: c.backend}
+		if c.name != "" {
+			registerCacheMetrics(c.name, c.metrics)
+		}
+		return c
+	}
+}
+
+// NewResponseCache is like ResponseCache, but returns an error if an option
+// is invalid.
+func NewResponseCache(opts ...CacheOption) (func(http.Handler) http.Handler, error) {
+	c := &responseCache{backend: newLRUStore(defaultCacheMaxBytes)}
+	for _, option := range opts {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return ResponseCache(opts...), nil
+}
+
+// CacheMaxBytes sets the maximum total size of the responses cached in
+// memory. The least recently used responses are evicted beyond it. The
+// default is 64MiB. It has no effect with CacheWithStore.
+func CacheMaxBytes(n int) CacheOption {
+	return func(c *responseCache) error {
+		if s, ok := c.backend.(*lruStore); ok {
+			s.maxBytes = n
+		}
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid cache max bytes %d", n)
+		}
+		return nil
+	}
+}
+
+// CacheMaxEntrySize sets the maximum size of the body of a cached response.
+// Larger responses are served but not stored. The default is 1MiB.
+func CacheMaxEntrySize(n int) CacheOption {
+	return func(c *responseCache) error {
+		c.maxEntrySize = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid cache max entry size %d", n)
+		}
+		return nil
+	}
+}
+
+// CacheDefaultTTL sets for how long responses without explicit freshness
+// information are cached. By default they aren't cached.
+func CacheDefaultTTL(d time.Duration) CacheOption {
+	return func(c *responseCache) error {
+		c.defaultTTL = d
+		if d < 0 {
+			return fmt.Errorf("handlers: invalid cache default TTL %v", d)
+		}
+		return nil
+	}
+}
+
+// CacheRefreshJitter sets the maximum random delay before a stale response is
+// refreshed in the background, so that instances sharing a store don't all
+// refresh it at once. It is capped to half the stale-while-revalidate window.
+// The default is one second.
+func CacheRefreshJitter(d time.Duration) CacheOption {
+	return func(c *responseCache) error {
+		c.jitter = d
+		if d < 0 {
+			return fmt.Errorf("handlers: invalid cache refresh jitter %v", d)
+		}
+		return nil
+	}
+}
+
+// CacheKeyQueryParams restricts the query parameters included in the cache
+// key to the ones matching one of the patterns, in the syntax of path.Match.
+// By default, all parameters are included.
+func CacheKeyQueryParams(patterns ...string) CacheOption {
+	return func(c *responseCache) error {
+		c.keyQuery = patterns
+		return checkPatterns(patterns)
+	}
+}
+
+// CacheKeyIgnoreQueryParams excludes the query parameters matching one of the
+// patterns, in the syntax of path.Match, from the cache key, e.g. "utm_*" for
+// tracking parameters.
+func CacheKeyIgnoreQueryParams(patterns ...string) CacheOption {
+	return func(c *responseCache) error {
+		c.keyIgnoreQuery = patterns
+		return checkPatterns(patterns)
+	}
+}
+
+// CacheKeyHeaders adds the values of the named request headers to the cache
+// key. Unlike with Vary, the handler needn't declare them.
+func CacheKeyHeaders(names ...string) CacheOption {
+	return func(c *responseCache) error {
+		for _, name := range names {
+			c.keyHeaders = append(c.keyHeaders, http.CanonicalHeaderKey(name))
+		}
+		return nil
+	}
+}
+
+// CacheKeyCookies adds the values of the named cookies to the cache key, e.g.
+// a tenant ID.
+func CacheKeyCookies(names ...string) CacheOption {
+	return func(c *responseCache) error {
+		c.keyCookies = append(c.keyCookies, names...)
+		return nil
+	}
+}
+
+// CacheKeyFunc replaces the construction of the cache key from the request
+// URL and the CacheKey options with fn. The request method is always part of
+// the key.
+func CacheKeyFunc(fn func(r *http.Request) string) CacheOption {
+	return func(c *responseCache) error {
+		c.keyFunc = fn
+		return nil
+	}
+}
+
+// cacheKey returns the primary cache key for r. The host is case-folded and
+// the query parameters sorted, so that equivalent URLs share entries.
+func (c *responseCache) cacheKey(r *http.Request) string {
+	if c.keyFunc != nil {
+		return r.Method + " " + c.keyFunc(r)
+	}
+
+	var b strings.Builder
+	b.WriteString(r.Method)
+	b.WriteByte(' ')
+	b.WriteString(strings.ToLower(r.Host))
+	b.WriteString(r.URL.EscapedPath())
+
+	query := r.URL.Query()
+	for name := range query {
+		if (c.keyQuery != nil && !matchAny(c.keyQuery, name)) || matchAny(c.keyIgnoreQuery, name) {
+			delete(query, name)
+		}
+	}
+	if len(query) > 0 {
+		b.WriteByte('?')
+		b.WriteString(query.Encode())
+	}
+
+	for _, name := range c.keyHeaders {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteByte(':')
+		b.WriteString(strings.Join(r.Header.Values(name), ","))
+	}
+	for _, name := range c.keyCookies {
+		b.WriteString("\ncookie ")
+		b.WriteString(name)
+		b.WriteByte('=')
+		if cookie, err := r.Cookie(name); err == nil {
+			b.WriteString(cookie.Value)
+		}
+	}
+	return b.String()
+}
+
+// checkPatterns returns an error if one of the path.Match patterns is
+// malformed.
+func checkPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil {
+			return fmt.Errorf("handlers: invalid pattern %q", pattern)
+		}
+	}
+	return nil
+}
+
+// matchAny reports whether name matches one of the path.Match patterns.
+func matchAny(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func (c *responseCache) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("response_cache", w, r)
+	defer end()
+
+	if !isCacheableRequest(r) {
+		c.observe(w, r, "BYPASS")
+		c.h.ServeHTTP(w, r)
+		return
+	}
+
+	key := c.cacheKey(r)
+	if cached, ok := c.lookup(r, key); ok {
+		stale := time.Since(cached.Expires)
+		switch {
+		case stale < 0:
+			c.observe(w, r, "HIT")
+			serveCachedResponse(w, cached)
+			return
+		case stale < cached.StaleWhileRevalidate:
+			c.refresh(r, key, cached.StaleWhileRevalidate-stale)
+			c.observe(w, r, "STALE")
+			serveCachedResponse(w, cached)
+			return
+		case stale < cached.StaleIfError:
+			c.serveStaleIfError(w, r, key, cached)
+			return
+		}
+	}
+
+	c.observe(w, r, "MISS")
+	// Handlers may alter the request headers, e.g. CompressHandler removes
+	// Accept-Encoding: keep the original ones to compute the Vary key.
+	reqHeader := r.Header.Clone()
+	if entry := c.record(w, r); entry != nil {
+		c.store(r.Context(), key, reqHeader, entry)
+	}
+}
+
+// refresh updates the cached response to r in the background, unless a
+// refresh is already in progress. window is the remaining time during which
+// the stale response may be served.
+func (c *responseCache) refresh(r *http.Request, key string, window time.Duration) {
+	c.mu.Lock()
+	if c.refreshing[key] {
+		c.mu.Unlock()
+		return
+	}
+	c.refreshing[key] = true
+	c.mu.Unlock()
+
+	var delay time.Duration
+	if jitter := minDuration(c.jitter, window/2); jitter > 0 {
+		delay = time.Duration(rand.Int63n(int64(jitter)))
+	}
+
+	// The refresh outlives the request, so it must not use its context.
+	req := r.Clone(context.Background())
+	req.Body = http.NoBody
+	reqHeader := r.Header.Clone()
+	go func() {
+		defer func() {
+			c.mu.Lock()
+			delete(c.refreshing, key)
+			c.mu.Unlock()
+		}()
+		time.Sleep(delay)
+		if entry := c.record(newResponseBuffer(), req); entry != nil {
+			c.store(req.Context(), key, reqHeader, entry)
+		}
+	}()
+}
+
+// serveStaleIfError serves the request with the wrapped handler, falling back
+// to the stale cached response if the handler fails.
+func (c *responseCache) serveStaleIfError(w http.ResponseWriter, r *http.Request, key string, cached *CachedResponse) {
+	reqHeader := r.Header.Clone()
+	buf := newResponseBuffer()
+	entry := c.record(buf, r)
+	if buf.status == 0 {
+		buf.status = http.StatusOK
+	}
+	if buf.status >= 500 {
+		c.observe(w, r, "STALE")
+		serveCachedResponse(w, cached)
+		return
+	}
+	if entry != nil {
+		c.store(r.Context(), key, reqHeader, entry)
+	}
+
+	h := w.Header()
+	for k, v := range buf.header {
+		h[k] = v
+	}
+	c.observe(w, r, "MISS")
+	w.WriteHeader(buf.status)
+	w.Write(buf.body.Bytes())
+}
+
+// lookup returns the response cached for the request. When the response
+// stored under the primary key varies on request headers, the primary key
+// holds an index of these headers, and the response itself is stored under
+// a secondary key derived from their values in the request.
+func (c *responseCache) lookup(r *http.Request, key string) (*CachedResponse, bool) {
+	entry, ok := c.backend.get(r.Context(), key)
+	if !ok || !entry.isVaryIndex() {
+		return entry, ok
+	}
+	return c.backend.get(r.Context(), varyKey(key, entry.Vary, r.Header))
+}
+
+// store saves the response to the request, and a Vary index when it varies
+// on request headers.
+func (c *responseCache) store(ctx context.Context, key string, reqHeader http.Header, entry *CachedResponse) {
+	ttl := entry.storageTTL()
+	vary := varyHeaders(entry.Header)
+	if len(vary) == 0 {
+		c.backend.set(ctx, key, entry, ttl)
+		return
+	}
+
+	entry.Vary = vary
+	c.backend.set(ctx, varyKey(key, vary, reqHeader), entry, ttl)
+	c.backend.set(ctx, key, &CachedResponse{
+		Vary:                 vary,
+		StoredAt:             entry.StoredAt,
+		Expires:              entry.Expires,
+		StaleWhileRevalidate: entry.StaleWhileRevalidate,
+		StaleIfError:         entry.StaleIfError,
+	}, ttl)
+}
+
+// varyHeaders returns the canonical names of the request headers listed in
+// the Vary header, sorted and deduplicated.
+func varyHeaders(h http.Header) []string {
+	seen := map[string]bool{}
+	var names []string
+	for _, v := range h.Values("Vary") {
+		for _, name := range strings.Split(v, ",") {
+			name = http.CanonicalHeaderKey(strings.TrimSpace(name))
+			if name != "" && !seen[name] {
+				seen[name] = true
+				names = append(names, name)
+			}
+		}
+	}
+	sort.Strings(names)
+	return names
+}
+
+// varyKey returns the secondary cache key for a request, from the values of
+// the headers the response varies on. Values are normalized so that
+// insignificant differences in whitespace and case don't split the cache.
+func varyKey(key string, vary []string, h http.Header) string {
+	var b strings.Builder
+	b.WriteString(key)
+	for _, name := range vary {
+		b.WriteString("\n")
+		b.WriteString(name)
+		b.WriteByte(':')
+		values := strings.Split(strings.Join(h.Values(name), ","), ",")
+		for i, v := range values {
+			if i > 0 {
+				b.WriteByte(',')
+			}
+			b.WriteString(strings.ToLower(strings.TrimSpace(v)))
+		}
+	}
+	return b.String()
+}
+
+// record serves the request with the wrapped handler, and returns the
+// response if it can be stored.
+func (c *responseCache) record(w http.ResponseWriter, r *http.Request) *CachedResponse {
+	entry := &CachedResponse{StoredAt: time.Now()}
+	var header http.Header
+	tooLarge := false
+
+	// Only the headers set by the wrapped handler belong to the response:
+	// those set by outer middlewares, such as a request ID or a cookie, are
+	// specific to this request.
+	before := w.Header().Clone()
+	snapshot := func(code int) {
+		if header == nil {
+			entry.StatusCode = code
+			header = headerChanges(before, w.Header())
+		}
+	}
+
+	var cw http.ResponseWriter
+	cw = httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if code >= 200 {
+					snapshot(code)
+				}
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				snapshot(http.StatusOK)
+				if !tooLarge {
+					if len(entry.Body)+len(b) > c.maxEntrySize {
+						tooLarge = true
+						entry.Body = nil
+					} else {
+						entry.Body = append(entry.Body, b...)
+					}
+				}
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			// Route the body through the Write hook so it is recorded.
+			return func(src io.Reader) (int64, error) {
+				return io.Copy(writerFunc(cw.Write), src)
+			}
+		},
+	})
+
+	c.h.ServeHTTP(cw, r)
+	snapshot(http.StatusOK)
+
+	if tooLarge {
+		return nil
+	}
+	entry.Header = header
+	ttl, ok := responseTTL(entry.StatusCode, header, c.defaultTTL)
+	if !ok {
+		return nil
+	}
+	entry.Header.Del(cacheStatusHeader)
+	entry.Expires = entry.StoredAt.Add(ttl)
+	entry.StaleWhileRevalidate, entry.StaleIfError = staleWindows(header)
+	return entry
+}
+
+// headerChanges returns the headers of after which are missing from before or
+// have different values.
+func headerChanges(before, after http.Header) http.Header {
+	changed := http.Header{}
+	for name, values := range after {
+		if old, ok := before[name]; ok && equalValues(old, values) {
+			continue
+		}
+		changed[name] = append([]string(nil), values...)
+	}
+	return changed
+}
+
+func equalValues(a, b []string) bool {
+	if len(a) != len(b) {
+		return false
+	}
+	for i := range a {
+		if a[i] != b[i] {
+			return false
+		}
+	}
+	return true
+}
+
+// staleWindows returns the durations set by the stale-while-revalidate and
+// stale-if-error directives of the Cache-Control header.
+func staleWindows(header http.Header) (whileRevalidate, ifError time.Duration) {
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	seconds := func(name string) time.Duration {
+		secs, err := strconv.Atoi(directives[name])
+		if err != nil || secs < 0 {
+			return 0
+		}
+		return time.Duration(secs) * time.Second
+	}
+	return seconds("stale-while-revalidate"), seconds("stale-if-error")
+}
+
+func minDuration(a, b time.Duration) time.Duration {
+	if a < b {
+		return a
+	}
+	return b
+}
+
+// responseBuffer is a ResponseWriter holding a whole response in memory, for
+// responses which may not be sent to the client.
+type responseBuffer struct {
+	header http.Header
+	status int
+	body   bytes.Buffer
+}
+
+func newResponseBuffer() *responseBuffer {
+	return &responseBuffer{header: http.Header{}}
+}
+
+func (b *responseBuffer) Header() http.Header {
+	return b.header
+}
+
+func (b *responseBuffer) WriteHeader(code int) {
+	if b.status == 0 && code >= 200 {
+		b.status = code
+	}
+}
+
+func (b *responseBuffer) Write(p []byte) (int, error) {
+	if b.status == 0 {
+		b.status = http.StatusOK
+	}
+	return b.body.Write(p)
+}
+
+// serveCachedResponse replays a cached response. Headers already set on w,
+// by middlewares wrapping the cache, take precedence over the cached ones.
+func serveCachedResponse(w http.ResponseWriter, entry *CachedResponse) {
+	h := w.Header()
+	for k, v := range entry.Header {
+		if _, ok := h[k]; !ok {
+			h[k] = append([]string(nil), v...)
+		}
+	}
+	h.Set("Age", strconv.Itoa(int(time.Since(entry.StoredAt)/time.Second)))
+	w.WriteHeader(entry.StatusCode)
+	w.Write(entry.Body)
+}
+
+// isCacheableRequest reports whether the response to r may be served from
+// or stored in the cache.
+func isCacheableRequest(r *http.Request) bool {
+	if (r.Method != "GET" && r.Method != "HEAD") || isStreamingRequest(r) {
+		return false
+	}
+	if r.Header.Get("Authorization") != "" || r.Header.Get("Range") != "" {
+		return false
+	}
+	directives := parseCacheControl(r.Header.Get("Cache-Control"))
+	if _, ok := directives["no-store"]; ok {
+		return false
+	}
+	if _, ok := directives["no-cache"]; ok {
+		return false
+	}
+	return true
+}
+
+// cacheableStatus lists the status codes which are cacheable by default
+// (RFC 9110, section 15.1).
+var cacheableStatus = map[int]bool{
+	200: true, 203: true, 204: true, 206: false, 300: true, 301: true, 308: true,
+	404: true, 405: true, 410: true, 414: true, 501: true,
+}
+
+// responseTTL returns for how long a response may be cached, and false if it
+// must not be stored.
+func responseTTL(status int, header http.Header, defaultTTL time.Duration) (time.Duration, bool) {
+	if !cacheableStatus[status] {
+		return 0, false
+	}
+	if header.Get("Set-Cookie") != "" {
+		return 0, false
+	}
+	for _, v := range header.Values("Vary") {
+		if strings.TrimSpace(v) == "*" {
+			return 0, false
+		}
+	}
+
+	directives := parseCacheControl(header.Get("Cache-Control"))
+	for _, d := range []string{"no-store", "no-cache", "private"} {
+		if _, ok := directives[d]; ok {
+			return 0, false
+		}
+	}
+	for _, d := range []string{"s-maxage", "max-age"} {
+		if v, ok := directives[d]; ok {
+			secs, err := strconv.Atoi(v)
+			if err != nil || secs <= 0 {
+				return 0, false
+			}
+			return time.Duration(secs) * time.Second, true
+		}
+	}
+	if v := header.Get("Expires"); v != "" {
+		t, err := http.ParseTime(v)
+		if err != nil {
+			return 0, false
+		}
+		if d := time.Until(t); d > 0 {
+			return d, true
+		}
+		return 0, false
+	}
+	if defaultTTL > 0 {
+		return defaultTTL, true
+	}
+	return 0, false
+}
+
+// parseCacheControl parses the directives of a Cache-Control header into a
+// map of lower-cased names to (unquoted) values.
+func parseCacheControl(v string) map[string]string {
+	directives := map[string]string{}
+	for _, part := range strings.Split(v, ",") {
+		part = strings.TrimSpace(part)
+		if part == "" {
+			continue
+		}
+		name, value := part, ""
+		if i := strings.IndexByte(part, '='); i != -1 {
+			name, value = part[:i], strings.Trim(strings.TrimSpace(part[i+1:]), `"`)
+		}
+		directives[strings.ToLower(strings.TrimSpace(name))] = value
+	}
+	return directives
+}
+
+// lruStore is a size-bounded, least recently used store of cached responses.
+type lruStore struct {
+	mu       sync.Mutex
+	maxBytes int
+	size     int
+	ll       *list.List
+	items    map[string]*list.Element
+}
+
+type lruItem struct {
+	key   string
+	entry *CachedResponse
+	size  int
+}
+
+func newLRUStore(maxBytes int) *lruStore {
+	return &lruStore{
+		maxBytes: maxBytes,
+		ll:       list.New(),
+		items:    map[string]*list.Element{},
+	}
+}
+
+func (s *lruStore) Get(key string) (*CachedResponse, bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	el, ok := s.items[key]
+	if !ok {
+		return nil, false
+	}
+	s.ll.MoveToFront(el)
+	return el.Value.(*lruItem).entry, true
+}
+
+func (s *lruStore) Set(key string, entry *CachedResponse) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	size := entry.size() + len(key)
+	if size > s.maxBytes {
+		return
+	}
+	if el, ok := s.items[key]; ok {
+		s.removeElement(el)
+	}
+	s.items[key] = s.ll.PushFront(&lruItem{key: key, entry: entry, size: size})
+	s.size += size
+
+	for s.size > s.maxBytes {
+		s.removeElement(s.ll.Back())
+	}
+}
+
+func (s *lruStore) Delete(key string) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if el, ok := s.items[key]; ok {
+		s.removeElement(el)
+	}
+}
+
+// usage returns the number and size of the stored responses.
+func (s *lruStore) usage() (entries, bytes int64) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return int64(len(s.items)), int64(s.size)
+}
+
+func (s *lruStore) removeElement(el *list.Element) {
+	item := s.ll.Remove(el).(*lruItem)
+	delete(s.items, item.key)
+	s.size -= item.size
+}
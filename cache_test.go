@@ -0,0 +1,425 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync/atomic"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestResponseCache(t *testing.T) {
+	calls := 0
+	handler := ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		fmt.Fprintf(w, "call %d", calls)
+	}))
+
+	serve := func(target string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", target))
+		return rec
+	}
+
+	rec := serve("/a")
+	if rec.Header().Get(cacheStatusHeader) != "MISS" || rec.Body.String() != "call 1" {
+		t.Fatalf("bad first response: %v %q", rec.Header(), rec.Body.String())
+	}
+
+	// 202 Accepted isn't cacheable.
+	rec = serve("/a")
+	if calls != 2 {
+		t.Fatalf("non-cacheable response served from cache")
+	}
+
+	handler = ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "public, max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		fmt.Fprintf(w, "call %d", calls)
+	}))
+	calls = 0
+
+	serve("/a")
+	rec = serve("/a")
+	if calls != 1 {
+		t.Fatalf("handler invoked %d times, want 1", calls)
+	}
+	if rec.Header().Get(cacheStatusHeader) != "HIT" || rec.Body.String() != "call 1" || rec.Code != http.StatusOK {
+		t.Fatalf("bad cached response: %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+	if rec.Header().Get("Age") == "" || rec.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("bad cached headers: %v", rec.Header())
+	}
+
+	// Different URLs are cached separately.
+	if rec = serve("/a?page=2"); rec.Body.String() != "call 2" {
+		t.Fatalf("bad response for another URL: %q", rec.Body.String())
+	}
+}
+
+func TestResponseCacheBypass(t *testing.T) {
+	calls := 0
+	handler := ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, ok)
+	}))
+
+	tests := []func(r *http.Request){
+		func(r *http.Request) { r.Method = "POST" },
+		func(r *http.Request) { r.Header.Set("Authorization", "Bearer x") },
+		func(r *http.Request) { r.Header.Set("Cache-Control", "no-cache") },
+	}
+	for i, setup := range tests {
+		calls = 0
+		for j := 0; j < 2; j++ {
+			r := newRequest("GET", "/")
+			setup(r)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+			if rec.Header().Get(cacheStatusHeader) != "BYPASS" {
+				t.Fatalf("%d: bad X-Cache header: %q", i, rec.Header().Get(cacheStatusHeader))
+			}
+		}
+		if calls != 2 {
+			t.Fatalf("%d: handler invoked %d times, want 2", i, calls)
+		}
+	}
+}
+
+func TestResponseTTL(t *testing.T) {
+	tests := []struct {
+		status     int
+		header     http.Header
+		defaultTTL time.Duration
+		ttl        time.Duration
+		ok         bool
+	}{
+		{200, http.Header{"Cache-Control": {"max-age=60"}}, 0, time.Minute, true},
+		{200, http.Header{"Cache-Control": {"max-age=60, s-maxage=120"}}, 0, 2 * time.Minute, true},
+		{200, http.Header{"Cache-Control": {"private, max-age=60"}}, 0, 0, false},
+		{200, http.Header{"Cache-Control": {"no-store"}}, time.Hour, 0, false},
+		{200, http.Header{"Cache-Control": {"max-age=60"}, "Set-Cookie": {"a=b"}}, 0, 0, false},
+		{200, http.Header{}, 0, 0, false},
+		{200, http.Header{}, time.Hour, time.Hour, true},
+		{500, http.Header{"Cache-Control": {"max-age=60"}}, 0, 0, false},
+		{404, http.Header{"Cache-Control": {"max-age=60"}}, 0, time.Minute, true},
+	}
+
+	for i, test := range tests {
+		ttl, ok := responseTTL(test.status, test.header, test.defaultTTL)
+		if ttl != test.ttl || ok != test.ok {
+			t.Errorf("%d: got %v %t want %v %t", i, ttl, ok, test.ttl, test.ok)
+		}
+	}
+}
+
+func TestLRUStore(t *testing.T) {
+	entry := func(body string) *CachedResponse {
+		return &CachedResponse{Body: []byte(body), Header: http.Header{}}
+	}
+	s := newLRUStore(2*entry("").size() + 2*len("a") + 20)
+
+	s.Set("a", entry("0123456789"))
+	s.Set("b", entry("0123456789"))
+	s.Get("a") // a is now more recently used than b
+	s.Set("c", entry("0123456789"))
+
+	if _, ok := s.Get("b"); ok {
+		t.Fatal("least recently used entry not evicted")
+	}
+	if _, ok := s.Get("a"); !ok {
+		t.Fatal("recently used entry evicted")
+	}
+	if _, ok := s.Get("c"); !ok {
+		t.Fatal("new entry not stored")
+	}
+}
+
+func TestResponseCacheVary(t *testing.T) {
+	calls := 0
+	handler := ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "Accept-Language")
+		fmt.Fprintf(w, "lang=%s", r.Header.Get("Accept-Language"))
+	}))
+
+	serve := func(lang string) *httptest.ResponseRecorder {
+		r := newRequest("GET", "/")
+		r.Header.Set("Accept-Language", lang)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	serve("en")
+	serve("fr")
+	if calls != 2 {
+		t.Fatalf("handler invoked %d times, want 2", calls)
+	}
+
+	if rec := serve("EN "); rec.Header().Get(cacheStatusHeader) != "HIT" || rec.Body.String() != "lang=en" {
+		t.Fatalf("bad cached variant: %v %q", rec.Header(), rec.Body.String())
+	}
+	if rec := serve("fr"); rec.Header().Get(cacheStatusHeader) != "HIT" || rec.Body.String() != "lang=fr" {
+		t.Fatalf("bad cached variant: %v %q", rec.Header(), rec.Body.String())
+	}
+	if calls != 2 {
+		t.Fatalf("handler invoked %d times, want 2", calls)
+	}
+}
+
+func TestResponseCacheVaryCompression(t *testing.T) {
+	handler := ResponseCache()(CompressHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, ok)
+	})))
+
+	serve := func(encoding string) *httptest.ResponseRecorder {
+		r := newRequest("GET", "/")
+		if encoding != "" {
+			r.Header.Set("Accept-Encoding", encoding)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	serve("gzip")
+	if rec := serve(""); rec.Header().Get("Content-Encoding") != "" || rec.Body.String() != ok {
+		t.Fatalf("compressed variant served to a client not supporting it: %v", rec.Header())
+	}
+	if rec := serve("gzip"); rec.Header().Get(cacheStatusHeader) != "HIT" || rec.Header().Get("Content-Encoding") != "gzip" {
+		t.Fatalf("bad compressed variant: %v", rec.Header())
+	}
+}
+
+func TestResponseCacheVaryStar(t *testing.T) {
+	calls := 0
+	handler := ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Vary", "*")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+
+	if calls != 2 {
+		t.Fatalf("handler invoked %d times, want 2", calls)
+	}
+}
+
+func TestResponseCacheStaleWhileRevalidate(t *testing.T) {
+	var calls int32
+	refreshed := make(chan struct{}, 1)
+	handler := ResponseCache(CacheRefreshJitter(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		n := atomic.AddInt32(&calls, 1)
+		w.Header().Set("Cache-Control", "max-age=60, stale-while-revalidate=60")
+		fmt.Fprintf(w, "call %d", n)
+		if n > 1 {
+			refreshed <- struct{}{}
+		}
+	}))
+	c := handler.(*responseCache)
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	entry, _ := c.backend.get(context.Background(), "GET /")
+	entry.Expires = time.Now().Add(-time.Second)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Header().Get(cacheStatusHeader) != "STALE" || rec.Body.String() != "call 1" {
+		t.Fatalf("bad stale response: %v %q", rec.Header(), rec.Body.String())
+	}
+
+	select {
+	case <-refreshed:
+	case <-time.After(time.Second):
+		t.Fatal("stale response not refreshed")
+	}
+	for i := 0; ; i++ {
+		rec = httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", "/"))
+		if rec.Header().Get(cacheStatusHeader) == "HIT" {
+			break
+		}
+		if i == 100 {
+			t.Fatal("refreshed response not stored")
+		}
+		time.Sleep(10 * time.Millisecond)
+	}
+	if rec.Body.String() != "call 2" {
+		t.Fatalf("bad refreshed response: %q", rec.Body.String())
+	}
+}
+
+func TestResponseCacheStaleIfError(t *testing.T) {
+	fail := false
+	handler := ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if fail {
+			http.Error(w, "down", http.StatusBadGateway)
+			return
+		}
+		w.Header().Set("Cache-Control", "max-age=60, stale-if-error=60")
+		io.WriteString(w, ok)
+	}))
+	c := handler.(*responseCache)
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	entry, _ := c.backend.get(context.Background(), "GET /")
+	entry.Expires = time.Now().Add(-time.Second)
+
+	fail = true
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusOK || rec.Header().Get(cacheStatusHeader) != "STALE" || rec.Body.String() != ok {
+		t.Fatalf("stale response not served on error: %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+
+	fail = false
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Header().Get(cacheStatusHeader) != "MISS" || rec.Body.String() != ok {
+		t.Fatalf("bad response: %v %q", rec.Header(), rec.Body.String())
+	}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Header().Get(cacheStatusHeader) != "HIT" {
+		t.Fatalf("response not stored: %v", rec.Header())
+	}
+}
+
+func TestResponseCacheKey(t *testing.T) {
+	tests := []struct {
+		opts []CacheOption
+		a, b string
+		same bool
+	}{
+		{nil, "http://example.com/p?a=1&b=2", "http://EXAMPLE.com/p?b=2&a=1", true},
+		{nil, "http://example.com/p?a=1", "http://example.com/p?a=2", false},
+		{nil, "http://example.com/p", "http://example.org/p", false},
+		{[]CacheOption{CacheKeyIgnoreQueryParams("utm_*")}, "/p?a=1&utm_source=x", "/p?a=1", true},
+		{[]CacheOption{CacheKeyIgnoreQueryParams("utm_*")}, "/p?a=1", "/p?a=2", false},
+		{[]CacheOption{CacheKeyQueryParams("page")}, "/p?page=1&sid=1", "/p?page=1&sid=2", true},
+		{[]CacheOption{CacheKeyQueryParams("page")}, "/p?page=1", "/p?page=2", false},
+		{[]CacheOption{CacheKeyIgnoreQueryParams("tenant")}, "/p?tenant=a", "/p?tenant=b", true},
+		{[]CacheOption{CacheKeyIgnoreQueryParams("tenant"), CacheKeyHeaders("x-tenant")}, "/p?tenant=a", "/p?tenant=b", false},
+		{[]CacheOption{CacheKeyIgnoreQueryParams("tenant"), CacheKeyCookies("tenant")}, "/p?tenant=a", "/p?tenant=b", false},
+		{[]CacheOption{CacheKeyIgnoreQueryParams("tenant"), CacheKeyCookies("tenant")}, "/p?tenant=a", "/p?tenant=a", true},
+		{[]CacheOption{CacheKeyFunc(func(r *http.Request) string { return r.URL.Path })}, "/p?a=1", "/p?a=2", true},
+	}
+
+	for i, test := range tests {
+		c := ResponseCache(test.opts...)(okHandler).(*responseCache)
+		request := func(target string) *http.Request {
+			r := httptest.NewRequest("GET", target, nil)
+			// Copy the tenant query parameter to a header and a cookie.
+			if tenant := r.URL.Query().Get("tenant"); tenant != "" {
+				r.Header.Set("X-Tenant", tenant)
+				r.AddCookie(&http.Cookie{Name: "tenant", Value: tenant})
+			}
+			return r
+		}
+		a, b := c.cacheKey(request(test.a)), c.cacheKey(request(test.b))
+		if (a == b) != test.same {
+			t.Errorf("%d: keys %q and %q: got same=%v, want %v", i, a, b, a == b, test.same)
+		}
+	}
+}
+
+func TestNewResponseCache(t *testing.T) {
+	if _, err := NewResponseCache(CacheMaxBytes(1<<20), CacheKeyIgnoreQueryParams("utm_*")); err != nil {
+		t.Fatal(err)
+	}
+	for _, opt := range []CacheOption{
+		CacheMaxBytes(0),
+		CacheMaxEntrySize(-1),
+		CacheDefaultTTL(-time.Second),
+		CacheRefreshJitter(-time.Second),
+		CacheKeyQueryParams("[a-"),
+	} {
+		if _, err := NewResponseCache(opt); err == nil {
+			t.Errorf("expected an error")
+		}
+	}
+}
+
+func TestResponseCacheReadFrom(t *testing.T) {
+	files := http.FileServer(http.FS(fstest.MapFS{"hello.txt": {Data: []byte("hello, world")}}))
+	calls := 0
+	ts := httptest.NewServer(ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		files.ServeHTTP(w, r)
+	})))
+	defer ts.Close()
+
+	for i := 0; i < 2; i++ {
+		res, err := http.Get(ts.URL + "/hello.txt")
+		if err != nil {
+			t.Fatal(err)
+		}
+		body, _ := io.ReadAll(res.Body)
+		res.Body.Close()
+		if string(body) != "hello, world" {
+			t.Fatalf("%d: bad body %q", i, body)
+		}
+	}
+	if calls != 1 {
+		t.Fatalf("handler invoked %d times, want 1", calls)
+	}
+}
+
+func TestResponseCacheStaleIfErrorEmptyBody(t *testing.T) {
+	handler := ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60, stale-if-error=60")
+	}))
+	c := handler.(*responseCache)
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	entry, _ := c.backend.get(context.Background(), "GET /")
+	entry.Expires = time.Now().Add(-time.Second)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusOK || rec.Header().Get(cacheStatusHeader) != "MISS" || rec.Body.Len() != 0 {
+		t.Fatalf("bad response: %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+}
+
+func TestResponseCacheOuterHeaders(t *testing.T) {
+	cache := ResponseCache()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Header().Set("Content-Type", "text/plain")
+		io.WriteString(w, ok)
+	}))
+	id := 0
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		// A per-request header set by a middleware wrapping the cache.
+		id++
+		w.Header().Set("X-Request-Id", strconv.Itoa(id))
+		cache.ServeHTTP(w, r)
+	})
+
+	for i := 1; i <= 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", "/"))
+		if got := rec.Header().Values("X-Request-Id"); len(got) != 1 || got[0] != strconv.Itoa(i) {
+			t.Fatalf("bad request ID of response %d: %v", i, got)
+		}
+		if rec.Body.String() != ok || rec.Header().Get("Content-Type") != "text/plain" {
+			t.Fatalf("bad response %d: %v %q", i, rec.Header(), rec.Body.String())
+		}
+	}
+}
@@ -0,0 +1,223 @@
+package handlers
+
+import (
+	"mime"
+	"net/http"
+	"path"
+	"strings"
+	"time"
+)
+
+// Common Cache-Control directives, for use in CachePolicy.
+const (
+	// CacheImmutable suits fingerprinted assets, whose URL changes with
+	// their content: they can be cached for a year without revalidation.
+	CacheImmutable = "public, max-age=31536000, immutable"
+	// CacheNoStore forbids caching, e.g. for API responses carrying private
+	// data.
+	CacheNoStore = "no-store"
+	// CacheRevalidate allows caching but requires revalidation before every
+	// use, e.g. for HTML pages referencing fingerprinted assets.
+	CacheRevalidate = "no-cache"
+)
+
+// CachePolicy associates caching headers with the responses matching a path
+// pattern and/or a content type.
+type CachePolicy struct {
+	// Path is matched against the request path. A pattern ending with a
+	// slash matches any path below it; other patterns are matched with
+	// path.Match and may use wildcards, e.g. "/assets/*.js". An empty
+	// pattern matches all paths.
+	Path string
+	// ContentType is matched against the media type of the response, e.g.
+	// "text/html". A subtype wildcard such as "image/*" is accepted. An
+	// empty value matches all content types.
+	ContentType string
+
+	// CacheControl is the value of the Cache-Control header set on
+	// matching responses.
+	CacheControl string
+	// SurrogateControl and CDNCacheControl, if set, are the values of the
+	// Surrogate-Control and CDN-Cache-Control (RFC 9213) headers, which
+	// control caching by CDNs independently of browsers, e.g. to cache a
+	// page at the edge for an hour but not in browsers. Use
+	// StripSurrogateHeaders to keep them from reaching browsers when the
+	// server isn't behind a CDN.
+	SurrogateControl string
+	CDNCacheControl  string
+	// Expires, if non-zero, also sets an Expires header this far in the
+	// future, for HTTP/1.0 caches. A negative value sets an Expires header
+	// in the past.
+	Expires time.Duration
+	// Override makes the policy replace caching headers set by the handler,
+	// which are otherwise left untouched.
+	Override bool
+}
+
+func (p CachePolicy) matchPath(urlPath string) bool {
+	switch {
+	case p.Path == "":
+		return true
+	case strings.HasSuffix(p.Path, "/"):
+		return strings.HasPrefix(urlPath, p.Path)
+	}
+	ok, _ := path.Match(p.Path, urlPath)
+	return ok
+}
+
+func (p CachePolicy) matchContentType(ct string) bool {
+	if p.ContentType == "" {
+		return true
+	}
+	mt, _, err := mime.ParseMediaType(ct)
+	if err != nil {
+		return false
+	}
+	if strings.HasSuffix(p.ContentType, "/*") {
+		return strings.HasPrefix(mt, strings.TrimSuffix(p.ContentType, "*"))
+	}
+	return strings.EqualFold(mt, p.ContentType)
+}
+
+// CacheControl is HTTP middleware applying Cache-Control (and optionally
+// Expires) headers to responses according to declarative policies, instead
+// of scattering header sets across handlers. The first policy matching a
+// response's path and content type applies; responses with a status of 400
+// or above are left untouched so errors aren't cached.
+//
+// Example:
+//
+//	cache := handlers.CacheControl(
+//		handlers.CachePolicy{Path: "/assets/", CacheControl: handlers.CacheImmutable},
+//		handlers.CachePolicy{Path: "/api/", CacheControl: handlers.CacheNoStore},
+//		handlers.CachePolicy{ContentType: "text/html", CacheControl: "public, max-age=0, s-maxage=300"},
+//	)
+//	http.ListenAndServe(":1123", cache(r))
+func CacheControl(policies ...CachePolicy) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w, r, end := beginRequestEvent("cache_control", w, r)
+			defer end()
+
+			var candidates []CachePolicy
+			for _, p := range policies {
+				if p.matchPath(r.URL.Path) {
+					candidates = append(candidates, p)
+				}
+			}
+			if len(candidates) == 0 {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			cw, finish := beforeWriteHeader(w, func(status int) {
+				if status >= 400 {
+					return
+				}
+				header := w.Header()
+				for _, p := range candidates {
+					if p.matchContentType(header.Get("Content-Type")) {
+						applyCachePolicy(header, p)
+						return
+					}
+				}
+			})
+			h.ServeHTTP(cw, r)
+			finish()
+		})
+	}
+}
+
+func applyCachePolicy(header http.Header, p CachePolicy) {
+	set := func(name, value string) {
+		if value != "" && (p.Override || header.Get(name) == "") {
+			header.Set(name, value)
+		}
+	}
+	set(surrogateControlHeader, p.SurrogateControl)
+	set(cdnCacheControlHeader, p.CDNCacheControl)
+
+	if header.Get("Cache-Control") != "" && !p.Override {
+		return
+	}
+	header.Set("Cache-Control", p.CacheControl)
+	switch {
+	case p.Expires > 0:
+		header.Set("Expires", time.Now().Add(p.Expires).UTC().Format(http.TimeFormat))
+	case p.Expires < 0:
+		header.Set("Expires", time.Unix(0, 0).UTC().Format(http.TimeFormat))
+	}
+}
+
+const (
+	surrogateControlHeader = "Surrogate-Control"
+	cdnCacheControlHeader  = "CDN-Cache-Control"
+)
+
+// surrogateHeaders are the response headers meant for CDNs only.
+var surrogateHeaders = []string{
+	surrogateControlHeader,
+	cdnCacheControlHeader,
+	"Surrogate-Key",
+	"Cache-Tag",
+}
+
+// ViaCDN reports whether a request was forwarded by a CDN, from the headers
+// added by common CDNs: CDN-Loop (RFC 8586), Surrogate-Capability, and the
+// vendor headers of Cloudflare, Fastly, Akamai and CloudFront. It is the
+// default detection of StripSurrogateHeaders.
+func ViaCDN(r *http.Request) bool {
+	for _, name := range []string{
+		"CDN-Loop",
+		"Surrogate-Capability",
+		"Cf-Ray",
+		"Fastly-Client-Ip",
+		"Akamai-Origin-Hop",
+		"X-Amz-Cf-Id",
+	} {
+		if r.Header.Get(name) != "" {
+			return true
+		}
+	}
+	return false
+}
+
+// StripSurrogateHeaders is HTTP middleware removing the headers meant for
+// CDNs (Surrogate-Control, CDN-Cache-Control, Surrogate-Key and Cache-Tag)
+// from the responses to requests which didn't come through a CDN, as
+// reported by viaCDN, so they don't reach browsers. If viaCDN is nil,
+// ViaCDN is used. It must wrap the CacheControl middleware, or any handler
+// setting these headers.
+//
+// Example:
+//
+//	cache := handlers.CacheControl(handlers.CachePolicy{
+//		Path:             "/",
+//		CacheControl:     "public, max-age=60",
+//		SurrogateControl: "max-age=3600",
+//	})
+//	http.ListenAndServe(":1123", handlers.StripSurrogateHeaders(nil)(cache(r)))
+func StripSurrogateHeaders(viaCDN func(*http.Request) bool) func(http.Handler) http.Handler {
+	if viaCDN == nil {
+		viaCDN = ViaCDN
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w, r, end := beginRequestEvent("strip_surrogate_headers", w, r)
+			defer end()
+
+			if viaCDN(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			cw, finish := beforeWriteHeader(w, func(int) {
+				for _, name := range surrogateHeaders {
+					w.Header().Del(name)
+				}
+			})
+			h.ServeHTTP(cw, r)
+			finish()
+		})
+	}
+}
@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestCacheControl(t *testing.T) {
+	cache := CacheControl(
+		CachePolicy{Path: "/assets/*.js", CacheControl: CacheImmutable, Expires: time.Hour},
+		CachePolicy{Path: "/api/", CacheControl: CacheNoStore, Override: true},
+		CachePolicy{ContentType: "text/html", CacheControl: "public, s-maxage=300"},
+		CachePolicy{ContentType: "image/*", CacheControl: "public, max-age=86400"},
+	)
+
+	tests := []struct {
+		path         string
+		contentType  string
+		status       int
+		handlerCache string
+		want         string
+	}{
+		{"/assets/app.js", "application/javascript", 200, "", CacheImmutable},
+		{"/assets/app.css", "text/css", 200, "", ""},
+		{"/api/users", "application/json", 200, "max-age=60", CacheNoStore},
+		{"/index.html", "text/html; charset=utf-8", 200, "", "public, s-maxage=300"},
+		{"/index.html", "text/html; charset=utf-8", 200, "private", "private"},
+		{"/logo.png", "image/png", 200, "", "public, max-age=86400"},
+		{"/missing.png", "image/png", 404, "", ""},
+	}
+
+	for _, test := range tests {
+		handler := cache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			if test.handlerCache != "" {
+				w.Header().Set("Cache-Control", test.handlerCache)
+			}
+			w.WriteHeader(test.status)
+			io.WriteString(w, ok)
+		}))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", test.path))
+
+		if got := rec.Header().Get("Cache-Control"); got != test.want {
+			t.Errorf("%s (%s): bad Cache-Control: got %q want %q", test.path, test.contentType, got, test.want)
+		}
+	}
+}
+
+func TestCacheControlExpires(t *testing.T) {
+	handler := CacheControl(CachePolicy{CacheControl: CacheNoStore, Expires: -1})(okHandler)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+
+	if got, want := rec.Header().Get("Expires"), "Thu, 01 Jan 1970 00:00:00 GMT"; got != want {
+		t.Fatalf("bad Expires: got %q want %q", got, want)
+	}
+}
+
+func TestCacheControlNoWrite(t *testing.T) {
+	handler := CacheControl(CachePolicy{CacheControl: CacheNoStore})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+
+	if got := rec.Header().Get("Cache-Control"); got != CacheNoStore {
+		t.Fatalf("bad Cache-Control: got %q want %q", got, CacheNoStore)
+	}
+}
+
+func TestCacheControlSurrogate(t *testing.T) {
+	cache := CacheControl(CachePolicy{
+		CacheControl:     "public, max-age=60",
+		SurrogateControl: "max-age=3600",
+		CDNCacheControl:  "max-age=600",
+	})
+	handler := StripSurrogateHeaders(nil)(cache(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Surrogate-Key", "page-1")
+		io.WriteString(w, ok)
+	})))
+
+	r := newRequest("GET", "/")
+	r.Header.Set("CDN-Loop", "cloudflare")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	for name, want := range map[string]string{
+		"Cache-Control":     "public, max-age=60",
+		"Surrogate-Control": "max-age=3600",
+		"CDN-Cache-Control": "max-age=600",
+		"Surrogate-Key":     "page-1",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("bad %s via CDN: got %q want %q", name, got, want)
+		}
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if got := rec.Header().Get("Cache-Control"); got != "public, max-age=60" {
+		t.Errorf("bad Cache-Control: got %q", got)
+	}
+	for _, name := range surrogateHeaders {
+		if got := rec.Header().Get(name); got != "" {
+			t.Errorf("%s sent without a CDN: %q", name, got)
+		}
+	}
+}
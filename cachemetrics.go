@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"sync"
+	"sync/atomic"
+)
+
+// CacheStats reports the effectiveness of a response cache.
+type CacheStats struct {
+	Hits     int64 `json:"hits"`
+	Misses   int64 `json:"misses"`
+	Stale    int64 `json:"stale"`
+	Bypasses int64 `json:"bypasses"`
+	// Entries and Bytes are the number and estimated size of the stored
+	// responses. They are only reported for the in-memory store.
+	Entries int64 `json:"entries"`
+	Bytes   int64 `json:"bytes"`
+}
+
+// HitRatio returns the proportion of cacheable requests served from the
+// cache, fresh or stale.
+func (s CacheStats) HitRatio() float64 {
+	total := s.Hits + s.Stale + s.Misses
+	if total == 0 {
+		return 0
+	}
+	return float64(s.Hits+s.Stale) / float64(total)
+}
+
+type cacheMetrics struct {
+	hits, misses, stale, bypasses int64
+	backend                       cacheBackend
+}
+
+func (m *cacheMetrics) add(result string) {
+	switch result {
+	case "HIT":
+		atomic.AddInt64(&m.hits, 1)
+	case "MISS":
+		atomic.AddInt64(&m.misses, 1)
+	case "STALE":
+		atomic.AddInt64(&m.stale, 1)
+	case "BYPASS":
+		atomic.AddInt64(&m.bypasses, 1)
+	}
+}
+
+func (m *cacheMetrics) read() CacheStats {
+	s := CacheStats{
+		Hits:     atomic.LoadInt64(&m.hits),
+		Misses:   atomic.LoadInt64(&m.misses),
+		Stale:    atomic.LoadInt64(&m.stale),
+		Bypasses: atomic.LoadInt64(&m.bypasses),
+	}
+	if lru, ok := m.backend.(*lruStore); ok {
+		s.Entries, s.Bytes = lru.usage()
+	}
+	return s
+}
+
+var (
+	cacheMetricsMu     sync.Mutex
+	cacheMetricsByName = map[string]*cacheMetrics{}
+)
+
+// CacheName registers the cache under name, so that its statistics are
+// returned by ReadCacheStats and served by StatsHandler. Caches registered
+// under the same name replace each other.
+func CacheName(name string) CacheOption {
+	return func(c *responseCache) error {
+		c.name = name
+		return nil
+	}
+}
+
+// CacheObserver sets a function called with the outcome of each request
+// handled by the cache: "HIT", "MISS", "STALE" or "BYPASS", e.g. to feed a
+// metrics library.
+func CacheObserver(fn func(r *http.Request, result string)) CacheOption {
+	return func(c *responseCache) error {
+		c.observer = fn
+		return nil
+	}
+}
+
+// ReadCacheStats returns the statistics of the caches registered with
+// CacheName, by name.
+func ReadCacheStats() map[string]CacheStats {
+	cacheMetricsMu.Lock()
+	defer cacheMetricsMu.Unlock()
+
+	stats := make(map[string]CacheStats, len(cacheMetricsByName))
+	for name, m := range cacheMetricsByName {
+		stats[name] = m.read()
+	}
+	return stats
+}
+
+func registerCacheMetrics(name string, m *cacheMetrics) {
+	cacheMetricsMu.Lock()
+	defer cacheMetricsMu.Unlock()
+	cacheMetricsByName[name] = m
+}
+
+// observe records the outcome of a request, and sets the X-Cache header.
+func (c *responseCache) observe(w http.ResponseWriter, r *http.Request, result string) {
+	w.Header().Set(cacheStatusHeader, result)
+	c.metrics.add(result)
+	if c.observer != nil {
+		c.observer(r, result)
+	}
+}
@@ -0,0 +1,49 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestCacheMetrics(t *testing.T) {
+	var results []string
+	handler := ResponseCache(
+		CacheName("test"),
+		CacheObserver(func(r *http.Request, result string) { results = append(results, result) }),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Cache-Control", "max-age=60")
+		w.Write([]byte(ok))
+	}))
+
+	for _, method := range []string{"GET", "GET", "GET", "POST"} {
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest(method, "/"))
+	}
+
+	want := []string{"MISS", "HIT", "HIT", "BYPASS"}
+	if len(results) != len(want) {
+		t.Fatalf("bad results: got %v want %v", results, want)
+	}
+	for i := range want {
+		if results[i] != want[i] {
+			t.Fatalf("bad results: got %v want %v", results, want)
+		}
+	}
+
+	stats, ok := ReadCacheStats()["test"]
+	if !ok {
+		t.Fatal("cache not registered")
+	}
+	if stats.Hits != 2 || stats.Misses != 1 || stats.Bypasses != 1 || stats.Stale != 0 {
+		t.Fatalf("bad counters: %+v", stats)
+	}
+	if stats.Entries != 1 || stats.Bytes == 0 {
+		t.Fatalf("bad usage: %+v", stats)
+	}
+	if r := stats.HitRatio(); r < 0.66 || r > 0.67 {
+		t.Fatalf("bad hit ratio: %v", r)
+	}
+	if _, ok := ReadStats().Caches["test"]; !ok {
+		t.Fatal("cache stats missing from ReadStats")
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"time"
+)
+
+// CacheStore is a key/value store backing the response cache, such as Redis
+// or memcached, allowing responses to be shared across instances. Values are
+// serialized CachedResponses.
+//
+// Implementations must be safe for concurrent use. Get reports a missing key
+// with found set to false and a nil error.
+type CacheStore interface {
+	Get(ctx context.Context, key string) (value []byte, found bool, err error)
+	Set(ctx context.Context, key string, value []byte, ttl time.Duration) error
+	Delete(ctx context.Context, key string) error
+}
+
+// cacheBackend is the storage used by the response cache: either the
+// built-in in-memory LRU, or a CacheStore.
+type cacheBackend interface {
+	get(ctx context.Context, key string) (*CachedResponse, bool)
+	set(ctx context.Context, key string, entry *CachedResponse, ttl time.Duration)
+	delete(ctx context.Context, key string)
+}
+
+func (s *lruStore) get(ctx context.Context, key string) (*CachedResponse, bool) {
+	return s.Get(key)
+}
+
+func (s *lruStore) set(ctx context.Context, key string, entry *CachedResponse, ttl time.Duration) {
+	s.Set(key, entry)
+}
+
+func (s *lruStore) delete(ctx context.Context, key string) {
+	s.Delete(key)
+}
+
+// storeBackend adapts a CacheStore, serializing (and optionally compressing)
+// responses. Store errors are treated as cache misses.
+type storeBackend struct {
+	store CacheStore
+	level int // gzip level, or gzip.NoCompression
+}
+
+func (b *storeBackend) get(ctx context.Context, key string) (*CachedResponse, bool) {
+	v, found, err := b.store.Get(ctx, key)
+	if err != nil || !found {
+		return nil, false
+	}
+	entry := &CachedResponse{}
+	if err := entry.UnmarshalBinary(v); err != nil {
+		return nil, false
+	}
+	return entry, true
+}
+
+func (b *storeBackend) set(ctx context.Context, key string, entry *CachedResponse, ttl time.Duration) {
+	v, err := entry.marshal(b.level)
+	if err != nil {
+		return
+	}
+	b.store.Set(ctx, key, v, ttl)
+}
+
+func (b *storeBackend) delete(ctx context.Context, key string) {
+	b.store.Delete(ctx, key)
+}
+
+// CacheWithStore makes the response cache use store instead of the built-in
+// in-memory LRU. Bodies of stored responses are gzip-compressed at the given
+// level (e.g. gzip.BestSpeed); use gzip.NoCompression to store them as is.
+//
+// Example:
+//
+//	cache := handlers.ResponseCache(handlers.CacheWithStore(redisStore{client}, gzip.BestSpeed))
+func CacheWithStore(store CacheStore, level int) CacheOption {
+	return func(c *responseCache) error {
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			level = gzip.DefaultCompression
+		}
+		c.backend = &storeBackend{store: store, level: level}
+		return nil
+	}
+}
+
+// cachedResponseJSON is the serialized form of a CachedResponse.
+type cachedResponseJSON struct {
+	StatusCode int         `json:"status"`
+	Header     http.Header `json:"header"`
+	Body       []byte      `json:"body"`
+	Encoding   string      `json:"encoding,omitempty"`
+	StoredAt   time.Time   `json:"stored_at"`
+	Expires    time.Time   `json:"expires"`
+	Vary       []string    `json:"vary,omitempty"`
+	// Stale windows, in seconds.
+	StaleWhileRevalidate int64 `json:"stale_while_revalidate,omitempty"`
+	StaleIfError         int64 `json:"stale_if_error,omitempty"`
+}
+
+// MarshalBinary serializes the response, for storage in a CacheStore.
+func (cr *CachedResponse) MarshalBinary() ([]byte, error) {
+	return cr.marshal(gzip.NoCompression)
+}
+
+func (cr *CachedResponse) marshal(level int) ([]byte, error) {
+	v := cachedResponseJSON{
+		StatusCode: cr.StatusCode,
+		Header:     cr.Header,
+		Body:       cr.Body,
+		StoredAt:   cr.StoredAt,
+		Expires:    cr.Expires,
+		Vary:       cr.Vary,
+
+		StaleWhileRevalidate: int64(cr.StaleWhileRevalidate / time.Second),
+		StaleIfError:         int64(cr.StaleIfError / time.Second),
+	}
+	if level != gzip.NoCompression && len(cr.Body) > 0 {
+		var buf bytes.Buffer
+		zw, err := gzip.NewWriterLevel(&buf, level)
+		if err != nil {
+			return nil, err
+		}
+		zw.Write(cr.Body)
+		if err := zw.Close(); err != nil {
+			return nil, err
+		}
+		if buf.Len() < len(cr.Body) {
+			v.Body = buf.Bytes()
+			v.Encoding = "gzip"
+		}
+	}
+	return json.Marshal(v)
+}
+
+// UnmarshalBinary restores a response serialized with MarshalBinary.
+func (cr *CachedResponse) UnmarshalBinary(data []byte) error {
+	var v cachedResponseJSON
+	if err := json.Unmarshal(data, &v); err != nil {
+		return err
+	}
+	if v.Encoding == "gzip" {
+		zr, err := gzip.NewReader(bytes.NewReader(v.Body))
+		if err != nil {
+			return err
+		}
+		if v.Body, err = ioutil.ReadAll(zr); err != nil {
+			return err
+		}
+	}
+	*cr = CachedResponse{
+		StatusCode: v.StatusCode,
+		Header:     v.Header,
+		Body:       v.Body,
+		StoredAt:   v.StoredAt,
+		Expires:    v.Expires,
+		Vary:       v.Vary,
+
+		StaleWhileRevalidate: time.Duration(v.StaleWhileRevalidate) * time.Second,
+		StaleIfError:         time.Duration(v.StaleIfError) * time.Second,
+	}
+	return nil
+}
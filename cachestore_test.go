@@ -0,0 +1,104 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"context"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+type mapCacheStore struct {
+	mu   sync.Mutex
+	data map[string][]byte
+	ttls map[string]time.Duration
+}
+
+func newMapCacheStore() *mapCacheStore {
+	return &mapCacheStore{data: map[string][]byte{}, ttls: map[string]time.Duration{}}
+}
+
+func (s *mapCacheStore) Get(ctx context.Context, key string) ([]byte, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	v, ok := s.data[key]
+	return v, ok, nil
+}
+
+func (s *mapCacheStore) Set(ctx context.Context, key string, value []byte, ttl time.Duration) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.data[key] = value
+	s.ttls[key] = ttl
+	return nil
+}
+
+func (s *mapCacheStore) Delete(ctx context.Context, key string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	delete(s.data, key)
+	return nil
+}
+
+func TestCacheWithStore(t *testing.T) {
+	store := newMapCacheStore()
+	body := strings.Repeat("Gorilla!\n", 100)
+	calls := 0
+	origin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Cache-Control", "max-age=60")
+		fmt.Fprint(w, body)
+	})
+
+	// Two instances sharing the same store.
+	first := ResponseCache(CacheWithStore(store, gzip.BestSpeed))(origin)
+	second := ResponseCache(CacheWithStore(store, gzip.BestSpeed))(origin)
+
+	first.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	rec := httptest.NewRecorder()
+	second.ServeHTTP(rec, newRequest("GET", "/"))
+
+	if calls != 1 {
+		t.Fatalf("handler invoked %d times, want 1", calls)
+	}
+	if rec.Header().Get(cacheStatusHeader) != "HIT" || rec.Body.String() != body {
+		t.Fatalf("bad cached response: %v %q", rec.Header(), rec.Body.String())
+	}
+
+	key := "GET /"
+	if len(store.data[key]) >= len(body) {
+		t.Fatalf("stored body not compressed: %d bytes", len(store.data[key]))
+	}
+	if ttl := store.ttls[key]; ttl <= 0 || ttl > time.Minute {
+		t.Fatalf("bad TTL: %v", ttl)
+	}
+}
+
+func TestCachedResponseMarshal(t *testing.T) {
+	entry := &CachedResponse{
+		StatusCode: http.StatusOK,
+		Header:     http.Header{"Content-Type": {"text/plain"}},
+		Body:       []byte(strings.Repeat("a", 1000)),
+		StoredAt:   time.Date(2020, 1, 1, 0, 0, 0, 0, time.UTC),
+		Expires:    time.Date(2020, 1, 1, 0, 1, 0, 0, time.UTC),
+	}
+
+	for _, level := range []int{gzip.NoCompression, gzip.BestCompression} {
+		b, err := entry.marshal(level)
+		if err != nil {
+			t.Fatal(err)
+		}
+		got := &CachedResponse{}
+		if err := got.UnmarshalBinary(b); err != nil {
+			t.Fatal(err)
+		}
+		if !reflect.DeepEqual(got, entry) {
+			t.Fatalf("level %d: bad round trip: got %+v want %+v", level, got, entry)
+		}
+	}
+}
@@ -0,0 +1,297 @@
+package handlers
+
+import (
+	"fmt"
+	"hash/fnv"
+	"math"
+	"math/rand"
+	"net/http"
+	"strings"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// Names of the arms of a Canary, as reported by CanaryArm.
+const (
+	CanaryStable = "stable"
+	CanaryCanary = "canary"
+)
+
+// CanaryOption represents a functional option for configuring a Canary.
+type CanaryOption func(*Canary) error
+
+// Canary splits traffic between a stable handler and a canary handler, for
+// gradual in-process rollouts of a new implementation. The share of requests
+// sent to the canary can be changed at any time with SetPercent.
+//
+// A request is routed, by order of precedence:
+//
+//   - by the override header set with CanaryHeader, whose value is "canary"
+//     or "stable";
+//   - by the assignment cookie set by an earlier response, with
+//     CanaryCookie;
+//   - by a hash of its key (see CanaryKey), so that each client sticks to
+//     one arm as long as the percentage doesn't change.
+//
+// The arm serving a request is available to its handler with CanaryArm and is
+// attached to its access log entry as the field "canary" (see SetLogField).
+// Request, error and latency counts of each arm are reported by Stats.
+//
+// Example:
+//
+//	c, err := handlers.NewCanary(oldSearch, newSearch, 5, handlers.CanaryName("search"))
+//	...
+//	mux.Handle("/search", c)
+//	...
+//	c.SetPercent(25) // after checking c.Stats()
+type Canary struct {
+	stable, canary http.Handler
+	// percent is stored as math.Float64bits.
+	percent    uint64
+	header     string
+	cookieName string
+	key        func(*http.Request) string
+	name       string
+	metrics    *canaryMetrics
+}
+
+// CanaryStats reports the traffic served by each arm of a Canary.
+type CanaryStats struct {
+	Percent float64        `json:"percent"`
+	Stable  CanaryArmStats `json:"stable"`
+	Canary  CanaryArmStats `json:"canary"`
+}
+
+// CanaryArmStats reports the traffic served by an arm of a Canary.
+type CanaryArmStats struct {
+	Requests int64 `json:"requests"`
+	// Errors counts the responses with a 5xx status code.
+	Errors int64 `json:"errors"`
+	// Duration is the total time spent serving the requests.
+	Duration time.Duration `json:"duration"`
+}
+
+// ErrorRate returns the proportion of requests answered with a 5xx status
+// code.
+func (s CanaryArmStats) ErrorRate() float64 {
+	if s.Requests == 0 {
+		return 0
+	}
+	return float64(s.Errors) / float64(s.Requests)
+}
+
+type canaryArmMetrics struct {
+	requests, errors, duration int64
+}
+
+func (m *canaryArmMetrics) add(status int, d time.Duration) {
+	atomic.AddInt64(&m.requests, 1)
+	if status >= 500 {
+		atomic.AddInt64(&m.errors, 1)
+	}
+	atomic.AddInt64(&m.duration, int64(d))
+}
+
+func (m *canaryArmMetrics) read() CanaryArmStats {
+	return CanaryArmStats{
+		Requests: atomic.LoadInt64(&m.requests),
+		Errors:   atomic.LoadInt64(&m.errors),
+		Duration: time.Duration(atomic.LoadInt64(&m.duration)),
+	}
+}
+
+type canaryMetrics struct {
+	c              *Canary
+	stable, canary canaryArmMetrics
+}
+
+func (m *canaryMetrics) read() CanaryStats {
+	return CanaryStats{Percent: m.c.Percent(), Stable: m.stable.read(), Canary: m.canary.read()}
+}
+
+var (
+	canaryMetricsMu     sync.Mutex
+	canaryMetricsByName = map[string]*canaryMetrics{}
+)
+
+// canaryArm is stored in the request context by Canary.
+type canaryArm string
+
+// CanaryName registers the canary under name, so that its statistics are
+// returned by ReadCanaryStats and served by StatsHandler. Canaries registered
+// under the same name replace each other.
+func CanaryName(name string) CanaryOption {
+	return func(c *Canary) error {
+		c.name = name
+		return nil
+	}
+}
+
+// CanaryHeader sets the name of the request header forcing a request to an
+// arm, e.g. "X-Canary". There is none by default, as any client could pick
+// its arm; an empty name disables overrides.
+func CanaryHeader(name string) CanaryOption {
+	return func(c *Canary) error {
+		c.header = name
+		return nil
+	}
+}
+
+// CanaryCookie makes the canary remember the arm of each client in the named
+// cookie, so that clients stick to their arm when the percentage changes, and
+// honors the cookie as an override.
+func CanaryCookie(name string) CanaryOption {
+	return func(c *Canary) error {
+		c.cookieName = name
+		return nil
+	}
+}
+
+// CanaryKey sets the function identifying the client of a request, e.g. a
+// user ID, which is hashed to pick its arm. It defaults to the client IP
+// address. Requests with an empty key are routed at random.
+func CanaryKey(fn func(r *http.Request) string) CanaryOption {
+	return func(c *Canary) error {
+		c.key = fn
+		return nil
+	}
+}
+
+// NewCanary returns a Canary sending percent (from 0 to 100) of the requests
+// to canary, and the others to stable. It returns an error if a handler is
+// nil, percent is out of range or an option is invalid.
+func NewCanary(stable, canary http.Handler, percent float64, opts ...CanaryOption) (*Canary, error) {
+	if stable == nil || canary == nil {
+		return nil, fmt.Errorf("handlers: nil canary handler")
+	}
+	c := &Canary{
+		stable: stable,
+		canary: canary,
+		key: func(r *http.Request) string {
+			return hostOnly(r.RemoteAddr)
+		},
+	}
+	c.metrics = &canaryMetrics{c: c}
+	if err := c.SetPercent(percent); err != nil {
+		return nil, err
+	}
+	for _, option := range opts {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	if c.name != "" {
+		canaryMetricsMu.Lock()
+		canaryMetricsByName[c.name] = c.metrics
+		canaryMetricsMu.Unlock()
+	}
+	return c, nil
+}
+
+// SetPercent sets the percentage of requests sent to the canary, from 0 to
+// 100. Requests routed by cookie or header aren't affected.
+func (c *Canary) SetPercent(percent float64) error {
+	if percent < 0 || percent > 100 || math.IsNaN(percent) {
+		return fmt.Errorf("handlers: invalid canary percentage %v", percent)
+	}
+	atomic.StoreUint64(&c.percent, math.Float64bits(percent))
+	return nil
+}
+
+// Percent returns the percentage of requests sent to the canary.
+func (c *Canary) Percent() float64 {
+	return math.Float64frombits(atomic.LoadUint64(&c.percent))
+}
+
+// Stats returns the traffic served by each arm so far.
+func (c *Canary) Stats() CanaryStats {
+	return c.metrics.read()
+}
+
+func (c *Canary) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("canary", w, r)
+	defer end()
+
+	arm, sticky := c.route(r)
+	if c.cookieName != "" && !sticky {
+		http.SetCookie(w, &http.Cookie{
+			Name:     c.cookieName,
+			Value:    arm,
+			Path:     "/",
+			HttpOnly: true,
+			SameSite: http.SameSiteLaxMode,
+		})
+	}
+
+	h, m := c.stable, &c.metrics.stable
+	if arm == CanaryCanary {
+		h, m = c.canary, &c.metrics.canary
+	}
+	SetLogField(r, "canary", arm)
+
+	start := time.Now()
+	logger, w := makeLogger(w)
+	h.ServeHTTP(w, WithValue(r, canaryArm(arm)))
+	m.add(logger.Status(), time.Since(start))
+}
+
+// route returns the arm serving r, and whether it was chosen by header or
+// cookie.
+func (c *Canary) route(r *http.Request) (string, bool) {
+	if c.header != "" {
+		if arm := parseCanaryArm(r.Header.Get(c.header)); arm != "" {
+			return arm, true
+		}
+	}
+	if c.cookieName != "" {
+		if cookie, err := r.Cookie(c.cookieName); err == nil {
+			if arm := parseCanaryArm(cookie.Value); arm != "" {
+				return arm, true
+			}
+		}
+	}
+
+	var bucket uint32
+	if k := c.key(r); k != "" {
+		h := fnv.New32a()
+		h.Write([]byte(k))
+		bucket = h.Sum32()
+	} else {
+		bucket = rand.Uint32()
+	}
+	if float64(bucket%10000) < c.Percent()*100 {
+		return CanaryCanary, false
+	}
+	return CanaryStable, false
+}
+
+func parseCanaryArm(v string) string {
+	switch strings.ToLower(strings.TrimSpace(v)) {
+	case CanaryCanary:
+		return CanaryCanary
+	case CanaryStable:
+		return CanaryStable
+	}
+	return ""
+}
+
+// CanaryArm returns the arm of the Canary serving r, CanaryStable or
+// CanaryCanary, or an empty string if r isn't served through a Canary.
+func CanaryArm(r *http.Request) string {
+	arm, _ := Value[canaryArm](r)
+	return string(arm)
+}
+
+// ReadCanaryStats returns the statistics of the canaries registered with
+// CanaryName, by name.
+func ReadCanaryStats() map[string]CanaryStats {
+	canaryMetricsMu.Lock()
+	defer canaryMetricsMu.Unlock()
+
+	stats := make(map[string]CanaryStats, len(canaryMetricsByName))
+	for name, m := range canaryMetricsByName {
+		stats[name] = m.read()
+	}
+	return stats
+}
@@ -0,0 +1,106 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func newTestCanary(t *testing.T, percent float64, opts ...CanaryOption) *Canary {
+	stable := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(CanaryArm(r)))
+	})
+	canary := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusInternalServerError)
+		w.Write([]byte(CanaryArm(r)))
+	})
+	c, err := NewCanary(stable, canary, percent, opts...)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return c
+}
+
+func TestCanarySplit(t *testing.T) {
+	c := newTestCanary(t, 20, CanaryName("test"))
+	serve := func(i int) string {
+		r := newRequest("GET", "/")
+		r.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+		rec := httptest.NewRecorder()
+		c.ServeHTTP(rec, r)
+		return rec.Body.String()
+	}
+
+	arms := map[int]string{}
+	for i := 0; i < 1000; i++ {
+		arms[i] = serve(i)
+	}
+	stats := ReadCanaryStats()["test"]
+	if stats.Canary.Requests < 150 || stats.Canary.Requests > 250 || stats.Stable.Requests+stats.Canary.Requests != 1000 {
+		t.Fatalf("wrong split: %+v", stats)
+	}
+	if stats.Canary.Errors != stats.Canary.Requests || stats.Stable.Errors != 0 || stats.Canary.ErrorRate() != 1 {
+		t.Fatalf("wrong error counts: %+v", stats)
+	}
+
+	// Raising the percentage only moves stable clients to the canary.
+	c.SetPercent(50)
+	for i := 0; i < 1000; i++ {
+		if arms[i] == CanaryCanary && serve(i) != CanaryCanary {
+			t.Fatalf("client %d moved back to stable", i)
+		}
+	}
+	if got := c.Stats().Percent; got != 50 {
+		t.Fatalf("wrong percentage: %v", got)
+	}
+}
+
+func TestCanaryOverrides(t *testing.T) {
+	r := newRequest("GET", "/")
+	r.Header.Set("X-Canary", CanaryCanary)
+	rec := httptest.NewRecorder()
+	newTestCanary(t, 0).ServeHTTP(rec, r)
+	if rec.Body.String() != CanaryStable {
+		t.Fatalf("header override without CanaryHeader: wrong response: %q", rec.Body.String())
+	}
+
+	c := newTestCanary(t, 0, CanaryCookie("arm"), CanaryHeader("X-Canary"))
+
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, newRequest("GET", "/"))
+	cookies := rec.Result().Cookies()
+	if rec.Body.String() != CanaryStable || len(cookies) != 1 || cookies[0].Value != CanaryStable {
+		t.Fatalf("wrong response: %q %v", rec.Body.String(), cookies)
+	}
+
+	r = newRequest("GET", "/")
+	r.Header.Set("X-Canary", "Canary")
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, r)
+	if rec.Body.String() != CanaryCanary || len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("header override: wrong response: %q", rec.Body.String())
+	}
+
+	r = newRequest("GET", "/")
+	r.AddCookie(&http.Cookie{Name: "arm", Value: CanaryCanary})
+	rec = httptest.NewRecorder()
+	c.ServeHTTP(rec, r)
+	if rec.Body.String() != CanaryCanary {
+		t.Fatalf("cookie override: wrong response: %q", rec.Body.String())
+	}
+}
+
+func TestNewCanaryErrors(t *testing.T) {
+	h := http.NotFoundHandler()
+	if _, err := NewCanary(nil, h, 10); err == nil {
+		t.Error("no error for a nil handler")
+	}
+	if _, err := NewCanary(h, h, 101); err == nil {
+		t.Error("no error for an invalid percentage")
+	}
+	c, _ := NewCanary(h, h, 10)
+	if err := c.SetPercent(-1); err == nil || c.Percent() != 10 {
+		t.Errorf("invalid percentage accepted: %v", c.Percent())
+	}
+}
@@ -1,20 +1,65 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
 	"net/url"
 	"strings"
 )
 
+// CanonicalHostOption represents a functional option for configuring
+// CanonicalHost.
+type CanonicalHostOption func(*canonical) error
+
 type canonical struct {
-	h      http.Handler
-	domain string
-	code   int
+	h          http.Handler
+	domain     string
+	code       int
+	forceHTTPS bool
+	skip       []func(r *http.Request) bool
+}
+
+// CanonicalHostForceHTTPS makes CanonicalHost also redirect requests which
+// weren't made over HTTPS to the canonical domain with the https scheme. Behind
+// a proxy terminating TLS, requests are considered made over HTTPS if their
+// X-Forwarded-Proto header says so, or their scheme was set by ProxyHeaders.
+func CanonicalHostForceHTTPS() CanonicalHostOption {
+	return func(c *canonical) error {
+		c.forceHTTPS = true
+		return nil
+	}
+}
+
+// CanonicalHostSkip makes CanonicalHost serve the requests for which fn
+// returns true without redirecting them, e.g. the health checks of a load
+// balancer, which probe instances by address and don't follow redirects.
+//
+// Example:
+//
+//	handlers.CanonicalHostSkip(func(r *http.Request) bool {
+//		return r.URL.Path == "/healthz"
+//	})
+func CanonicalHostSkip(fn func(r *http.Request) bool) CanonicalHostOption {
+	return func(c *canonical) error {
+		if fn == nil {
+			return errors.New("handlers: nil canonical host skip function")
+		}
+		c.skip = append(c.skip, fn)
+		return nil
+	}
 }
 
 // CanonicalHost is HTTP middleware that re-directs requests to the canonical
 // domain. It accepts a domain and a status code (e.g. 301 or 302) and
-// re-directs clients to this domain. The existing request path is maintained.
+// re-directs clients to this domain. The existing request path and query
+// string are maintained. Use 307 or 308 for the redirected requests to keep
+// their method and body, e.g. those of forms.
+//
+// With CanonicalHostForceHTTPS, requests made over plain HTTP are redirected
+// too. CanonicalHostSkip exempts requests from redirects. Invalid options, such
+// as a nil CanonicalHostSkip function, are ignored: use NewCanonicalHost to
+// have them reported.
 //
 // Note: If the provided domain is considered invalid by url.Parse or otherwise
 // returns an empty scheme or host, clients are not re-directed.
@@ -27,15 +72,47 @@ type canonical struct {
 //
 //  log.Fatal(http.ListenAndServe(":7000", canonical(r)))
 //
-func CanonicalHost(domain string, code int) func(h http.Handler) http.Handler {
+func CanonicalHost(domain string, code int, opts ...CanonicalHostOption) func(h http.Handler) http.Handler {
 	fn := func(h http.Handler) http.Handler {
-		return canonical{h, domain, code}
+		c := canonical{h: h, domain: domain, code: code}
+		for _, option := range opts {
+			option(&c)
+		}
+		return c
 	}
 
 	return fn
 }
 
+// NewCanonicalHost is like CanonicalHost, but returns an error if domain isn't
+// an absolute URL, code isn't a redirect status, or an option is invalid.
+func NewCanonicalHost(domain string, code int, opts ...CanonicalHostOption) (func(h http.Handler) http.Handler, error) {
+	if dest, err := url.Parse(domain); err != nil || dest.Scheme == "" || dest.Host == "" {
+		return nil, fmt.Errorf("handlers: invalid canonical domain %q", domain)
+	}
+	if code < 300 || code > 399 {
+		return nil, fmt.Errorf("handlers: invalid redirect status %d", code)
+	}
+	c := canonical{}
+	for _, option := range opts {
+		if err := option(&c); err != nil {
+			return nil, err
+		}
+	}
+	return CanonicalHost(domain, code, opts...), nil
+}
+
 func (c canonical) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("canonical", w, r)
+	defer end()
+
+	for _, skip := range c.skip {
+		if skip(r) {
+			c.h.ServeHTTP(w, r)
+			return
+		}
+	}
+
 	dest, err := url.Parse(c.domain)
 	if err != nil {
 		// Call the next handler if the provided domain fails to parse.
@@ -50,9 +127,16 @@ func (c canonical) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	if !strings.EqualFold(cleanHost(r.Host), dest.Host) {
+	scheme := dest.Scheme
+	redirect := !strings.EqualFold(cleanHost(r.Host), dest.Host)
+	if c.forceHTTPS {
+		scheme = "https"
+		redirect = redirect || !isHTTPSRequest(r)
+	}
+
+	if redirect {
 		// Re-build the destination URL
-		dest := dest.Scheme + "://" + dest.Host + r.URL.Path
+		dest := scheme + "://" + dest.Host + r.URL.EscapedPath()
 		if r.URL.RawQuery != "" {
 			dest += "?" + r.URL.RawQuery
 		}
@@ -63,6 +147,19 @@ func (c canonical) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 	c.h.ServeHTTP(w, r)
 }
 
+// isHTTPSRequest reports whether r was made over HTTPS, directly or through a
+// proxy terminating TLS.
+func isHTTPSRequest(r *http.Request) bool {
+	if r.TLS != nil || strings.EqualFold(r.URL.Scheme, "https") {
+		return true
+	}
+	proto := r.Header.Get(xForwardedProto)
+	if i := strings.IndexByte(proto, ','); i != -1 {
+		proto = proto[:i]
+	}
+	return strings.EqualFold(strings.TrimSpace(proto), "https")
+}
+
 // cleanHost cleans invalid Host headers by stripping anything after '/' or ' '.
 // This is backported from Go 1.5 (in response to issue #11206) and attempts to
 // mitigate malformed Host headers that do not match the format in RFC7230.
@@ -125,3 +125,74 @@ func TestHeaderWrites(t *testing.T) {
 		t.Fatalf("re-direct did not return early: multiple header writes")
 	}
 }
+
+func TestCanonicalHostForceHTTPS(t *testing.T) {
+	handler := CanonicalHost("http://example.com", http.StatusPermanentRedirect, CanonicalHostForceHTTPS())(okHandler)
+
+	tests := []struct {
+		name     string
+		url      string
+		proto    string
+		location string
+	}{
+		{"http", "http://example.com/a%2Fb?q=1", "", "https://example.com/a%2Fb?q=1"},
+		{"other host", "https://www.example.com/", "", "https://example.com/"},
+		{"https", "https://example.com/", "", ""},
+		{"forwarded https", "http://example.com/", "https", ""},
+		{"forwarded http", "http://example.com/", "http", "https://example.com/"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRequest("POST", test.url)
+			if test.proto != "" {
+				r.Header.Set("X-Forwarded-Proto", test.proto)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if test.location == "" {
+				if rec.Code != http.StatusOK {
+					t.Fatalf("unexpected redirect to %q", rec.Header().Get("Location"))
+				}
+				return
+			}
+			if rec.Code != http.StatusPermanentRedirect || rec.Header().Get("Location") != test.location {
+				t.Fatalf("bad redirect: got %d %q want %d %q", rec.Code, rec.Header().Get("Location"), http.StatusPermanentRedirect, test.location)
+			}
+		})
+	}
+}
+
+func TestCanonicalHostSkip(t *testing.T) {
+	handler := CanonicalHost("https://example.com", http.StatusMovedPermanently,
+		CanonicalHostForceHTTPS(),
+		CanonicalHostSkip(func(r *http.Request) bool { return r.URL.Path == "/healthz" }),
+	)(okHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "http://10.0.0.7/healthz"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("health check redirected to %q", rec.Header().Get("Location"))
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "http://10.0.0.7/"))
+	if rec.Code != http.StatusMovedPermanently {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusMovedPermanently)
+	}
+}
+
+func TestNewCanonicalHost(t *testing.T) {
+	if _, err := NewCanonicalHost("https://example.com", http.StatusMovedPermanently, CanonicalHostForceHTTPS()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewCanonicalHost("example.com", http.StatusMovedPermanently); err == nil {
+		t.Fatal("expected an error for a domain without scheme")
+	}
+	if _, err := NewCanonicalHost("https://example.com", http.StatusOK); err == nil {
+		t.Fatal("expected an error for a non-redirect status")
+	}
+	if _, err := NewCanonicalHost("https://example.com", http.StatusFound, CanonicalHostSkip(nil)); err == nil {
+		t.Fatal("expected an error for a nil skip function")
+	}
+}
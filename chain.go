@@ -0,0 +1,70 @@
+package handlers
+
+import "net/http"
+
+// Middleware is a function wrapping a http.Handler, such as those returned by
+// CORS or RecoveryHandler.
+type Middleware = func(http.Handler) http.Handler
+
+// Chain composes middlewares into one, the first being the outermost:
+// Chain(a, b, c)(h) is a(b(c(h))).
+//
+// Example:
+//
+//	stack := handlers.Chain(
+//		handlers.RecoveryHandler(),
+//		handlers.RequestIDHandler(),
+//		handlers.CORS(),
+//	)
+//	http.ListenAndServe(":1123", stack(r))
+func Chain(mw ...Middleware) Middleware {
+	return Stack(mw).Then
+}
+
+// Stack is an ordered list of middlewares, the first being the outermost,
+// built up with Append and Extend. A Stack is never modified in place, so a
+// base stack can be shared between routes.
+//
+// Example:
+//
+//	base := handlers.NewStack(handlers.RecoveryHandler(), handlers.RequestIDHandler())
+//	api := base.Append(handlers.CORS(), handlers.CompressHandler)
+//	mux.Handle("/api/", api.Then(apiHandler))
+//	mux.Handle("/", base.Then(site))
+type Stack []Middleware
+
+// NewStack returns a Stack of the given middlewares.
+func NewStack(mw ...Middleware) Stack {
+	return append(Stack(nil), mw...)
+}
+
+// Append returns a new Stack with mw added after (inside of) the middlewares
+// of s.
+func (s Stack) Append(mw ...Middleware) Stack {
+	stack := make(Stack, 0, len(s)+len(mw))
+	stack = append(stack, s...)
+	return append(stack, mw...)
+}
+
+// Extend returns a new Stack with the middlewares of other added after
+// (inside of) those of s.
+func (s Stack) Extend(other Stack) Stack {
+	return s.Append(other...)
+}
+
+// Then wraps h with the middlewares of s. A nil h is replaced by
+// http.DefaultServeMux.
+func (s Stack) Then(h http.Handler) http.Handler {
+	if h == nil {
+		h = http.DefaultServeMux
+	}
+	for i := len(s) - 1; i >= 0; i-- {
+		h = s[i](h)
+	}
+	return h
+}
+
+// ThenFunc wraps fn with the middlewares of s.
+func (s Stack) ThenFunc(fn http.HandlerFunc) http.Handler {
+	return s.Then(fn)
+}
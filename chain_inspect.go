@@ -0,0 +1,336 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+// MiddlewareInfo describes a middleware in a handler chain, as reported by
+// Inspect.
+type MiddlewareInfo struct {
+	// Name identifies the middleware, e.g. "cors".
+	Name string
+	// Summary is a short, human readable description of its configuration.
+	Summary string
+}
+
+func (mi MiddlewareInfo) String() string {
+	if mi.Summary == "" {
+		return mi.Name
+	}
+	return fmt.Sprintf("%s(%s)", mi.Name, mi.Summary)
+}
+
+// chainLink is implemented by the middlewares which can be inspected.
+type chainLink interface {
+	middlewareInfo() MiddlewareInfo
+	next() http.Handler
+}
+
+type namedHandler struct {
+	http.Handler
+	info  MiddlewareInfo
+	inner http.Handler
+}
+
+func (nh *namedHandler) middlewareInfo() MiddlewareInfo { return nh.info }
+func (nh *namedHandler) next() http.Handler             { return nh.inner }
+
+// Named wraps mw so that the handlers it produces are reported by Inspect
+// with the given name and configuration summary. Most middlewares of this
+// package are reported without it; Named is meant for third-party
+// middlewares and for the function-based ones, such as CompressHandler.
+//
+// Example:
+//
+//	compress := handlers.Named("compress", "gzip", handlers.CompressHandler)
+//	h := handlers.CORS()(compress(handlers.LoggingHandler(os.Stdout, r)))
+//	log.Println(handlers.DescribeChain(h))
+//	// cors(origins=* methods=GET,HEAD,POST) -> compress(gzip) -> logging(common) -> *http.ServeMux
+func Named(name, summary string, mw func(http.Handler) http.Handler) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return &namedHandler{
+			Handler: mw(h),
+			info:    MiddlewareInfo{Name: name, Summary: summary},
+			inner:   h,
+		}
+	}
+}
+
+// Inspect returns the middlewares applied to h, outermost first. The walk
+// stops at the first handler which is neither a middleware of this package
+// nor wrapped with Named.
+func Inspect(h http.Handler) []MiddlewareInfo {
+	var chain []MiddlewareInfo
+	for h != nil {
+		link, ok := h.(chainLink)
+		if !ok {
+			break
+		}
+		chain = append(chain, link.middlewareInfo())
+		h = link.next()
+	}
+	return chain
+}
+
+// DescribeChain returns a one-line description of the middlewares applied to
+// h, followed by the type of the innermost handler, suitable for logging at
+// startup.
+func DescribeChain(h http.Handler) string {
+	var parts []string
+	for h != nil {
+		link, ok := h.(chainLink)
+		if !ok {
+			parts = append(parts, fmt.Sprintf("%T", h))
+			break
+		}
+		parts = append(parts, link.middlewareInfo().String())
+		h = link.next()
+	}
+	return strings.Join(parts, " -> ")
+}
+
+// Inspection support for the middlewares of this package.
+
+func (ch *cors) middlewareInfo() MiddlewareInfo {
+	origins := "*"
+	if ch.allowedOriginValidator != nil {
+		origins = "validator"
+	} else if len(ch.allowedOrigins) > 0 || len(ch.originPatterns) > 0 {
+		list := append([]string(nil), ch.allowedOrigins...)
+		for _, p := range ch.originPatterns {
+			list = append(list, p.pattern)
+		}
+		origins = strings.Join(list, ",")
+	}
+	summary := fmt.Sprintf("origins=%s methods=%s", origins, strings.Join(ch.allowedMethods, ","))
+	if ch.allowCredentials {
+		summary += " credentials"
+	}
+	return MiddlewareInfo{Name: "cors", Summary: summary}
+}
+
+func (ch *cors) next() http.Handler { return ch.h }
+
+func (h loggingHandler) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "logging", Summary: h.format}
+}
+
+func (h loggingHandler) next() http.Handler { return h.handler }
+
+func (h *recoveryHandler) middlewareInfo() MiddlewareInfo {
+	summary := ""
+	if h.printStack {
+		summary = "stack"
+	}
+	return MiddlewareInfo{Name: "recovery", Summary: summary}
+}
+
+func (h *recoveryHandler) next() http.Handler { return h.handler }
+
+func (c canonical) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "canonical_host", Summary: fmt.Sprintf("%s %d", c.domain, c.code)}
+}
+
+func (c canonical) next() http.Handler { return c.h }
+
+func (rh *requestID) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "request_id", Summary: rh.header}
+}
+
+func (rh *requestID) next() http.Handler { return rh.h }
+
+func (c *chaos) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "chaos", Summary: fmt.Sprintf("enabled=%t", c.enabled())}
+}
+
+func (c *chaos) next() http.Handler { return c.h }
+
+func (a *acmeChallenge) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "acme_challenge"}
+}
+
+func (a *acmeChallenge) next() http.Handler { return a.fallback }
+
+func (v *apiVersions) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "api_version", Summary: v.header}
+}
+
+func (v *apiVersions) next() http.Handler { return v.h }
+
+func (c *responseCache) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "response_cache"}
+}
+
+func (c *responseCache) next() http.Handler { return c.h }
+
+func (c *compressor) middlewareInfo() MiddlewareInfo {
+	names := make([]string, len(c.encoders))
+	for i, enc := range c.encoders {
+		names[i] = enc.name
+	}
+	return MiddlewareInfo{Name: "compress", Summary: strings.Join(names, ",")}
+}
+
+func (c *compressor) next() http.Handler { return c.h }
+
+func (c *conditional) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "conditional"}
+}
+
+func (c *conditional) next() http.Handler { return c.h }
+
+func (d *deprecation) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "deprecation"}
+}
+
+func (d *deprecation) next() http.Handler { return d.h }
+
+func (d *digest) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "digest"}
+}
+
+func (d *digest) next() http.Handler { return d.h }
+
+func (e *etag) middlewareInfo() MiddlewareInfo {
+	summary := ""
+	if e.weak {
+		summary = "weak"
+	}
+	return MiddlewareInfo{Name: "etag", Summary: summary}
+}
+
+func (e *etag) next() http.Handler { return e.h }
+
+func (e *experiment) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "experiment", Summary: e.name}
+}
+
+func (e *experiment) next() http.Handler { return e.h }
+
+func (f *featureFlags) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "feature_flags"}
+}
+
+func (f *featureFlags) next() http.Handler { return f.h }
+
+func (f *fixtures) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "fixtures", Summary: f.dir}
+}
+
+func (f *fixtures) next() http.Handler { return f.h }
+
+func (g *graphQLGuard) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "graphql_guard"}
+}
+
+func (g *graphQLGuard) next() http.Handler { return g.h }
+
+func (g *guard) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "guard", Summary: fmt.Sprintf("enabled=%t", !g.disabled)}
+}
+
+func (g *guard) next() http.Handler { return g.h }
+
+func (i *instrument) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "instrument"}
+}
+
+func (i *instrument) next() http.Handler { return i.h }
+
+func (l *locales) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "locale"}
+}
+
+func (l *locales) next() http.Handler { return l.h }
+
+func (m *methodOverride) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "method_override", Summary: m.header}
+}
+
+func (m *methodOverride) next() http.Handler { return m.h }
+
+func (m *minify) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "minify"}
+}
+
+func (m *minify) next() http.Handler { return m.h }
+
+func (v *openAPIValidator) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "openapi"}
+}
+
+func (v *openAPIValidator) next() http.Handler { return v.h }
+
+func (p *problemResponder) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "problem"}
+}
+
+func (p *problemResponder) next() http.Handler { return p.h }
+
+func (p *trustedProxyHeaders) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "proxy_headers"}
+}
+
+func (p *trustedProxyHeaders) next() http.Handler { return p.h }
+
+func (rr *ranges) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "ranges"}
+}
+
+func (rr *ranges) next() http.Handler { return rr.h }
+
+func (l *rateLimiter) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "rate_limit", Summary: fmt.Sprintf("rate=%g/s burst=%d", l.rate, l.burst)}
+}
+
+func (l *rateLimiter) next() http.Handler { return l.h }
+
+func (s *scrubber) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "scrub"}
+}
+
+func (s *scrubber) next() http.Handler { return s.h }
+
+func (s *secureHeaders) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "secure_headers"}
+}
+
+func (s *secureHeaders) next() http.Handler { return s.h }
+
+func (s *sendfile) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "sendfile", Summary: s.header}
+}
+
+func (s *sendfile) next() http.Handler { return s.h }
+
+func (p *slowProfiler) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "slow_profile", Summary: p.threshold.String()}
+}
+
+func (p *slowProfiler) next() http.Handler { return p.h }
+
+func (s *subdomains) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "subdomains"}
+}
+
+func (s *subdomains) next() http.Handler { return s.h }
+
+func (t *tenants[T]) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "tenant"}
+}
+
+func (t *tenants[T]) next() http.Handler { return t.h }
+
+func (t *timeout) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "timeout", Summary: t.d.String()}
+}
+
+func (t *timeout) next() http.Handler { return t.h }
+
+func (u *multipartUpload) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "upload"}
+}
+
+func (u *multipartUpload) next() http.Handler { return u.h }
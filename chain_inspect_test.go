@@ -0,0 +1,58 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestInspect(t *testing.T) {
+	compress := Named("compress", "gzip", CompressHandler)
+	h := CORS(AllowedOrigins([]string{"https://example.com"}))(
+		compress(
+			LoggingHandler(ioutil.Discard,
+				RecoveryHandler(PrintRecoveryStack(true))(okHandler))))
+
+	want := []MiddlewareInfo{
+		{"cors", "origins=https://example.com methods=GET,HEAD,POST"},
+		{"compress", "gzip"},
+		{"logging", "common"},
+		{"recovery", "stack"},
+	}
+	if got := Inspect(h); !reflect.DeepEqual(got, want) {
+		t.Fatalf("bad chain:\ngot  %v\nwant %v", got, want)
+	}
+
+	wantDesc := "cors(origins=https://example.com methods=GET,HEAD,POST) -> compress(gzip) -> logging(common) -> recovery(stack) -> http.HandlerFunc"
+	if got := DescribeChain(h); got != wantDesc {
+		t.Fatalf("bad description:\ngot  %q\nwant %q", got, wantDesc)
+	}
+}
+
+func TestInspectUnknownHandler(t *testing.T) {
+	// The walk stops at handlers which can't be inspected.
+	h := CompressHandler(LoggingHandler(ioutil.Discard, okHandler))
+	if got := Inspect(h); len(got) != 0 {
+		t.Fatalf("expected empty chain, got %v", got)
+	}
+
+	var nilHandler http.Handler
+	if got := DescribeChain(nilHandler); got != "" {
+		t.Fatalf("expected empty description, got %q", got)
+	}
+}
+
+func TestInspectStructMiddlewares(t *testing.T) {
+	h := RateLimit(10, time.Second, RateLimitBurst(5))(
+		Timeout(time.Second)(
+			SecureHeaders()(
+				Instrument(&testCollector{})(
+					ResponseCache()(okHandler)))))
+
+	want := "rate_limit(rate=10/s burst=5) -> timeout(1s) -> secure_headers -> instrument -> response_cache -> http.HandlerFunc"
+	if got := DescribeChain(h); got != want {
+		t.Fatalf("bad description:\ngot  %q\nwant %q", got, want)
+	}
+}
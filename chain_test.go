@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func tagMiddleware(tag string, trace *[]string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			*trace = append(*trace, tag)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestChain(t *testing.T) {
+	var trace []string
+	h := Chain(tagMiddleware("a", &trace), tagMiddleware("b", &trace))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		trace = append(trace, "h")
+	}))
+	h.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	if want := []string{"a", "b", "h"}; !reflect.DeepEqual(trace, want) {
+		t.Fatalf("got %v want %v", trace, want)
+	}
+}
+
+func TestStack(t *testing.T) {
+	var trace []string
+	base := NewStack(tagMiddleware("a", &trace))
+	s1 := base.Append(tagMiddleware("b", &trace))
+	s2 := base.Extend(NewStack(tagMiddleware("c", &trace), tagMiddleware("d", &trace)))
+
+	final := func(w http.ResponseWriter, r *http.Request) { trace = append(trace, "h") }
+	for _, test := range []struct {
+		stack Stack
+		want  []string
+	}{
+		{base, []string{"a", "h"}},
+		{s1, []string{"a", "b", "h"}},
+		{s2, []string{"a", "c", "d", "h"}},
+		{NewStack(), []string{"h"}},
+	} {
+		trace = nil
+		test.stack.ThenFunc(final).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+		if !reflect.DeepEqual(trace, test.want) {
+			t.Errorf("got %v want %v", trace, test.want)
+		}
+	}
+}
+
+func TestStackInspect(t *testing.T) {
+	h := NewStack(RequestIDHandler(), RecoveryHandler()).Then(http.NotFoundHandler())
+	infos := Inspect(h)
+	if len(infos) != 2 || infos[0].Name != "request_id" || infos[1].Name != "recovery" {
+		t.Fatalf("wrong chain: %v", infos)
+	}
+}
@@ -0,0 +1,265 @@
+package handlers
+
+import (
+	"io"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// ChaosOption represents a functional option for configuring the fault
+// injection middleware.
+type ChaosOption func(*chaos) error
+
+type chaos struct {
+	h       http.Handler
+	enabled func() bool
+	trigger string
+
+	latencyMin, latencyMax time.Duration
+	latencyRate            float64
+
+	errorCode int
+	errorRate float64
+
+	dropRate float64
+
+	truncateAt   int
+	truncateRate float64
+}
+
+// Fault names accepted in the trigger header.
+const (
+	chaosLatency  = "latency"
+	chaosError    = "error"
+	chaosDrop     = "drop"
+	chaosTruncate = "truncate"
+)
+
+// Chaos is HTTP middleware injecting faults into responses for resilience
+// testing: added latency, error responses, dropped connections and truncated
+// bodies. Each fault applies to a configured fraction of requests, or to
+// every request carrying the trigger header.
+//
+// The middleware is disabled unless ChaosEnabled or ChaosEnabledFunc is
+// given, so it can be left in place and switched on in staging only.
+//
+// Example:
+//
+//	chaos := handlers.Chaos(
+//		handlers.ChaosEnabled(os.Getenv("ENV") == "staging"),
+//		handlers.ChaosLatency(100*time.Millisecond, 2*time.Second, 0.1),
+//		handlers.ChaosError(http.StatusServiceUnavailable, 0.01),
+//		handlers.ChaosTriggerHeader("X-Chaos"),
+//	)
+//	http.ListenAndServe(":1123", chaos(r))
+func Chaos(opts ...ChaosOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		c := &chaos{
+			h:         h,
+			enabled:   func() bool { return false },
+			errorCode: http.StatusInternalServerError,
+		}
+		for _, option := range opts {
+			option(c)
+		}
+		return c
+	}
+}
+
+// ChaosEnabled enables or disables fault injection.
+func ChaosEnabled(enabled bool) ChaosOption {
+	return func(c *chaos) error {
+		c.enabled = func() bool { return enabled }
+		return nil
+	}
+}
+
+// ChaosEnabledFunc sets a function consulted on every request to decide
+// whether fault injection is enabled, allowing it to be toggled at runtime.
+func ChaosEnabledFunc(fn func() bool) ChaosOption {
+	return func(c *chaos) error {
+		if fn != nil {
+			c.enabled = fn
+		}
+		return nil
+	}
+}
+
+// ChaosLatency delays a fraction (between 0 and 1) of requests by a random
+// duration between min and max before they reach the handler.
+func ChaosLatency(min, max time.Duration, rate float64) ChaosOption {
+	return func(c *chaos) error {
+		if max < min {
+			min, max = max, min
+		}
+		c.latencyMin, c.latencyMax, c.latencyRate = min, max, rate
+		return nil
+	}
+}
+
+// ChaosError responds to a fraction (between 0 and 1) of requests with the
+// given status code instead of invoking the handler.
+func ChaosError(code int, rate float64) ChaosOption {
+	return func(c *chaos) error {
+		c.errorCode, c.errorRate = code, rate
+		return nil
+	}
+}
+
+// ChaosDrop closes the connection of a fraction (between 0 and 1) of
+// requests without sending any response.
+func ChaosDrop(rate float64) ChaosOption {
+	return func(c *chaos) error {
+		c.dropRate = rate
+		return nil
+	}
+}
+
+// ChaosTruncate cuts the response body of a fraction (between 0 and 1) of
+// requests after n bytes, then aborts the connection so clients observe a
+// truncated transfer.
+func ChaosTruncate(n int, rate float64) ChaosOption {
+	return func(c *chaos) error {
+		c.truncateAt, c.truncateRate = n, rate
+		return nil
+	}
+}
+
+// ChaosTriggerHeader sets a request header forcing fault injection. When the
+// header is present, every configured fault applies regardless of its rate.
+// Its value may restrict this to a comma-separated list of faults among
+// "latency", "error", "drop" and "truncate".
+func ChaosTriggerHeader(name string) ChaosOption {
+	return func(c *chaos) error {
+		c.trigger = http.CanonicalHeaderKey(name)
+		return nil
+	}
+}
+
+func (c *chaos) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("chaos", w, r)
+	defer end()
+
+	if !c.enabled() {
+		c.h.ServeHTTP(w, r)
+		return
+	}
+
+	var forced map[string]bool
+	if c.trigger != "" {
+		if v, ok := r.Header[c.trigger]; ok {
+			forced = map[string]bool{}
+			for _, name := range strings.Split(strings.Join(v, ","), ",") {
+				if name = strings.ToLower(strings.TrimSpace(name)); name != "" {
+					forced[name] = true
+				}
+			}
+			if len(forced) == 0 {
+				forced = map[string]bool{chaosLatency: true, chaosError: true, chaosDrop: true, chaosTruncate: true}
+			}
+		}
+	}
+	apply := func(name string, rate float64) bool {
+		if forced != nil {
+			return forced[name]
+		}
+		return rate > 0 && rand.Float64() < rate
+	}
+
+	if c.latencyMax > 0 && apply(chaosLatency, c.latencyRate) {
+		d := c.latencyMin
+		if spread := c.latencyMax - c.latencyMin; spread > 0 {
+			d += time.Duration(rand.Int63n(int64(spread)))
+		}
+		select {
+		case <-time.After(d):
+		case <-r.Context().Done():
+			return
+		}
+	}
+
+	if c.dropRate > 0 || forced != nil {
+		if apply(chaosDrop, c.dropRate) {
+			dropConnection(w)
+			return
+		}
+	}
+
+	if c.errorRate > 0 || forced != nil {
+		if apply(chaosError, c.errorRate) {
+			http.Error(w, http.StatusText(c.errorCode), c.errorCode)
+			return
+		}
+	}
+
+	if c.truncateAt > 0 && apply(chaosTruncate, c.truncateRate) {
+		c.serveTruncated(w, r)
+		return
+	}
+
+	c.h.ServeHTTP(w, r)
+}
+
+func (c *chaos) serveTruncated(w http.ResponseWriter, r *http.Request) {
+	written := 0
+	truncated := false
+	var tw http.ResponseWriter
+	tw = httpsnoop.Wrap(w, httpsnoop.Hooks{
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				if room := c.truncateAt - written; len(b) > room {
+					truncated = true
+					if room > 0 {
+						n, _ := next(b[:room])
+						written += n
+					}
+					// Pretend everything was written so the handler carries on.
+					return len(b), nil
+				}
+				n, err := next(b)
+				written += n
+				return n, err
+			}
+		},
+		ReadFrom: func(httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			// Bypass the ReadFrom optimization so that the body goes
+			// through the truncating Write hook.
+			return func(src io.Reader) (int64, error) {
+				return io.Copy(writerFunc(tw.Write), src)
+			}
+		},
+	})
+
+	c.h.ServeHTTP(tw, r)
+
+	if truncated {
+		if f, ok := w.(http.Flusher); ok {
+			f.Flush()
+		}
+		dropConnection(w)
+	}
+}
+
+// dropConnection closes the underlying connection of w without completing the
+// response.
+func dropConnection(w http.ResponseWriter) {
+	if hj, ok := w.(http.Hijacker); ok {
+		if conn, _, err := hj.Hijack(); err == nil {
+			conn.Close()
+			return
+		}
+	}
+	// Makes the server abort the response and close the connection.
+	panic(http.ErrAbortHandler)
+}
+
+// writerFunc adapts a function to the io.Writer interface.
+type writerFunc func([]byte) (int, error)
+
+func (f writerFunc) Write(b []byte) (int, error) {
+	return f(b)
+}
@@ -0,0 +1,132 @@
+package handlers
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestChaosDisabled(t *testing.T) {
+	handler := Chaos(ChaosError(http.StatusServiceUnavailable, 1))(okHandler)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestChaosError(t *testing.T) {
+	handler := Chaos(ChaosEnabled(true), ChaosError(http.StatusServiceUnavailable, 1))(okHandler)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestChaosLatency(t *testing.T) {
+	handler := Chaos(ChaosEnabled(true), ChaosLatency(20*time.Millisecond, 20*time.Millisecond, 1))(okHandler)
+	start := time.Now()
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+
+	if d := time.Since(start); d < 20*time.Millisecond {
+		t.Fatalf("request not delayed: took %v", d)
+	}
+}
+
+func TestChaosTriggerHeader(t *testing.T) {
+	handler := Chaos(
+		ChaosEnabled(true),
+		ChaosError(http.StatusBadGateway, 0),
+		ChaosTriggerHeader("X-Chaos"),
+	)(okHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bad status without trigger: got %d want %d", rec.Code, http.StatusOK)
+	}
+
+	r := newRequest("GET", "/")
+	r.Header.Set("X-Chaos", "error")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("bad status with trigger: got %d want %d", rec.Code, http.StatusBadGateway)
+	}
+
+	r.Header.Set("X-Chaos", "latency")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bad status with other fault triggered: got %d want %d", rec.Code, http.StatusOK)
+	}
+}
+
+func TestChaosDropAndTruncate(t *testing.T) {
+	body := strings.Repeat("Gorilla!\n", 100)
+	handler := Chaos(
+		ChaosEnabled(true),
+		ChaosDrop(0),
+		ChaosTruncate(10, 0),
+		ChaosTriggerHeader("X-Chaos"),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, body)
+	}))
+
+	srv := httptest.NewServer(handler)
+	defer srv.Close()
+
+	get := func(fault string) (string, error) {
+		req, _ := http.NewRequest("GET", srv.URL, nil)
+		req.Header.Set("X-Chaos", fault)
+		res, err := http.DefaultClient.Do(req)
+		if err != nil {
+			return "", err
+		}
+		defer res.Body.Close()
+		b, err := ioutil.ReadAll(res.Body)
+		return string(b), err
+	}
+
+	if _, err := get("drop"); err == nil {
+		t.Fatal("expected an error for a dropped connection")
+	}
+
+	b, err := get("truncate")
+	if err == nil {
+		t.Fatal("expected an error for a truncated body")
+	}
+	if b != body[:10] {
+		t.Fatalf("bad truncated body: got %q want %q", b, body[:10])
+	}
+}
+
+func TestChaosTruncateReadFrom(t *testing.T) {
+	body := strings.Repeat("Gorilla!\n", 100)
+	srv := httptest.NewServer(Chaos(ChaosEnabled(true), ChaosTruncate(10, 1))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.Copy(w, io.LimitReader(strings.NewReader(body), int64(len(body))))
+		}),
+	))
+	defer srv.Close()
+
+	res, err := http.Get(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err == nil {
+		t.Fatal("expected an error for a truncated body")
+	}
+	if string(b) != body[:10] {
+		t.Fatalf("bad truncated body: got %q want %q", b, body[:10])
+	}
+}
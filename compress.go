@@ -7,6 +7,7 @@ package handlers
 import (
 	"compress/flate"
 	"compress/gzip"
+	"fmt"
 	"io"
 	"net/http"
 	"strings"
@@ -55,6 +56,8 @@ func (w *compressResponseWriter) Flush() {
 	}
 }
 
+var compressInFlight = newInFlightCounter("compress")
+
 // CompressHandler gzip compresses HTTP responses for clients that support it
 // via the 'Accept-Encoding' header.
 //
@@ -81,6 +84,10 @@ func CompressHandlerLevel(h http.Handler, level int) http.Handler {
 	)
 
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		defer compressInFlight.track()()
+		w, r, end := beginRequestEvent("compress", w, r)
+		defer end()
+
 		// detect what encoding to use
 		var encoding string
 		for _, curEnc := range strings.Split(r.Header.Get(acceptEncoding), ",") {
@@ -101,7 +108,7 @@ func CompressHandlerLevel(h http.Handler, level int) http.Handler {
 			return
 		}
 
-		if r.Header.Get("Upgrade") != "" {
+		if isStreamingRequest(r) {
 			h.ServeHTTP(w, r)
 			return
 		}
@@ -141,3 +148,12 @@ func CompressHandlerLevel(h http.Handler, level int) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 }
+
+// NewCompress returns a middleware like CompressHandlerLevel, or an error if
+// the compression level is invalid instead of falling back to the default.
+func NewCompress(level int) (func(http.Handler) http.Handler, error) {
+	if level < gzip.DefaultCompression || level > gzip.BestCompression {
+		return nil, fmt.Errorf("handlers: invalid compression level %d", level)
+	}
+	return func(h http.Handler) http.Handler { return CompressHandlerLevel(h, level) }, nil
+}
@@ -298,3 +298,16 @@ func TestCompressHandlerDoesntInventInterfaces(t *testing.T) {
 	r.Header.Set(acceptEncoding, "gzip")
 	h.ServeHTTP(rw, r)
 }
+
+func TestNewCompress(t *testing.T) {
+	for _, level := range []int{gzip.DefaultCompression, gzip.NoCompression, gzip.BestCompression} {
+		if _, err := NewCompress(level); err != nil {
+			t.Errorf("level %d: %v", level, err)
+		}
+	}
+	for _, level := range []int{-2, 10} {
+		if _, err := NewCompress(level); err == nil {
+			t.Errorf("level %d: expected an error", level)
+		}
+	}
+}
@@ -0,0 +1,482 @@
+package handlers
+
+import (
+	"compress/flate"
+	"compress/gzip"
+	"errors"
+	"fmt"
+	"io"
+	"mime"
+	"net/http"
+	"path"
+	"strconv"
+	"strings"
+	"sync"
+
+	"github.com/felixge/httpsnoop"
+)
+
+const defaultCompressMinSize = 1024
+
+// defaultCompressExcludedTypes are the content types Compress leaves alone by
+// default, as they are compressed already.
+var defaultCompressExcludedTypes = []string{
+	"image/*",
+	"audio/*",
+	"video/*",
+	"font/woff",
+	"font/woff2",
+	"application/gzip",
+	"application/x-gzip",
+	"application/zip",
+	"application/zstd",
+	"application/x-bzip2",
+	"application/x-7z-compressed",
+	"application/x-rar-compressed",
+	"application/pdf",
+}
+
+// CompressOption represents a functional option for configuring Compress.
+type CompressOption func(*compressor) error
+
+type compressor struct {
+	h        http.Handler
+	level    int
+	minSize  int
+	types    []string
+	excluded []string
+	// encoders are in the order of preference of the server.
+	encoders []*compressEncoder
+}
+
+// compressEncoder is a content coding supported by Compress.
+type compressEncoder struct {
+	name string
+	new  func(w io.Writer, level int) (io.WriteCloser, error)
+	// pool recycles the encoders which can be reset to a new writer, such
+	// as those of compress/gzip, which are costly to allocate.
+	pool sync.Pool
+}
+
+type resetter interface {
+	Reset(w io.Writer)
+}
+
+// CompressLevel sets the compression level of the gzip and deflate encodings,
+// from gzip.HuffmanOnly to gzip.BestCompression, gzip.DefaultCompression by
+// default. It is also passed to the encoders added with CompressEncoder.
+func CompressLevel(level int) CompressOption {
+	return func(c *compressor) error {
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return fmt.Errorf("handlers: invalid compression level %d", level)
+		}
+		c.level = level
+		return nil
+	}
+}
+
+// CompressMinSize sets the size below which responses aren't compressed, 1KiB
+// by default, as compressing them saves little and costs CPU. Responses are
+// buffered until they reach it, unless their Content-Length is set or they
+// are flushed.
+func CompressMinSize(n int) CompressOption {
+	return func(c *compressor) error {
+		c.minSize = n
+		if n < 0 {
+			return fmt.Errorf("handlers: invalid compression min size %d", n)
+		}
+		return nil
+	}
+}
+
+// CompressTypes restricts compression to the responses whose content type
+// matches one of patterns, e.g. "application/json" or "text/*". By default
+// all content types are compressed, but those of CompressExcludeTypes.
+func CompressTypes(patterns ...string) CompressOption {
+	return func(c *compressor) error {
+		c.types = append(c.types, lowerPatterns(patterns)...)
+		return validMediaTypePatterns(patterns)
+	}
+}
+
+// CompressExcludeTypes leaves alone the responses whose content type matches
+// one of patterns, in addition to the images, audio, video, fonts and archives
+// excluded by default, which are compressed already.
+func CompressExcludeTypes(patterns ...string) CompressOption {
+	return func(c *compressor) error {
+		c.excluded = append(c.excluded, lowerPatterns(patterns)...)
+		return validMediaTypePatterns(patterns)
+	}
+}
+
+// CompressEncoder adds a content coding, e.g. "br" or "zstd", whose encoders
+// are returned by fn for the given compression level. Encoders having a
+// Reset(io.Writer) method are reused across responses. Added encodings are
+// preferred over gzip and deflate when clients accept them equally, in the
+// order they are added; adding an encoding again replaces it.
+//
+// Example, with github.com/andybalholm/brotli:
+//
+//	handlers.CompressEncoder("br", func(w io.Writer, level int) (io.WriteCloser, error) {
+//		return brotli.NewWriterLevel(w, brotli.DefaultCompression), nil
+//	})
+func CompressEncoder(name string, fn func(w io.Writer, level int) (io.WriteCloser, error)) CompressOption {
+	return func(c *compressor) error {
+		if name == "" || fn == nil {
+			return errors.New("handlers: invalid compression encoder")
+		}
+		name = strings.ToLower(name)
+		// Added encoders go after the previously added ones, before the
+		// built-in ones.
+		var added, builtin []*compressEncoder
+		for _, e := range c.encoders {
+			switch {
+			case e.name == name:
+			case e.name == "gzip" || e.name == "deflate":
+				builtin = append(builtin, e)
+			default:
+				added = append(added, e)
+			}
+		}
+		added = append(added, &compressEncoder{name: name, new: fn})
+		c.encoders = append(added, builtin...)
+		return nil
+	}
+}
+
+// Compress is HTTP middleware compressing responses with the content coding
+// the client prefers among those of its Accept-Encoding header: gzip and
+// deflate, and the encodings added with CompressEncoder, e.g. brotli or
+// zstd. It honors quality values, e.g. "br;q=1.0, gzip;q=0.8, *;q=0".
+//
+// Responses smaller than CompressMinSize, of excluded content types, partial,
+// with no content, already encoded or marked Cache-Control: no-transform are
+// sent as is. Compressed responses have their ETag weakened, as their bytes
+// differ from those of the identity encoding, and all of them vary on
+// Accept-Encoding.
+//
+// Flushing the response flushes the encoder too, so that server-sent events
+// and other streams reach clients as they are written. Hijacking connections
+// and close notifications are passed through, and upgrade and RPC requests
+// aren't compressed.
+//
+// Compressing TLS traffic may leak the page contents to an attacker if the
+// page contains user input: http://security.stackexchange.com/a/102015/12208
+//
+// Example:
+//
+//	compress := handlers.Compress(
+//		handlers.CompressLevel(gzip.BestSpeed),
+//		handlers.CompressTypes("application/json", "text/*"),
+//	)
+//	http.ListenAndServe(":1123", compress(r))
+func Compress(opts ...CompressOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		c := newCompressor()
+		c.h = h
+		for _, option := range opts {
+			option(c)
+		}
+		return c
+	}
+}
+
+// NewCompressor is like Compress, but returns an error if an option is
+// invalid.
+func NewCompressor(opts ...CompressOption) (func(http.Handler) http.Handler, error) {
+	c := newCompressor()
+	for _, option := range opts {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return Compress(opts...), nil
+}
+
+func newCompressor() *compressor {
+	return &compressor{
+		level:    gzip.DefaultCompression,
+		minSize:  defaultCompressMinSize,
+		excluded: defaultCompressExcludedTypes,
+		encoders: []*compressEncoder{
+			{name: "gzip", new: func(w io.Writer, level int) (io.WriteCloser, error) {
+				return gzip.NewWriterLevel(w, level)
+			}},
+			{name: "deflate", new: func(w io.Writer, level int) (io.WriteCloser, error) {
+				return flate.NewWriter(w, level)
+			}},
+		},
+	}
+}
+
+func (c *compressor) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	defer compressInFlight.track()()
+	w, r, end := beginRequestEvent("compress", w, r)
+	defer end()
+
+	addVary(w.Header(), acceptEncoding)
+	enc := c.negotiate(r.Header.Get(acceptEncoding))
+	if enc == nil || r.Method == http.MethodHead || isStreamingRequest(r) {
+		c.h.ServeHTTP(w, r)
+		return
+	}
+
+	cw := &compressWriter{c: c, enc: enc, w: w}
+	defer cw.close()
+	c.h.ServeHTTP(httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return cw.WriteHeader
+		},
+		Write: func(httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return cw.Write
+		},
+		ReadFrom: func(httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				return io.Copy(writerOnly{cw}, src)
+			}
+		},
+		Flush: func(httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return cw.Flush
+		},
+	}), r)
+}
+
+// negotiate returns the encoder of the content coding preferred by the client
+// per accept, the Accept-Encoding header of its request, or nil if it
+// accepts none of them.
+func (c *compressor) negotiate(accept string) *compressEncoder {
+	if accept == "" {
+		return nil
+	}
+	type coding struct {
+		name string
+		q    float64
+	}
+	var codings []coding
+	for _, part := range strings.Split(accept, ",") {
+		name, params, _ := strings.Cut(part, ";")
+		name = strings.ToLower(strings.TrimSpace(name))
+		if name == "" {
+			continue
+		}
+		q := 1.0
+		if k, v, ok := strings.Cut(strings.TrimSpace(params), "="); ok && strings.TrimSpace(k) == "q" {
+			f, err := strconv.ParseFloat(strings.TrimSpace(v), 64)
+			if err != nil || f < 0 || f > 1 {
+				continue
+			}
+			q = f
+		}
+		codings = append(codings, coding{name, q})
+	}
+
+	var best *compressEncoder
+	bestQ := 0.0
+	for _, e := range c.encoders {
+		q, listed, star := 0.0, false, -1.0
+		for _, cd := range codings {
+			switch cd.name {
+			case e.name:
+				q, listed = cd.q, true
+			case "*":
+				star = cd.q
+			}
+		}
+		if !listed && star >= 0 {
+			q = star
+		}
+		if q > bestQ {
+			best, bestQ = e, q
+		}
+	}
+	return best
+}
+
+// compressible reports whether a response with status code and headers h
+// should be compressed.
+func (c *compressor) compressible(code int, h http.Header) bool {
+	if code < 200 || code == http.StatusNoContent || code == http.StatusPartialContent ||
+		code == http.StatusNotModified || h.Get("Content-Encoding") != "" {
+		return false
+	}
+	for _, v := range h.Values("Cache-Control") {
+		if strings.Contains(strings.ToLower(v), "no-transform") {
+			return false
+		}
+	}
+	mt, _, err := mime.ParseMediaType(h.Get("Content-Type"))
+	if err != nil {
+		return len(c.types) == 0
+	}
+	if matchMediaTypePattern(c.excluded, mt) {
+		return false
+	}
+	return len(c.types) == 0 || matchMediaTypePattern(c.types, mt)
+}
+
+func (e *compressEncoder) get(w io.Writer, level int) (io.WriteCloser, error) {
+	if v := e.pool.Get(); v != nil {
+		wc := v.(io.WriteCloser)
+		wc.(resetter).Reset(w)
+		return wc, nil
+	}
+	return e.new(w, level)
+}
+
+func (e *compressEncoder) put(wc io.WriteCloser) {
+	if _, ok := wc.(resetter); ok {
+		e.pool.Put(wc)
+	}
+}
+
+// compressWriter buffers the response until it knows whether to compress it.
+type compressWriter struct {
+	c   *compressor
+	enc *compressEncoder
+	w   http.ResponseWriter
+
+	code    int
+	buf     []byte
+	started bool
+	encoder io.WriteCloser // nil if the response isn't compressed
+}
+
+func (cw *compressWriter) WriteHeader(code int) {
+	if cw.started || cw.code != 0 {
+		return
+	}
+	if code < 200 && code != http.StatusSwitchingProtocols {
+		// Informational responses, e.g. 103 Early Hints, go through.
+		cw.w.WriteHeader(code)
+		return
+	}
+	cw.code = code
+	if !cw.c.compressible(code, cw.w.Header()) {
+		cw.start(false)
+		return
+	}
+	if cl := cw.w.Header().Get("Content-Length"); cl != "" {
+		n, err := strconv.Atoi(cl)
+		cw.start(err == nil && n >= cw.c.minSize)
+	}
+}
+
+func (cw *compressWriter) Write(b []byte) (int, error) {
+	if !cw.started {
+		cw.buf = append(cw.buf, b...)
+		if len(cw.buf) >= cw.c.minSize {
+			cw.start(true)
+			return len(b), cw.writeBuffered()
+		}
+		return len(b), nil
+	}
+	if cw.encoder != nil {
+		return cw.encoder.Write(b)
+	}
+	return cw.w.Write(b)
+}
+
+func (cw *compressWriter) Flush() {
+	if !cw.started {
+		cw.start(true)
+		cw.writeBuffered()
+	}
+	if f, ok := cw.encoder.(flusher); ok {
+		f.Flush()
+	}
+	if f, ok := cw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// start sends the response header, compressing the response if big is true
+// and it is compressible.
+func (cw *compressWriter) start(big bool) {
+	cw.started = true
+	h := cw.w.Header()
+	if h.Get("Content-Type") == "" && len(cw.buf) > 0 {
+		h.Set("Content-Type", http.DetectContentType(cw.buf))
+	}
+	if cw.code == 0 {
+		cw.code = http.StatusOK
+	}
+	if big && cw.c.compressible(cw.code, h) {
+		encoder, err := cw.enc.get(cw.w, cw.c.level)
+		if err == nil {
+			cw.encoder = encoder
+			h.Set("Content-Encoding", cw.enc.name)
+			h.Del("Content-Length")
+			if etag := h.Get("ETag"); etag != "" && !strings.HasPrefix(etag, "W/") {
+				h.Set("ETag", "W/"+etag)
+			}
+		}
+	}
+	cw.w.WriteHeader(cw.code)
+}
+
+func (cw *compressWriter) writeBuffered() error {
+	buf := cw.buf
+	cw.buf = nil
+	if len(buf) == 0 {
+		return nil
+	}
+	var err error
+	if cw.encoder != nil {
+		_, err = cw.encoder.Write(buf)
+	} else {
+		_, err = cw.w.Write(buf)
+	}
+	return err
+}
+
+// close sends the rest of the response, once the handler returned.
+func (cw *compressWriter) close() {
+	if !cw.started {
+		if cw.code == 0 && len(cw.buf) == 0 {
+			return
+		}
+		cw.start(len(cw.buf) >= cw.c.minSize && len(cw.buf) > 0)
+		cw.writeBuffered()
+	}
+	if cw.encoder != nil {
+		cw.encoder.Close()
+		cw.enc.put(cw.encoder)
+		cw.encoder = nil
+	}
+}
+
+// writerOnly hides the ReadFrom method of a writer from io.Copy.
+type writerOnly struct {
+	io.Writer
+}
+
+// addVary adds name to the Vary header of h, unless it is already there.
+func addVary(h http.Header, name string) {
+	for _, v := range h.Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			field = strings.TrimSpace(field)
+			if field == "*" || strings.EqualFold(field, name) {
+				return
+			}
+		}
+	}
+	h.Add("Vary", name)
+}
+
+func matchMediaTypePattern(patterns []string, mt string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, mt); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func validMediaTypePatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil || !strings.Contains(pattern, "/") {
+			return fmt.Errorf("handlers: invalid media type pattern %q", pattern)
+		}
+	}
+	return nil
+}
@@ -0,0 +1,238 @@
+package handlers
+
+import (
+	"bufio"
+	"compress/flate"
+	"compress/gzip"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestCompressNegotiate(t *testing.T) {
+	c := newCompressor()
+	CompressEncoder("br", func(w io.Writer, level int) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	})(c)
+
+	tests := []struct {
+		accept, want string
+	}{
+		{"", ""},
+		{"identity", ""},
+		{"gzip", "gzip"},
+		{"deflate, gzip", "gzip"},
+		{"gzip, br", "br"},
+		{"GZIP;q=0.5, deflate;q=0.8", "deflate"},
+		{"br;q=0, gzip", "gzip"},
+		{"*", "br"},
+		{"*;q=0.1, gzip;q=0", "br"},
+		{"gzip;q=0, deflate;q=0, br;q=0, *", ""},
+		{"gzip;q=bad, deflate", "deflate"},
+	}
+	for _, test := range tests {
+		got := ""
+		if e := c.negotiate(test.accept); e != nil {
+			got = e.name
+		}
+		if got != test.want {
+			t.Errorf("%q: got %q, want %q", test.accept, got, test.want)
+		}
+	}
+}
+
+func compressedResponse(t *testing.T, h http.Handler, accept string) (*httptest.ResponseRecorder, string) {
+	t.Helper()
+	r := newRequest("GET", "http://example.com/")
+	r.Header.Set("Accept-Encoding", accept)
+	w := httptest.NewRecorder()
+	h.ServeHTTP(w, r)
+
+	var body io.Reader = w.Body
+	switch w.Header().Get("Content-Encoding") {
+	case "gzip":
+		gr, err := gzip.NewReader(w.Body)
+		if err != nil {
+			t.Fatal(err)
+		}
+		body = gr
+	case "deflate":
+		body = flate.NewReader(w.Body)
+	}
+	b, err := ioutil.ReadAll(body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return w, string(b)
+}
+
+func TestCompress(t *testing.T) {
+	large := strings.Repeat(`{"id":1,"name":"item"},`, 100)
+	tests := []struct {
+		name     string
+		opts     []CompressOption
+		header   map[string]string
+		code     int
+		body     string
+		encoding string
+	}{
+		{"large JSON", nil, map[string]string{"Content-Type": "application/json"}, 200, large, "gzip"},
+		{"small", nil, map[string]string{"Content-Type": "application/json"}, 200, `{"id":1}`, ""},
+		{"min size", []CompressOption{CompressMinSize(4)}, nil, 200, `{"id":1}`, "gzip"},
+		{"sniffed", nil, nil, 200, "<html>" + large, "gzip"},
+		{"image", nil, map[string]string{"Content-Type": "image/png"}, 200, large, ""},
+		{"excluded", []CompressOption{CompressExcludeTypes("application/*")}, map[string]string{"Content-Type": "application/json"}, 200, large, ""},
+		{"allowed", []CompressOption{CompressTypes("text/*")}, map[string]string{"Content-Type": "text/csv"}, 200, large, "gzip"},
+		{"not allowed", []CompressOption{CompressTypes("text/*")}, map[string]string{"Content-Type": "application/json"}, 200, large, ""},
+		{"encoded", nil, map[string]string{"Content-Encoding": "br"}, 200, large, "br"},
+		{"no-transform", nil, map[string]string{"Cache-Control": "public, no-transform"}, 200, large, ""},
+		{"partial", nil, map[string]string{"Content-Type": "text/plain"}, http.StatusPartialContent, large, ""},
+		{"small length", nil, map[string]string{"Content-Length": "8"}, 200, `{"id":1}`, ""},
+		{"error", nil, map[string]string{"Content-Type": "text/plain"}, 500, large, "gzip"},
+	}
+	for _, test := range tests {
+		h := Compress(test.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			for k, v := range test.header {
+				w.Header().Set(k, v)
+			}
+			w.WriteHeader(test.code)
+			io.WriteString(w, test.body)
+		}))
+		w, body := compressedResponse(t, h, "gzip, deflate")
+		if got := w.Header().Get("Content-Encoding"); got != test.encoding {
+			t.Errorf("%s: got Content-Encoding %q, want %q", test.name, got, test.encoding)
+		}
+		if w.Code != test.code {
+			t.Errorf("%s: got status %d, want %d", test.name, w.Code, test.code)
+		}
+		if body != test.body {
+			t.Errorf("%s: got body %q", test.name, body)
+		}
+		if got := w.Header().Get("Vary"); got != "Accept-Encoding" {
+			t.Errorf("%s: got Vary %q", test.name, got)
+		}
+	}
+}
+
+func TestCompressWeakensETag(t *testing.T) {
+	h := Compress(CompressMinSize(0))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("ETag", `"v1"`)
+		io.WriteString(w, "hello")
+	}))
+	w, body := compressedResponse(t, h, "deflate")
+	if w.Header().Get("Content-Encoding") != "deflate" || body != "hello" {
+		t.Fatalf("got %q encoded as %q", body, w.Header().Get("Content-Encoding"))
+	}
+	if got := w.Header().Get("ETag"); got != `W/"v1"` {
+		t.Errorf("got ETag %q", got)
+	}
+}
+
+func TestCompressEncoder(t *testing.T) {
+	h := Compress(CompressEncoder("x-deflate", func(w io.Writer, level int) (io.WriteCloser, error) {
+		return flate.NewWriter(w, level)
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, strings.Repeat("a", 2000))
+	}))
+	for i := 0; i < 2; i++ {
+		w, raw := compressedResponse(t, h, "gzip, x-deflate")
+		if got := w.Header().Get("Content-Encoding"); got != "x-deflate" {
+			t.Fatalf("got Content-Encoding %q", got)
+		}
+		b, err := ioutil.ReadAll(flate.NewReader(strings.NewReader(raw)))
+		if err != nil || len(b) != 2000 {
+			t.Errorf("got %d bytes, %v", len(b), err)
+		}
+	}
+}
+
+func TestCompressFlush(t *testing.T) {
+	events := make(chan string)
+	ts := httptest.NewServer(Compress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/event-stream")
+		for e := range events {
+			io.WriteString(w, "data: "+e+"\n\n")
+			w.(http.Flusher).Flush()
+		}
+	})))
+	defer ts.Close()
+
+	req, _ := http.NewRequest("GET", ts.URL, nil)
+	req.Header.Set("Accept-Encoding", "gzip")
+	go func() { events <- "first" }()
+	res, err := http.DefaultTransport.RoundTrip(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	if res.Header.Get("Content-Encoding") != "gzip" {
+		t.Fatalf("got Content-Encoding %q", res.Header.Get("Content-Encoding"))
+	}
+	gr, err := gzip.NewReader(res.Body)
+	if err != nil {
+		t.Fatal(err)
+	}
+	lines := bufio.NewReader(gr)
+	for _, e := range []string{"first", "second"} {
+		if e != "first" {
+			go func() { events <- e }()
+		}
+		done := make(chan string)
+		go func() {
+			line, _ := lines.ReadString('\n')
+			lines.ReadString('\n')
+			done <- line
+		}()
+		select {
+		case line := <-done:
+			if line != "data: "+e+"\n" {
+				t.Errorf("got %q", line)
+			}
+		case <-time.After(5 * time.Second):
+			t.Fatalf("event %q wasn't flushed", e)
+		}
+	}
+	close(events)
+}
+
+func TestCompressPreservesInterfaces(t *testing.T) {
+	h := Compress()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := w.(http.Hijacker); !ok {
+			t.Error("lost http.Hijacker")
+		}
+		if _, ok := w.(http.CloseNotifier); !ok {
+			t.Error("lost http.CloseNotifier")
+		}
+		if _, ok := w.(http.Flusher); !ok {
+			t.Error("lost http.Flusher")
+		}
+	}))
+	r := newRequest("GET", "http://example.com/")
+	r.Header.Set("Accept-Encoding", "gzip")
+	h.ServeHTTP(fullyFeaturedResponseWriter{}, r)
+}
+
+func TestNewCompressor(t *testing.T) {
+	tests := []struct {
+		opts []CompressOption
+		ok   bool
+	}{
+		{nil, true},
+		{[]CompressOption{CompressLevel(gzip.BestSpeed), CompressMinSize(0), CompressTypes("text/*")}, true},
+		{[]CompressOption{CompressLevel(10)}, false},
+		{[]CompressOption{CompressMinSize(-1)}, false},
+		{[]CompressOption{CompressTypes("json")}, false},
+		{[]CompressOption{CompressExcludeTypes("image/[")}, false},
+		{[]CompressOption{CompressEncoder("", nil)}, false},
+	}
+	for i, test := range tests {
+		mw, err := NewCompressor(test.opts...)
+		if (err == nil) != test.ok || (mw != nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
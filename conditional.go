@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"errors"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// ConditionalOption represents a functional option for configuring the
+// conditional requests middleware.
+type ConditionalOption func(*conditional) error
+
+// ValidatorFunc returns the current validators of the resource targeted by a
+// request: its entity tag and last modification time. Either may be empty;
+// exists is false if the resource doesn't exist.
+type ValidatorFunc func(r *http.Request) (etag string, lastModified time.Time, exists bool)
+
+type conditional struct {
+	h          http.Handler
+	validators ValidatorFunc
+}
+
+// ConditionalRequests is HTTP middleware implementing conditional requests
+// (RFC 9110, section 13) on top of the ETag and Last-Modified headers set by
+// the wrapped handler, or by an inner ETag middleware.
+//
+// For GET and HEAD requests, a 2xx response whose validators match the
+// If-None-Match or If-Modified-Since request headers is converted to a 304
+// Not Modified response: its body is discarded and representation headers
+// are removed. Failed If-Match or If-Unmodified-Since preconditions yield 412
+// Precondition Failed.
+//
+// Handlers may call SetLastModified instead of setting the Last-Modified
+// header themselves.
+//
+// For other methods, If-Match, If-Unmodified-Since and If-None-Match are
+// evaluated before the handler runs, so that lost updates are prevented. The
+// current validators of the resource are obtained from the function set
+// with ConditionalValidators, or with ConditionalValidatorsFromGET by serving
+// an internal GET request to the wrapped handler. Without either, such
+// requests are answered with 428 Precondition Required, as their
+// preconditions can't be evaluated.
+//
+// Example:
+//
+//	h := handlers.ConditionalRequests(handlers.ConditionalValidators(itemVersion))(handlers.ETag()(r))
+func ConditionalRequests(opts ...ConditionalOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		c := &conditional{h: h}
+		for _, option := range opts {
+			option(c)
+		}
+		return c
+	}
+}
+
+// NewConditionalRequests is like ConditionalRequests, but returns an error if
+// an option is invalid.
+func NewConditionalRequests(opts ...ConditionalOption) (func(http.Handler) http.Handler, error) {
+	c := &conditional{}
+	for _, option := range opts {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return ConditionalRequests(opts...), nil
+}
+
+// ConditionalValidators sets the function returning the current validators
+// of resources targeted by unsafe requests (e.g. PUT or DELETE).
+func ConditionalValidators(fn ValidatorFunc) ConditionalOption {
+	return func(c *conditional) error {
+		if fn == nil {
+			return errors.New("handlers: nil validator function")
+		}
+		c.validators = fn
+		return nil
+	}
+}
+
+// ConditionalValidatorsFromGET obtains the current validators of resources
+// targeted by unsafe requests by serving an internal GET request for them to
+// the wrapped handler, discarding its body. The handler then runs twice for
+// these requests, so it must be cheap and free of side effects for GET.
+func ConditionalValidatorsFromGET() ConditionalOption {
+	return func(c *conditional) error {
+		c.validators = c.validatorsFromGET
+		return nil
+	}
+}
+
+// lastModifiedState holds the time set with SetLastModified.
+type lastModifiedState struct {
+	t time.Time
+}
+
+// SetLastModified sets the last modification time of the resource served in
+// response to r, for a handler wrapped by the ConditionalRequests middleware.
+// The middleware emits it as the Last-Modified header of a 2xx response, and
+// evaluates the If-Modified-Since and If-Unmodified-Since preconditions
+// against it. A Last-Modified header set by the handler takes precedence. It
+// must be called before the response is written, and is a no-op if r isn't
+// served through the middleware.
+func SetLastModified(r *http.Request, t time.Time) {
+	if s, ok := Value[*lastModifiedState](r); ok {
+		s.t = t
+	}
+}
+
+// withLastModified returns a shallow copy of r carrying a state for
+// SetLastModified.
+func withLastModified(r *http.Request) (*http.Request, *lastModifiedState) {
+	s := &lastModifiedState{}
+	return WithValue(r, s), s
+}
+
+// apply sets the Last-Modified header from the state, unless it is already
+// set.
+func (s *lastModifiedState) apply(h http.Header) {
+	if !s.t.IsZero() && h.Get("Last-Modified") == "" {
+		h.Set("Last-Modified", s.t.UTC().Format(http.TimeFormat))
+	}
+}
+
+func hasConditions(h http.Header) bool {
+	return h.Get("If-Match") != "" || h.Get("If-None-Match") != "" ||
+		h.Get("If-Modified-Since") != "" || h.Get("If-Unmodified-Since") != ""
+}
+
+func (c *conditional) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("conditional", w, r)
+	defer end()
+
+	if isStreamingRequest(r) {
+		c.h.ServeHTTP(w, r)
+		return
+	}
+
+	r, lm := withLastModified(r)
+	if !hasConditions(r.Header) {
+		cw, finish := beforeWriteHeader(w, func(code int) {
+			if code >= 200 && code < 300 {
+				lm.apply(w.Header())
+			}
+		})
+		c.h.ServeHTTP(cw, r)
+		finish()
+		return
+	}
+
+	if r.Method != "GET" && r.Method != "HEAD" {
+		if c.validators == nil {
+			code := http.StatusPreconditionRequired
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		etag, lastModified, exists := c.validators(r)
+		if code := evaluateConditions(r, etag, lastModified, exists); code != 0 {
+			http.Error(w, http.StatusText(code), code)
+			return
+		}
+		c.h.ServeHTTP(w, r)
+		return
+	}
+
+	decided := false
+	suppress := false
+	decide := func(code int) bool {
+		if decided {
+			return suppress
+		}
+		decided = true
+		if code < 200 || code >= 300 {
+			return false
+		}
+
+		h := w.Header()
+		lm.apply(h)
+		var lastModified time.Time
+		if lm := h.Get("Last-Modified"); lm != "" {
+			lastModified, _ = http.ParseTime(lm)
+		}
+		switch evaluateConditions(r, h.Get(etagHeader), lastModified, true) {
+		case http.StatusNotModified:
+			writeNotModified(w)
+			suppress = true
+		case http.StatusPreconditionFailed:
+			http.Error(w, http.StatusText(http.StatusPreconditionFailed), http.StatusPreconditionFailed)
+			suppress = true
+		}
+		return suppress
+	}
+
+	cw := httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+					next(code)
+					return
+				}
+				if decided {
+					if !suppress {
+						next(code)
+					}
+					return
+				}
+				if !decide(code) {
+					next(code)
+				}
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				if decide(http.StatusOK) {
+					return len(b), nil
+				}
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				if decide(http.StatusOK) {
+					return io.Copy(ioutil.Discard, src)
+				}
+				return next(src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				if !decide(http.StatusOK) {
+					next()
+				}
+			}
+		},
+	})
+
+	c.h.ServeHTTP(cw, r)
+	if !decided {
+		// The handler didn't write anything: an implicit 200 OK.
+		decide(http.StatusOK)
+	}
+}
+
+// validatorsFromGET obtains the validators of the resource targeted by r by
+// serving a GET request for it.
+func (c *conditional) validatorsFromGET(r *http.Request) (string, time.Time, bool) {
+	get, lm := withLastModified(r)
+	get = get.Clone(get.Context())
+	get.Method = "GET"
+	get.Body = http.NoBody
+	get.ContentLength = 0
+	for _, h := range []string{"If-Match", "If-None-Match", "If-Modified-Since", "If-Unmodified-Since", "If-Range", "Range"} {
+		get.Header.Del(h)
+	}
+
+	rec := &headerRecorder{header: http.Header{}}
+	c.h.ServeHTTP(rec, get)
+	if rec.status == 0 {
+		rec.status = http.StatusOK
+	}
+	if rec.status < 200 || rec.status >= 300 {
+		return "", time.Time{}, false
+	}
+
+	lm.apply(rec.header)
+	lastModified, _ := http.ParseTime(rec.header.Get("Last-Modified"))
+	return rec.header.Get(etagHeader), lastModified, true
+}
+
+// evaluateConditions evaluates the preconditions of r against the current
+// validators of the target resource, in the order defined by RFC 9110
+// section 13.2.2. It returns 304, 412 or 0 if the request should proceed.
+func evaluateConditions(r *http.Request, etag string, lastModified time.Time, exists bool) int {
+	safe := r.Method == "GET" || r.Method == "HEAD"
+
+	if im := r.Header.Get("If-Match"); im != "" {
+		if !exists || !etagListMatch(im, etag, false) {
+			return http.StatusPreconditionFailed
+		}
+	} else if ius := r.Header.Get("If-Unmodified-Since"); ius != "" && exists && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ius); err == nil && lastModified.Truncate(time.Second).After(t) {
+			return http.StatusPreconditionFailed
+		}
+	}
+
+	if inm := r.Header.Get("If-None-Match"); inm != "" {
+		if exists && etagListMatch(inm, etag, true) {
+			if safe {
+				return http.StatusNotModified
+			}
+			return http.StatusPreconditionFailed
+		}
+	} else if ims := r.Header.Get("If-Modified-Since"); ims != "" && safe && exists && !lastModified.IsZero() {
+		if t, err := http.ParseTime(ims); err == nil && !lastModified.Truncate(time.Second).After(t) {
+			return http.StatusNotModified
+		}
+	}
+
+	return 0
+}
+
+// etagListMatch reports whether etag matches the comma-separated list of
+// entity tags of a If-Match or If-None-Match header, using the weak or
+// strong comparison function.
+func etagListMatch(list, etag string, weak bool) bool {
+	list = strings.TrimSpace(list)
+	if list == "*" {
+		return true
+	}
+	if etag == "" {
+		return false
+	}
+	for _, candidate := range strings.Split(list, ",") {
+		candidate = strings.TrimSpace(candidate)
+		if weak {
+			if strings.TrimPrefix(candidate, "W/") == strings.TrimPrefix(etag, "W/") {
+				return true
+			}
+		} else if !strings.HasPrefix(candidate, "W/") && !strings.HasPrefix(etag, "W/") && candidate == etag {
+			return true
+		}
+	}
+	return false
+}
+
+// writeNotModified sends a 304 Not Modified response, removing the headers
+// describing the (omitted) representation.
+func writeNotModified(w http.ResponseWriter) {
+	h := w.Header()
+	h.Del("Content-Type")
+	h.Del("Content-Length")
+	h.Del("Content-Encoding")
+	h.Del("Transfer-Encoding")
+	if h.Get(etagHeader) != "" {
+		h.Del("Last-Modified")
+	}
+	w.WriteHeader(http.StatusNotModified)
+}
+
+// headerRecorder is a http.ResponseWriter recording the status and headers
+// of a response and discarding its body.
+type headerRecorder struct {
+	header http.Header
+	status int
+}
+
+func (hr *headerRecorder) Header() http.Header { return hr.header }
+
+func (hr *headerRecorder) Write(b []byte) (int, error) {
+	if hr.status == 0 {
+		hr.status = http.StatusOK
+	}
+	return len(b), nil
+}
+
+func (hr *headerRecorder) WriteHeader(code int) {
+	if hr.status == 0 {
+		hr.status = code
+	}
+}
@@ -0,0 +1,209 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+var lastModifiedTime = time.Date(2020, 1, 2, 3, 4, 5, 0, time.UTC)
+
+func TestConditionalRequestsGet(t *testing.T) {
+	handler := ConditionalRequests()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set(etagHeader, `"v1"`)
+		w.Header().Set("Last-Modified", lastModifiedTime.Format(http.TimeFormat))
+		w.Header().Set("Cache-Control", "max-age=60")
+		io.WriteString(w, ok)
+	}))
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+	}{
+		{"no condition", "", "", http.StatusOK},
+		{"if-none-match hit", "If-None-Match", `"v0", "v1"`, http.StatusNotModified},
+		{"if-none-match weak hit", "If-None-Match", `W/"v1"`, http.StatusNotModified},
+		{"if-none-match star", "If-None-Match", `*`, http.StatusNotModified},
+		{"if-none-match miss", "If-None-Match", `"v2"`, http.StatusOK},
+		{"if-modified-since hit", "If-Modified-Since", lastModifiedTime.Format(http.TimeFormat), http.StatusNotModified},
+		{"if-modified-since miss", "If-Modified-Since", lastModifiedTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+		{"if-match miss", "If-Match", `"v2"`, http.StatusPreconditionFailed},
+		{"if-match weak", "If-Match", `W/"v1"`, http.StatusPreconditionFailed},
+		{"if-unmodified-since miss", "If-Unmodified-Since", lastModifiedTime.Add(-time.Hour).Format(http.TimeFormat), http.StatusPreconditionFailed},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRequest("GET", "/")
+			if test.header != "" {
+				r.Header.Set(test.header, test.value)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != test.code {
+				t.Fatalf("bad status: got %d want %d", rec.Code, test.code)
+			}
+			switch test.code {
+			case http.StatusOK:
+				if rec.Body.String() != ok {
+					t.Fatalf("bad body: got %q want %q", rec.Body.String(), ok)
+				}
+			case http.StatusNotModified:
+				if rec.Body.Len() != 0 {
+					t.Fatalf("unexpected body %q", rec.Body.String())
+				}
+				if rec.Header().Get("Content-Type") != "" {
+					t.Fatal("Content-Type not removed from 304 response")
+				}
+				if rec.Header().Get(etagHeader) != `"v1"` || rec.Header().Get("Cache-Control") == "" {
+					t.Fatalf("missing headers on 304 response: %v", rec.Header())
+				}
+			}
+		})
+	}
+}
+
+func TestConditionalRequestsWithETag(t *testing.T) {
+	handler := ConditionalRequests()(ETag()(okHandler))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	tag := rec.Header().Get(etagHeader)
+
+	r := newRequest("GET", "/")
+	r.Header.Set("If-None-Match", tag)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("bad response: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestConditionalRequestsUnsafe(t *testing.T) {
+	version := `"v1"`
+	writes := 0
+	handler := ConditionalRequests(ConditionalValidatorsFromGET())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.Method {
+		case "GET":
+			w.Header().Set(etagHeader, version)
+			io.WriteString(w, ok)
+		case "PUT":
+			writes++
+			version = `"v2"`
+			w.WriteHeader(http.StatusNoContent)
+		}
+	}))
+
+	put := func(ifMatch string) int {
+		r := newRequest("PUT", "/")
+		r.Header.Set("If-Match", ifMatch)
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec.Code
+	}
+
+	if code := put(`"v1"`); code != http.StatusNoContent || writes != 1 {
+		t.Fatalf("bad first write: status %d, %d writes", code, writes)
+	}
+	// The resource changed: the second (lost) update is rejected.
+	if code := put(`"v1"`); code != http.StatusPreconditionFailed || writes != 1 {
+		t.Fatalf("bad second write: status %d, %d writes", code, writes)
+	}
+}
+
+func TestConditionalValidators(t *testing.T) {
+	handler := ConditionalRequests(ConditionalValidators(func(r *http.Request) (string, time.Time, bool) {
+		return "", time.Time{}, false
+	}))(okHandler)
+
+	// If-None-Match: * on a missing resource allows creation.
+	r := newRequest("PUT", "/")
+	r.Header.Set("If-None-Match", "*")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusOK)
+	}
+
+	r.Header.Del("If-None-Match")
+	r.Header.Set("If-Match", "*")
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+}
+
+func TestSetLastModified(t *testing.T) {
+	handler := ConditionalRequests(ConditionalValidatorsFromGET())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetLastModified(r, lastModifiedTime.In(time.Local))
+		if r.Method == "PUT" {
+			w.WriteHeader(http.StatusNoContent)
+			return
+		}
+		io.WriteString(w, ok)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if got, want := rec.Header().Get("Last-Modified"), lastModifiedTime.Format(http.TimeFormat); got != want {
+		t.Fatalf("bad Last-Modified: got %q want %q", got, want)
+	}
+
+	r := newRequest("GET", "/")
+	r.Header.Set("If-Modified-Since", lastModifiedTime.Format(http.TimeFormat))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotModified {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusNotModified)
+	}
+
+	r = newRequest("PUT", "/")
+	r.Header.Set("If-Unmodified-Since", lastModifiedTime.Add(-time.Hour).Format(http.TimeFormat))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusPreconditionFailed)
+	}
+
+	// Outside of the middleware, SetLastModified is a no-op.
+	SetLastModified(newRequest("GET", "/"), lastModifiedTime)
+}
+
+func TestConditionalRequestsUnsafeWithoutValidators(t *testing.T) {
+	calls := 0
+	handler := ConditionalRequests()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+	}))
+
+	r := newRequest("DELETE", "/")
+	r.Header.Set("If-Match", `"v1"`)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPreconditionRequired || calls != 0 {
+		t.Fatalf("bad response: status %d, %d calls", rec.Code, calls)
+	}
+
+	// Unconditional requests are served.
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("DELETE", "/"))
+	if rec.Code != http.StatusOK || calls != 1 {
+		t.Fatalf("bad response: status %d, %d calls", rec.Code, calls)
+	}
+}
+
+func TestNewConditionalRequests(t *testing.T) {
+	if _, err := NewConditionalRequests(ConditionalValidatorsFromGET()); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewConditionalRequests(ConditionalValidators(nil)); err == nil {
+		t.Fatal("no error for a nil validator function")
+	}
+}
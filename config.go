@@ -0,0 +1,311 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"sort"
+	"sync"
+)
+
+// MiddlewareFactory builds a middleware from its options in a ChainConfig,
+// given as a JSON object, which is empty if the configuration has none.
+type MiddlewareFactory func(options json.RawMessage) (Middleware, error)
+
+// ChainConfig describes a middleware chain, outermost middleware first.
+//
+// It is usually decoded from a JSON file with LoadChain. YAML documents can be
+// used by converting them to JSON first, e.g. with sigs.k8s.io/yaml.
+type ChainConfig struct {
+	Middlewares []MiddlewareConfig `json:"middlewares"`
+}
+
+// MiddlewareConfig describes a middleware in a ChainConfig.
+type MiddlewareConfig struct {
+	// Name is the name the middleware factory is registered under.
+	Name string `json:"name"`
+	// Options are passed to the factory.
+	Options json.RawMessage `json:"options,omitempty"`
+}
+
+var (
+	factoriesMu sync.RWMutex
+	factories   = map[string]MiddlewareFactory{
+		"canonical_host":  canonicalHostFactory,
+		"compress":        compressFactory,
+		"cors":            corsFactory,
+		"etag":            etagFactory,
+		"ip_filter":       ipFilterFactory,
+		"logging":         loggingFactory,
+		"problem_details": problemDetailsFactory,
+		"proxy_headers":   staticFactory(ProxyHeaders),
+		"recovery":        recoveryFactory,
+		"request_id":      staticFactory(RequestIDHandler()),
+	}
+)
+
+// RegisterMiddleware registers a factory under name, for use in ChainConfig,
+// replacing any factory registered under the same name. The middlewares of
+// this package are registered as canonical_host, compress, cors, etag,
+// ip_filter (Guard with GuardAllowedIPs), logging, problem_details,
+// proxy_headers, recovery and request_id.
+func RegisterMiddleware(name string, factory MiddlewareFactory) {
+	factoriesMu.Lock()
+	defer factoriesMu.Unlock()
+	factories[name] = factory
+}
+
+// RegisteredMiddlewares returns the sorted names of the registered middleware
+// factories.
+func RegisteredMiddlewares() []string {
+	factoriesMu.RLock()
+	defer factoriesMu.RUnlock()
+	names := make([]string, 0, len(factories))
+	for name := range factories {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// LoadChain decodes a JSON ChainConfig from r and builds its Stack.
+//
+// Example:
+//
+//	// edge.json:
+//	// {"middlewares": [
+//	//   {"name": "recovery"},
+//	//   {"name": "logging", "options": {"format": "combined"}},
+//	//   {"name": "cors", "options": {"allowed_origins": ["https://example.com"]}},
+//	//   {"name": "compress"}
+//	// ]}
+//	f, err := os.Open("edge.json")
+//	...
+//	stack, err := handlers.LoadChain(f)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	http.ListenAndServe(":1123", stack.Then(r))
+func LoadChain(r io.Reader) (Stack, error) {
+	var cfg ChainConfig
+	dec := json.NewDecoder(r)
+	dec.DisallowUnknownFields()
+	if err := dec.Decode(&cfg); err != nil {
+		return nil, fmt.Errorf("handlers: invalid chain configuration: %v", err)
+	}
+	return BuildChain(cfg)
+}
+
+// BuildChain builds the Stack described by cfg. It fails if a middleware
+// isn't registered or if its options are invalid.
+func BuildChain(cfg ChainConfig) (Stack, error) {
+	var stack Stack
+	for i, mc := range cfg.Middlewares {
+		factoriesMu.RLock()
+		factory, ok := factories[mc.Name]
+		factoriesMu.RUnlock()
+		if !ok {
+			return nil, fmt.Errorf("handlers: middleware %d: unknown middleware %q", i, mc.Name)
+		}
+		options := mc.Options
+		if len(options) == 0 || string(options) == "null" {
+			options = json.RawMessage("{}")
+		}
+		mw, err := factory(options)
+		if err != nil {
+			return nil, fmt.Errorf("handlers: middleware %d (%s): %v", i, mc.Name, err)
+		}
+		stack = append(stack, mw)
+	}
+	return stack, nil
+}
+
+// decodeOptions decodes the options of a middleware into v, rejecting
+// unknown fields so that typos are caught.
+func decodeOptions(options json.RawMessage, v interface{}) error {
+	dec := json.NewDecoder(bytes.NewReader(options))
+	dec.DisallowUnknownFields()
+	return dec.Decode(v)
+}
+
+// staticFactory returns a factory of mw, which takes no options.
+func staticFactory(mw Middleware) MiddlewareFactory {
+	return func(options json.RawMessage) (Middleware, error) {
+		if err := decodeOptions(options, &struct{}{}); err != nil {
+			return nil, err
+		}
+		return mw, nil
+	}
+}
+
+func canonicalHostFactory(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		Domain     string   `json:"domain"`
+		Code       int      `json:"code"`
+		ForceHTTPS bool     `json:"force_https"`
+		SkipPaths  []string `json:"skip_paths"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.Domain == "" {
+		return nil, fmt.Errorf("missing domain")
+	}
+	if o.Code == 0 {
+		o.Code = http.StatusMovedPermanently
+	}
+	var opts []CanonicalHostOption
+	if o.ForceHTTPS {
+		opts = append(opts, CanonicalHostForceHTTPS())
+	}
+	if len(o.SkipPaths) > 0 {
+		opts = append(opts, CanonicalHostSkip(func(r *http.Request) bool {
+			return containsString(o.SkipPaths, r.URL.Path)
+		}))
+	}
+	return CanonicalHost(o.Domain, o.Code, opts...), nil
+}
+
+func compressFactory(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		Level *int `json:"level"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	if o.Level == nil {
+		return CompressHandler, nil
+	}
+	return NewCompress(*o.Level)
+}
+
+func corsFactory(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		AllowedOrigins   []string `json:"allowed_origins"`
+		AllowedMethods   []string `json:"allowed_methods"`
+		AllowedHeaders   []string `json:"allowed_headers"`
+		ExposedHeaders   []string `json:"exposed_headers"`
+		MaxAge           int      `json:"max_age"`
+		AllowCredentials bool     `json:"allow_credentials"`
+		IgnoreOptions    bool     `json:"ignore_options"`
+		OptionStatusCode int      `json:"option_status_code"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	var opts []CORSOption
+	if o.AllowedOrigins != nil {
+		opts = append(opts, AllowedOrigins(o.AllowedOrigins))
+	}
+	if o.AllowedMethods != nil {
+		opts = append(opts, AllowedMethods(o.AllowedMethods))
+	}
+	if o.AllowedHeaders != nil {
+		opts = append(opts, AllowedHeaders(o.AllowedHeaders))
+	}
+	if o.ExposedHeaders != nil {
+		opts = append(opts, ExposedHeaders(o.ExposedHeaders))
+	}
+	if o.MaxAge != 0 {
+		opts = append(opts, MaxAge(o.MaxAge))
+	}
+	if o.AllowCredentials {
+		opts = append(opts, AllowCredentials())
+	}
+	if o.IgnoreOptions {
+		opts = append(opts, IgnoreOptions())
+	}
+	if o.OptionStatusCode != 0 {
+		opts = append(opts, OptionStatusCode(o.OptionStatusCode))
+	}
+	return NewCORS(opts...)
+}
+
+func etagFactory(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		Weak         bool     `json:"weak"`
+		MaxSize      int      `json:"max_size"`
+		ContentTypes []string `json:"content_types"`
+		PathPrefixes []string `json:"path_prefixes"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	var opts []ETagOption
+	if o.Weak {
+		opts = append(opts, ETagWeak())
+	}
+	if o.MaxSize != 0 {
+		opts = append(opts, ETagMaxSize(o.MaxSize))
+	}
+	if o.ContentTypes != nil {
+		opts = append(opts, ETagContentTypes(o.ContentTypes))
+	}
+	if o.PathPrefixes != nil {
+		opts = append(opts, ETagPathPrefixes(o.PathPrefixes))
+	}
+	return NewETag(opts...)
+}
+
+func ipFilterFactory(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		AllowedIPs []string `json:"allowed_ips"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	allowed := GuardAllowedIPs(o.AllowedIPs)
+	if err := allowed(&guard{}); err != nil {
+		return nil, err
+	}
+	return Guard(allowed), nil
+}
+
+func loggingFactory(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		Output string `json:"output"`
+		Format string `json:"format"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	var out io.Writer
+	switch o.Output {
+	case "", "stdout":
+		out = os.Stdout
+	case "stderr":
+		out = os.Stderr
+	default:
+		return nil, fmt.Errorf("invalid output %q, expected stdout or stderr", o.Output)
+	}
+	switch o.Format {
+	case "", "common":
+		return func(h http.Handler) http.Handler { return LoggingHandler(out, h) }, nil
+	case "combined":
+		return func(h http.Handler) http.Handler { return CombinedLoggingHandler(out, h) }, nil
+	}
+	return nil, fmt.Errorf("invalid format %q, expected common or combined", o.Format)
+}
+
+func problemDetailsFactory(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		TypeBase string `json:"type_base"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	return ProblemDetails(ProblemTypeBase(o.TypeBase)), nil
+}
+
+func recoveryFactory(options json.RawMessage) (Middleware, error) {
+	var o struct {
+		PrintStack bool `json:"print_stack"`
+	}
+	if err := decodeOptions(options, &o); err != nil {
+		return nil, err
+	}
+	return RecoveryHandler(PrintRecoveryStack(o.PrintStack)), nil
+}
@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestLoadChain(t *testing.T) {
+	cfg := `{"middlewares": [
+		{"name": "recovery", "options": {"print_stack": false}},
+		{"name": "request_id"},
+		{"name": "cors", "options": {"allowed_origins": ["https://example.com"], "max_age": 60}},
+		{"name": "compress", "options": {"level": 5}},
+		{"name": "etag", "options": {"weak": true}}
+	]}`
+	stack, err := LoadChain(strings.NewReader(cfg))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(stack) != 5 {
+		t.Fatalf("wrong stack length: %d", len(stack))
+	}
+
+	h := stack.Then(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("ok"))
+	}))
+	infos := Inspect(h)
+	if len(infos) < 3 || infos[0].Name != "recovery" || infos[1].Name != "request_id" || infos[2].Name != "cors" {
+		t.Fatalf("wrong chain: %v", infos)
+	}
+
+	r := newRequest("GET", "/")
+	r.Header.Set("Origin", "https://example.com")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Header().Get(RequestIDHeader) == "" || rec.Header().Get(corsAllowOriginHeader) != "https://example.com" || !strings.HasPrefix(rec.Header().Get(etagHeader), "W/") {
+		t.Fatalf("chain not applied: %v", rec.Header())
+	}
+}
+
+func TestLoadChainErrors(t *testing.T) {
+	tests := []struct {
+		cfg  string
+		want string
+	}{
+		{`{"middlewares": [{"name": "nope"}]}`, `unknown middleware "nope"`},
+		{`{"middlewares": [{"name": "cors", "options": {"allowed_origin": ["x"]}}]}`, `unknown field "allowed_origin"`},
+		{`{"middlewares": [{"name": "compress", "options": {"level": 12}}]}`, "handlers: invalid compression level 12"},
+		{`{"middlewares": [{"name": "logging", "options": {"format": "json"}}]}`, `invalid format "json"`},
+		{`{"middlewares": [{"name": "request_id", "options": {"x": 1}}]}`, `unknown field "x"`},
+		{`{"middlewares": [{"name": "ip_filter", "options": {"allowed_ips": ["10.0.0.0/33"]}}]}`, "handlers: invalid CIDR range"},
+		{`{"middleware": []}`, `unknown field "middleware"`},
+	}
+	for _, test := range tests {
+		_, err := LoadChain(strings.NewReader(test.cfg))
+		if err == nil || !strings.Contains(err.Error(), test.want) {
+			t.Errorf("%s: got error %v, want %q", test.cfg, err, test.want)
+		}
+	}
+}
+
+func TestRegisterMiddleware(t *testing.T) {
+	RegisterMiddleware("test_header", func(options json.RawMessage) (Middleware, error) {
+		var o struct {
+			Value string `json:"value"`
+		}
+		if err := decodeOptions(options, &o); err != nil {
+			return nil, err
+		}
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("X-Test", o.Value)
+				h.ServeHTTP(w, r)
+			})
+		}, nil
+	})
+	defer func() {
+		factoriesMu.Lock()
+		delete(factories, "test_header")
+		factoriesMu.Unlock()
+	}()
+
+	stack, err := BuildChain(ChainConfig{Middlewares: []MiddlewareConfig{{Name: "test_header", Options: json.RawMessage(`{"value":"v"}`)}}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	rec := httptest.NewRecorder()
+	stack.Then(http.NotFoundHandler()).ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Header().Get("X-Test") != "v" {
+		t.Fatalf("custom middleware not applied: %v", rec.Header())
+	}
+}
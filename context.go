@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"strings"
+)
+
+// contextKey is the type of the keys used by the handlers in this package to
+// store values in a request's context. Using an unexported type guarantees
+// they cannot collide with keys defined in other packages.
+type contextKey int
+
+const (
+	requestIDKey contextKey = iota
+	requestEventKey
+	traceIDKey
+	mountPrefixKey
+	clientIPKey
+)
+
+// typedKey is the context key of the values stored with WithValue. Each type
+// argument yields a distinct key, so a value can only be read back as the
+// type it was stored with.
+type typedKey[T any] struct{}
+
+// WithValue returns a shallow copy of r whose context carries v, keyed by its
+// type T. Use a type specific to the value, e.g. a named type or a pointer to
+// a struct, rather than a basic type like string, since any other WithValue
+// call for the same type shadows it.
+//
+// Example:
+//
+//	type tenant struct{ ID string }
+//
+//	r = handlers.WithValue(r, &tenant{ID: "acme"})
+//	...
+//	if t, ok := handlers.Value[*tenant](r); ok {
+//		log.Println(t.ID)
+//	}
+func WithValue[T any](r *http.Request, v T) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), typedKey[T]{}, v))
+}
+
+// Value returns the value of type T stored in the context of r with
+// WithValue, and whether there was one.
+func Value[T any](r *http.Request) (T, bool) {
+	return ValueFromContext[T](r.Context())
+}
+
+// ValueFromContext is like Value, for code which only has the context of a
+// request.
+func ValueFromContext[T any](ctx context.Context) (T, bool) {
+	v, ok := ctx.Value(typedKey[T]{}).(T)
+	return v, ok
+}
+
+// The functions below retrieve the values stored in a context by the
+// middlewares of this package, for code which only has the context of a
+// request, e.g. a database layer. Each returns the zero value of its type when
+// the request wasn't served through the corresponding middleware. The
+// accessors taking a *http.Request, such as RequestID, are shorthands for
+// them.
+
+// RequestIDFromContext returns the request ID assigned by RequestIDHandler,
+// or an empty string.
+func RequestIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(requestIDKey).(string)
+	return id
+}
+
+// TraceIDFromContext returns the trace ID set with WithTraceID, or an empty
+// string. Unlike TraceID, it can't fall back to the traceparent header.
+func TraceIDFromContext(ctx context.Context) string {
+	id, _ := ctx.Value(traceIDKey).(string)
+	return id
+}
+
+// ClientIPFromContext returns the client IP address established by
+// ProxyHeaders from the forwarding headers, or an empty string if there were
+// none.
+func ClientIPFromContext(ctx context.Context) string {
+	ip, _ := ctx.Value(clientIPKey).(string)
+	return ip
+}
+
+// RegistrableDomainFromContext returns the registrable domain parsed by
+// Subdomains, or an empty string.
+func RegistrableDomainFromContext(ctx context.Context) string {
+	if p, ok := ValueFromContext[*hostParts](ctx); ok {
+		return p.domain
+	}
+	return ""
+}
+
+// SubdomainFromContext returns the subdomain parsed by Subdomains, e.g. the
+// tenant of multi-tenant applications, or an empty string.
+func SubdomainFromContext(ctx context.Context) string {
+	if p, ok := ValueFromContext[*hostParts](ctx); ok {
+		return strings.Join(p.labels, ".")
+	}
+	return ""
+}
+
+// CSPNonceFromContext returns the Content-Security-Policy nonce generated by
+// SecureHeaders, or an empty string.
+func CSPNonceFromContext(ctx context.Context) string {
+	nonce, _ := ValueFromContext[cspNonce](ctx)
+	return string(nonce)
+}
+
+// MountPrefixFromContext returns the path prefixes stripped by StripPrefix,
+// or an empty string.
+func MountPrefixFromContext(ctx context.Context) string {
+	prefix, _ := ctx.Value(mountPrefixKey).(string)
+	return prefix
+}
+
+// ServerTimingFromContext returns the Server-Timing collector attached by
+// ServerTimingHandler, or nil. The methods of a nil *ServerTiming are no-ops.
+func ServerTimingFromContext(ctx context.Context) *ServerTiming {
+	st, _ := ValueFromContext[*ServerTiming](ctx)
+	return st
+}
+
+// MultipartUploadFromContext returns the multipart upload parsed by
+// StreamMultipartUploads, or nil.
+func MultipartUploadFromContext(ctx context.Context) *MultipartUpload {
+	upload, _ := ValueFromContext[*MultipartUpload](ctx)
+	return upload
+}
+
+// FeatureFlagsFromContext returns the state of the feature flags evaluated by
+// FeatureFlags, or nil.
+func FeatureFlagsFromContext(ctx context.Context) map[string]bool {
+	flags, _ := ValueFromContext[enabledFlags](ctx)
+	return flags
+}
+
+// ExperimentVariantsFromContext returns the experiments assigned by
+// Experiment, mapped to their variants, or nil.
+func ExperimentVariantsFromContext(ctx context.Context) map[string]string {
+	assignments, _ := ValueFromContext[experimentAssignments](ctx)
+	return assignments
+}
+
+// TenantIDFromContext returns the ID of the tenant resolved by Tenants, or an
+// empty string. The tenant itself is retrieved with ValueFromContext.
+func TenantIDFromContext(ctx context.Context) string {
+	id, _ := ValueFromContext[tenantID](ctx)
+	return string(id)
+}
+
+// APIVersionFromContext returns the API version determined by APIVersions, or
+// an empty string.
+func APIVersionFromContext(ctx context.Context) string {
+	v, _ := ValueFromContext[apiVersion](ctx)
+	return string(v)
+}
+
+// LocaleFromContext returns the language tag chosen by Locales, or an empty
+// string.
+func LocaleFromContext(ctx context.Context) string {
+	tag, _ := ValueFromContext[locale](ctx)
+	return string(tag)
+}
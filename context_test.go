@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestContextAccessorsZero(t *testing.T) {
+	ctx := context.Background()
+	if RequestIDFromContext(ctx) != "" || TraceIDFromContext(ctx) != "" || ClientIPFromContext(ctx) != "" ||
+		RegistrableDomainFromContext(ctx) != "" || SubdomainFromContext(ctx) != "" || MountPrefixFromContext(ctx) != "" ||
+		ServerTimingFromContext(ctx) != nil || MultipartUploadFromContext(ctx) != nil {
+		t.Fatal("non-zero value from an empty context")
+	}
+}
+
+func TestContextAccessors(t *testing.T) {
+	var ctx context.Context
+	h := Chain(
+		ProxyHeaders,
+		RequestIDHandler(),
+		Subdomains(SubdomainBaseDomains("example.com")),
+		func(h http.Handler) http.Handler { return StripPrefix("/api", h) },
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ctx = r.Context()
+	}))
+
+	r := newRequest("GET", "/api/users")
+	r.Host = "acme.example.com"
+	r.Header.Set(xForwardedFor, "203.0.113.7")
+	r.Header.Set(RequestIDHeader, "id-1")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	tests := []struct {
+		name string
+		got  string
+		want string
+	}{
+		{"request ID", RequestIDFromContext(ctx), "id-1"},
+		{"client IP", ClientIPFromContext(ctx), "203.0.113.7"},
+		{"domain", RegistrableDomainFromContext(ctx), "example.com"},
+		{"subdomain", SubdomainFromContext(ctx), "acme"},
+		{"prefix", MountPrefixFromContext(ctx), "/api"},
+	}
+	for _, test := range tests {
+		if test.got != test.want {
+			t.Errorf("%s: got %q want %q", test.name, test.got, test.want)
+		}
+	}
+}
+
+func TestClientIP(t *testing.T) {
+	r := newRequest("GET", "/")
+	r.RemoteAddr = "[2001:db8::1]:4711"
+	if ip := ClientIP(r); ip != "2001:db8::1" {
+		t.Fatalf("got %q", ip)
+	}
+}
+
+func TestTypedValues(t *testing.T) {
+	type tenant struct{ ID string }
+	type userID string
+
+	r := newRequest("GET", "/")
+	if _, ok := Value[*tenant](r); ok {
+		t.Fatal("value found in an empty context")
+	}
+
+	r = WithValue(r, &tenant{ID: "acme"})
+	r = WithValue(r, userID("u1"))
+	if v, ok := Value[*tenant](r); !ok || v.ID != "acme" {
+		t.Fatalf("wrong tenant: %v %v", v, ok)
+	}
+	if v, ok := ValueFromContext[userID](r.Context()); !ok || v != "u1" {
+		t.Fatalf("wrong user ID: %q %v", v, ok)
+	}
+	// Values are keyed by their exact type.
+	if _, ok := Value[string](r); ok {
+		t.Fatal("userID value read back as a string")
+	}
+	if _, ok := Value[tenant](r); ok {
+		t.Fatal("*tenant value read back as a tenant")
+	}
+}
@@ -1,7 +1,10 @@
 package handlers
 
 import (
+	"errors"
+	"fmt"
 	"net/http"
+	"net/url"
 	"strconv"
 	"strings"
 )
@@ -14,12 +17,53 @@ type cors struct {
 	allowedHeaders         []string
 	allowedMethods         []string
 	allowedOrigins         []string
+	originPatterns         []originPattern
 	allowedOriginValidator OriginValidator
 	exposedHeaders         []string
 	maxAge                 int
 	ignoreOptions          bool
 	allowCredentials       bool
 	optionStatusCode       int
+
+	// The values below are precomputed by prepare, so that serving requests
+	// doesn't allocate. Header value slices are shared by all responses.
+	requestHeaders      map[string]corsRequestHeader
+	allowMethodsValues  map[string][]string
+	allowOriginValues   map[string][]string
+	exposedHeadersValue []string
+	maxAgeValue         []string
+	allowAllOrigins     bool
+	varyOrigin          bool
+}
+
+// originPattern is an origin pattern of AllowedOriginPatterns, split around
+// its wildcard.
+type originPattern struct {
+	pattern        string
+	prefix, suffix string
+	wildcard       bool
+}
+
+func (p originPattern) match(origin string) bool {
+	if !p.wildcard {
+		return strings.EqualFold(origin, p.pattern)
+	}
+	if len(origin) <= len(p.prefix)+len(p.suffix) ||
+		!strings.EqualFold(origin[:len(p.prefix)], p.prefix) ||
+		!strings.EqualFold(origin[len(origin)-len(p.suffix):], p.suffix) {
+		return false
+	}
+	labels := origin[len(p.prefix) : len(origin)-len(p.suffix)]
+	return !strings.ContainsAny(labels, "/:@?#") && labels[0] != '.' && labels[len(labels)-1] != '.'
+}
+
+// corsRequestHeader is a request header allowed in preflight requests, keyed
+// by its lowercase name.
+type corsRequestHeader struct {
+	name string
+	// simple reports whether the header is always allowed, and left out of
+	// the Access-Control-Allow-Headers header.
+	simple bool
 }
 
 // OriginValidator takes an origin string and returns whether or not that origin is allowed.
@@ -47,7 +91,16 @@ const (
 	corsOriginMatchAll         string = "*"
 )
 
+var (
+	corsTrueValue       = []string{"true"}
+	corsVaryOriginValue = []string{corsOriginHeader}
+	corsMatchAllValue   = []string{corsOriginMatchAll}
+)
+
 func (ch *cors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("cors", w, r)
+	defer end()
+
 	origin := r.Header.Get(corsOriginHeader)
 	if !ch.isOriginAllowed(origin) {
 		if r.Method != corsOptionMethod || ch.ignoreOptions {
@@ -64,72 +117,85 @@ func (ch *cors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 		}
 
 		if _, ok := r.Header[corsRequestMethodHeader]; !ok {
+			if writeProblem(w, r, http.StatusBadRequest, "Missing "+corsRequestMethodHeader+" header") {
+				return
+			}
 			w.WriteHeader(http.StatusBadRequest)
 			return
 		}
 
 		method := r.Header.Get(corsRequestMethodHeader)
 		if !ch.isMatch(method, ch.allowedMethods) {
+			if writeProblem(w, r, http.StatusMethodNotAllowed, "Method "+method+" not allowed by CORS policy") {
+				return
+			}
 			w.WriteHeader(http.StatusMethodNotAllowed)
 			return
 		}
 
-		requestHeaders := strings.Split(r.Header.Get(corsRequestHeadersHeader), ",")
-		allowedHeaders := []string{}
-		for _, v := range requestHeaders {
-			canonicalHeader := http.CanonicalHeaderKey(strings.TrimSpace(v))
-			if canonicalHeader == "" || ch.isMatch(canonicalHeader, defaultCorsHeaders) {
+		// The requested headers are joined into buf, on the stack unless
+		// they are many.
+		var buf [128]byte
+		allowedHeaders := buf[:0]
+		for rest := r.Header.Get(corsRequestHeadersHeader); rest != ""; {
+			var v string
+			v, rest, _ = strings.Cut(rest, ",")
+			v = strings.TrimSpace(v)
+			if v == "" {
 				continue
 			}
 
-			if !ch.isMatch(canonicalHeader, ch.allowedHeaders) {
+			header, ok := ch.lookupRequestHeader(v)
+			if !ok {
+				canonicalHeader := http.CanonicalHeaderKey(v)
+				if writeProblem(w, r, http.StatusForbidden, "Header "+canonicalHeader+" not allowed by CORS policy") {
+					return
+				}
 				w.WriteHeader(http.StatusForbidden)
 				return
 			}
+			if header.simple {
+				continue
+			}
 
-			allowedHeaders = append(allowedHeaders, canonicalHeader)
+			if len(allowedHeaders) > 0 {
+				allowedHeaders = append(allowedHeaders, ',')
+			}
+			allowedHeaders = append(allowedHeaders, header.name...)
 		}
 
 		if len(allowedHeaders) > 0 {
-			w.Header().Set(corsAllowHeadersHeader, strings.Join(allowedHeaders, ","))
+			w.Header()[corsAllowHeadersHeader] = []string{string(allowedHeaders)}
 		}
 
-		if ch.maxAge > 0 {
-			w.Header().Set(corsMaxAgeHeader, strconv.Itoa(ch.maxAge))
+		if ch.maxAgeValue != nil {
+			w.Header()[corsMaxAgeHeader] = ch.maxAgeValue
 		}
 
 		if !ch.isMatch(method, defaultCorsMethods) {
-			w.Header().Set(corsAllowMethodsHeader, method)
+			w.Header()[corsAllowMethodsHeader] = ch.allowMethodsValues[method]
 		}
 	} else {
-		if len(ch.exposedHeaders) > 0 {
-			w.Header().Set(corsExposeHeadersHeader, strings.Join(ch.exposedHeaders, ","))
+		if ch.exposedHeadersValue != nil {
+			w.Header()[corsExposeHeadersHeader] = ch.exposedHeadersValue
 		}
 	}
 
 	if ch.allowCredentials {
-		w.Header().Set(corsAllowCredentialsHeader, "true")
+		w.Header()[corsAllowCredentialsHeader] = corsTrueValue
 	}
 
-	if len(ch.allowedOrigins) > 1 {
-		w.Header().Set(corsVaryHeader, corsOriginHeader)
+	if ch.varyOrigin {
+		w.Header()[corsVaryHeader] = corsVaryOriginValue
 	}
 
-	returnOrigin := origin
-	if ch.allowedOriginValidator == nil && len(ch.allowedOrigins) == 0 {
-		returnOrigin = "*"
+	if ch.allowAllOrigins {
+		w.Header()[corsAllowOriginHeader] = corsMatchAllValue
+	} else if v, ok := ch.allowOriginValues[origin]; ok {
+		w.Header()[corsAllowOriginHeader] = v
 	} else {
-		for _, o := range ch.allowedOrigins {
-			// A configuration of * is different than explicitly setting an allowed
-			// origin. Returning arbitrary origin headers in an access control allow
-			// origin header is unsafe and is not required by any use case.
-			if o == corsOriginMatchAll {
-				returnOrigin = "*"
-				break
-			}
-		}
+		w.Header()[corsAllowOriginHeader] = []string{origin}
 	}
-	w.Header().Set(corsAllowOriginHeader, returnOrigin)
 
 	if r.Method == corsOptionMethod {
 		w.WriteHeader(ch.optionStatusCode)
@@ -159,13 +225,29 @@ func (ch *cors) ServeHTTP(w http.ResponseWriter, r *http.Request) {
 //
 func CORS(opts ...CORSOption) func(http.Handler) http.Handler {
 	return func(h http.Handler) http.Handler {
-		ch := parseCORSOptions(opts...)
+		ch, _ := parseCORSOptions(opts...)
 		ch.h = h
 		return ch
 	}
 }
 
-func parseCORSOptions(opts ...CORSOption) *cors {
+// NewCORS is like CORS, but returns an error if an option is invalid, e.g. a
+// malformed origin, or if credentials are allowed for any origin, which
+// browsers reject.
+func NewCORS(opts ...CORSOption) (func(http.Handler) http.Handler, error) {
+	ch, err := parseCORSOptions(opts...)
+	if err != nil {
+		return nil, err
+	}
+	if ch.allowCredentials && ch.isMatch(corsOriginMatchAll, ch.allowedOrigins) {
+		return nil, errors.New("handlers: CORS credentials cannot be allowed for all origins")
+	}
+	return CORS(opts...), nil
+}
+
+// parseCORSOptions applies opts, returning the first error reported by an
+// option. Invalid options are applied anyway, as CORS has always done.
+func parseCORSOptions(opts ...CORSOption) (*cors, error) {
 	ch := &cors{
 		allowedMethods:   defaultCorsMethods,
 		allowedHeaders:   defaultCorsHeaders,
@@ -173,11 +255,73 @@ func parseCORSOptions(opts ...CORSOption) *cors {
 		optionStatusCode: defaultCorsOptionStatusCode,
 	}
 
+	var err error
 	for _, option := range opts {
-		option(ch)
+		if optErr := option(ch); optErr != nil && err == nil {
+			err = optErr
+		}
+	}
+	ch.prepare()
+
+	return ch, err
+}
+
+// prepare precomputes the lookup tables and header values of ch once its
+// options are applied.
+func (ch *cors) prepare() {
+	ch.requestHeaders = make(map[string]corsRequestHeader, len(ch.allowedHeaders)+len(defaultCorsHeaders))
+	for _, h := range ch.allowedHeaders {
+		ch.requestHeaders[strings.ToLower(h)] = corsRequestHeader{name: h}
 	}
+	for _, h := range defaultCorsHeaders {
+		ch.requestHeaders[strings.ToLower(h)] = corsRequestHeader{name: h, simple: true}
+	}
+
+	ch.allowMethodsValues = make(map[string][]string, len(ch.allowedMethods))
+	for _, m := range ch.allowedMethods {
+		ch.allowMethodsValues[m] = []string{m}
+	}
+
+	// A configuration of * is different than explicitly setting an allowed
+	// origin. Returning arbitrary origin headers in an access control allow
+	// origin header is unsafe and is not required by any use case.
+	ch.allowAllOrigins = (ch.allowedOriginValidator == nil && len(ch.allowedOrigins) == 0 && len(ch.originPatterns) == 0) ||
+		ch.isMatch(corsOriginMatchAll, ch.allowedOrigins)
+	// The response depends on the origin whenever it is echoed, unless
+	// a single origin is allowed.
+	ch.varyOrigin = !ch.allowAllOrigins &&
+		(len(ch.allowedOrigins) > 1 || len(ch.originPatterns) > 0 || ch.allowedOriginValidator != nil)
+	ch.allowOriginValues = make(map[string][]string, len(ch.allowedOrigins))
+	for _, o := range ch.allowedOrigins {
+		ch.allowOriginValues[o] = []string{o}
+	}
+
+	if len(ch.exposedHeaders) > 0 {
+		ch.exposedHeadersValue = []string{strings.Join(ch.exposedHeaders, ",")}
+	}
+	if ch.maxAge > 0 {
+		ch.maxAgeValue = []string{strconv.Itoa(ch.maxAge)}
+	}
+}
 
-	return ch
+// lookupRequestHeader returns the allowed request header named name, in any
+// case, lowercasing it on the stack.
+func (ch *cors) lookupRequestHeader(name string) (corsRequestHeader, bool) {
+	var buf [64]byte
+	if len(name) > len(buf) {
+		h, ok := ch.requestHeaders[strings.ToLower(name)]
+		return h, ok
+	}
+	lower := buf[:len(name)]
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if 'A' <= c && c <= 'Z' {
+			c += 'a' - 'A'
+		}
+		lower[i] = c
+	}
+	h, ok := ch.requestHeaders[string(lower)]
+	return h, ok
 }
 
 //
@@ -242,12 +386,21 @@ func AllowedOrigins(origins []string) CORSOption {
 		}
 
 		ch.allowedOrigins = origins
+		for _, v := range origins {
+			if u, err := url.Parse(v); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" {
+				return fmt.Errorf("handlers: invalid CORS origin %q", v)
+			}
+		}
 		return nil
 	}
 }
 
 // AllowedOriginValidator sets a function for evaluating allowed origins in CORS requests, represented by the
 // 'Allow-Access-Control-Origin' HTTP header.
+// The function is called on every CORS request, preflight or not, e.g. to look
+// up the origins of tenants in a database, and takes precedence over
+// AllowedOrigins and AllowedOriginPatterns. The origins it allows are echoed in
+// the Access-Control-Allow-Origin header.
 func AllowedOriginValidator(fn OriginValidator) CORSOption {
 	return func(ch *cors) error {
 		ch.allowedOriginValidator = fn
@@ -255,6 +408,46 @@ func AllowedOriginValidator(fn OriginValidator) CORSOption {
 	}
 }
 
+// AllowedOriginPatterns allows the origins matching one of patterns, in
+// addition to those of AllowedOrigins. A pattern is an origin whose host may
+// start with a "*." wildcard, matching one or more labels: "https://*.example.com"
+// allows https://app.example.com and https://eu.app.example.com, but neither
+// https://example.com nor http://app.example.com. Matching is
+// case-insensitive, and the matched origin is echoed in the
+// Access-Control-Allow-Origin header.
+func AllowedOriginPatterns(patterns []string) CORSOption {
+	return func(ch *cors) error {
+		var err error
+		for _, v := range patterns {
+			p, perr := parseOriginPattern(v)
+			if perr != nil {
+				if err == nil {
+					err = perr
+				}
+				continue
+			}
+			ch.originPatterns = append(ch.originPatterns, p)
+		}
+		return err
+	}
+}
+
+func parseOriginPattern(pattern string) (originPattern, error) {
+	p := originPattern{pattern: pattern}
+	origin := pattern
+	if i := strings.Index(pattern, "://*."); i >= 0 {
+		p.wildcard = true
+		p.prefix = pattern[:i+len("://")]
+		p.suffix = pattern[i+len("://*"):]
+		origin = p.prefix + "x" + p.suffix
+	}
+	if u, err := url.Parse(origin); err != nil || u.Scheme == "" || u.Host == "" || u.Path != "" || u.RawQuery != "" ||
+		u.User != nil || strings.Contains(origin, "*") {
+		return p, fmt.Errorf("handlers: invalid CORS origin pattern %q", pattern)
+	}
+	return p, nil
+}
+
 // OptionStatusCode sets a custom status code on the OPTIONS requests.
 // Default behaviour sets it to 200 to reflect best practices. This is option is not mandatory
 // and can be used if you need a custom status code (i.e 204).
@@ -264,6 +457,9 @@ func AllowedOriginValidator(fn OriginValidator) CORSOption {
 func OptionStatusCode(code int) CORSOption {
 	return func(ch *cors) error {
 		ch.optionStatusCode = code
+		if code < 200 || code > 299 {
+			return fmt.Errorf("handlers: invalid CORS preflight status code %d", code)
+		}
 		return nil
 	}
 }
@@ -299,6 +495,9 @@ func MaxAge(age int) CORSOption {
 		}
 
 		ch.maxAge = age
+		if age < 0 {
+			return fmt.Errorf("handlers: invalid CORS max age %d", age)
+		}
 		return nil
 	}
 }
@@ -331,7 +530,7 @@ func (ch *cors) isOriginAllowed(origin string) bool {
 		return ch.allowedOriginValidator(origin)
 	}
 
-	if len(ch.allowedOrigins) == 0 {
+	if len(ch.allowedOrigins) == 0 && len(ch.originPatterns) == 0 {
 		return true
 	}
 
@@ -341,6 +540,12 @@ func (ch *cors) isOriginAllowed(origin string) bool {
 		}
 	}
 
+	for _, p := range ch.originPatterns {
+		if p.match(origin) {
+			return true
+		}
+	}
+
 	return false
 }
 
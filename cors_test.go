@@ -408,3 +408,145 @@ func TestCORSAllowStar(t *testing.T) {
 		t.Fatalf("bad header: expected %q to be %q, got %q.", corsAllowOriginHeader, want, got)
 	}
 }
+
+func TestCORSOriginPatterns(t *testing.T) {
+	h := CORS(
+		AllowedOrigins([]string{"https://example.org"}),
+		AllowedOriginPatterns([]string{"https://*.example.com", "http://*.dev.example.com:8080"}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	tests := []struct {
+		origin  string
+		allowed bool
+	}{
+		{"https://app.example.com", true},
+		{"https://eu.app.example.com", true},
+		{"HTTPS://App.Example.com", true},
+		{"http://api.dev.example.com:8080", true},
+		{"https://example.org", true},
+		{"https://example.com", false},
+		{"http://app.example.com", false},
+		{"https://app.example.com.evil.com", false},
+		{"https://evil.com/.example.com", false},
+		{"https://user@app.example.com", false},
+		{"http://api.dev.example.com", false},
+		{"http://api.dev.example.com:9090", false},
+	}
+	for _, test := range tests {
+		for _, method := range []string{"GET", "OPTIONS"} {
+			r := newRequest(method, "http://api.example.com/")
+			r.Header.Set("Origin", test.origin)
+			if method == "OPTIONS" {
+				r.Header.Set(corsRequestMethodHeader, "GET")
+			}
+			rr := httptest.NewRecorder()
+			h.ServeHTTP(rr, r)
+
+			want := ""
+			if test.allowed {
+				want = test.origin
+			}
+			if got := rr.Header().Get(corsAllowOriginHeader); got != want {
+				t.Errorf("%s %s: got %s %q, want %q", method, test.origin, corsAllowOriginHeader, got, want)
+			}
+			if test.allowed && rr.Header().Get(corsVaryHeader) != corsOriginHeader {
+				t.Errorf("%s %s: missing Vary: Origin", method, test.origin)
+			}
+		}
+	}
+}
+
+func TestCORSOriginValidatorSetsVaryHeader(t *testing.T) {
+	r := newRequest("GET", "http://api.example.com/")
+	r.Header.Set("Origin", "https://tenant.example.com")
+	rr := httptest.NewRecorder()
+
+	CORS(AllowedOriginValidator(func(origin string) bool { return origin == "https://tenant.example.com" }))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})).ServeHTTP(rr, r)
+	if got := rr.Header().Get(corsAllowOriginHeader); got != "https://tenant.example.com" {
+		t.Errorf("got %s %q", corsAllowOriginHeader, got)
+	}
+	if got := rr.Header().Get(corsVaryHeader); got != corsOriginHeader {
+		t.Errorf("got %s %q, want %q", corsVaryHeader, got, corsOriginHeader)
+	}
+}
+
+func TestNewCORS(t *testing.T) {
+	tests := []struct {
+		opts []CORSOption
+		ok   bool
+	}{
+		{[]CORSOption{AllowedOrigins([]string{"https://example.com", "http://localhost:8080"})}, true},
+		{[]CORSOption{AllowedOrigins([]string{"*"}), MaxAge(60)}, true},
+		{[]CORSOption{AllowedOrigins([]string{"example.com"})}, false},
+		{[]CORSOption{AllowedOrigins([]string{"https://example.com/"})}, false},
+		{[]CORSOption{OptionStatusCode(204)}, true},
+		{[]CORSOption{OptionStatusCode(404)}, false},
+		{[]CORSOption{MaxAge(-1)}, false},
+		{[]CORSOption{AllowedOrigins([]string{"*"}), AllowCredentials()}, false},
+		{[]CORSOption{AllowedOriginPatterns([]string{"https://*.example.com", "http://localhost:3000"})}, true},
+		{[]CORSOption{AllowedOriginPatterns([]string{"*.example.com"})}, false},
+		{[]CORSOption{AllowedOriginPatterns([]string{"https://app.*.example.com"})}, false},
+		{[]CORSOption{AllowedOriginPatterns([]string{"https://*.example.com/"})}, false},
+		{[]CORSOption{AllowedOriginPatterns([]string{"https://*"})}, false},
+	}
+	for i, test := range tests {
+		mw, err := NewCORS(test.opts...)
+		if (err == nil) != test.ok || (mw != nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
+
+func TestCORSAllocs(t *testing.T) {
+	h := CORS(
+		AllowedOrigins([]string{"https://app.example.com", "https://admin.example.com"}),
+		AllowedHeaders([]string{"X-Requested-With"}),
+		ExposedHeaders([]string{"X-Request-Id"}),
+		MaxAge(600),
+		AllowCredentials(),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := newRequest("GET", "http://api.example.com/items")
+	get.Header.Set("Origin", "https://app.example.com")
+	preflight := newRequest("OPTIONS", "http://api.example.com/items")
+	preflight.Header.Set("Origin", "https://app.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", "POST")
+	preflight.Header.Set("Access-Control-Request-Headers", "accept, content-language")
+	w := &discardResponseWriter{header: http.Header{}}
+
+	for _, r := range []*http.Request{get, preflight} {
+		if allocs := testing.AllocsPerRun(100, func() { w.reset(); h.ServeHTTP(w, r) }); allocs != 0 {
+			t.Errorf("%s: got %v allocations per request, want 0", r.Method, allocs)
+		}
+	}
+}
+
+func BenchmarkCORS(b *testing.B) {
+	h := CORS(
+		AllowedOrigins([]string{"https://app.example.com", "https://admin.example.com"}),
+		ExposedHeaders([]string{"X-Request-Id", "X-Total-Count"}),
+		AllowCredentials(),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	get := newRequest("GET", "http://api.example.com/items")
+	get.Header.Set("Origin", "https://admin.example.com")
+	preflight := newRequest("OPTIONS", "http://api.example.com/items")
+	preflight.Header.Set("Origin", "https://admin.example.com")
+	preflight.Header.Set("Access-Control-Request-Method", "GET")
+	preflight.Header.Set("Access-Control-Request-Headers", "accept, content-language")
+	w := &discardResponseWriter{header: http.Header{}}
+
+	for _, bench := range []struct {
+		name string
+		r    *http.Request
+	}{{"GET", get}, {"Preflight", preflight}} {
+		b.Run(bench.name, func(b *testing.B) {
+			b.ReportAllocs()
+			for i := 0; i < b.N; i++ {
+				w.reset()
+				h.ServeHTTP(w, bench.r)
+			}
+		})
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net"
+	"net/http"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const defaultDashboardSize = 100
+
+// DashboardRequest is a request shown by the Dashboard.
+type DashboardRequest struct {
+	Start     time.Time     `json:"start"`
+	Method    string        `json:"method"`
+	Path      string        `json:"path"`
+	Status    int           `json:"status,omitempty"`
+	Duration  time.Duration `json:"duration"`
+	ClientIP  string        `json:"client_ip"`
+	RequestID string        `json:"request_id,omitempty"`
+}
+
+// DashboardSnapshot is the JSON document served by the Dashboard.
+type DashboardSnapshot struct {
+	InFlight []DashboardRequest `json:"in_flight"`
+	Recent   []DashboardRequest `json:"recent"`
+}
+
+// Dashboard keeps track of the requests in flight and of the most recent
+// completed ones, and serves them as a HTML page or JSON document for quick
+// operational visibility on small deployments.
+//
+// Requests are recorded by the middleware returned by Handler. The dashboard
+// itself is a http.Handler, guarded by the options given to NewDashboard.
+type Dashboard struct {
+	guard http.Handler
+
+	mu       sync.Mutex
+	recent   []DashboardRequest
+	next     int
+	full     bool
+	seq      uint64
+	inFlight map[uint64]*DashboardRequest
+}
+
+// NewDashboard returns a Dashboard keeping the last size completed requests.
+// Access to the dashboard is restricted by the given options; without any
+// option only loopback clients are allowed.
+//
+// Example:
+//
+//	dashboard := handlers.NewDashboard(200, handlers.GuardBasicAuth("ops", password))
+//	mux.Handle("/debug/requests", dashboard)
+//	http.ListenAndServe(":1123", dashboard.Handler(mux))
+func NewDashboard(size int, opts ...GuardOption) *Dashboard {
+	if size <= 0 {
+		size = defaultDashboardSize
+	}
+	d := &Dashboard{
+		recent:   make([]DashboardRequest, size),
+		inFlight: map[uint64]*DashboardRequest{},
+	}
+	d.guard = newGuard(http.HandlerFunc(d.serve), opts...)
+	return d
+}
+
+// Handler returns HTTP middleware recording the requests served by h in the
+// dashboard.
+func (d *Dashboard) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("dashboard", w, r)
+		defer end()
+
+		host, _, err := net.SplitHostPort(r.RemoteAddr)
+		if err != nil {
+			host = r.RemoteAddr
+		}
+		entry := &DashboardRequest{
+			Start:     time.Now(),
+			Method:    r.Method,
+			Path:      r.URL.Path,
+			ClientIP:  host,
+			RequestID: RequestID(r),
+		}
+
+		d.mu.Lock()
+		d.seq++
+		id := d.seq
+		d.inFlight[id] = entry
+		d.mu.Unlock()
+
+		logger, lw := makeLogger(w)
+		defer func() {
+			d.mu.Lock()
+			delete(d.inFlight, id)
+			done := *entry
+			done.Status = logger.Status()
+			done.Duration = time.Since(entry.Start)
+			if done.RequestID == "" {
+				done.RequestID = w.Header().Get(RequestIDHeader)
+			}
+			d.recent[d.next] = done
+			d.next = (d.next + 1) % len(d.recent)
+			if d.next == 0 {
+				d.full = true
+			}
+			d.mu.Unlock()
+		}()
+
+		h.ServeHTTP(lw, r)
+	})
+}
+
+// Snapshot returns the requests in flight, oldest first, and the recent
+// completed requests, newest first.
+func (d *Dashboard) Snapshot() DashboardSnapshot {
+	now := time.Now()
+	d.mu.Lock()
+	defer d.mu.Unlock()
+
+	s := DashboardSnapshot{
+		InFlight: make([]DashboardRequest, 0, len(d.inFlight)),
+		Recent:   []DashboardRequest{},
+	}
+	for _, e := range d.inFlight {
+		r := *e
+		r.Duration = now.Sub(r.Start)
+		s.InFlight = append(s.InFlight, r)
+	}
+	sort.Slice(s.InFlight, func(i, j int) bool { return s.InFlight[i].Start.Before(s.InFlight[j].Start) })
+
+	n := d.next
+	if d.full {
+		n = len(d.recent)
+	}
+	for i := 1; i <= n; i++ {
+		s.Recent = append(s.Recent, d.recent[(d.next-i+len(d.recent))%len(d.recent)])
+	}
+	return s
+}
+
+// ServeHTTP serves the dashboard: a JSON DashboardSnapshot if the client
+// accepts application/json (or with ?format=json), a HTML page otherwise.
+func (d *Dashboard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	d.guard.ServeHTTP(w, r)
+}
+
+func (d *Dashboard) serve(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Cache-Control", "no-store")
+	snapshot := d.Snapshot()
+
+	if r.URL.Query().Get("format") == "json" || strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(snapshot)
+		return
+	}
+
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	dashboardTemplate.Execute(w, snapshot)
+}
+
+var dashboardTemplate = template.Must(template.New("dashboard").Parse(`<!DOCTYPE html>
+<html>
+<head>
+<meta charset="utf-8">
+<meta http-equiv="refresh" content="5">
+<title>Requests</title>
+<style>
+body { font-family: sans-serif; font-size: 14px; }
+table { border-collapse: collapse; margin-bottom: 2em; }
+th, td { padding: 2px 8px; text-align: left; border-bottom: 1px solid #ddd; }
+</style>
+</head>
+<body>
+{{define "rows"}}<table>
+<tr><th>Start</th><th>Method</th><th>Path</th><th>Status</th><th>Duration</th><th>Client IP</th><th>Request ID</th></tr>
+{{range .}}<tr><td>{{.Start.Format "15:04:05.000"}}</td><td>{{.Method}}</td><td>{{.Path}}</td><td>{{if .Status}}{{.Status}}{{end}}</td><td>{{.Duration}}</td><td>{{.ClientIP}}</td><td>{{.RequestID}}</td></tr>
+{{end}}</table>{{end}}
+<h2>In flight ({{len .InFlight}})</h2>
+{{template "rows" .InFlight}}
+<h2>Recent ({{len .Recent}})</h2>
+{{template "rows" .Recent}}
+</body>
+</html>
+`))
@@ -0,0 +1,70 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestDashboard(t *testing.T) {
+	d := NewDashboard(2)
+
+	view := func(accept string) *httptest.ResponseRecorder {
+		r := newRequest("GET", "/debug/requests")
+		r.RemoteAddr = "127.0.0.1:1234"
+		r.Header.Set("Accept", accept)
+		rec := httptest.NewRecorder()
+		d.ServeHTTP(rec, r)
+		return rec
+	}
+
+	var inFlight DashboardSnapshot
+	handler := d.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/slow" {
+			json.Unmarshal(view("application/json").Body.Bytes(), &inFlight)
+		}
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	for _, path := range []string{"/a", "/b", "/slow"} {
+		r := newRequest("GET", "http://example.com"+path)
+		r.RemoteAddr = "192.0.2.1:1234"
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+	}
+
+	if len(inFlight.InFlight) != 1 || inFlight.InFlight[0].Path != "/slow" {
+		t.Fatalf("bad in-flight requests: %+v", inFlight.InFlight)
+	}
+
+	s := d.Snapshot()
+	if len(s.InFlight) != 0 {
+		t.Fatalf("bad in-flight requests after completion: %+v", s.InFlight)
+	}
+	if len(s.Recent) != 2 || s.Recent[0].Path != "/slow" || s.Recent[1].Path != "/b" {
+		t.Fatalf("bad recent requests: %+v", s.Recent)
+	}
+	if e := s.Recent[0]; e.Status != http.StatusTeapot || e.ClientIP != "192.0.2.1" || e.Method != "GET" {
+		t.Fatalf("bad entry: %+v", e)
+	}
+
+	rec := view("text/html")
+	if ct := rec.Header().Get("Content-Type"); !strings.HasPrefix(ct, "text/html") {
+		t.Fatalf("bad content type: %q", ct)
+	}
+	if !strings.Contains(rec.Body.String(), "/slow") {
+		t.Fatalf("dashboard page doesn't list requests: %s", rec.Body.String())
+	}
+}
+
+func TestDashboardGuarded(t *testing.T) {
+	r := newRequest("GET", "/debug/requests")
+	r.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	NewDashboard(10).ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// DeprecationOption represents a functional option for configuring the
+// Deprecated middleware.
+type DeprecationOption func(*deprecation) error
+
+type deprecation struct {
+	h             http.Handler
+	since         time.Time
+	sunset        time.Time
+	enforceSunset bool
+	links         []string
+	client        func(*http.Request) string
+	observer      func(r *http.Request, client string)
+	now           func() time.Time
+}
+
+// DeprecationSunset announces the date after which the route will stop
+// responding, in the Sunset header (RFC 8594).
+func DeprecationSunset(t time.Time) DeprecationOption {
+	return func(d *deprecation) error {
+		d.sunset = t
+		return nil
+	}
+}
+
+// DeprecationEnforceSunset answers requests with 410 Gone once the sunset date
+// has passed.
+func DeprecationEnforceSunset() DeprecationOption {
+	return func(d *deprecation) error {
+		d.enforceSunset = true
+		return nil
+	}
+}
+
+// DeprecationSuccessor links to the route replacing the deprecated one, with a
+// Link header of relation type "successor-version".
+func DeprecationSuccessor(url string) DeprecationOption {
+	return func(d *deprecation) error {
+		d.links = append(d.links, "<"+url+`>; rel="successor-version"`)
+		return nil
+	}
+}
+
+// DeprecationDocs links to documentation about the deprecation, e.g. a
+// migration guide, with a Link header of relation type "deprecation".
+func DeprecationDocs(url string) DeprecationOption {
+	return func(d *deprecation) error {
+		d.links = append(d.links, "<"+url+`>; rel="deprecation"`)
+		return nil
+	}
+}
+
+// DeprecationClient sets the function identifying the client of a request,
+// as passed to the observer. It defaults to the User-Agent header.
+func DeprecationClient(fn func(r *http.Request) string) DeprecationOption {
+	return func(d *deprecation) error {
+		d.client = fn
+		return nil
+	}
+}
+
+// DeprecationObserver sets a function called for each request to the
+// deprecated route, with the client identified by DeprecationClient, e.g. to
+// find the clients to contact before the sunset. See DeprecationCounter.
+func DeprecationObserver(fn func(r *http.Request, client string)) DeprecationOption {
+	return func(d *deprecation) error {
+		d.observer = fn
+		return nil
+	}
+}
+
+// Deprecated is HTTP middleware marking the routes it wraps as deprecated
+// since the given date, with the Deprecation response header (RFC 9745). A
+// zero date sends the "true" value of earlier drafts instead. Sunset dates and
+// links to the successor route and documentation are announced as configured.
+//
+// Example:
+//
+//	calls := &handlers.DeprecationCounter{}
+//	deprecated := handlers.Deprecated(time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC),
+//		handlers.DeprecationSunset(time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)),
+//		handlers.DeprecationSuccessor("/v2/orders"),
+//		handlers.DeprecationObserver(calls.Observe),
+//	)
+//	mux.Handle("/v1/orders", deprecated(ordersV1))
+func Deprecated(since time.Time, opts ...DeprecationOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		d := &deprecation{
+			h:     h,
+			since: since,
+			client: func(r *http.Request) string {
+				return r.UserAgent()
+			},
+			now: time.Now,
+		}
+		for _, option := range opts {
+			option(d)
+		}
+		return d
+	}
+}
+
+func (d *deprecation) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("deprecation", w, r)
+	defer end()
+
+	h := w.Header()
+	if d.since.IsZero() {
+		h.Set("Deprecation", "true")
+	} else {
+		h.Set("Deprecation", "@"+strconv.FormatInt(d.since.Unix(), 10))
+	}
+	if !d.sunset.IsZero() {
+		h.Set("Sunset", d.sunset.UTC().Format(http.TimeFormat))
+	}
+	for _, link := range d.links {
+		h.Add("Link", link)
+	}
+	if d.observer != nil {
+		d.observer(r, d.client(r))
+	}
+
+	if d.enforceSunset && !d.sunset.IsZero() && d.now().After(d.sunset) {
+		if !writeProblem(w, r, http.StatusGone, "") {
+			http.Error(w, http.StatusText(http.StatusGone), http.StatusGone)
+		}
+		return
+	}
+	d.h.ServeHTTP(w, r)
+}
+
+// DeprecationCounter counts the calls to deprecated routes by client. Its
+// Observe method is meant for DeprecationObserver. The zero value is ready to
+// use, and can be shared between routes.
+type DeprecationCounter struct {
+	mu     sync.Mutex
+	counts map[string]int64
+}
+
+// Observe counts a call by client.
+func (c *DeprecationCounter) Observe(r *http.Request, client string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.counts == nil {
+		c.counts = make(map[string]int64)
+	}
+	c.counts[client]++
+}
+
+// Counts returns the number of calls of each client.
+func (c *DeprecationCounter) Counts() map[string]int64 {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	counts := make(map[string]int64, len(c.counts))
+	for client, n := range c.counts {
+		counts[client] = n
+	}
+	return counts
+}
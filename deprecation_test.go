@@ -0,0 +1,51 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestDeprecated(t *testing.T) {
+	since := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	sunset := time.Date(2024, 7, 1, 0, 0, 0, 0, time.UTC)
+	calls := &DeprecationCounter{}
+	h := Deprecated(since,
+		DeprecationSunset(sunset),
+		DeprecationSuccessor("/v2/orders"),
+		DeprecationDocs("https://example.com/migrate"),
+		DeprecationObserver(calls.Observe),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for _, ua := range []string{"a/1", "b/1", "a/1"} {
+		r := newRequest("GET", "/v1/orders")
+		r.Header.Set("User-Agent", ua)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK {
+			t.Fatalf("wrong status: %d", rec.Code)
+		}
+		hdr := rec.Header()
+		if hdr.Get("Deprecation") != "@1704067200" || hdr.Get("Sunset") != "Mon, 01 Jul 2024 00:00:00 GMT" {
+			t.Fatalf("wrong headers: %v", hdr)
+		}
+		if links := hdr.Values("Link"); len(links) != 2 || links[0] != `</v2/orders>; rel="successor-version"` || links[1] != `<https://example.com/migrate>; rel="deprecation"` {
+			t.Fatalf("wrong links: %q", links)
+		}
+	}
+	if counts := calls.Counts(); counts["a/1"] != 2 || counts["b/1"] != 1 {
+		t.Fatalf("wrong counts: %v", counts)
+	}
+}
+
+func TestDeprecatedSunset(t *testing.T) {
+	sunset := time.Now().Add(-time.Hour)
+	h := Deprecated(time.Time{}, DeprecationSunset(sunset), DeprecationEnforceSunset())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusGone || rec.Header().Get("Deprecation") != "true" {
+		t.Fatalf("wrong response: %d %v", rec.Code, rec.Header())
+	}
+}
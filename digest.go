@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"crypto/sha512"
+	"crypto/subtle"
+	"encoding/base64"
+	"fmt"
+	"hash"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"strings"
+)
+
+const (
+	contentDigestHeader = "Content-Digest"
+	reprDigestHeader    = "Repr-Digest"
+
+	defaultDigestMaxSize     = 1 << 20
+	defaultDigestMaxBodySize = 10 << 20
+)
+
+// digestAlgorithms are the hash algorithms of the HTTP Digest Algorithm
+// Values Registry supported by the Digest middleware.
+var digestAlgorithms = map[string]func() hash.Hash{
+	"sha-256": sha256.New,
+	"sha-512": sha512.New,
+}
+
+// DigestOption represents a functional option for configuring the Digest
+// middleware.
+type DigestOption func(*digest) error
+
+type digest struct {
+	h           http.Handler
+	algorithms  []string
+	maxSize     int
+	maxBodySize int64
+}
+
+// Digest is HTTP middleware implementing integrity fields (RFC 9530).
+//
+// Request bodies carrying a Content-Digest header, or a Repr-Digest header
+// when they have no content coding, are read and checked against it before
+// the wrapped handler runs: a mismatch yields 400 Bad Request, and a body
+// larger than the maximum size (10MiB by default) 413 Request Entity Too
+// Large. Digests using only unsupported algorithms are ignored.
+//
+// Responses are buffered up to a maximum size (1MiB by default) and sent with
+// a Content-Digest header, and a Repr-Digest header when the client asks for
+// one with Want-Repr-Digest and the response has no content coding. Larger
+// responses, responses flushed by the handler, and responses which already
+// have a Content-Digest are passed through untouched.
+//
+// Example:
+//
+//	digest := handlers.Digest(handlers.DigestAlgorithms("sha-512"))
+//	http.ListenAndServe(":1123", digest(r))
+func Digest(opts ...DigestOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		d := &digest{
+			h:           h,
+			algorithms:  []string{"sha-256"},
+			maxSize:     defaultDigestMaxSize,
+			maxBodySize: defaultDigestMaxBodySize,
+		}
+		for _, option := range opts {
+			option(d)
+		}
+		return d
+	}
+}
+
+// NewDigest is like Digest, but returns an error if an option is invalid, e.g.
+// an unsupported algorithm.
+func NewDigest(opts ...DigestOption) (func(http.Handler) http.Handler, error) {
+	d := &digest{}
+	for _, option := range opts {
+		if err := option(d); err != nil {
+			return nil, err
+		}
+	}
+	return Digest(opts...), nil
+}
+
+// DigestAlgorithms sets the algorithms used to compute response digests,
+// among "sha-256" (the default) and "sha-512". Unsupported algorithms are
+// ignored.
+func DigestAlgorithms(names ...string) DigestOption {
+	return func(d *digest) error {
+		var algorithms []string
+		var err error
+		for _, name := range names {
+			name = strings.ToLower(name)
+			if _, ok := digestAlgorithms[name]; ok {
+				algorithms = append(algorithms, name)
+			} else if err == nil {
+				err = fmt.Errorf("handlers: unsupported digest algorithm %q", name)
+			}
+		}
+		if len(algorithms) > 0 {
+			d.algorithms = algorithms
+		}
+		return err
+	}
+}
+
+// DigestMaxSize sets the maximum size of the responses buffered to compute
+// their digest. Larger responses are streamed without digest.
+func DigestMaxSize(n int) DigestOption {
+	return func(d *digest) error {
+		d.maxSize = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid digest max size %d", n)
+		}
+		return nil
+	}
+}
+
+// DigestMaxBodySize sets the maximum size of the request bodies read to
+// validate their digest.
+func DigestMaxBodySize(n int64) DigestOption {
+	return func(d *digest) error {
+		d.maxBodySize = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid digest max body size %d", n)
+		}
+		return nil
+	}
+}
+
+func (d *digest) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("digest", w, r)
+	defer end()
+
+	if isStreamingRequest(r) {
+		d.h.ServeHTTP(w, r)
+		return
+	}
+	if code := d.validateRequest(r); code != 0 {
+		http.Error(w, http.StatusText(code), code)
+		return
+	}
+
+	if r.Method == "HEAD" {
+		d.h.ServeHTTP(w, r)
+		return
+	}
+
+	bw := &bufferedResponseWriter{w: w, max: d.maxSize}
+	d.h.ServeHTTP(bw.wrap(), r)
+	if bw.passthrough {
+		return
+	}
+
+	h := w.Header()
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	if bw.status != http.StatusNotModified && bw.status != http.StatusNoContent && h.Get(contentDigestHeader) == "" {
+		value := formatDigest(bw.buf.Bytes(), d.algorithms)
+		h.Set(contentDigestHeader, value)
+		if r.Header.Get("Want-Repr-Digest") != "" && h.Get("Content-Encoding") == "" && h.Get(reprDigestHeader) == "" {
+			h.Set(reprDigestHeader, value)
+		}
+	}
+	bw.flush()
+}
+
+// validateRequest checks the digests of the request body, and returns the
+// status code of the error response to send if they don't match.
+func (d *digest) validateRequest(r *http.Request) int {
+	var fields []string
+	if v := r.Header.Get(contentDigestHeader); v != "" {
+		fields = append(fields, v)
+	}
+	if v := r.Header.Get(reprDigestHeader); v != "" && r.Header.Get("Content-Encoding") == "" {
+		fields = append(fields, v)
+	}
+	if len(fields) == 0 || r.Body == nil {
+		return 0
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, d.maxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return http.StatusBadRequest
+	}
+	if int64(len(body)) > d.maxBodySize {
+		return http.StatusRequestEntityTooLarge
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	for _, field := range fields {
+		if !verifyDigest(field, body) {
+			return http.StatusBadRequest
+		}
+	}
+	return 0
+}
+
+// formatDigest returns the value of a Content-Digest or Repr-Digest field for
+// body, a dictionary of byte sequences (RFC 8941).
+func formatDigest(body []byte, algorithms []string) string {
+	values := make([]string, 0, len(algorithms))
+	for _, name := range algorithms {
+		h := digestAlgorithms[name]()
+		h.Write(body)
+		values = append(values, name+"=:"+base64.StdEncoding.EncodeToString(h.Sum(nil))+":")
+	}
+	return strings.Join(values, ", ")
+}
+
+// verifyDigest reports whether all the digests with a supported algorithm in
+// the field match body.
+func verifyDigest(field string, body []byte) bool {
+	for _, member := range strings.Split(field, ",") {
+		name, value := member, ""
+		if i := strings.IndexByte(member, '='); i != -1 {
+			name, value = member[:i], member[i+1:]
+		}
+		newHash, ok := digestAlgorithms[strings.ToLower(strings.TrimSpace(name))]
+		if !ok {
+			continue
+		}
+		value = strings.TrimSpace(value)
+		if len(value) < 2 || value[0] != ':' || value[len(value)-1] != ':' {
+			return false
+		}
+		want, err := base64.StdEncoding.DecodeString(value[1 : len(value)-1])
+		if err != nil {
+			return false
+		}
+		h := newHash()
+		h.Write(body)
+		if subtle.ConstantTimeCompare(h.Sum(nil), want) != 1 {
+			return false
+		}
+	}
+	return true
+}
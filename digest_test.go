@@ -0,0 +1,95 @@
+package handlers
+
+import (
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Examples from RFC 9530, appendix D.
+const (
+	digestBody   = `{"hello": "world"}`
+	digestSHA256 = "sha-256=:X48E9qOokqqrvdts8nOJRJN3OWDUoyWxBf7kbu9DBPE=:"
+	digestSHA512 = "sha-512=:WZDPaVn/7XgHaAy8pmojAkGWoRx2UFChF41A2svX+TaPm+AbwAgBWnrIiYllu7BNNyealdVLvRwEmTHWXvJwew==:"
+)
+
+func TestDigestResponse(t *testing.T) {
+	handler := Digest(DigestAlgorithms("sha-256", "sha-512", "md5"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, digestBody)
+	}))
+
+	r := newRequest("GET", "/")
+	r.Header.Set("Want-Repr-Digest", "sha-256=1")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	want := digestSHA256 + ", " + digestSHA512
+	if got := rec.Header().Get(contentDigestHeader); got != want {
+		t.Fatalf("bad Content-Digest: got %q want %q", got, want)
+	}
+	if got := rec.Header().Get(reprDigestHeader); got != want {
+		t.Fatalf("bad Repr-Digest: got %q want %q", got, want)
+	}
+	if rec.Body.String() != digestBody {
+		t.Fatalf("bad body: %q", rec.Body.String())
+	}
+}
+
+func TestDigestRequest(t *testing.T) {
+	handler := Digest()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		b, _ := ioutil.ReadAll(r.Body)
+		if string(b) != digestBody {
+			t.Errorf("bad request body: %q", b)
+		}
+	}))
+
+	tests := []struct {
+		header string
+		value  string
+		code   int
+	}{
+		{"", "", http.StatusOK},
+		{contentDigestHeader, digestSHA256, http.StatusOK},
+		{contentDigestHeader, digestSHA512 + ", " + digestSHA256, http.StatusOK},
+		{reprDigestHeader, digestSHA256, http.StatusOK},
+		{contentDigestHeader, "md5=:AAAA:", http.StatusOK},
+		{contentDigestHeader, "sha-256=:AAAA:", http.StatusBadRequest},
+		{contentDigestHeader, "sha-256=AAAA", http.StatusBadRequest},
+	}
+
+	for _, test := range tests {
+		r := httptest.NewRequest("POST", "/", strings.NewReader(digestBody))
+		if test.header != "" {
+			r.Header.Set(test.header, test.value)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%s: %s: bad status: got %d want %d", test.header, test.value, rec.Code, test.code)
+		}
+	}
+
+	handler = Digest(DigestMaxBodySize(4))(okHandler)
+	r := httptest.NewRequest("POST", "/", strings.NewReader(digestBody))
+	r.Header.Set(contentDigestHeader, digestSHA256)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("bad status for a large body: got %d want %d", rec.Code, http.StatusRequestEntityTooLarge)
+	}
+}
+
+func TestNewDigest(t *testing.T) {
+	if _, err := NewDigest(DigestAlgorithms("sha-256", "SHA-512")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewDigest(DigestAlgorithms("sha-256", "md5")); err == nil || !strings.Contains(err.Error(), `"md5"`) {
+		t.Fatalf("expected an error for md5, got %v", err)
+	}
+	if _, err := NewDigest(DigestMaxBodySize(-1)); err == nil {
+		t.Fatal("expected an error for a negative max body size")
+	}
+}
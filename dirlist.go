@@ -0,0 +1,219 @@
+package handlers
+
+import (
+	"encoding/json"
+	"html/template"
+	"net/http"
+	"path"
+	"sort"
+	"strings"
+	"time"
+)
+
+// DirectoryEntry is an entry of a directory listing.
+type DirectoryEntry struct {
+	Name    string    `json:"name"`
+	IsDir   bool      `json:"is_dir"`
+	Size    int64     `json:"size"`
+	ModTime time.Time `json:"mod_time"`
+}
+
+// DirectoryIndex is a directory listing, as rendered by the template of
+// DirectoryHandler or encoded in JSON.
+type DirectoryIndex struct {
+	// Path is the URL path of the directory, with a trailing slash.
+	Path string `json:"path"`
+	// Sort and Order are the sort key ("name", "size" or "modified") and
+	// order ("asc" or "desc") of the entries.
+	Sort    string           `json:"sort"`
+	Order   string           `json:"order"`
+	Entries []DirectoryEntry `json:"entries"`
+}
+
+// DirectoryOption represents a functional option for configuring
+// DirectoryHandler.
+type DirectoryOption func(*directoryHandler) error
+
+type directoryHandler struct {
+	root       http.FileSystem
+	files      http.Handler
+	tmpl       *template.Template
+	showHidden bool
+	sort       string
+}
+
+var defaultDirectoryTemplate = template.Must(template.New("directory").Parse(`<!DOCTYPE html>
+<html>
+<head><meta charset="utf-8"><title>Index of {{.Path}}</title></head>
+<body>
+<h1>Index of {{.Path}}</h1>
+<table>
+<tr><th><a href="?sort=name">Name</a></th><th><a href="?sort=size">Size</a></th><th><a href="?sort=modified">Modified</a></th></tr>
+{{if ne .Path "/"}}<tr><td><a href="../">../</a></td><td></td><td></td></tr>
+{{end}}{{range .Entries}}<tr><td><a href="{{.Name}}{{if .IsDir}}/{{end}}">{{.Name}}{{if .IsDir}}/{{end}}</a></td><td>{{if not .IsDir}}{{.Size}}{{end}}</td><td>{{.ModTime.UTC.Format "2006-01-02 15:04:05"}}</td></tr>
+{{end}}</table>
+</body>
+</html>
+`))
+
+// DirectoryHandler returns a handler serving the files of root like
+// http.FileServer, but with a better directory listing: entries can be
+// sorted with the "sort" (name, size or modified) and "order" (asc or desc)
+// query parameters, hidden files (starting with a dot) are neither listed
+// nor served, and clients sending "Accept: application/json" get the
+// listing as a JSON DirectoryIndex. Directories containing an index.html
+// file are served that file instead.
+//
+// Example:
+//
+//	http.Handle("/files/", http.StripPrefix("/files", handlers.DirectoryHandler(http.Dir("/srv/files"))))
+func DirectoryHandler(root http.FileSystem, opts ...DirectoryOption) http.Handler {
+	d := &directoryHandler{
+		root:  root,
+		files: http.FileServer(root),
+		tmpl:  defaultDirectoryTemplate,
+		sort:  "name",
+	}
+	for _, option := range opts {
+		option(d)
+	}
+	return d
+}
+
+// DirectoryTemplate sets the template rendering directory listings, executed
+// with a DirectoryIndex.
+func DirectoryTemplate(tmpl *template.Template) DirectoryOption {
+	return func(d *directoryHandler) error {
+		d.tmpl = tmpl
+		return nil
+	}
+}
+
+// DirectoryShowHidden makes the handler list and serve hidden files.
+func DirectoryShowHidden() DirectoryOption {
+	return func(d *directoryHandler) error {
+		d.showHidden = true
+		return nil
+	}
+}
+
+// DirectoryDefaultSort sets the default sort key of listings: "name" (the
+// default), "size" or "modified".
+func DirectoryDefaultSort(key string) DirectoryOption {
+	return func(d *directoryHandler) error {
+		d.sort = key
+		return nil
+	}
+}
+
+func isHidden(p string) bool {
+	for _, segment := range strings.Split(p, "/") {
+		if strings.HasPrefix(segment, ".") {
+			return true
+		}
+	}
+	return false
+}
+
+func (d *directoryHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("directory", w, r)
+	defer end()
+
+	p := path.Clean("/" + r.URL.Path)
+	if !d.showHidden && isHidden(p) {
+		http.NotFound(w, r)
+		return
+	}
+
+	f, err := d.root.Open(p)
+	if err != nil {
+		d.files.ServeHTTP(w, r)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || !fi.IsDir() {
+		d.files.ServeHTTP(w, r)
+		return
+	}
+	if index, err := d.root.Open(path.Join(p, "index.html")); err == nil {
+		index.Close()
+		d.files.ServeHTTP(w, r)
+		return
+	}
+	if !strings.HasSuffix(r.URL.Path, "/") {
+		// Relative links in the listing require a trailing slash.
+		http.Redirect(w, r, path.Base(r.URL.Path)+"/", http.StatusMovedPermanently)
+		return
+	}
+
+	infos, err := f.Readdir(-1)
+	if err != nil {
+		http.Error(w, "Error reading directory", http.StatusInternalServerError)
+		return
+	}
+
+	index := DirectoryIndex{
+		Path:    strings.TrimSuffix(p, "/") + "/",
+		Sort:    d.sort,
+		Order:   "asc",
+		Entries: make([]DirectoryEntry, 0, len(infos)),
+	}
+	for _, info := range infos {
+		if !d.showHidden && strings.HasPrefix(info.Name(), ".") {
+			continue
+		}
+		index.Entries = append(index.Entries, DirectoryEntry{
+			Name:    info.Name(),
+			IsDir:   info.IsDir(),
+			Size:    info.Size(),
+			ModTime: info.ModTime(),
+		})
+	}
+	query := r.URL.Query()
+	switch query.Get("sort") {
+	case "name", "size", "modified":
+		index.Sort = query.Get("sort")
+	}
+	if query.Get("order") == "desc" {
+		index.Order = "desc"
+	}
+	sortEntries(index.Entries, index.Sort, index.Order == "desc")
+
+	if strings.Contains(r.Header.Get("Accept"), "application/json") {
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(index)
+		return
+	}
+	w.Header().Set("Content-Type", "text/html; charset=utf-8")
+	if err := d.tmpl.Execute(w, index); err != nil {
+		http.Error(w, "Error rendering directory", http.StatusInternalServerError)
+	}
+}
+
+// sortEntries sorts directory entries by key, with directories first.
+func sortEntries(entries []DirectoryEntry, key string, desc bool) {
+	less := func(a, b DirectoryEntry) bool {
+		switch key {
+		case "size":
+			if a.Size != b.Size {
+				return a.Size < b.Size
+			}
+		case "modified":
+			if !a.ModTime.Equal(b.ModTime) {
+				return a.ModTime.Before(b.ModTime)
+			}
+		}
+		return a.Name < b.Name
+	}
+	sort.SliceStable(entries, func(i, j int) bool {
+		a, b := entries[i], entries[j]
+		if a.IsDir != b.IsDir {
+			return a.IsDir
+		}
+		if desc {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+}
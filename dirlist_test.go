@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"testing/fstest"
+	"time"
+)
+
+func TestDirectoryHandler(t *testing.T) {
+	now := time.Now()
+	fsys := fstest.MapFS{
+		"b.txt":           {Data: []byte("bb"), ModTime: now},
+		"a.txt":           {Data: []byte("aaaa"), ModTime: now.Add(-time.Hour)},
+		"c.txt":           {Data: []byte("c"), ModTime: now.Add(-2 * time.Hour)},
+		".secret":         {Data: []byte("s")},
+		"sub/file.txt":    {Data: []byte("f")},
+		"site/index.html": {Data: []byte("<html>site</html>")},
+	}
+	handler := DirectoryHandler(http.FS(fsys))
+
+	listing := func(target string) DirectoryIndex {
+		r := newRequest("GET", target)
+		r.Header.Set("Accept", "application/json")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		var index DirectoryIndex
+		if err := json.Unmarshal(rec.Body.Bytes(), &index); err != nil {
+			t.Fatalf("%s: bad JSON listing: %v %q", target, err, rec.Body.String())
+		}
+		return index
+	}
+	names := func(index DirectoryIndex) string {
+		var names []string
+		for _, e := range index.Entries {
+			names = append(names, e.Name)
+		}
+		return strings.Join(names, ",")
+	}
+
+	for target, want := range map[string]string{
+		"/":                          "site,sub,a.txt,b.txt,c.txt",
+		"/?order=desc":               "sub,site,c.txt,b.txt,a.txt",
+		"/?sort=size":                "site,sub,c.txt,b.txt,a.txt",
+		"/?sort=modified":            "site,sub,c.txt,a.txt,b.txt",
+		"/?sort=modified&order=desc": "sub,site,b.txt,a.txt,c.txt",
+	} {
+		if got := names(listing(target)); got != want {
+			t.Errorf("%s: bad entries: got %s want %s", target, got, want)
+		}
+	}
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/sub/"))
+	if !strings.Contains(rec.Body.String(), `<a href="file.txt">`) || rec.Header().Get("Content-Type") != "text/html; charset=utf-8" {
+		t.Errorf("bad HTML listing: %q", rec.Body.String())
+	}
+
+	for target, code := range map[string]int{
+		"/.secret": http.StatusNotFound,
+		"/a.txt":   http.StatusOK,
+		"/sub":     http.StatusMovedPermanently,
+		"/site/":   http.StatusOK,
+	} {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", target))
+		if rec.Code != code {
+			t.Errorf("%s: bad status: got %d want %d", target, rec.Code, code)
+		}
+	}
+
+	handler = DirectoryHandler(http.FS(fsys), DirectoryShowHidden())
+	if got := names(listing("/")); !strings.Contains(got, ".secret") {
+		t.Errorf("hidden file not listed: %s", got)
+	}
+}
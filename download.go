@@ -0,0 +1,171 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"time"
+)
+
+// DownloadOption represents a functional option for configuring ServeDownload.
+type DownloadOption func(*download) error
+
+type download struct {
+	inline      bool
+	contentType string
+	rate        int
+}
+
+// DownloadInline makes browsers display the content if they can, rather than
+// saving it (Content-Disposition: inline).
+func DownloadInline() DownloadOption {
+	return func(d *download) error {
+		d.inline = true
+		return nil
+	}
+}
+
+// DownloadContentType sets the Content-Type of the download. By default it is
+// derived from the extension of the file name, or sniffed from the content.
+func DownloadContentType(contentType string) DownloadOption {
+	return func(d *download) error {
+		d.contentType = contentType
+		return nil
+	}
+}
+
+// DownloadRateLimit limits the transfer rate of the download to
+// bytesPerSecond.
+func DownloadRateLimit(bytesPerSecond int) DownloadOption {
+	return func(d *download) error {
+		d.rate = bytesPerSecond
+		return nil
+	}
+}
+
+// ServeDownload replies to the request with the content, as a download saved
+// by browsers under name. It sets a Content-Disposition header with the file
+// name encoded per RFC 6266 and RFC 5987, so non-ASCII names are preserved,
+// and supports conditional and range requests (resumed downloads) with
+// http.ServeContent, modtime being the last modification time of the content,
+// or the zero time if unknown.
+//
+// Example:
+//
+//	func export(w http.ResponseWriter, r *http.Request) {
+//		report := bytes.NewReader(generateReport())
+//		handlers.ServeDownload(w, r, "rapport-été.csv", time.Time{}, report,
+//			handlers.DownloadRateLimit(1<<20))
+//	}
+func ServeDownload(w http.ResponseWriter, r *http.Request, name string, modtime time.Time, content io.ReadSeeker, opts ...DownloadOption) {
+	d := &download{}
+	for _, option := range opts {
+		option(d)
+	}
+
+	disposition := "attachment"
+	if d.inline {
+		disposition = "inline"
+	}
+	w.Header().Set("Content-Disposition", contentDisposition(disposition, name))
+	if d.contentType != "" {
+		w.Header().Set("Content-Type", d.contentType)
+	}
+	if d.rate > 0 {
+		content = &throttledReadSeeker{rs: content, ctx: r.Context(), rate: d.rate}
+	}
+	http.ServeContent(w, r, name, modtime, content)
+}
+
+// ServeFileDownload replies to the request with the contents of the named
+// file, as ServeDownload does. The download is named after the file.
+func ServeFileDownload(w http.ResponseWriter, r *http.Request, path string, opts ...DownloadOption) {
+	f, err := os.Open(path)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	ServeDownload(w, r, filepath.Base(path), fi.ModTime(), f, opts...)
+}
+
+// contentDisposition returns a Content-Disposition header value for a file
+// name: a quoted ASCII fallback, and the UTF-8 name in the filename*
+// parameter when it isn't plain ASCII.
+func contentDisposition(disposition, name string) string {
+	var fallback strings.Builder
+	ascii := true
+	for _, r := range name {
+		switch {
+		case r == '"' || r == '\\':
+			fallback.WriteByte('_')
+		case r < 0x20 || r == 0x7f:
+			ascii = false
+		case r > 0x7f:
+			ascii = false
+			fallback.WriteByte('_')
+		default:
+			fallback.WriteRune(r)
+		}
+	}
+
+	v := disposition + `; filename="` + fallback.String() + `"`
+	if !ascii || fallback.String() != name {
+		// url.PathEscape leaves a few characters which aren't attr-chars
+		// unescaped.
+		escaped := url.PathEscape(name)
+		escaped = strings.NewReplacer("'", "%27", "(", "%28", ")", "%29", "*", "%2A", ",", "%2C", ";", "%3B", "=", "%3D", "@", "%40", ":", "%3A").Replace(escaped)
+		v += "; filename*=UTF-8''" + escaped
+	}
+	return v
+}
+
+// throttledReadSeeker limits the rate at which a ReadSeeker is read.
+type throttledReadSeeker struct {
+	rs    io.ReadSeeker
+	ctx   context.Context
+	rate  int
+	start time.Time
+	n     int64
+}
+
+func (t *throttledReadSeeker) Read(p []byte) (int, error) {
+	if t.start.IsZero() {
+		t.start = time.Now()
+	}
+	if len(p) > t.rate {
+		p = p[:t.rate]
+	}
+	n, err := t.rs.Read(p)
+	t.n += int64(n)
+
+	// Wait until the bytes read so far are within the allowed rate.
+	due := t.start.Add(time.Duration(t.n) * time.Second / time.Duration(t.rate))
+	if wait := time.Until(due); wait > 0 {
+		timer := time.NewTimer(wait)
+		defer timer.Stop()
+		select {
+		case <-timer.C:
+		case <-t.ctx.Done():
+			return n, t.ctx.Err()
+		}
+	}
+	return n, err
+}
+
+func (t *throttledReadSeeker) Seek(offset int64, whence int) (int64, error) {
+	return t.rs.Seek(offset, whence)
+}
@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestContentDisposition(t *testing.T) {
+	tests := []struct {
+		name string
+		want string
+	}{
+		{"report.csv", `attachment; filename="report.csv"`},
+		{"rapport été.csv", `attachment; filename="rapport _t_.csv"; filename*=UTF-8''rapport%20%C3%A9t%C3%A9.csv`},
+		{`a"b.txt`, `attachment; filename="a_b.txt"; filename*=UTF-8''a%22b.txt`},
+	}
+	for _, test := range tests {
+		if got := contentDisposition("attachment", test.name); got != test.want {
+			t.Errorf("%q: got %s want %s", test.name, got, test.want)
+		}
+	}
+}
+
+func TestServeDownload(t *testing.T) {
+	content := strings.Repeat("x", 100)
+	serve := func(r *http.Request, opts ...DownloadOption) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		ServeDownload(rec, r, "data.csv", time.Time{}, strings.NewReader(content), opts...)
+		return rec
+	}
+
+	rec := serve(newRequest("GET", "/"))
+	if rec.Code != http.StatusOK || rec.Body.String() != content {
+		t.Fatalf("bad download: %d %q", rec.Code, rec.Body.String())
+	}
+	if got := rec.Header().Get("Content-Type"); got != "text/csv; charset=utf-8" {
+		t.Errorf("bad Content-Type: %q", got)
+	}
+	if got := rec.Header().Get("Content-Disposition"); got != `attachment; filename="data.csv"` {
+		t.Errorf("bad Content-Disposition: %q", got)
+	}
+
+	r := newRequest("GET", "/")
+	r.Header.Set("Range", "bytes=90-")
+	rec = serve(r, DownloadInline(), DownloadContentType("application/octet-stream"))
+	if rec.Code != http.StatusPartialContent || rec.Body.Len() != 10 {
+		t.Fatalf("bad resumed download: %d %q", rec.Code, rec.Body.String())
+	}
+	if rec.Header().Get("Content-Type") != "application/octet-stream" || !strings.HasPrefix(rec.Header().Get("Content-Disposition"), "inline;") {
+		t.Errorf("bad headers: %v", rec.Header())
+	}
+
+	start := time.Now()
+	rec = serve(newRequest("GET", "/"), DownloadRateLimit(500))
+	if elapsed := time.Since(start); elapsed < 150*time.Millisecond || rec.Body.String() != content {
+		t.Errorf("download not rate limited: %v", elapsed)
+	}
+}
+
+func TestServeFileDownload(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorilla_download")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	path := filepath.Join(dir, "notes.txt")
+	if err := ioutil.WriteFile(path, []byte("notes"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	rec := httptest.NewRecorder()
+	ServeFileDownload(rec, newRequest("GET", "/"), path)
+	if rec.Body.String() != "notes" || rec.Header().Get("Content-Disposition") != `attachment; filename="notes.txt"` || rec.Header().Get("Last-Modified") == "" {
+		t.Fatalf("bad download: %v %q", rec.Header(), rec.Body.String())
+	}
+
+	rec = httptest.NewRecorder()
+	ServeFileDownload(rec, newRequest("GET", "/"), filepath.Join(dir, "missing"))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("bad status for a missing file: %d", rec.Code)
+	}
+}
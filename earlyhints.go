@@ -0,0 +1,87 @@
+package handlers
+
+import (
+	"net/http"
+)
+
+// EarlyHintRule associates Link headers to send in a 103 Early Hints response
+// with a path pattern.
+type EarlyHintRule struct {
+	// Path is matched against the request path as in CachePolicy: a pattern
+	// ending with a slash matches any path below it, other patterns are
+	// matched with path.Match, and an empty pattern matches all paths.
+	Path string
+	// Links are the values of the Link headers, e.g.
+	// "</style.css>; rel=preload; as=style".
+	Links []string
+}
+
+type earlyHintsState struct {
+	w http.ResponseWriter
+}
+
+// EarlyHints is HTTP middleware sending a 103 Early Hints interim response
+// (RFC 8297) with the Link headers of the rules matching the request path,
+// before the wrapped handler runs. Browsers can then preload critical
+// resources or preconnect to origins while the page is being generated.
+//
+// Handlers may send further hints, e.g. depending on the page, with
+// AddEarlyHints. Hints are only sent for GET requests from HTTP/1.1 or later
+// clients, as HTTP/1.0 clients don't support interim responses.
+//
+// Example:
+//
+//	hints := handlers.EarlyHints(handlers.EarlyHintRule{
+//		Path:  "/app/",
+//		Links: []string{"</app.css>; rel=preload; as=style", "<https://cdn.example.com>; rel=preconnect"},
+//	})
+//	http.ListenAndServe(":1123", hints(r))
+func EarlyHints(rules ...EarlyHintRule) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w, r, end := beginRequestEvent("early_hints", w, r)
+			defer end()
+
+			if r.Method != "GET" || !r.ProtoAtLeast(1, 1) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			var links []string
+			for _, rule := range rules {
+				if (CachePolicy{Path: rule.Path}).matchPath(r.URL.Path) {
+					links = append(links, rule.Links...)
+				}
+			}
+			state := &earlyHintsState{w: w}
+			state.send(links)
+
+			r = WithValue(r, state)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// AddEarlyHints sends a 103 Early Hints response with the given Link headers
+// from a handler wrapped by the EarlyHints middleware. It must be called
+// before the response is written, and is a no-op if r isn't served through
+// the middleware.
+func AddEarlyHints(r *http.Request, links ...string) {
+	if s, ok := Value[*earlyHintsState](r); ok {
+		s.send(links)
+	}
+}
+
+// send writes an interim response with the links. The Link headers stay in
+// the header map, so that they are repeated in the final response as
+// RFC 8297 recommends.
+func (s *earlyHintsState) send(links []string) {
+	if len(links) == 0 {
+		return
+	}
+	h := s.w.Header()
+	for _, link := range links {
+		h.Add("Link", link)
+	}
+	s.w.WriteHeader(http.StatusEarlyHints)
+}
@@ -0,0 +1,93 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/http/httptrace"
+	"net/textproto"
+	"strings"
+	"testing"
+)
+
+func TestEarlyHints(t *testing.T) {
+	hints := EarlyHints(
+		EarlyHintRule{Path: "/app/", Links: []string{"</app.css>; rel=preload; as=style"}},
+		EarlyHintRule{Path: "/other", Links: []string{"</other.css>; rel=preload; as=style"}},
+	)
+	s := httptest.NewServer(hints(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		AddEarlyHints(r, "</page.js>; rel=preload; as=script")
+		io.WriteString(w, ok)
+	})))
+	defer s.Close()
+
+	var interim []http.Header
+	trace := &httptrace.ClientTrace{
+		Got1xxResponse: func(code int, header textproto.MIMEHeader) error {
+			if code == http.StatusEarlyHints {
+				interim = append(interim, http.Header(header))
+			}
+			return nil
+		},
+	}
+	req, err := http.NewRequest("GET", s.URL+"/app/page", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	req = req.WithContext(httptrace.WithClientTrace(req.Context(), trace))
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if len(interim) != 2 {
+		t.Fatalf("got %d early hints responses, want 2", len(interim))
+	}
+	if links := interim[0].Values("Link"); len(links) != 1 || links[0] != "</app.css>; rel=preload; as=style" {
+		t.Fatalf("bad links in the first early hints: %q", links)
+	}
+	if links := interim[1].Values("Link"); len(links) != 2 || links[1] != "</page.js>; rel=preload; as=script" {
+		t.Fatalf("bad links in the second early hints: %q", links)
+	}
+	if res.StatusCode != http.StatusOK || len(res.Header.Values("Link")) != 2 {
+		t.Fatalf("bad final response: %d %v", res.StatusCode, res.Header)
+	}
+}
+
+func TestEarlyHintsSkipped(t *testing.T) {
+	hints := EarlyHints(EarlyHintRule{Links: []string{"</app.css>; rel=preload; as=style"}})(okHandler)
+
+	for _, r := range []*http.Request{newRequest("POST", "/"), newRequest("GET", "/")} {
+		if r.Method == "GET" {
+			r.ProtoMajor, r.ProtoMinor = 1, 0
+		}
+		rec := httptest.NewRecorder()
+		hints.ServeHTTP(rec, r)
+		if rec.Code != http.StatusOK || rec.Header().Get("Link") != "" {
+			t.Fatalf("early hints sent for %s HTTP/%d.%d: %d %v", r.Method, r.ProtoMajor, r.ProtoMinor, rec.Code, rec.Header())
+		}
+	}
+}
+
+func TestEarlyHintsLogging(t *testing.T) {
+	var buf bytes.Buffer
+	hints := EarlyHints(EarlyHintRule{Path: "/", Links: []string{"</app.css>; rel=preload; as=style"}})
+	s := httptest.NewServer(LoggingHandler(&buf, hints(okHandler)))
+	defer s.Close()
+
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	s.Close()
+
+	if res.StatusCode != http.StatusOK {
+		t.Fatalf("bad status: %d", res.StatusCode)
+	}
+	if line := buf.String(); !strings.Contains(line, `"GET / HTTP/1.1" 200 `) {
+		t.Fatalf("bad log line: %q", line)
+	}
+}
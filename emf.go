@@ -0,0 +1,161 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"strconv"
+	"time"
+)
+
+// EMFOption represents a functional option for configuring the CloudWatch
+// Embedded Metric Format log formatter.
+type EMFOption func(*emfFormatter) error
+
+type emfDimension struct {
+	name  string
+	value func(LogFormatterParams) string
+}
+
+type emfFormatter struct {
+	namespace  string
+	dimensions []emfDimension
+	properties bool
+}
+
+// Built-in EMF dimensions, usable with EMFDimensions.
+var emfBuiltinDimensions = map[string]func(LogFormatterParams) string{
+	"Method": func(p LogFormatterParams) string { return p.Request.Method },
+	"Host":   func(p LogFormatterParams) string { return p.Request.Host },
+	"StatusCode": func(p LogFormatterParams) string {
+		return strconv.Itoa(p.StatusCode)
+	},
+	"StatusClass": func(p LogFormatterParams) string {
+		return strconv.Itoa(p.StatusCode/100) + "xx"
+	},
+}
+
+// EMFFormatter returns a LogFormatter emitting one CloudWatch Embedded
+// Metric Format (EMF) JSON line per request, for use with
+// CustomLoggingHandler. When written to stdout on Lambda or ECS (with the
+// awslogs driver), CloudWatch extracts the Requests, Latency (milliseconds)
+// and ResponseSize (bytes) metrics from the logs, without running an agent.
+//
+// Metrics are published in namespace with the Method and StatusClass
+// dimensions by default. Each line also carries the request path and ID, its
+// trace ID (see TraceID) as trace_id, and the fields set with SetLogField, as
+// properties, to find the requests and traces behind a metric with Logs
+// Insights.
+//
+// Example:
+//
+//	h := handlers.CustomLoggingHandler(os.Stdout, r, handlers.EMFFormatter("MyService",
+//		handlers.EMFDimensions("Method", "StatusCode"),
+//	))
+//
+// See https://docs.aws.amazon.com/AmazonCloudWatch/latest/monitoring/CloudWatch_Embedded_Metric_Format_Specification.html
+func EMFFormatter(namespace string, opts ...EMFOption) LogFormatter {
+	f := &emfFormatter{namespace: namespace, properties: true}
+	EMFDimensions("Method", "StatusClass")(f)
+	for _, option := range opts {
+		option(f)
+	}
+	return f.format
+}
+
+// EMFDimensions replaces the dimensions of the metrics with built-in ones
+// among "Method", "Host", "StatusCode" and "StatusClass" (e.g. "2xx").
+// Unknown names are ignored.
+func EMFDimensions(names ...string) EMFOption {
+	return func(f *emfFormatter) error {
+		f.dimensions = nil
+		for _, name := range names {
+			if fn, ok := emfBuiltinDimensions[name]; ok {
+				f.dimensions = append(f.dimensions, emfDimension{name: name, value: fn})
+			}
+		}
+		return nil
+	}
+}
+
+// EMFDimension adds a dimension whose value is computed from each request,
+// e.g. the matched route. Beware of high cardinality values, which are
+// billed as separate metrics.
+func EMFDimension(name string, fn func(LogFormatterParams) string) EMFOption {
+	return func(f *emfFormatter) error {
+		f.dimensions = append(f.dimensions, emfDimension{name: name, value: fn})
+		return nil
+	}
+}
+
+// EMFOmitProperties drops the Path, RequestId, trace_id and log field
+// properties from the emitted lines, keeping only dimensions and metrics.
+func EMFOmitProperties() EMFOption {
+	return func(f *emfFormatter) error {
+		f.properties = false
+		return nil
+	}
+}
+
+type emfMetric struct {
+	Name string `json:"Name"`
+	Unit string `json:"Unit"`
+}
+
+type emfDirective struct {
+	Namespace  string      `json:"Namespace"`
+	Dimensions [][]string  `json:"Dimensions"`
+	Metrics    []emfMetric `json:"Metrics"`
+}
+
+type emfMetadata struct {
+	Timestamp         int64          `json:"Timestamp"`
+	CloudWatchMetrics []emfDirective `json:"CloudWatchMetrics"`
+}
+
+var emfMetrics = []emfMetric{
+	{Name: "Requests", Unit: "Count"},
+	{Name: "Latency", Unit: "Milliseconds"},
+	{Name: "ResponseSize", Unit: "Bytes"},
+}
+
+func (f *emfFormatter) format(writer io.Writer, params LogFormatterParams) {
+	names := make([]string, 0, len(f.dimensions))
+	doc := make(map[string]interface{}, len(f.dimensions)+6)
+	for _, d := range f.dimensions {
+		names = append(names, d.name)
+		doc[d.name] = d.value(params)
+	}
+
+	doc["_aws"] = emfMetadata{
+		Timestamp: params.TimeStamp.UnixNano() / int64(time.Millisecond),
+		CloudWatchMetrics: []emfDirective{{
+			Namespace:  f.namespace,
+			Dimensions: [][]string{names},
+			Metrics:    emfMetrics,
+		}},
+	}
+	doc["Requests"] = 1
+	doc["Latency"] = float64(params.Duration) / float64(time.Millisecond)
+	doc["ResponseSize"] = params.Size
+
+	if f.properties {
+		doc["Path"] = params.URL.Path
+		if params.RequestID != "" {
+			doc["RequestId"] = params.RequestID
+		}
+		if id := TraceID(params.Request); id != "" {
+			doc["trace_id"] = id
+		}
+		for k, v := range params.Fields {
+			if _, ok := doc[k]; !ok {
+				doc[k] = v
+			}
+		}
+	}
+
+	b, err := json.Marshal(doc)
+	if err != nil {
+		return
+	}
+	writer.Write(append(b, '\n'))
+}
@@ -0,0 +1,72 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"testing"
+)
+
+func TestEMFFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	handler := CustomLoggingHandler(&buf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNotFound)
+		w.Write([]byte(ok))
+	}), EMFFormatter("MyService", EMFDimension("Route", func(LogFormatterParams) string { return "/users/{id}" })))
+
+	r := newRequest("GET", "http://example.com/users/42")
+	r.Header.Set(RequestIDHeader, "abc")
+	r.Header.Set("Traceparent", "00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01")
+	RequestIDHandler()(handler).ServeHTTP(httptest.NewRecorder(), r)
+
+	var doc struct {
+		AWS struct {
+			Timestamp         int64
+			CloudWatchMetrics []struct {
+				Namespace  string
+				Dimensions [][]string
+				Metrics    []emfMetric
+			}
+		} `json:"_aws"`
+		Method       string
+		StatusClass  string
+		Route        string
+		Requests     int
+		Latency      float64
+		ResponseSize int
+		Path         string
+		RequestID    string `json:"RequestId"`
+		TraceID      string `json:"trace_id"`
+	}
+	if err := json.Unmarshal(buf.Bytes(), &doc); err != nil {
+		t.Fatalf("invalid EMF line %q: %v", buf.String(), err)
+	}
+
+	if len(doc.AWS.CloudWatchMetrics) != 1 {
+		t.Fatalf("bad metrics directive: %+v", doc.AWS)
+	}
+	directive := doc.AWS.CloudWatchMetrics[0]
+	if directive.Namespace != "MyService" {
+		t.Fatalf("bad namespace: %q", directive.Namespace)
+	}
+	if want := [][]string{{"Method", "StatusClass", "Route"}}; !reflect.DeepEqual(directive.Dimensions, want) {
+		t.Fatalf("bad dimensions: got %v want %v", directive.Dimensions, want)
+	}
+	if !reflect.DeepEqual(directive.Metrics, emfMetrics) {
+		t.Fatalf("bad metrics: %v", directive.Metrics)
+	}
+	if doc.AWS.Timestamp == 0 {
+		t.Fatal("missing timestamp")
+	}
+	if doc.Method != "GET" || doc.StatusClass != "4xx" || doc.Route != "/users/{id}" {
+		t.Fatalf("bad dimension values: %+v", doc)
+	}
+	if doc.Requests != 1 || doc.ResponseSize != len(ok) || doc.Latency < 0 {
+		t.Fatalf("bad metric values: %+v", doc)
+	}
+	if doc.Path != "/users/42" || doc.RequestID != "abc" || doc.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("bad properties: %+v", doc)
+	}
+}
@@ -0,0 +1,167 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"log"
+	"net/http"
+	"os"
+)
+
+// HandlerE is a handler returning an error, to be replied to by an
+// ErrorHandler rather than by each handler. HandlerE implements http.Handler
+// with the default ErrorHandler options.
+//
+// Example:
+//
+//	func getUser(w http.ResponseWriter, r *http.Request) error {
+//		user, err := db.User(r.Context(), r.URL.Query().Get("id"))
+//		if err != nil {
+//			return err // ErrNoUser is mapped to 404 with ErrorStatus
+//		}
+//		handlers.JSON(w, r, http.StatusOK, user)
+//		return nil
+//	}
+//
+//	mux.Handle("/user", handlers.ErrorHandler(getUser, handlers.ErrorStatus(ErrNoUser, http.StatusNotFound)))
+type HandlerE func(w http.ResponseWriter, r *http.Request) error
+
+func (h HandlerE) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	ErrorHandler(h).ServeHTTP(w, r)
+}
+
+// HTTPError is an error carrying the status code of the response it should
+// be replied with.
+type HTTPError struct {
+	Status int
+	Err    error
+}
+
+// StatusError returns err annotated with the status code of the response an
+// ErrorHandler replies with.
+func StatusError(status int, err error) error {
+	return &HTTPError{Status: status, Err: err}
+}
+
+func (e *HTTPError) Error() string {
+	if e.Err == nil {
+		return http.StatusText(e.Status)
+	}
+	return e.Err.Error()
+}
+
+func (e *HTTPError) Unwrap() error { return e.Err }
+
+// ErrorHandlerOption represents a functional option for configuring
+// ErrorHandler.
+type ErrorHandlerOption func(*errorHandler) error
+
+type errorHandler struct {
+	h       HandlerE
+	mappers []func(error) int
+	logger  RecoveryHandlerLogger
+}
+
+// ErrorStatus maps the errors matching target, according to errors.Is, to
+// the given status code.
+func ErrorStatus(target error, status int) ErrorHandlerOption {
+	return ErrorMapper(func(err error) int {
+		if errors.Is(err, target) {
+			return status
+		}
+		return 0
+	})
+}
+
+// ErrorMapper adds a function mapping errors to status codes, returning 0 for
+// errors it doesn't know about. Mappers are tried in order, before the
+// default mapping.
+func ErrorMapper(fn func(err error) int) ErrorHandlerOption {
+	return func(e *errorHandler) error {
+		e.mappers = append(e.mappers, fn)
+		return nil
+	}
+}
+
+// ErrorLogger sets the logger of server errors (5xx). It defaults to the
+// standard logger.
+func ErrorLogger(logger RecoveryHandlerLogger) ErrorHandlerOption {
+	return func(e *errorHandler) error {
+		e.logger = logger
+		return nil
+	}
+}
+
+// ErrorHandler adapts h to a http.Handler replying to the errors it returns
+// with RenderError, so the error responses are negotiated, and are RFC 7807
+// problems under ProblemDetails. Server errors are logged with the request
+// ID, like panics by RecoveryHandler.
+//
+// The status code of an error is given by the mappers set with ErrorStatus
+// and ErrorMapper, then by HTTPError, and defaults to 404 for
+// os.ErrNotExist, 403 for os.ErrPermission, 504 for
+// context.DeadlineExceeded and 500 otherwise. Errors returned after the
+// response was started, and those caused by the client going away, are only
+// logged.
+func ErrorHandler(h HandlerE, opts ...ErrorHandlerOption) http.Handler {
+	e := &errorHandler{h: h}
+	for _, option := range opts {
+		option(e)
+	}
+	return e
+}
+
+func (e *errorHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("error_handler", w, r)
+	defer end()
+
+	logger, lw := makeLogger(w)
+	err := e.h(lw, r)
+	if err == nil {
+		return
+	}
+
+	if errors.Is(err, context.Canceled) && r.Context().Err() != nil {
+		return
+	}
+	status := e.status(err)
+	if status >= 500 {
+		if id := requestIDFor(w, r); id != "" {
+			e.log("request_id="+id, err)
+		} else {
+			e.log(err)
+		}
+	}
+	if logger.wroteHeader || logger.Size() > 0 {
+		return
+	}
+	RenderError(w, r, status, err)
+}
+
+func (e *errorHandler) status(err error) int {
+	for _, mapper := range e.mappers {
+		if status := mapper(err); status != 0 {
+			return status
+		}
+	}
+	var httpErr *HTTPError
+	switch {
+	case errors.As(err, &httpErr):
+		return httpErr.Status
+	case errors.Is(err, os.ErrNotExist):
+		return http.StatusNotFound
+	case errors.Is(err, os.ErrPermission):
+		return http.StatusForbidden
+	case errors.Is(err, context.DeadlineExceeded):
+		return http.StatusGatewayTimeout
+	}
+	return http.StatusInternalServerError
+}
+
+func (e *errorHandler) log(v ...interface{}) {
+	if e.logger != nil {
+		e.logger.Println(v...)
+	} else {
+		log.Println(v...)
+	}
+}
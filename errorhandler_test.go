@@ -0,0 +1,80 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+)
+
+type recordingLogger struct {
+	lines []string
+}
+
+func (l *recordingLogger) Println(v ...interface{}) {
+	l.lines = append(l.lines, fmt.Sprintln(v...))
+}
+
+func TestErrorHandler(t *testing.T) {
+	errNoUser := errors.New("no such user")
+	tests := []struct {
+		err    error
+		status int
+		logged bool
+	}{
+		{nil, http.StatusOK, false},
+		{errNoUser, http.StatusNotFound, false},
+		{fmt.Errorf("lookup: %w", errNoUser), http.StatusNotFound, false},
+		{StatusError(http.StatusConflict, errors.New("version mismatch")), http.StatusConflict, false},
+		{fmt.Errorf("open: %w", os.ErrNotExist), http.StatusNotFound, false},
+		{context.DeadlineExceeded, http.StatusGatewayTimeout, true},
+		{errors.New("database down"), http.StatusInternalServerError, true},
+	}
+	for _, test := range tests {
+		logger := &recordingLogger{}
+		handler := ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+			return test.err
+		}, ErrorStatus(errNoUser, http.StatusNotFound), ErrorLogger(logger))
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", "/"))
+		if rec.Code != test.status {
+			t.Errorf("%v: wrong status, got %d want %d", test.err, rec.Code, test.status)
+		}
+		if logged := len(logger.lines) > 0; logged != test.logged {
+			t.Errorf("%v: logged %v want %v", test.err, logged, test.logged)
+		}
+		if test.err != nil && test.status < 500 && !strings.Contains(rec.Body.String(), test.err.Error()) {
+			t.Errorf("%v: message missing from body %q", test.err, rec.Body.String())
+		}
+	}
+}
+
+func TestErrorHandlerStarted(t *testing.T) {
+	logger := &recordingLogger{}
+	handler := ErrorHandler(func(w http.ResponseWriter, r *http.Request) error {
+		w.Write([]byte("partial"))
+		return errors.New("stream broken")
+	}, ErrorLogger(logger))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusOK || rec.Body.String() != "partial" || len(logger.lines) != 1 {
+		t.Fatalf("got %d %q, %d log lines", rec.Code, rec.Body.String(), len(logger.lines))
+	}
+}
+
+func TestHandlerEProblem(t *testing.T) {
+	handler := ProblemDetails()(HandlerE(func(w http.ResponseWriter, r *http.Request) error {
+		return StatusError(http.StatusBadRequest, errors.New("missing id"))
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if p := decodeProblem(t, rec); p.Status != http.StatusBadRequest || p.Detail != "missing id" {
+		t.Fatalf("wrong problem: %+v", p)
+	}
+}
@@ -0,0 +1,365 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash"
+	"io"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+)
+
+const (
+	etagHeader         = "ETag"
+	defaultETagMaxSize = 1 << 20
+	etagHashSize       = 16
+)
+
+// ETagOption represents a functional option for configuring the ETag
+// middleware.
+type ETagOption func(*etag) error
+
+type etag struct {
+	h              http.Handler
+	weak           bool
+	maxSize        int
+	hash           func() hash.Hash
+	contentTypes   []string
+	streamingTypes []string
+	pathPrefixes   []string
+}
+
+// defaultETagStreamingTypes are the media types of the responses ETag streams
+// without buffering by default.
+var defaultETagStreamingTypes = []string{"text/event-stream", "application/x-ndjson"}
+
+// etagState is stored in the request context so handlers can opt out of ETag
+// generation with SkipETag.
+type etagState struct {
+	skip bool
+}
+
+// ETag is HTTP middleware generating ETag headers for successful GET
+// responses, from a hash of their body, so that conditional caching works
+// without per-handler code. Responses are buffered up to a maximum size (1MiB
+// by default); larger responses, responses flushed by the handler, responses
+// of streaming media types such as text/event-stream, and responses which
+// already have an ETag are passed through untouched.
+//
+// Requests whose If-None-Match header matches the ETag, generated or set by
+// the handler, or whose If-Modified-Since header is no earlier than the
+// Last-Modified header of the response, are answered with 304 Not Modified
+// and the buffered body is discarded. ConditionalRequests additionally
+// handles If-Match and If-Unmodified-Since, and requests of other methods.
+//
+// Example:
+//
+//	etag := handlers.ETag(
+//		handlers.ETagContentTypes([]string{"application/json", "text/html"}),
+//		handlers.ETagPathPrefixes([]string{"/api/"}),
+//	)
+//	http.ListenAndServe(":1123", etag(r))
+func ETag(opts ...ETagOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		e := newETag()
+		e.h = h
+		for _, option := range opts {
+			option(e)
+		}
+		return e
+	}
+}
+
+// NewETag is like ETag, but returns an error if an option is invalid.
+func NewETag(opts ...ETagOption) (func(http.Handler) http.Handler, error) {
+	e := newETag()
+	for _, option := range opts {
+		if err := option(e); err != nil {
+			return nil, err
+		}
+	}
+	return ETag(opts...), nil
+}
+
+func newETag() *etag {
+	return &etag{
+		maxSize:        defaultETagMaxSize,
+		hash:           sha256.New,
+		streamingTypes: defaultETagStreamingTypes,
+	}
+}
+
+// ETagWeak makes the middleware generate weak validators (W/"..."), for
+// responses which are semantically but not byte-for-byte equivalent, e.g.
+// because an outer middleware compresses them.
+func ETagWeak() ETagOption {
+	return func(e *etag) error {
+		e.weak = true
+		return nil
+	}
+}
+
+// ETagMaxSize sets the maximum size of the responses buffered to compute an
+// ETag. Larger responses are streamed without ETag.
+func ETagMaxSize(n int) ETagOption {
+	return func(e *etag) error {
+		e.maxSize = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid ETag max size %d", n)
+		}
+		return nil
+	}
+}
+
+// ETagContentTypes restricts ETag generation to responses of the given media
+// types. By default all responses are considered.
+func ETagContentTypes(types []string) ETagOption {
+	return func(e *etag) error {
+		for _, t := range types {
+			e.contentTypes = append(e.contentTypes, strings.ToLower(strings.TrimSpace(t)))
+		}
+		return nil
+	}
+}
+
+// ETagHash sets the hash function computing ETags from response bodies,
+// SHA-256 by default. Any hash.Hash will do, e.g. the faster, non
+// cryptographic fnv.New128a; ETags only have to change with the body, and
+// hashes longer than 128 bits are truncated.
+func ETagHash(fn func() hash.Hash) ETagOption {
+	return func(e *etag) error {
+		if fn == nil {
+			return errors.New("handlers: nil ETag hash function")
+		}
+		e.hash = fn
+		return nil
+	}
+}
+
+// ETagStreamingTypes sets the media types of the responses which are streamed
+// to the client as they are written, without buffering nor ETag,
+// text/event-stream and application/x-ndjson by default. Patterns such as
+// "video/*" are allowed. The Content-Type header must be set before the
+// response is written.
+func ETagStreamingTypes(types []string) ETagOption {
+	return func(e *etag) error {
+		e.streamingTypes = lowerPatterns(types)
+		return validMediaTypePatterns(types)
+	}
+}
+
+// ETagPathPrefixes restricts ETag generation to requests whose path starts
+// with one of the given prefixes. By default all paths are considered.
+func ETagPathPrefixes(prefixes []string) ETagOption {
+	return func(e *etag) error {
+		e.pathPrefixes = append(e.pathPrefixes, prefixes...)
+		return nil
+	}
+}
+
+// SkipETag disables ETag generation for the response to r, e.g. for
+// responses that embed per-request data such as CSRF tokens. It has no effect
+// if r isn't served through the ETag middleware.
+func SkipETag(r *http.Request) {
+	if s, ok := Value[*etagState](r); ok {
+		s.skip = true
+	}
+}
+
+func (e *etag) matchPath(path string) bool {
+	if len(e.pathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range e.pathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *etag) matchContentType(ct string) bool {
+	if len(e.contentTypes) == 0 {
+		return true
+	}
+	if i := strings.IndexByte(ct, ';'); i != -1 {
+		ct = ct[:i]
+	}
+	ct = strings.ToLower(strings.TrimSpace(ct))
+	for _, t := range e.contentTypes {
+		if t == ct {
+			return true
+		}
+	}
+	return false
+}
+
+func (e *etag) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("etag", w, r)
+	defer end()
+
+	if r.Method != "GET" || isStreamingRequest(r) || !e.matchPath(r.URL.Path) {
+		e.h.ServeHTTP(w, r)
+		return
+	}
+
+	state := &etagState{}
+	r = WithValue(r, state)
+
+	bw := &bufferedResponseWriter{w: w, max: e.maxSize, bypass: e.isStreaming}
+	e.h.ServeHTTP(bw.wrap(), r)
+
+	if bw.passthrough {
+		return
+	}
+
+	h := w.Header()
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	if h.Get("Content-Type") == "" && bw.buf.Len() > 0 {
+		h.Set("Content-Type", http.DetectContentType(bw.buf.Bytes()))
+	}
+	if bw.status == http.StatusOK && !state.skip && h.Get(etagHeader) == "" && e.matchContentType(h.Get("Content-Type")) {
+		h.Set(etagHeader, hashETag(e.hash, bw.buf.Bytes(), e.weak))
+	}
+	if bw.status == http.StatusOK && !state.skip && e.notModified(r, h) {
+		writeNotModified(w)
+		return
+	}
+	bw.flush()
+}
+
+// notModified reports whether the response with headers h can be answered
+// with 304 Not Modified.
+func (e *etag) notModified(r *http.Request, h http.Header) bool {
+	var lastModified time.Time
+	if lm := h.Get("Last-Modified"); lm != "" {
+		lastModified, _ = http.ParseTime(lm)
+	}
+	if r.Header.Get("If-Match") != "" || r.Header.Get("If-Unmodified-Since") != "" {
+		// Left to ConditionalRequests.
+		return false
+	}
+	return evaluateConditions(r, h.Get(etagHeader), lastModified, true) == http.StatusNotModified
+}
+
+func (e *etag) isStreaming(h http.Header) bool {
+	mt := h.Get("Content-Type")
+	if i := strings.IndexByte(mt, ';'); i != -1 {
+		mt = mt[:i]
+	}
+	mt = strings.ToLower(strings.TrimSpace(mt))
+	return mt != "" && matchMediaTypePattern(e.streamingTypes, mt)
+}
+
+// computeETag returns an entity tag for body.
+func computeETag(body []byte, weak bool) string {
+	return hashETag(sha256.New, body, weak)
+}
+
+// hashETag returns an entity tag for body, hashed with newHash.
+func hashETag(newHash func() hash.Hash, body []byte, weak bool) string {
+	hh := newHash()
+	hh.Write(body)
+	sum := hh.Sum(nil)
+	if len(sum) > etagHashSize {
+		sum = sum[:etagHashSize]
+	}
+	tag := `"` + base64.RawURLEncoding.EncodeToString(sum) + `"`
+	if weak {
+		return "W/" + tag
+	}
+	return tag
+}
+
+// bufferedResponseWriter holds back a response until the handler returns, so
+// that headers can still be changed based on its body. It switches to
+// pass-through mode when the response exceeds max bytes or is flushed, or
+// from the start if bypass reports so for its headers.
+type bufferedResponseWriter struct {
+	w           http.ResponseWriter
+	max         int
+	bypass      func(http.Header) bool
+	status      int
+	buf         bytes.Buffer
+	passthrough bool
+}
+
+func (bw *bufferedResponseWriter) wrap() http.ResponseWriter {
+	return httpsnoop.Wrap(bw.w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return bw.WriteHeader
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return bw.Write
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				return io.Copy(writerFunc(bw.Write), src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				bw.flush()
+				next()
+			}
+		},
+	})
+}
+
+func (bw *bufferedResponseWriter) WriteHeader(code int) {
+	if bw.passthrough {
+		bw.w.WriteHeader(code)
+		return
+	}
+	if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+		// Interim responses are sent right away.
+		bw.w.WriteHeader(code)
+		return
+	}
+	if bw.status == 0 {
+		bw.status = code
+		if bw.bypass != nil && bw.bypass(bw.w.Header()) {
+			bw.flush()
+		}
+	}
+}
+
+func (bw *bufferedResponseWriter) Write(b []byte) (int, error) {
+	if bw.passthrough {
+		return bw.w.Write(b)
+	}
+	if bw.status == 0 {
+		bw.WriteHeader(http.StatusOK)
+		if bw.passthrough {
+			return bw.w.Write(b)
+		}
+	}
+	if bw.buf.Len()+len(b) > bw.max {
+		bw.flush()
+		return bw.w.Write(b)
+	}
+	return bw.buf.Write(b)
+}
+
+// flush sends the buffered response and switches to pass-through mode.
+func (bw *bufferedResponseWriter) flush() {
+	if bw.passthrough {
+		return
+	}
+	bw.passthrough = true
+	if bw.status != 0 {
+		bw.w.WriteHeader(bw.status)
+	}
+	if bw.buf.Len() > 0 {
+		bw.w.Write(bw.buf.Bytes())
+	}
+	bw.buf = bytes.Buffer{}
+}
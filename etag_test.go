@@ -0,0 +1,240 @@
+package handlers
+
+import (
+	"encoding/base64"
+	"hash/fnv"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestETag(t *testing.T) {
+	body := `{"hello":"world"}`
+	jsonHandler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		io.WriteString(w, body)
+	})
+
+	rec := httptest.NewRecorder()
+	ETag()(jsonHandler).ServeHTTP(rec, newRequest("GET", "/"))
+
+	tag := rec.Header().Get(etagHeader)
+	if tag == "" || !strings.HasPrefix(tag, `"`) {
+		t.Fatalf("bad ETag: %q", tag)
+	}
+	if rec.Body.String() != body || rec.Code != http.StatusOK {
+		t.Fatalf("bad response: %d %q", rec.Code, rec.Body.String())
+	}
+
+	// The same body always yields the same ETag.
+	rec = httptest.NewRecorder()
+	ETag()(jsonHandler).ServeHTTP(rec, newRequest("GET", "/other"))
+	if got := rec.Header().Get(etagHeader); got != tag {
+		t.Fatalf("unstable ETag: got %q want %q", got, tag)
+	}
+
+	rec = httptest.NewRecorder()
+	ETag(ETagWeak())(jsonHandler).ServeHTTP(rec, newRequest("GET", "/"))
+	if got := rec.Header().Get(etagHeader); got != "W/"+tag {
+		t.Fatalf("bad weak ETag: got %q want %q", got, "W/"+tag)
+	}
+}
+
+func TestETagSkipped(t *testing.T) {
+	tests := []struct {
+		name    string
+		opts    []ETagOption
+		method  string
+		path    string
+		handler http.HandlerFunc
+	}{
+		{"post", nil, "POST", "/", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, ok) }},
+		{"error status", nil, "GET", "/", func(w http.ResponseWriter, r *http.Request) {
+			w.WriteHeader(http.StatusNotFound)
+			io.WriteString(w, ok)
+		}},
+		{"opt-out", nil, "GET", "/", func(w http.ResponseWriter, r *http.Request) {
+			SkipETag(r)
+			io.WriteString(w, ok)
+		}},
+		{"too large", []ETagOption{ETagMaxSize(2)}, "GET", "/", func(w http.ResponseWriter, r *http.Request) { io.WriteString(w, ok) }},
+		{"flushed", nil, "GET", "/", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, ok)
+			w.(http.Flusher).Flush()
+		}},
+		{"content type", []ETagOption{ETagContentTypes([]string{"application/json"})}, "GET", "/", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, ok)
+		}},
+		{"path", []ETagOption{ETagPathPrefixes([]string{"/api/"})}, "GET", "/static/", func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, ok)
+		}},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			ETag(test.opts...)(test.handler).ServeHTTP(rec, newRequest(test.method, test.path))
+
+			if got := rec.Header().Get(etagHeader); got != "" {
+				t.Fatalf("unexpected ETag %q", got)
+			}
+			if rec.Body.String() != ok {
+				t.Fatalf("bad body: got %q want %q", rec.Body.String(), ok)
+			}
+		})
+	}
+}
+
+func TestETagKeepsHandlerETag(t *testing.T) {
+	rec := httptest.NewRecorder()
+	ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etagHeader, `"v1"`)
+		io.WriteString(w, ok)
+	})).ServeHTTP(rec, newRequest("GET", "/"))
+
+	if got := rec.Header().Get(etagHeader); got != `"v1"` {
+		t.Fatalf("bad ETag: got %q want %q", got, `"v1"`)
+	}
+}
+
+func TestETagUpgrade(t *testing.T) {
+	handler := ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusSwitchingProtocols)
+	}))
+	r := newRequest("GET", "/")
+	r.Header.Set("Connection", "Upgrade")
+	r.Header.Set("Upgrade", "websocket")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusSwitchingProtocols || rec.Header().Get(etagHeader) != "" {
+		t.Fatalf("upgrade response buffered: %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestNewETag(t *testing.T) {
+	if _, err := NewETag(ETagWeak(), ETagMaxSize(1024)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewETag(ETagMaxSize(0)); err == nil {
+		t.Fatal("expected an error for a zero max size")
+	}
+}
+
+func TestETagNotModified(t *testing.T) {
+	lastModified := time.Date(2024, 5, 26, 3, 30, 45, 0, time.UTC)
+	calls := 0
+	handler := ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		w.Header().Set("Content-Type", "application/json")
+		w.Header().Set("Last-Modified", lastModified.Format(http.TimeFormat))
+		io.WriteString(w, `{"hello":"world"}`)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	tag := rec.Header().Get(etagHeader)
+
+	tests := []struct {
+		name   string
+		header string
+		value  string
+		code   int
+	}{
+		{"matching etag", "If-None-Match", tag, http.StatusNotModified},
+		{"weak match", "If-None-Match", `"other", W/` + tag, http.StatusNotModified},
+		{"any", "If-None-Match", "*", http.StatusNotModified},
+		{"other etag", "If-None-Match", `"other"`, http.StatusOK},
+		{"not modified since", "If-Modified-Since", lastModified.Format(http.TimeFormat), http.StatusNotModified},
+		{"modified since", "If-Modified-Since", lastModified.Add(-time.Hour).Format(http.TimeFormat), http.StatusOK},
+		{"if-match", "If-Match", `"other"`, http.StatusOK},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRequest("GET", "/")
+			r.Header.Set(test.header, test.value)
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if rec.Code != test.code {
+				t.Fatalf("bad status: got %d want %d", rec.Code, test.code)
+			}
+			if test.code != http.StatusNotModified {
+				return
+			}
+			if rec.Body.Len() != 0 || rec.Header().Get("Content-Type") != "" {
+				t.Fatalf("304 with representation: %v %q", rec.Header(), rec.Body.String())
+			}
+			if got := rec.Header().Get(etagHeader); got != tag {
+				t.Fatalf("bad ETag: got %q want %q", got, tag)
+			}
+		})
+	}
+
+	// The handler's own ETag is honored too.
+	r := newRequest("GET", "/")
+	r.Header.Set("If-None-Match", `"v1"`)
+	rec = httptest.NewRecorder()
+	ETag()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set(etagHeader, `"v1"`)
+		io.WriteString(w, ok)
+	})).ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotModified || rec.Body.Len() != 0 {
+		t.Fatalf("bad response: %d %q", rec.Code, rec.Body.String())
+	}
+}
+
+func TestETagHash(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, ok)
+	})
+
+	rec := httptest.NewRecorder()
+	ETag(ETagHash(fnv.New128a))(handler).ServeHTTP(rec, newRequest("GET", "/"))
+	sum := fnv.New128a()
+	io.WriteString(sum, ok)
+	want := `"` + base64.RawURLEncoding.EncodeToString(sum.Sum(nil)) + `"`
+	if got := rec.Header().Get(etagHeader); got != want {
+		t.Fatalf("bad ETag: got %q want %q", got, want)
+	}
+
+	if _, err := NewETag(ETagHash(nil)); err == nil {
+		t.Fatal("expected an error for a nil hash function")
+	}
+}
+
+func TestETagStreamingTypes(t *testing.T) {
+	tests := []struct {
+		name        string
+		opts        []ETagOption
+		contentType string
+	}{
+		{"event stream", nil, "text/event-stream"},
+		{"ndjson", nil, "application/x-ndjson; charset=utf-8"},
+		{"pattern", []ETagOption{ETagStreamingTypes([]string{"video/*"})}, "video/mp4"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			var sent string
+			ETag(test.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				w.Header().Set("Content-Type", test.contentType)
+				io.WriteString(w, ok)
+				sent = rec.Body.String()
+			})).ServeHTTP(rec, newRequest("GET", "/"))
+
+			if sent != ok {
+				t.Fatalf("response buffered: sent %q", sent)
+			}
+			if got := rec.Header().Get(etagHeader); got != "" {
+				t.Fatalf("unexpected ETag %q", got)
+			}
+		})
+	}
+
+	if _, err := NewETag(ETagStreamingTypes([]string{"video"})); err == nil {
+		t.Fatal("expected an error for an invalid media type pattern")
+	}
+}
@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// RequestEvent describes a request served through the middlewares of this
+// package. It is delivered to the functions registered with OnRequestStart
+// and OnRequestEnd.
+type RequestEvent struct {
+	// Request is the request being served.
+	Request *http.Request
+	// Middleware is the name of the outermost middleware of this package
+	// the request went through, e.g. "logging" or "cors".
+	Middleware string
+	// Start is the time the request entered the middleware.
+	Start time.Time
+
+	// The following fields are only set on end events.
+
+	// Duration is the time spent serving the request.
+	Duration time.Duration
+	// StatusCode is the HTTP status code of the response.
+	StatusCode int
+	// BytesRead is the number of bytes read from the request body.
+	BytesRead int64
+	// BytesWritten is the number of bytes written in the response body.
+	BytesWritten int64
+}
+
+type eventSubscriber struct {
+	fn func(RequestEvent)
+}
+
+var (
+	eventsMu          sync.Mutex
+	startSubscribers  atomic.Value // []*eventSubscriber
+	endSubscribers    atomic.Value // []*eventSubscriber
+	eventsSubscribers int32
+)
+
+// OnRequestStart registers fn to be called when a request enters the
+// middlewares of this package, and returns a function unregistering it.
+//
+// Each request is published once, by the outermost middleware of this
+// package, however many of them it goes through. fn is called synchronously
+// and must be safe for concurrent use.
+func OnRequestStart(fn func(RequestEvent)) (remove func()) {
+	return subscribe(&startSubscribers, fn)
+}
+
+// OnRequestEnd registers fn to be called when a request has been served by
+// the middlewares of this package, and returns a function unregistering it.
+// End events carry the status code, duration and sizes of the exchange.
+//
+// Example:
+//
+//	handlers.OnRequestEnd(func(e handlers.RequestEvent) {
+//		latency.WithLabelValues(e.Request.Method, strconv.Itoa(e.StatusCode)).
+//			Observe(e.Duration.Seconds())
+//	})
+func OnRequestEnd(fn func(RequestEvent)) (remove func()) {
+	return subscribe(&endSubscribers, fn)
+}
+
+func subscribe(subscribers *atomic.Value, fn func(RequestEvent)) func() {
+	s := &eventSubscriber{fn: fn}
+
+	eventsMu.Lock()
+	current, _ := subscribers.Load().([]*eventSubscriber)
+	subscribers.Store(append(current[:len(current):len(current)], s))
+	atomic.AddInt32(&eventsSubscribers, 1)
+	eventsMu.Unlock()
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			eventsMu.Lock()
+			defer eventsMu.Unlock()
+			current, _ := subscribers.Load().([]*eventSubscriber)
+			next := make([]*eventSubscriber, 0, len(current))
+			for _, v := range current {
+				if v != s {
+					next = append(next, v)
+				}
+			}
+			subscribers.Store(next)
+			atomic.AddInt32(&eventsSubscribers, -1)
+		})
+	}
+}
+
+func publish(subscribers *atomic.Value, e RequestEvent) {
+	current, _ := subscribers.Load().([]*eventSubscriber)
+	for _, s := range current {
+		s.fn(e)
+	}
+}
+
+func noopEventEnd() {}
+
+// beginRequestEvent publishes the start event of a request entering the
+// middleware called name, unless an outer middleware of this package already
+// did. It returns the response writer and request the middleware should use
+// from then on, and a function publishing the end event, to be deferred.
+//
+// It is a no-op when there are no subscribers.
+func beginRequestEvent(name string, w http.ResponseWriter, r *http.Request) (http.ResponseWriter, *http.Request, func()) {
+	if atomic.LoadInt32(&eventsSubscribers) == 0 || r.Context().Value(requestEventKey) != nil {
+		return w, r, noopEventEnd
+	}
+
+	e := RequestEvent{Middleware: name, Start: time.Now()}
+	r = r.WithContext(context.WithValue(r.Context(), requestEventKey, true))
+	e.Request = r
+
+	var body *countingReadCloser
+	if r.Body != nil && r.Body != http.NoBody {
+		body = &countingReadCloser{ReadCloser: r.Body}
+		r.Body = body
+	}
+	logger, w := makeLogger(w)
+
+	publish(&startSubscribers, e)
+
+	return w, r, func() {
+		e.Duration = time.Since(e.Start)
+		e.StatusCode = logger.Status()
+		e.BytesWritten = int64(logger.Size())
+		if body != nil {
+			e.BytesRead = body.n
+		}
+		publish(&endSubscribers, e)
+	}
+}
+
+// countingReadCloser counts the bytes read from a request body.
+type countingReadCloser struct {
+	io.ReadCloser
+	n int64
+}
+
+func (c *countingReadCloser) Read(p []byte) (int, error) {
+	n, err := c.ReadCloser.Read(p)
+	c.n += int64(n)
+	return n, err
+}
@@ -0,0 +1,97 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRequestEvents(t *testing.T) {
+	var starts, ends []RequestEvent
+	removeStart := OnRequestStart(func(e RequestEvent) { starts = append(starts, e) })
+	removeEnd := OnRequestEnd(func(e RequestEvent) { ends = append(ends, e) })
+
+	handler := LoggingHandler(ioutil.Discard, CORS()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte(ok))
+	})))
+
+	r := httptest.NewRequest("POST", "/", strings.NewReader("hello"))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(starts) != 1 || len(ends) != 1 {
+		t.Fatalf("bad number of events: got %d start and %d end, want 1 each", len(starts), len(ends))
+	}
+	e := ends[0]
+	if e.Middleware != "logging" {
+		t.Fatalf("bad middleware: got %q want %q", e.Middleware, "logging")
+	}
+	if e.StatusCode != http.StatusCreated || e.BytesWritten != int64(len(ok)) || e.BytesRead != 5 {
+		t.Fatalf("bad end event: %+v", e)
+	}
+	if e.Duration <= 0 || !e.Start.Equal(starts[0].Start) {
+		t.Fatalf("bad timing: %+v", e)
+	}
+
+	removeStart()
+	removeEnd()
+	removeEnd() // removing twice is harmless
+
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+	if len(starts) != 1 || len(ends) != 1 {
+		t.Fatal("events published after unsubscribing")
+	}
+}
+
+func TestRequestEventsRecovery(t *testing.T) {
+	var status int
+	defer OnRequestEnd(func(e RequestEvent) { status = e.StatusCode })()
+
+	handler := RecoveryHandler(RecoveryLogger(testLogger{}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("Unexpected error!")
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+
+	if status != http.StatusInternalServerError {
+		t.Fatalf("bad status: got %d want %d", status, http.StatusInternalServerError)
+	}
+}
+
+type testLogger struct{}
+
+func (testLogger) Println(...interface{}) {}
+
+func TestRequestEventsMiddlewares(t *testing.T) {
+	var ends []RequestEvent
+	defer OnRequestEnd(func(e RequestEvent) { ends = append(ends, e) })()
+
+	tests := []struct {
+		middleware string
+		handler    http.Handler
+		status     int
+	}{
+		{"rate_limit", RateLimit(1, time.Minute)(okHandler), http.StatusTooManyRequests},
+		{"timeout", Timeout(time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})), http.StatusServiceUnavailable},
+		{"secure_headers", SecureHeaders()(okHandler), http.StatusOK},
+		{"instrument", Instrument(&testCollector{})(okHandler), http.StatusOK},
+	}
+	for _, test := range tests {
+		ends = nil
+		// The first request of the rate limited client is let through.
+		for i := 0; i < 2; i++ {
+			test.handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "/", nil))
+		}
+		if len(ends) != 2 {
+			t.Fatalf("%s: bad number of events: %d", test.middleware, len(ends))
+		}
+		if e := ends[1]; e.Middleware != test.middleware || e.StatusCode != test.status {
+			t.Fatalf("%s: bad end event: %+v", test.middleware, e)
+		}
+	}
+}
@@ -0,0 +1,107 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+	"time"
+)
+
+const traceparentHeader = "Traceparent"
+
+// Exemplar links a metric observation, such as a request latency recorded in
+// a histogram, to the trace of the request which produced it, so that slow
+// buckets can be clicked through to traces in tools supporting OpenMetrics
+// exemplars.
+type Exemplar struct {
+	Labels    map[string]string
+	Value     float64
+	Timestamp time.Time
+}
+
+// String formats the exemplar as in the OpenMetrics text format, e.g.
+//
+//	# {trace_id="4bf92f3577b34da6a3ce929d0e0e4736"} 0.27 1700000000.123
+func (e Exemplar) String() string {
+	names := make([]string, 0, len(e.Labels))
+	for name := range e.Labels {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+
+	var b strings.Builder
+	b.WriteString("# {")
+	for i, name := range names {
+		if i > 0 {
+			b.WriteByte(',')
+		}
+		b.WriteString(name)
+		b.WriteString("=")
+		b.WriteString(strconv.Quote(e.Labels[name]))
+	}
+	b.WriteString("} ")
+	b.WriteString(strconv.FormatFloat(e.Value, 'g', -1, 64))
+	if !e.Timestamp.IsZero() {
+		b.WriteByte(' ')
+		b.WriteString(strconv.FormatFloat(float64(e.Timestamp.UnixNano())/1e9, 'f', 3, 64))
+	}
+	return b.String()
+}
+
+// WithTraceID returns a shallow copy of r whose context carries the given
+// trace ID. Tracing middlewares call it so that the metrics recorded by this
+// package are linked to their traces.
+func WithTraceID(r *http.Request, traceID string) *http.Request {
+	return r.WithContext(context.WithValue(r.Context(), traceIDKey, traceID))
+}
+
+// TraceID returns the ID of the trace the request belongs to: the one set
+// with WithTraceID if any, otherwise the trace ID of its W3C Trace Context
+// traceparent header. It returns an empty string if the request isn't traced.
+func TraceID(r *http.Request) string {
+	if id := TraceIDFromContext(r.Context()); id != "" {
+		return id
+	}
+	return parseTraceparent(r.Header.Get(traceparentHeader))
+}
+
+// RequestExemplar returns an exemplar for an observation of value made while
+// serving r, labeled with the request's trace ID. The boolean is false if the
+// request isn't traced.
+func RequestExemplar(r *http.Request, value float64) (Exemplar, bool) {
+	id := TraceID(r)
+	if id == "" {
+		return Exemplar{}, false
+	}
+	return Exemplar{
+		Labels:    map[string]string{"trace_id": id},
+		Value:     value,
+		Timestamp: time.Now(),
+	}, true
+}
+
+// parseTraceparent returns the trace ID of a traceparent header value, of the
+// form "00-<32 hex trace ID>-<16 hex parent ID>-<2 hex flags>".
+func parseTraceparent(v string) string {
+	parts := strings.Split(strings.TrimSpace(v), "-")
+	if len(parts) < 4 || len(parts[0]) != 2 || parts[0] == "ff" || len(parts[1]) != 32 {
+		return ""
+	}
+	id := parts[1]
+	allZero := true
+	for i := 0; i < len(id); i++ {
+		c := id[i]
+		if !('0' <= c && c <= '9' || 'a' <= c && c <= 'f') {
+			return ""
+		}
+		if c != '0' {
+			allZero = false
+		}
+	}
+	if allZero {
+		return ""
+	}
+	return id
+}
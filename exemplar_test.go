@@ -0,0 +1,50 @@
+package handlers
+
+import (
+	"testing"
+	"time"
+)
+
+func TestTraceID(t *testing.T) {
+	tests := []struct {
+		traceparent string
+		want        string
+	}{
+		{"00-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", "4bf92f3577b34da6a3ce929d0e0e4736"},
+		{"", ""},
+		{"00-00000000000000000000000000000000-00f067aa0ba902b7-01", ""},
+		{"00-4BF92F3577B34DA6A3CE929D0E0E4736-00f067aa0ba902b7-01", ""},
+		{"ff-4bf92f3577b34da6a3ce929d0e0e4736-00f067aa0ba902b7-01", ""},
+		{"garbage", ""},
+	}
+
+	for _, test := range tests {
+		r := newRequest("GET", "/")
+		r.Header.Set("traceparent", test.traceparent)
+		if got := TraceID(r); got != test.want {
+			t.Errorf("%q: got %q want %q", test.traceparent, got, test.want)
+		}
+	}
+
+	r := WithTraceID(newRequest("GET", "/"), "custom")
+	if got := TraceID(r); got != "custom" {
+		t.Fatalf("bad trace ID from context: got %q want %q", got, "custom")
+	}
+}
+
+func TestRequestExemplar(t *testing.T) {
+	if _, ok := RequestExemplar(newRequest("GET", "/"), 1); ok {
+		t.Fatal("expected no exemplar for an untraced request")
+	}
+
+	r := WithTraceID(newRequest("GET", "/"), "abc")
+	e, ok := RequestExemplar(r, 0.25)
+	if !ok || e.Labels["trace_id"] != "abc" || e.Value != 0.25 {
+		t.Fatalf("bad exemplar: %+v", e)
+	}
+
+	e.Timestamp = time.Unix(1700000000, 123000000)
+	if got, want := e.String(), `# {trace_id="abc"} 0.25 1700000000.123`; got != want {
+		t.Fatalf("bad exemplar format: got %q want %q", got, want)
+	}
+}
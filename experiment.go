@@ -0,0 +1,262 @@
+package handlers
+
+import (
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/base64"
+	"errors"
+	"fmt"
+	"hash/fnv"
+	"math/rand"
+	"net/http"
+	"strings"
+	"time"
+)
+
+const defaultExperimentCookieMaxAge = 30 * 24 * time.Hour
+
+// ExperimentOption represents a functional option for configuring the
+// Experiment middleware.
+type ExperimentOption func(*experiment) error
+
+type experiment struct {
+	h            http.Handler
+	name         string
+	variants     []string
+	weights      []int
+	total        int
+	key          func(*http.Request) string
+	signingKey   []byte
+	cookieName   string
+	cookieMaxAge time.Duration
+}
+
+// experimentAssignments maps the experiments a request takes part in to its
+// variants, and is stored in the request context by Experiment.
+type experimentAssignments map[string]string
+
+// ExperimentWeights sets the relative weights of the variants, in order. By
+// default all variants are equally likely.
+func ExperimentWeights(weights ...int) ExperimentOption {
+	return func(e *experiment) error {
+		e.weights = weights
+		for _, w := range weights {
+			if w < 0 {
+				return fmt.Errorf("handlers: invalid experiment weight %d", w)
+			}
+		}
+		return nil
+	}
+}
+
+// ExperimentKey sets the function identifying the subject of a request, e.g.
+// a user ID or session cookie, which is hashed to pick its variant. It
+// defaults to the client IP address. Requests with an empty key are assigned
+// at random.
+func ExperimentKey(fn func(r *http.Request) string) ExperimentOption {
+	return func(e *experiment) error {
+		e.key = fn
+		return nil
+	}
+}
+
+// ExperimentCookie persists assignments in a cookie signed with key (HMAC
+// SHA-256), so that clients keep their variant when the key function or the
+// weights change. The cookie is named "exp_" followed by the experiment name.
+func ExperimentCookie(key []byte) ExperimentOption {
+	return func(e *experiment) error {
+		e.signingKey = key
+		if len(key) < 16 {
+			return errors.New("handlers: experiment signing key must be at least 16 bytes")
+		}
+		return nil
+	}
+}
+
+// ExperimentCookieMaxAge sets the lifetime of the assignment cookie. It
+// defaults to 30 days.
+func ExperimentCookieMaxAge(d time.Duration) ExperimentOption {
+	return func(e *experiment) error {
+		e.cookieMaxAge = d
+		if d <= 0 {
+			return fmt.Errorf("handlers: invalid experiment cookie max age %v", d)
+		}
+		return nil
+	}
+}
+
+// Experiment is HTTP middleware assigning each request to one of the variants
+// of the named A/B experiment. Assignment is deterministic: a hash of the
+// experiment name and of the request's key (see ExperimentKey) picks the
+// variant, so a client gets the same one across requests and instances.
+//
+// Handlers read the variant with ExperimentVariant. It is also attached to
+// the access log entry of the request as the field "experiment.<name>" (see
+// SetLogField), so that logs and EMF metrics can be broken down by variant.
+//
+// Example:
+//
+//	checkout := handlers.Experiment("checkout", []string{"control", "one-page"},
+//		handlers.ExperimentWeights(90, 10),
+//		handlers.ExperimentCookie(secret),
+//	)
+//	http.ListenAndServe(":1123", handlers.LoggingHandler(os.Stdout, checkout(r)))
+//
+//	// In a handler:
+//	if handlers.ExperimentVariant(r, "checkout") == "one-page" {
+//		...
+//	}
+func Experiment(name string, variants []string, opts ...ExperimentOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		e := newExperiment(name, variants)
+		e.h = h
+		for _, option := range opts {
+			option(e)
+		}
+		e.init()
+		return e
+	}
+}
+
+// NewExperiment is like Experiment, but returns an error if there are no
+// variants or an option is invalid.
+func NewExperiment(name string, variants []string, opts ...ExperimentOption) (func(http.Handler) http.Handler, error) {
+	if name == "" || len(variants) == 0 {
+		return nil, errors.New("handlers: experiment needs a name and variants")
+	}
+	e := newExperiment(name, variants)
+	for _, option := range opts {
+		if err := option(e); err != nil {
+			return nil, err
+		}
+	}
+	if e.weights != nil && len(e.weights) != len(variants) {
+		return nil, fmt.Errorf("handlers: %d experiment weights for %d variants", len(e.weights), len(variants))
+	}
+	return Experiment(name, variants, opts...), nil
+}
+
+func newExperiment(name string, variants []string) *experiment {
+	return &experiment{
+		name:     name,
+		variants: variants,
+		key: func(r *http.Request) string {
+			return hostOnly(r.RemoteAddr)
+		},
+		cookieName:   "exp_" + name,
+		cookieMaxAge: defaultExperimentCookieMaxAge,
+	}
+}
+
+// init normalizes the weights: missing ones are 1, extra ones are ignored.
+func (e *experiment) init() {
+	weights := make([]int, len(e.variants))
+	for i := range weights {
+		weights[i] = 1
+		if e.weights != nil {
+			weights[i] = 0
+			if i < len(e.weights) && e.weights[i] > 0 {
+				weights[i] = e.weights[i]
+			}
+		}
+		e.total += weights[i]
+	}
+	e.weights = weights
+}
+
+func (e *experiment) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("experiment", w, r)
+	defer end()
+
+	if len(e.variants) == 0 || e.total == 0 {
+		e.h.ServeHTTP(w, r)
+		return
+	}
+
+	variant, ok := e.fromCookie(r)
+	if !ok {
+		variant = e.assign(r)
+		if e.signingKey != nil {
+			http.SetCookie(w, &http.Cookie{
+				Name:     e.cookieName,
+				Value:    variant + "." + e.sign(variant),
+				Path:     "/",
+				MaxAge:   int(e.cookieMaxAge / time.Second),
+				HttpOnly: true,
+				Secure:   r.TLS != nil || r.URL.Scheme == "https",
+				SameSite: http.SameSiteLaxMode,
+			})
+		}
+	}
+
+	assignments := experimentAssignments{e.name: variant}
+	for name, v := range ExperimentVariantsFromContext(r.Context()) {
+		if name != e.name {
+			assignments[name] = v
+		}
+	}
+	SetLogField(r, "experiment."+e.name, variant)
+	e.h.ServeHTTP(w, WithValue(r, assignments))
+}
+
+// assign picks the variant of r from the hash of its key.
+func (e *experiment) assign(r *http.Request) string {
+	var bucket uint32
+	if k := e.key(r); k != "" {
+		h := fnv.New32a()
+		h.Write([]byte(e.name))
+		h.Write([]byte{0})
+		h.Write([]byte(k))
+		bucket = h.Sum32()
+	} else {
+		bucket = rand.Uint32()
+	}
+	n := int(bucket % uint32(e.total))
+	for i, w := range e.weights {
+		if n < w {
+			return e.variants[i]
+		}
+		n -= w
+	}
+	return e.variants[len(e.variants)-1]
+}
+
+// fromCookie returns the variant stored in the assignment cookie of r, if it
+// is correctly signed and still a variant of the experiment.
+func (e *experiment) fromCookie(r *http.Request) (string, bool) {
+	if e.signingKey == nil {
+		return "", false
+	}
+	c, err := r.Cookie(e.cookieName)
+	if err != nil {
+		return "", false
+	}
+	i := strings.LastIndexByte(c.Value, '.')
+	if i < 0 {
+		return "", false
+	}
+	variant, sig := c.Value[:i], c.Value[i+1:]
+	if !hmac.Equal([]byte(sig), []byte(e.sign(variant))) {
+		return "", false
+	}
+	for i, v := range e.variants {
+		if v == variant && e.weights[i] > 0 {
+			return variant, true
+		}
+	}
+	return "", false
+}
+
+func (e *experiment) sign(variant string) string {
+	mac := hmac.New(sha256.New, e.signingKey)
+	mac.Write([]byte(e.name))
+	mac.Write([]byte{0})
+	mac.Write([]byte(variant))
+	return base64.RawURLEncoding.EncodeToString(mac.Sum(nil)[:16])
+}
+
+// ExperimentVariant returns the variant of the named experiment assigned to
+// r by Experiment, or an empty string.
+func ExperimentVariant(r *http.Request, name string) string {
+	return ExperimentVariantsFromContext(r.Context())[name]
+}
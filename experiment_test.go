@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+var experimentKey = []byte("0123456789abcdef")
+
+func TestExperimentAssignment(t *testing.T) {
+	var got string
+	h := Experiment("checkout", []string{"a", "b", "c"}, ExperimentWeights(1, 0, 1))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ExperimentVariant(r, "checkout")
+	}))
+
+	counts := map[string]int{}
+	for i := 0; i < 1000; i++ {
+		r := newRequest("GET", "/")
+		r.RemoteAddr = fmt.Sprintf("10.0.%d.%d:1234", i/256, i%256)
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		first := got
+		h.ServeHTTP(httptest.NewRecorder(), r)
+		if got != first {
+			t.Fatalf("%s: unstable assignment: %q then %q", r.RemoteAddr, first, got)
+		}
+		counts[got]++
+	}
+	if counts["b"] != 0 || counts["a"] < 400 || counts["c"] < 400 {
+		t.Fatalf("wrong distribution: %v", counts)
+	}
+}
+
+func TestExperimentCookie(t *testing.T) {
+	var got string
+	h := Experiment("checkout", []string{"a", "b"}, ExperimentCookie(experimentKey))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = ExperimentVariant(r, "checkout")
+	}))
+
+	request := func() *http.Request {
+		r := newRequest("GET", "/")
+		r.RemoteAddr = "192.0.2.1:1234"
+		return r
+	}
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, request())
+	cookies := rec.Result().Cookies()
+	if len(cookies) != 1 || cookies[0].Name != "exp_checkout" || !strings.HasPrefix(cookies[0].Value, got+".") {
+		t.Fatalf("wrong cookies for variant %q: %v", got, cookies)
+	}
+
+	// A signed cookie overrides the hash assignment.
+	other := map[string]string{"a": "b", "b": "a"}[got]
+	r := request()
+	r.AddCookie(&http.Cookie{Name: "exp_checkout", Value: other + "." + (&experiment{name: "checkout", signingKey: experimentKey}).sign(other)})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if got != other || len(rec.Result().Cookies()) != 0 {
+		t.Fatalf("cookie not honored: got %q want %q", got, other)
+	}
+
+	// A tampered cookie is ignored.
+	r = request()
+	r.AddCookie(&http.Cookie{Name: "exp_checkout", Value: other + ".forged"})
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if got == other || len(rec.Result().Cookies()) != 1 {
+		t.Fatalf("tampered cookie honored: got %q", got)
+	}
+}
+
+func TestExperimentLogFieldsAndNesting(t *testing.T) {
+	var fields map[string]string
+	var variants map[string]string
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		variants = ExperimentVariantsFromContext(r.Context())
+	})
+	h := Chain(
+		func(h http.Handler) http.Handler {
+			return CustomLoggingHandler(ioutil.Discard, h, func(_ io.Writer, params LogFormatterParams) {
+				fields = params.Fields
+			})
+		},
+		Experiment("one", []string{"x"}),
+		Experiment("two", []string{"y"}),
+	)(inner)
+
+	h.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	if variants["one"] != "x" || variants["two"] != "y" {
+		t.Fatalf("wrong variants: %v", variants)
+	}
+	if fields["experiment.one"] != "x" || fields["experiment.two"] != "y" {
+		t.Fatalf("wrong log fields: %v", fields)
+	}
+}
+
+func TestNewExperiment(t *testing.T) {
+	tests := []struct {
+		name     string
+		variants []string
+		opts     []ExperimentOption
+		ok       bool
+	}{
+		{"e", []string{"a", "b"}, []ExperimentOption{ExperimentWeights(1, 2), ExperimentCookie(experimentKey)}, true},
+		{"", []string{"a"}, nil, false},
+		{"e", nil, nil, false},
+		{"e", []string{"a", "b"}, []ExperimentOption{ExperimentWeights(1)}, false},
+		{"e", []string{"a"}, []ExperimentOption{ExperimentWeights(-1)}, false},
+		{"e", []string{"a"}, []ExperimentOption{ExperimentCookie([]byte("short"))}, false},
+		{"e", []string{"a"}, []ExperimentOption{ExperimentCookieMaxAge(0)}, false},
+	}
+	for i, test := range tests {
+		if _, err := NewExperiment(test.name, test.variants, test.opts...); (err == nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,169 @@
+package handlers
+
+import (
+	"errors"
+	"hash/fnv"
+	"net/http"
+	"sort"
+	"strings"
+)
+
+// FeatureFlagProvider evaluates the feature flags of a request.
+type FeatureFlagProvider interface {
+	// FeatureFlags returns the state of each flag known to the provider for
+	// r.
+	FeatureFlags(r *http.Request) map[string]bool
+}
+
+// FeatureFlagProviderFunc is an adapter to use a function as a
+// FeatureFlagProvider.
+type FeatureFlagProviderFunc func(r *http.Request) map[string]bool
+
+// FeatureFlags calls fn(r).
+func (fn FeatureFlagProviderFunc) FeatureFlags(r *http.Request) map[string]bool {
+	return fn(r)
+}
+
+// StaticFeatureFlags returns a provider setting every request's flags to the
+// given states.
+func StaticFeatureFlags(flags map[string]bool) FeatureFlagProvider {
+	static := make(map[string]bool, len(flags))
+	for name, on := range flags {
+		static[name] = on
+	}
+	return FeatureFlagProviderFunc(func(r *http.Request) map[string]bool {
+		return static
+	})
+}
+
+// PercentageFeatureFlags returns a provider enabling each flag for the given
+// percentage of clients, from 0 to 100. Clients are identified by key, which
+// defaults to the client IP address, and hashed with the flag name, so that
+// a client keeps its flags across requests and the flags of a client are
+// independent from each other.
+func PercentageFeatureFlags(rollout map[string]float64, key func(r *http.Request) string) FeatureFlagProvider {
+	thresholds := make(map[string]uint32, len(rollout))
+	for name, pct := range rollout {
+		switch {
+		case pct < 0:
+			pct = 0
+		case pct > 100:
+			pct = 100
+		}
+		thresholds[name] = uint32(pct * 100)
+	}
+	if key == nil {
+		key = func(r *http.Request) string {
+			return hostOnly(r.RemoteAddr)
+		}
+	}
+	return FeatureFlagProviderFunc(func(r *http.Request) map[string]bool {
+		k := key(r)
+		flags := make(map[string]bool, len(thresholds))
+		for name, threshold := range thresholds {
+			h := fnv.New32a()
+			h.Write([]byte(name))
+			h.Write([]byte{0})
+			h.Write([]byte(k))
+			flags[name] = h.Sum32()%10000 < threshold
+		}
+		return flags
+	})
+}
+
+// FeatureFlagOption represents a functional option for configuring the
+// FeatureFlags middleware.
+type FeatureFlagOption func(*featureFlags) error
+
+type featureFlags struct {
+	h         http.Handler
+	providers []FeatureFlagProvider
+	header    string
+}
+
+// enabledFlags is stored in the request context by FeatureFlags.
+type enabledFlags map[string]bool
+
+// FeatureFlagHeader makes the middleware list the enabled flags of each
+// request, comma separated, in the named response header, for debugging.
+func FeatureFlagHeader(name string) FeatureFlagOption {
+	return func(f *featureFlags) error {
+		f.header = name
+		return nil
+	}
+}
+
+// FeatureFlags is HTTP middleware evaluating feature flags for each request
+// with the given providers and storing them in the request context, where
+// FeatureFlagEnabled reads them. When providers disagree on a flag, the last
+// one wins, so a StaticFeatureFlags provider placed last can force flags on or
+// off.
+//
+// Example:
+//
+//	flags := handlers.FeatureFlags([]handlers.FeatureFlagProvider{
+//		handlers.PercentageFeatureFlags(map[string]float64{"new-checkout": 10}, nil),
+//		handlers.StaticFeatureFlags(map[string]bool{"dark-mode": true}),
+//	}, handlers.FeatureFlagHeader("X-Feature-Flags"))
+//	http.ListenAndServe(":1123", flags(r))
+//
+//	// In a handler:
+//	if handlers.FeatureFlagEnabled(r, "new-checkout") {
+//		...
+//	}
+func FeatureFlags(providers []FeatureFlagProvider, opts ...FeatureFlagOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		f := &featureFlags{h: h, providers: providers}
+		for _, option := range opts {
+			option(f)
+		}
+		return f
+	}
+}
+
+// NewFeatureFlags is like FeatureFlags, but returns an error if a provider is
+// nil or an option is invalid.
+func NewFeatureFlags(providers []FeatureFlagProvider, opts ...FeatureFlagOption) (func(http.Handler) http.Handler, error) {
+	for _, p := range providers {
+		if p == nil {
+			return nil, errors.New("handlers: nil feature flag provider")
+		}
+	}
+	f := &featureFlags{}
+	for _, option := range opts {
+		if err := option(f); err != nil {
+			return nil, err
+		}
+	}
+	return FeatureFlags(providers, opts...), nil
+}
+
+func (f *featureFlags) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("feature_flags", w, r)
+	defer end()
+
+	flags := enabledFlags{}
+	for _, p := range f.providers {
+		for name, on := range p.FeatureFlags(r) {
+			flags[name] = on
+		}
+	}
+	if f.header != "" {
+		var names []string
+		for name, on := range flags {
+			if on {
+				names = append(names, name)
+			}
+		}
+		sort.Strings(names)
+		w.Header().Set(f.header, strings.Join(names, ","))
+	}
+	f.h.ServeHTTP(w, WithValue(r, flags))
+}
+
+// FeatureFlagEnabled reports whether the named flag is enabled for r, as
+// evaluated by FeatureFlags. Unknown flags, and all flags of requests not
+// served through FeatureFlags, are disabled.
+func FeatureFlagEnabled(r *http.Request, name string) bool {
+	return FeatureFlagsFromContext(r.Context())[name]
+}
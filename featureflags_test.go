@@ -0,0 +1,65 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestFeatureFlags(t *testing.T) {
+	var enabled, disabled, unknown bool
+	h := FeatureFlags([]FeatureFlagProvider{
+		StaticFeatureFlags(map[string]bool{"a": true, "b": true, "c": false}),
+		StaticFeatureFlags(map[string]bool{"b": false}),
+	}, FeatureFlagHeader("X-Feature-Flags"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		enabled = FeatureFlagEnabled(r, "a")
+		disabled = FeatureFlagEnabled(r, "b")
+		unknown = FeatureFlagEnabled(r, "z")
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/"))
+	if !enabled || disabled || unknown {
+		t.Fatalf("wrong flags: a=%v b=%v z=%v", enabled, disabled, unknown)
+	}
+	if got := rec.Header().Get("X-Feature-Flags"); got != "a" {
+		t.Fatalf("wrong header: got %q want %q", got, "a")
+	}
+	if FeatureFlagEnabled(newRequest("GET", "/"), "a") {
+		t.Fatal("flag enabled without the middleware")
+	}
+}
+
+func TestPercentageFeatureFlags(t *testing.T) {
+	p := PercentageFeatureFlags(map[string]float64{"none": 0, "half": 50, "all": 100}, func(r *http.Request) string {
+		return r.Header.Get("X-User")
+	})
+	var half int
+	for i := 0; i < 1000; i++ {
+		r := newRequest("GET", "/")
+		r.Header.Set("X-User", fmt.Sprint("user", i))
+		flags := p.FeatureFlags(r)
+		if flags["none"] || !flags["all"] {
+			t.Fatalf("wrong flags for user %d: %v", i, flags)
+		}
+		if flags["half"] {
+			half++
+		}
+		if again := p.FeatureFlags(r); again["half"] != flags["half"] {
+			t.Fatalf("unstable flag for user %d", i)
+		}
+	}
+	if half < 400 || half > 600 {
+		t.Fatalf("flag enabled for %d of 1000 users, want about 500", half)
+	}
+}
+
+func TestNewFeatureFlags(t *testing.T) {
+	if _, err := NewFeatureFlags([]FeatureFlagProvider{nil}); err == nil {
+		t.Fatal("no error for a nil provider")
+	}
+	if _, err := NewFeatureFlags([]FeatureFlagProvider{StaticFeatureFlags(nil)}); err != nil {
+		t.Fatal(err)
+	}
+}
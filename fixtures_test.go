@@ -0,0 +1,89 @@
+package handlers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestFixtures(t *testing.T) {
+	dir, err := ioutil.TempDir("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	calls := 0
+	origin := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		calls++
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte(r.URL.Query().Get("q") + ":" + string(body)))
+	})
+
+	serve := func(mode FixtureMode, target, body string) *httptest.ResponseRecorder {
+		rec := httptest.NewRecorder()
+		r := httptest.NewRequest("POST", target, strings.NewReader(body))
+		Fixtures(dir, mode)(origin).ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := serve(FixtureRecord, "/search?q=go&page=1", "payload")
+	if calls != 1 || rec.Body.String() != "go:payload" {
+		t.Fatalf("bad recorded response: calls %d body %q", calls, rec.Body.String())
+	}
+
+	// Query parameter order doesn't matter.
+	rec = serve(FixtureReplay, "/search?page=1&q=go", "payload")
+	if calls != 1 {
+		t.Fatalf("handler invoked in replay mode")
+	}
+	if rec.Code != http.StatusAccepted || rec.Body.String() != "go:payload" || rec.Header().Get("Content-Type") != "text/plain" {
+		t.Fatalf("bad replayed response: %d %q %v", rec.Code, rec.Body.String(), rec.Header())
+	}
+
+	// A different body is a different fixture.
+	rec = serve(FixtureReplay, "/search?q=go&page=1", "other")
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("bad status for missing fixture: got %d want %d", rec.Code, http.StatusNotFound)
+	}
+
+	rec = serve(FixtureReplayOrRecord, "/search?q=go&page=1", "other")
+	if calls != 2 || rec.Body.String() != "go:other" {
+		t.Fatalf("bad response: calls %d body %q", calls, rec.Body.String())
+	}
+	serve(FixtureReplayOrRecord, "/search?q=go&page=1", "other")
+	if calls != 2 {
+		t.Fatalf("handler invoked for recorded fixture")
+	}
+}
+
+func TestFixturesRecordError(t *testing.T) {
+	f, err := ioutil.TempFile("", "fixtures")
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.Close()
+	defer os.Remove(f.Name())
+
+	var buf bytes.Buffer
+	log.SetOutput(&buf)
+	defer log.SetOutput(os.Stderr)
+
+	// The fixture directory can't be created under a file.
+	rec := httptest.NewRecorder()
+	Fixtures(filepath.Join(f.Name(), "fixtures"), FixtureRecord)(okHandler).ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Body.String() != ok {
+		t.Fatalf("bad response: %q", rec.Body.String())
+	}
+	if !strings.Contains(buf.String(), "handlers: recording fixture") {
+		t.Fatalf("recording error not logged: %q", buf.String())
+	}
+}
@@ -1,5 +1,5 @@
 module github.com/stockholmr/handlers
 
-go 1.14
+go 1.22
 
 require github.com/felixge/httpsnoop v1.0.1
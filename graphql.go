@@ -0,0 +1,669 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultGraphQLMaxDepth      = 12
+	defaultGraphQLMaxComplexity = 1000
+	defaultGraphQLMaxAliases    = 30
+	defaultGraphQLMaxBodySize   = 1 << 20
+
+	// graphQLCap bounds the complexity and alias counts of documents
+	// reusing fragments, which can grow exponentially.
+	graphQLCap = 1 << 40
+)
+
+// GraphQLOption represents a functional option for configuring GraphQLGuard.
+type GraphQLOption func(*graphQLGuard) error
+
+type graphQLGuard struct {
+	h             http.Handler
+	maxDepth      int
+	maxComplexity int
+	maxAliases    int
+	maxBodySize   int64
+}
+
+// GraphQLMaxDepth sets the maximum nesting depth of the fields of a query, 12
+// by default. Top-level fields have depth 1.
+func GraphQLMaxDepth(n int) GraphQLOption {
+	return func(g *graphQLGuard) error {
+		g.maxDepth = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid GraphQL max depth %d", n)
+		}
+		return nil
+	}
+}
+
+// GraphQLMaxComplexity sets the maximum complexity of a request, 1000 by
+// default. The complexity is the number of fields selected, counting those of
+// fragments each time they are spread, summed over the documents of a batch.
+func GraphQLMaxComplexity(n int) GraphQLOption {
+	return func(g *graphQLGuard) error {
+		g.maxComplexity = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid GraphQL max complexity %d", n)
+		}
+		return nil
+	}
+}
+
+// GraphQLMaxAliases sets the maximum number of aliased fields of a request,
+// 30 by default, counted as the complexity is. Aliases let a single request
+// run the same resolver many times.
+func GraphQLMaxAliases(n int) GraphQLOption {
+	return func(g *graphQLGuard) error {
+		g.maxAliases = n
+		if n < 0 {
+			return fmt.Errorf("handlers: invalid GraphQL max aliases %d", n)
+		}
+		return nil
+	}
+}
+
+// GraphQLMaxBodySize sets the maximum size of the request bodies, 1MiB by
+// default. Larger bodies are rejected with 413 Request Entity Too Large.
+func GraphQLMaxBodySize(n int64) GraphQLOption {
+	return func(g *graphQLGuard) error {
+		g.maxBodySize = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid GraphQL max body size %d", n)
+		}
+		return nil
+	}
+}
+
+// GraphQLGuard is HTTP middleware for a GraphQL endpoint, rejecting queries
+// too expensive to execute before they reach the GraphQL server: it parses
+// the request documents and answers those exceeding the maximum depth,
+// complexity or number of aliases with 400 Bad Request. Documents which don't
+// parse are rejected the same way.
+//
+// Documents are read from the query parameter of GET requests, and from the
+// body of POST requests, either as application/graphql or as the query member
+// of an application/json object, or of each object of a batch array. The body
+// remains readable by the GraphQL server. Requests with other content types,
+// such as multipart file uploads, are passed on unchecked.
+//
+// Errors are reported in the GraphQL response format:
+//
+//	{"errors": [{"message": "query depth 14 exceeds the limit of 12"}]}
+//
+// Example:
+//
+//	http.Handle("/graphql", handlers.GraphQLGuard(
+//		handlers.GraphQLMaxDepth(8),
+//		handlers.GraphQLMaxAliases(10),
+//	)(graphqlServer))
+func GraphQLGuard(opts ...GraphQLOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		g := &graphQLGuard{
+			h:             h,
+			maxDepth:      defaultGraphQLMaxDepth,
+			maxComplexity: defaultGraphQLMaxComplexity,
+			maxAliases:    defaultGraphQLMaxAliases,
+			maxBodySize:   defaultGraphQLMaxBodySize,
+		}
+		for _, option := range opts {
+			option(g)
+		}
+		return g
+	}
+}
+
+// NewGraphQLGuard is like GraphQLGuard, but returns an error if an option is
+// invalid.
+func NewGraphQLGuard(opts ...GraphQLOption) (func(http.Handler) http.Handler, error) {
+	g := &graphQLGuard{}
+	for _, option := range opts {
+		if err := option(g); err != nil {
+			return nil, err
+		}
+	}
+	return GraphQLGuard(opts...), nil
+}
+
+func (g *graphQLGuard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("graphql_guard", w, r)
+	defer end()
+
+	queries, code, err := g.queries(r)
+	if err == nil {
+		err = g.check(queries)
+	}
+	if err != nil {
+		if code == 0 {
+			code = http.StatusBadRequest
+		}
+		writeGraphQLError(w, code, err.Error())
+		return
+	}
+	g.h.ServeHTTP(w, r)
+}
+
+// queries returns the GraphQL documents of r, and on error the status code
+// to reply with.
+func (g *graphQLGuard) queries(r *http.Request) ([]string, int, error) {
+	if r.Method == "GET" || r.Method == "HEAD" {
+		if q := r.URL.Query().Get("query"); q != "" {
+			return []string{q}, 0, nil
+		}
+		return nil, 0, nil
+	}
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if r.Body == nil || (mt != "application/graphql" && !isJSONMediaType(mt)) {
+		return nil, 0, nil
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, g.maxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		return nil, 0, errors.New("unreadable request body")
+	}
+	if int64(len(body)) > g.maxBodySize {
+		return nil, http.StatusRequestEntityTooLarge, fmt.Errorf("request body larger than %d bytes", g.maxBodySize)
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	if mt == "application/graphql" {
+		return []string{string(body)}, 0, nil
+	}
+	type params struct {
+		Query string `json:"query"`
+	}
+	var batch []params
+	if body = bytes.TrimSpace(body); len(body) > 0 && body[0] == '[' {
+		err = json.Unmarshal(body, &batch)
+	} else {
+		batch = make([]params, 1)
+		err = json.Unmarshal(body, &batch[0])
+	}
+	if err != nil {
+		return nil, 0, errors.New("invalid JSON request body")
+	}
+	queries := make([]string, 0, len(batch))
+	for _, p := range batch {
+		if p.Query != "" {
+			queries = append(queries, p.Query)
+		}
+	}
+	return queries, 0, nil
+}
+
+// check returns an error if queries exceed the configured limits.
+func (g *graphQLGuard) check(queries []string) error {
+	var total graphQLStats
+	for _, q := range queries {
+		stats, err := measureGraphQL(q)
+		if err != nil {
+			return err
+		}
+		if stats.depth > total.depth {
+			total.depth = stats.depth
+		}
+		total.complexity = capGraphQL(total.complexity + stats.complexity)
+		total.aliases = capGraphQL(total.aliases + stats.aliases)
+	}
+	switch {
+	case total.depth > g.maxDepth:
+		return fmt.Errorf("query depth %d exceeds the limit of %d", total.depth, g.maxDepth)
+	case total.complexity > g.maxComplexity:
+		return fmt.Errorf("query complexity %d exceeds the limit of %d", total.complexity, g.maxComplexity)
+	case total.aliases > g.maxAliases:
+		return fmt.Errorf("query uses %d aliases, more than the limit of %d", total.aliases, g.maxAliases)
+	}
+	return nil
+}
+
+// writeGraphQLError replies with a GraphQL response holding a single error.
+func writeGraphQLError(w http.ResponseWriter, code int, message string) {
+	body, _ := json.Marshal(map[string]interface{}{
+		"errors": []map[string]string{{"message": message}},
+	})
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+	w.Write(body)
+}
+
+// graphQLSelection is a field, inline fragment or fragment spread of a
+// selection set, as far as GraphQLGuard is concerned.
+type graphQLSelection struct {
+	field    bool
+	alias    bool
+	spread   string
+	children []graphQLSelection
+}
+
+type graphQLStats struct {
+	depth, complexity, aliases int
+}
+
+func capGraphQL(n int) int {
+	if n > graphQLCap {
+		return graphQLCap
+	}
+	return n
+}
+
+// measureGraphQL parses the GraphQL document q and returns the maximum depth,
+// and the total complexity and aliases, of its operations.
+func measureGraphQL(q string) (graphQLStats, error) {
+	p := &graphQLParser{lex: graphQLLexer{src: q}}
+	ops, fragments, err := p.document()
+	if err != nil {
+		return graphQLStats{}, err
+	}
+	m := &graphQLMeasure{fragments: fragments, stats: map[string]graphQLStats{}, visiting: map[string]bool{}}
+	var total graphQLStats
+	for _, op := range ops {
+		stats, err := m.measure(op)
+		if err != nil {
+			return graphQLStats{}, err
+		}
+		if stats.depth > total.depth {
+			total.depth = stats.depth
+		}
+		total.complexity = capGraphQL(total.complexity + stats.complexity)
+		total.aliases = capGraphQL(total.aliases + stats.aliases)
+	}
+	return total, nil
+}
+
+// graphQLMeasure measures selection sets, memoizing the measures of fragments.
+type graphQLMeasure struct {
+	fragments map[string][]graphQLSelection
+	stats     map[string]graphQLStats
+	visiting  map[string]bool
+}
+
+func (m *graphQLMeasure) measure(set []graphQLSelection) (graphQLStats, error) {
+	var total graphQLStats
+	for _, sel := range set {
+		var stats graphQLStats
+		var err error
+		switch {
+		case sel.spread != "":
+			stats, err = m.fragment(sel.spread)
+		default:
+			stats, err = m.measure(sel.children)
+		}
+		if err != nil {
+			return graphQLStats{}, err
+		}
+		if sel.field {
+			stats.depth++
+			stats.complexity++
+			if sel.alias {
+				stats.aliases++
+			}
+		}
+		if stats.depth > total.depth {
+			total.depth = stats.depth
+		}
+		total.complexity = capGraphQL(total.complexity + stats.complexity)
+		total.aliases = capGraphQL(total.aliases + stats.aliases)
+	}
+	return total, nil
+}
+
+func (m *graphQLMeasure) fragment(name string) (graphQLStats, error) {
+	if stats, ok := m.stats[name]; ok {
+		return stats, nil
+	}
+	set, ok := m.fragments[name]
+	if !ok {
+		return graphQLStats{}, fmt.Errorf("unknown fragment %q", name)
+	}
+	if m.visiting[name] {
+		return graphQLStats{}, fmt.Errorf("fragment %q spreads itself", name)
+	}
+	m.visiting[name] = true
+	stats, err := m.measure(set)
+	m.visiting[name] = false
+	if err != nil {
+		return graphQLStats{}, err
+	}
+	m.stats[name] = stats
+	return stats, nil
+}
+
+// graphQLParser parses the executable definitions of GraphQL documents,
+// skipping over arguments, variables and directives.
+type graphQLParser struct {
+	lex graphQLLexer
+	tok graphQLToken
+}
+
+func (p *graphQLParser) next() error {
+	tok, err := p.lex.next()
+	p.tok = tok
+	return err
+}
+
+func (p *graphQLParser) errorf(format string, args ...interface{}) error {
+	return fmt.Errorf("syntax error at offset %d: %s", p.tok.pos, fmt.Sprintf(format, args...))
+}
+
+// expect consumes the punctuator s.
+func (p *graphQLParser) expect(s string) error {
+	if p.tok.kind != graphQLPunct || p.tok.text != s {
+		return p.errorf("expected %q, found %s", s, p.tok)
+	}
+	return p.next()
+}
+
+// name consumes a name and returns it.
+func (p *graphQLParser) name() (string, error) {
+	if p.tok.kind != graphQLName {
+		return "", p.errorf("expected name, found %s", p.tok)
+	}
+	name := p.tok.text
+	return name, p.next()
+}
+
+func (p *graphQLParser) is(s string) bool {
+	return p.tok.kind == graphQLPunct && p.tok.text == s
+}
+
+func (p *graphQLParser) document() (ops [][]graphQLSelection, fragments map[string][]graphQLSelection, err error) {
+	fragments = map[string][]graphQLSelection{}
+	if err := p.next(); err != nil {
+		return nil, nil, err
+	}
+	for p.tok.kind != graphQLEOF {
+		switch {
+		case p.is("{"):
+		case p.tok.kind == graphQLName && (p.tok.text == "query" || p.tok.text == "mutation" || p.tok.text == "subscription"):
+			if err := p.next(); err != nil {
+				return nil, nil, err
+			}
+			if p.tok.kind == graphQLName {
+				if err := p.next(); err != nil {
+					return nil, nil, err
+				}
+			}
+			if p.is("(") {
+				if err := p.skipGroup(); err != nil {
+					return nil, nil, err
+				}
+			}
+			if err := p.directives(); err != nil {
+				return nil, nil, err
+			}
+		case p.tok.kind == graphQLName && p.tok.text == "fragment":
+			if err := p.next(); err != nil {
+				return nil, nil, err
+			}
+			name, err := p.name()
+			if err != nil {
+				return nil, nil, err
+			}
+			if err := p.typeCondition(); err != nil {
+				return nil, nil, err
+			}
+			if err := p.directives(); err != nil {
+				return nil, nil, err
+			}
+			if _, ok := fragments[name]; ok {
+				return nil, nil, fmt.Errorf("fragment %q defined twice", name)
+			}
+			if fragments[name], err = p.selectionSet(); err != nil {
+				return nil, nil, err
+			}
+			continue
+		default:
+			return nil, nil, p.errorf("expected operation or fragment, found %s", p.tok)
+		}
+		set, err := p.selectionSet()
+		if err != nil {
+			return nil, nil, err
+		}
+		ops = append(ops, set)
+	}
+	if len(ops) == 0 {
+		return nil, nil, errors.New("document has no operation")
+	}
+	return ops, fragments, nil
+}
+
+// typeCondition consumes "on Type".
+func (p *graphQLParser) typeCondition() error {
+	if p.tok.kind != graphQLName || p.tok.text != "on" {
+		return p.errorf("expected \"on\", found %s", p.tok)
+	}
+	if err := p.next(); err != nil {
+		return err
+	}
+	_, err := p.name()
+	return err
+}
+
+// directives skips over directives.
+func (p *graphQLParser) directives() error {
+	for p.is("@") {
+		if err := p.next(); err != nil {
+			return err
+		}
+		if _, err := p.name(); err != nil {
+			return err
+		}
+		if p.is("(") {
+			if err := p.skipGroup(); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
+
+// skipGroup skips over a parenthesized group, such as arguments or variable
+// definitions, and the brackets and braces of the values within.
+func (p *graphQLParser) skipGroup() error {
+	var stack []string
+	for {
+		if p.tok.kind == graphQLPunct {
+			switch p.tok.text {
+			case "(":
+				stack = append(stack, ")")
+			case "[":
+				stack = append(stack, "]")
+			case "{":
+				stack = append(stack, "}")
+			case ")", "]", "}":
+				if len(stack) == 0 || stack[len(stack)-1] != p.tok.text {
+					return p.errorf("unexpected %s", p.tok)
+				}
+				stack = stack[:len(stack)-1]
+			}
+		} else if p.tok.kind == graphQLEOF {
+			return p.errorf("unexpected end of document")
+		}
+		if err := p.next(); err != nil {
+			return err
+		}
+		if len(stack) == 0 {
+			return nil
+		}
+	}
+}
+
+func (p *graphQLParser) selectionSet() ([]graphQLSelection, error) {
+	if err := p.expect("{"); err != nil {
+		return nil, err
+	}
+	var set []graphQLSelection
+	for !p.is("}") {
+		sel, err := p.selection()
+		if err != nil {
+			return nil, err
+		}
+		set = append(set, sel)
+	}
+	if len(set) == 0 {
+		return nil, p.errorf("empty selection set")
+	}
+	return set, p.next()
+}
+
+func (p *graphQLParser) selection() (sel graphQLSelection, err error) {
+	if p.is("...") {
+		if err := p.next(); err != nil {
+			return sel, err
+		}
+		if p.tok.kind == graphQLName && p.tok.text != "on" {
+			if sel.spread, err = p.name(); err != nil {
+				return sel, err
+			}
+			return sel, p.directives()
+		}
+		if p.tok.kind == graphQLName {
+			if err := p.typeCondition(); err != nil {
+				return sel, err
+			}
+		}
+		if err := p.directives(); err != nil {
+			return sel, err
+		}
+		sel.children, err = p.selectionSet()
+		return sel, err
+	}
+
+	sel.field = true
+	if _, err := p.name(); err != nil {
+		return sel, err
+	}
+	if p.is(":") {
+		sel.alias = true
+		if err := p.next(); err != nil {
+			return sel, err
+		}
+		if _, err := p.name(); err != nil {
+			return sel, err
+		}
+	}
+	if p.is("(") {
+		if err := p.skipGroup(); err != nil {
+			return sel, err
+		}
+	}
+	if err := p.directives(); err != nil {
+		return sel, err
+	}
+	if p.is("{") {
+		sel.children, err = p.selectionSet()
+	}
+	return sel, err
+}
+
+type graphQLTokenKind int
+
+const (
+	graphQLEOF graphQLTokenKind = iota
+	graphQLPunct
+	graphQLName
+	graphQLValue
+)
+
+type graphQLToken struct {
+	kind graphQLTokenKind
+	text string
+	pos  int
+}
+
+func (t graphQLToken) String() string {
+	if t.kind == graphQLEOF {
+		return "end of document"
+	}
+	return fmt.Sprintf("%q", t.text)
+}
+
+// graphQLLexer splits a GraphQL document into tokens, skipping whitespace,
+// commas and comments. Strings and numbers are returned as values, unparsed.
+type graphQLLexer struct {
+	src string
+	pos int
+}
+
+func (l *graphQLLexer) next() (graphQLToken, error) {
+	for l.pos < len(l.src) {
+		c := l.src[l.pos]
+		if c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == ',' {
+			l.pos++
+		} else if c == '#' {
+			for l.pos < len(l.src) && l.src[l.pos] != '\n' && l.src[l.pos] != '\r' {
+				l.pos++
+			}
+		} else if strings.HasPrefix(l.src[l.pos:], "\ufeff") {
+			l.pos += 3
+		} else {
+			break
+		}
+	}
+	start := l.pos
+	if l.pos == len(l.src) {
+		return graphQLToken{kind: graphQLEOF, pos: start}, nil
+	}
+	c := l.src[l.pos]
+	switch {
+	case c == '.':
+		if strings.HasPrefix(l.src[l.pos:], "...") {
+			l.pos += 3
+			return graphQLToken{graphQLPunct, "...", start}, nil
+		}
+	case strings.IndexByte("!$&():=@[]{|}", c) >= 0:
+		l.pos++
+		return graphQLToken{graphQLPunct, string(c), start}, nil
+	case c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z':
+		for l.pos < len(l.src) && isGraphQLNameChar(l.src[l.pos]) {
+			l.pos++
+		}
+		return graphQLToken{graphQLName, l.src[start:l.pos], start}, nil
+	case c == '-' || c >= '0' && c <= '9':
+		l.pos++
+		for l.pos < len(l.src) && (isGraphQLNameChar(l.src[l.pos]) || l.src[l.pos] == '.' || l.src[l.pos] == '+' || l.src[l.pos] == '-') {
+			l.pos++
+		}
+		return graphQLToken{graphQLValue, l.src[start:l.pos], start}, nil
+	case c == '"':
+		if strings.HasPrefix(l.src[l.pos:], `"""`) {
+			l.pos += 3
+			for ; l.pos < len(l.src); l.pos++ {
+				if strings.HasPrefix(l.src[l.pos:], `\"""`) {
+					l.pos += 3
+				} else if strings.HasPrefix(l.src[l.pos:], `"""`) {
+					l.pos += 3
+					return graphQLToken{graphQLValue, l.src[start:l.pos], start}, nil
+				}
+			}
+		} else {
+			for l.pos++; l.pos < len(l.src); l.pos++ {
+				switch l.src[l.pos] {
+				case '\\':
+					l.pos++
+				case '\n', '\r':
+					l.pos = len(l.src)
+				case '"':
+					l.pos++
+					return graphQLToken{graphQLValue, l.src[start:l.pos], start}, nil
+				}
+			}
+		}
+		return graphQLToken{pos: start}, fmt.Errorf("syntax error at offset %d: unterminated string", start)
+	}
+	return graphQLToken{pos: start}, fmt.Errorf("syntax error at offset %d: unexpected character %q", start, c)
+}
+
+func isGraphQLNameChar(c byte) bool {
+	return c == '_' || c >= 'A' && c <= 'Z' || c >= 'a' && c <= 'z' || c >= '0' && c <= '9'
+}
@@ -0,0 +1,143 @@
+package handlers
+
+import (
+	"fmt"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMeasureGraphQL(t *testing.T) {
+	tests := []struct {
+		query string
+		stats graphQLStats
+	}{
+		{`{ me { name } }`, graphQLStats{2, 2, 0}},
+		{`query Q($id: ID! = "x") @cached { a: user(id: $id, filter: {tags: ["a", "b"]}) { name @include(if: true) } b: user(id: 2) { name } }`, graphQLStats{2, 4, 2}},
+		{`
+			# Fetch a user's friends.
+			query {
+				user(id: 1) {
+					...userFields
+					... on Admin { permissions { name } }
+					... @skip(if: false) { email }
+				}
+			}
+			fragment userFields on User {
+				friends(first: 10, after: """a "quoted" \""" cursor""") { name }
+			}
+		`, graphQLStats{3, 6, 0}},
+		{`query A { a } mutation B { b { c } }`, graphQLStats{2, 3, 0}},
+		{`{ ...f ...f } fragment f on Q { x: a y: b }`, graphQLStats{1, 4, 4}},
+	}
+	for _, test := range tests {
+		stats, err := measureGraphQL(test.query)
+		if err != nil {
+			t.Errorf("%s: %v", test.query, err)
+		} else if stats != test.stats {
+			t.Errorf("%s: got %+v want %+v", test.query, stats, test.stats)
+		}
+	}
+
+	for _, query := range []string{
+		``,
+		`{ }`,
+		`{ a(b: 1 }`,
+		`{ a { b }`,
+		`{ a(b: "c) }`,
+		`{ ...missing }`,
+		`{ ...f } fragment f on Q { ...g } fragment g on Q { ...f }`,
+		`{ a } fragment f on Q { b } fragment f on Q { c }`,
+		`type Query { a: String }`,
+		`{ a ~ }`,
+	} {
+		if _, err := measureGraphQL(query); err == nil {
+			t.Errorf("%s: no error", query)
+		}
+	}
+}
+
+func TestMeasureGraphQLFragmentExpansion(t *testing.T) {
+	// Each fragment spreads the previous one twice, for 2^50 fields.
+	var b strings.Builder
+	b.WriteString("{ ...f50 } fragment f0 on Q { a }")
+	for i := 1; i <= 50; i++ {
+		fmt.Fprintf(&b, " fragment f%d on Q { ...f%d ...f%d }", i, i-1, i-1)
+	}
+	stats, err := measureGraphQL(b.String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if stats.complexity != graphQLCap {
+		t.Fatalf("got complexity %d want %d", stats.complexity, graphQLCap)
+	}
+}
+
+func TestGraphQLGuard(t *testing.T) {
+	var body string
+	h := GraphQLGuard(GraphQLMaxDepth(3), GraphQLMaxComplexity(5), GraphQLMaxAliases(1), GraphQLMaxBodySize(256))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}
+	}))
+
+	tests := []struct {
+		method, contentType, body string
+		code                      int
+		message                   string
+	}{
+		{"GET", "", `{ a { b { c } } }`, http.StatusOK, ""},
+		{"GET", "", `{ a { b { c { d } } } }`, http.StatusBadRequest, "query depth 4 exceeds the limit of 3"},
+		{"POST", "application/json", `{"query": "{ a b c d e }", "variables": {}}`, http.StatusOK, ""},
+		{"POST", "application/json", `{"query": "{ a b c d e f }"}`, http.StatusBadRequest, "query complexity 6 exceeds the limit of 5"},
+		{"POST", "application/json", `[{"query": "{ a b c }"}, {"query": "{ d e f }"}]`, http.StatusBadRequest, "query complexity 6 exceeds the limit of 5"},
+		{"POST", "application/json; charset=utf-8", `{"query": "{ x: a y: a }"}`, http.StatusBadRequest, "query uses 2 aliases, more than the limit of 1"},
+		{"POST", "application/json", `{"query": "{ a "}`, http.StatusBadRequest, "syntax error at offset 4: expected name, found end of document"},
+		{"POST", "application/json", `{"query": `, http.StatusBadRequest, "invalid JSON request body"},
+		{"POST", "application/graphql", `{ x: a b }`, http.StatusOK, ""},
+		{"POST", "application/graphql", `{ a { b { c { d } } } }`, http.StatusBadRequest, "query depth 4 exceeds the limit of 3"},
+		{"POST", "application/json", `{"query": "` + strings.Repeat(" ", 256) + `"}`, http.StatusRequestEntityTooLarge, "request body larger than 256 bytes"},
+		{"POST", "multipart/form-data; boundary=x", `--x--`, http.StatusOK, ""},
+	}
+	for _, test := range tests {
+		body = ""
+		var r *http.Request
+		if test.method == "GET" {
+			r = newRequest("GET", "/graphql?query="+url.QueryEscape(test.body))
+		} else {
+			r = httptest.NewRequest(test.method, "/graphql", strings.NewReader(test.body))
+			r.Header.Set("Content-Type", test.contentType)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%s: wrong status: got %d want %d: %s", test.body, rec.Code, test.code, rec.Body.String())
+			continue
+		}
+		if test.code == http.StatusOK {
+			if test.method == "POST" && body != test.body {
+				t.Errorf("%s: body not readable: %q", test.body, body)
+			}
+			continue
+		}
+		want := `{"errors":[{"message":"` + test.message + `"}]}`
+		if rec.Body.String() != want || rec.Header().Get("Content-Type") != "application/json" {
+			t.Errorf("%s: wrong response: got %s want %s", test.body, rec.Body.String(), want)
+		}
+	}
+}
+
+func TestNewGraphQLGuard(t *testing.T) {
+	for _, opt := range []GraphQLOption{GraphQLMaxDepth(0), GraphQLMaxComplexity(-1), GraphQLMaxAliases(-1), GraphQLMaxBodySize(0)} {
+		if _, err := NewGraphQLGuard(opt); err == nil {
+			t.Error("no error for invalid option")
+		}
+	}
+	if _, err := NewGraphQLGuard(GraphQLMaxAliases(0)); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,92 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Group registers routes sharing a path prefix and a middleware stack on a
+// http.ServeMux. Patterns use the syntax of ServeMux, including methods and
+// wildcards ("GET /users/{id}"), and handlers see the full request path, so
+// r.PathValue works as usual.
+//
+// Example:
+//
+//	mux := http.NewServeMux()
+//	base := handlers.NewGroup(mux, "", handlers.RecoveryHandler())
+//
+//	api := base.Group("/api", handlers.CORS(), handlers.CompressHandler)
+//	api.HandleFunc("GET /users/{id}", getUser)  // GET /api/users/{id}
+//	api.HandleFunc("POST /users", createUser)   // POST /api/users
+//
+//	admin := base.Group("/admin", requireAdmin)
+//	admin.Handle("/", adminUI)                  // /admin/...
+//
+//	http.ListenAndServe(":1123", mux)
+type Group struct {
+	mux    *http.ServeMux
+	prefix string
+	stack  Stack
+}
+
+// NewGroup returns a Group registering routes under prefix on mux, wrapped
+// with the given middlewares. A nil mux is replaced by http.DefaultServeMux.
+// NewGroup panics if prefix is neither empty nor starts with "/".
+func NewGroup(mux *http.ServeMux, prefix string, mw ...Middleware) *Group {
+	if mux == nil {
+		mux = http.DefaultServeMux
+	}
+	return &Group{mux: mux, prefix: cleanGroupPrefix(prefix), stack: NewStack(mw...)}
+}
+
+// Group returns a sub-group of g, whose prefix is appended to that of g and
+// whose middlewares run inside those of g.
+func (g *Group) Group(prefix string, mw ...Middleware) *Group {
+	return &Group{mux: g.mux, prefix: g.prefix + cleanGroupPrefix(prefix), stack: g.stack.Append(mw...)}
+}
+
+// With returns a group with the prefix of g and additional middlewares, for
+// routes which need more middlewares than their siblings.
+func (g *Group) With(mw ...Middleware) *Group {
+	return g.Group("", mw...)
+}
+
+// Prefix returns the path prefix of the routes of g.
+func (g *Group) Prefix() string {
+	return g.prefix
+}
+
+// Handle registers h for pattern, prefixed with the prefix of g and wrapped
+// with its middlewares. The pattern "/" matches every path under the prefix.
+// Like http.ServeMux.Handle, it panics if the pattern is invalid or conflicts
+// with another one.
+func (g *Group) Handle(pattern string, h http.Handler) {
+	g.mux.Handle(g.pattern(pattern), g.stack.Then(h))
+}
+
+// HandleFunc registers fn for pattern, like Handle.
+func (g *Group) HandleFunc(pattern string, fn func(http.ResponseWriter, *http.Request)) {
+	g.Handle(pattern, http.HandlerFunc(fn))
+}
+
+// pattern inserts the prefix of g between the method and host of pattern, and
+// its path.
+func (g *Group) pattern(pattern string) string {
+	var method string
+	if i := strings.IndexAny(pattern, " \t"); i >= 0 {
+		method = pattern[:i] + " "
+		pattern = strings.TrimLeft(pattern[i:], " \t")
+	}
+	i := strings.IndexByte(pattern, '/')
+	if i < 0 {
+		panic("handlers: invalid group pattern " + pattern)
+	}
+	return method + pattern[:i] + g.prefix + pattern[i:]
+}
+
+func cleanGroupPrefix(prefix string) string {
+	if prefix != "" && prefix[0] != '/' {
+		panic("handlers: group prefix must start with /: " + prefix)
+	}
+	return strings.TrimSuffix(prefix, "/")
+}
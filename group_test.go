@@ -0,0 +1,85 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestGroup(t *testing.T) {
+	var trace []string
+	mux := http.NewServeMux()
+	base := NewGroup(mux, "", tagMiddleware("base", &trace))
+	api := base.Group("/api/", tagMiddleware("api", &trace))
+	admin := base.Group("/admin", tagMiddleware("admin", &trace))
+
+	api.HandleFunc("GET /users/{id}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("user " + r.PathValue("id")))
+	})
+	api.With(tagMiddleware("auth", &trace)).HandleFunc("POST /users", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("created"))
+	})
+	admin.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("admin " + r.URL.Path))
+	})
+	base.HandleFunc("GET /{$}", func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("home"))
+	})
+
+	tests := []struct {
+		method, path string
+		code         int
+		body         string
+		trace        string
+	}{
+		{"GET", "/api/users/42", http.StatusOK, "user 42", "base,api"},
+		{"POST", "/api/users", http.StatusOK, "created", "base,api,auth"},
+		{"DELETE", "/api/users/42", http.StatusMethodNotAllowed, "", ""},
+		{"GET", "/admin/settings", http.StatusOK, "admin /admin/settings", "base,admin"},
+		{"GET", "/", http.StatusOK, "home", "base"},
+		{"GET", "/users/42", http.StatusNotFound, "", ""},
+	}
+	for _, test := range tests {
+		trace = nil
+		rec := httptest.NewRecorder()
+		mux.ServeHTTP(rec, newRequest(test.method, test.path))
+		if rec.Code != test.code {
+			t.Errorf("%s %s: wrong status: got %d want %d", test.method, test.path, rec.Code, test.code)
+			continue
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%s %s: wrong body: got %q want %q", test.method, test.path, rec.Body.String(), test.body)
+		}
+		if got := strings.Join(trace, ","); got != test.trace {
+			t.Errorf("%s %s: wrong middlewares: got %q want %q", test.method, test.path, got, test.trace)
+		}
+	}
+}
+
+func TestGroupPattern(t *testing.T) {
+	g := NewGroup(nil, "/api").Group("/v1")
+	if g.Prefix() != "/api/v1" {
+		t.Fatalf("wrong prefix: %q", g.Prefix())
+	}
+	for pattern, want := range map[string]string{
+		"/":                     "/api/v1/",
+		"/users":                "/api/v1/users",
+		"GET /users/{id}":       "GET /api/v1/users/{id}",
+		"GET example.com/users": "GET example.com/api/v1/users",
+		"example.com/":          "example.com/api/v1/",
+	} {
+		if got := g.pattern(pattern); got != want {
+			t.Errorf("%q: got %q want %q", pattern, got, want)
+		}
+	}
+}
+
+func TestGroupInvalidPrefix(t *testing.T) {
+	defer func() {
+		if recover() == nil {
+			t.Fatal("no panic for a relative prefix")
+		}
+	}()
+	NewGroup(http.NewServeMux(), "api")
+}
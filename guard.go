@@ -0,0 +1,208 @@
+package handlers
+
+import (
+	"crypto/subtle"
+	"fmt"
+	"net"
+	"net/http"
+	"strings"
+)
+
+// GuardOption represents a functional option for configuring the access
+// guard protecting the introspection handlers of this package, such as
+// StatsHandler.
+type GuardOption func(*guard) error
+
+// guard restricts access to a handler by client IP address and/or HTTP Basic
+// Authentication credentials. When no rule is configured only loopback
+// clients are allowed.
+type guard struct {
+	h          http.Handler
+	networks   []*net.IPNet
+	allowlist  bool
+	username   string
+	password   string
+	realm      string
+	authorizer func(*http.Request) bool
+	disabled   bool
+}
+
+func newGuard(h http.Handler, opts ...GuardOption) *guard {
+	g := &guard{h: h, realm: "Restricted"}
+	for _, option := range opts {
+		option(g)
+	}
+	return g
+}
+
+// Guard is HTTP middleware restricting access to the wrapped handler by client
+// IP address and/or HTTP Basic Authentication credentials, as configured by
+// the given options. Without any option only loopback clients are allowed.
+//
+// It is used by the introspection handlers of this package, such as
+// StatsHandler, and can protect any other debugging endpoint.
+func Guard(opts ...GuardOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return newGuard(h, opts...)
+	}
+}
+
+// NewGuard is like Guard, but returns an error if an option is invalid, such
+// as an allowed IP range which can't be parsed.
+func NewGuard(opts ...GuardOption) (func(http.Handler) http.Handler, error) {
+	g := &guard{}
+	for _, option := range opts {
+		if err := option(g); err != nil {
+			return nil, err
+		}
+	}
+	return Guard(opts...), nil
+}
+
+// GuardAllowedIPs restricts access to clients whose IP address, as seen in
+// r.RemoteAddr, is within one of the given CIDR ranges. Plain IP addresses
+// are accepted as single-host ranges. Invalid entries are skipped by Guard,
+// and reported by NewGuard; if none is valid, every client is denied.
+//
+// Combine with ProxyHeaders when running behind a reverse proxy.
+func GuardAllowedIPs(cidrs []string) GuardOption {
+	return func(g *guard) error {
+		g.allowlist = g.allowlist || len(cidrs) > 0
+		var firstErr error
+		for _, v := range cidrs {
+			n, err := parseCIDR(v)
+			if err != nil {
+				if firstErr == nil {
+					firstErr = err
+				}
+				continue
+			}
+			g.networks = append(g.networks, n)
+		}
+		return firstErr
+	}
+}
+
+// GuardBasicAuth requires clients to present the given HTTP Basic
+// Authentication credentials.
+func GuardBasicAuth(username, password string) GuardOption {
+	return func(g *guard) error {
+		g.username = username
+		g.password = password
+		return nil
+	}
+}
+
+// GuardAuthorizer sets a function deciding whether a request may access the
+// guarded handler. It is consulted in addition to the IP and Basic
+// Authentication rules.
+func GuardAuthorizer(fn func(*http.Request) bool) GuardOption {
+	return func(g *guard) error {
+		g.authorizer = fn
+		return nil
+	}
+}
+
+// GuardEnabled toggles the guarded handler. A disabled handler responds to
+// every request with 404 Not Found, as if it was not mounted at all.
+func GuardEnabled(enabled bool) GuardOption {
+	return func(g *guard) error {
+		g.disabled = !enabled
+		return nil
+	}
+}
+
+func (g *guard) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("guard", w, r)
+	defer end()
+
+	if g.disabled {
+		http.NotFound(w, r)
+		return
+	}
+
+	if !g.isIPAllowed(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	if g.username != "" || g.password != "" {
+		user, pass, ok := r.BasicAuth()
+		if !ok || !secureCompare(user, g.username) || !secureCompare(pass, g.password) {
+			w.Header().Set("WWW-Authenticate", fmt.Sprintf("Basic realm=%q", g.realm))
+			http.Error(w, http.StatusText(http.StatusUnauthorized), http.StatusUnauthorized)
+			return
+		}
+	}
+
+	if g.authorizer != nil && !g.authorizer(r) {
+		http.Error(w, http.StatusText(http.StatusForbidden), http.StatusForbidden)
+		return
+	}
+
+	g.h.ServeHTTP(w, r)
+}
+
+func (g *guard) isIPAllowed(r *http.Request) bool {
+	ip := remoteIP(r)
+
+	if len(g.networks) == 0 {
+		if g.allowlist {
+			// None of the allowed ranges could be parsed.
+			return false
+		}
+		// Without explicit rules, only local clients are trusted unless
+		// another form of authentication has been configured.
+		if g.username != "" || g.password != "" || g.authorizer != nil {
+			return true
+		}
+		return ip != nil && ip.IsLoopback()
+	}
+
+	if ip == nil {
+		return false
+	}
+	for _, n := range g.networks {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+// remoteIP returns the IP address of the client from r.RemoteAddr, or nil if
+// it cannot be parsed.
+func remoteIP(r *http.Request) net.IP {
+	host, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		host = r.RemoteAddr
+	}
+	return net.ParseIP(strings.Trim(host, "[]"))
+}
+
+// parseCIDR parses s as a CIDR range, accepting plain IP addresses as
+// single-host ranges.
+func parseCIDR(s string) (*net.IPNet, error) {
+	s = strings.TrimSpace(s)
+	if !strings.Contains(s, "/") {
+		ip := net.ParseIP(s)
+		if ip == nil {
+			return nil, fmt.Errorf("handlers: invalid IP address %q", s)
+		}
+		bits := 8 * net.IPv4len
+		if ip.To4() == nil {
+			bits = 8 * net.IPv6len
+		}
+		s = fmt.Sprintf("%s/%d", s, bits)
+	}
+	_, n, err := net.ParseCIDR(s)
+	if err != nil {
+		return nil, fmt.Errorf("handlers: invalid CIDR range %q: %v", s, err)
+	}
+	return n, nil
+}
+
+// secureCompare compares two strings in constant time.
+func secureCompare(given, actual string) bool {
+	return subtle.ConstantTimeCompare([]byte(given), []byte(actual)) == 1
+}
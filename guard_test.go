@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestGuard(t *testing.T) {
+	tests := []struct {
+		name       string
+		opts       []GuardOption
+		remoteAddr string
+		user, pass string
+		code       int
+	}{
+		{"default loopback", nil, "127.0.0.1:1234", "", "", http.StatusOK},
+		{"default remote", nil, "192.0.2.1:1234", "", "", http.StatusForbidden},
+		{"allowed ip", []GuardOption{GuardAllowedIPs([]string{"192.0.2.0/24"})}, "192.0.2.1:1234", "", "", http.StatusOK},
+		{"allowed single ip", []GuardOption{GuardAllowedIPs([]string{"2001:db8::1"})}, "[2001:db8::1]:1234", "", "", http.StatusOK},
+		{"denied ip", []GuardOption{GuardAllowedIPs([]string{"192.0.2.0/24"})}, "198.51.100.1:1234", "", "", http.StatusForbidden},
+		{"invalid allowed ips", []GuardOption{GuardAllowedIPs([]string{"192.0.2.0/33"}), GuardBasicAuth("ops", "secret")}, "192.0.2.1:1234", "ops", "secret", http.StatusForbidden},
+		{"basic auth ok", []GuardOption{GuardBasicAuth("ops", "secret")}, "192.0.2.1:1234", "ops", "secret", http.StatusOK},
+		{"basic auth bad", []GuardOption{GuardBasicAuth("ops", "secret")}, "192.0.2.1:1234", "ops", "wrong", http.StatusUnauthorized},
+		{"authorizer", []GuardOption{GuardAuthorizer(func(*http.Request) bool { return false })}, "127.0.0.1:1234", "", "", http.StatusForbidden},
+		{"disabled", []GuardOption{GuardEnabled(false)}, "127.0.0.1:1234", "", "", http.StatusNotFound},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRequest("GET", "/")
+			r.RemoteAddr = test.remoteAddr
+			if test.user != "" {
+				r.SetBasicAuth(test.user, test.pass)
+			}
+			rec := httptest.NewRecorder()
+			newGuard(okHandler, test.opts...).ServeHTTP(rec, r)
+			if rec.Code != test.code {
+				t.Fatalf("bad status: got %d want %d", rec.Code, test.code)
+			}
+			if test.code == http.StatusUnauthorized && rec.Header().Get("WWW-Authenticate") == "" {
+				t.Fatal("missing WWW-Authenticate header")
+			}
+		})
+	}
+}
+
+func TestNewGuard(t *testing.T) {
+	if _, err := NewGuard(GuardAllowedIPs([]string{"192.0.2.0/24", "example.com"})); err == nil {
+		t.Fatal("no error for an invalid allowed IP range")
+	}
+	if _, err := NewGuard(GuardAllowedIPs([]string{"192.0.2.0/24"}), GuardBasicAuth("ops", "secret")); err != nil {
+		t.Fatal(err)
+	}
+}
@@ -7,10 +7,13 @@ package handlers
 import (
 	"bufio"
 	"fmt"
+	"io"
 	"net"
 	"net/http"
 	"sort"
 	"strings"
+
+	"github.com/felixge/httpsnoop"
 )
 
 // MethodHandler is an http.Handler that dispatches to a handler whose key in the
@@ -37,7 +40,7 @@ func (h MethodHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		w.Header().Set("Allow", strings.Join(allow, ", "))
 		if req.Method == "OPTIONS" {
 			w.WriteHeader(http.StatusOK)
-		} else {
+		} else if !writeProblem(w, req, http.StatusMethodNotAllowed, "") {
 			http.Error(w, "Method not allowed", http.StatusMethodNotAllowed)
 		}
 	}
@@ -46,9 +49,10 @@ func (h MethodHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 // responseLogger is wrapper of http.ResponseWriter that keeps track of its HTTP
 // status code and body size
 type responseLogger struct {
-	w      http.ResponseWriter
-	status int
-	size   int
+	w           http.ResponseWriter
+	status      int
+	size        int
+	wroteHeader bool
 }
 
 func (l *responseLogger) Write(b []byte) (int, error) {
@@ -59,7 +63,12 @@ func (l *responseLogger) Write(b []byte) (int, error) {
 
 func (l *responseLogger) WriteHeader(s int) {
 	l.w.WriteHeader(s)
+	if s < 200 && s != http.StatusSwitchingProtocols {
+		// Interim responses, such as 103 Early Hints, precede the final one.
+		return
+	}
 	l.status = s
+	l.wroteHeader = true
 }
 
 func (l *responseLogger) Status() int {
@@ -72,7 +81,7 @@ func (l *responseLogger) Size() int {
 
 func (l *responseLogger) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	conn, rw, err := l.w.(http.Hijacker).Hijack()
-	if err == nil && l.status == 0 {
+	if err == nil && !l.wroteHeader {
 		// The status will be StatusSwitchingProtocols if there was no error and
 		// WriteHeader has not been called yet
 		l.status = http.StatusSwitchingProtocols
@@ -80,6 +89,52 @@ func (l *responseLogger) Hijack() (net.Conn, *bufio.ReadWriter, error) {
 	return conn, rw, err
 }
 
+// IsUpgradeRequest reports whether r asks to switch to another protocol, e.g.
+// a WebSocket, or is a CONNECT request. The handlers of such requests usually
+// hijack the connection, so the middlewares of this package which buffer or
+// rewrite responses step aside for them.
+func IsUpgradeRequest(r *http.Request) bool {
+	if r.Method == "CONNECT" {
+		return true
+	}
+	if r.Header.Get("Upgrade") == "" {
+		return false
+	}
+	for _, v := range r.Header.Values("Connection") {
+		for _, token := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(token), "upgrade") {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// IsRPCRequest reports whether r is a gRPC, gRPC-Web or Connect streaming
+// call, going by its content type: application/grpc, application/grpc-web,
+// application/grpc-web-text or application/connect, with any +codec suffix.
+// Their responses are streamed as frames, possibly followed by trailers, so
+// the middlewares of this package which buffer, rewrite, compress or cache
+// responses step aside for them too. Connect unary calls are plain HTTP
+// requests, and aren't reported.
+func IsRPCRequest(r *http.Request) bool {
+	ct := r.Header.Get("Content-Type")
+	if i := strings.IndexAny(ct, ";+"); i >= 0 {
+		ct = ct[:i]
+	}
+	switch strings.ToLower(strings.TrimSpace(ct)) {
+	case "application/grpc", "application/grpc-web", "application/grpc-web-text", "application/connect":
+		return true
+	}
+	return false
+}
+
+// isStreamingRequest reports whether the response to r must be passed on as
+// the handler writes it, unbuffered and unmodified.
+func isStreamingRequest(r *http.Request) bool {
+	return IsUpgradeRequest(r) || IsRPCRequest(r)
+}
+
 // isContentType validates the Content-Type header matches the supplied
 // contentType. That is, its type and subtype match.
 func isContentType(h http.Header, contentType string) bool {
@@ -97,6 +152,9 @@ func isContentType(h http.Header, contentType string) bool {
 // Only PUT, POST, and PATCH requests are considered.
 func ContentTypeHandler(h http.Handler, contentTypes ...string) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("content_type", w, r)
+		defer end()
+
 		if !(r.Method == "PUT" || r.Method == "POST" || r.Method == "PATCH") {
 			h.ServeHTTP(w, r)
 			return
@@ -108,7 +166,10 @@ func ContentTypeHandler(h http.Handler, contentTypes ...string) http.Handler {
 				return
 			}
 		}
-		http.Error(w, fmt.Sprintf("Unsupported content type %q; expected one of %q", r.Header.Get("Content-Type"), contentTypes), http.StatusUnsupportedMediaType)
+		msg := fmt.Sprintf("Unsupported content type %q; expected one of %q", r.Header.Get("Content-Type"), contentTypes)
+		if !writeProblem(w, r, http.StatusUnsupportedMediaType, msg) {
+			http.Error(w, msg, http.StatusUnsupportedMediaType)
+		}
 	})
 }
 
@@ -133,6 +194,9 @@ const (
 // Form method takes precedence over header method.
 func HTTPMethodOverrideHandler(h http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("method_override", w, r)
+		defer end()
+
 		if r.Method == "POST" {
 			om := r.FormValue(HTTPMethodOverrideFormKey)
 			if om == "" {
@@ -145,3 +209,48 @@ func HTTPMethodOverrideHandler(h http.Handler) http.Handler {
 		h.ServeHTTP(w, r)
 	})
 }
+
+// beforeWriteHeader wraps w so that fn is called exactly once, right before
+// the response headers are sent, with the status code of the response.
+// Interim (1xx) responses other than 101 Switching Protocols don't trigger
+// it. Callers must call the returned finish function once the handler
+// returned, which invokes fn if the handler didn't write anything.
+func beforeWriteHeader(w http.ResponseWriter, fn func(status int)) (http.ResponseWriter, func()) {
+	called := false
+	call := func(status int) {
+		if !called {
+			called = true
+			fn(status)
+		}
+	}
+
+	ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if code >= 200 || code == http.StatusSwitchingProtocols {
+					call(code)
+				}
+				next(code)
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				call(http.StatusOK)
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				call(http.StatusOK)
+				return next(src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				call(http.StatusOK)
+				next()
+			}
+		},
+	})
+	return ww, func() { call(http.StatusOK) }
+}
@@ -70,6 +70,55 @@ func TestMethodHandler(t *testing.T) {
 	}
 }
 
+func TestIsUpgradeRequest(t *testing.T) {
+	tests := []struct {
+		method     string
+		connection string
+		upgrade    string
+		want       bool
+	}{
+		{"GET", "Upgrade", "websocket", true},
+		{"GET", "keep-alive, upgrade", "websocket", true},
+		{"GET", "keep-alive", "websocket", false},
+		{"GET", "Upgrade", "", false},
+		{"GET", "", "", false},
+		{"CONNECT", "", "", true},
+	}
+	for _, test := range tests {
+		r := newRequest(test.method, "/")
+		r.Header.Set("Connection", test.connection)
+		r.Header.Set("Upgrade", test.upgrade)
+		if got := IsUpgradeRequest(r); got != test.want {
+			t.Errorf("%s Connection: %q Upgrade: %q: got %v want %v", test.method, test.connection, test.upgrade, got, test.want)
+		}
+	}
+}
+
+func TestIsRPCRequest(t *testing.T) {
+	tests := []struct {
+		contentType string
+		want        bool
+	}{
+		{"application/grpc", true},
+		{"application/grpc+proto", true},
+		{"application/grpc-web+proto", true},
+		{"Application/gRPC-Web-Text", true},
+		{"application/connect+json", true},
+		{"application/connect+proto; charset=utf-8", true},
+		{"application/json", false},
+		{"application/proto", false},
+		{"application/grpcx", false},
+		{"", false},
+	}
+	for _, test := range tests {
+		r := newRequest("POST", "/")
+		r.Header.Set("Content-Type", test.contentType)
+		if got := IsRPCRequest(r); got != test.want {
+			t.Errorf("Content-Type: %q: got %v want %v", test.contentType, got, test.want)
+		}
+	}
+}
+
 func TestContentTypeHandler(t *testing.T) {
 	tests := []struct {
 		Method            string
@@ -0,0 +1,45 @@
+package handlerstest
+
+import (
+	"sync"
+	"time"
+)
+
+// Clock is a fake clock for time-dependent tests, e.g. of cache expiration or
+// of LogFormatterParams timestamps. Its Now method can be passed wherever a
+// func() time.Time is expected. It is safe for concurrent use.
+type Clock struct {
+	mu  sync.Mutex
+	now time.Time
+}
+
+// NewClock returns a Clock set to t.
+func NewClock(t time.Time) *Clock {
+	return &Clock{now: t}
+}
+
+// Now returns the current time of the clock.
+func (c *Clock) Now() time.Time {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	return c.now
+}
+
+// Advance moves the clock forward by d.
+func (c *Clock) Advance(d time.Duration) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = c.now.Add(d)
+}
+
+// Set sets the clock to t.
+func (c *Clock) Set(t time.Time) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.now = t
+}
+
+// Since returns the time elapsed since t according to the clock.
+func (c *Clock) Since(t time.Time) time.Duration {
+	return c.Now().Sub(t)
+}
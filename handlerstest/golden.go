@@ -0,0 +1,49 @@
+package handlerstest
+
+import (
+	"bytes"
+	"io/ioutil"
+	"os"
+	"path/filepath"
+	"regexp"
+	"testing"
+)
+
+// UpdateGoldenEnv is the environment variable which, set to a non-empty
+// value, makes Golden write the golden files instead of comparing them.
+const UpdateGoldenEnv = "UPDATE_GOLDEN"
+
+// logTimestamp matches the timestamps of the Apache Common and Combined Log
+// Formats written by handlers.LoggingHandler.
+var logTimestamp = regexp.MustCompile(`\[\d{2}/[A-Z][a-z]{2}/\d{4}:\d{2}:\d{2}:\d{2} [+-]\d{4}\]`)
+
+// Golden compares got with the content of testdata/name.golden, and reports
+// differences with t.Errorf. With UPDATE_GOLDEN=1 in the environment, it
+// writes got to the file instead.
+func Golden(t testing.TB, name string, got []byte) {
+	t.Helper()
+	path := filepath.Join("testdata", name+".golden")
+	if os.Getenv(UpdateGoldenEnv) != "" {
+		if err := os.MkdirAll(filepath.Dir(path), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(path, got, 0644); err != nil {
+			t.Fatal(err)
+		}
+		return
+	}
+	want, err := ioutil.ReadFile(path)
+	if err != nil {
+		t.Fatalf("reading golden file (run with %s=1 to create it): %v", UpdateGoldenEnv, err)
+	}
+	if !bytes.Equal(got, want) {
+		t.Errorf("output differs from %s:\ngot:\n%s\nwant:\n%s", path, got, want)
+	}
+}
+
+// NormalizeLogTimestamps replaces the timestamps of the access log lines
+// written by handlers.LoggingHandler and handlers.CombinedLoggingHandler with
+// a fixed one, so that the logs can be compared with Golden.
+func NormalizeLogTimestamps(log []byte) []byte {
+	return logTimestamp.ReplaceAll(log, []byte("[01/Jan/2000:00:00:00 +0000]"))
+}
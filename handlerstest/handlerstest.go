@@ -0,0 +1,37 @@
+// Package handlerstest provides utilities for testing the middlewares of the
+// handlers package, and handlers using them: request builders, a response
+// recorder with assertions, a fake clock and golden files.
+package handlerstest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+)
+
+// NewPreflightRequest returns a CORS preflight request for target, as sent
+// by browsers before a request with the given method and headers from
+// origin.
+//
+// Example:
+//
+//	r := handlerstest.NewPreflightRequest("/api/users", "https://example.com", "PUT", "Content-Type")
+//	rec := handlerstest.NewRecorder()
+//	handlers.CORS(handlers.AllowedMethods([]string{"PUT"}))(h).ServeHTTP(rec, r)
+//	rec.AssertHeader(t, "Access-Control-Allow-Methods", "PUT")
+func NewPreflightRequest(target, origin, method string, headers ...string) *http.Request {
+	r := httptest.NewRequest("OPTIONS", target, nil)
+	r.Header.Set("Origin", origin)
+	r.Header.Set("Access-Control-Request-Method", method)
+	if len(headers) > 0 {
+		r.Header.Set("Access-Control-Request-Headers", strings.Join(headers, ","))
+	}
+	return r
+}
+
+// NewCORSRequest returns a cross-origin request for target from origin.
+func NewCORSRequest(method, target, origin string) *http.Request {
+	r := httptest.NewRequest(method, target, nil)
+	r.Header.Set("Origin", origin)
+	return r
+}
@@ -0,0 +1,92 @@
+package handlerstest
+
+import (
+	"bytes"
+	"net/http"
+	"testing"
+	"time"
+
+	"github.com/stockholmr/handlers"
+)
+
+func TestPreflight(t *testing.T) {
+	h := handlers.CORS(
+		handlers.AllowedOrigins([]string{"https://example.com"}),
+		handlers.AllowedMethods([]string{"PUT"}),
+		handlers.AllowedHeaders([]string{"Content-Type"}),
+	)(http.NotFoundHandler())
+
+	rec := NewRecorder()
+	h.ServeHTTP(rec, NewPreflightRequest("/api", "https://example.com", "PUT", "Content-Type"))
+	rec.AssertStatus(t, http.StatusOK)
+	rec.AssertHeader(t, "Access-Control-Allow-Origin", "https://example.com")
+	rec.AssertHeader(t, "access-control-allow-methods", "PUT")
+	rec.AssertHeader(t, "Access-Control-Allow-Headers", "Content-Type")
+
+	rec = NewRecorder()
+	h.ServeHTTP(rec, NewCORSRequest("GET", "/api", "https://evil.example.com"))
+	rec.AssertNoHeader(t, "Access-Control-Allow-Origin")
+}
+
+func TestRecorderFlush(t *testing.T) {
+	rec := NewRecorder()
+	h := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("a"))
+		w.(http.Flusher).Flush()
+		w.Write([]byte("b"))
+		w.(http.Flusher).Flush()
+	})
+	h.ServeHTTP(rec, NewCORSRequest("GET", "/", "https://example.com"))
+	rec.AssertFlushed(t, 2)
+	rec.AssertBody(t, "ab")
+
+	rec = NewRecorder()
+	handlers.CompressHandler(h).ServeHTTP(rec, NewCORSRequest("GET", "/", "https://example.com"))
+	rec.AssertVary(t, "accept-encoding")
+}
+
+func TestRecorderFailures(t *testing.T) {
+	ft := &fakeT{TB: t}
+	rec := NewRecorder()
+	rec.WriteHeader(http.StatusNotFound)
+	rec.AssertStatus(ft, http.StatusOK)
+	rec.AssertHeader(ft, "X-Missing", "v")
+	rec.AssertFlushed(ft, 1)
+	if ft.errors != 3 {
+		t.Fatalf("got %d failures, want 3", ft.errors)
+	}
+}
+
+type fakeT struct {
+	testing.TB
+	errors int
+}
+
+func (f *fakeT) Helper()                       {}
+func (f *fakeT) Errorf(string, ...interface{}) { f.errors++ }
+
+func TestClock(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	c := NewClock(start)
+	c.Advance(time.Minute)
+	if c.Since(start) != time.Minute {
+		t.Fatalf("got %v", c.Since(start))
+	}
+	c.Set(start)
+	if !c.Now().Equal(start) {
+		t.Fatalf("got %v", c.Now())
+	}
+}
+
+func TestGoldenLog(t *testing.T) {
+	var buf bytes.Buffer
+	h := handlers.CombinedLoggingHandler(&buf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte("hello"))
+	}))
+	r := NewCORSRequest("GET", "/path?q=1", "https://example.com")
+	r.RemoteAddr = "192.0.2.1:1234"
+	r.Header.Set("User-Agent", "test")
+	h.ServeHTTP(NewRecorder(), r)
+
+	Golden(t, "combined_log", NormalizeLogTimestamps(buf.Bytes()))
+}
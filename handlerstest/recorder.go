@@ -0,0 +1,83 @@
+package handlerstest
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// Recorder is a httptest.ResponseRecorder with assertion methods, which
+// report failures with t.Errorf.
+type Recorder struct {
+	*httptest.ResponseRecorder
+
+	// Flushes is the number of times the response was flushed.
+	Flushes int
+}
+
+// NewRecorder returns an initialized Recorder.
+func NewRecorder() *Recorder {
+	return &Recorder{ResponseRecorder: httptest.NewRecorder()}
+}
+
+// Flush counts the flushes of the response.
+func (rec *Recorder) Flush() {
+	rec.Flushes++
+	rec.ResponseRecorder.Flush()
+}
+
+// AssertStatus checks the status code of the response.
+func (rec *Recorder) AssertStatus(t testing.TB, code int) {
+	t.Helper()
+	if rec.Code != code {
+		t.Errorf("wrong status code: got %d want %d", rec.Code, code)
+	}
+}
+
+// AssertHeader checks the value of a response header.
+func (rec *Recorder) AssertHeader(t testing.TB, name, value string) {
+	t.Helper()
+	if got, ok := rec.Header()[http.CanonicalHeaderKey(name)]; !ok {
+		t.Errorf("missing %s header, want %q", name, value)
+	} else if strings.Join(got, ", ") != value {
+		t.Errorf("wrong %s header: got %q want %q", name, strings.Join(got, ", "), value)
+	}
+}
+
+// AssertNoHeader checks that a response header is absent.
+func (rec *Recorder) AssertNoHeader(t testing.TB, name string) {
+	t.Helper()
+	if got, ok := rec.Header()[http.CanonicalHeaderKey(name)]; ok {
+		t.Errorf("unexpected %s header: %q", name, strings.Join(got, ", "))
+	}
+}
+
+// AssertVary checks that the Vary header of the response lists value.
+func (rec *Recorder) AssertVary(t testing.TB, value string) {
+	t.Helper()
+	for _, v := range rec.Header().Values("Vary") {
+		for _, field := range strings.Split(v, ",") {
+			if strings.EqualFold(strings.TrimSpace(field), value) {
+				return
+			}
+		}
+	}
+	t.Errorf("Vary header %q doesn't list %s", rec.Header().Values("Vary"), value)
+}
+
+// AssertBody checks the body of the response.
+func (rec *Recorder) AssertBody(t testing.TB, body string) {
+	t.Helper()
+	if got := rec.Body.String(); got != body {
+		t.Errorf("wrong body: got %q want %q", got, body)
+	}
+}
+
+// AssertFlushed checks that the response was flushed at least n times.
+func (rec *Recorder) AssertFlushed(t testing.TB, n int) {
+	t.Helper()
+	if rec.Flushes < n {
+		t.Errorf("response flushed %d times, want at least %d", rec.Flushes, n)
+	}
+}
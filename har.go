@@ -0,0 +1,441 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+)
+
+const (
+	defaultHARRingSize    = 100
+	defaultHARMaxBodySize = 64 << 10
+	harRedacted           = "[REDACTED]"
+)
+
+var defaultHARRedactedHeaders = []string{"Authorization", "Cookie", "Proxy-Authorization", "Set-Cookie"}
+
+// HAR is a HTTP Archive (HAR 1.2) document.
+type HAR struct {
+	Log HARLog `json:"log"`
+}
+
+// HARLog is the root object of a HAR document.
+type HARLog struct {
+	Version string     `json:"version"`
+	Creator HARCreator `json:"creator"`
+	Entries []HAREntry `json:"entries"`
+}
+
+// HARCreator identifies the application which created a HAR document.
+type HARCreator struct {
+	Name    string `json:"name"`
+	Version string `json:"version"`
+}
+
+// HAREntry is a single recorded request/response pair.
+type HAREntry struct {
+	StartedDateTime time.Time   `json:"startedDateTime"`
+	Time            float64     `json:"time"`
+	Request         HARRequest  `json:"request"`
+	Response        HARResponse `json:"response"`
+	Cache           struct{}    `json:"cache"`
+	Timings         HARTimings  `json:"timings"`
+	Comment         string      `json:"comment,omitempty"`
+}
+
+// HARRequest is the request part of a HAR entry.
+type HARRequest struct {
+	Method      string         `json:"method"`
+	URL         string         `json:"url"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	QueryString []HARNameValue `json:"queryString"`
+	PostData    *HARPostData   `json:"postData,omitempty"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARResponse is the response part of a HAR entry.
+type HARResponse struct {
+	Status      int            `json:"status"`
+	StatusText  string         `json:"statusText"`
+	HTTPVersion string         `json:"httpVersion"`
+	Cookies     []HARNameValue `json:"cookies"`
+	Headers     []HARNameValue `json:"headers"`
+	Content     HARContent     `json:"content"`
+	RedirectURL string         `json:"redirectURL"`
+	HeadersSize int            `json:"headersSize"`
+	BodySize    int64          `json:"bodySize"`
+}
+
+// HARNameValue is a header, cookie or query string parameter.
+type HARNameValue struct {
+	Name  string `json:"name"`
+	Value string `json:"value"`
+}
+
+// HARPostData describes a request body.
+type HARPostData struct {
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text"`
+}
+
+// HARContent describes a response body.
+type HARContent struct {
+	Size     int64  `json:"size"`
+	MimeType string `json:"mimeType"`
+	Text     string `json:"text,omitempty"`
+	Comment  string `json:"comment,omitempty"`
+}
+
+// HARTimings holds the timings of a HAR entry, in milliseconds. Only the time
+// spent in the handler is known, which is reported as wait time.
+type HARTimings struct {
+	Send    float64 `json:"send"`
+	Wait    float64 `json:"wait"`
+	Receive float64 `json:"receive"`
+}
+
+// HAROption represents a functional option for configuring a HARRecorder.
+type HAROption func(*HARRecorder) error
+
+// HARRecorder captures request/response pairs in HTTP Archive format, for
+// reproducing client issues in browsers' developer tools or HAR viewers.
+// Entries are kept in an in-memory ring buffer and optionally written to a
+// directory, one file per entry.
+//
+// Recording can be switched on and off at runtime with Enable; a disabled
+// recorder only costs an atomic load per request.
+type HARRecorder struct {
+	enabled int32
+	maxBody int
+	dir     string
+	redact  map[string]bool
+
+	mu      sync.Mutex
+	ring    []HAREntry
+	next    int
+	full    bool
+	counter uint64
+}
+
+// NewHARRecorder returns a new, disabled HARRecorder.
+func NewHARRecorder(opts ...HAROption) *HARRecorder {
+	hr := &HARRecorder{
+		maxBody: defaultHARMaxBodySize,
+		ring:    make([]HAREntry, defaultHARRingSize),
+		redact:  map[string]bool{},
+	}
+	for _, h := range defaultHARRedactedHeaders {
+		hr.redact[h] = true
+	}
+	for _, option := range opts {
+		option(hr)
+	}
+	return hr
+}
+
+// HARRingSize sets the number of entries kept in memory. The default is 100.
+func HARRingSize(n int) HAROption {
+	return func(hr *HARRecorder) error {
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid HAR ring size %d", n)
+		}
+		hr.ring = make([]HAREntry, n)
+		return nil
+	}
+}
+
+// HARMaxBodySize sets the maximum number of bytes of request and response
+// bodies captured in each entry. Bodies are truncated beyond this size. The
+// default is 64KiB.
+func HARMaxBodySize(n int) HAROption {
+	return func(hr *HARRecorder) error {
+		hr.maxBody = n
+		return nil
+	}
+}
+
+// HARDirectory makes the recorder write every entry as a separate HAR file in
+// dir, in addition to keeping it in memory.
+func HARDirectory(dir string) HAROption {
+	return func(hr *HARRecorder) error {
+		hr.dir = dir
+		return nil
+	}
+}
+
+// HARRedactHeaders adds headers whose values are replaced by a placeholder in
+// recorded entries. Authorization, Cookie, Proxy-Authorization and Set-Cookie
+// are always redacted.
+func HARRedactHeaders(headers []string) HAROption {
+	return func(hr *HARRecorder) error {
+		for _, h := range headers {
+			hr.redact[http.CanonicalHeaderKey(h)] = true
+		}
+		return nil
+	}
+}
+
+// Enable switches recording on or off.
+func (hr *HARRecorder) Enable(enabled bool) {
+	var v int32
+	if enabled {
+		v = 1
+	}
+	atomic.StoreInt32(&hr.enabled, v)
+}
+
+// Enabled reports whether the recorder is recording.
+func (hr *HARRecorder) Enabled() bool {
+	return atomic.LoadInt32(&hr.enabled) == 1
+}
+
+// Entries returns the entries currently held in memory, oldest first.
+func (hr *HARRecorder) Entries() []HAREntry {
+	hr.mu.Lock()
+	defer hr.mu.Unlock()
+
+	if !hr.full {
+		return append([]HAREntry(nil), hr.ring[:hr.next]...)
+	}
+	entries := make([]HAREntry, 0, len(hr.ring))
+	entries = append(entries, hr.ring[hr.next:]...)
+	return append(entries, hr.ring[:hr.next]...)
+}
+
+// Reset discards the entries held in memory.
+func (hr *HARRecorder) Reset() {
+	hr.mu.Lock()
+	hr.next = 0
+	hr.full = false
+	for i := range hr.ring {
+		hr.ring[i] = HAREntry{}
+	}
+	hr.mu.Unlock()
+}
+
+// ServeHTTP serves the entries held in memory as a HAR document.
+func (hr *HARRecorder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Content-Disposition", `attachment; filename="requests.har"`)
+	json.NewEncoder(w).Encode(newHAR(hr.Entries()))
+}
+
+// Handler returns HTTP middleware recording the requests served by h while
+// the recorder is enabled.
+//
+// Example:
+//
+//	recorder := handlers.NewHARRecorder(handlers.HARRedactHeaders([]string{"X-Api-Key"}))
+//	mux.Handle("/debug/har", handlers.Guard()(recorder))
+//	http.ListenAndServe(":1123", recorder.Handler(mux))
+func (hr *HARRecorder) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if !hr.Enabled() {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		w, r, end := beginRequestEvent("har", w, r)
+		defer end()
+
+		start := time.Now()
+		entry := HAREntry{StartedDateTime: start}
+		entry.Request = hr.harRequest(r)
+
+		var reqBody *cappedBuffer
+		if r.Body != nil && r.Body != http.NoBody {
+			reqBody = &cappedBuffer{max: hr.maxBody}
+			r.Body = &teeReadCloser{Reader: io.TeeReader(r.Body, reqBody), Closer: r.Body}
+		}
+
+		resBody := &cappedBuffer{max: hr.maxBody}
+		status := 0
+		sw := httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(code int) {
+					if status == 0 && (code < 100 || code >= 200 || code == http.StatusSwitchingProtocols) {
+						status = code
+					}
+					next(code)
+				}
+			},
+			Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+				return func(b []byte) (int, error) {
+					if status == 0 {
+						status = http.StatusOK
+					}
+					n, err := next(b)
+					resBody.Write(b[:n])
+					return n, err
+				}
+			},
+			ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+				return func(src io.Reader) (int64, error) {
+					if status == 0 {
+						status = http.StatusOK
+					}
+					return next(io.TeeReader(src, resBody))
+				}
+			},
+		})
+
+		h.ServeHTTP(sw, r)
+
+		if status == 0 {
+			status = http.StatusOK
+		}
+		elapsed := float64(time.Since(start)) / float64(time.Millisecond)
+		entry.Time = elapsed
+		entry.Timings.Wait = elapsed
+		entry.Comment = requestIDFor(w, r)
+
+		if reqBody != nil {
+			entry.Request.BodySize = reqBody.n
+			entry.Request.PostData = &HARPostData{
+				MimeType: r.Header.Get("Content-Type"),
+				Text:     reqBody.String(),
+			}
+		}
+
+		entry.Response = HARResponse{
+			Status:      status,
+			StatusText:  http.StatusText(status),
+			HTTPVersion: r.Proto,
+			Cookies:     []HARNameValue{},
+			Headers:     hr.harHeaders(w.Header()),
+			Content: HARContent{
+				Size:     resBody.n,
+				MimeType: w.Header().Get("Content-Type"),
+				Text:     resBody.String(),
+			},
+			RedirectURL: w.Header().Get("Location"),
+			HeadersSize: -1,
+			BodySize:    resBody.n,
+		}
+		if resBody.truncated() {
+			entry.Response.Content.Comment = fmt.Sprintf("truncated to %d bytes", hr.maxBody)
+		}
+
+		hr.add(entry)
+	})
+}
+
+func (hr *HARRecorder) harRequest(r *http.Request) HARRequest {
+	u := *r.URL
+	if u.Host == "" {
+		u.Host = r.Host
+	}
+	if u.Scheme == "" {
+		u.Scheme = "http"
+		if r.TLS != nil {
+			u.Scheme = "https"
+		}
+	}
+
+	query := []HARNameValue{}
+	for name, values := range r.URL.Query() {
+		for _, v := range values {
+			query = append(query, HARNameValue{Name: name, Value: v})
+		}
+	}
+
+	return HARRequest{
+		Method:      r.Method,
+		URL:         u.String(),
+		HTTPVersion: r.Proto,
+		Cookies:     []HARNameValue{},
+		Headers:     hr.harHeaders(r.Header),
+		QueryString: query,
+		HeadersSize: -1,
+	}
+}
+
+func (hr *HARRecorder) harHeaders(h http.Header) []HARNameValue {
+	headers := []HARNameValue{}
+	for name, values := range h {
+		for _, v := range values {
+			if hr.redact[name] {
+				v = harRedacted
+			}
+			headers = append(headers, HARNameValue{Name: name, Value: v})
+		}
+	}
+	return headers
+}
+
+func (hr *HARRecorder) add(entry HAREntry) {
+	hr.mu.Lock()
+	hr.ring[hr.next] = entry
+	hr.next = (hr.next + 1) % len(hr.ring)
+	if hr.next == 0 {
+		hr.full = true
+	}
+	hr.counter++
+	n := hr.counter
+	hr.mu.Unlock()
+
+	if hr.dir == "" {
+		return
+	}
+	name := fmt.Sprintf("%s-%06d.har", entry.StartedDateTime.UTC().Format("20060102T150405.000"), n)
+	if f, err := os.Create(filepath.Join(hr.dir, name)); err == nil {
+		json.NewEncoder(f).Encode(newHAR([]HAREntry{entry}))
+		f.Close()
+	}
+}
+
+func newHAR(entries []HAREntry) HAR {
+	if entries == nil {
+		entries = []HAREntry{}
+	}
+	return HAR{Log: HARLog{
+		Version: "1.2",
+		Creator: HARCreator{Name: "github.com/stockholmr/handlers", Version: "1"},
+		Entries: entries,
+	}}
+}
+
+// cappedBuffer stores up to max bytes written to it while counting all of
+// them.
+type cappedBuffer struct {
+	buf []byte
+	max int
+	n   int64
+}
+
+func (b *cappedBuffer) Write(p []byte) (int, error) {
+	b.n += int64(len(p))
+	if room := b.max - len(b.buf); room > 0 {
+		if len(p) > room {
+			b.buf = append(b.buf, p[:room]...)
+		} else {
+			b.buf = append(b.buf, p...)
+		}
+	}
+	return len(p), nil
+}
+
+func (b *cappedBuffer) truncated() bool {
+	return b.n > int64(len(b.buf))
+}
+
+func (b *cappedBuffer) String() string {
+	return string(b.buf)
+}
+
+// teeReadCloser combines a reader with the Closer of the original body.
+type teeReadCloser struct {
+	io.Reader
+	io.Closer
+}
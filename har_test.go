@@ -0,0 +1,112 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func harHeader(headers []HARNameValue, name string) string {
+	for _, h := range headers {
+		if h.Name == name {
+			return h.Value
+		}
+	}
+	return ""
+}
+
+func TestHARRecorder(t *testing.T) {
+	dir, err := ioutil.TempDir("", "har")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	recorder := NewHARRecorder(HARMaxBodySize(4), HARDirectory(dir))
+	handler := recorder.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := ioutil.ReadAll(r.Body)
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		w.Write(body)
+	}))
+
+	// Disabled recorders don't record anything.
+	handler.ServeHTTP(httptest.NewRecorder(), httptest.NewRequest("GET", "http://example.com/", nil))
+	if n := len(recorder.Entries()); n != 0 {
+		t.Fatalf("disabled recorder recorded %d entries", n)
+	}
+
+	recorder.Enable(true)
+	r := httptest.NewRequest("POST", "http://example.com/upload?a=1", strings.NewReader("hello world"))
+	r.Header.Set("Authorization", "Bearer secret")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	if got, want := rec.Body.String(), "hello world"; got != want {
+		t.Fatalf("bad response body: got %q want %q", got, want)
+	}
+
+	entries := recorder.Entries()
+	if len(entries) != 1 {
+		t.Fatalf("bad number of entries: got %d want 1", len(entries))
+	}
+	e := entries[0]
+	if e.Request.URL != "http://example.com/upload?a=1" || e.Request.Method != "POST" {
+		t.Fatalf("bad request: %+v", e.Request)
+	}
+	if got := harHeader(e.Request.Headers, "Authorization"); got != harRedacted {
+		t.Fatalf("Authorization header not redacted: %q", got)
+	}
+	if e.Request.PostData == nil || e.Request.PostData.Text != "hell" || e.Request.BodySize != 11 {
+		t.Fatalf("bad request body: %+v size %d", e.Request.PostData, e.Request.BodySize)
+	}
+	if e.Response.Status != http.StatusCreated || e.Response.Content.Text != "hell" || e.Response.Content.Size != 11 {
+		t.Fatalf("bad response: %+v", e.Response)
+	}
+	if e.Response.Content.Comment == "" {
+		t.Fatal("expected truncation comment")
+	}
+
+	files, _ := filepath.Glob(filepath.Join(dir, "*.har"))
+	if len(files) != 1 {
+		t.Fatalf("bad number of HAR files: got %d want 1", len(files))
+	}
+
+	rec = httptest.NewRecorder()
+	recorder.ServeHTTP(rec, newRequest("GET", "/debug/har"))
+	var har HAR
+	if err := json.Unmarshal(rec.Body.Bytes(), &har); err != nil {
+		t.Fatal(err)
+	}
+	if har.Log.Version != "1.2" || len(har.Log.Entries) != 1 {
+		t.Fatalf("bad HAR document: %+v", har.Log)
+	}
+}
+
+func TestHARRecorderRing(t *testing.T) {
+	recorder := NewHARRecorder(HARRingSize(2))
+	recorder.Enable(true)
+	handler := recorder.Handler(okHandler)
+
+	for _, path := range []string{"/a", "/b", "/c"} {
+		handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "http://example.com"+path))
+	}
+
+	entries := recorder.Entries()
+	if len(entries) != 2 {
+		t.Fatalf("bad number of entries: got %d want 2", len(entries))
+	}
+	if entries[0].Request.URL != "http://example.com/b" || entries[1].Request.URL != "http://example.com/c" {
+		t.Fatalf("bad entries order: %s, %s", entries[0].Request.URL, entries[1].Request.URL)
+	}
+
+	recorder.Reset()
+	if n := len(recorder.Entries()); n != 0 {
+		t.Fatalf("bad number of entries after reset: got %d want 0", n)
+	}
+}
@@ -0,0 +1,279 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// HealthChecker reports the health of a dependency. It should return
+// promptly once ctx is done.
+type HealthChecker func(ctx context.Context) error
+
+// HealthOption represents a functional option for configuring Health.
+type HealthOption func(*Health) error
+
+// Health is a registry of named health checks serving liveness and readiness
+// endpoints. Checks run concurrently, each bounded by its own timeout, and
+// their results are cached for the configured TTL so that frequent probes
+// don't overload the dependencies being checked.
+//
+// Calling Drain makes the readiness endpoint fail, so load balancers stop
+// routing new traffic to the instance while in-flight requests complete.
+// Shutdown does so before shutting the server down.
+type Health struct {
+	mu        sync.Mutex
+	liveness  []*healthCheck
+	readiness []*healthCheck
+	timeout   time.Duration
+	ttl       time.Duration
+	draining  int32
+}
+
+type healthCheck struct {
+	name    string
+	fn      HealthChecker
+	timeout time.Duration
+
+	mu      sync.Mutex
+	checked time.Time
+	result  HealthCheckResult
+}
+
+// HealthReport is the JSON document served by the health endpoints.
+type HealthReport struct {
+	Status string                       `json:"status"`
+	Checks map[string]HealthCheckResult `json:"checks,omitempty"`
+}
+
+// HealthCheckResult is the outcome of a single health check.
+type HealthCheckResult struct {
+	Status    string    `json:"status"`
+	Error     string    `json:"error,omitempty"`
+	Duration  string    `json:"duration"`
+	CheckedAt time.Time `json:"checked_at"`
+}
+
+const (
+	healthStatusOK       = "ok"
+	healthStatusFail     = "fail"
+	healthStatusDraining = "draining"
+
+	defaultHealthTimeout = 5 * time.Second
+)
+
+// NewHealth returns an empty health check registry. It returns an error if an
+// option is invalid.
+func NewHealth(opts ...HealthOption) (*Health, error) {
+	h := &Health{timeout: defaultHealthTimeout}
+	for _, option := range opts {
+		if err := option(h); err != nil {
+			return nil, err
+		}
+	}
+	return h, nil
+}
+
+// HealthTimeout sets the default timeout of checks registered without an
+// explicit one. The default is 5 seconds.
+func HealthTimeout(d time.Duration) HealthOption {
+	return func(h *Health) error {
+		if d <= 0 {
+			return fmt.Errorf("handlers: invalid health check timeout %v", d)
+		}
+		h.timeout = d
+		return nil
+	}
+}
+
+// HealthCacheTTL sets how long check results are reused before the check is
+// run again. By default checks run on every probe.
+func HealthCacheTTL(d time.Duration) HealthOption {
+	return func(h *Health) error {
+		if d < 0 {
+			return fmt.Errorf("handlers: invalid health check cache TTL %v", d)
+		}
+		h.ttl = d
+		return nil
+	}
+}
+
+// AddLivenessCheck registers a check reported by the liveness endpoint. Only
+// failures requiring a restart of the process should be reported here.
+//
+// A zero timeout uses the registry's default timeout.
+func (h *Health) AddLivenessCheck(name string, timeout time.Duration, fn HealthChecker) {
+	h.mu.Lock()
+	h.liveness = append(h.liveness, &healthCheck{name: name, fn: fn, timeout: timeout})
+	h.mu.Unlock()
+}
+
+// AddReadinessCheck registers a check reported by the readiness endpoint,
+// typically a dependency required to serve traffic such as a database.
+//
+// A zero timeout uses the registry's default timeout.
+func (h *Health) AddReadinessCheck(name string, timeout time.Duration, fn HealthChecker) {
+	h.mu.Lock()
+	h.readiness = append(h.readiness, &healthCheck{name: name, fn: fn, timeout: timeout})
+	h.mu.Unlock()
+}
+
+// Drain flags the instance as shutting down: from then on the readiness
+// endpoint responds with 503 Service Unavailable regardless of its checks.
+func (h *Health) Drain() {
+	atomic.StoreInt32(&h.draining, 1)
+}
+
+// Shutdown drains the instance and shuts srv down gracefully: it calls Drain,
+// waits for delay so that load balancers notice the failing readiness
+// endpoint and stop routing new requests to the instance, then calls
+// srv.Shutdown, which waits for the in-flight requests to complete. The
+// delay should exceed the probe interval of the load balancer times its
+// failure threshold. If ctx is done first, srv is shut down immediately.
+//
+// Example:
+//
+//	sig := make(chan os.Signal, 1)
+//	signal.Notify(sig, syscall.SIGTERM)
+//	<-sig
+//	ctx, cancel := context.WithTimeout(context.Background(), 30*time.Second)
+//	defer cancel()
+//	health.Shutdown(ctx, srv, 10*time.Second)
+func (h *Health) Shutdown(ctx context.Context, srv *http.Server, delay time.Duration) error {
+	h.Drain()
+	t := time.NewTimer(delay)
+	defer t.Stop()
+	select {
+	case <-t.C:
+	case <-ctx.Done():
+	}
+	return srv.Shutdown(ctx)
+}
+
+// Draining reports whether Drain has been called.
+func (h *Health) Draining() bool {
+	return atomic.LoadInt32(&h.draining) == 1
+}
+
+// LivenessHandler returns a http.Handler reporting the liveness checks. It
+// responds with 200 OK if all checks pass and 503 Service Unavailable
+// otherwise, with a JSON HealthReport detailing each check.
+func (h *Health) LivenessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("health", w, r)
+		defer end()
+
+		h.mu.Lock()
+		checks := h.liveness
+		h.mu.Unlock()
+
+		writeHealthReport(w, h.run(r.Context(), checks))
+	})
+}
+
+// ReadinessHandler returns a http.Handler reporting the readiness checks. It
+// behaves like LivenessHandler, and additionally fails once Drain has been
+// called.
+func (h *Health) ReadinessHandler() http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("health", w, r)
+		defer end()
+
+		if h.Draining() {
+			writeHealthReport(w, HealthReport{Status: healthStatusDraining})
+			return
+		}
+
+		h.mu.Lock()
+		checks := h.readiness
+		h.mu.Unlock()
+
+		writeHealthReport(w, h.run(r.Context(), checks))
+	})
+}
+
+func (h *Health) run(ctx context.Context, checks []*healthCheck) HealthReport {
+	report := HealthReport{
+		Status: healthStatusOK,
+		Checks: make(map[string]HealthCheckResult, len(checks)),
+	}
+
+	results := make([]HealthCheckResult, len(checks))
+	var wg sync.WaitGroup
+	for i, c := range checks {
+		wg.Add(1)
+		go func(i int, c *healthCheck) {
+			defer wg.Done()
+			results[i] = h.check(ctx, c)
+		}(i, c)
+	}
+	wg.Wait()
+
+	for i, c := range checks {
+		report.Checks[c.name] = results[i]
+		if results[i].Status != healthStatusOK {
+			report.Status = healthStatusFail
+		}
+	}
+	return report
+}
+
+func (h *Health) check(ctx context.Context, c *healthCheck) HealthCheckResult {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if h.ttl > 0 && !c.checked.IsZero() && time.Since(c.checked) < h.ttl {
+		return c.result
+	}
+
+	timeout := c.timeout
+	if timeout <= 0 {
+		timeout = h.timeout
+	}
+	checkCtx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	start := time.Now()
+	errc := make(chan error, 1)
+	go func() { errc <- c.fn(checkCtx) }()
+
+	var err error
+	select {
+	case err = <-errc:
+	case <-checkCtx.Done():
+		err = checkCtx.Err()
+	}
+
+	now := time.Now()
+	result := HealthCheckResult{
+		Status:    healthStatusOK,
+		Duration:  now.Sub(start).String(),
+		CheckedAt: now,
+	}
+	if err != nil {
+		result.Status = healthStatusFail
+		result.Error = err.Error()
+	}
+	// The result of a check interrupted by the client going away says
+	// nothing about the dependency, so it isn't cached.
+	if ctx.Err() == nil {
+		c.checked = now
+		c.result = result
+	}
+	return result
+}
+
+func writeHealthReport(w http.ResponseWriter, report HealthReport) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+	if report.Status == healthStatusOK {
+		w.WriteHeader(http.StatusOK)
+	} else {
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}
+	json.NewEncoder(w).Encode(report)
+}
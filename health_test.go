@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func serveHealth(t *testing.T, h http.Handler) (int, HealthReport) {
+	t.Helper()
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/healthz"))
+
+	var report HealthReport
+	if err := json.Unmarshal(rec.Body.Bytes(), &report); err != nil {
+		t.Fatalf("invalid report %q: %v", rec.Body.String(), err)
+	}
+	return rec.Code, report
+}
+
+func TestHealthReadiness(t *testing.T) {
+	health, err := NewHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	health.AddReadinessCheck("db", 0, func(ctx context.Context) error { return nil })
+
+	code, report := serveHealth(t, health.ReadinessHandler())
+	if code != http.StatusOK || report.Status != healthStatusOK {
+		t.Fatalf("bad result: got %d %q", code, report.Status)
+	}
+	if got := report.Checks["db"].Status; got != healthStatusOK {
+		t.Fatalf("bad check status: got %q want %q", got, healthStatusOK)
+	}
+
+	health.AddReadinessCheck("cache", 0, func(ctx context.Context) error { return errors.New("connection refused") })
+
+	code, report = serveHealth(t, health.ReadinessHandler())
+	if code != http.StatusServiceUnavailable || report.Status != healthStatusFail {
+		t.Fatalf("bad result: got %d %q", code, report.Status)
+	}
+	if got, want := report.Checks["cache"].Error, "connection refused"; got != want {
+		t.Fatalf("bad check error: got %q want %q", got, want)
+	}
+
+	// Liveness is unaffected by readiness checks.
+	code, _ = serveHealth(t, health.LivenessHandler())
+	if code != http.StatusOK {
+		t.Fatalf("bad liveness status: got %d want %d", code, http.StatusOK)
+	}
+}
+
+func TestHealthTimeout(t *testing.T) {
+	health, err := NewHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	health.AddLivenessCheck("slow", 10*time.Millisecond, func(ctx context.Context) error {
+		<-ctx.Done()
+		return ctx.Err()
+	})
+
+	code, report := serveHealth(t, health.LivenessHandler())
+	if code != http.StatusServiceUnavailable {
+		t.Fatalf("bad status: got %d want %d", code, http.StatusServiceUnavailable)
+	}
+	if got, want := report.Checks["slow"].Error, context.DeadlineExceeded.Error(); got != want {
+		t.Fatalf("bad check error: got %q want %q", got, want)
+	}
+}
+
+func TestHealthCache(t *testing.T) {
+	calls := 0
+	health, err := NewHealth(HealthCacheTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	health.AddReadinessCheck("db", 0, func(ctx context.Context) error {
+		calls++
+		return nil
+	})
+
+	for i := 0; i < 3; i++ {
+		serveHealth(t, health.ReadinessHandler())
+	}
+	if calls != 1 {
+		t.Fatalf("bad number of check calls: got %d want 1", calls)
+	}
+}
+
+func TestHealthCacheCanceled(t *testing.T) {
+	health, err := NewHealth(HealthCacheTTL(time.Minute))
+	if err != nil {
+		t.Fatal(err)
+	}
+	health.AddReadinessCheck("db", 0, func(ctx context.Context) error {
+		return ctx.Err()
+	})
+
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	rec := httptest.NewRecorder()
+	health.ReadinessHandler().ServeHTTP(rec, newRequest("GET", "/healthz").WithContext(ctx))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("bad status for a canceled request: %d", rec.Code)
+	}
+
+	if code, report := serveHealth(t, health.ReadinessHandler()); code != http.StatusOK {
+		t.Fatalf("canceled check result cached: %d %+v", code, report)
+	}
+}
+
+func TestHealthDrain(t *testing.T) {
+	health, err := NewHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	health.Drain()
+
+	code, report := serveHealth(t, health.ReadinessHandler())
+	if code != http.StatusServiceUnavailable || report.Status != healthStatusDraining {
+		t.Fatalf("bad result: got %d %q", code, report.Status)
+	}
+
+	code, _ = serveHealth(t, health.LivenessHandler())
+	if code != http.StatusOK {
+		t.Fatalf("bad liveness status while draining: got %d want %d", code, http.StatusOK)
+	}
+}
+
+func TestHealthShutdown(t *testing.T) {
+	health, err := NewHealth()
+	if err != nil {
+		t.Fatal(err)
+	}
+	s := httptest.NewServer(health.ReadinessHandler())
+	defer s.Close()
+
+	done := make(chan error)
+	go func() { done <- health.Shutdown(context.Background(), s.Config, 50*time.Millisecond) }()
+
+	// The readiness endpoint fails while the server keeps serving.
+	time.Sleep(10 * time.Millisecond)
+	res, err := http.Get(s.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable {
+		t.Fatalf("bad status while draining: %d", res.StatusCode)
+	}
+
+	if err := <-done; err != nil {
+		t.Fatal(err)
+	}
+	if _, err := http.Get(s.URL); err == nil {
+		t.Fatal("server still serving after shutdown")
+	}
+}
+
+func TestNewHealth(t *testing.T) {
+	if _, err := NewHealth(HealthTimeout(time.Second), HealthCacheTTL(time.Minute)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewHealth(HealthTimeout(0)); err == nil {
+		t.Fatal("no error for a zero timeout")
+	}
+	if _, err := NewHealth(HealthCacheTTL(-time.Second)); err == nil {
+		t.Fatal("no error for a negative cache TTL")
+	}
+}
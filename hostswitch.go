@@ -0,0 +1,110 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+	"sync"
+)
+
+// HostSwitch dispatches requests to handlers by the host they are addressed
+// to, for servers hosting several domains without a full router.
+//
+// Patterns are either exact host names ("example.com") or wildcards matching
+// any subdomain ("*.example.com" matches "api.example.com" and
+// "a.b.example.com", but not "example.com"). Exact patterns take precedence,
+// then the wildcard with the longest suffix. Host names are matched without
+// port, case-insensitively.
+type HostSwitch struct {
+	def http.Handler
+
+	mu        sync.RWMutex
+	exact     map[string]http.Handler
+	wildcards map[string]http.Handler
+}
+
+// NewHostSwitch returns a HostSwitch serving requests for unknown hosts with
+// def, or with 404 Not Found responses if def is nil.
+//
+// Example:
+//
+//	hs := handlers.NewHostSwitch(nil)
+//	hs.Handle("example.com", site)
+//	hs.Handle("*.example.com", tenants, handlers.CORS())
+//	hs.Handle("api.example.com", api, handlers.CompressHandler, handlers.RequestIDHandler())
+//	http.ListenAndServe(":1123", hs)
+func NewHostSwitch(def http.Handler) *HostSwitch {
+	if def == nil {
+		def = http.NotFoundHandler()
+	}
+	return &HostSwitch{
+		def:       def,
+		exact:     map[string]http.Handler{},
+		wildcards: map[string]http.Handler{},
+	}
+}
+
+// Handle registers h for the hosts matching pattern, wrapped with the given
+// middlewares, the first one being the outermost. It panics if pattern is
+// empty or already registered.
+func (hs *HostSwitch) Handle(pattern string, h http.Handler, middlewares ...func(http.Handler) http.Handler) {
+	h = Stack(middlewares).Then(h)
+
+	host := normalizeHost(pattern)
+	routes := hs.exact
+	if strings.HasPrefix(host, "*.") {
+		host = host[1:]
+		routes = hs.wildcards
+	}
+	if host == "" || host == "." {
+		panic("handlers: invalid host pattern " + pattern)
+	}
+
+	hs.mu.Lock()
+	defer hs.mu.Unlock()
+	if _, ok := routes[host]; ok {
+		panic("handlers: multiple registrations for host " + pattern)
+	}
+	routes[host] = h
+}
+
+// Handler returns the handler for the given host, and the default handler if
+// no pattern matches.
+func (hs *HostSwitch) Handler(host string) http.Handler {
+	host = normalizeHost(host)
+
+	hs.mu.RLock()
+	defer hs.mu.RUnlock()
+	if h, ok := hs.exact[host]; ok {
+		return h
+	}
+	// Try the wildcards from the longest suffix: ".b.example.com", then
+	// ".example.com", then ".com".
+	for i := strings.IndexByte(host, '.'); i != -1; {
+		if h, ok := hs.wildcards[host[i:]]; ok {
+			return h
+		}
+		next := strings.IndexByte(host[i+1:], '.')
+		if next == -1 {
+			break
+		}
+		i += next + 1
+	}
+	return hs.def
+}
+
+func (hs *HostSwitch) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("host_switch", w, r)
+	defer end()
+
+	hs.Handler(r.Host).ServeHTTP(w, r)
+}
+
+// normalizeHost returns host lowercased, without port and trailing dot.
+func normalizeHost(host string) string {
+	host = cleanHost(host)
+	if h, _, err := net.SplitHostPort(host); err == nil {
+		host = h
+	}
+	return strings.TrimSuffix(strings.ToLower(host), ".")
+}
@@ -0,0 +1,86 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func hostHandler(name string) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write([]byte(name))
+	})
+}
+
+func TestHostSwitch(t *testing.T) {
+	hs := NewHostSwitch(hostHandler("default"))
+	hs.Handle("example.com", hostHandler("exact"))
+	hs.Handle("*.example.com", hostHandler("wildcard"))
+	hs.Handle("*.eu.example.com", hostHandler("eu"))
+	hs.Handle("api.example.com", hostHandler("api"))
+
+	tests := []struct {
+		host string
+		want string
+	}{
+		{"example.com", "exact"},
+		{"EXAMPLE.com:8080", "exact"},
+		{"example.com.", "exact"},
+		{"api.example.com", "api"},
+		{"www.example.com", "wildcard"},
+		{"a.b.example.com", "wildcard"},
+		{"fr.eu.example.com", "eu"},
+		{"eu.example.com", "wildcard"},
+		{"example.org", "default"},
+		{"notexample.com", "default"},
+		{"", "default"},
+	}
+	for _, test := range tests {
+		r := newRequest("GET", "/")
+		r.Host = test.host
+		rec := httptest.NewRecorder()
+		hs.ServeHTTP(rec, r)
+		if got := rec.Body.String(); got != test.want {
+			t.Errorf("%q: got %q want %q", test.host, got, test.want)
+		}
+	}
+}
+
+func TestHostSwitchMiddlewares(t *testing.T) {
+	var order []string
+	mw := func(name string) func(http.Handler) http.Handler {
+		return func(h http.Handler) http.Handler {
+			return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				order = append(order, name)
+				h.ServeHTTP(w, r)
+			})
+		}
+	}
+	hs := NewHostSwitch(nil)
+	hs.Handle("example.com", hostHandler("exact"), mw("outer"), mw("inner"))
+
+	r := newRequest("GET", "/")
+	r.Host = "example.com"
+	hs.ServeHTTP(httptest.NewRecorder(), r)
+	if len(order) != 2 || order[0] != "outer" || order[1] != "inner" {
+		t.Fatalf("wrong middleware order: %v", order)
+	}
+
+	r.Host = "example.org"
+	rec := httptest.NewRecorder()
+	hs.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("wrong default status: got %d want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestHostSwitchDuplicate(t *testing.T) {
+	hs := NewHostSwitch(nil)
+	hs.Handle("*.example.com", hostHandler("a"))
+	defer func() {
+		if recover() == nil {
+			t.Fatal("expected panic on duplicate pattern")
+		}
+	}()
+	hs.Handle("*.Example.com", hostHandler("b"))
+}
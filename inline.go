@@ -0,0 +1,124 @@
+package handlers
+
+import (
+	"bytes"
+	"mime"
+	"net/http"
+	"path"
+	"time"
+)
+
+// defaultInlineCacheControl caches inline assets for a week: their URLs, such
+// as /favicon.ico, can't be fingerprinted, so they aren't immutable.
+const defaultInlineCacheControl = "public, max-age=604800"
+
+// InlineAssetOption represents a functional option for configuring
+// InlineAsset.
+type InlineAssetOption func(*inlineAsset) error
+
+type inlineAsset struct {
+	name         string
+	content      []byte
+	contentType  string
+	cacheControl string
+	etag         string
+	modtime      time.Time
+}
+
+// InlineAssetContentType sets the Content-Type of the asset. By default it is
+// derived from the extension of its name, and defaults to
+// application/octet-stream.
+func InlineAssetContentType(contentType string) InlineAssetOption {
+	return func(a *inlineAsset) error {
+		a.contentType = contentType
+		return nil
+	}
+}
+
+// InlineAssetCacheControl sets the Cache-Control header of the asset, which
+// defaults to "public, max-age=604800". An empty value omits the header.
+func InlineAssetCacheControl(value string) InlineAssetOption {
+	return func(a *inlineAsset) error {
+		a.cacheControl = value
+		return nil
+	}
+}
+
+// InlineAsset returns a handler serving content from memory, for single
+// assets embedded in the binary such as a favicon or robots.txt. Responses
+// carry an ETag and long-lived cache headers, and conditional and range
+// requests are supported.
+//
+// Example:
+//
+//	//go:embed robots.txt
+//	var robots []byte
+//
+//	mux.Handle("/robots.txt", handlers.InlineAsset("robots.txt", robots))
+func InlineAsset(name string, content []byte, opts ...InlineAssetOption) http.Handler {
+	a := &inlineAsset{
+		name:         name,
+		content:      content,
+		cacheControl: defaultInlineCacheControl,
+		etag:         computeETag(content, false),
+		modtime:      time.Now(),
+	}
+	for _, option := range opts {
+		option(a)
+	}
+	if a.contentType == "" {
+		a.contentType = mime.TypeByExtension(path.Ext(name))
+	}
+	if a.contentType == "" {
+		a.contentType = "application/octet-stream"
+	}
+	return a
+}
+
+func (a *inlineAsset) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("inline_asset", w, r)
+	defer end()
+
+	h := w.Header()
+	h.Set("Content-Type", a.contentType)
+	h.Set(etagHeader, a.etag)
+	if a.cacheControl != "" {
+		h.Set("Cache-Control", a.cacheControl)
+	}
+	http.ServeContent(w, r, a.name, a.modtime, bytes.NewReader(a.content))
+}
+
+// Favicon is HTTP middleware answering requests for /favicon.ico from
+// memory, short-circuiting the 404 responses which otherwise clutter access
+// logs. With nil content it replies 204 No Content, cached like the icon
+// would be, so browsers stop asking.
+//
+// Example:
+//
+//	//go:embed favicon.ico
+//	var favicon []byte
+//
+//	http.ListenAndServe(":1123", handlers.Favicon(favicon)(r))
+func Favicon(content []byte, opts ...InlineAssetOption) func(http.Handler) http.Handler {
+	var icon http.Handler
+	if content != nil {
+		icon = InlineAsset("favicon.ico", content, append([]InlineAssetOption{InlineAssetContentType("image/x-icon")}, opts...)...)
+	} else {
+		icon = http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Cache-Control", defaultInlineCacheControl)
+			w.WriteHeader(http.StatusNoContent)
+		})
+	}
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w, r, end := beginRequestEvent("favicon", w, r)
+			defer end()
+
+			if r.URL.Path == "/favicon.ico" && (r.Method == "GET" || r.Method == "HEAD") {
+				icon.ServeHTTP(w, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
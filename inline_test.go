@@ -0,0 +1,55 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestInlineAsset(t *testing.T) {
+	handler := InlineAsset("robots.txt", []byte("User-agent: *\n"))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/robots.txt"))
+	if rec.Code != http.StatusOK || rec.Body.String() != "User-agent: *\n" {
+		t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if ct := rec.Header().Get("Content-Type"); ct != "text/plain; charset=utf-8" {
+		t.Errorf("wrong content type: %q", ct)
+	}
+	if cc := rec.Header().Get("Cache-Control"); cc != defaultInlineCacheControl {
+		t.Errorf("wrong cache control: %q", cc)
+	}
+
+	r := newRequest("GET", "/robots.txt")
+	r.Header.Set("If-None-Match", rec.Header().Get(etagHeader))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("wrong conditional status: got %d want %d", rec.Code, http.StatusNotModified)
+	}
+}
+
+func TestFavicon(t *testing.T) {
+	next := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	})
+
+	rec := httptest.NewRecorder()
+	Favicon([]byte{0, 0, 1, 0})(next).ServeHTTP(rec, newRequest("GET", "/favicon.ico"))
+	if rec.Code != http.StatusOK || rec.Header().Get("Content-Type") != "image/x-icon" || rec.Body.Len() != 4 {
+		t.Errorf("wrong icon response: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	Favicon(nil)(next).ServeHTTP(rec, newRequest("GET", "/favicon.ico"))
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Cache-Control") == "" {
+		t.Errorf("wrong empty icon response: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = httptest.NewRecorder()
+	Favicon(nil)(next).ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusTeapot {
+		t.Errorf("request not passed through: %d", rec.Code)
+	}
+}
@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"time"
+)
+
+// MetricsCollector receives the measurements of Instrument, to record them
+// with a metrics library, e.g. as Prometheus or OpenTelemetry instruments, or
+// expvar variables. Its methods are called concurrently.
+type MetricsCollector interface {
+	// RequestStarted is called when Instrument starts serving r, e.g. to
+	// increment an in-flight requests gauge.
+	RequestStarted(r *http.Request, method string)
+	// RequestDone is called once the handler returned, with the
+	// measurements of the request, e.g. to decrement the in-flight requests
+	// gauge, count the request and observe its latency and response size.
+	RequestDone(r *http.Request, m RequestMetrics)
+}
+
+// RequestMetrics are the measurements of a request served through
+// Instrument.
+type RequestMetrics struct {
+	// Method is the method of the request, or OTHER for non-standard
+	// methods, so as to bound the number of label values.
+	Method string
+	// Route identifies the handler which served the request, e.g.
+	// "/items/{id}", as set with InstrumentRoute or SetMetricsRoute. It is
+	// empty if there is none.
+	Route string
+	// Status is the status code of the response.
+	Status int
+	// Size is the number of bytes of the response body.
+	Size int
+	// Duration is the time taken to serve the request.
+	Duration time.Duration
+	// TraceID is the ID of the trace the request belongs to, see TraceID, to
+	// record the latency with an exemplar. It is empty if the request isn't
+	// traced.
+	TraceID string
+}
+
+// InstrumentOption represents a functional option for configuring
+// Instrument.
+type InstrumentOption func(*instrument) error
+
+type instrument struct {
+	h         http.Handler
+	collector MetricsCollector
+	route     func(r *http.Request) string
+}
+
+// metricsRoute holds the route of a request set with SetMetricsRoute.
+type metricsRoute struct {
+	route string
+}
+
+// InstrumentRoute sets the function returning the route of a request, called
+// once the handler returned, unless the route was set with SetMetricsRoute.
+// Routes should be patterns rather than paths, e.g. "/items/{id}", to keep the
+// number of label values bounded.
+func InstrumentRoute(fn func(r *http.Request) string) InstrumentOption {
+	return func(i *instrument) error {
+		if fn == nil {
+			return errors.New("handlers: nil route function")
+		}
+		i.route = fn
+		return nil
+	}
+}
+
+// Instrument is HTTP middleware measuring the requests served by the wrapped
+// handler: the number of requests in flight, and the count, latency and
+// response size of requests per method, route and status, reported to
+// collector.
+//
+// The status and size are captured with the same ResponseWriter as the logging
+// handlers, which Instrument shares with them when wrapped directly by one, or
+// wrapping one, rather than wrapping the response twice. The optional
+// interfaces of the ResponseWriter, such as http.Flusher, are preserved.
+//
+// Example, with a collector recording Prometheus metrics:
+//
+//	type promCollector struct {
+//		inFlight *prometheus.GaugeVec
+//		requests *prometheus.CounterVec
+//		latency  *prometheus.HistogramVec
+//		size     *prometheus.HistogramVec
+//	}
+//
+//	func (c *promCollector) RequestStarted(r *http.Request, method string) {
+//		c.inFlight.WithLabelValues(method).Inc()
+//	}
+//
+//	func (c *promCollector) RequestDone(r *http.Request, m handlers.RequestMetrics) {
+//		status := strconv.Itoa(m.Status)
+//		c.inFlight.WithLabelValues(m.Method).Dec()
+//		c.requests.WithLabelValues(m.Method, m.Route, status).Inc()
+//		c.latency.WithLabelValues(m.Method, m.Route, status).Observe(m.Duration.Seconds())
+//		c.size.WithLabelValues(m.Method, m.Route, status).Observe(float64(m.Size))
+//	}
+//
+//	r.HandleFunc("/items/{id}", func(w http.ResponseWriter, r *http.Request) {
+//		handlers.SetMetricsRoute(r, "/items/{id}")
+//		...
+//	})
+//	http.ListenAndServe(":1123", handlers.Instrument(collector)(r))
+func Instrument(collector MetricsCollector, opts ...InstrumentOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		i := &instrument{h: h, collector: collector}
+		for _, option := range opts {
+			option(i)
+		}
+		return i
+	}
+}
+
+// NewInstrument is like Instrument, but returns an error if collector is nil
+// or an option is invalid.
+func NewInstrument(collector MetricsCollector, opts ...InstrumentOption) (func(http.Handler) http.Handler, error) {
+	if collector == nil {
+		return nil, errors.New("handlers: nil metrics collector")
+	}
+	i := &instrument{}
+	for _, option := range opts {
+		if err := option(i); err != nil {
+			return nil, err
+		}
+	}
+	return Instrument(collector, opts...), nil
+}
+
+// SetMetricsRoute sets the route of r reported by Instrument, e.g. by the
+// handler of a route or by a middleware of the router. It has no effect if r
+// isn't served through Instrument.
+func SetMetricsRoute(r *http.Request, route string) {
+	if mr, ok := Value[*metricsRoute](r); ok {
+		mr.route = route
+	}
+}
+
+func (i *instrument) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("instrument", w, r)
+	defer end()
+
+	if i.collector == nil {
+		i.h.ServeHTTP(w, r)
+		return
+	}
+
+	t := time.Now()
+	method := metricsMethod(r.Method)
+	i.collector.RequestStarted(r, method)
+	logger, w := captureResponse(w)
+	mr := &metricsRoute{}
+	completed := false
+	defer func() {
+		status := logger.Status()
+		if !completed && !logger.wroteHeader {
+			// The handler panicked, which RecoveryHandler answers with 500.
+			status = http.StatusInternalServerError
+		}
+		route := mr.route
+		if route == "" && i.route != nil {
+			route = i.route(r)
+		}
+		i.collector.RequestDone(r, RequestMetrics{
+			Method:   method,
+			Route:    route,
+			Status:   status,
+			Size:     logger.Size(),
+			Duration: time.Since(t),
+			TraceID:  TraceID(r),
+		})
+	}()
+
+	i.h.ServeHTTP(w, WithValue(r, mr))
+	completed = true
+}
+
+// metricsMethod returns method in uppercase if it is a standard method, and
+// OTHER otherwise.
+func metricsMethod(method string) string {
+	if m := canonicalMethod(method); containsString(standardMethods, m) {
+		return m
+	}
+	return "OTHER"
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+)
+
+type testCollector struct {
+	mu       sync.Mutex
+	inFlight map[string]int
+	done     []RequestMetrics
+}
+
+func (c *testCollector) RequestStarted(r *http.Request, method string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	if c.inFlight == nil {
+		c.inFlight = map[string]int{}
+	}
+	c.inFlight[method]++
+}
+
+func (c *testCollector) RequestDone(r *http.Request, m RequestMetrics) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	c.inFlight[m.Method]--
+	c.done = append(c.done, m)
+}
+
+func TestInstrument(t *testing.T) {
+	c := &testCollector{}
+	handler := Instrument(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if n := c.inFlight["GET"]; n != 1 {
+			t.Errorf("bad in-flight requests: got %d want 1", n)
+		}
+		SetMetricsRoute(r, "/items/{id}")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, ok)
+	}))
+	r := newRequest("get", "/items/42")
+	r = WithTraceID(r, "4bf92f3577b34da6a3ce929d0e0e4736")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if len(c.done) != 1 {
+		t.Fatalf("bad number of measurements: %d", len(c.done))
+	}
+	m := c.done[0]
+	if m.Method != "GET" || m.Route != "/items/{id}" || m.Status != http.StatusCreated || m.Size != len(ok) || m.Duration <= 0 || m.TraceID != "4bf92f3577b34da6a3ce929d0e0e4736" {
+		t.Fatalf("bad measurements: %+v", m)
+	}
+	if n := c.inFlight["GET"]; n != 0 {
+		t.Fatalf("bad in-flight requests: got %d want 0", n)
+	}
+}
+
+func TestInstrumentRoute(t *testing.T) {
+	c := &testCollector{}
+	handler := Instrument(c, InstrumentRoute(func(r *http.Request) string { return "default" }))(okHandler)
+
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("PURGE", "/"))
+	if m := c.done[0]; m.Method != "OTHER" || m.Route != "default" || m.Status != http.StatusOK {
+		t.Fatalf("bad measurements: %+v", m)
+	}
+}
+
+func TestInstrumentPanic(t *testing.T) {
+	c := &testCollector{}
+	handler := RecoveryHandler()(Instrument(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+
+	if len(c.done) != 1 || c.done[0].Status != http.StatusInternalServerError || c.inFlight["GET"] != 0 {
+		t.Fatalf("bad measurements: %+v %v", c.done, c.inFlight)
+	}
+}
+
+func TestInstrumentSharesLoggingWriter(t *testing.T) {
+	c := &testCollector{}
+	var params LogFormatterParams
+	var mu sync.Mutex
+	formatter := func(_ io.Writer, p LogFormatterParams) {
+		mu.Lock()
+		defer mu.Unlock()
+		params = p
+	}
+
+	var logged, inner http.ResponseWriter
+	ts := httptest.NewServer(CustomLoggingHandler(io.Discard, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		logged = w
+		Instrument(c)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			inner = w
+			w.WriteHeader(http.StatusAccepted)
+			io.WriteString(w, ok)
+			w.(http.Flusher).Flush()
+		})).ServeHTTP(w, r)
+	}), formatter))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	ts.Close()
+
+	if inner != logged {
+		t.Fatalf("response writer wrapped twice: %T", inner)
+	}
+	mu.Lock()
+	defer mu.Unlock()
+	if c.done[0].Status != http.StatusAccepted || params.StatusCode != http.StatusAccepted || c.done[0].Size != len(ok) || params.Size != len(ok) {
+		t.Fatalf("bad measurements: %+v %+v", c.done[0], params)
+	}
+}
+
+func TestNewInstrument(t *testing.T) {
+	if _, err := NewInstrument(&testCollector{}, InstrumentRoute(func(r *http.Request) string { return "" })); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewInstrument(nil); err == nil {
+		t.Fatal("expected an error for a nil collector")
+	}
+	if _, err := NewInstrument(&testCollector{}, InstrumentRoute(nil)); err == nil {
+		t.Fatal("expected an error for a nil route function")
+	}
+}
@@ -0,0 +1,379 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+const (
+	defaultJSONMaxBodySize = 1 << 20
+	defaultJSONMaxDepth    = 32
+)
+
+// JSONOption represents a functional option for configuring DecodeJSON.
+type JSONOption func(*jsonDecoder) error
+
+type jsonDecoder struct {
+	maxBodySize  int64
+	maxDepth     int
+	allowUnknown bool
+}
+
+// JSONMaxBodySize sets the maximum size of the request bodies, 1MiB by
+// default. Larger bodies are rejected with 413 Request Entity Too Large.
+func JSONMaxBodySize(n int64) JSONOption {
+	return func(d *jsonDecoder) error {
+		d.maxBodySize = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid JSON max body size %d", n)
+		}
+		return nil
+	}
+}
+
+// JSONMaxDepth sets the maximum nesting depth of objects and arrays in request
+// bodies, 32 by default.
+func JSONMaxDepth(n int) JSONOption {
+	return func(d *jsonDecoder) error {
+		d.maxDepth = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid JSON max depth %d", n)
+		}
+		return nil
+	}
+}
+
+// JSONAllowUnknownFields ignores object members that don't match a field of
+// the target struct. By default they are rejected.
+func JSONAllowUnknownFields() JSONOption {
+	return func(d *jsonDecoder) error {
+		d.allowUnknown = true
+		return nil
+	}
+}
+
+// jsonBody holds the request body decoded by DecodeJSON in the request
+// context, so that it doesn't collide with other values of type T.
+type jsonBody[T any] struct {
+	value T
+}
+
+// DecodeJSON is HTTP middleware decoding the JSON body of requests into a
+// value of type T, which handlers retrieve with JSONBody. It is meant to be
+// applied to the routes expecting a body of that type.
+//
+// Decoding is strict: the request must have a JSON content type, or it is
+// answered with 415 Unsupported Media Type, and its body must hold a single
+// JSON value, no larger and no deeper than the configured limits, whose
+// object members all match fields of T. Other requests are answered with 400
+// Bad Request, or 413 Request Entity Too Large, application/problem+json
+// documents whose "errors" member lists ValidationError values locating the
+// invalid values, e.g.:
+//
+//	{
+//		"title": "Bad Request",
+//		"status": 400,
+//		"detail": "invalid request",
+//		"errors": [{"in": "body", "pointer": "/items/0/sku", "message": "unknown property"}]
+//	}
+//
+// The body remains readable by the handler.
+//
+// Example:
+//
+//	type createOrder struct {
+//		Items []struct {
+//			ID       string `json:"id"`
+//			Quantity int    `json:"quantity"`
+//		} `json:"items"`
+//	}
+//
+//	mux.Handle("POST /orders", handlers.DecodeJSON[createOrder]()(http.HandlerFunc(
+//		func(w http.ResponseWriter, r *http.Request) {
+//			order, _ := handlers.JSONBody[createOrder](r)
+//			...
+//		})))
+func DecodeJSON[T any](opts ...JSONOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		d := &jsonDecoder{maxBodySize: defaultJSONMaxBodySize, maxDepth: defaultJSONMaxDepth}
+		for _, option := range opts {
+			option(d)
+		}
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w, r, end := beginRequestEvent("json_body", w, r)
+			defer end()
+
+			var value T
+			var errs ValidationErrors
+			if code := d.decode(r, &value, &errs); code != 0 {
+				writeValidationErrors(w, r, code, errs)
+				return
+			}
+			h.ServeHTTP(w, WithValue(r, jsonBody[T]{value}))
+		})
+	}
+}
+
+// NewDecodeJSON is like DecodeJSON, but returns an error if an option is
+// invalid.
+func NewDecodeJSON[T any](opts ...JSONOption) (func(http.Handler) http.Handler, error) {
+	d := &jsonDecoder{}
+	for _, option := range opts {
+		if err := option(d); err != nil {
+			return nil, err
+		}
+	}
+	return DecodeJSON[T](opts...), nil
+}
+
+// JSONBody returns the request body decoded by DecodeJSON[T], and whether
+// there was one.
+func JSONBody[T any](r *http.Request) (T, bool) {
+	b, ok := Value[jsonBody[T]](r)
+	return b.value, ok
+}
+
+// decode decodes the body of r into v, which must be a pointer. It returns
+// the status code to reply with if the body is invalid, or 0.
+func (d *jsonDecoder) decode(r *http.Request, v interface{}, errs *ValidationErrors) int {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil || !isJSONMediaType(mt) {
+		errs.add("header", "/Content-Type", "content type must be application/json")
+		return http.StatusUnsupportedMediaType
+	}
+	if r.Body == nil {
+		errs.add("body", "", "request body is required")
+		return http.StatusBadRequest
+	}
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, d.maxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		errs.add("body", "", "unreadable request body")
+		return http.StatusBadRequest
+	}
+	if int64(len(body)) > d.maxBodySize {
+		errs.add("body", "", fmt.Sprintf("request body larger than %d bytes", d.maxBodySize))
+		return http.StatusRequestEntityTooLarge
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+	if len(bytes.TrimSpace(body)) == 0 {
+		errs.add("body", "", "request body is required")
+		return http.StatusBadRequest
+	}
+
+	if err := checkJSONSyntax(body, d.maxDepth); err != nil {
+		errs.add("body", "", err.Error())
+		return http.StatusBadRequest
+	}
+	if !d.allowUnknown {
+		var raw interface{}
+		dec := json.NewDecoder(bytes.NewReader(body))
+		dec.UseNumber()
+		dec.Decode(&raw)
+		unknownJSONFields(raw, reflect.TypeOf(v).Elem(), "", errs)
+		if len(*errs) > 0 {
+			return http.StatusBadRequest
+		}
+	}
+
+	dec := json.NewDecoder(bytes.NewReader(body))
+	if !d.allowUnknown {
+		dec.DisallowUnknownFields()
+	}
+	if err := dec.Decode(v); err != nil {
+		var typeErr *json.UnmarshalTypeError
+		if errors.As(err, &typeErr) {
+			pointer := ""
+			if typeErr.Field != "" {
+				pointer = "/" + strings.ReplaceAll(typeErr.Field, ".", "/")
+			}
+			errs.add("body", pointer, "must be of type "+jsonTypeName(typeErr.Type))
+		} else {
+			errs.add("body", "", strings.TrimPrefix(err.Error(), "json: "))
+		}
+		return http.StatusBadRequest
+	}
+	return 0
+}
+
+// checkJSONSyntax checks that body holds a single JSON value nested no deeper
+// than maxDepth.
+func checkJSONSyntax(body []byte, maxDepth int) error {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	depth := 0
+	for {
+		tok, err := dec.Token()
+		if err == io.EOF && depth == 0 {
+			return nil
+		}
+		if err != nil {
+			var syntaxErr *json.SyntaxError
+			if errors.As(err, &syntaxErr) {
+				return fmt.Errorf("invalid JSON at offset %d: %v", syntaxErr.Offset, err)
+			}
+			if err == io.EOF || err == io.ErrUnexpectedEOF {
+				return errors.New("invalid JSON: unexpected end of input")
+			}
+			return fmt.Errorf("invalid JSON: %v", err)
+		}
+		if delim, ok := tok.(json.Delim); ok {
+			switch delim {
+			case '{', '[':
+				if depth++; depth > maxDepth {
+					return fmt.Errorf("JSON nested deeper than %d levels", maxDepth)
+				}
+			default:
+				depth--
+			}
+		}
+		if depth == 0 && dec.More() {
+			return errors.New("unexpected data after the JSON value")
+		}
+	}
+}
+
+var (
+	jsonUnmarshalerType = reflect.TypeOf((*json.Unmarshaler)(nil)).Elem()
+	textUnmarshalerType = reflect.TypeOf((*encoding.TextUnmarshaler)(nil)).Elem()
+)
+
+// unknownJSONFields reports the members of the objects in v, a decoded JSON
+// value, that don't match a field of the corresponding struct in t.
+func unknownJSONFields(v interface{}, t reflect.Type, pointer string, errs *ValidationErrors) {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	if reflect.PtrTo(t).Implements(jsonUnmarshalerType) || reflect.PtrTo(t).Implements(textUnmarshalerType) {
+		return
+	}
+	switch t.Kind() {
+	case reflect.Struct:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		fields := jsonFields(t)
+		for _, name := range sortedMembers(obj) {
+			ft, ok := fields[name]
+			if !ok {
+				for fname, f := range fields {
+					if strings.EqualFold(fname, name) {
+						ft, ok = f, true
+						break
+					}
+				}
+			}
+			if !ok {
+				errs.add("body", jsonPointer(pointer, name), "unknown property")
+				continue
+			}
+			unknownJSONFields(obj[name], ft, jsonPointer(pointer, name), errs)
+		}
+	case reflect.Map:
+		obj, ok := v.(map[string]interface{})
+		if !ok {
+			return
+		}
+		for _, name := range sortedMembers(obj) {
+			unknownJSONFields(obj[name], t.Elem(), jsonPointer(pointer, name), errs)
+		}
+	case reflect.Slice, reflect.Array:
+		arr, ok := v.([]interface{})
+		if !ok {
+			return
+		}
+		for i, elem := range arr {
+			unknownJSONFields(elem, t.Elem(), jsonPointer(pointer, strconv.Itoa(i)), errs)
+		}
+	}
+}
+
+// sortedMembers returns the member names of obj in order, so that errors are
+// reported consistently.
+func sortedMembers(obj map[string]interface{}) []string {
+	names := make([]string, 0, len(obj))
+	for name := range obj {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// jsonFields returns the types of the fields of struct type t by JSON member
+// name, including those promoted from embedded structs.
+func jsonFields(t reflect.Type) map[string]reflect.Type {
+	fields := map[string]reflect.Type{}
+	var embedded []reflect.Type
+	for i := 0; i < t.NumField(); i++ {
+		f := t.Field(i)
+		tag := f.Tag.Get("json")
+		if tag == "-" {
+			continue
+		}
+		name := strings.Split(tag, ",")[0]
+		if f.Anonymous && name == "" {
+			ft := f.Type
+			if ft.Kind() == reflect.Ptr {
+				ft = ft.Elem()
+			}
+			if ft.Kind() == reflect.Struct {
+				embedded = append(embedded, ft)
+				continue
+			}
+		}
+		if f.PkgPath != "" {
+			continue
+		}
+		if name == "" {
+			name = f.Name
+		}
+		fields[name] = f.Type
+	}
+	for _, et := range embedded {
+		for name, ft := range jsonFields(et) {
+			if _, ok := fields[name]; !ok {
+				fields[name] = ft
+			}
+		}
+	}
+	return fields
+}
+
+// jsonTypeName returns the name of the JSON type which decodes into t.
+func jsonTypeName(t reflect.Type) string {
+	for t.Kind() == reflect.Ptr {
+		t = t.Elem()
+	}
+	switch t.Kind() {
+	case reflect.Bool:
+		return "boolean"
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64,
+		reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return "integer"
+	case reflect.Float32, reflect.Float64:
+		return "number"
+	case reflect.String:
+		return "string"
+	case reflect.Slice:
+		if t.Elem().Kind() == reflect.Uint8 {
+			return "string"
+		}
+		return "array"
+	case reflect.Array:
+		return "array"
+	case reflect.Map, reflect.Struct:
+		return "object"
+	}
+	return t.String()
+}
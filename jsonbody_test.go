@@ -0,0 +1,152 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+type testOrderItem struct {
+	ID       string `json:"id"`
+	Quantity int    `json:"quantity"`
+}
+
+type testOrderMeta struct {
+	Source string `json:"source"`
+}
+
+type testOrder struct {
+	testOrderMeta
+	Items    []testOrderItem   `json:"items"`
+	Note     *string           `json:"note,omitempty"`
+	Labels   map[string]string `json:"labels"`
+	Internal string            `json:"-"`
+}
+
+func TestDecodeJSON(t *testing.T) {
+	var got testOrder
+	var body string
+	h := DecodeJSON[testOrder](JSONMaxBodySize(256), JSONMaxDepth(3))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var ok bool
+		if got, ok = JSONBody[testOrder](r); !ok {
+			t.Error("no decoded body")
+		}
+		b, _ := ioutil.ReadAll(r.Body)
+		body = string(b)
+	}))
+
+	tests := []struct {
+		contentType, body string
+		code              int
+		errors            []ValidationError
+	}{
+		{"application/json", `{"source": "web", "items": [{"id": "a", "quantity": 2}], "labels": {"x": "y"}}`, http.StatusOK, nil},
+		{"application/vnd.api+json; charset=utf-8", `{"Items": []}`, http.StatusOK, nil},
+		{"text/plain", `{}`, http.StatusUnsupportedMediaType, []ValidationError{
+			{"header", "/Content-Type", "content type must be application/json"},
+		}},
+		{"application/json", ``, http.StatusBadRequest, []ValidationError{
+			{"body", "", "request body is required"},
+		}},
+		{"application/json", `{"items": [}`, http.StatusBadRequest, []ValidationError{
+			{"body", "", "invalid JSON at offset 12: invalid character '}' looking for beginning of value"},
+		}},
+		{"application/json", `{"items": [`, http.StatusBadRequest, []ValidationError{
+			{"body", "", "invalid JSON: unexpected end of input"},
+		}},
+		{"application/json", `{} {}`, http.StatusBadRequest, []ValidationError{
+			{"body", "", "unexpected data after the JSON value"},
+		}},
+		{"application/json", `{"labels": {"a": [[1]]}}`, http.StatusBadRequest, []ValidationError{
+			{"body", "", "JSON nested deeper than 3 levels"},
+		}},
+		{"application/json", `{"items": [{"id": "a", "sku": "b"}], "internal": "x", "extra": 1, "labels": {"a/b": "c"}}`, http.StatusBadRequest, []ValidationError{
+			{"body", "/extra", "unknown property"},
+			{"body", "/internal", "unknown property"},
+			{"body", "/items/0/sku", "unknown property"},
+		}},
+		{"application/json", `{"items": [{"quantity": "2"}]}`, http.StatusBadRequest, []ValidationError{
+			{"body", "/items/0/quantity", "must be of type integer"},
+		}},
+		{"application/json", `{"note": 1.5}`, http.StatusBadRequest, []ValidationError{
+			{"body", "/note", "must be of type string"},
+		}},
+		{"application/json", `[]`, http.StatusBadRequest, []ValidationError{
+			{"body", "", "must be of type object"},
+		}},
+		{"application/json", `{"source": "` + strings.Repeat("a", 256) + `"}`, http.StatusRequestEntityTooLarge, []ValidationError{
+			{"body", "", "request body larger than 256 bytes"},
+		}},
+	}
+	for _, test := range tests {
+		got, body = testOrder{}, ""
+		r := httptest.NewRequest("POST", "/orders", strings.NewReader(test.body))
+		r.Header.Set("Content-Type", test.contentType)
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%s: wrong status: got %d want %d: %s", test.body, rec.Code, test.code, rec.Body.String())
+			continue
+		}
+		if test.code == http.StatusOK {
+			if body != test.body {
+				t.Errorf("%s: body not readable: %q", test.body, body)
+			}
+			continue
+		}
+		var problem struct {
+			Errors []ValidationError
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatal(err)
+		}
+		if len(problem.Errors) != len(test.errors) {
+			t.Errorf("%s: wrong errors: got %v want %v", test.body, problem.Errors, test.errors)
+			continue
+		}
+		for i := range test.errors {
+			if problem.Errors[i] != test.errors[i] {
+				t.Errorf("%s: error %d: got %v want %v", test.body, i, problem.Errors[i], test.errors[i])
+			}
+		}
+	}
+
+	r := httptest.NewRequest("POST", "/orders", strings.NewReader(tests[0].body))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if got.Source != "web" || len(got.Items) != 1 || got.Items[0].Quantity != 2 || got.Labels["x"] != "y" {
+		t.Errorf("wrong decoded body: %+v", got)
+	}
+}
+
+func TestDecodeJSONAllowUnknownFields(t *testing.T) {
+	h := DecodeJSON[testOrderItem](JSONAllowUnknownFields())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		item, _ := JSONBody[testOrderItem](r)
+		w.Write([]byte(item.ID))
+	}))
+	r := httptest.NewRequest("POST", "/", strings.NewReader(`{"id": "a", "sku": "b"}`))
+	r.Header.Set("Content-Type", "application/json")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	if rec.Code != http.StatusOK || rec.Body.String() != "a" {
+		t.Fatalf("got %d %q", rec.Code, rec.Body.String())
+	}
+	if _, ok := JSONBody[testOrder](r); ok {
+		t.Fatal("body found without DecodeJSON")
+	}
+}
+
+func TestNewDecodeJSON(t *testing.T) {
+	if _, err := NewDecodeJSON[testOrder](JSONMaxBodySize(0)); err == nil {
+		t.Error("no error for invalid max body size")
+	}
+	if _, err := NewDecodeJSON[testOrder](JSONMaxDepth(-1)); err == nil {
+		t.Error("no error for invalid max depth")
+	}
+	if _, err := NewDecodeJSON[testOrder](JSONMaxDepth(4), JSONAllowUnknownFields()); err != nil {
+		t.Error(err)
+	}
+}
@@ -0,0 +1,115 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io"
+	"log/slog"
+	"net/http"
+	"sort"
+	"time"
+)
+
+// jsonLogEntry is the access log entry written by JSONLoggingHandler.
+type jsonLogEntry struct {
+	Time      string            `json:"time"`
+	Method    string            `json:"method"`
+	Path      string            `json:"path"`
+	Query     string            `json:"query,omitempty"`
+	Proto     string            `json:"proto"`
+	Status    int               `json:"status"`
+	Bytes     int               `json:"bytes"`
+	LatencyMS float64           `json:"latency_ms"`
+	RemoteIP  string            `json:"remote_ip"`
+	Referer   string            `json:"referer,omitempty"`
+	UserAgent string            `json:"user_agent,omitempty"`
+	RequestID string            `json:"request_id,omitempty"`
+	Fields    map[string]string `json:"fields,omitempty"`
+}
+
+// JSONLogFormatter is a LogFormatter writing one JSON object per request, as
+// JSONLoggingHandler does.
+func JSONLogFormatter(writer io.Writer, params LogFormatterParams) {
+	r := params.Request
+	b, err := json.Marshal(jsonLogEntry{
+		Time:      params.TimeStamp.Format(time.RFC3339Nano),
+		Method:    r.Method,
+		Path:      params.URL.Path,
+		Query:     params.URL.RawQuery,
+		Proto:     r.Proto,
+		Status:    params.StatusCode,
+		Bytes:     params.Size,
+		LatencyMS: float64(params.Duration) / float64(time.Millisecond),
+		RemoteIP:  ClientIP(r),
+		Referer:   r.Referer(),
+		UserAgent: r.UserAgent(),
+		RequestID: params.RequestID,
+		Fields:    params.Fields,
+	})
+	if err != nil {
+		return
+	}
+	writer.Write(append(b, '\n'))
+}
+
+// JSONLoggingHandler returns a http.Handler that wraps h and logs requests to
+// out as JSON lines, for log pipelines which parse structured logs, e.g.:
+//
+//	{"time":"2024-05-26T03:30:45.123Z","method":"GET","path":"/items","query":"page=2","proto":"HTTP/1.1","status":200,"bytes":512,"latency_ms":1.25,"remote_ip":"192.0.2.7","user_agent":"curl/8.5.0"}
+//
+// The remote IP is the one established by ProxyHeaders, if any. The request
+// ID and the fields set with SetLogField are included when present.
+func JSONLoggingHandler(out io.Writer, h http.Handler) http.Handler {
+	return loggingHandler{out, h, JSONLogFormatter, "json"}
+}
+
+// SlogFormatter returns a LogFormatter logging each request with logger, at
+// the info level, for use with CustomLoggingHandler. The writer passed to
+// CustomLoggingHandler is unused and may be nil. Other structured loggers,
+// such as zap or zerolog, can be plugged in the same way with a LogFormatter
+// of their own, reading the status, size and duration captured in
+// LogFormatterParams.
+//
+// Example:
+//
+//	logger := slog.New(slog.NewJSONHandler(os.Stderr, nil))
+//	h := handlers.CustomLoggingHandler(nil, r, handlers.SlogFormatter(logger))
+func SlogFormatter(logger *slog.Logger) LogFormatter {
+	return func(_ io.Writer, params LogFormatterParams) {
+		r := params.Request
+		attrs := make([]slog.Attr, 0, 12)
+		attrs = append(attrs,
+			slog.String("method", r.Method),
+			slog.String("path", params.URL.Path),
+			slog.String("proto", r.Proto),
+			slog.Int("status", params.StatusCode),
+			slog.Int("bytes", params.Size),
+			slog.Duration("latency", params.Duration),
+			slog.String("remote_ip", ClientIP(r)),
+		)
+		if params.URL.RawQuery != "" {
+			attrs = append(attrs, slog.String("query", params.URL.RawQuery))
+		}
+		if referer := r.Referer(); referer != "" {
+			attrs = append(attrs, slog.String("referer", referer))
+		}
+		if ua := r.UserAgent(); ua != "" {
+			attrs = append(attrs, slog.String("user_agent", ua))
+		}
+		if params.RequestID != "" {
+			attrs = append(attrs, slog.String("request_id", params.RequestID))
+		}
+		if len(params.Fields) > 0 {
+			keys := make([]string, 0, len(params.Fields))
+			for k := range params.Fields {
+				keys = append(keys, k)
+			}
+			sort.Strings(keys)
+			fields := make([]interface{}, 0, len(keys))
+			for _, k := range keys {
+				fields = append(fields, slog.String(k, params.Fields[k]))
+			}
+			attrs = append(attrs, slog.Group("fields", fields...))
+		}
+		logger.LogAttrs(r.Context(), slog.LevelInfo, "request", attrs...)
+	}
+}
@@ -0,0 +1,75 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"log/slog"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestJSONLoggingHandler(t *testing.T) {
+	var buf bytes.Buffer
+	h := JSONLoggingHandler(&buf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		SetLogField(r, "tenant", "acme")
+		w.WriteHeader(http.StatusCreated)
+		w.Write([]byte("created"))
+	}))
+	r := newRequest("POST", "http://example.com/items?dry=1")
+	r.RemoteAddr = "192.0.2.7:4321"
+	r.Header.Set("Referer", "http://example.com/")
+	r.Header.Set("User-Agent", "test/1.0")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	line := buf.String()
+	if !strings.HasSuffix(line, "}\n") || strings.Count(line, "\n") != 1 {
+		t.Fatalf("not a JSON line: %q", line)
+	}
+	var entry map[string]interface{}
+	if err := json.Unmarshal([]byte(line), &entry); err != nil {
+		t.Fatal(err)
+	}
+	want := map[string]interface{}{
+		"method":     "POST",
+		"path":       "/items",
+		"query":      "dry=1",
+		"proto":      "HTTP/1.1",
+		"status":     float64(201),
+		"bytes":      float64(7),
+		"remote_ip":  "192.0.2.7",
+		"referer":    "http://example.com/",
+		"user_agent": "test/1.0",
+	}
+	for k, v := range want {
+		if entry[k] != v {
+			t.Errorf("%s: got %v, want %v", k, entry[k], v)
+		}
+	}
+	if _, ok := entry["latency_ms"].(float64); !ok {
+		t.Errorf("missing latency_ms in %q", line)
+	}
+	if fields, _ := entry["fields"].(map[string]interface{}); fields["tenant"] != "acme" {
+		t.Errorf("got fields %v", entry["fields"])
+	}
+}
+
+func TestSlogFormatter(t *testing.T) {
+	var buf bytes.Buffer
+	logger := slog.New(slog.NewJSONHandler(&buf, nil))
+	h := CustomLoggingHandler(nil, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		http.NotFound(w, r)
+	}), SlogFormatter(logger))
+	r := newRequest("GET", "http://example.com/missing")
+	r.RemoteAddr = "192.0.2.7:4321"
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	var entry map[string]interface{}
+	if err := json.Unmarshal(buf.Bytes(), &entry); err != nil {
+		t.Fatalf("%v: %q", err, buf.String())
+	}
+	if entry["msg"] != "request" || entry["status"] != float64(404) || entry["path"] != "/missing" || entry["remote_ip"] != "192.0.2.7" {
+		t.Errorf("unexpected entry %v", entry)
+	}
+}
@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"errors"
+	"net/http"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// LocaleOption represents a functional option for configuring the Locales
+// middleware.
+type LocaleOption func(*locales) error
+
+type locales struct {
+	h          http.Handler
+	supported  []string
+	def        string
+	query      string
+	cookieName string
+}
+
+// locale is stored in the request context by Locales.
+type locale string
+
+// LocaleDefault sets the locale of requests matching none of the supported
+// ones. It defaults to the first supported locale.
+func LocaleDefault(tag string) LocaleOption {
+	return func(l *locales) error {
+		l.def = tag
+		return nil
+	}
+}
+
+// LocaleQuery lets clients choose their locale with the named query
+// parameter, e.g. "lang", overriding the cookie and Accept-Language header.
+func LocaleQuery(param string) LocaleOption {
+	return func(l *locales) error {
+		l.query = param
+		return nil
+	}
+}
+
+// LocaleCookie lets clients choose their locale with the named cookie,
+// overriding the Accept-Language header.
+func LocaleCookie(name string) LocaleOption {
+	return func(l *locales) error {
+		l.cookieName = name
+		return nil
+	}
+}
+
+// Locales is HTTP middleware choosing the locale of each request among the
+// supported language tags, from the query parameter and cookie set with
+// LocaleQuery and LocaleCookie, then from the Accept-Language header, as
+// NegotiateLanguage does. The chosen tag is stored in the request context,
+// where it is retrieved with Locale, and sent in the Content-Language header,
+// which handlers can still change.
+//
+// Example:
+//
+//	i18n := handlers.Locales([]string{"en", "fr", "pt-BR"}, handlers.LocaleQuery("lang"))
+//	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+//		t := catalog[handlers.Locale(r)]
+//		...
+//	})
+//	http.ListenAndServe(":1123", i18n(r))
+func Locales(supported []string, opts ...LocaleOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		l := &locales{h: h, supported: supported}
+		if len(supported) > 0 {
+			l.def = supported[0]
+		}
+		for _, option := range opts {
+			option(l)
+		}
+		return l
+	}
+}
+
+// NewLocales is like Locales, but returns an error if there are no supported
+// locales or an option is invalid.
+func NewLocales(supported []string, opts ...LocaleOption) (func(http.Handler) http.Handler, error) {
+	if len(supported) == 0 {
+		return nil, errors.New("handlers: no supported locale")
+	}
+	l := &locales{supported: supported}
+	for _, option := range opts {
+		if err := option(l); err != nil {
+			return nil, err
+		}
+	}
+	return Locales(supported, opts...), nil
+}
+
+func (l *locales) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("locale", w, r)
+	defer end()
+
+	h := w.Header()
+	h.Add("Vary", "Accept-Language")
+
+	tag := ""
+	if l.query != "" {
+		tag = matchLanguage(r.URL.Query().Get(l.query), l.supported)
+	}
+	if tag == "" && l.cookieName != "" {
+		h.Add("Vary", "Cookie")
+		if c, err := r.Cookie(l.cookieName); err == nil {
+			tag = matchLanguage(c.Value, l.supported)
+		}
+	}
+	if tag == "" {
+		tag = NegotiateLanguage(r, l.supported, l.def)
+	}
+
+	if tag != "" {
+		h.Set("Content-Language", tag)
+	}
+	l.h.ServeHTTP(w, WithValue(r, locale(tag)))
+}
+
+// Locale returns the language tag chosen by Locales for r, or an empty
+// string.
+func Locale(r *http.Request) string {
+	return LocaleFromContext(r.Context())
+}
+
+// NegotiateLanguage returns the language tag among supported preferred by the
+// client according to the request's Accept-Language header, or def if none is
+// acceptable. Tags are compared case-insensitively; a language range matches
+// more specific tags ("en" matches "en-US"), and is otherwise truncated until
+// it matches ("de-CH-1996" matches "de"), following the lookup scheme of RFC
+// 4647.
+func NegotiateLanguage(r *http.Request, supported []string, def string) string {
+	type languageRange struct {
+		tag string
+		q   float64
+	}
+	var ranges []languageRange
+	for _, part := range strings.Split(r.Header.Get("Accept-Language"), ",") {
+		params := strings.Split(part, ";")
+		tag := strings.TrimSpace(params[0])
+		if tag == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		if q > 0 {
+			ranges = append(ranges, languageRange{tag, q})
+		}
+	}
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return ranges[i].q > ranges[j].q
+	})
+
+	for _, lr := range ranges {
+		if lr.tag == "*" {
+			if len(supported) > 0 {
+				return supported[0]
+			}
+			break
+		}
+		if tag := matchLanguage(lr.tag, supported); tag != "" {
+			return tag
+		}
+	}
+	return def
+}
+
+// matchLanguage returns the supported tag matching the language range tag, or
+// an empty string.
+func matchLanguage(tag string, supported []string) string {
+	tag = strings.TrimSpace(tag)
+	if tag == "" {
+		return ""
+	}
+	for _, s := range supported {
+		if strings.EqualFold(s, tag) {
+			return s
+		}
+	}
+	for _, s := range supported {
+		if len(s) > len(tag) && s[len(tag)] == '-' && strings.EqualFold(s[:len(tag)], tag) {
+			return s
+		}
+	}
+	for {
+		i := strings.LastIndexByte(tag, '-')
+		if i < 0 {
+			return ""
+		}
+		tag = tag[:i]
+		for _, s := range supported {
+			if strings.EqualFold(s, tag) {
+				return s
+			}
+		}
+	}
+}
@@ -0,0 +1,69 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNegotiateLanguage(t *testing.T) {
+	supported := []string{"en", "fr-FR", "pt-BR", "de"}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "none"},
+		{"fr-FR", "fr-FR"},
+		{"fr", "fr-FR"},
+		{"fr-fr", "fr-FR"},
+		{"de-CH-1996", "de"},
+		{"ja, pt-br;q=0.8, en;q=0.9", "en"},
+		{"en;q=0, de;q=0.1", "de"},
+		{"ja, *;q=0.5", "en"},
+		{"ja", "none"},
+	}
+	for _, test := range tests {
+		r := newRequest("GET", "/")
+		r.Header.Set("Accept-Language", test.accept)
+		if got := NegotiateLanguage(r, supported, "none"); got != test.want {
+			t.Errorf("%q: got %q want %q", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestLocales(t *testing.T) {
+	var tag string
+	h := Locales([]string{"en", "fr"}, LocaleQuery("lang"), LocaleCookie("locale"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tag = Locale(r)
+	}))
+
+	tests := []struct {
+		url, cookie, accept string
+		want                string
+	}{
+		{"/", "", "fr-CA", "fr"},
+		{"/", "", "ja", "en"},
+		{"/", "fr", "en", "fr"},
+		{"/?lang=en", "fr", "fr", "en"},
+		{"/?lang=xx", "", "fr", "fr"},
+	}
+	for _, test := range tests {
+		r := newRequest("GET", test.url)
+		r.Header.Set("Accept-Language", test.accept)
+		if test.cookie != "" {
+			r.AddCookie(&http.Cookie{Name: "locale", Value: test.cookie})
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if tag != test.want || rec.Header().Get("Content-Language") != test.want {
+			t.Errorf("%s %q %q: got %q (Content-Language %q) want %q", test.url, test.cookie, test.accept, tag, rec.Header().Get("Content-Language"), test.want)
+		}
+		if vary := rec.Header().Values("Vary"); len(vary) == 0 || vary[0] != "Accept-Language" {
+			t.Errorf("wrong Vary: %q", vary)
+		}
+	}
+
+	if _, err := NewLocales(nil); err == nil {
+		t.Error("no error without locales")
+	}
+}
@@ -5,11 +5,16 @@
 package handlers
 
 import (
+	"bufio"
+	"context"
 	"io"
 	"net"
 	"net/http"
 	"net/url"
 	"strconv"
+	"strings"
+	"sync"
+	"sync/atomic"
 	"time"
 	"unicode/utf8"
 
@@ -25,6 +30,14 @@ type LogFormatterParams struct {
 	TimeStamp  time.Time
 	StatusCode int
 	Size       int
+	// Duration is the time spent serving the request.
+	Duration time.Duration
+	// RequestID is the ID assigned to the request by RequestIDHandler, if
+	// any.
+	RequestID string
+	// Fields are the values attached to the request with SetLogField, if
+	// any.
+	Fields map[string]string
 }
 
 // LogFormatter gives the signature of the formatter function passed to CustomLoggingHandler
@@ -37,16 +50,32 @@ type loggingHandler struct {
 	writer    io.Writer
 	handler   http.Handler
 	formatter LogFormatter
+	// format names the log format, as reported by Inspect.
+	format string
 }
 
+var loggingInFlight = newInFlightCounter("logging")
+
 func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	atomic.AddInt64(&loggingInFlight.n, 1)
+	defer atomic.AddInt64(&loggingInFlight.n, -1)
+	w, req, end := beginRequestEvent("logging", w, req)
+	defer end()
+
 	t := time.Now()
-	logger, w := makeLogger(w)
+	logger, w := captureResponse(w)
 	url := *req.URL
+	fields := &logFields{Context: req.Context()}
+
+	served := req.WithContext(fields)
+	h.handler.ServeHTTP(w, served)
+	if served.MultipartForm != nil {
+		served.MultipartForm.RemoveAll()
+	}
 
-	h.handler.ServeHTTP(w, req)
-	if req.MultipartForm != nil {
-		req.MultipartForm.RemoveAll()
+	requestID := fields.readRequestID()
+	if requestID == "" {
+		requestID = requestIDFor(w, req)
 	}
 
 	params := LogFormatterParams{
@@ -55,23 +84,170 @@ func (h loggingHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
 		TimeStamp:  t,
 		StatusCode: logger.Status(),
 		Size:       logger.Size(),
+		Duration:   time.Since(t),
+		RequestID:  requestID,
+		Fields:     fields.read(),
 	}
 
 	h.formatter(h.writer, params)
 }
 
+// logFields collects the fields set with SetLogField while a request is
+// served. It is the context of the request, carrying itself as would
+// WithValue, which saves an allocation.
+type logFields struct {
+	context.Context
+	mu        sync.Mutex
+	fields    map[string]string
+	requestID string
+}
+
+func (lf *logFields) Value(key interface{}) interface{} {
+	if _, ok := key.(typedKey[*logFields]); ok {
+		return lf
+	}
+	return lf.Context.Value(key)
+}
+
+// SetLogField attaches a value to the access log entry of r, available to
+// formatters as LogFormatterParams.Fields, e.g. to tag entries with the
+// experiment variant or tenant of the request. It has no effect if r isn't
+// served through one of the logging handlers.
+func SetLogField(r *http.Request, key, value string) {
+	lf, ok := Value[*logFields](r)
+	if !ok {
+		return
+	}
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	if lf.fields == nil {
+		lf.fields = make(map[string]string)
+	}
+	lf.fields[key] = value
+}
+
+func (lf *logFields) read() map[string]string {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.fields
+}
+
+// setRequestID records the ID assigned by a RequestIDHandler further down the
+// chain, whatever the header carrying it.
+func (lf *logFields) setRequestID(id string) {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	lf.requestID = id
+}
+
+func (lf *logFields) readRequestID() string {
+	lf.mu.Lock()
+	defer lf.mu.Unlock()
+	return lf.requestID
+}
+
+// captureResponse returns a ResponseWriter writing to w, and the
+// responseLogger recording the status and size of the response. If w already
+// records them, being the ResponseWriter of an outer logging handler or
+// Instrument, it is returned as is, with its responseLogger, rather than
+// wrapped again.
+//
+// responseLoggers aren't recycled: the handler may keep the ResponseWriter
+// after returning, e.g. in a goroutine, and its late writes must not reach
+// the response of another request.
+func captureResponse(w http.ResponseWriter) (*responseLogger, http.ResponseWriter) {
+	switch lw := w.(type) {
+	case loggedResponseWriter:
+		return lw.l, w
+	case loggedHTTP1ResponseWriter:
+		return lw.l, w
+	case loggedHTTP2ResponseWriter:
+		return lw.l, w
+	}
+	return makeLogger(w)
+}
+
 func makeLogger(w http.ResponseWriter) (*responseLogger, http.ResponseWriter) {
 	logger := &responseLogger{w: w, status: http.StatusOK}
-	return logger, httpsnoop.Wrap(w, httpsnoop.Hooks{
+	return logger, logger.wrap()
+}
+
+// wrap returns a ResponseWriter writing through l, with the optional
+// interfaces of the underlying one. The response writers of the HTTP/1.x and
+// HTTP/2 servers, and plain ones, get a wrapper which doesn't allocate; the
+// others are wrapped with httpsnoop.
+func (l *responseLogger) wrap() http.ResponseWriter {
+	_, flusher := l.w.(http.Flusher)
+	_, hijacker := l.w.(http.Hijacker)
+	_, readerFrom := l.w.(io.ReaderFrom)
+	_, closeNotifier := l.w.(http.CloseNotifier)
+	_, pusher := l.w.(http.Pusher)
+	switch {
+	case !flusher && !hijacker && !readerFrom && !closeNotifier && !pusher:
+		return loggedResponseWriter{l}
+	case flusher && hijacker && readerFrom && closeNotifier && !pusher:
+		return loggedHTTP1ResponseWriter{loggedResponseWriter{l}}
+	case flusher && !hijacker && !readerFrom && closeNotifier && pusher:
+		return loggedHTTP2ResponseWriter{loggedResponseWriter{l}}
+	}
+	return httpsnoop.Wrap(l.w, httpsnoop.Hooks{
 		Write: func(httpsnoop.WriteFunc) httpsnoop.WriteFunc {
-			return logger.Write
+			return l.Write
 		},
 		WriteHeader: func(httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
-			return logger.WriteHeader
+			return l.WriteHeader
+		},
+		Hijack: func(httpsnoop.HijackFunc) httpsnoop.HijackFunc {
+			return l.Hijack
 		},
 	})
 }
 
+// loggedResponseWriter is the plain ResponseWriter returned by
+// responseLogger.wrap. Holding a single pointer, it is stored in an interface
+// without allocating.
+type loggedResponseWriter struct {
+	l *responseLogger
+}
+
+func (w loggedResponseWriter) Header() http.Header         { return w.l.w.Header() }
+func (w loggedResponseWriter) Write(b []byte) (int, error) { return w.l.Write(b) }
+func (w loggedResponseWriter) WriteHeader(code int)        { w.l.WriteHeader(code) }
+
+// loggedHTTP1ResponseWriter wraps the response writers of the HTTP/1.x server.
+type loggedHTTP1ResponseWriter struct {
+	loggedResponseWriter
+}
+
+func (w loggedHTTP1ResponseWriter) Flush() { w.l.w.(http.Flusher).Flush() }
+
+func (w loggedHTTP1ResponseWriter) Hijack() (net.Conn, *bufio.ReadWriter, error) {
+	return w.l.Hijack()
+}
+
+func (w loggedHTTP1ResponseWriter) ReadFrom(src io.Reader) (int64, error) {
+	return w.l.w.(io.ReaderFrom).ReadFrom(src)
+}
+
+func (w loggedHTTP1ResponseWriter) CloseNotify() <-chan bool {
+	return w.l.w.(http.CloseNotifier).CloseNotify()
+}
+
+// loggedHTTP2ResponseWriter wraps the response writers of the HTTP/2 server.
+type loggedHTTP2ResponseWriter struct {
+	loggedResponseWriter
+}
+
+func (w loggedHTTP2ResponseWriter) Flush() { w.l.w.(http.Flusher).Flush() }
+
+func (w loggedHTTP2ResponseWriter) CloseNotify() <-chan bool {
+	return w.l.w.(http.CloseNotifier).CloseNotify()
+}
+
+func (w loggedHTTP2ResponseWriter) Push(target string, opts *http.PushOptions) error {
+	return w.l.w.(http.Pusher).Push(target, opts)
+}
+
 const lowerhex = "0123456789abcdef"
 
 func appendQuoted(buf []byte, s string) []byte {
@@ -138,10 +314,34 @@ func appendQuoted(buf []byte, s string) []byte {
 	return buf
 }
 
+// logBufferPool recycles the buffers of the log entries, which io.Writer
+// implementations must not retain.
+var logBufferPool = sync.Pool{New: func() interface{} {
+	buf := make([]byte, 0, 256)
+	return &buf
+}}
+
+// maxPooledLogBuffer is the capacity above which log buffers aren't recycled,
+// so that a few huge entries don't pin memory.
+const maxPooledLogBuffer = 64 << 10
+
+func putLogBuffer(bp *[]byte, buf []byte) {
+	if cap(buf) > maxPooledLogBuffer {
+		return
+	}
+	*bp = buf[:0]
+	logBufferPool.Put(bp)
+}
+
 // buildCommonLogLine builds a log entry for req in Apache Common Log Format.
 // ts is the timestamp with which the entry should be logged.
 // status and size are used to provide the response HTTP status and size.
 func buildCommonLogLine(req *http.Request, url url.URL, ts time.Time, status int, size int) []byte {
+	return appendCommonLogLine(nil, req, &url, ts, status, size)
+}
+
+// appendCommonLogLine is like buildCommonLogLine, but appends the entry to buf.
+func appendCommonLogLine(buf []byte, req *http.Request, url *url.URL, ts time.Time, status int, size int) []byte {
 	username := "-"
 	if url.User != nil {
 		if name := url.User.Username(); name != "" {
@@ -149,9 +349,13 @@ func buildCommonLogLine(req *http.Request, url url.URL, ts time.Time, status int
 		}
 	}
 
-	host, _, err := net.SplitHostPort(req.RemoteAddr)
-	if err != nil {
-		host = req.RemoteAddr
+	host := req.RemoteAddr
+	// Only split addresses with a port, as the error of net.SplitHostPort
+	// allocates.
+	if strings.IndexByte(host, ':') >= 0 {
+		if h, _, err := net.SplitHostPort(host); err == nil {
+			host = h
+		}
 	}
 
 	uri := req.RequestURI
@@ -166,12 +370,14 @@ func buildCommonLogLine(req *http.Request, url url.URL, ts time.Time, status int
 		uri = url.RequestURI()
 	}
 
-	buf := make([]byte, 0, 3*(len(host)+len(username)+len(req.Method)+len(uri)+len(req.Proto)+50)/2)
+	if buf == nil {
+		buf = make([]byte, 0, 3*(len(host)+len(username)+len(req.Method)+len(uri)+len(req.Proto)+50)/2)
+	}
 	buf = append(buf, host...)
 	buf = append(buf, " - "...)
 	buf = append(buf, username...)
 	buf = append(buf, " ["...)
-	buf = append(buf, ts.Format("02/Jan/2006:15:04:05 -0700")...)
+	buf = ts.AppendFormat(buf, "02/Jan/2006:15:04:05 -0700")
 	buf = append(buf, `] "`...)
 	buf = append(buf, req.Method...)
 	buf = append(buf, " "...)
@@ -179,9 +385,9 @@ func buildCommonLogLine(req *http.Request, url url.URL, ts time.Time, status int
 	buf = append(buf, " "...)
 	buf = append(buf, req.Proto...)
 	buf = append(buf, `" `...)
-	buf = append(buf, strconv.Itoa(status)...)
+	buf = strconv.AppendInt(buf, int64(status), 10)
 	buf = append(buf, " "...)
-	buf = append(buf, strconv.Itoa(size)...)
+	buf = strconv.AppendInt(buf, int64(size), 10)
 	return buf
 }
 
@@ -189,22 +395,26 @@ func buildCommonLogLine(req *http.Request, url url.URL, ts time.Time, status int
 // ts is the timestamp with which the entry should be logged.
 // status and size are used to provide the response HTTP status and size.
 func writeLog(writer io.Writer, params LogFormatterParams) {
-	buf := buildCommonLogLine(params.Request, params.URL, params.TimeStamp, params.StatusCode, params.Size)
+	bp := logBufferPool.Get().(*[]byte)
+	buf := appendCommonLogLine(*bp, params.Request, &params.URL, params.TimeStamp, params.StatusCode, params.Size)
 	buf = append(buf, '\n')
 	writer.Write(buf)
+	putLogBuffer(bp, buf)
 }
 
 // writeCombinedLog writes a log entry for req to w in Apache Combined Log Format.
 // ts is the timestamp with which the entry should be logged.
 // status and size are used to provide the response HTTP status and size.
 func writeCombinedLog(writer io.Writer, params LogFormatterParams) {
-	buf := buildCommonLogLine(params.Request, params.URL, params.TimeStamp, params.StatusCode, params.Size)
+	bp := logBufferPool.Get().(*[]byte)
+	buf := appendCommonLogLine(*bp, params.Request, &params.URL, params.TimeStamp, params.StatusCode, params.Size)
 	buf = append(buf, ` "`...)
 	buf = appendQuoted(buf, params.Request.Referer())
 	buf = append(buf, `" "`...)
 	buf = appendQuoted(buf, params.Request.UserAgent())
 	buf = append(buf, '"', '\n')
 	writer.Write(buf)
+	putLogBuffer(bp, buf)
 }
 
 // CombinedLoggingHandler return a http.Handler that wraps h and logs requests to out in
@@ -214,7 +424,7 @@ func writeCombinedLog(writer io.Writer, params LogFormatterParams) {
 //
 // LoggingHandler always sets the ident field of the log to -
 func CombinedLoggingHandler(out io.Writer, h http.Handler) http.Handler {
-	return loggingHandler{out, h, writeCombinedLog}
+	return loggingHandler{out, h, writeCombinedLog, "combined"}
 }
 
 // LoggingHandler return a http.Handler that wraps h and logs requests to out in
@@ -234,11 +444,11 @@ func CombinedLoggingHandler(out io.Writer, h http.Handler) http.Handler {
 //  http.ListenAndServe(":1123", loggedRouter)
 //
 func LoggingHandler(out io.Writer, h http.Handler) http.Handler {
-	return loggingHandler{out, h, writeLog}
+	return loggingHandler{out, h, writeLog, "common"}
 }
 
 // CustomLoggingHandler provides a way to supply a custom log formatter
 // while taking advantage of the mechanisms in this package
 func CustomLoggingHandler(out io.Writer, h http.Handler, f LogFormatter) http.Handler {
-	return loggingHandler{out, h, f}
+	return loggingHandler{out, h, f, "custom"}
 }
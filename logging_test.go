@@ -8,6 +8,7 @@ import (
 	"bytes"
 	"encoding/base64"
 	"fmt"
+	"io"
 	"io/ioutil"
 	"math/rand"
 	"mime/multipart"
@@ -17,6 +18,7 @@ import (
 	"os"
 	"path/filepath"
 	"strings"
+	"sync"
 	"testing"
 	"time"
 )
@@ -45,6 +47,34 @@ func TestMakeLogger(t *testing.T) {
 	}
 }
 
+func TestMakeLoggerHijack(t *testing.T) {
+	var logger *responseLogger
+	s := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var lw http.ResponseWriter
+		logger, lw = makeLogger(w)
+		conn, _, err := lw.(http.Hijacker).Hijack()
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		conn.Write([]byte("HTTP/1.1 101 Switching Protocols\r\nConnection: Upgrade\r\nUpgrade: websocket\r\n\r\n"))
+		conn.Close()
+	}))
+	defer s.Close()
+
+	req, _ := http.NewRequest("GET", s.URL, nil)
+	req.Header.Set("Connection", "Upgrade")
+	req.Header.Set("Upgrade", "websocket")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if logger.Status() != http.StatusSwitchingProtocols {
+		t.Fatalf("wrong status, got %d want %d", logger.Status(), http.StatusSwitchingProtocols)
+	}
+}
+
 func TestLoggerCleanup(t *testing.T) {
 	rand.Seed(time.Now().UnixNano())
 
@@ -127,6 +157,24 @@ func TestLogPathRewrites(t *testing.T) {
 	}
 }
 
+func TestSetLogField(t *testing.T) {
+	var fields map[string]string
+	handler := http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		SetLogField(req, "tenant", "acme")
+	})
+	logger := CustomLoggingHandler(ioutil.Discard, handler, func(_ io.Writer, params LogFormatterParams) {
+		fields = params.Fields
+	})
+
+	logger.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	if fields["tenant"] != "acme" {
+		t.Fatalf("wrong fields: %v", fields)
+	}
+
+	// Without a logging handler, SetLogField is a no-op.
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+}
+
 func BenchmarkWriteLog(b *testing.B) {
 	loc, err := time.LoadLocation("Europe/Warsaw")
 	if err != nil {
@@ -383,3 +431,145 @@ func constructEncodedRequest() *http.Request {
 	req.URL, _ = url.Parse("http://example.com/test?abc=hello%20world&a=b%3F")
 	return req
 }
+
+// discardResponseWriter is a ResponseWriter which doesn't allocate, for
+// benchmarks.
+type discardResponseWriter struct {
+	header http.Header
+}
+
+func (w *discardResponseWriter) Header() http.Header         { return w.header }
+func (w *discardResponseWriter) Write(b []byte) (int, error) { return len(b), nil }
+func (w *discardResponseWriter) WriteHeader(int)             {}
+
+func (w *discardResponseWriter) reset() {
+	for k := range w.header {
+		delete(w.header, k)
+	}
+}
+
+func TestLoggingHandlerHTTP1Interfaces(t *testing.T) {
+	var buf bytes.Buffer
+	var mu sync.Mutex
+	ts := httptest.NewServer(LoggingHandler(writerFunc(func(p []byte) (int, error) {
+		mu.Lock()
+		defer mu.Unlock()
+		return buf.Write(p)
+	}), http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		_, flusher := w.(http.Flusher)
+		_, hijacker := w.(http.Hijacker)
+		_, readerFrom := w.(io.ReaderFrom)
+		_, closeNotifier := w.(http.CloseNotifier)
+		_, pusher := w.(http.Pusher)
+		if !flusher || !hijacker || !readerFrom || !closeNotifier || pusher {
+			t.Errorf("%T doesn't have the interfaces of the HTTP/1.x response writer", w)
+		}
+		w.WriteHeader(http.StatusAccepted)
+		w.Write([]byte("hello"))
+	})))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL + "/items")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	ts.Close()
+
+	mu.Lock()
+	defer mu.Unlock()
+	if line := buf.String(); !strings.Contains(line, `"GET /items HTTP/1.1" 202 5`) {
+		t.Errorf("unexpected log line %q", line)
+	}
+}
+
+func TestLoggingHandlerAllocs(t *testing.T) {
+	body := []byte("hello")
+	h := CombinedLoggingHandler(ioutil.Discard, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	r := newRequest("GET", "http://example.com/items")
+	r.RemoteAddr = "192.168.100.5:4321"
+	w := &discardResponseWriter{header: http.Header{}}
+
+	// The response logger, the request copy and its context remain.
+	if allocs := testing.AllocsPerRun(100, func() { h.ServeHTTP(w, r) }); allocs > 3 {
+		t.Errorf("got %v allocations per request, want at most 3", allocs)
+	}
+}
+
+func BenchmarkLoggingHandler(b *testing.B) {
+	body := []byte("hello")
+	h := CombinedLoggingHandler(ioutil.Discard, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Write(body)
+	}))
+	r := newRequest("GET", "http://example.com/items?q=1")
+	r.RemoteAddr = "192.168.100.5:4321"
+	r.RequestURI = "/items?q=1"
+	r.Header.Set("User-Agent", "bench/1.0")
+	w := &discardResponseWriter{header: http.Header{}}
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		w.reset()
+		h.ServeHTTP(w, r)
+	}
+}
+
+func TestLoggingHandlerRemovesParsedMultipartForm(t *testing.T) {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	fw, _ := mw.CreateFormFile("upload", "example.txt")
+	fw.Write(bytes.Repeat([]byte("x"), 1024))
+	mw.Close()
+
+	var tmpFile string
+	handler := LoggingHandler(ioutil.Discard, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if err := r.ParseMultipartForm(0); err != nil {
+			t.Fatal(err)
+		}
+		f, err := r.MultipartForm.File["upload"][0].Open()
+		if err != nil {
+			t.Fatal(err)
+		}
+		defer f.Close()
+		if osFile, ok := f.(*os.File); ok {
+			tmpFile = osFile.Name()
+		}
+	}))
+
+	r := httptest.NewRequest("POST", "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if tmpFile == "" {
+		t.Fatal("multipart form not stored on disk")
+	}
+	if _, err := os.Stat(tmpFile); !os.IsNotExist(err) {
+		t.Fatalf("expected %s to be removed, got %v", tmpFile, err)
+	}
+}
+
+func TestLoggingHandlerLateWrite(t *testing.T) {
+	var buf bytes.Buffer
+	var late http.ResponseWriter
+	h := CustomLoggingHandler(&buf, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if late == nil {
+			// Keep the ResponseWriter of the first request past its end.
+			late = w
+			return
+		}
+		late.WriteHeader(http.StatusTeapot)
+		late.Write([]byte("late"))
+		w.Write([]byte(ok))
+	}), func(w io.Writer, params LogFormatterParams) {
+		fmt.Fprintf(w, "%d %d\n", params.StatusCode, params.Size)
+	})
+
+	h.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	h.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	if want := fmt.Sprintf("200 0\n200 %d\n", len(ok)); buf.String() != want {
+		t.Fatalf("late writes of another request logged: got %q want %q", buf.String(), want)
+	}
+}
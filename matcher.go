@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// Matcher reports whether a request matches a condition, for Only and
+// Unless.
+type Matcher func(r *http.Request) bool
+
+// MatchPathPrefix matches requests whose path starts with one of the given
+// prefixes.
+func MatchPathPrefix(prefixes ...string) Matcher {
+	return func(r *http.Request) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchPath matches requests whose path matches one of the given path.Match
+// patterns, e.g. "/static/*.js".
+func MatchPath(patterns ...string) Matcher {
+	return func(r *http.Request) bool {
+		return matchAny(patterns, r.URL.Path)
+	}
+}
+
+// MatchMethods matches requests with one of the given methods.
+func MatchMethods(methods ...string) Matcher {
+	return func(r *http.Request) bool {
+		for _, m := range methods {
+			if strings.EqualFold(r.Method, m) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchHosts matches requests addressed to one of the given hosts, which may
+// be wildcards as in HostSwitch ("*.example.com").
+func MatchHosts(patterns ...string) Matcher {
+	return func(r *http.Request) bool {
+		host := normalizeHost(r.Host)
+		for _, pattern := range patterns {
+			pattern = normalizeHost(pattern)
+			if host == pattern || strings.HasPrefix(pattern, "*.") && strings.HasSuffix(host, pattern[1:]) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// MatchAll matches requests matched by all the given matchers.
+func MatchAll(matchers ...Matcher) Matcher {
+	return func(r *http.Request) bool {
+		for _, m := range matchers {
+			if !m(r) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// MatchAny matches requests matched by any of the given matchers.
+func MatchAny(matchers ...Matcher) Matcher {
+	return func(r *http.Request) bool {
+		for _, m := range matchers {
+			if m(r) {
+				return true
+			}
+		}
+		return false
+	}
+}
+
+// Only applies mw to the requests matched by m. Other requests go straight
+// to the wrapped handler.
+//
+// Example:
+//
+//	auth := handlers.Only(handlers.MatchPathPrefix("/admin/"), requireAdmin)
+//	http.ListenAndServe(":1123", auth(r))
+func Only(m Matcher, mw Middleware) Middleware {
+	return func(h http.Handler) http.Handler {
+		wrapped := mw(h)
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if m(r) {
+				wrapped.ServeHTTP(w, r)
+				return
+			}
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+// Unless applies mw to the requests not matched by m. Matched requests go
+// straight to the wrapped handler.
+//
+// Example:
+//
+//	compress := handlers.Unless(handlers.MatchPathPrefix("/stream"), handlers.CompressHandler)
+//	http.ListenAndServe(":1123", compress(r))
+func Unless(m Matcher, mw Middleware) Middleware {
+	return Only(func(r *http.Request) bool { return !m(r) }, mw)
+}
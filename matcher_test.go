@@ -0,0 +1,66 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestMatchers(t *testing.T) {
+	r := newRequest("POST", "/api/v1/users.json")
+	r.Host = "api.example.com:8080"
+
+	tests := []struct {
+		name string
+		m    Matcher
+		want bool
+	}{
+		{"prefix", MatchPathPrefix("/static/", "/api/"), true},
+		{"prefix miss", MatchPathPrefix("/static/"), false},
+		{"path", MatchPath("/api/*/*.json"), true},
+		{"path miss", MatchPath("/api/*.json"), false},
+		{"methods", MatchMethods("get", "post"), true},
+		{"methods miss", MatchMethods("GET"), false},
+		{"host", MatchHosts("api.example.com"), true},
+		{"host wildcard", MatchHosts("*.example.com"), true},
+		{"host miss", MatchHosts("example.com"), false},
+		{"all", MatchAll(MatchMethods("POST"), MatchPathPrefix("/api/")), true},
+		{"all miss", MatchAll(MatchMethods("POST"), MatchPathPrefix("/static/")), false},
+		{"any", MatchAny(MatchMethods("GET"), MatchPathPrefix("/api/")), true},
+		{"predicate", func(r *http.Request) bool { return r.URL.Query().Get("x") != "" }, false},
+	}
+	for _, test := range tests {
+		if got := test.m(r); got != test.want {
+			t.Errorf("%s: got %v want %v", test.name, got, test.want)
+		}
+	}
+}
+
+func TestOnlyUnless(t *testing.T) {
+	mark := func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Wrapped", "1")
+			h.ServeHTTP(w, r)
+		})
+	}
+	final := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+	healthz := MatchPathPrefix("/healthz")
+
+	tests := []struct {
+		mw      Middleware
+		path    string
+		wrapped bool
+	}{
+		{Only(healthz, mark), "/healthz", true},
+		{Only(healthz, mark), "/", false},
+		{Unless(healthz, mark), "/healthz", false},
+		{Unless(healthz, mark), "/", true},
+	}
+	for i, test := range tests {
+		rec := httptest.NewRecorder()
+		test.mw(final).ServeHTTP(rec, newRequest("GET", test.path))
+		if wrapped := rec.Header().Get("X-Wrapped") != ""; wrapped != test.wrapped {
+			t.Errorf("%d %s: wrapped %v want %v", i, test.path, wrapped, test.wrapped)
+		}
+	}
+}
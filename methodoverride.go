@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+// standardMethods are the methods MethodOverride canonicalizes to uppercase.
+var standardMethods = []string{
+	http.MethodGet, http.MethodHead, http.MethodPost, http.MethodPut, http.MethodPatch,
+	http.MethodDelete, http.MethodConnect, http.MethodOptions, http.MethodTrace,
+}
+
+// MethodOverrideOption represents a functional option for configuring
+// MethodOverride.
+type MethodOverrideOption func(*methodOverride) error
+
+type methodOverride struct {
+	h       http.Handler
+	header  string
+	formKey string
+	allowed []string
+	sources []string
+}
+
+// originalMethod holds the method of a request before MethodOverride.
+type originalMethod string
+
+// MethodOverrideAllow sets the methods requests can be overridden to, PUT,
+// PATCH and DELETE by default. Overrides match them case-insensitively.
+func MethodOverrideAllow(methods ...string) MethodOverrideOption {
+	return func(m *methodOverride) error {
+		m.allowed = canonicalMethods(methods)
+		return validMethods(methods)
+	}
+}
+
+// MethodOverrideSources sets the methods of the requests which can be
+// overridden, POST by default. Allowing GET requests to be overridden lets
+// mere links, which browsers follow without asking, change resources.
+func MethodOverrideSources(methods ...string) MethodOverrideOption {
+	return func(m *methodOverride) error {
+		m.sources = canonicalMethods(methods)
+		return validMethods(methods)
+	}
+}
+
+// MethodOverrideHeader sets the header naming the method, X-HTTP-Method-Override
+// by default. An empty name disables overrides by header.
+func MethodOverrideHeader(name string) MethodOverrideOption {
+	return func(m *methodOverride) error {
+		m.header = name
+		return nil
+	}
+}
+
+// MethodOverrideFormKey sets the form field naming the method, _method by
+// default. An empty key disables overrides by form field.
+func MethodOverrideFormKey(key string) MethodOverrideOption {
+	return func(m *methodOverride) error {
+		m.formKey = key
+		return nil
+	}
+}
+
+// MethodOverride is HTTP middleware letting clients which can only send GET
+// and POST requests, such as HTML forms, tunnel other methods through POST
+// requests, with the X-HTTP-Method-Override header or the _method form field,
+// which takes precedence. The form field is only read from URL-encoded and
+// multipart forms.
+//
+// Only POST requests can be overridden, to PUT, PATCH or DELETE, unless
+// configured otherwise. Overrides to other methods are answered with 400 Bad
+// Request, rather than served with the method of the request. Standard methods
+// are canonicalized to uppercase, both in requests and overrides, e.g. "delete"
+// becomes DELETE. The method before the override is returned by
+// OriginalMethod.
+//
+// Example:
+//
+//	<form method="POST" action="/articles/42">
+//		<input type="hidden" name="_method" value="DELETE">
+//		<button>Delete</button>
+//	</form>
+//
+//	http.ListenAndServe(":1123", handlers.MethodOverride()(r))
+func MethodOverride(opts ...MethodOverrideOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		m := newMethodOverride()
+		m.h = h
+		for _, option := range opts {
+			option(m)
+		}
+		return m
+	}
+}
+
+// NewMethodOverride is like MethodOverride, but returns an error if an option
+// is invalid.
+func NewMethodOverride(opts ...MethodOverrideOption) (func(http.Handler) http.Handler, error) {
+	m := newMethodOverride()
+	for _, option := range opts {
+		if err := option(m); err != nil {
+			return nil, err
+		}
+	}
+	return MethodOverride(opts...), nil
+}
+
+func newMethodOverride() *methodOverride {
+	return &methodOverride{
+		header:  HTTPMethodOverrideHeader,
+		formKey: HTTPMethodOverrideFormKey,
+		allowed: []string{http.MethodPut, http.MethodPatch, http.MethodDelete},
+		sources: []string{http.MethodPost},
+	}
+}
+
+func (m *methodOverride) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("method_override", w, r)
+	defer end()
+
+	r.Method = canonicalMethod(r.Method)
+	if !containsString(m.sources, r.Method) {
+		m.h.ServeHTTP(w, r)
+		return
+	}
+
+	override := ""
+	if m.formKey != "" && isFormRequest(r) {
+		override = r.FormValue(m.formKey)
+	}
+	if override == "" && m.header != "" {
+		override = r.Header.Get(m.header)
+	}
+	if override == "" {
+		m.h.ServeHTTP(w, r)
+		return
+	}
+
+	method := ""
+	for _, allowed := range m.allowed {
+		if strings.EqualFold(allowed, strings.TrimSpace(override)) {
+			method = allowed
+			break
+		}
+	}
+	if method == "" {
+		msg := fmt.Sprintf("method override %q not allowed", override)
+		if !writeProblem(w, r, http.StatusBadRequest, msg) {
+			http.Error(w, msg, http.StatusBadRequest)
+		}
+		return
+	}
+	r = WithValue(r, originalMethod(r.Method))
+	r.Method = method
+	m.h.ServeHTTP(w, r)
+}
+
+// OriginalMethod returns the method of r before MethodOverride overrode it,
+// or its method if it wasn't overridden.
+func OriginalMethod(r *http.Request) string {
+	if m, ok := Value[originalMethod](r); ok {
+		return string(m)
+	}
+	return r.Method
+}
+
+func isFormRequest(r *http.Request) bool {
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	return err == nil && (mt == "application/x-www-form-urlencoded" || mt == "multipart/form-data")
+}
+
+// canonicalMethod returns method in uppercase if it is a standard method.
+func canonicalMethod(method string) string {
+	for _, m := range standardMethods {
+		if strings.EqualFold(method, m) {
+			return m
+		}
+	}
+	return method
+}
+
+func canonicalMethods(methods []string) []string {
+	canonical := make([]string, len(methods))
+	for i, m := range methods {
+		canonical[i] = canonicalMethod(strings.TrimSpace(m))
+	}
+	return canonical
+}
+
+func validMethods(methods []string) error {
+	if len(methods) == 0 {
+		return errors.New("handlers: no methods")
+	}
+	for _, m := range methods {
+		if m = strings.TrimSpace(m); m == "" || strings.ContainsAny(m, " \t\"(),/:;<=>?@[\\]{}") {
+			return fmt.Errorf("handlers: invalid method %q", m)
+		}
+	}
+	return nil
+}
+
+func containsString(list []string, s string) bool {
+	for _, v := range list {
+		if v == s {
+			return true
+		}
+	}
+	return false
+}
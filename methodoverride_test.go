@@ -0,0 +1,88 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func TestMethodOverride(t *testing.T) {
+	tests := []struct {
+		name     string
+		opts     []MethodOverrideOption
+		method   string
+		form     string
+		header   string
+		code     int
+		want     string
+		original string
+	}{
+		{"header", nil, "POST", "", "DELETE", 200, "DELETE", "POST"},
+		{"form", nil, "POST", "patch", "", 200, "PATCH", "POST"},
+		{"form precedence", nil, "POST", "PUT", "DELETE", 200, "PUT", "POST"},
+		{"none", nil, "POST", "", "", 200, "POST", "POST"},
+		{"not allowed", nil, "POST", "", "CONNECT", 400, "", ""},
+		{"GET ignored", nil, "GET", "", "DELETE", 200, "GET", "GET"},
+		{"canonical", nil, "post", "", "put", 200, "PUT", "POST"},
+		{"custom allowed", []MethodOverrideOption{MethodOverrideAllow("PURGE")}, "POST", "", "purge", 200, "PURGE", "POST"},
+		{"custom sources", []MethodOverrideOption{MethodOverrideSources("GET", "POST")}, "GET", "", "DELETE", 200, "DELETE", "GET"},
+		{"header disabled", []MethodOverrideOption{MethodOverrideHeader("")}, "POST", "", "DELETE", 200, "POST", "POST"},
+		{"custom form key", []MethodOverrideOption{MethodOverrideFormKey("verb")}, "POST", "", "", 200, "POST", "POST"},
+	}
+	for _, test := range tests {
+		var method, original string
+		h := MethodOverride(test.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			method, original = r.Method, OriginalMethod(r)
+		}))
+		var r *http.Request
+		if test.form != "" {
+			body := url.Values{HTTPMethodOverrideFormKey: {test.form}}.Encode()
+			r = httptest.NewRequest(test.method, "/", strings.NewReader(body))
+			r.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+		} else {
+			r = httptest.NewRequest(test.method, "/", nil)
+		}
+		if test.header != "" {
+			r.Header.Set(HTTPMethodOverrideHeader, test.header)
+		}
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.code || method != test.want || original != test.original {
+			t.Errorf("%s: got %d %q from %q, want %d %q from %q", test.name, w.Code, method, original, test.code, test.want, test.original)
+		}
+	}
+}
+
+func TestMethodOverrideIgnoresNonFormBodies(t *testing.T) {
+	var method string
+	h := MethodOverride()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		method = r.Method
+	}))
+	r := httptest.NewRequest("POST", "/?_method=DELETE", strings.NewReader(`{"_method":"DELETE"}`))
+	r.Header.Set("Content-Type", "application/json")
+	h.ServeHTTP(httptest.NewRecorder(), r)
+	if method != "POST" {
+		t.Errorf("got method %q", method)
+	}
+}
+
+func TestNewMethodOverride(t *testing.T) {
+	tests := []struct {
+		opts []MethodOverrideOption
+		ok   bool
+	}{
+		{nil, true},
+		{[]MethodOverrideOption{MethodOverrideAllow("PUT", "delete"), MethodOverrideSources("POST")}, true},
+		{[]MethodOverrideOption{MethodOverrideAllow()}, false},
+		{[]MethodOverrideOption{MethodOverrideAllow("PU T")}, false},
+		{[]MethodOverrideOption{MethodOverrideSources("")}, false},
+	}
+	for i, test := range tests {
+		mw, err := NewMethodOverride(test.opts...)
+		if (err == nil) != test.ok || (mw != nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,348 @@
+package handlers
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"io"
+	"mime"
+	"net/http"
+	"strings"
+)
+
+const (
+	defaultMinifyMaxSize   = 1 << 20
+	defaultMinifyCacheSize = 16 << 20
+)
+
+// Minifier minifies content of a given media type.
+type Minifier interface {
+	Minify(mediaType string, dst io.Writer, src io.Reader) error
+}
+
+// MinifierFunc is an adapter to use an ordinary function as a Minifier.
+type MinifierFunc func(mediaType string, dst io.Writer, src io.Reader) error
+
+// Minify calls f(mediaType, dst, src).
+func (f MinifierFunc) Minify(mediaType string, dst io.Writer, src io.Reader) error {
+	return f(mediaType, dst, src)
+}
+
+// MinifyOption represents a functional option for configuring the Minify
+// middleware.
+type MinifyOption func(*minify) error
+
+type minify struct {
+	h          http.Handler
+	minifiers  map[string]Minifier
+	maxSize    int
+	cache      *lruStore
+	exclusions []string
+}
+
+// Minify is HTTP middleware minifying text/html and text/css responses on the
+// fly, and responses of other media types for which a Minifier is set with
+// MinifyWith, e.g. application/javascript.
+//
+// The built-in minifiers are conservative: they remove comments and collapse
+// whitespace, leaving the content of pre, textarea, script and style
+// elements untouched. For JavaScript, and for more aggressive minification,
+// plug a full-fledged minifier such as github.com/tdewolff/minify with
+// MinifyWith.
+//
+// Responses are buffered up to a maximum size (1MiB by default); larger
+// responses, responses flushed by the handler and encoded (e.g. compressed)
+// responses are passed through untouched, so the middleware must wrap
+// CompressHandler rather than the other way around. The minified output is
+// cached by content hash, so unchanged responses are only minified once.
+// Since the minified response is equivalent to the original, an ETag set by
+// the handler is kept but made weak.
+//
+// Example:
+//
+//	minify := handlers.Minify(handlers.MinifyExclude("/debug/"))
+//	http.ListenAndServe(":1123", handlers.CompressHandler(minify(r)))
+func Minify(opts ...MinifyOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		m := &minify{
+			h: h,
+			minifiers: map[string]Minifier{
+				"text/html": MinifierFunc(minifyHTML),
+				"text/css":  MinifierFunc(minifyCSS),
+			},
+			maxSize: defaultMinifyMaxSize,
+			cache:   newLRUStore(defaultMinifyCacheSize),
+		}
+		for _, option := range opts {
+			option(m)
+		}
+		return m
+	}
+}
+
+// MinifyWith sets the Minifier used for a media type, replacing the built-in
+// one if any. A nil Minifier disables minification of the media type.
+func MinifyWith(mediaType string, minifier Minifier) MinifyOption {
+	return func(m *minify) error {
+		if minifier == nil {
+			delete(m.minifiers, mediaType)
+		} else {
+			m.minifiers[mediaType] = minifier
+		}
+		return nil
+	}
+}
+
+// MinifyMaxSize sets the maximum size of the responses buffered for
+// minification. Larger responses are passed through untouched.
+func MinifyMaxSize(n int) MinifyOption {
+	return func(m *minify) error {
+		m.maxSize = n
+		return nil
+	}
+}
+
+// MinifyCacheSize sets the maximum total size of the cached minified
+// responses. The default is 16MiB.
+func MinifyCacheSize(n int) MinifyOption {
+	return func(m *minify) error {
+		m.cache.maxBytes = n
+		return nil
+	}
+}
+
+// MinifyExclude excludes the requests whose path starts with one of the
+// prefixes from minification.
+func MinifyExclude(prefixes ...string) MinifyOption {
+	return func(m *minify) error {
+		m.exclusions = append(m.exclusions, prefixes...)
+		return nil
+	}
+}
+
+func (m *minify) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("minify", w, r)
+	defer end()
+
+	if isStreamingRequest(r) {
+		m.h.ServeHTTP(w, r)
+		return
+	}
+	for _, prefix := range m.exclusions {
+		if strings.HasPrefix(r.URL.Path, prefix) {
+			m.h.ServeHTTP(w, r)
+			return
+		}
+	}
+
+	bw := &bufferedResponseWriter{w: w, max: m.maxSize}
+	m.h.ServeHTTP(bw.wrap(), r)
+	if bw.passthrough {
+		return
+	}
+
+	h := w.Header()
+	mt, _, _ := mime.ParseMediaType(h.Get("Content-Type"))
+	minifier, ok := m.minifiers[mt]
+	if !ok || h.Get("Content-Encoding") != "" || bw.buf.Len() == 0 {
+		bw.flush()
+		return
+	}
+
+	sum := sha256.Sum256(bw.buf.Bytes())
+	key := mt + " " + string(sum[:])
+	if entry, ok := m.cache.Get(key); ok {
+		bw.buf = *bytes.NewBuffer(entry.Body)
+	} else {
+		var out bytes.Buffer
+		if err := minifier.Minify(mt, &out, bytes.NewReader(bw.buf.Bytes())); err != nil {
+			// Serve the original response.
+			bw.flush()
+			return
+		}
+		m.cache.Set(key, &CachedResponse{Body: out.Bytes()})
+		bw.buf = out
+	}
+	transformedHeaders(h)
+	bw.flush()
+}
+
+// transformedHeaders adjusts the headers of a response whose body was
+// transformed into an equivalent representation: the length changed, and
+// strong validators and byte ranges don't apply anymore.
+func transformedHeaders(h http.Header) {
+	h.Del("Content-Length")
+	h.Del("Content-MD5")
+	h.Del(contentDigestHeader)
+	h.Del(reprDigestHeader)
+	if h.Get("Accept-Ranges") != "" {
+		h.Set("Accept-Ranges", "none")
+	}
+	if etag := h.Get(etagHeader); etag != "" && !strings.HasPrefix(etag, "W/") {
+		h.Set(etagHeader, "W/"+etag)
+	}
+}
+
+// minifyHTML removes comments (except conditional comments) and collapses
+// whitespace in HTML, outside of pre, textarea, script and style elements.
+func minifyHTML(mediaType string, dst io.Writer, src io.Reader) error {
+	in, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	out.Grow(len(in))
+
+	lower := bytes.ToLower(in)
+	space := false
+	for i := 0; i < len(in); {
+		switch {
+		case bytes.HasPrefix(in[i:], []byte("<!--")) && !bytes.HasPrefix(in[i:], []byte("<!--[if")):
+			end := bytes.Index(in[i+4:], []byte("-->"))
+			if end == -1 {
+				i = len(in)
+			} else {
+				i += 4 + end + 3
+			}
+
+		case in[i] == '<':
+			end := tagEnd(in, i)
+			tag := in[i:end]
+			if space {
+				out.WriteByte(' ')
+				space = false
+			}
+			out.Write(tag)
+			i = end
+			if name := rawTextElement(lower[i-len(tag):]); name != "" {
+				// Copy the content of the element verbatim.
+				closing := bytes.Index(lower[i:], []byte("</"+name))
+				if closing == -1 {
+					closing = len(in) - i
+				}
+				out.Write(in[i : i+closing])
+				i += closing
+			}
+
+		case isHTMLSpace(in[i]):
+			space = out.Len() > 0
+			i++
+
+		default:
+			if space {
+				out.WriteByte(' ')
+				space = false
+			}
+			out.WriteByte(in[i])
+			i++
+		}
+	}
+	_, err = dst.Write(out.Bytes())
+	return err
+}
+
+// tagEnd returns the index following the tag starting at in[i], skipping
+// quoted attribute values.
+func tagEnd(in []byte, i int) int {
+	var quote byte
+	for j := i + 1; j < len(in); j++ {
+		switch c := in[j]; {
+		case quote != 0:
+			if c == quote {
+				quote = 0
+			}
+		case c == '"' || c == '\'':
+			quote = c
+		case c == '>':
+			return j + 1
+		}
+	}
+	return len(in)
+}
+
+// rawTextElement returns the name of the element opened by the (lower-cased)
+// tag at the start of tag, if its content must be preserved.
+func rawTextElement(tag []byte) string {
+	for _, name := range []string{"pre", "textarea", "script", "style"} {
+		if bytes.HasPrefix(tag, []byte("<"+name)) && len(tag) > len(name)+1 {
+			if c := tag[len(name)+1]; c == '>' || c == '/' || isHTMLSpace(c) {
+				return name
+			}
+		}
+	}
+	return ""
+}
+
+func isHTMLSpace(c byte) bool {
+	return c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f'
+}
+
+// minifyCSS removes comments (except /*! comments), collapses whitespace and
+// removes it around braces, semicolons and commas in CSS.
+func minifyCSS(mediaType string, dst io.Writer, src io.Reader) error {
+	in, err := io.ReadAll(src)
+	if err != nil {
+		return err
+	}
+	var out bytes.Buffer
+	out.Grow(len(in))
+
+	isPunct := func(c byte) bool { return c == '{' || c == '}' || c == ';' || c == ',' }
+	space := false
+	for i := 0; i < len(in); {
+		c := in[i]
+		switch {
+		case bytes.HasPrefix(in[i:], []byte("/*")):
+			end := bytes.Index(in[i+2:], []byte("*/"))
+			if end == -1 {
+				end = len(in) - i - 2
+			}
+			if bytes.HasPrefix(in[i:], []byte("/*!")) {
+				out.Write(in[i:minInt(i+2+end+2, len(in))])
+			}
+			i += 2 + end + 2
+
+		case c == '"' || c == '\'':
+			j := i + 1
+			for j < len(in) && in[j] != c {
+				if in[j] == '\\' {
+					j++
+				}
+				j++
+			}
+			j = minInt(j+1, len(in))
+			if space {
+				out.WriteByte(' ')
+				space = false
+			}
+			out.Write(in[i:j])
+			i = j
+
+		case c == ' ' || c == '\t' || c == '\n' || c == '\r' || c == '\f':
+			space = out.Len() > 0 && !isPunct(out.Bytes()[out.Len()-1])
+			i++
+
+		default:
+			if isPunct(c) {
+				space = false
+				if c == '}' && out.Len() > 0 && out.Bytes()[out.Len()-1] == ';' {
+					out.Truncate(out.Len() - 1)
+				}
+			}
+			if space {
+				out.WriteByte(' ')
+				space = false
+			}
+			out.WriteByte(c)
+			i++
+		}
+	}
+	_, err = dst.Write(out.Bytes())
+	return err
+}
+
+func minInt(a, b int) int {
+	if a < b {
+		return a
+	}
+	return b
+}
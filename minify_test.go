@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestMinifyHTML(t *testing.T) {
+	in := `<!DOCTYPE html>
+<html>
+  <!-- a comment -->
+  <!--[if IE]><p>IE</p><![endif]-->
+  <body class="a  b">
+    <p>Hello,
+       world!</p>
+    <pre>  keep
+   this  </pre>
+    <script>
+      var s = "a  b"; // <!-- not a comment -->
+    </script>
+  </body>
+</html>
+`
+	want := `<!DOCTYPE html> <html> <!--[if IE]><p>IE</p><![endif]--> <body class="a  b"> <p>Hello, world!</p> <pre>  keep
+   this  </pre> <script>
+      var s = "a  b"; // <!-- not a comment -->
+    </script> </body> </html>`
+
+	var out bytes.Buffer
+	if err := minifyHTML("text/html", &out, strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Fatalf("bad minified HTML:\ngot  %q\nwant %q", out.String(), want)
+	}
+}
+
+func TestMinifyCSS(t *testing.T) {
+	in := `/*! license */
+/* comment */
+a :hover , b > c {
+  color : red;
+  content: "a  /* b */  c";
+}
+`
+	want := `/*! license */ a :hover,b > c{color : red;content: "a  /* b */  c"}`
+
+	var out bytes.Buffer
+	if err := minifyCSS("text/css", &out, strings.NewReader(in)); err != nil {
+		t.Fatal(err)
+	}
+	if out.String() != want {
+		t.Fatalf("bad minified CSS:\ngot  %q\nwant %q", out.String(), want)
+	}
+}
+
+func TestMinify(t *testing.T) {
+	calls := 0
+	upper := MinifierFunc(func(mediaType string, dst io.Writer, src io.Reader) error {
+		calls++
+		b, _ := io.ReadAll(src)
+		_, err := dst.Write(bytes.ToUpper(b))
+		return err
+	})
+	minify := Minify(MinifyWith("application/javascript", upper), MinifyExclude("/raw/"))
+
+	var contentType, body string
+	handler := minify(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", contentType)
+		w.Header().Set("Content-Length", "100")
+		w.Header().Set(etagHeader, `"v1"`)
+		io.WriteString(w, body)
+	}))
+	serve := func(path, ct, b string) *httptest.ResponseRecorder {
+		contentType, body = ct, b
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", path))
+		return rec
+	}
+
+	rec := serve("/", "text/html; charset=utf-8", "<p>  a  </p>")
+	if rec.Body.String() != "<p> a </p>" {
+		t.Errorf("bad HTML response: %q", rec.Body.String())
+	}
+	if rec.Header().Get("Content-Length") != "" || rec.Header().Get(etagHeader) != `W/"v1"` {
+		t.Errorf("bad headers: %v", rec.Header())
+	}
+
+	for i := 0; i < 2; i++ {
+		if rec = serve("/app.js", "application/javascript", "var a"); rec.Body.String() != "VAR A" {
+			t.Errorf("bad JS response: %q", rec.Body.String())
+		}
+	}
+	if calls != 1 {
+		t.Errorf("minified output not cached: %d calls", calls)
+	}
+
+	if rec = serve("/raw/page", "text/html", "<p>  a  </p>"); rec.Body.String() != "<p>  a  </p>" {
+		t.Errorf("excluded path minified: %q", rec.Body.String())
+	}
+	if rec = serve("/data", "application/json", "{  }"); rec.Body.String() != "{  }" {
+		t.Errorf("JSON minified: %q", rec.Body.String())
+	}
+}
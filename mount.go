@@ -0,0 +1,77 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/url"
+	"path"
+	"strings"
+)
+
+// StripPrefix is like http.StripPrefix, but stores the stripped prefix in the
+// request's context, so that handlers mounted under a prefix can build links
+// and redirects to their own resources with MountPath and MountURL. Nested
+// prefixes are accumulated.
+//
+// Example:
+//
+//	mux.Handle("/api/v1/", handlers.StripPrefix("/api/v1", api))
+//
+//	// In api, serving /api/v1/users:
+//	http.Redirect(w, r, handlers.MountPath(r, "/users/"+id), http.StatusSeeOther)
+func StripPrefix(prefix string, h http.Handler) http.Handler {
+	if prefix == "" {
+		return h
+	}
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("strip_prefix", w, r)
+		defer end()
+
+		p := strings.TrimPrefix(r.URL.Path, prefix)
+		rp := strings.TrimPrefix(r.URL.RawPath, prefix)
+		if len(p) == len(r.URL.Path) || (r.URL.RawPath != "" && len(rp) == len(r.URL.RawPath)) {
+			http.NotFound(w, r)
+			return
+		}
+
+		ctx := context.WithValue(r.Context(), mountPrefixKey, MountPrefix(r)+strings.TrimSuffix(prefix, "/"))
+		r2 := r.WithContext(ctx)
+		r2.URL = new(url.URL)
+		*r2.URL = *r.URL
+		r2.URL.Path = p
+		r2.URL.RawPath = rp
+		h.ServeHTTP(w, r2)
+	})
+}
+
+// MountPrefix returns the path prefixes stripped from the request by
+// StripPrefix, e.g. "/api/v1", or an empty string if there are none.
+func MountPrefix(r *http.Request) string {
+	return MountPrefixFromContext(r.Context())
+}
+
+// MountPath returns the absolute path of p, a path relative to the prefix
+// the handler is mounted under. A trailing slash is preserved.
+func MountPath(r *http.Request, p string) string {
+	joined := path.Join("/", MountPrefix(r), p)
+	if strings.HasSuffix(p, "/") && joined != "/" {
+		joined += "/"
+	}
+	return joined
+}
+
+// MountURL returns the absolute URL of p, a path relative to the prefix the
+// handler is mounted under, on the host the request was addressed to. The
+// scheme is taken from the request URL, as set by ProxyHeaders, and defaults
+// to https for TLS connections and http otherwise.
+func MountURL(r *http.Request, p string) string {
+	scheme := r.URL.Scheme
+	if scheme == "" {
+		scheme = "http"
+		if r.TLS != nil {
+			scheme = "https"
+		}
+	}
+	u := url.URL{Scheme: scheme, Host: r.Host, Path: MountPath(r, p)}
+	return u.String()
+}
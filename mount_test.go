@@ -0,0 +1,61 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStripPrefix(t *testing.T) {
+	var path, prefix string
+	inner := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path = r.URL.Path
+		prefix = MountPrefix(r)
+	})
+	handler := StripPrefix("/api", StripPrefix("/v1/", inner))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/api/v1/users"))
+	if path != "users" || prefix != "/api/v1" {
+		t.Fatalf("got path %q prefix %q", path, prefix)
+	}
+
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/other"))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("wrong status: got %d want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestMountPath(t *testing.T) {
+	var r *http.Request
+	handler := StripPrefix("/api/v1", http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		r = req
+	}))
+	req := newRequest("GET", "/api/v1/users")
+	req.Host = "example.com"
+	req.TLS = &tls.ConnectionState{}
+	handler.ServeHTTP(httptest.NewRecorder(), req)
+
+	tests := []struct {
+		path string
+		want string
+	}{
+		{"/users/1", "/api/v1/users/1"},
+		{"users/", "/api/v1/users/"},
+		{"", "/api/v1"},
+		{"../x", "/api/x"},
+	}
+	for _, test := range tests {
+		if got := MountPath(r, test.path); got != test.want {
+			t.Errorf("MountPath(%q): got %q want %q", test.path, got, test.want)
+		}
+	}
+	if got, want := MountURL(r, "/users"), "https://example.com/api/v1/users"; got != want {
+		t.Errorf("MountURL: got %q want %q", got, want)
+	}
+	if got := MountPath(newRequest("GET", "/"), "/users/"); got != "/users/" {
+		t.Errorf("MountPath without prefix: got %q", got)
+	}
+}
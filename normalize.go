@@ -0,0 +1,136 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"strings"
+)
+
+// singletonHeaders are request headers whose values can't be combined into a
+// comma-separated list, because they aren't defined as lists or their values
+// may contain commas.
+var singletonHeaders = map[string]bool{
+	"Authorization":       true,
+	"Content-Length":      true,
+	"Content-Type":        true,
+	"Date":                true,
+	"From":                true,
+	"Host":                true,
+	"If-Modified-Since":   true,
+	"If-Range":            true,
+	"If-Unmodified-Since": true,
+	"Max-Forwards":        true,
+	"Proxy-Authorization": true,
+	"Range":               true,
+	"Referer":             true,
+	"User-Agent":          true,
+}
+
+// NormalizeRequests is HTTP middleware canonicalizing requests before they
+// are routed, so that equivalent requests look the same to routers, caches
+// and handlers:
+//
+//   - the host is lowercased, and the default port of the scheme (80 for
+//     http, 443 for https) removed;
+//   - percent-encoded unreserved characters in the path are decoded, and the
+//     remaining escapes uppercased, as in RFC 3986 section 6.2.2, so that
+//     "/%7euser/a%2fb" becomes "/~user/a%2Fb";
+//   - header fields sent on several lines are merged into one
+//     comma-separated line, except for those which aren't lists; Cookie lines
+//     are joined with "; ".
+//
+// Use it after ProxyHeaders, which may change the host and scheme.
+func NormalizeRequests(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("normalize", w, r)
+		defer end()
+
+		scheme := r.URL.Scheme
+		if scheme == "" {
+			scheme = "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+		}
+		r.Host = normalizeRequestHost(r.Host, scheme)
+		if r.URL.Host != "" {
+			r.URL.Host = normalizeRequestHost(r.URL.Host, scheme)
+		}
+
+		if escaped := normalizeEscapes(r.URL.EscapedPath()); escaped != r.URL.EscapedPath() {
+			r.URL.RawPath = escaped
+		}
+
+		for name, values := range r.Header {
+			if len(values) < 2 || singletonHeaders[name] {
+				continue
+			}
+			sep := ", "
+			if name == "Cookie" {
+				sep = "; "
+			}
+			r.Header[name] = []string{strings.Join(values, sep)}
+		}
+
+		h.ServeHTTP(w, r)
+	})
+}
+
+// normalizeRequestHost lowercases host and removes the default port of
+// scheme.
+func normalizeRequestHost(host, scheme string) string {
+	host = strings.ToLower(host)
+	if h, port, err := net.SplitHostPort(host); err == nil {
+		if (scheme == "http" && port == "80") || (scheme == "https" && port == "443") {
+			if strings.Contains(h, ":") {
+				return "[" + h + "]"
+			}
+			return h
+		}
+	}
+	return host
+}
+
+// normalizeEscapes decodes the percent-encoded unreserved characters of the
+// escaped path p and uppercases the other escapes.
+func normalizeEscapes(p string) string {
+	if !strings.Contains(p, "%") {
+		return p
+	}
+	var b strings.Builder
+	b.Grow(len(p))
+	for i := 0; i < len(p); i++ {
+		if p[i] != '%' || i+2 >= len(p) || !isHex(p[i+1]) || !isHex(p[i+2]) {
+			b.WriteByte(p[i])
+			continue
+		}
+		c := unhex(p[i+1])<<4 | unhex(p[i+2])
+		if isUnreserved(c) {
+			b.WriteByte(c)
+		} else {
+			b.WriteString(strings.ToUpper(p[i : i+3]))
+		}
+		i += 2
+	}
+	return b.String()
+}
+
+func isHex(c byte) bool {
+	return '0' <= c && c <= '9' || 'a' <= c && c <= 'f' || 'A' <= c && c <= 'F'
+}
+
+func unhex(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	}
+	return c - 'A' + 10
+}
+
+// isUnreserved reports whether c is an unreserved character of RFC 3986.
+func isUnreserved(c byte) bool {
+	return 'a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' ||
+		c == '-' || c == '.' || c == '_' || c == '~'
+}
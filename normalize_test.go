@@ -0,0 +1,60 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestNormalizeRequests(t *testing.T) {
+	var got *http.Request
+	h := NormalizeRequests(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+
+	r := newRequest("GET", "/%7euser/a%2fb/%41")
+	r.Host = "Example.COM:80"
+	r.Header["Accept"] = []string{"text/html", "application/json"}
+	r.Header["Cookie"] = []string{"a=1", "b=2"}
+	r.Header["User-Agent"] = []string{"one", "two"}
+	h.ServeHTTP(httptest.NewRecorder(), r)
+
+	if got.Host != "example.com" {
+		t.Errorf("wrong host: %q", got.Host)
+	}
+	if p := got.URL.EscapedPath(); p != "/~user/a%2Fb/A" {
+		t.Errorf("wrong escaped path: %q", p)
+	}
+	if got.URL.Path != "/~user/a/b/A" {
+		t.Errorf("wrong path: %q", got.URL.Path)
+	}
+	for name, want := range map[string][]string{
+		"Accept":     {"text/html, application/json"},
+		"Cookie":     {"a=1; b=2"},
+		"User-Agent": {"one", "two"},
+	} {
+		if v := got.Header[name]; len(v) != len(want) || v[0] != want[0] {
+			t.Errorf("wrong %s header: %q", name, v)
+		}
+	}
+	if c, err := got.Cookie("b"); err != nil || c.Value != "2" {
+		t.Errorf("merged cookies not parsed: %v %v", c, err)
+	}
+}
+
+func TestNormalizeRequestHost(t *testing.T) {
+	tests := []struct {
+		host, scheme, want string
+	}{
+		{"example.com:443", "https", "example.com"},
+		{"example.com:443", "http", "example.com:443"},
+		{"example.com:8080", "http", "example.com:8080"},
+		{"[::1]:80", "http", "[::1]"},
+		{"EXAMPLE.com", "http", "example.com"},
+	}
+	for _, test := range tests {
+		if got := normalizeRequestHost(test.host, test.scheme); got != test.want {
+			t.Errorf("%s %s: got %q want %q", test.scheme, test.host, got, test.want)
+		}
+	}
+}
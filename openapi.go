@@ -0,0 +1,919 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"math"
+	"mime"
+	"net/http"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"unicode/utf8"
+)
+
+const defaultOpenAPIMaxBodySize = 1 << 20
+
+// OpenAPI is an OpenAPI 3 document loaded with LoadOpenAPI, against which
+// OpenAPIValidator validates requests.
+//
+// The following subset of the specification is supported: path templates;
+// path, query, header and cookie parameters of primitive types or arrays of
+// them; JSON request and response bodies; and in schemas, the type, nullable,
+// enum, properties, required, additionalProperties, items, minimum, maximum,
+// exclusiveMinimum, exclusiveMaximum, minLength, maxLength, pattern,
+// minItems, maxItems, allOf, anyOf and oneOf keywords, and local $ref
+// references. Other keywords, such as format, are ignored.
+type OpenAPI struct {
+	routes     []*openAPIRoute
+	components struct {
+		Schemas       map[string]*openAPISchema      `json:"schemas"`
+		Parameters    map[string]*openAPIParameter   `json:"parameters"`
+		RequestBodies map[string]*openAPIRequestBody `json:"requestBodies"`
+		Responses     map[string]*openAPIResponse    `json:"responses"`
+	}
+}
+
+type openAPIRoute struct {
+	segments   []string
+	templated  int
+	operations map[string]*openAPIOperation
+}
+
+type openAPIOperation struct {
+	Parameters  []*openAPIParameter         `json:"parameters"`
+	RequestBody *openAPIRequestBody         `json:"requestBody"`
+	Responses   map[string]*openAPIResponse `json:"responses"`
+}
+
+type openAPIParameter struct {
+	Ref      string         `json:"$ref"`
+	Name     string         `json:"name"`
+	In       string         `json:"in"`
+	Required bool           `json:"required"`
+	Explode  *bool          `json:"explode"`
+	Schema   *openAPISchema `json:"schema"`
+}
+
+type openAPIRequestBody struct {
+	Ref      string                       `json:"$ref"`
+	Required bool                         `json:"required"`
+	Content  map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIResponse struct {
+	Ref     string                       `json:"$ref"`
+	Content map[string]*openAPIMediaType `json:"content"`
+}
+
+type openAPIMediaType struct {
+	Schema *openAPISchema `json:"schema"`
+}
+
+type openAPISchema struct {
+	Ref                  string                    `json:"$ref"`
+	Type                 json.RawMessage           `json:"type"`
+	Nullable             bool                      `json:"nullable"`
+	Enum                 []interface{}             `json:"enum"`
+	Properties           map[string]*openAPISchema `json:"properties"`
+	Required             []string                  `json:"required"`
+	AdditionalProperties json.RawMessage           `json:"additionalProperties"`
+	Items                *openAPISchema            `json:"items"`
+	Minimum              *float64                  `json:"minimum"`
+	Maximum              *float64                  `json:"maximum"`
+	ExclusiveMinimum     json.RawMessage           `json:"exclusiveMinimum"`
+	ExclusiveMaximum     json.RawMessage           `json:"exclusiveMaximum"`
+	MinLength            *int                      `json:"minLength"`
+	MaxLength            *int                      `json:"maxLength"`
+	Pattern              string                    `json:"pattern"`
+	MinItems             *int                      `json:"minItems"`
+	MaxItems             *int                      `json:"maxItems"`
+	AllOf                []*openAPISchema          `json:"allOf"`
+	AnyOf                []*openAPISchema          `json:"anyOf"`
+	OneOf                []*openAPISchema          `json:"oneOf"`
+
+	// Compiled by LoadOpenAPI.
+	types        []string
+	pattern      *regexp.Regexp
+	additional   *openAPISchema
+	noAdditional bool
+	exclMin      *float64
+	exclMax      *float64
+}
+
+// LoadOpenAPI decodes an OpenAPI 3 document in JSON from r. YAML documents
+// can be used by converting them to JSON first, e.g. with sigs.k8s.io/yaml.
+func LoadOpenAPI(r io.Reader) (*OpenAPI, error) {
+	var raw struct {
+		OpenAPI    string                                `json:"openapi"`
+		Paths      map[string]map[string]json.RawMessage `json:"paths"`
+		Components json.RawMessage                       `json:"components"`
+	}
+	if err := json.NewDecoder(r).Decode(&raw); err != nil {
+		return nil, fmt.Errorf("handlers: invalid OpenAPI document: %v", err)
+	}
+	if !strings.HasPrefix(raw.OpenAPI, "3.") {
+		return nil, fmt.Errorf("handlers: unsupported OpenAPI version %q", raw.OpenAPI)
+	}
+
+	doc := &OpenAPI{}
+	if len(raw.Components) > 0 {
+		if err := json.Unmarshal(raw.Components, &doc.components); err != nil {
+			return nil, fmt.Errorf("handlers: invalid OpenAPI components: %v", err)
+		}
+	}
+	for _, s := range doc.components.Schemas {
+		if err := doc.compileSchema(s); err != nil {
+			return nil, err
+		}
+	}
+
+	for path, item := range raw.Paths {
+		route := &openAPIRoute{operations: map[string]*openAPIOperation{}}
+		for _, seg := range strings.Split(strings.Trim(path, "/"), "/") {
+			if strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+				route.templated++
+			}
+			route.segments = append(route.segments, seg)
+		}
+
+		var common []*openAPIParameter
+		if params, ok := item["parameters"]; ok {
+			if err := json.Unmarshal(params, &common); err != nil {
+				return nil, fmt.Errorf("handlers: invalid OpenAPI parameters of %s: %v", path, err)
+			}
+		}
+		for key, value := range item {
+			method := strings.ToUpper(key)
+			switch method {
+			case "GET", "PUT", "POST", "DELETE", "OPTIONS", "HEAD", "PATCH", "TRACE":
+			default:
+				continue
+			}
+			op := &openAPIOperation{}
+			if err := json.Unmarshal(value, op); err != nil {
+				return nil, fmt.Errorf("handlers: invalid OpenAPI operation %s %s: %v", method, path, err)
+			}
+			if err := doc.compileOperation(op, common); err != nil {
+				return nil, fmt.Errorf("handlers: OpenAPI operation %s %s: %v", method, path, err)
+			}
+			route.operations[method] = op
+		}
+		doc.routes = append(doc.routes, route)
+	}
+	// Concrete paths take precedence over templated ones.
+	sort.SliceStable(doc.routes, func(i, j int) bool {
+		return doc.routes[i].templated < doc.routes[j].templated
+	})
+	return doc, nil
+}
+
+// compileOperation resolves the references of op and merges the common
+// parameters of its path into its own.
+func (doc *OpenAPI) compileOperation(op *openAPIOperation, common []*openAPIParameter) error {
+	var params []*openAPIParameter
+	seen := map[string]bool{}
+	for _, list := range [][]*openAPIParameter{op.Parameters, common} {
+		for _, p := range list {
+			if p.Ref != "" {
+				ref, ok := doc.components.Parameters[strings.TrimPrefix(p.Ref, "#/components/parameters/")]
+				if !ok {
+					return fmt.Errorf("unresolved reference %q", p.Ref)
+				}
+				p = ref
+			}
+			if seen[p.In+":"+p.Name] {
+				continue
+			}
+			seen[p.In+":"+p.Name] = true
+			if p.Schema != nil {
+				if err := doc.compileSchema(p.Schema); err != nil {
+					return err
+				}
+			}
+			params = append(params, p)
+		}
+	}
+	op.Parameters = params
+
+	if rb := op.RequestBody; rb != nil && rb.Ref != "" {
+		ref, ok := doc.components.RequestBodies[strings.TrimPrefix(rb.Ref, "#/components/requestBodies/")]
+		if !ok {
+			return fmt.Errorf("unresolved reference %q", rb.Ref)
+		}
+		op.RequestBody = ref
+	}
+	if rb := op.RequestBody; rb != nil {
+		for _, mt := range rb.Content {
+			if mt != nil && mt.Schema != nil {
+				if err := doc.compileSchema(mt.Schema); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	for code, res := range op.Responses {
+		if res.Ref != "" {
+			ref, ok := doc.components.Responses[strings.TrimPrefix(res.Ref, "#/components/responses/")]
+			if !ok {
+				return fmt.Errorf("unresolved reference %q", res.Ref)
+			}
+			op.Responses[code] = ref
+			res = ref
+		}
+		for _, mt := range res.Content {
+			if mt != nil && mt.Schema != nil {
+				if err := doc.compileSchema(mt.Schema); err != nil {
+					return err
+				}
+			}
+		}
+	}
+	return nil
+}
+
+// compileSchema checks the references of s and its subschemas, and prepares
+// them for validation.
+func (doc *OpenAPI) compileSchema(s *openAPISchema) error {
+	if s == nil || s.types != nil {
+		return nil
+	}
+	if s.Ref != "" {
+		if _, err := doc.resolveSchema(s); err != nil {
+			return err
+		}
+	}
+	s.types = []string{}
+	if len(s.Type) > 0 {
+		var t string
+		if err := json.Unmarshal(s.Type, &t); err == nil {
+			s.types = []string{t}
+		} else if err := json.Unmarshal(s.Type, &s.types); err != nil {
+			return fmt.Errorf("invalid schema type %s", s.Type)
+		}
+	}
+	if s.Pattern != "" {
+		re, err := regexp.Compile(s.Pattern)
+		if err != nil {
+			return fmt.Errorf("invalid schema pattern %q: %v", s.Pattern, err)
+		}
+		s.pattern = re
+	}
+	if len(s.AdditionalProperties) > 0 {
+		var allowed bool
+		if err := json.Unmarshal(s.AdditionalProperties, &allowed); err == nil {
+			s.noAdditional = !allowed
+		} else {
+			s.additional = &openAPISchema{}
+			if err := json.Unmarshal(s.AdditionalProperties, s.additional); err != nil {
+				return fmt.Errorf("invalid additionalProperties: %v", err)
+			}
+		}
+	}
+	// exclusiveMinimum is a boolean modifier of minimum in OpenAPI 3.0, and a
+	// bound of its own in 3.1.
+	for _, excl := range []struct {
+		raw   json.RawMessage
+		bound *float64
+		dst   **float64
+	}{{s.ExclusiveMinimum, s.Minimum, &s.exclMin}, {s.ExclusiveMaximum, s.Maximum, &s.exclMax}} {
+		if len(excl.raw) == 0 {
+			continue
+		}
+		var b bool
+		var f float64
+		if err := json.Unmarshal(excl.raw, &b); err == nil {
+			if b && excl.bound != nil {
+				*excl.dst = excl.bound
+			}
+		} else if err := json.Unmarshal(excl.raw, &f); err == nil {
+			*excl.dst = &f
+		}
+	}
+
+	subschemas := []*openAPISchema{s.Items, s.additional}
+	subschemas = append(subschemas, s.AllOf...)
+	subschemas = append(subschemas, s.AnyOf...)
+	subschemas = append(subschemas, s.OneOf...)
+	for _, p := range s.Properties {
+		subschemas = append(subschemas, p)
+	}
+	for _, sub := range subschemas {
+		if err := doc.compileSchema(sub); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// resolveSchema follows the $ref of s, if any.
+func (doc *OpenAPI) resolveSchema(s *openAPISchema) (*openAPISchema, error) {
+	for depth := 0; s.Ref != ""; depth++ {
+		ref, ok := doc.components.Schemas[strings.TrimPrefix(s.Ref, "#/components/schemas/")]
+		if !ok || depth > 32 {
+			return nil, fmt.Errorf("unresolved reference %q", s.Ref)
+		}
+		s = ref
+	}
+	return s, nil
+}
+
+// match returns the route of path, and the values of its path parameters.
+func (doc *OpenAPI) match(path string) (*openAPIRoute, map[string]string) {
+	segments := strings.Split(strings.Trim(path, "/"), "/")
+Routes:
+	for _, route := range doc.routes {
+		if len(route.segments) != len(segments) {
+			continue
+		}
+		var params map[string]string
+		for i, seg := range route.segments {
+			if route.templated > 0 && strings.HasPrefix(seg, "{") && strings.HasSuffix(seg, "}") {
+				if segments[i] == "" {
+					continue Routes
+				}
+				if params == nil {
+					params = map[string]string{}
+				}
+				params[seg[1:len(seg)-1]] = segments[i]
+			} else if seg != segments[i] {
+				continue Routes
+			}
+		}
+		return route, params
+	}
+	return nil, nil
+}
+
+// operation returns the operation of route for method, or nil.
+func (route *openAPIRoute) operation(method string) *openAPIOperation {
+	op := route.operations[method]
+	if op == nil && method == "HEAD" {
+		op = route.operations["GET"]
+	}
+	return op
+}
+
+// allow returns the methods of route, for the Allow header.
+func (route *openAPIRoute) allow() string {
+	methods := make([]string, 0, len(route.operations))
+	for method := range route.operations {
+		methods = append(methods, method)
+	}
+	sort.Strings(methods)
+	return strings.Join(methods, ", ")
+}
+
+// OpenAPIOption represents a functional option for configuring
+// OpenAPIValidator.
+type OpenAPIOption func(*openAPIValidator) error
+
+type openAPIValidator struct {
+	h                 http.Handler
+	doc               *OpenAPI
+	basePath          string
+	passUnknown       bool
+	validateResponses bool
+	maxBodySize       int64
+}
+
+// OpenAPIBasePath sets the path prefix under which the API is served, which
+// the paths of the document are relative to, e.g. "/api/v1".
+func OpenAPIBasePath(prefix string) OpenAPIOption {
+	return func(v *openAPIValidator) error {
+		v.basePath = strings.TrimSuffix(prefix, "/")
+		return nil
+	}
+}
+
+// OpenAPIPassUnknown lets requests for paths which aren't in the document
+// through, unvalidated. By default they are answered with 404 Not Found.
+func OpenAPIPassUnknown() OpenAPIOption {
+	return func(v *openAPIValidator) error {
+		v.passUnknown = true
+		return nil
+	}
+}
+
+// OpenAPIValidateResponses validates responses too, replacing the invalid
+// ones with 500 Internal Server Error problems listing the errors. Responses
+// are buffered to do so, which makes it best suited to development and
+// testing.
+func OpenAPIValidateResponses() OpenAPIOption {
+	return func(v *openAPIValidator) error {
+		v.validateResponses = true
+		return nil
+	}
+}
+
+// OpenAPIMaxBodySize sets the maximum size of the request bodies read for
+// validation, 1MiB by default. Larger bodies are rejected with 413 Request
+// Entity Too Large.
+func OpenAPIMaxBodySize(n int64) OpenAPIOption {
+	return func(v *openAPIValidator) error {
+		v.maxBodySize = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid OpenAPI max body size %d", n)
+		}
+		return nil
+	}
+}
+
+// OpenAPIValidator is HTTP middleware validating requests against doc: their
+// path and method, their parameters and their JSON body. Invalid requests are
+// answered with 400 Bad Request application/problem+json documents, whose
+// errors member lists each violation with its location as a ValidationError.
+// Requests for unknown paths and methods are answered with 404 Not Found and
+// 405 Method Not Allowed, and bodies of undeclared media types with 415
+// Unsupported Media Type.
+//
+// Example:
+//
+//	f, _ := os.Open("openapi.json")
+//	doc, err := handlers.LoadOpenAPI(f)
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	validate := handlers.OpenAPIValidator(doc, handlers.OpenAPIBasePath("/api"))
+//	http.ListenAndServe(":1123", validate(r))
+func OpenAPIValidator(doc *OpenAPI, opts ...OpenAPIOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		v := &openAPIValidator{h: h, doc: doc, maxBodySize: defaultOpenAPIMaxBodySize}
+		for _, option := range opts {
+			option(v)
+		}
+		return v
+	}
+}
+
+// NewOpenAPIValidator is like OpenAPIValidator, but returns an error if doc
+// is nil or an option is invalid.
+func NewOpenAPIValidator(doc *OpenAPI, opts ...OpenAPIOption) (func(http.Handler) http.Handler, error) {
+	if doc == nil {
+		return nil, errors.New("handlers: nil OpenAPI document")
+	}
+	v := &openAPIValidator{}
+	for _, option := range opts {
+		if err := option(v); err != nil {
+			return nil, err
+		}
+	}
+	return OpenAPIValidator(doc, opts...), nil
+}
+
+func (v *openAPIValidator) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("openapi", w, r)
+	defer end()
+
+	if IsRPCRequest(r) {
+		v.h.ServeHTTP(w, r)
+		return
+	}
+	path := r.URL.Path
+	if v.basePath != "" {
+		if path != v.basePath && !strings.HasPrefix(path, v.basePath+"/") {
+			v.unknown(w, r)
+			return
+		}
+		path = strings.TrimPrefix(path, v.basePath)
+	}
+	route, pathParams := v.doc.match(path)
+	if route == nil {
+		v.unknown(w, r)
+		return
+	}
+	op := route.operation(r.Method)
+	if op == nil {
+		w.Header().Set("Allow", route.allow())
+		WriteProblem(w, r, Problem{Status: http.StatusMethodNotAllowed})
+		return
+	}
+
+	var errs ValidationErrors
+	v.validateParameters(r, op, pathParams, &errs)
+	if code, ok := v.validateBody(r, op, &errs); !ok {
+		writeValidationErrors(w, r, code, errs)
+		return
+	}
+	if len(errs) > 0 {
+		writeValidationErrors(w, r, http.StatusBadRequest, errs)
+		return
+	}
+
+	if !v.validateResponses || IsUpgradeRequest(r) {
+		v.h.ServeHTTP(w, r)
+		return
+	}
+	bw := &bufferedResponseWriter{w: w, max: math.MaxInt32}
+	v.h.ServeHTTP(bw.wrap(), r)
+	if bw.passthrough {
+		return
+	}
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	var resErrs ValidationErrors
+	v.doc.validateResponse(op, bw.status, w.Header().Get("Content-Type"), bw.buf.Bytes(), &resErrs)
+	if len(resErrs) > 0 {
+		writeProblemDocument(w, r, Problem{Status: http.StatusInternalServerError, Detail: "invalid response"}, resErrs)
+		return
+	}
+	bw.flush()
+}
+
+func (v *openAPIValidator) unknown(w http.ResponseWriter, r *http.Request) {
+	if v.passUnknown {
+		v.h.ServeHTTP(w, r)
+		return
+	}
+	WriteProblem(w, r, Problem{Status: http.StatusNotFound})
+}
+
+// validateParameters validates the parameters of r declared by op.
+func (v *openAPIValidator) validateParameters(r *http.Request, op *openAPIOperation, pathParams map[string]string, errs *ValidationErrors) {
+	query := r.URL.Query()
+	for _, p := range op.Parameters {
+		var values []string
+		switch p.In {
+		case "path":
+			if value, ok := pathParams[p.Name]; ok {
+				values = []string{value}
+			}
+		case "query":
+			values = query[p.Name]
+		case "header":
+			values = r.Header.Values(p.Name)
+		case "cookie":
+			if c, err := r.Cookie(p.Name); err == nil {
+				values = []string{c.Value}
+			}
+		default:
+			continue
+		}
+		pointer := jsonPointer("", p.Name)
+		if len(values) == 0 {
+			if p.Required || p.In == "path" {
+				errs.add(p.In, pointer, "required parameter is missing")
+			}
+			continue
+		}
+		if p.Schema == nil {
+			continue
+		}
+		value, err := v.doc.parseParameter(p, values)
+		if err != nil {
+			errs.add(p.In, pointer, err.Error())
+			continue
+		}
+		v.doc.validate(p.Schema, value, p.In, pointer, errs)
+	}
+}
+
+// parseParameter converts the string values of a parameter to the type of its
+// schema.
+func (doc *OpenAPI) parseParameter(p *openAPIParameter, values []string) (interface{}, error) {
+	s, err := doc.resolveSchema(p.Schema)
+	if err != nil {
+		return nil, err
+	}
+	if s.hasType("array") {
+		if len(values) == 1 && (p.Explode != nil && !*p.Explode || p.In != "query" && p.In != "cookie") {
+			values = strings.Split(values[0], ",")
+		}
+		var items *openAPISchema
+		if s.Items != nil {
+			if items, err = doc.resolveSchema(s.Items); err != nil {
+				return nil, err
+			}
+		}
+		array := make([]interface{}, len(values))
+		for i, value := range values {
+			if array[i], err = parsePrimitive(items, value); err != nil {
+				return nil, err
+			}
+		}
+		return array, nil
+	}
+	return parsePrimitive(s, values[0])
+}
+
+// parsePrimitive converts value to the primitive type of s.
+func parsePrimitive(s *openAPISchema, value string) (interface{}, error) {
+	switch {
+	case s == nil:
+		return value, nil
+	case s.hasType("integer"), s.hasType("number"):
+		if _, err := strconv.ParseFloat(value, 64); err != nil {
+			return nil, fmt.Errorf("%q is not a number", value)
+		}
+		return json.Number(value), nil
+	case s.hasType("boolean"):
+		b, err := strconv.ParseBool(value)
+		if err != nil {
+			return nil, fmt.Errorf("%q is not a boolean", value)
+		}
+		return b, nil
+	}
+	return value, nil
+}
+
+// validateBody validates the body of r against op. If the body can't be
+// validated at all, it returns the status code of the response and false.
+func (v *openAPIValidator) validateBody(r *http.Request, op *openAPIOperation, errs *ValidationErrors) (int, bool) {
+	rb := op.RequestBody
+	if rb == nil {
+		return 0, true
+	}
+	hasBody := r.Body != nil && r.Body != http.NoBody && r.ContentLength != 0
+	if !hasBody {
+		if rb.Required {
+			errs.add("body", "", "request body is required")
+		}
+		return 0, true
+	}
+
+	mt, _, err := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if err != nil {
+		errs.add("header", "/Content-Type", "invalid content type")
+		return http.StatusUnsupportedMediaType, false
+	}
+	media := matchOpenAPIContent(rb.Content, mt)
+	if media == nil {
+		errs.add("header", "/Content-Type", fmt.Sprintf("unsupported content type %q", mt))
+		return http.StatusUnsupportedMediaType, false
+	}
+	if media.Schema == nil || !isJSONMediaType(mt) {
+		return 0, true
+	}
+
+	body, err := ioutil.ReadAll(io.LimitReader(r.Body, v.maxBodySize+1))
+	r.Body.Close()
+	if err != nil {
+		errs.add("body", "", "unreadable request body")
+		return http.StatusBadRequest, false
+	}
+	if int64(len(body)) > v.maxBodySize {
+		errs.add("body", "", fmt.Sprintf("request body larger than %d bytes", v.maxBodySize))
+		return http.StatusRequestEntityTooLarge, false
+	}
+	r.Body = ioutil.NopCloser(bytes.NewReader(body))
+
+	value, err := decodeJSONValue(body)
+	if err != nil {
+		errs.add("body", "", "invalid JSON: "+err.Error())
+		return http.StatusBadRequest, false
+	}
+	v.doc.validate(media.Schema, value, "body", "", errs)
+	return 0, true
+}
+
+// validateResponse validates a buffered response against op.
+func (doc *OpenAPI) validateResponse(op *openAPIOperation, status int, contentType string, body []byte, errs *ValidationErrors) {
+	code := strconv.Itoa(status)
+	res, ok := op.Responses[code]
+	if !ok {
+		res, ok = op.Responses[code[:1]+"XX"]
+	}
+	if !ok {
+		res, ok = op.Responses["default"]
+	}
+	if !ok {
+		errs.add("response", "", fmt.Sprintf("undeclared status code %d", status))
+		return
+	}
+	if len(res.Content) == 0 || len(body) == 0 {
+		return
+	}
+	mt, _, _ := mime.ParseMediaType(contentType)
+	media := matchOpenAPIContent(res.Content, mt)
+	if media == nil {
+		errs.add("response", "", fmt.Sprintf("undeclared content type %q", mt))
+		return
+	}
+	if media.Schema == nil || !isJSONMediaType(mt) {
+		return
+	}
+	value, err := decodeJSONValue(body)
+	if err != nil {
+		errs.add("response", "", "invalid JSON: "+err.Error())
+		return
+	}
+	doc.validate(media.Schema, value, "response", "", errs)
+}
+
+// matchOpenAPIContent returns the media type of content matching mt, exactly
+// or through a range such as "application/*".
+func matchOpenAPIContent(content map[string]*openAPIMediaType, mt string) *openAPIMediaType {
+	if media, ok := content[mt]; ok && media != nil {
+		return media
+	}
+	if i := strings.IndexByte(mt, '/'); i >= 0 {
+		if media, ok := content[mt[:i]+"/*"]; ok && media != nil {
+			return media
+		}
+	}
+	if media, ok := content["*/*"]; ok && media != nil {
+		return media
+	}
+	return nil
+}
+
+func isJSONMediaType(mt string) bool {
+	return mt == "application/json" || strings.HasSuffix(mt, "+json")
+}
+
+// decodeJSONValue decodes a JSON document, keeping numbers as json.Number.
+func decodeJSONValue(body []byte) (interface{}, error) {
+	dec := json.NewDecoder(bytes.NewReader(body))
+	dec.UseNumber()
+	var value interface{}
+	if err := dec.Decode(&value); err != nil {
+		return nil, err
+	}
+	if dec.More() {
+		return nil, errors.New("unexpected data after the JSON value")
+	}
+	return value, nil
+}
+
+func (s *openAPISchema) hasType(t string) bool {
+	for _, st := range s.types {
+		if st == t {
+			return true
+		}
+	}
+	return false
+}
+
+// validate validates value against s, adding the errors found to errs.
+func (doc *OpenAPI) validate(s *openAPISchema, value interface{}, in, pointer string, errs *ValidationErrors) {
+	s, err := doc.resolveSchema(s)
+	if err != nil {
+		errs.add(in, pointer, err.Error())
+		return
+	}
+
+	if value == nil {
+		if len(s.types) > 0 && !s.Nullable && !s.hasType("null") {
+			errs.add(in, pointer, "must not be null")
+		}
+		return
+	}
+	if len(s.types) > 0 && !s.matchType(value) {
+		errs.add(in, pointer, "must be of type "+strings.Join(s.types, " or "))
+		return
+	}
+	if len(s.Enum) > 0 && !matchEnum(s.Enum, value) {
+		errs.add(in, pointer, "must be one of the allowed values")
+	}
+
+	switch value := value.(type) {
+	case json.Number:
+		doc.validateNumber(s, value, in, pointer, errs)
+	case string:
+		n := utf8.RuneCountInString(value)
+		if s.MinLength != nil && n < *s.MinLength {
+			errs.add(in, pointer, fmt.Sprintf("must be at least %d characters long", *s.MinLength))
+		}
+		if s.MaxLength != nil && n > *s.MaxLength {
+			errs.add(in, pointer, fmt.Sprintf("must be at most %d characters long", *s.MaxLength))
+		}
+		if s.pattern != nil && !s.pattern.MatchString(value) {
+			errs.add(in, pointer, fmt.Sprintf("must match pattern %q", s.Pattern))
+		}
+	case []interface{}:
+		if s.MinItems != nil && len(value) < *s.MinItems {
+			errs.add(in, pointer, fmt.Sprintf("must have at least %d items", *s.MinItems))
+		}
+		if s.MaxItems != nil && len(value) > *s.MaxItems {
+			errs.add(in, pointer, fmt.Sprintf("must have at most %d items", *s.MaxItems))
+		}
+		if s.Items != nil {
+			for i, item := range value {
+				doc.validate(s.Items, item, in, jsonPointer(pointer, strconv.Itoa(i)), errs)
+			}
+		}
+	case map[string]interface{}:
+		for _, name := range s.Required {
+			if _, ok := value[name]; !ok {
+				errs.add(in, jsonPointer(pointer, name), "required property is missing")
+			}
+		}
+		names := make([]string, 0, len(value))
+		for name := range value {
+			names = append(names, name)
+		}
+		sort.Strings(names)
+		for _, name := range names {
+			p := jsonPointer(pointer, name)
+			if prop, ok := s.Properties[name]; ok {
+				doc.validate(prop, value[name], in, p, errs)
+			} else if s.noAdditional {
+				errs.add(in, p, "unknown property")
+			} else if s.additional != nil {
+				doc.validate(s.additional, value[name], in, p, errs)
+			}
+		}
+	}
+
+	for _, sub := range s.AllOf {
+		doc.validate(sub, value, in, pointer, errs)
+	}
+	if len(s.AnyOf) > 0 && doc.countMatches(s.AnyOf, value, in, pointer) == 0 {
+		errs.add(in, pointer, "must match at least one of the anyOf schemas")
+	}
+	if len(s.OneOf) > 0 && doc.countMatches(s.OneOf, value, in, pointer) != 1 {
+		errs.add(in, pointer, "must match exactly one of the oneOf schemas")
+	}
+}
+
+func (doc *OpenAPI) validateNumber(s *openAPISchema, value json.Number, in, pointer string, errs *ValidationErrors) {
+	f, err := value.Float64()
+	if err != nil {
+		errs.add(in, pointer, "must be a number")
+		return
+	}
+	if s.Minimum != nil && f < *s.Minimum {
+		errs.add(in, pointer, fmt.Sprintf("must be at least %v", *s.Minimum))
+	}
+	if s.Maximum != nil && f > *s.Maximum {
+		errs.add(in, pointer, fmt.Sprintf("must be at most %v", *s.Maximum))
+	}
+	if s.exclMin != nil && f <= *s.exclMin {
+		errs.add(in, pointer, fmt.Sprintf("must be greater than %v", *s.exclMin))
+	}
+	if s.exclMax != nil && f >= *s.exclMax {
+		errs.add(in, pointer, fmt.Sprintf("must be less than %v", *s.exclMax))
+	}
+}
+
+// countMatches returns the number of schemas value is valid against.
+func (doc *OpenAPI) countMatches(schemas []*openAPISchema, value interface{}, in, pointer string) int {
+	n := 0
+	for _, sub := range schemas {
+		var subErrs ValidationErrors
+		doc.validate(sub, value, in, pointer, &subErrs)
+		if len(subErrs) == 0 {
+			n++
+		}
+	}
+	return n
+}
+
+// matchType reports whether value is of one of the types of s.
+func (s *openAPISchema) matchType(value interface{}) bool {
+	for _, t := range s.types {
+		switch value := value.(type) {
+		case string:
+			if t == "string" {
+				return true
+			}
+		case bool:
+			if t == "boolean" {
+				return true
+			}
+		case json.Number:
+			if t == "number" {
+				return true
+			}
+			if t == "integer" {
+				if f, err := value.Float64(); err == nil && f == math.Trunc(f) {
+					return true
+				}
+			}
+		case []interface{}:
+			if t == "array" {
+				return true
+			}
+		case map[string]interface{}:
+			if t == "object" {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// matchEnum reports whether value is one of the enum values.
+func matchEnum(enum []interface{}, value interface{}) bool {
+	for _, e := range enum {
+		switch e := e.(type) {
+		case float64:
+			if n, ok := value.(json.Number); ok {
+				if f, err := n.Float64(); err == nil && f == e {
+					return true
+				}
+			}
+		case string, bool:
+			if e == value {
+				return true
+			}
+		}
+	}
+	return false
+}
@@ -0,0 +1,199 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+const testOpenAPIDocument = `{
+	"openapi": "3.0.3",
+	"paths": {
+		"/items": {
+			"get": {
+				"parameters": [
+					{"name": "limit", "in": "query", "schema": {"type": "integer", "minimum": 1, "maximum": 100}},
+					{"name": "tags", "in": "query", "schema": {"type": "array", "items": {"type": "string"}, "maxItems": 2}}
+				],
+				"responses": {"200": {"description": "ok", "content": {"application/json": {"schema": {"type": "array", "items": {"$ref": "#/components/schemas/Item"}}}}}}
+			},
+			"post": {
+				"requestBody": {"required": true, "content": {"application/json": {"schema": {"$ref": "#/components/schemas/Item"}}}},
+				"responses": {"201": {"description": "created"}}
+			}
+		},
+		"/items/{id}": {
+			"parameters": [{"name": "id", "in": "path", "required": true, "schema": {"type": "integer"}}],
+			"get": {
+				"parameters": [{"name": "X-Tenant", "in": "header", "required": true, "schema": {"type": "string", "pattern": "^[a-z]+$"}}],
+				"responses": {"default": {"description": "item"}}
+			}
+		},
+		"/items/featured": {
+			"get": {"responses": {"200": {"description": "ok"}}}
+		}
+	},
+	"components": {
+		"schemas": {
+			"Item": {
+				"type": "object",
+				"required": ["name", "quantity"],
+				"additionalProperties": false,
+				"properties": {
+					"name": {"type": "string", "minLength": 1},
+					"quantity": {"type": "integer", "minimum": 0, "exclusiveMinimum": true},
+					"kind": {"type": "string", "enum": ["book", "toy"]},
+					"tags": {"type": "array", "items": {"type": "string", "maxLength": 3}},
+					"note": {"type": "string", "nullable": true}
+				}
+			}
+		}
+	}
+}`
+
+func loadTestOpenAPI(t *testing.T) *OpenAPI {
+	doc, err := LoadOpenAPI(strings.NewReader(testOpenAPIDocument))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return doc
+}
+
+func TestOpenAPIValidatorRequests(t *testing.T) {
+	var body string
+	h := OpenAPIValidator(loadTestOpenAPI(t), OpenAPIBasePath("/api"))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.Body != nil {
+			b, _ := ioutil.ReadAll(r.Body)
+			body = string(b)
+		}
+	}))
+
+	tests := []struct {
+		method, url, body string
+		header            map[string]string
+		code              int
+		errors            []ValidationError
+	}{
+		{"GET", "/api/items?limit=10&tags=a&tags=b", "", nil, http.StatusOK, nil},
+		{"GET", "/api/items?limit=0&tags=a&tags=b&tags=c", "", nil, http.StatusBadRequest, []ValidationError{
+			{"query", "/limit", "must be at least 1"},
+			{"query", "/tags", "must have at most 2 items"},
+		}},
+		{"GET", "/api/items?limit=ten", "", nil, http.StatusBadRequest, []ValidationError{
+			{"query", "/limit", `"ten" is not a number`},
+		}},
+		{"GET", "/api/items/42", "", map[string]string{"X-Tenant": "acme"}, http.StatusOK, nil},
+		{"GET", "/api/items/featured", "", nil, http.StatusOK, nil},
+		{"GET", "/api/items/abc", "", map[string]string{"X-Tenant": "ACME"}, http.StatusBadRequest, []ValidationError{
+			{"header", "/X-Tenant", `must match pattern "^[a-z]+$"`},
+			{"path", "/id", `"abc" is not a number`},
+		}},
+		{"GET", "/api/items/4.5", "", nil, http.StatusBadRequest, []ValidationError{
+			{"header", "/X-Tenant", "required parameter is missing"},
+			{"path", "/id", "must be of type integer"},
+		}},
+		{"POST", "/api/items", `{"name": "ball", "quantity": 2, "kind": "toy", "note": null}`, map[string]string{"Content-Type": "application/json"}, http.StatusOK, nil},
+		{"POST", "/api/items", `{"name": "", "quantity": 0, "kind": "car", "tags": ["abcd"], "color": "red", "note": 1}`, map[string]string{"Content-Type": "application/json"}, http.StatusBadRequest, []ValidationError{
+			{"body", "/color", "unknown property"},
+			{"body", "/kind", "must be one of the allowed values"},
+			{"body", "/name", "must be at least 1 characters long"},
+			{"body", "/note", "must be of type string"},
+			{"body", "/quantity", "must be greater than 0"},
+			{"body", "/tags/0", "must be at most 3 characters long"},
+		}},
+		{"POST", "/api/items", `{"quantity": 1}`, map[string]string{"Content-Type": "application/json"}, http.StatusBadRequest, []ValidationError{
+			{"body", "/name", "required property is missing"},
+		}},
+		{"POST", "/api/items", `{`, map[string]string{"Content-Type": "application/json"}, http.StatusBadRequest, nil},
+		{"POST", "/api/items", ``, nil, http.StatusBadRequest, []ValidationError{
+			{"body", "", "request body is required"},
+		}},
+		{"POST", "/api/items", `name=ball`, map[string]string{"Content-Type": "application/x-www-form-urlencoded"}, http.StatusUnsupportedMediaType, nil},
+		{"DELETE", "/api/items", "", nil, http.StatusMethodNotAllowed, nil},
+		{"GET", "/api/users", "", nil, http.StatusNotFound, nil},
+		{"GET", "/items", "", nil, http.StatusNotFound, nil},
+	}
+	for _, test := range tests {
+		body = ""
+		var r *http.Request
+		if test.body != "" {
+			r = httptest.NewRequest(test.method, test.url, strings.NewReader(test.body))
+		} else {
+			r = newRequest(test.method, test.url)
+		}
+		for name, value := range test.header {
+			r.Header.Set(name, value)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%s %s: wrong status: got %d want %d: %s", test.method, test.url, rec.Code, test.code, rec.Body.String())
+			continue
+		}
+		if test.code == http.StatusOK {
+			if body != test.body {
+				t.Errorf("%s %s: body not passed on: %q", test.method, test.url, body)
+			}
+			continue
+		}
+		if test.errors == nil {
+			continue
+		}
+		var problem struct {
+			Status int
+			Errors []ValidationError
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &problem); err != nil {
+			t.Fatal(err)
+		}
+		if len(problem.Errors) != len(test.errors) {
+			t.Errorf("%s %s: wrong errors: got %v want %v", test.method, test.url, problem.Errors, test.errors)
+			continue
+		}
+		for i := range test.errors {
+			if problem.Errors[i] != test.errors[i] {
+				t.Errorf("%s %s: error %d: got %v want %v", test.method, test.url, i, problem.Errors[i], test.errors[i])
+			}
+		}
+	}
+}
+
+func TestOpenAPIValidatorResponses(t *testing.T) {
+	var response string
+	h := OpenAPIValidator(loadTestOpenAPI(t), OpenAPIValidateResponses())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(response))
+	}))
+
+	response = `[{"name": "ball", "quantity": 1}]`
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/items"))
+	if rec.Code != http.StatusOK || rec.Body.String() != response {
+		t.Fatalf("valid response replaced: %d %s", rec.Code, rec.Body.String())
+	}
+
+	response = `[{"name": "ball"}]`
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/items"))
+	if rec.Code != http.StatusInternalServerError || !strings.Contains(rec.Body.String(), `"pointer":"/0/quantity"`) {
+		t.Fatalf("invalid response not reported: %d %s", rec.Code, rec.Body.String())
+	}
+}
+
+func TestLoadOpenAPIErrors(t *testing.T) {
+	tests := []string{
+		`{"openapi": "2.0"}`,
+		`{"openapi": "3.0.0", "paths": {"/a": {"get": {"requestBody": {"$ref": "#/components/requestBodies/Missing"}}}}}`,
+		`{"openapi": "3.0.0", "paths": {"/a": {"get": {"parameters": [{"name": "q", "in": "query", "schema": {"$ref": "#/components/schemas/Missing"}}]}}}}`,
+		`{"openapi": "3.0.0", "components": {"schemas": {"A": {"type": "string", "pattern": "("}}}}`,
+		`{"openapi": `,
+	}
+	for _, doc := range tests {
+		if _, err := LoadOpenAPI(strings.NewReader(doc)); err == nil {
+			t.Errorf("%s: no error", doc)
+		}
+	}
+}
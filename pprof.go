@@ -0,0 +1,62 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/pprof"
+	"strings"
+)
+
+const pprofIndexPath = "/debug/pprof/"
+
+// PprofHandler returns a http.Handler serving the net/http/pprof profiling
+// endpoints under prefix, guarded by the given options. Without any option
+// only loopback clients are allowed; use GuardEnabled to switch profiling on
+// and off (e.g. from a flag) while leaving it compiled in.
+//
+// Example:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/admin/pprof/", handlers.PprofHandler("/admin/pprof/",
+//		handlers.GuardEnabled(*enableProfiling),
+//		handlers.GuardBasicAuth("ops", os.Getenv("PPROF_PASSWORD")),
+//	))
+func PprofHandler(prefix string, opts ...GuardOption) http.Handler {
+	if !strings.HasSuffix(prefix, "/") {
+		prefix += "/"
+	}
+
+	fn := func(w http.ResponseWriter, r *http.Request) {
+		var name string
+		switch {
+		case strings.HasPrefix(r.URL.Path, prefix):
+			name = r.URL.Path[len(prefix):]
+		case r.URL.Path+"/" == prefix:
+			name = ""
+		default:
+			http.NotFound(w, r)
+			return
+		}
+
+		switch name {
+		case "cmdline":
+			pprof.Cmdline(w, r)
+		case "profile":
+			pprof.Profile(w, r)
+		case "symbol":
+			pprof.Symbol(w, r)
+		case "trace":
+			pprof.Trace(w, r)
+		default:
+			// pprof.Index resolves named profiles (heap, goroutine, ...)
+			// relative to the standard /debug/pprof/ path.
+			r2 := new(http.Request)
+			*r2 = *r
+			u := *r.URL
+			u.Path = pprofIndexPath + name
+			r2.URL = &u
+			pprof.Index(w, r2)
+		}
+	}
+
+	return newGuard(http.HandlerFunc(fn), opts...)
+}
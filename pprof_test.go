@@ -0,0 +1,56 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestPprofHandler(t *testing.T) {
+	handler := PprofHandler("/admin/pprof")
+
+	tests := []struct {
+		path string
+		code int
+		body string
+	}{
+		{"/admin/pprof/", http.StatusOK, "goroutine"},
+		{"/admin/pprof", http.StatusOK, "goroutine"},
+		{"/admin/pprof/goroutine?debug=1", http.StatusOK, "goroutine profile"},
+		{"/admin/pprof/cmdline", http.StatusOK, ""},
+		{"/admin/pprof/nonexistent", http.StatusNotFound, ""},
+		{"/elsewhere", http.StatusNotFound, ""},
+	}
+
+	for _, test := range tests {
+		r := newRequest("GET", test.path)
+		r.RemoteAddr = "127.0.0.1:1234"
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		if rec.Code != test.code {
+			t.Errorf("%s: bad status: got %d want %d", test.path, rec.Code, test.code)
+		}
+		if !strings.Contains(rec.Body.String(), test.body) {
+			t.Errorf("%s: body %q does not contain %q", test.path, rec.Body.String(), test.body)
+		}
+	}
+}
+
+func TestPprofHandlerGuarded(t *testing.T) {
+	r := newRequest("GET", "/debug/pprof/")
+	r.RemoteAddr = "127.0.0.1:1234"
+	rec := httptest.NewRecorder()
+	PprofHandler("/debug/pprof/", GuardEnabled(false)).ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("bad status for disabled handler: got %d want %d", rec.Code, http.StatusNotFound)
+	}
+
+	r.RemoteAddr = "192.0.2.1:1234"
+	rec = httptest.NewRecorder()
+	PprofHandler("/debug/pprof/").ServeHTTP(rec, r)
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("bad status for remote client: got %d want %d", rec.Code, http.StatusForbidden)
+	}
+}
@@ -0,0 +1,135 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+)
+
+// Problem is a RFC 7807 problem details object.
+type Problem struct {
+	Type     string `json:"type,omitempty"`
+	Title    string `json:"title,omitempty"`
+	Status   int    `json:"status,omitempty"`
+	Detail   string `json:"detail,omitempty"`
+	Instance string `json:"instance,omitempty"`
+}
+
+// ProblemOption represents a functional option for configuring the
+// ProblemDetails middleware.
+type ProblemOption func(*problemResponder) error
+
+type problemResponder struct {
+	h        http.Handler
+	typeBase string
+	rewrite  func(*http.Request, *Problem)
+}
+
+// ProblemTypeBase sets the URI prefix of problem types: the type of a problem
+// is the prefix followed by the status text in kebab case, e.g.
+// "https://example.com/problems/method-not-allowed". By default problems have
+// no type, which means "about:blank".
+func ProblemTypeBase(uri string) ProblemOption {
+	return func(p *problemResponder) error {
+		p.typeBase = uri
+		return nil
+	}
+}
+
+// ProblemRewrite sets a function called on each problem before it is
+// written, e.g. to map problems to application-specific types.
+func ProblemRewrite(fn func(r *http.Request, p *Problem)) ProblemOption {
+	return func(p *problemResponder) error {
+		p.rewrite = fn
+		return nil
+	}
+}
+
+// ProblemDetails is HTTP middleware making the error responses of the
+// middlewares of this package, further down the chain, RFC 7807
+// application/problem+json documents. These are CORS preflight rejections,
+// 405 Method Not Allowed from MethodHandler, 415 Unsupported Media Type from
+// ContentTypeHandler, 500 Internal Server Error from RecoveryHandler, proxy
+// errors from ReverseProxy, and RenderError. The instance member is set to the
+// request ID, if there is one.
+//
+// Example:
+//
+//	h := handlers.ProblemDetails(handlers.ProblemTypeBase("https://example.com/problems/"))(
+//		handlers.RecoveryHandler()(handlers.ContentTypeHandler(r, "application/json")))
+func ProblemDetails(opts ...ProblemOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		p := &problemResponder{h: h}
+		for _, option := range opts {
+			option(p)
+		}
+		return p
+	}
+}
+
+func (p *problemResponder) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("problem", w, r)
+	defer end()
+
+	p.h.ServeHTTP(w, WithValue(r, p))
+}
+
+// WriteProblem writes p as an application/problem+json response. Missing
+// members are filled in: the status defaults to 500, the title to the status
+// text and the instance to the request ID, and the type and rewrite function
+// configured by an enclosing ProblemDetails middleware are applied.
+func WriteProblem(w http.ResponseWriter, r *http.Request, p Problem) {
+	writeProblemDocument(w, r, p, nil)
+}
+
+// writeProblemDocument writes p, with the validation errors errs as the
+// errors extension member.
+func writeProblemDocument(w http.ResponseWriter, r *http.Request, p Problem, errs ValidationErrors) {
+	if p.Status == 0 {
+		p.Status = http.StatusInternalServerError
+	}
+	if p.Title == "" {
+		p.Title = http.StatusText(p.Status)
+	}
+	if p.Instance == "" {
+		p.Instance = requestIDFor(w, r)
+	}
+	if pr, ok := Value[*problemResponder](r); ok {
+		if p.Type == "" && pr.typeBase != "" {
+			p.Type = pr.typeBase + strings.ToLower(strings.ReplaceAll(http.StatusText(p.Status), " ", "-"))
+		}
+		if pr.rewrite != nil {
+			pr.rewrite(r, &p)
+		}
+	}
+
+	b, err := json.Marshal(struct {
+		Problem
+		Errors ValidationErrors `json:"errors,omitempty"`
+	}{p, errs})
+	if err != nil {
+		renderEncodingError(w)
+		return
+	}
+	b = append(b, '\n')
+	h := w.Header()
+	h.Set("Content-Type", "application/problem+json")
+	h.Set("Content-Length", strconv.Itoa(len(b)))
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(p.Status)
+	if r.Method != "HEAD" {
+		w.Write(b)
+	}
+}
+
+// writeProblem writes a problem response if the request is served through
+// ProblemDetails, and reports whether it did. Middlewares call it before
+// falling back to their plain error responses.
+func writeProblem(w http.ResponseWriter, r *http.Request, code int, detail string) bool {
+	if _, ok := Value[*problemResponder](r); !ok {
+		return false
+	}
+	WriteProblem(w, r, Problem{Status: code, Detail: detail})
+	return true
+}
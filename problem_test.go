@@ -0,0 +1,113 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func decodeProblem(t *testing.T, rec *httptest.ResponseRecorder) Problem {
+	t.Helper()
+	if ct := rec.Header().Get("Content-Type"); ct != "application/problem+json" {
+		t.Fatalf("wrong content type: %q", ct)
+	}
+	var p Problem
+	if err := json.Unmarshal(rec.Body.Bytes(), &p); err != nil {
+		t.Fatal(err)
+	}
+	return p
+}
+
+func TestProblemDetails(t *testing.T) {
+	problems := ProblemDetails(ProblemTypeBase("https://example.com/problems/"))
+	ok := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {})
+
+	tests := []struct {
+		name    string
+		handler http.Handler
+		req     func() *http.Request
+		want    Problem
+	}{
+		{
+			"method",
+			MethodHandler{"GET": ok},
+			func() *http.Request { return newRequest("POST", "/") },
+			Problem{Type: "https://example.com/problems/method-not-allowed", Title: "Method Not Allowed", Status: 405},
+		},
+		{
+			"content type",
+			ContentTypeHandler(ok, "application/json"),
+			func() *http.Request {
+				r := newRequest("POST", "/")
+				r.Header.Set("Content-Type", "text/plain")
+				return r
+			},
+			Problem{Type: "https://example.com/problems/unsupported-media-type", Title: "Unsupported Media Type", Status: 415,
+				Detail: `Unsupported content type "text/plain"; expected one of ["application/json"]`},
+		},
+		{
+			"recovery",
+			RecoveryHandler(RecoveryLogger(testLogger{}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) { panic("boom") })),
+			func() *http.Request { return newRequest("GET", "/") },
+			Problem{Type: "https://example.com/problems/internal-server-error", Title: "Internal Server Error", Status: 500},
+		},
+		{
+			"cors",
+			CORS(AllowedOrigins([]string{"https://a.example.com"}))(ok),
+			func() *http.Request {
+				r := newRequest("OPTIONS", "/")
+				r.Header.Set("Origin", "https://a.example.com")
+				r.Header.Set(corsRequestMethodHeader, "DELETE")
+				return r
+			},
+			Problem{Type: "https://example.com/problems/method-not-allowed", Title: "Method Not Allowed", Status: 405,
+				Detail: "Method DELETE not allowed by CORS policy"},
+		},
+		{
+			"render error",
+			http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+				RenderError(w, r, http.StatusNotFound, errors.New("no such user"))
+			}),
+			func() *http.Request { return newRequest("GET", "/") },
+			Problem{Type: "https://example.com/problems/not-found", Title: "Not Found", Status: 404, Detail: "no such user"},
+		},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		problems(test.handler).ServeHTTP(rec, test.req())
+		if rec.Code != test.want.Status {
+			t.Errorf("%s: wrong status, got %d want %d", test.name, rec.Code, test.want.Status)
+			continue
+		}
+		if p := decodeProblem(t, rec); p != test.want {
+			t.Errorf("%s: got %+v want %+v", test.name, p, test.want)
+		}
+	}
+}
+
+func TestProblemDetailsDisabled(t *testing.T) {
+	rec := httptest.NewRecorder()
+	MethodHandler{}.ServeHTTP(rec, newRequest("POST", "/"))
+	if rec.Code != http.StatusMethodNotAllowed || rec.Header().Get("Content-Type") == "application/problem+json" {
+		t.Fatalf("unexpected problem response: %d %v", rec.Code, rec.Header())
+	}
+}
+
+func TestWriteProblem(t *testing.T) {
+	r := newRequest("GET", "/")
+	r.Header.Set(RequestIDHeader, "id-1")
+	rec := httptest.NewRecorder()
+	handler := RequestIDHandler()(ProblemDetails(ProblemRewrite(func(r *http.Request, p *Problem) {
+		p.Type = "https://example.com/problems/quota"
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		WriteProblem(w, r, Problem{Status: http.StatusTooManyRequests, Detail: "quota exceeded"})
+	})))
+	handler.ServeHTTP(rec, r)
+
+	want := Problem{Type: "https://example.com/problems/quota", Title: "Too Many Requests", Status: 429, Detail: "quota exceeded", Instance: "id-1"}
+	if p := decodeProblem(t, rec); rec.Code != 429 || p != want {
+		t.Fatalf("got %d %+v want %+v", rec.Code, p, want)
+	}
+}
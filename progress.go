@@ -0,0 +1,242 @@
+package handlers
+
+import (
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+const (
+	uploadIDParam              = "X-Progress-ID"
+	defaultUploadProgressTTL   = time.Minute
+	defaultUploadProgressEvery = 250 * time.Millisecond
+)
+
+// Upload states reported by UploadProgress.
+const (
+	UploadStarting  = "starting"
+	UploadUploading = "uploading"
+	UploadDone      = "done"
+	UploadError     = "error"
+)
+
+// UploadStatus is the progress of an upload, as reported by UploadProgress.
+type UploadStatus struct {
+	State    string `json:"state"`
+	Received int64  `json:"received"`
+	// Size is the size of the request body, or -1 if unknown.
+	Size      int64     `json:"size"`
+	StartedAt time.Time `json:"started_at"`
+}
+
+type uploadTracker struct {
+	received int64 // accessed atomically
+	size     int64
+	start    time.Time
+
+	mu    sync.Mutex
+	state string
+	ended time.Time
+}
+
+func (t *uploadTracker) status() UploadStatus {
+	t.mu.Lock()
+	state := t.state
+	t.mu.Unlock()
+	return UploadStatus{
+		State:     state,
+		Received:  atomic.LoadInt64(&t.received),
+		Size:      t.size,
+		StartedAt: t.start,
+	}
+}
+
+func (t *uploadTracker) end(state string) {
+	t.mu.Lock()
+	t.state = state
+	t.ended = time.Now()
+	t.mu.Unlock()
+}
+
+// UploadProgress tracks the bytes received for uploads identified by the
+// client, and reports their progress, so that browsers can display accurate
+// progress for plain form submissions (polling from another request while
+// the form is posted), and for server-side monitoring.
+//
+// Uploads are tracked by the middleware returned by Handler, for requests
+// carrying an upload ID in the X-Progress-ID query parameter or header.
+// UploadProgress is itself a http.Handler reporting the progress of the
+// upload whose ID is given the same way, as a JSON UploadStatus, or as a
+// stream of server-sent events if the client accepts text/event-stream.
+// Progress is kept for a minute after the end of an upload.
+//
+// Upload IDs are chosen by clients, so they are scoped to the client IP
+// address, as seen in r.RemoteAddr: a client can neither see nor replace the
+// uploads of another one. Combine with ProxyHeaders when running behind a
+// reverse proxy.
+//
+// Example:
+//
+//	progress := handlers.NewUploadProgress()
+//	mux.Handle("/upload", progress.Handler(uploadHandler))
+//	mux.Handle("/upload/progress", progress)
+type UploadProgress struct {
+	ttl   time.Duration
+	every time.Duration
+
+	mu      sync.Mutex
+	uploads map[uploadKey]*uploadTracker
+}
+
+// uploadKey identifies an upload: its ID is only unique for a client.
+type uploadKey struct {
+	client string
+	id     string
+}
+
+// NewUploadProgress returns a new UploadProgress.
+func NewUploadProgress() *UploadProgress {
+	return &UploadProgress{
+		ttl:     defaultUploadProgressTTL,
+		every:   defaultUploadProgressEvery,
+		uploads: map[uploadKey]*uploadTracker{},
+	}
+}
+
+// requestUploadKey returns the key of the upload identified in r, and whether r
+// carries an upload ID.
+func requestUploadKey(r *http.Request) (uploadKey, bool) {
+	id := r.URL.Query().Get(uploadIDParam)
+	if id == "" {
+		id = r.Header.Get(uploadIDParam)
+	}
+	return uploadKey{client: hostOnly(r.RemoteAddr), id: id}, id != ""
+}
+
+// Handler returns HTTP middleware tracking the progress of the request bodies
+// read by h.
+func (p *UploadProgress) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("upload_progress", w, r)
+		defer end()
+
+		key, ok := requestUploadKey(r)
+		if !ok || r.Body == nil {
+			h.ServeHTTP(w, r)
+			return
+		}
+
+		t := &uploadTracker{size: r.ContentLength, start: time.Now(), state: UploadStarting}
+		p.mu.Lock()
+		p.removeExpired()
+		p.uploads[key] = t
+		p.mu.Unlock()
+
+		r.Body = &progressReadCloser{ReadCloser: r.Body, t: t}
+		state := UploadError
+		defer func() { t.end(state) }()
+		h.ServeHTTP(w, r)
+		if t.size < 0 || atomic.LoadInt64(&t.received) >= t.size {
+			state = UploadDone
+		}
+	})
+}
+
+// removeExpired removes the uploads which ended more than the TTL ago. p.mu
+// must be held.
+func (p *UploadProgress) removeExpired() {
+	for key, t := range p.uploads {
+		t.mu.Lock()
+		expired := !t.ended.IsZero() && time.Since(t.ended) > p.ttl
+		t.mu.Unlock()
+		if expired {
+			delete(p.uploads, key)
+		}
+	}
+}
+
+// Status returns the progress of the upload identified in r, the upload ID
+// being given in the X-Progress-ID query parameter or header, started by the
+// same client.
+func (p *UploadProgress) Status(r *http.Request) (UploadStatus, bool) {
+	key, ok := requestUploadKey(r)
+	if !ok {
+		return UploadStatus{}, false
+	}
+	p.mu.Lock()
+	p.removeExpired()
+	t, ok := p.uploads[key]
+	p.mu.Unlock()
+	if !ok {
+		return UploadStatus{}, false
+	}
+	return t.status(), true
+}
+
+func (p *UploadProgress) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("upload_progress", w, r)
+	defer end()
+
+	w.Header().Set("Cache-Control", "no-store")
+
+	if r.Header.Get("Accept") != "text/event-stream" {
+		status, ok := p.Status(r)
+		if !ok {
+			http.NotFound(w, r)
+			return
+		}
+		w.Header().Set("Content-Type", "application/json")
+		json.NewEncoder(w).Encode(status)
+		return
+	}
+
+	flusher, ok := w.(http.Flusher)
+	if !ok {
+		http.Error(w, "Streaming unsupported", http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Content-Type", "text/event-stream")
+	ticker := time.NewTicker(p.every)
+	defer ticker.Stop()
+	for {
+		// The upload may not have started yet when the client subscribes.
+		status, ok := p.Status(r)
+		if !ok {
+			status = UploadStatus{State: UploadStarting, Size: -1}
+		}
+		b, _ := json.Marshal(status)
+		fmt.Fprintf(w, "data: %s\n\n", b)
+		flusher.Flush()
+		if status.State == UploadDone || status.State == UploadError {
+			return
+		}
+
+		select {
+		case <-ticker.C:
+		case <-r.Context().Done():
+			return
+		}
+	}
+}
+
+// progressReadCloser counts the bytes read from a request body.
+type progressReadCloser struct {
+	io.ReadCloser
+	t *uploadTracker
+}
+
+func (p *progressReadCloser) Read(b []byte) (int, error) {
+	n, err := p.ReadCloser.Read(b)
+	if atomic.AddInt64(&p.t.received, int64(n)) > 0 {
+		p.t.mu.Lock()
+		if p.t.state == UploadStarting {
+			p.t.state = UploadUploading
+		}
+		p.t.mu.Unlock()
+	}
+	return n, err
+}
@@ -0,0 +1,105 @@
+package handlers
+
+import (
+	"bufio"
+	"encoding/json"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestUploadProgress(t *testing.T) {
+	progress := NewUploadProgress()
+	progress.every = 10 * time.Millisecond
+
+	read := make(chan struct{})
+	resume := make(chan struct{})
+	handler := progress.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.ReadFull(r.Body, make([]byte, 4))
+		read <- struct{}{}
+		<-resume
+		ioutil.ReadAll(r.Body)
+	}))
+
+	r := httptest.NewRequest("POST", "/upload?X-Progress-ID=abc", strings.NewReader("0123456789"))
+	r.RemoteAddr = "127.0.0.1:1234"
+	go handler.ServeHTTP(httptest.NewRecorder(), r)
+	<-read
+
+	rec := httptest.NewRecorder()
+	r = newRequest("GET", "/progress?X-Progress-ID=abc")
+	r.RemoteAddr = "127.0.0.1:5678"
+	progress.ServeHTTP(rec, r)
+	var status UploadStatus
+	if err := json.Unmarshal(rec.Body.Bytes(), &status); err != nil {
+		t.Fatal(err)
+	}
+	if status.State != UploadUploading || status.Received != 4 || status.Size != 10 {
+		t.Fatalf("bad status: %+v", status)
+	}
+
+	rec = httptest.NewRecorder()
+	r = newRequest("GET", "/progress?X-Progress-ID=abc")
+	r.RemoteAddr = "192.0.2.1:1234"
+	progress.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("bad status for the upload of another client: %d", rec.Code)
+	}
+
+	s := httptest.NewServer(progress)
+	defer s.Close()
+	req, _ := http.NewRequest("GET", s.URL+"?X-Progress-ID=abc", nil)
+	req.Header.Set("Accept", "text/event-stream")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	close(resume)
+
+	var last UploadStatus
+	scanner := bufio.NewScanner(res.Body)
+	for scanner.Scan() {
+		if line := scanner.Text(); strings.HasPrefix(line, "data: ") {
+			if err := json.Unmarshal([]byte(strings.TrimPrefix(line, "data: ")), &last); err != nil {
+				t.Fatal(err)
+			}
+		}
+	}
+	if last.State != UploadDone || last.Received != 10 {
+		t.Fatalf("bad final event: %+v", last)
+	}
+
+	rec = httptest.NewRecorder()
+	progress.ServeHTTP(rec, newRequest("GET", "/progress?X-Progress-ID=unknown"))
+	if rec.Code != http.StatusNotFound {
+		t.Fatalf("bad status for an unknown upload: %d", rec.Code)
+	}
+}
+
+func TestUploadProgressExpiration(t *testing.T) {
+	progress := NewUploadProgress()
+	progress.ttl = 10 * time.Millisecond
+	handler := progress.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		ioutil.ReadAll(r.Body)
+	}))
+
+	r := httptest.NewRequest("POST", "/upload?X-Progress-ID=abc", strings.NewReader("0123456789"))
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+	r = httptest.NewRequest("GET", "/progress?X-Progress-ID=abc", nil)
+	if status, ok := progress.Status(r); !ok || status.State != UploadDone {
+		t.Fatalf("bad status: %+v %v", status, ok)
+	}
+
+	time.Sleep(20 * time.Millisecond)
+	if _, ok := progress.Status(r); ok {
+		t.Fatal("expired upload still reported")
+	}
+	if len(progress.uploads) != 0 {
+		t.Fatalf("expired upload not removed: %v", progress.uploads)
+	}
+}
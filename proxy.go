@@ -0,0 +1,386 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net"
+	"net/http"
+	"net/http/httputil"
+	"net/url"
+	"strings"
+	"time"
+)
+
+// ReverseProxyOption represents a functional option for configuring
+// ReverseProxy.
+type ReverseProxyOption func(*reverseProxy) error
+
+type reverseProxy struct {
+	proxy           *httputil.ReverseProxy
+	transport       http.RoundTripper
+	timeout         time.Duration
+	retries         int
+	retryBackoff    time.Duration
+	trustForwarded  bool
+	forwarded       bool
+	requestHeaders  http.Header
+	responseHeaders http.Header
+	errorHandler    func(http.ResponseWriter, *http.Request, error)
+
+	// Load balancing, for LoadBalancer.
+	strategy     BalanceStrategy
+	maxFailures  int
+	ejectFor     time.Duration
+	stickyCookie string
+	stickyTTL    time.Duration
+	stickyKey    func(*http.Request) string
+}
+
+// ProxyTransport sets the transport used to reach the upstream. It defaults
+// to http.DefaultTransport.
+func ProxyTransport(rt http.RoundTripper) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		if rt == nil {
+			return errors.New("handlers: nil proxy transport")
+		}
+		p.transport = rt
+		return nil
+	}
+}
+
+// ProxyTimeout sets how long to wait for the upstream's response headers, for
+// each attempt. Response bodies are streamed without time limit. Expired
+// requests are answered with 504 Gateway Timeout.
+func ProxyTimeout(d time.Duration) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.timeout = d
+		if d < 0 {
+			return fmt.Errorf("handlers: invalid proxy timeout %v", d)
+		}
+		return nil
+	}
+}
+
+// ProxyRetries retries requests up to n times, waiting backoff (doubled after
+// each attempt) in between, when the upstream can't be reached or answers 502,
+// 503 or 504. Only requests with an idempotent method (GET, HEAD, OPTIONS) and
+// no body are retried.
+func ProxyRetries(n int, backoff time.Duration) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.retries = n
+		p.retryBackoff = backoff
+		if n < 0 || backoff < 0 {
+			return fmt.Errorf("handlers: invalid proxy retries %d with backoff %v", n, backoff)
+		}
+		return nil
+	}
+}
+
+// ProxyTrustForwarded keeps the forwarding headers of incoming requests,
+// appending to them, instead of replacing them. Only use it when the proxy is
+// itself behind a trusted proxy; see ProxyHeaders.
+func ProxyTrustForwarded() ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.trustForwarded = true
+		return nil
+	}
+}
+
+// ProxyForwardedHeader makes the proxy send a RFC7239 Forwarded header, in
+// addition to the X-Forwarded-* headers.
+func ProxyForwardedHeader() ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.forwarded = true
+		return nil
+	}
+}
+
+// ProxyRequestHeader sets a header of the requests sent upstream. An empty
+// value removes the header.
+func ProxyRequestHeader(name, value string) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.requestHeaders[http.CanonicalHeaderKey(name)] = []string{value}
+		return nil
+	}
+}
+
+// ProxyResponseHeader sets a header of the responses received from upstream.
+// An empty value removes the header.
+func ProxyResponseHeader(name, value string) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.responseHeaders[http.CanonicalHeaderKey(name)] = []string{value}
+		return nil
+	}
+}
+
+// ProxyErrorHandler sets the function replying to requests that couldn't be
+// proxied. By default they are answered with 502 Bad Gateway, or 504 Gateway
+// Timeout if the upstream timed out.
+func ProxyErrorHandler(fn func(w http.ResponseWriter, r *http.Request, err error)) ReverseProxyOption {
+	return func(p *reverseProxy) error {
+		p.errorHandler = fn
+		return nil
+	}
+}
+
+// ReverseProxy returns a handler proxying requests to target, built on
+// httputil.ReverseProxy.
+//
+// Forwarding headers are derived from the request as seen by the handler, so
+// that they reflect the client address, scheme and host established by
+// ProxyHeaders when it is used in front: X-Forwarded-For, X-Forwarded-Host,
+// X-Forwarded-Proto and X-Real-IP are set, and the incoming values are
+// discarded unless ProxyTrustForwarded is given. The request ID set by
+// RequestIDHandler is passed on in the X-Request-Id header.
+//
+// Example:
+//
+//	api, _ := url.Parse("http://10.0.0.12:8080/v1")
+//	proxy := handlers.ReverseProxy(api,
+//		handlers.ProxyTimeout(10*time.Second),
+//		handlers.ProxyRetries(2, 100*time.Millisecond),
+//		handlers.ProxyResponseHeader("Server", ""),
+//	)
+//	http.ListenAndServe(":1123", handlers.ProxyHeaders(proxy))
+func ReverseProxy(target *url.URL, opts ...ReverseProxyOption) http.Handler {
+	return newReverseProxy(target, opts...)
+}
+
+func newReverseProxy(target *url.URL, opts ...ReverseProxyOption) *reverseProxy {
+	p := newReverseProxyConfig()
+	for _, option := range opts {
+		option(p)
+	}
+
+	p.proxy = httputil.NewSingleHostReverseProxy(target)
+	director := p.proxy.Director
+	p.proxy.Director = func(r *http.Request) {
+		// r is a copy of the incoming request until director points it at
+		// the target.
+		scheme := r.URL.Scheme
+		if scheme == "" {
+			scheme = "http"
+			if r.TLS != nil {
+				scheme = "https"
+			}
+		}
+		director(r)
+		p.setForwarded(r, scheme)
+		setHeaders(r.Header, p.requestHeaders)
+	}
+	p.proxy.ModifyResponse = func(res *http.Response) error {
+		setHeaders(res.Header, p.responseHeaders)
+		return nil
+	}
+	p.proxy.ErrorHandler = p.errorHandler
+	p.proxy.Transport = p.roundTripper()
+	return p
+}
+
+// NewReverseProxy is like ReverseProxy, but returns an error if target isn't
+// an absolute URL or if an option is invalid.
+func NewReverseProxy(target *url.URL, opts ...ReverseProxyOption) (http.Handler, error) {
+	if target == nil || target.Scheme == "" || target.Host == "" {
+		return nil, fmt.Errorf("handlers: invalid proxy target %v", target)
+	}
+	p := newReverseProxyConfig()
+	for _, option := range opts {
+		if err := option(p); err != nil {
+			return nil, err
+		}
+	}
+	return ReverseProxy(target, opts...), nil
+}
+
+// newReverseProxyConfig returns a reverseProxy with the default settings, to
+// apply options to.
+func newReverseProxyConfig() *reverseProxy {
+	return &reverseProxy{
+		transport:       http.DefaultTransport,
+		requestHeaders:  http.Header{},
+		responseHeaders: http.Header{},
+		errorHandler:    proxyError,
+		maxFailures:     defaultMaxFailures,
+		ejectFor:        defaultEjectFor,
+	}
+}
+
+func (p *reverseProxy) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("reverse_proxy", w, r)
+	defer end()
+	p.proxy.ServeHTTP(w, r)
+}
+
+// setForwarded sets the forwarding headers of the outgoing request r.
+func (p *reverseProxy) setForwarded(r *http.Request, scheme string) {
+	h := r.Header
+	if !p.trustForwarded {
+		for _, name := range []string{xForwardedFor, xForwardedHost, xForwardedProto, xForwardedScheme, xRealIP, forwarded} {
+			h.Del(name)
+		}
+	}
+
+	clientIP, _, err := net.SplitHostPort(r.RemoteAddr)
+	if err != nil {
+		// ProxyHeaders sets RemoteAddr to a bare address, which
+		// httputil.ReverseProxy doesn't add to X-Forwarded-For itself.
+		clientIP = r.RemoteAddr
+		if clientIP != "" {
+			if prior := h.Get(xForwardedFor); prior != "" {
+				clientIP = prior + ", " + clientIP
+			}
+			h.Set(xForwardedFor, clientIP)
+		}
+	}
+
+	if h.Get(xForwardedHost) == "" {
+		h.Set(xForwardedHost, r.Host)
+	}
+	if h.Get(xForwardedProto) == "" {
+		h.Set(xForwardedProto, scheme)
+	}
+	if h.Get(xRealIP) == "" {
+		if ip, _, err := net.SplitHostPort(r.RemoteAddr); err == nil {
+			h.Set(xRealIP, ip)
+		} else if r.RemoteAddr != "" {
+			h.Set(xRealIP, r.RemoteAddr)
+		}
+	}
+	if p.forwarded {
+		elem := "proto=" + scheme
+		if ip := h.Get(xRealIP); ip != "" {
+			if strings.Contains(ip, ":") {
+				ip = "[" + ip + "]"
+			}
+			elem = "for=" + quoteForwarded(ip) + ";" + elem
+		}
+		if r.Host != "" {
+			elem += ";host=" + quoteForwarded(r.Host)
+		}
+		if prior := h.Get(forwarded); prior != "" {
+			elem = prior + ", " + elem
+		}
+		h.Set(forwarded, elem)
+	}
+	if id := RequestID(r); id != "" {
+		h.Set(RequestIDHeader, id)
+	}
+}
+
+// quoteForwarded quotes a Forwarded parameter value if it isn't a token, as
+// for IPv6 addresses and ports.
+func quoteForwarded(s string) string {
+	if strings.ContainsAny(s, ":[]") {
+		return `"` + s + `"`
+	}
+	return s
+}
+
+// setHeaders applies header rewrite rules to h.
+func setHeaders(h, rules http.Header) {
+	for name, values := range rules {
+		if values[0] == "" {
+			h.Del(name)
+		} else {
+			h[name] = values
+		}
+	}
+}
+
+// roundTripper returns the transport used to reach the upstream, applying the
+// timeout and retry policy.
+func (p *reverseProxy) roundTripper() http.RoundTripper {
+	rt := p.transport
+	if p.timeout > 0 || p.retries > 0 {
+		rt = &retryTransport{rt: rt, timeout: p.timeout, retries: p.retries, backoff: p.retryBackoff}
+	}
+	return rt
+}
+
+// retryTransport applies a per-attempt response header timeout and retries
+// idempotent requests.
+type retryTransport struct {
+	rt      http.RoundTripper
+	timeout time.Duration
+	retries int
+	backoff time.Duration
+}
+
+func (t *retryTransport) RoundTrip(r *http.Request) (*http.Response, error) {
+	retryable := (r.Method == "GET" || r.Method == "HEAD" || r.Method == "OPTIONS") &&
+		(r.Body == nil || r.Body == http.NoBody) && !IsUpgradeRequest(r)
+	backoff := t.backoff
+	for attempt := 0; ; attempt++ {
+		res, err := t.roundTrip(r)
+		if !retryable || attempt >= t.retries || r.Context().Err() != nil {
+			return res, err
+		}
+		if err == nil {
+			switch res.StatusCode {
+			case http.StatusBadGateway, http.StatusServiceUnavailable, http.StatusGatewayTimeout:
+				io.Copy(ioutil.Discard, io.LimitReader(res.Body, 4096))
+				res.Body.Close()
+			default:
+				return res, nil
+			}
+		}
+		select {
+		case <-time.After(backoff):
+		case <-r.Context().Done():
+			return nil, r.Context().Err()
+		}
+		backoff *= 2
+	}
+}
+
+func (t *retryTransport) roundTrip(r *http.Request) (*http.Response, error) {
+	if t.timeout <= 0 {
+		return t.rt.RoundTrip(r)
+	}
+	ctx, cancel := context.WithCancel(r.Context())
+	timer := time.AfterFunc(t.timeout, cancel)
+	res, err := t.rt.RoundTrip(r.WithContext(ctx))
+	if !timer.Stop() {
+		if err == nil {
+			res.Body.Close()
+		}
+		cancel()
+		return nil, errProxyTimeout
+	}
+	if err != nil {
+		cancel()
+		return nil, err
+	}
+	res.Body = &cancelReadCloser{ReadCloser: res.Body, cancel: cancel}
+	return res, nil
+}
+
+// cancelReadCloser releases the context of an upstream request when its
+// response body is closed.
+type cancelReadCloser struct {
+	io.ReadCloser
+	cancel context.CancelFunc
+}
+
+func (c *cancelReadCloser) Close() error {
+	err := c.ReadCloser.Close()
+	c.cancel()
+	return err
+}
+
+var errProxyTimeout = errors.New("upstream timeout")
+
+// proxyError is the default error handler of ReverseProxy.
+func proxyError(w http.ResponseWriter, r *http.Request, err error) {
+	code := http.StatusBadGateway
+	var netErr net.Error
+	if errors.Is(err, errProxyTimeout) || errors.Is(err, context.DeadlineExceeded) || (errors.As(err, &netErr) && netErr.Timeout()) {
+		code = http.StatusGatewayTimeout
+	}
+	if !writeProblem(w, r, code, "") {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
@@ -1,6 +1,9 @@
 package handlers
 
 import (
+	"context"
+	"fmt"
+	"net"
 	"net/http"
 	"regexp"
 	"strings"
@@ -42,9 +45,13 @@ var (
 // headers for validating the 'trustworthiness' of a request.
 func ProxyHeaders(h http.Handler) http.Handler {
 	fn := func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("proxy_headers", w, r)
+		defer end()
+
 		// Set the remote IP with the value passed from the proxy.
 		if fwd := getIP(r); fwd != "" {
 			r.RemoteAddr = fwd
+			r = r.WithContext(context.WithValue(r.Context(), clientIPKey, hostOnly(fwd)))
 		}
 
 		// Set the scheme (proto) with the value passed from the proxy.
@@ -62,6 +69,184 @@ func ProxyHeaders(h http.Handler) http.Handler {
 	return http.HandlerFunc(fn)
 }
 
+// TrustedProxyHeaders is like ProxyHeaders, but only honors the headers of
+// requests coming from the trusted proxies, given as IP addresses or CIDR
+// ranges, e.g. "10.0.0.0/8" or "::1". The headers of other requests are
+// ignored, so that clients can't spoof their address.
+//
+// The client IP address is the rightmost one of the X-Forwarded-For header, or
+// of the RFC7239 Forwarded header, which isn't a trusted proxy: the addresses
+// on its left were supplied by the client, and can't be trusted. The scheme and
+// host are taken from X-Forwarded-Proto, X-Forwarded-Scheme and
+// X-Forwarded-Host, or Forwarded.
+//
+// Handlers downstream, such as the logging handlers and RateLimit, see the
+// client IP address in r.RemoteAddr and through ClientIP. Invalid ranges are
+// ignored; NewTrustedProxyHeaders reports them instead.
+//
+// Example:
+//
+//	h := handlers.TrustedProxyHeaders("10.0.0.0/8", "127.0.0.1")(r)
+func TrustedProxyHeaders(trusted ...string) func(http.Handler) http.Handler {
+	nets, _ := parseTrustedProxies(trusted)
+	return func(h http.Handler) http.Handler {
+		return &trustedProxyHeaders{h: h, trusted: nets}
+	}
+}
+
+// NewTrustedProxyHeaders is like TrustedProxyHeaders, but returns an error if
+// one of the trusted addresses or ranges is invalid.
+func NewTrustedProxyHeaders(trusted ...string) (func(http.Handler) http.Handler, error) {
+	if _, err := parseTrustedProxies(trusted); err != nil {
+		return nil, err
+	}
+	return TrustedProxyHeaders(trusted...), nil
+}
+
+func parseTrustedProxies(trusted []string) ([]*net.IPNet, error) {
+	var nets []*net.IPNet
+	var err error
+	for _, s := range trusted {
+		if !strings.Contains(s, "/") {
+			if ip := net.ParseIP(s); ip != nil {
+				bits := 8 * net.IPv6len
+				if ip4 := ip.To4(); ip4 != nil {
+					ip, bits = ip4, 8*net.IPv4len
+				}
+				nets = append(nets, &net.IPNet{IP: ip, Mask: net.CIDRMask(bits, bits)})
+				continue
+			}
+		} else if _, n, perr := net.ParseCIDR(s); perr == nil {
+			nets = append(nets, n)
+			continue
+		}
+		if err == nil {
+			err = fmt.Errorf("handlers: invalid trusted proxy %q", s)
+		}
+	}
+	return nets, err
+}
+
+type trustedProxyHeaders struct {
+	h       http.Handler
+	trusted []*net.IPNet
+}
+
+func (p *trustedProxyHeaders) isTrusted(addr string) bool {
+	ip := net.ParseIP(addr)
+	if ip == nil {
+		return false
+	}
+	for _, n := range p.trusted {
+		if n.Contains(ip) {
+			return true
+		}
+	}
+	return false
+}
+
+func (p *trustedProxyHeaders) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("proxy_headers", w, r)
+	defer end()
+
+	if !p.isTrusted(hostOnly(r.RemoteAddr)) {
+		p.h.ServeHTTP(w, r)
+		return
+	}
+
+	if ip := p.clientIP(r); ip != "" {
+		r.RemoteAddr = ip
+		r = r.WithContext(context.WithValue(r.Context(), clientIPKey, ip))
+	}
+	if scheme := getScheme(r); scheme != "" {
+		r.URL.Scheme = scheme
+	}
+	if host := r.Header.Get(xForwardedHost); host != "" {
+		r.Host = strings.TrimSpace(strings.Split(host, ",")[0])
+	} else if host := forwardedParam(r.Header.Values(forwarded), "host"); host != "" {
+		r.Host = host
+	}
+	p.h.ServeHTTP(w, r)
+}
+
+// clientIP returns the address of the client which sent r through the trusted
+// proxies, or "" if there is none or it is invalid.
+func (p *trustedProxyHeaders) clientIP(r *http.Request) string {
+	var chain []string
+	if values := r.Header.Values(xForwardedFor); len(values) > 0 {
+		for _, v := range values {
+			for _, addr := range strings.Split(v, ",") {
+				chain = append(chain, strings.TrimSpace(addr))
+			}
+		}
+	} else if v := r.Header.Get(xRealIP); v != "" {
+		chain = []string{strings.TrimSpace(v)}
+	} else {
+		for _, elem := range forwardedElements(r.Header.Values(forwarded)) {
+			chain = append(chain, elem["for"])
+		}
+	}
+
+	for i := len(chain) - 1; i >= 0; i-- {
+		addr := hostOnly(chain[i])
+		if net.ParseIP(addr) == nil {
+			return ""
+		}
+		if i == 0 || !p.isTrusted(addr) {
+			return addr
+		}
+	}
+	return ""
+}
+
+// forwardedElements parses the RFC7239 Forwarded header values into their
+// elements, whose parameter names are lowercase.
+func forwardedElements(values []string) []map[string]string {
+	var elems []map[string]string
+	for _, v := range values {
+		for _, elem := range strings.Split(v, ",") {
+			params := map[string]string{}
+			for _, pair := range strings.Split(elem, ";") {
+				k, v, ok := strings.Cut(strings.TrimSpace(pair), "=")
+				if ok {
+					params[strings.ToLower(k)] = strings.Trim(v, `"`)
+				}
+			}
+			elems = append(elems, params)
+		}
+	}
+	return elems
+}
+
+// forwardedParam returns the first value of the named parameter in the RFC7239
+// Forwarded header values.
+func forwardedParam(values []string, name string) string {
+	for _, elem := range forwardedElements(values) {
+		if v := elem[name]; v != "" {
+			return v
+		}
+	}
+	return ""
+}
+
+// ClientIP returns the IP address of the client which sent the request: the
+// one established by ProxyHeaders or TrustedProxyHeaders if any, otherwise the
+// address of the peer.
+func ClientIP(r *http.Request) string {
+	if ip := ClientIPFromContext(r.Context()); ip != "" {
+		return ip
+	}
+	return hostOnly(r.RemoteAddr)
+}
+
+// hostOnly strips the port from addr, and the brackets from IPv6 addresses.
+func hostOnly(addr string) string {
+	if host, _, err := net.SplitHostPort(addr); err == nil {
+		return host
+	}
+	return strings.Trim(addr, "[]")
+}
+
 // getIP retrieves the IP from the X-Forwarded-For, X-Real-IP and RFC7239
 // Forwarded headers (in that order).
 func getIP(r *http.Request) string {
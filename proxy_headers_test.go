@@ -109,3 +109,98 @@ func TestProxyHeaders(t *testing.T) {
 	}
 
 }
+
+func TestTrustedProxyHeaders(t *testing.T) {
+	tests := []struct {
+		name     string
+		peer     string
+		header   http.Header
+		clientIP string
+		scheme   string
+		host     string
+	}{
+		{
+			name:     "untrusted peer",
+			peer:     "203.0.113.9:4000",
+			header:   http.Header{xForwardedFor: {"198.51.100.1"}, xForwardedProto: {"https"}, xForwardedHost: {"evil.com"}},
+			clientIP: "203.0.113.9",
+			host:     "example.com",
+		},
+		{
+			name:     "trusted peer",
+			peer:     "10.0.0.2:4000",
+			header:   http.Header{xForwardedFor: {"198.51.100.1"}, xForwardedProto: {"https"}, xForwardedHost: {"www.example.com"}},
+			clientIP: "198.51.100.1",
+			scheme:   "https",
+			host:     "www.example.com",
+		},
+		{
+			name:     "spoofed chain",
+			peer:     "10.0.0.2:4000",
+			header:   http.Header{xForwardedFor: {"1.1.1.1, 198.51.100.1, 10.0.0.7"}},
+			clientIP: "198.51.100.1",
+			host:     "example.com",
+		},
+		{
+			name:     "several headers",
+			peer:     "10.0.0.2:4000",
+			header:   http.Header{xForwardedFor: {"1.1.1.1", "198.51.100.1:5000"}},
+			clientIP: "198.51.100.1",
+			host:     "example.com",
+		},
+		{
+			name:     "all trusted",
+			peer:     "127.0.0.1:4000",
+			header:   http.Header{xForwardedFor: {"10.0.0.3, 10.0.0.2"}},
+			clientIP: "10.0.0.3",
+			host:     "example.com",
+		},
+		{
+			name:     "invalid address",
+			peer:     "10.0.0.2:4000",
+			header:   http.Header{xForwardedFor: {"198.51.100.1, unknown"}},
+			clientIP: "10.0.0.2",
+			host:     "example.com",
+		},
+		{
+			name:     "real IP",
+			peer:     "[::1]:4000",
+			header:   http.Header{xRealIP: {"2001:db8::1"}},
+			clientIP: "2001:db8::1",
+			host:     "example.com",
+		},
+		{
+			name:     "forwarded",
+			peer:     "10.0.0.2:4000",
+			header:   http.Header{forwarded: {`for=1.1.1.1, for="[2001:db8::1]:4711";proto=https;host=api.example.com, for=10.0.0.9`}},
+			clientIP: "2001:db8::1",
+			scheme:   "https",
+			host:     "api.example.com",
+		},
+	}
+	mw := TrustedProxyHeaders("10.0.0.0/8", "127.0.0.1", "::1")
+	for _, test := range tests {
+		r := newRequest("GET", "http://example.com/")
+		r.URL.Scheme = ""
+		r.RemoteAddr = test.peer
+		r.Header = test.header
+		var clientIP, scheme, host string
+		mw(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			clientIP, scheme, host = ClientIP(r), r.URL.Scheme, r.Host
+		})).ServeHTTP(httptest.NewRecorder(), r)
+		if clientIP != test.clientIP || scheme != test.scheme || host != test.host {
+			t.Errorf("%s: got %q %q %q, want %q %q %q", test.name, clientIP, scheme, host, test.clientIP, test.scheme, test.host)
+		}
+	}
+}
+
+func TestNewTrustedProxyHeaders(t *testing.T) {
+	if _, err := NewTrustedProxyHeaders("10.0.0.0/8", "192.168.1.1", "fd00::/8"); err != nil {
+		t.Error(err)
+	}
+	for _, trusted := range []string{"10.0.0.0/33", "proxy.local", ""} {
+		if _, err := NewTrustedProxyHeaders(trusted); err == nil {
+			t.Errorf("%q: got no error", trusted)
+		}
+	}
+}
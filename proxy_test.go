@@ -0,0 +1,207 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func newProxyTest(t *testing.T, upstream http.HandlerFunc, opts ...ReverseProxyOption) (*httptest.Server, func()) {
+	backend := httptest.NewServer(upstream)
+	target, err := url.Parse(backend.URL + "/base")
+	if err != nil {
+		t.Fatal(err)
+	}
+	front := httptest.NewServer(ProxyHeaders(ReverseProxy(target, opts...)))
+	return front, func() {
+		front.Close()
+		backend.Close()
+	}
+}
+
+func TestReverseProxyForwardedHeaders(t *testing.T) {
+	var got *http.Request
+	front, done := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		w.Header().Set("Server", "backend")
+		w.Header().Set("X-Upstream", "1")
+	}, ProxyForwardedHeader(), ProxyRequestHeader("X-Secret", "s3cret"), ProxyResponseHeader("Server", ""))
+	defer done()
+
+	req, _ := http.NewRequest("GET", front.URL+"/items?q=1", nil)
+	req.Header.Set(xForwardedFor, "203.0.113.7")
+	req.Header.Set(xForwardedProto, "https")
+	req.Header.Set(xForwardedHost, "example.com")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if got.URL.Path != "/base/items" || got.URL.RawQuery != "q=1" {
+		t.Errorf("wrong upstream URL: %s", got.URL)
+	}
+	for name, want := range map[string]string{
+		xForwardedFor:   "203.0.113.7",
+		xForwardedProto: "https",
+		xForwardedHost:  "example.com",
+		xRealIP:         "203.0.113.7",
+		forwarded:       "for=203.0.113.7;proto=https;host=example.com",
+		"X-Secret":      "s3cret",
+	} {
+		if v := got.Header.Get(name); v != want {
+			t.Errorf("wrong %s header: got %q want %q", name, v, want)
+		}
+	}
+	if res.Header.Get("Server") != "" || res.Header.Get("X-Upstream") != "1" {
+		t.Errorf("wrong response headers: %v", res.Header)
+	}
+}
+
+func TestReverseProxyUntrustedForwarded(t *testing.T) {
+	var got *http.Request
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+	front := httptest.NewServer(ReverseProxy(target))
+	defer front.Close()
+
+	req, _ := http.NewRequest("GET", front.URL, nil)
+	req.Header.Set(xForwardedFor, "203.0.113.7")
+	req.Header.Set(xRealIP, "203.0.113.7")
+	res, err := http.DefaultClient.Do(req)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+
+	if v := got.Header.Get(xForwardedFor); v != "127.0.0.1" {
+		t.Errorf("wrong X-Forwarded-For: got %q want %q", v, "127.0.0.1")
+	}
+	if v := got.Header.Get(xRealIP); v != "127.0.0.1" {
+		t.Errorf("wrong X-Real-IP: got %q want %q", v, "127.0.0.1")
+	}
+	if v := got.Header.Get(xForwardedProto); v != "http" {
+		t.Errorf("wrong X-Forwarded-Proto: got %q want %q", v, "http")
+	}
+}
+
+func TestReverseProxyRequestID(t *testing.T) {
+	var id string
+	backend := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id = r.Header.Get(RequestIDHeader)
+	}))
+	defer backend.Close()
+	target, _ := url.Parse(backend.URL)
+	front := httptest.NewServer(RequestIDHandler()(ReverseProxy(target)))
+	defer front.Close()
+
+	res, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if id == "" || id != res.Header.Get(RequestIDHeader) {
+		t.Fatalf("request ID not forwarded: got %q want %q", id, res.Header.Get(RequestIDHeader))
+	}
+}
+
+func TestReverseProxyRetries(t *testing.T) {
+	var calls int32
+	front, done := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		if atomic.AddInt32(&calls, 1) < 3 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		w.Write([]byte("ok"))
+	}, ProxyRetries(2, time.Millisecond))
+	defer done()
+
+	res, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || atomic.LoadInt32(&calls) != 3 {
+		t.Fatalf("got status %d after %d calls", res.StatusCode, calls)
+	}
+
+	atomic.StoreInt32(&calls, 0)
+	res, err = http.Post(front.URL, "text/plain", nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusServiceUnavailable || atomic.LoadInt32(&calls) != 1 {
+		t.Fatalf("POST: got status %d after %d calls", res.StatusCode, calls)
+	}
+}
+
+func TestReverseProxyTimeout(t *testing.T) {
+	release := make(chan struct{})
+	front, done := newProxyTest(t, func(w http.ResponseWriter, r *http.Request) {
+		select {
+		case <-release:
+		case <-r.Context().Done():
+		}
+	}, ProxyTimeout(20*time.Millisecond))
+	defer done()
+	defer close(release)
+
+	res, err := http.Get(front.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusGatewayTimeout {
+		t.Fatalf("wrong status: got %d want %d", res.StatusCode, http.StatusGatewayTimeout)
+	}
+}
+
+func TestReverseProxyErrorHandler(t *testing.T) {
+	target, _ := url.Parse("http://127.0.0.1:1")
+	var proxyErr error
+	handler := ReverseProxy(target, ProxyErrorHandler(func(w http.ResponseWriter, r *http.Request, err error) {
+		proxyErr = err
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusTeapot || proxyErr == nil {
+		t.Fatalf("error handler not called: %d %v", rec.Code, proxyErr)
+	}
+
+	rec = httptest.NewRecorder()
+	ReverseProxy(target).ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusBadGateway {
+		t.Fatalf("wrong status: got %d want %d", rec.Code, http.StatusBadGateway)
+	}
+}
+
+func TestNewReverseProxy(t *testing.T) {
+	target, _ := url.Parse("http://127.0.0.1:8080")
+	relative, _ := url.Parse("/api")
+	tests := []struct {
+		target *url.URL
+		opts   []ReverseProxyOption
+		ok     bool
+	}{
+		{target, []ReverseProxyOption{ProxyTimeout(time.Second), ProxyRetries(2, time.Millisecond)}, true},
+		{nil, nil, false},
+		{relative, nil, false},
+		{target, []ReverseProxyOption{ProxyTimeout(-time.Second)}, false},
+		{target, []ReverseProxyOption{ProxyRetries(-1, 0)}, false},
+		{target, []ReverseProxyOption{ProxyTransport(nil)}, false},
+	}
+	for i, test := range tests {
+		if _, err := NewReverseProxy(test.target, test.opts...); (err == nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
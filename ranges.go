@@ -0,0 +1,141 @@
+package handlers
+
+import (
+	"bytes"
+	"fmt"
+	"net/http"
+	"strings"
+)
+
+const defaultRangeMaxSize = 32 << 20
+
+// RangeOption represents a functional option for configuring the range
+// requests middleware.
+type RangeOption func(*ranges) error
+
+type ranges struct {
+	h            http.Handler
+	maxSize      int
+	pathPrefixes []string
+}
+
+// RangeRequests is HTTP middleware serving byte ranges (RFC 9110, section 14)
+// of the responses of handlers which don't support them, e.g. dynamically
+// generated downloads, so that clients can resume interrupted transfers.
+//
+// Responses to GET requests with a Range header are buffered, up to a maximum
+// size (32MiB by default), and the requested ranges of successful responses
+// are served with 206 Partial Content and Content-Range headers, or 416 Range
+// Not Satisfiable. If-Range is evaluated against the ETag and Last-Modified
+// headers of the response. Larger responses, responses flushed by the handler
+// and responses which are already partial are passed through untouched.
+// Other successful GET responses are marked with "Accept-Ranges: bytes".
+//
+// Since the handler generates the full response for every range, it must be
+// deterministic for resumed downloads to be consistent; setting an ETag, e.g.
+// with the ETag middleware, lets clients detect changes with If-Range.
+//
+// Example:
+//
+//	ranges := handlers.RangeRequests(handlers.RangePathPrefixes([]string{"/exports/"}))
+//	http.ListenAndServe(":1123", ranges(handlers.ETag()(r)))
+func RangeRequests(opts ...RangeOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		rr := &ranges{h: h, maxSize: defaultRangeMaxSize}
+		for _, option := range opts {
+			option(rr)
+		}
+		return rr
+	}
+}
+
+// NewRangeRequests is like RangeRequests, but returns an error if an option
+// is invalid.
+func NewRangeRequests(opts ...RangeOption) (func(http.Handler) http.Handler, error) {
+	rr := &ranges{}
+	for _, option := range opts {
+		if err := option(rr); err != nil {
+			return nil, err
+		}
+	}
+	return RangeRequests(opts...), nil
+}
+
+// RangeMaxSize sets the maximum size of the responses buffered to serve byte
+// ranges. Larger responses are served in full.
+func RangeMaxSize(n int) RangeOption {
+	return func(rr *ranges) error {
+		rr.maxSize = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid range max size %d", n)
+		}
+		return nil
+	}
+}
+
+// RangePathPrefixes restricts range support to requests whose path starts
+// with one of the given prefixes. By default all paths are considered.
+func RangePathPrefixes(prefixes []string) RangeOption {
+	return func(rr *ranges) error {
+		rr.pathPrefixes = append(rr.pathPrefixes, prefixes...)
+		return nil
+	}
+}
+
+func (rr *ranges) matchPath(path string) bool {
+	if len(rr.pathPrefixes) == 0 {
+		return true
+	}
+	for _, prefix := range rr.pathPrefixes {
+		if strings.HasPrefix(path, prefix) {
+			return true
+		}
+	}
+	return false
+}
+
+func (rr *ranges) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("ranges", w, r)
+	defer end()
+
+	if r.Method != "GET" || isStreamingRequest(r) || !rr.matchPath(r.URL.Path) {
+		rr.h.ServeHTTP(w, r)
+		return
+	}
+
+	if r.Header.Get("Range") == "" {
+		cw, finish := beforeWriteHeader(w, func(status int) {
+			h := w.Header()
+			if status == http.StatusOK && h.Get("Accept-Ranges") == "" {
+				h.Set("Accept-Ranges", "bytes")
+			}
+		})
+		rr.h.ServeHTTP(cw, r)
+		finish()
+		return
+	}
+
+	bw := &bufferedResponseWriter{w: w, max: rr.maxSize}
+	rr.h.ServeHTTP(bw.wrap(), r)
+	if bw.passthrough {
+		return
+	}
+
+	h := w.Header()
+	if bw.status == 0 {
+		bw.status = http.StatusOK
+	}
+	if bw.status != http.StatusOK || h.Get("Content-Range") != "" || h.Get("Accept-Ranges") == "none" {
+		bw.flush()
+		return
+	}
+
+	// http.ServeContent implements Range and If-Range, using the ETag header
+	// and the modification time.
+	lastModified, _ := http.ParseTime(h.Get("Last-Modified"))
+	body := bw.buf.Bytes()
+	bw.buf = bytes.Buffer{}
+	bw.passthrough = true
+	h.Del("Content-Length")
+	http.ServeContent(w, r, "", lastModified, bytes.NewReader(body))
+}
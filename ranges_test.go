@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestRangeRequests(t *testing.T) {
+	body := strings.Repeat("0123456789", 10)
+	handler := RangeRequests()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("Content-Type", "text/plain")
+		w.Header().Set(etagHeader, `"v1"`)
+		io.WriteString(w, body)
+	}))
+
+	tests := []struct {
+		rangeHeader  string
+		ifRange      string
+		code         int
+		contentRange string
+		body         string
+	}{
+		{"", "", http.StatusOK, "", body},
+		{"bytes=10-19", "", http.StatusPartialContent, "bytes 10-19/100", body[10:20]},
+		{"bytes=95-", "", http.StatusPartialContent, "bytes 95-99/100", body[95:]},
+		{"bytes=-3", "", http.StatusPartialContent, "bytes 97-99/100", body[97:]},
+		{"bytes=200-", "", http.StatusRequestedRangeNotSatisfiable, "bytes */100", ""},
+		{"bytes=10-19", `"v1"`, http.StatusPartialContent, "bytes 10-19/100", body[10:20]},
+		{"bytes=10-19", `"v0"`, http.StatusOK, "", body},
+	}
+
+	for _, test := range tests {
+		r := newRequest("GET", "/")
+		if test.rangeHeader != "" {
+			r.Header.Set("Range", test.rangeHeader)
+		}
+		if test.ifRange != "" {
+			r.Header.Set("If-Range", test.ifRange)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+
+		if rec.Code != test.code {
+			t.Errorf("%s (If-Range %s): bad status: got %d want %d", test.rangeHeader, test.ifRange, rec.Code, test.code)
+			continue
+		}
+		if got := rec.Header().Get("Content-Range"); got != test.contentRange {
+			t.Errorf("%s: bad Content-Range: got %q want %q", test.rangeHeader, got, test.contentRange)
+		}
+		if test.code != http.StatusRequestedRangeNotSatisfiable && rec.Header().Get("Accept-Ranges") != "bytes" {
+			t.Errorf("%s: missing Accept-Ranges", test.rangeHeader)
+		}
+		if test.code != http.StatusRequestedRangeNotSatisfiable && rec.Body.String() != test.body {
+			t.Errorf("%s: bad body: got %q want %q", test.rangeHeader, rec.Body.String(), test.body)
+		}
+	}
+}
+
+func TestRangeRequestsPassthrough(t *testing.T) {
+	body := strings.Repeat("x", 100)
+	handler := RangeRequests(RangeMaxSize(50))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/missing" {
+			http.NotFound(w, r)
+			return
+		}
+		io.WriteString(w, body)
+	}))
+
+	for _, path := range []string{"/large", "/missing"} {
+		r := newRequest("GET", path)
+		r.Header.Set("Range", "bytes=0-9")
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		if rec.Code == http.StatusPartialContent || rec.Header().Get("Content-Range") != "" {
+			t.Errorf("%s: range served: %d %v", path, rec.Code, rec.Header())
+		}
+	}
+}
+
+func TestNewRangeRequests(t *testing.T) {
+	if _, err := NewRangeRequests(RangeMaxSize(1 << 20)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRangeRequests(RangeMaxSize(0)); err == nil {
+		t.Fatal("expected an error for a zero max size")
+	}
+}
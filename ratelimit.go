@@ -0,0 +1,243 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"math"
+	"net/http"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// rateLimitSweepInterval is how often the in-memory store evicts the buckets
+// which are full again, and so equivalent to absent ones.
+const rateLimitSweepInterval = time.Minute
+
+// RateLimitStore keeps the token buckets of RateLimit. The default one keeps
+// them in memory; stores backed by a shared database, e.g. Redis with a Lua
+// script, let several instances of a service enforce a common limit.
+type RateLimitStore interface {
+	// Take takes a token from the bucket of key, which holds at most burst
+	// tokens and regains rate tokens per second, as of now. Absent buckets
+	// are full.
+	Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (RateLimitResult, error)
+}
+
+// RateLimitResult is the state of a token bucket after a request took, or
+// tried to take, a token from it.
+type RateLimitResult struct {
+	// Allowed reports whether there was a token for the request.
+	Allowed bool
+	// Remaining is the number of whole tokens left.
+	Remaining int
+	// RetryAfter is the time until a token is available, if the request
+	// wasn't allowed.
+	RetryAfter time.Duration
+	// ResetAfter is the time until the bucket is full again.
+	ResetAfter time.Duration
+}
+
+// RateLimitOption represents a functional option for configuring RateLimit.
+type RateLimitOption func(*rateLimiter) error
+
+type rateLimiter struct {
+	h     http.Handler
+	rate  float64
+	burst int
+	key   func(r *http.Request) string
+	store RateLimitStore
+	now   func() time.Time
+}
+
+// RateLimitBurst sets the number of requests a client can send at once, after
+// being idle, which defaults to the limit of RateLimit.
+func RateLimitBurst(n int) RateLimitOption {
+	return func(l *rateLimiter) error {
+		l.burst = n
+		if n <= 0 {
+			return fmt.Errorf("handlers: invalid rate limit burst %d", n)
+		}
+		return nil
+	}
+}
+
+// RateLimitKey sets the function returning the key whose bucket the requests
+// take tokens from, e.g. their API key, instead of the client IP address.
+// Requests with an empty key aren't limited.
+func RateLimitKey(fn func(r *http.Request) string) RateLimitOption {
+	return func(l *rateLimiter) error {
+		if fn == nil {
+			return errors.New("handlers: nil rate limit key function")
+		}
+		l.key = fn
+		return nil
+	}
+}
+
+// RateLimitWithStore makes RateLimit keep its token buckets in store instead
+// of memory.
+func RateLimitWithStore(store RateLimitStore) RateLimitOption {
+	return func(l *rateLimiter) error {
+		if store == nil {
+			return errors.New("handlers: nil rate limit store")
+		}
+		l.store = store
+		return nil
+	}
+}
+
+// RateLimit is HTTP middleware limiting each client to limit requests per
+// period, with a token bucket per client: a bucket holds up to limit tokens,
+// see RateLimitBurst, and is refilled steadily over period. Clients are told
+// apart by IP address, the one established by ProxyHeaders if any, or by the
+// key of RateLimitKey.
+//
+// Responses carry the X-RateLimit-Limit, X-RateLimit-Remaining and
+// X-RateLimit-Reset headers, the latter being the number of seconds until the
+// bucket is full. Requests exceeding the limit are answered with 429 Too Many
+// Requests and a Retry-After header. If the store fails, requests are served.
+//
+// Example:
+//
+//	limit := handlers.RateLimit(100, time.Minute, handlers.RateLimitBurst(20),
+//		handlers.RateLimitKey(func(r *http.Request) string {
+//			return r.Header.Get("X-Api-Key")
+//		}),
+//	)
+//	http.Handle("/api/", limit(api))
+func RateLimit(limit int, period time.Duration, opts ...RateLimitOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		l := newRateLimiter(limit, period)
+		l.h = h
+		for _, option := range opts {
+			option(l)
+		}
+		return l
+	}
+}
+
+// NewRateLimit is like RateLimit, but returns an error if limit or period
+// isn't positive, or an option is invalid.
+func NewRateLimit(limit int, period time.Duration, opts ...RateLimitOption) (func(http.Handler) http.Handler, error) {
+	if limit <= 0 || period <= 0 {
+		return nil, fmt.Errorf("handlers: invalid rate limit of %d requests per %v", limit, period)
+	}
+	l := newRateLimiter(limit, period)
+	for _, option := range opts {
+		if err := option(l); err != nil {
+			return nil, err
+		}
+	}
+	return RateLimit(limit, period, opts...), nil
+}
+
+func newRateLimiter(limit int, period time.Duration) *rateLimiter {
+	l := &rateLimiter{
+		burst: limit,
+		key:   ClientIP,
+		store: &memoryRateLimitStore{buckets: map[string]*tokenBucket{}},
+		now:   time.Now,
+	}
+	if period > 0 {
+		l.rate = float64(limit) / period.Seconds()
+	}
+	return l
+}
+
+func (l *rateLimiter) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("rate_limit", w, r)
+	defer end()
+
+	key := l.key(r)
+	if key == "" || l.rate <= 0 || l.burst <= 0 {
+		l.h.ServeHTTP(w, r)
+		return
+	}
+	res, err := l.store.Take(r.Context(), key, l.rate, l.burst, l.now())
+	if err != nil {
+		l.h.ServeHTTP(w, r)
+		return
+	}
+
+	h := w.Header()
+	h.Set("X-RateLimit-Limit", strconv.Itoa(l.burst))
+	h.Set("X-RateLimit-Remaining", strconv.Itoa(res.Remaining))
+	h.Set("X-RateLimit-Reset", strconv.FormatInt(ceilSeconds(res.ResetAfter), 10))
+	if res.Allowed {
+		l.h.ServeHTTP(w, r)
+		return
+	}
+
+	retryAfter := ceilSeconds(res.RetryAfter)
+	if retryAfter < 1 {
+		retryAfter = 1
+	}
+	h.Set("Retry-After", strconv.FormatInt(retryAfter, 10))
+	if !writeProblem(w, r, http.StatusTooManyRequests, "rate limit exceeded") {
+		http.Error(w, http.StatusText(http.StatusTooManyRequests), http.StatusTooManyRequests)
+	}
+}
+
+func ceilSeconds(d time.Duration) int64 {
+	return int64(math.Ceil(d.Seconds()))
+}
+
+// memoryRateLimitStore is the default RateLimitStore.
+type memoryRateLimitStore struct {
+	mu        sync.Mutex
+	buckets   map[string]*tokenBucket
+	lastSweep time.Time
+}
+
+type tokenBucket struct {
+	tokens float64
+	last   time.Time
+	full   time.Time
+}
+
+func (s *memoryRateLimitStore) Take(ctx context.Context, key string, rate float64, burst int, now time.Time) (RateLimitResult, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.sweep(now)
+
+	b, ok := s.buckets[key]
+	if !ok {
+		b = &tokenBucket{tokens: float64(burst), last: now}
+		s.buckets[key] = b
+	} else if elapsed := now.Sub(b.last); elapsed > 0 {
+		b.tokens = math.Min(float64(burst), b.tokens+elapsed.Seconds()*rate)
+		b.last = now
+	}
+
+	var res RateLimitResult
+	if b.tokens >= 1 {
+		b.tokens--
+		res.Allowed = true
+	} else {
+		res.RetryAfter = secondsDuration((1 - b.tokens) / rate)
+	}
+	res.Remaining = int(b.tokens)
+	res.ResetAfter = secondsDuration((float64(burst) - b.tokens) / rate)
+	b.full = now.Add(res.ResetAfter)
+	return res, nil
+}
+
+// sweep evicts the buckets which are full again, at most once per
+// rateLimitSweepInterval.
+func (s *memoryRateLimitStore) sweep(now time.Time) {
+	if now.Sub(s.lastSweep) < rateLimitSweepInterval {
+		return
+	}
+	s.lastSweep = now
+	for key, b := range s.buckets {
+		if !now.Before(b.full) {
+			delete(s.buckets, key)
+		}
+	}
+}
+
+func secondsDuration(s float64) time.Duration {
+	return time.Duration(s * float64(time.Second))
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestRateLimit(t *testing.T) {
+	now := time.Date(2024, 5, 26, 3, 30, 45, 0, time.UTC)
+	h := RateLimit(60, time.Minute, RateLimitBurst(2))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	h.(*rateLimiter).now = func() time.Time { return now }
+
+	serve := func(addr string) *httptest.ResponseRecorder {
+		r := newRequest("GET", "http://example.com/")
+		r.RemoteAddr = addr
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		return w
+	}
+
+	tests := []struct {
+		advance   time.Duration
+		addr      string
+		code      int
+		remaining string
+		reset     string
+		retry     string
+	}{
+		{0, "192.0.2.1:1000", 200, "1", "1", ""},
+		{0, "192.0.2.1:1001", 200, "0", "2", ""},
+		{0, "192.0.2.1:1002", 429, "0", "2", "1"},
+		{0, "192.0.2.2:1000", 200, "1", "1", ""},
+		{500 * time.Millisecond, "192.0.2.1:1003", 429, "0", "2", "1"},
+		{500 * time.Millisecond, "192.0.2.1:1004", 200, "0", "2", ""},
+		{10 * time.Second, "192.0.2.1:1005", 200, "1", "1", ""},
+	}
+	for i, test := range tests {
+		now = now.Add(test.advance)
+		w := serve(test.addr)
+		if w.Code != test.code {
+			t.Errorf("%d: got status %d, want %d", i, w.Code, test.code)
+		}
+		if got := w.Header().Get("X-RateLimit-Limit"); got != "2" {
+			t.Errorf("%d: got X-RateLimit-Limit %q", i, got)
+		}
+		if got := w.Header().Get("X-RateLimit-Remaining"); got != test.remaining {
+			t.Errorf("%d: got X-RateLimit-Remaining %q, want %q", i, got, test.remaining)
+		}
+		if got := w.Header().Get("X-RateLimit-Reset"); got != test.reset {
+			t.Errorf("%d: got X-RateLimit-Reset %q, want %q", i, got, test.reset)
+		}
+		if got := w.Header().Get("Retry-After"); got != test.retry {
+			t.Errorf("%d: got Retry-After %q, want %q", i, got, test.retry)
+		}
+	}
+}
+
+func TestRateLimitKey(t *testing.T) {
+	h := RateLimit(1, time.Hour, RateLimitKey(func(r *http.Request) string {
+		return r.Header.Get("X-Api-Key")
+	}))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+
+	for i, test := range []struct {
+		key  string
+		code int
+	}{{"a", 200}, {"a", 429}, {"b", 200}, {"", 200}, {"", 200}} {
+		r := newRequest("GET", "http://example.com/")
+		r.Header.Set("X-Api-Key", test.key)
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, r)
+		if w.Code != test.code {
+			t.Errorf("%d: got status %d, want %d", i, w.Code, test.code)
+		}
+	}
+}
+
+type failingRateLimitStore struct{}
+
+func (failingRateLimitStore) Take(context.Context, string, float64, int, time.Time) (RateLimitResult, error) {
+	return RateLimitResult{}, errors.New("unavailable")
+}
+
+func TestRateLimitStoreFailure(t *testing.T) {
+	h := RateLimit(1, time.Hour, RateLimitWithStore(failingRateLimitStore{}))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	for i := 0; i < 3; i++ {
+		w := httptest.NewRecorder()
+		h.ServeHTTP(w, newRequest("GET", "http://example.com/"))
+		if w.Code != http.StatusOK {
+			t.Fatalf("got status %d", w.Code)
+		}
+	}
+}
+
+func TestMemoryRateLimitStoreSweep(t *testing.T) {
+	s := &memoryRateLimitStore{buckets: map[string]*tokenBucket{}}
+	now := time.Now()
+	s.Take(context.Background(), "a", 1, 10, now)
+	s.Take(context.Background(), "b", 0.001, 10, now)
+	s.Take(context.Background(), "c", 1, 10, now.Add(2*rateLimitSweepInterval))
+	if _, ok := s.buckets["a"]; ok {
+		t.Error("full bucket wasn't evicted")
+	}
+	if _, ok := s.buckets["b"]; !ok {
+		t.Error("refilling bucket was evicted")
+	}
+}
+
+func TestNewRateLimit(t *testing.T) {
+	tests := []struct {
+		limit  int
+		period time.Duration
+		opts   []RateLimitOption
+		ok     bool
+	}{
+		{10, time.Second, nil, true},
+		{10, time.Second, []RateLimitOption{RateLimitBurst(5), RateLimitKey(ClientIP)}, true},
+		{0, time.Second, nil, false},
+		{10, 0, nil, false},
+		{10, time.Second, []RateLimitOption{RateLimitBurst(0)}, false},
+		{10, time.Second, []RateLimitOption{RateLimitKey(nil)}, false},
+		{10, time.Second, []RateLimitOption{RateLimitWithStore(nil)}, false},
+	}
+	for i, test := range tests {
+		mw, err := NewRateLimit(test.limit, test.period, test.opts...)
+		if (err == nil) != test.ok || (mw != nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
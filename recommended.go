@@ -0,0 +1,194 @@
+package handlers
+
+import (
+	"compress/gzip"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"time"
+)
+
+const defaultRecommendedTimeout = 30 * time.Second
+
+// RecommendedOption represents a functional option for configuring the stack
+// returned by Recommended.
+type RecommendedOption func(*recommended) error
+
+type recommended struct {
+	requestID       []RequestIDOption
+	trustProxy      bool
+	logOut          io.Writer
+	recovery        []RecoveryOption
+	securityHeaders http.Header
+	compressLevel   int
+	timeout         time.Duration
+}
+
+// Recommended returns a Stack of the middlewares most services want, with
+// defaults suitable for production. From the outermost:
+//
+//   - RequestIDHandler, assigning each request an ID;
+//   - ProxyHeaders, only with RecommendedTrustProxy;
+//   - CombinedLoggingHandler, logging to os.Stdout;
+//   - RecoveryHandler, answering panics with 500 Internal Server Error;
+//   - security headers: X-Content-Type-Options, X-Frame-Options,
+//     Referrer-Policy, and Strict-Transport-Security on HTTPS requests;
+//   - CompressHandler, at the default gzip level;
+//   - Timeout, answering requests taking more than 30 seconds with 503
+//     Service Unavailable. Upgrade requests aren't subject to it.
+//
+// Each layer can be adjusted or disabled with the options below. As a Stack,
+// the result can be extended with further middlewares.
+//
+// Example:
+//
+//	stack := handlers.Recommended(
+//		handlers.RecommendedTrustProxy(),
+//		handlers.RecommendedTimeout(5*time.Second),
+//	)
+//	http.ListenAndServe(":1123", stack.Then(r))
+func Recommended(opts ...RecommendedOption) Stack {
+	rc := newRecommended()
+	for _, option := range opts {
+		option(rc)
+	}
+	return rc.stack()
+}
+
+// NewRecommended is like Recommended, but returns an error if an option is
+// invalid.
+func NewRecommended(opts ...RecommendedOption) (Stack, error) {
+	rc := newRecommended()
+	for _, option := range opts {
+		if err := option(rc); err != nil {
+			return nil, err
+		}
+	}
+	return rc.stack(), nil
+}
+
+func newRecommended() *recommended {
+	return &recommended{
+		logOut: os.Stdout,
+		securityHeaders: http.Header{
+			"X-Content-Type-Options":    {"nosniff"},
+			"X-Frame-Options":           {"DENY"},
+			"Referrer-Policy":           {"strict-origin-when-cross-origin"},
+			"Strict-Transport-Security": {"max-age=63072000; includeSubDomains"},
+		},
+		compressLevel: gzip.DefaultCompression,
+		timeout:       defaultRecommendedTimeout,
+	}
+}
+
+// RecommendedRequestID sets the options of the RequestIDHandler layer.
+func RecommendedRequestID(opts ...RequestIDOption) RecommendedOption {
+	return func(rc *recommended) error {
+		rc.requestID = opts
+		return nil
+	}
+}
+
+// RecommendedTrustProxy adds the ProxyHeaders layer, so that the client
+// address, scheme and host are taken from the forwarding headers. Only use it
+// behind a reverse proxy which sets them.
+func RecommendedTrustProxy() RecommendedOption {
+	return func(rc *recommended) error {
+		rc.trustProxy = true
+		return nil
+	}
+}
+
+// RecommendedLogging sets where requests are logged. A nil out disables the
+// logging layer.
+func RecommendedLogging(out io.Writer) RecommendedOption {
+	return func(rc *recommended) error {
+		rc.logOut = out
+		return nil
+	}
+}
+
+// RecommendedRecovery sets the options of the RecoveryHandler layer.
+func RecommendedRecovery(opts ...RecoveryOption) RecommendedOption {
+	return func(rc *recommended) error {
+		rc.recovery = opts
+		return nil
+	}
+}
+
+// RecommendedSecurityHeader sets a security header added to every response,
+// e.g. Content-Security-Policy, which may contain CSPNoncePlaceholder as with
+// SecureHeaders. An empty value removes one of the defaults. Handlers can
+// still override the headers.
+func RecommendedSecurityHeader(name, value string) RecommendedOption {
+	return func(rc *recommended) error {
+		rc.securityHeaders[http.CanonicalHeaderKey(name)] = []string{value}
+		return nil
+	}
+}
+
+// RecommendedCompression sets the gzip compression level of the compression
+// layer. gzip.NoCompression disables it.
+func RecommendedCompression(level int) RecommendedOption {
+	return func(rc *recommended) error {
+		rc.compressLevel = level
+		if level < gzip.HuffmanOnly || level > gzip.BestCompression {
+			return fmt.Errorf("handlers: invalid compression level %d", level)
+		}
+		return nil
+	}
+}
+
+// RecommendedTimeout sets the time limit of the timeout layer. Zero disables
+// it, e.g. for services streaming responses for longer; see Timeout for
+// exempting some requests only.
+func RecommendedTimeout(d time.Duration) RecommendedOption {
+	return func(rc *recommended) error {
+		rc.timeout = d
+		if d < 0 {
+			return fmt.Errorf("handlers: invalid timeout %v", d)
+		}
+		return nil
+	}
+}
+
+func (rc *recommended) stack() Stack {
+	stack := NewStack(RequestIDHandler(rc.requestID...))
+	if rc.trustProxy {
+		stack = stack.Append(ProxyHeaders)
+	}
+	if rc.logOut != nil {
+		out := rc.logOut
+		stack = stack.Append(func(h http.Handler) http.Handler {
+			return CombinedLoggingHandler(out, h)
+		})
+	}
+	stack = stack.Append(RecoveryHandler(rc.recovery...), securityHeaders(rc.securityHeaders))
+	if rc.compressLevel != gzip.NoCompression {
+		level := rc.compressLevel
+		stack = stack.Append(func(h http.Handler) http.Handler {
+			return CompressHandlerLevel(h, level)
+		})
+	}
+	if rc.timeout > 0 {
+		stack = stack.Append(Timeout(rc.timeout))
+	}
+	return stack
+}
+
+// securityHeaders sets the given headers on every response, before the
+// handler runs, as SecureHeaders does. Empty values are skipped.
+func securityHeaders(headers http.Header) Middleware {
+	headers = headers.Clone()
+	for name, values := range headers {
+		if values[0] == "" {
+			delete(headers, name)
+		}
+	}
+	return func(h http.Handler) http.Handler {
+		s := &secureHeaders{h: h, headers: headers}
+		s.prepare()
+		return s
+	}
+}
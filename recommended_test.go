@@ -0,0 +1,142 @@
+package handlers
+
+import (
+	"bytes"
+	"compress/gzip"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestRecommended(t *testing.T) {
+	var logs bytes.Buffer
+	h := Recommended(RecommendedLogging(&logs), RecommendedSecurityHeader("X-Frame-Options", "")).
+		ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			if r.URL.Path == "/panic" {
+				panic("boom")
+			}
+			w.Write([]byte(strings.Repeat("hello ", 100)))
+		})
+
+	r := newRequest("GET", "/")
+	r.Header.Set(acceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+
+	for name, want := range map[string]string{
+		"X-Content-Type-Options":    "nosniff",
+		"Referrer-Policy":           "strict-origin-when-cross-origin",
+		"X-Frame-Options":           "",
+		"Strict-Transport-Security": "",
+		"Content-Encoding":          "gzip",
+	} {
+		if got := rec.Header().Get(name); got != want {
+			t.Errorf("wrong %s header: got %q want %q", name, got, want)
+		}
+	}
+	if rec.Header().Get(RequestIDHeader) == "" {
+		t.Error("no request ID")
+	}
+	if !strings.Contains(logs.String(), `"GET / HTTP/1.1" 200`) {
+		t.Errorf("request not logged: %q", logs.String())
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "https://example.com/panic"))
+	if rec.Code != http.StatusInternalServerError {
+		t.Errorf("panic: wrong status: got %d want %d", rec.Code, http.StatusInternalServerError)
+	}
+	if rec.Header().Get("Strict-Transport-Security") == "" {
+		t.Error("no Strict-Transport-Security header over HTTPS")
+	}
+}
+
+func TestRecommendedTimeout(t *testing.T) {
+	h := Recommended(RecommendedLogging(nil), RecommendedTimeout(10*time.Millisecond)).
+		ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			<-r.Context().Done()
+		})
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusServiceUnavailable {
+		t.Fatalf("wrong status: got %d want %d", rec.Code, http.StatusServiceUnavailable)
+	}
+}
+
+func TestRecommendedRPC(t *testing.T) {
+	h := Recommended(RecommendedLogging(nil), RecommendedTimeout(time.Second)).Append(ETag()).ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("no deadline for RPC call")
+		}
+		w.Header().Set("Content-Type", "application/grpc-web+proto")
+		w.Header().Set("Trailer", "Grpc-Status")
+		w.Write(bytes.Repeat([]byte{0}, 2048))
+		w.(http.Flusher).Flush()
+		w.Header().Set("Grpc-Status", "0")
+	})
+
+	r := httptest.NewRequest("POST", "/pkg.Service/Method", strings.NewReader("\x00\x00\x00\x00\x00"))
+	r.Header.Set("Content-Type", "application/grpc-web+proto")
+	r.Header.Set(acceptEncoding, "gzip")
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, r)
+	res := rec.Result()
+	if res.Header.Get("Content-Encoding") != "" || rec.Body.Len() != 2048 {
+		t.Errorf("RPC response rewritten: %v, %d bytes", res.Header, rec.Body.Len())
+	}
+	if !rec.Flushed {
+		t.Error("RPC response not flushed")
+	}
+	if res.Trailer.Get("Grpc-Status") != "0" {
+		t.Errorf("trailer lost: %v", res.Trailer)
+	}
+}
+
+func TestNewRecommended(t *testing.T) {
+	tests := []struct {
+		opts []RecommendedOption
+		ok   bool
+	}{
+		{nil, true},
+		{[]RecommendedOption{RecommendedTimeout(0), RecommendedCompression(gzip.NoCompression)}, true},
+		{[]RecommendedOption{RecommendedTimeout(-time.Second)}, false},
+		{[]RecommendedOption{RecommendedCompression(42)}, false},
+	}
+	for i, test := range tests {
+		if _, err := NewRecommended(test.opts...); (err == nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+	stack, _ := NewRecommended(RecommendedTrustProxy(), RecommendedLogging(nil))
+	if len(stack) != 6 {
+		t.Errorf("wrong number of layers: got %d want 6", len(stack))
+	}
+}
+
+func TestRecommendedTimeoutAbortsStartedResponse(t *testing.T) {
+	h := Recommended(RecommendedLogging(nil), RecommendedCompression(gzip.NoCompression), RecommendedTimeout(20*time.Millisecond)).
+		ThenFunc(func(w http.ResponseWriter, r *http.Request) {
+			io.WriteString(w, "partial")
+			w.(http.Flusher).Flush()
+			<-r.Context().Done()
+		})
+	ts := httptest.NewUnstartedServer(h)
+	ts.Config.ErrorLog = log.New(io.Discard, "", 0)
+	ts.Start()
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := io.ReadAll(res.Body)
+	if err == nil {
+		t.Fatalf("truncated response read without error: %d %q", res.StatusCode, b)
+	}
+}
@@ -12,9 +12,11 @@ type RecoveryHandlerLogger interface {
 }
 
 type recoveryHandler struct {
-	handler    http.Handler
-	logger     RecoveryHandlerLogger
-	printStack bool
+	handler      http.Handler
+	logger       RecoveryHandlerLogger
+	printStack   bool
+	printRequest bool
+	respond      func(http.ResponseWriter, *http.Request, interface{})
 }
 
 // RecoveryOption provides a functional approach to define
@@ -34,6 +36,10 @@ func parseRecoveryOptions(h http.Handler, opts ...RecoveryOption) http.Handler {
 // logs the panic, writes http.StatusInternalServerError, and
 // continues to the next handler.
 //
+// Panics with http.ErrAbortHandler, which handlers and middlewares such as
+// Timeout use to abort the response, are passed on to the server, so that it
+// closes the connection.
+//
 // Example:
 //
 //  r := mux.NewRouter()
@@ -67,11 +73,62 @@ func PrintRecoveryStack(print bool) RecoveryOption {
 	}
 }
 
+// PrintRecoveryRequest is a functional option to enable or disable logging
+// the method and URL of the request which panicked.
+func PrintRecoveryRequest(print bool) RecoveryOption {
+	return func(h http.Handler) {
+		r := h.(*recoveryHandler)
+		r.printRequest = print
+	}
+}
+
+// RecoveryHandlerFunc is a functional option to override the response to
+// requests which panicked, e.g. to render a JSON error or to report the panic
+// to an error tracker, called with the value passed to panic once it is
+// logged. As it is called while recovering, debug.Stack returns the stack of
+// the panic. The default response is 500 Internal Server Error.
+//
+// Example:
+//
+//	handlers.RecoveryHandler(handlers.RecoveryHandlerFunc(func(w http.ResponseWriter, r *http.Request, err interface{}) {
+//		sentry.CurrentHub().Recover(err)
+//		w.Header().Set("Content-Type", "application/json")
+//		w.WriteHeader(http.StatusInternalServerError)
+//		io.WriteString(w, `{"error":"internal error"}`)
+//	}))
+func RecoveryHandlerFunc(fn func(w http.ResponseWriter, r *http.Request, err interface{})) RecoveryOption {
+	return func(h http.Handler) {
+		r := h.(*recoveryHandler)
+		r.respond = fn
+	}
+}
+
+var recoveryInFlight = newInFlightCounter("recovery")
+
 func (h recoveryHandler) ServeHTTP(w http.ResponseWriter, req *http.Request) {
+	defer recoveryInFlight.track()()
+	w, req, end := beginRequestEvent("recovery", w, req)
+	defer end()
+
 	defer func() {
 		if err := recover(); err != nil {
-			w.WriteHeader(http.StatusInternalServerError)
-			h.log(err)
+			if err == http.ErrAbortHandler {
+				panic(err)
+			}
+			var v []interface{}
+			if id := requestIDFor(w, req); id != "" {
+				v = append(v, "request_id="+id)
+			}
+			if h.printRequest {
+				v = append(v, req.Method, req.URL.RequestURI())
+			}
+			h.log(append(v, err)...)
+
+			if h.respond != nil {
+				h.respond(w, req, err)
+			} else if !writeProblem(w, req, http.StatusInternalServerError, "") {
+				w.WriteHeader(http.StatusInternalServerError)
+			}
 		}
 	}()
 
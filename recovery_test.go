@@ -56,3 +56,50 @@ func TestRecoveryLoggerWithCustomLogger(t *testing.T) {
 		}
 	})
 }
+
+func TestRecoveryHandlerFunc(t *testing.T) {
+	var buf bytes.Buffer
+	var recovered interface{}
+	handler := RecoveryHandler(
+		RecoveryLogger(log.New(&buf, "", 0)),
+		PrintRecoveryRequest(true),
+		RecoveryHandlerFunc(func(w http.ResponseWriter, r *http.Request, err interface{}) {
+			recovered = err
+			w.Header().Set("Content-Type", "application/json")
+			w.WriteHeader(http.StatusServiceUnavailable)
+			w.Write([]byte(`{"error":"unavailable"}`))
+		}),
+	)(http.HandlerFunc(func(w http.ResponseWriter, req *http.Request) {
+		panic("Unexpected error!")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("POST", "/orders?id=7"))
+
+	if recovered != "Unexpected error!" {
+		t.Errorf("got recovered value %v", recovered)
+	}
+	if rec.Code != http.StatusServiceUnavailable || rec.Body.String() != `{"error":"unavailable"}` {
+		t.Errorf("got response %d %q", rec.Code, rec.Body.String())
+	}
+	if got, want := buf.String(), "POST /orders?id=7 Unexpected error!\n"; got != want {
+		t.Errorf("got log %q, want %q", got, want)
+	}
+}
+
+func TestRecoveryHandlerAbort(t *testing.T) {
+	var buf bytes.Buffer
+	handler := RecoveryHandler(RecoveryLogger(log.New(&buf, "", 0)))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic(http.ErrAbortHandler)
+	}))
+
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Fatalf("bad panic: got %v want %v", p, http.ErrAbortHandler)
+		}
+		if buf.Len() != 0 {
+			t.Fatalf("abort logged: %q", buf.String())
+		}
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+}
@@ -0,0 +1,250 @@
+package handlers
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"os"
+	"os/signal"
+	"sync/atomic"
+	"syscall"
+	"time"
+)
+
+// Reloadable holds a middleware which can be replaced while the server is
+// running, e.g. to change CORS origins, allowed IP ranges or redirects
+// without a restart. Each request is served by the middleware current when it
+// arrives; requests in flight finish with the one they started with.
+//
+// Replacing the middleware rebuilds the handlers it wraps on their next
+// request, so middlewares keeping state, such as caches, start afresh.
+type Reloadable struct {
+	current atomic.Pointer[reloadableState]
+}
+
+type reloadableState struct {
+	mw         Middleware
+	generation uint64
+}
+
+// NewReloadable returns a Reloadable holding mw. A nil mw leaves handlers
+// unwrapped.
+func NewReloadable(mw Middleware) *Reloadable {
+	rl := &Reloadable{}
+	rl.current.Store(&reloadableState{mw: mw})
+	return rl
+}
+
+// Store atomically replaces the middleware held by rl.
+func (rl *Reloadable) Store(mw Middleware) {
+	for {
+		old := rl.current.Load()
+		if rl.current.CompareAndSwap(old, &reloadableState{mw: mw, generation: old.generation + 1}) {
+			return
+		}
+	}
+}
+
+// Generation returns the number of times the middleware was replaced.
+func (rl *Reloadable) Generation() uint64 {
+	return rl.current.Load().generation
+}
+
+// Handler wraps h with the current middleware of rl. It is itself a
+// Middleware, so it can be used in a Stack.
+func (rl *Reloadable) Handler(h http.Handler) http.Handler {
+	return &reloadableHandler{rl: rl, h: h}
+}
+
+type reloadableHandler struct {
+	rl    *Reloadable
+	h     http.Handler
+	built atomic.Pointer[reloadableBuilt]
+}
+
+// reloadableBuilt is h wrapped with the middleware of state.
+type reloadableBuilt struct {
+	state *reloadableState
+	h     http.Handler
+}
+
+func (rh *reloadableHandler) current() http.Handler {
+	state := rh.rl.current.Load()
+	if b := rh.built.Load(); b != nil && b.state == state {
+		return b.h
+	}
+	h := rh.h
+	if state.mw != nil {
+		h = state.mw(h)
+	}
+	rh.built.Store(&reloadableBuilt{state: state, h: h})
+	return h
+}
+
+func (rh *reloadableHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	rh.current().ServeHTTP(w, r)
+}
+
+func (rh *reloadableHandler) middlewareInfo() MiddlewareInfo {
+	return MiddlewareInfo{Name: "reloadable", Summary: fmt.Sprintf("generation=%d", rh.rl.Generation())}
+}
+
+func (rh *reloadableHandler) next() http.Handler {
+	return rh.current()
+}
+
+// WatchOption represents a functional option for configuring
+// WatchChainConfig.
+type WatchOption func(*chainWatcher) error
+
+type chainWatcher struct {
+	path     string
+	rl       *Reloadable
+	interval time.Duration
+	signals  []os.Signal
+	onReload func(generation uint64)
+	onError  func(error)
+	modTime  time.Time
+}
+
+// WatchInterval sets how often the configuration file is checked for changes.
+// It defaults to 5 seconds; zero disables polling, leaving only signals.
+func WatchInterval(d time.Duration) WatchOption {
+	return func(cw *chainWatcher) error {
+		cw.interval = d
+		if d < 0 {
+			return fmt.Errorf("handlers: invalid watch interval %v", d)
+		}
+		return nil
+	}
+}
+
+// WatchSignals sets the signals triggering a reload. It defaults to SIGHUP;
+// no signal disables them, leaving only polling.
+func WatchSignals(sig ...os.Signal) WatchOption {
+	return func(cw *chainWatcher) error {
+		cw.signals = sig
+		return nil
+	}
+}
+
+// WatchOnReload sets a function called after each successful reload.
+func WatchOnReload(fn func(generation uint64)) WatchOption {
+	return func(cw *chainWatcher) error {
+		cw.onReload = fn
+		return nil
+	}
+}
+
+// WatchErrorHandler sets the function called when a reload fails, in which
+// case the previous configuration stays in effect. By default the error is
+// logged with the standard logger.
+func WatchErrorHandler(fn func(error)) WatchOption {
+	return func(cw *chainWatcher) error {
+		cw.onError = fn
+		return nil
+	}
+}
+
+// WatchChainConfig loads the ChainConfig in the JSON file at path, as
+// LoadChain does, and returns a Reloadable holding its middlewares. Until ctx
+// is canceled, the file is loaded again when it changes or when the process
+// receives SIGHUP. A configuration which fails to load leaves the previous one
+// in effect.
+//
+// Example:
+//
+//	ctx, cancel := context.WithCancel(context.Background())
+//	defer cancel()
+//	edge, err := handlers.WatchChainConfig(ctx, "/etc/app/edge.json")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	http.ListenAndServe(":1123", edge.Handler(r))
+func WatchChainConfig(ctx context.Context, path string, opts ...WatchOption) (*Reloadable, error) {
+	cw := &chainWatcher{
+		path:     path,
+		interval: 5 * time.Second,
+		signals:  []os.Signal{syscall.SIGHUP},
+		onError: func(err error) {
+			log.Printf("handlers: reloading %s: %v", path, err)
+		},
+	}
+	for _, option := range opts {
+		if err := option(cw); err != nil {
+			return nil, err
+		}
+	}
+
+	stack, modTime, err := loadChainFile(path)
+	if err != nil {
+		return nil, err
+	}
+	cw.rl = NewReloadable(Chain(stack...))
+	cw.modTime = modTime
+	go cw.watch(ctx)
+	return cw.rl, nil
+}
+
+func (cw *chainWatcher) watch(ctx context.Context) {
+	var sigc chan os.Signal
+	if len(cw.signals) > 0 {
+		sigc = make(chan os.Signal, 1)
+		signal.Notify(sigc, cw.signals...)
+		defer signal.Stop(sigc)
+	}
+	var tick <-chan time.Time
+	if cw.interval > 0 {
+		ticker := time.NewTicker(cw.interval)
+		defer ticker.Stop()
+		tick = ticker.C
+	}
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-sigc:
+			cw.reload()
+		case <-tick:
+			if fi, err := os.Stat(cw.path); err != nil {
+				cw.onError(err)
+			} else if !fi.ModTime().Equal(cw.modTime) {
+				cw.reload()
+			}
+		}
+	}
+}
+
+func (cw *chainWatcher) reload() {
+	stack, modTime, err := loadChainFile(cw.path)
+	if !modTime.IsZero() {
+		// Don't retry a broken file until it changes again.
+		cw.modTime = modTime
+	}
+	if err != nil {
+		cw.onError(err)
+		return
+	}
+	cw.rl.Store(Chain(stack...))
+	if cw.onReload != nil {
+		cw.onReload(cw.rl.Generation())
+	}
+}
+
+// loadChainFile loads the ChainConfig at path, returning the modification
+// time of the file.
+func loadChainFile(path string) (Stack, time.Time, error) {
+	f, err := os.Open(path)
+	if err != nil {
+		return nil, time.Time{}, err
+	}
+	defer f.Close()
+	var modTime time.Time
+	if fi, err := f.Stat(); err == nil {
+		modTime = fi.ModTime()
+	}
+	stack, err := LoadChain(f)
+	return stack, modTime, err
+}
@@ -0,0 +1,121 @@
+package handlers
+
+import (
+	"context"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func headerMiddleware(value string) Middleware {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("X-Test", value)
+			h.ServeHTTP(w, r)
+		})
+	}
+}
+
+func TestReloadable(t *testing.T) {
+	rl := NewReloadable(headerMiddleware("a"))
+	h := rl.Handler(http.NotFoundHandler())
+
+	serve := func() string {
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, newRequest("GET", "/"))
+		return rec.Header().Get("X-Test")
+	}
+	if got := serve(); got != "a" {
+		t.Fatalf("got %q want %q", got, "a")
+	}
+	rl.Store(headerMiddleware("b"))
+	if got := serve(); got != "b" {
+		t.Fatalf("after Store: got %q want %q", got, "b")
+	}
+	rl.Store(nil)
+	if got := serve(); got != "" {
+		t.Fatalf("after Store(nil): got %q want none", got)
+	}
+	if rl.Generation() != 2 {
+		t.Fatalf("wrong generation: %d", rl.Generation())
+	}
+	if infos := Inspect(h); len(infos) != 1 || infos[0].String() != "reloadable(generation=2)" {
+		t.Fatalf("wrong chain: %v", infos)
+	}
+}
+
+func TestWatchChainConfig(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "chain.json")
+	write := func(cfg string, mtime time.Time) {
+		if err := os.WriteFile(path, []byte(cfg), 0o644); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.Chtimes(path, mtime, mtime); err != nil {
+			t.Fatal(err)
+		}
+	}
+	start := time.Now().Add(-time.Hour)
+	write(`{"middlewares": [{"name": "ip_filter", "options": {"allowed_ips": ["10.0.0.0/8"]}}]}`, start)
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	reloaded := make(chan uint64, 1)
+	errs := make(chan error, 1)
+	rl, err := WatchChainConfig(ctx, path,
+		WatchInterval(5*time.Millisecond),
+		WatchSignals(),
+		WatchOnReload(func(gen uint64) { reloaded <- gen }),
+		WatchErrorHandler(func(err error) { errs <- err }),
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	h := rl.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {}))
+	status := func() int {
+		r := newRequest("GET", "/")
+		r.RemoteAddr = "192.0.2.1:1234"
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		return rec.Code
+	}
+	if code := status(); code != http.StatusForbidden {
+		t.Fatalf("wrong status: got %d want %d", code, http.StatusForbidden)
+	}
+
+	write(`{"middlewares": [{"name": "ip_filter", "options": {"allowed_ips": ["192.0.2.0/24"]}}]}`, start.Add(time.Minute))
+	select {
+	case <-reloaded:
+	case <-time.After(5 * time.Second):
+		t.Fatal("configuration not reloaded")
+	}
+	if code := status(); code != http.StatusOK {
+		t.Fatalf("after reload: wrong status: got %d want %d", code, http.StatusOK)
+	}
+
+	write(`{"middlewares": [{"name": "nope"}]}`, start.Add(2*time.Minute))
+	select {
+	case err := <-errs:
+		if !strings.Contains(err.Error(), "unknown middleware") {
+			t.Fatalf("wrong error: %v", err)
+		}
+	case <-time.After(5 * time.Second):
+		t.Fatal("reload error not reported")
+	}
+	if code := status(); code != http.StatusOK || rl.Generation() != 1 {
+		t.Fatalf("broken configuration applied: status %d, generation %d", code, rl.Generation())
+	}
+}
+
+func TestWatchChainConfigErrors(t *testing.T) {
+	ctx := context.Background()
+	if _, err := WatchChainConfig(ctx, filepath.Join(t.TempDir(), "missing.json")); err == nil {
+		t.Error("no error for a missing file")
+	}
+	if _, err := WatchChainConfig(ctx, "x", WatchInterval(-time.Second)); err == nil {
+		t.Error("no error for a negative interval")
+	}
+}
@@ -0,0 +1,260 @@
+package handlers
+
+import (
+	"bytes"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"io"
+	"net/http"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// renderStreamThreshold is the length from which slices are streamed as JSON
+// one element at a time, instead of being encoded in memory first.
+const renderStreamThreshold = 1000
+
+// ErrorEnvelope is the body of the error responses written by RenderError.
+type ErrorEnvelope struct {
+	Error ErrorResponse `json:"error"`
+}
+
+// ErrorResponse describes an error in an ErrorEnvelope.
+type ErrorResponse struct {
+	Status    int    `json:"status" xml:"status"`
+	Message   string `json:"message" xml:"message"`
+	RequestID string `json:"request_id,omitempty" xml:"request_id,omitempty"`
+}
+
+// MarshalXML encodes the envelope as <error><status>...</status>...</error>.
+func (e ErrorEnvelope) MarshalXML(enc *xml.Encoder, start xml.StartElement) error {
+	start.Name.Local = "error"
+	return enc.EncodeElement(e.Error, start)
+}
+
+// JSON writes v encoded as JSON with the given status code. Slices and arrays
+// of more than 1000 elements are streamed, so that large result sets aren't
+// encoded in memory first. The body is omitted for HEAD requests.
+//
+// Example:
+//
+//	func listUsers(w http.ResponseWriter, r *http.Request) {
+//		users, err := db.Users(r.Context())
+//		if err != nil {
+//			handlers.RenderError(w, r, http.StatusInternalServerError, err)
+//			return
+//		}
+//		handlers.JSON(w, r, http.StatusOK, users)
+//	}
+func JSON(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	if rv := reflect.ValueOf(v); (rv.Kind() == reflect.Slice || rv.Kind() == reflect.Array) && rv.Len() > renderStreamThreshold {
+		writeHeaders(w, "application/json; charset=utf-8", code)
+		if r.Method != "HEAD" {
+			streamJSON(w, rv)
+		}
+		return
+	}
+
+	b, err := json.Marshal(v)
+	if err != nil {
+		renderEncodingError(w)
+		return
+	}
+	writeBody(w, r, "application/json; charset=utf-8", code, append(b, '\n'))
+}
+
+// XML writes v encoded as XML with the given status code. The body is
+// omitted for HEAD requests.
+func XML(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	b, err := xml.Marshal(v)
+	if err != nil {
+		renderEncodingError(w)
+		return
+	}
+	writeBody(w, r, "application/xml; charset=utf-8", code, append([]byte(xml.Header), b...))
+}
+
+// Text writes s as plain text with the given status code. The body is
+// omitted for HEAD requests.
+func Text(w http.ResponseWriter, r *http.Request, code int, s string) {
+	writeBody(w, r, "text/plain; charset=utf-8", code, []byte(s))
+}
+
+// Render writes v in the format preferred by the client according to the
+// request's Accept header: JSON (the default), XML, or plain text for values
+// implementing fmt.Stringer or error and for strings.
+func Render(w http.ResponseWriter, r *http.Request, code int, v interface{}) {
+	w.Header().Add("Vary", "Accept")
+	offers := []string{"application/json", "application/xml", "text/xml"}
+	s, isText := textValue(v)
+	if isText {
+		offers = append(offers, "text/plain")
+	}
+	switch NegotiateContentType(r, offers, "application/json") {
+	case "application/xml", "text/xml":
+		XML(w, r, code, v)
+	case "text/plain":
+		Text(w, r, code, s)
+	default:
+		JSON(w, r, code, v)
+	}
+}
+
+// RenderError writes an ErrorEnvelope for err with the given status code, in
+// the format negotiated as with Render. The message of server errors (5xx)
+// is replaced by the status text, so that internal details don't leak to
+// clients. The request ID is included if the request has one.
+//
+// Under ProblemDetails, the error is written as a problem instead.
+func RenderError(w http.ResponseWriter, r *http.Request, code int, err error) {
+	msg, detail := http.StatusText(code), ""
+	if err != nil && code < 500 {
+		msg, detail = err.Error(), err.Error()
+	}
+	if writeProblem(w, r, code, detail) {
+		return
+	}
+	envelope := ErrorEnvelope{Error: ErrorResponse{
+		Status:    code,
+		Message:   msg,
+		RequestID: requestIDFor(w, r),
+	}}
+
+	w.Header().Add("Vary", "Accept")
+	switch NegotiateContentType(r, []string{"application/json", "application/xml", "text/xml", "text/plain"}, "application/json") {
+	case "application/xml", "text/xml":
+		XML(w, r, code, envelope)
+	case "text/plain":
+		Text(w, r, code, msg+"\n")
+	default:
+		JSON(w, r, code, envelope)
+	}
+}
+
+// NegotiateContentType returns the media type among offers preferred by the
+// client according to the request's Accept header, or def if none is
+// acceptable. Offers are listed by order of preference of the server, which
+// breaks ties; wildcards such as text/* are honored.
+func NegotiateContentType(r *http.Request, offers []string, def string) string {
+	accept := r.Header.Get("Accept")
+	if accept == "" {
+		if len(offers) > 0 {
+			return offers[0]
+		}
+		return def
+	}
+
+	type acceptRange struct {
+		mediaType string
+		q         float64
+	}
+	var ranges []acceptRange
+	for _, part := range strings.Split(accept, ",") {
+		params := strings.Split(part, ";")
+		mt := strings.ToLower(strings.TrimSpace(params[0]))
+		if mt == "" {
+			continue
+		}
+		q := 1.0
+		for _, param := range params[1:] {
+			param = strings.TrimSpace(param)
+			if strings.HasPrefix(param, "q=") {
+				if f, err := strconv.ParseFloat(param[2:], 64); err == nil {
+					q = f
+				}
+			}
+		}
+		ranges = append(ranges, acceptRange{mt, q})
+	}
+	// More specific ranges take precedence over wildcards.
+	sort.SliceStable(ranges, func(i, j int) bool {
+		return strings.Count(ranges[i].mediaType, "*") < strings.Count(ranges[j].mediaType, "*")
+	})
+
+	best, bestQ := def, 0.0
+	for _, offer := range offers {
+		for _, ar := range ranges {
+			if matchMediaRange(ar.mediaType, offer) {
+				if ar.q > bestQ {
+					best, bestQ = offer, ar.q
+				}
+				break
+			}
+		}
+	}
+	return best
+}
+
+// matchMediaRange reports whether the media type mt matches the range of an
+// Accept header.
+func matchMediaRange(mediaRange, mt string) bool {
+	if mediaRange == "*/*" || mediaRange == mt {
+		return true
+	}
+	return strings.HasSuffix(mediaRange, "/*") && strings.HasPrefix(mt, mediaRange[:len(mediaRange)-1])
+}
+
+// textValue returns the text representation of v, if it has one.
+func textValue(v interface{}) (string, bool) {
+	switch v := v.(type) {
+	case string:
+		return v, true
+	case error:
+		return v.Error(), true
+	case fmt.Stringer:
+		return v.String(), true
+	}
+	return "", false
+}
+
+func writeHeaders(w http.ResponseWriter, contentType string, code int) {
+	h := w.Header()
+	h.Set("Content-Type", contentType)
+	h.Set("X-Content-Type-Options", "nosniff")
+	w.WriteHeader(code)
+}
+
+func writeBody(w http.ResponseWriter, r *http.Request, contentType string, code int, body []byte) {
+	w.Header().Set("Content-Length", strconv.Itoa(len(body)))
+	writeHeaders(w, contentType, code)
+	if r.Method != "HEAD" {
+		w.Write(body)
+	}
+}
+
+// streamJSON writes the JSON array of the elements of rv, encoding them one
+// at a time.
+func streamJSON(w io.Writer, rv reflect.Value) {
+	var buf bytes.Buffer
+	enc := json.NewEncoder(&buf)
+	buf.WriteByte('[')
+	for i := 0; i < rv.Len(); i++ {
+		if i > 0 {
+			buf.WriteByte(',')
+		}
+		if err := enc.Encode(rv.Index(i).Interface()); err != nil {
+			// The status is already sent: leave the body truncated, which
+			// makes it invalid JSON for the client.
+			w.Write(buf.Bytes())
+			return
+		}
+		// Encode appends a newline, which is dropped to keep the array on
+		// one line.
+		buf.Truncate(buf.Len() - 1)
+		if buf.Len() >= 32<<10 {
+			w.Write(buf.Bytes())
+			buf.Reset()
+		}
+	}
+	buf.WriteString("]\n")
+	w.Write(buf.Bytes())
+}
+
+// renderEncodingError replies to requests whose response couldn't be
+// encoded.
+func renderEncodingError(w http.ResponseWriter) {
+	http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+}
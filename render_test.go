@@ -0,0 +1,117 @@
+package handlers
+
+import (
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func TestNegotiateContentType(t *testing.T) {
+	offers := []string{"application/json", "application/xml", "text/plain"}
+	tests := []struct {
+		accept string
+		want   string
+	}{
+		{"", "application/json"},
+		{"*/*", "application/json"},
+		{"application/xml", "application/xml"},
+		{"text/*", "text/plain"},
+		{"application/xml;q=0.5, text/plain", "text/plain"},
+		{"application/json;q=0, */*;q=0.1", "application/xml"},
+		{"image/png", "default"},
+		{"TEXT/PLAIN", "text/plain"},
+	}
+	for _, test := range tests {
+		r := newRequest("GET", "/")
+		r.Header.Set("Accept", test.accept)
+		if got := NegotiateContentType(r, offers, "default"); got != test.want {
+			t.Errorf("%q: got %q want %q", test.accept, got, test.want)
+		}
+	}
+}
+
+func TestRender(t *testing.T) {
+	type item struct {
+		Name string `json:"name" xml:"name"`
+	}
+	tests := []struct {
+		accept      string
+		v           interface{}
+		contentType string
+		body        string
+	}{
+		{"", item{"a"}, "application/json; charset=utf-8", `{"name":"a"}` + "\n"},
+		{"application/xml", item{"a"}, "application/xml; charset=utf-8", `<?xml version="1.0" encoding="UTF-8"?>` + "\n<item><name>a</name></item>"},
+		{"text/plain", "hello", "text/plain; charset=utf-8", "hello"},
+		{"text/plain", item{"a"}, "application/json; charset=utf-8", `{"name":"a"}` + "\n"},
+	}
+	for _, test := range tests {
+		r := newRequest("GET", "/")
+		r.Header.Set("Accept", test.accept)
+		rec := httptest.NewRecorder()
+		Render(rec, r, http.StatusCreated, test.v)
+		if rec.Code != http.StatusCreated {
+			t.Errorf("%q: wrong status %d", test.accept, rec.Code)
+		}
+		if ct := rec.Header().Get("Content-Type"); ct != test.contentType {
+			t.Errorf("%q: wrong content type, got %q want %q", test.accept, ct, test.contentType)
+		}
+		if rec.Body.String() != test.body {
+			t.Errorf("%q: wrong body, got %q want %q", test.accept, rec.Body.String(), test.body)
+		}
+		if rec.Header().Get("Vary") != "Accept" || rec.Header().Get("X-Content-Type-Options") != "nosniff" {
+			t.Errorf("%q: wrong headers %v", test.accept, rec.Header())
+		}
+	}
+}
+
+func TestJSONHead(t *testing.T) {
+	rec := httptest.NewRecorder()
+	JSON(rec, newRequest("HEAD", "/"), http.StatusOK, map[string]int{"a": 1})
+	if rec.Body.Len() != 0 || rec.Header().Get("Content-Length") != "8" {
+		t.Fatalf("wrong HEAD response: %q %v", rec.Body.String(), rec.Header())
+	}
+}
+
+func TestJSONStream(t *testing.T) {
+	items := make([]int, renderStreamThreshold*50)
+	for i := range items {
+		items[i] = i
+	}
+	rec := httptest.NewRecorder()
+	JSON(rec, newRequest("GET", "/"), http.StatusOK, items)
+
+	if rec.Header().Get("Content-Length") != "" {
+		t.Errorf("streamed response has a Content-Length")
+	}
+	var got []int
+	if err := json.Unmarshal(rec.Body.Bytes(), &got); err != nil {
+		t.Fatal(err)
+	}
+	if len(got) != len(items) || got[len(got)-1] != len(items)-1 {
+		t.Fatalf("wrong decoded slice: %d items", len(got))
+	}
+}
+
+func TestRenderError(t *testing.T) {
+	r := newRequest("GET", "/")
+	r.Header.Set(RequestIDHeader, "id-1")
+	rec := httptest.NewRecorder()
+	RequestIDHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		RenderError(w, r, http.StatusNotFound, errors.New("no such user"))
+	})).ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotFound || rec.Body.String() != `{"error":{"status":404,"message":"no such user","request_id":"id-1"}}`+"\n" {
+		t.Fatalf("wrong response: %d %q", rec.Code, rec.Body.String())
+	}
+
+	r = newRequest("GET", "/")
+	r.Header.Set("Accept", "application/xml")
+	rec = httptest.NewRecorder()
+	RenderError(rec, r, http.StatusInternalServerError, errors.New("database password is hunter2"))
+	if strings.Contains(rec.Body.String(), "hunter2") || !strings.Contains(rec.Body.String(), "<error><status>500</status><message>Internal Server Error</message></error>") {
+		t.Fatalf("wrong XML error: %q", rec.Body.String())
+	}
+}
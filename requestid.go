@@ -0,0 +1,214 @@
+package handlers
+
+import (
+	"context"
+	"crypto/rand"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+)
+
+// RequestIDHeader is the HTTP header carrying the request ID.
+const RequestIDHeader = "X-Request-Id"
+
+// maxRequestIDLength is the maximum length of an incoming request ID before
+// it is rejected and replaced by a generated one.
+const maxRequestIDLength = 128
+
+// RequestIDOption represents a functional option for configuring the request
+// ID middleware.
+type RequestIDOption func(*requestID) error
+
+type requestID struct {
+	h         http.Handler
+	header    string
+	generator func() string
+	validator func(string) bool
+}
+
+// RequestIDHandler is HTTP middleware assigning an ID to each request. A valid
+// X-Request-Id header sent by the client (or an upstream proxy) is honored;
+// otherwise a new UUIDv7 is generated. The ID is stored in the request's
+// context, where it can be retrieved with RequestID or RequestIDFromContext,
+// and is set on the response's X-Request-Id header. The header can be renamed
+// with RequestIDHeaderName.
+//
+// LoggingHandler and RecoveryHandler include the request ID in what they log.
+//
+// Example:
+//
+//	r := http.NewServeMux()
+//	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+//		log.Printf("[%s] serving %s", handlers.RequestID(r), r.URL)
+//	})
+//
+//	http.ListenAndServe(":1123", handlers.RequestIDHandler()(r))
+func RequestIDHandler(opts ...RequestIDOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		rh := &requestID{
+			h:         h,
+			header:    RequestIDHeader,
+			generator: NewUUIDv7,
+			validator: isValidRequestID,
+		}
+		for _, option := range opts {
+			option(rh)
+		}
+		return rh
+	}
+}
+
+// NewRequestID is like RequestIDHandler, but returns an error if an option is
+// invalid.
+func NewRequestID(opts ...RequestIDOption) (func(http.Handler) http.Handler, error) {
+	rh := &requestID{}
+	for _, option := range opts {
+		if err := option(rh); err != nil {
+			return nil, err
+		}
+	}
+	return RequestIDHandler(opts...), nil
+}
+
+// RequestIDHeaderName sets the header carrying the request ID, in requests and
+// responses, e.g. X-Correlation-Id. The default is X-Request-Id.
+//
+// RecoveryHandler only finds IDs carried by other headers in the request
+// context, so it must be wrapped by RequestIDHandler rather than wrap it.
+func RequestIDHeaderName(name string) RequestIDOption {
+	return func(rh *requestID) error {
+		if name == "" || strings.ContainsAny(name, " \t\"(),/:;<=>?@[\\]{}") {
+			return fmt.Errorf("handlers: invalid request ID header %q", name)
+		}
+		rh.header = http.CanonicalHeaderKey(name)
+		return nil
+	}
+}
+
+// RequestIDGenerator sets the function generating IDs for requests that
+// don't carry a valid one. The default generates UUIDv7 strings; NewUUIDv4
+// generates random UUIDs, which don't reveal when requests were made.
+func RequestIDGenerator(fn func() string) RequestIDOption {
+	return func(rh *requestID) error {
+		if fn == nil {
+			return errors.New("handlers: nil request ID generator")
+		}
+		rh.generator = fn
+		return nil
+	}
+}
+
+// RequestIDValidator sets the function deciding whether an incoming request
+// ID is honored. The default accepts up to 128 printable ASCII characters
+// without spaces.
+func RequestIDValidator(fn func(string) bool) RequestIDOption {
+	return func(rh *requestID) error {
+		if fn == nil {
+			return errors.New("handlers: nil request ID validator")
+		}
+		rh.validator = fn
+		return nil
+	}
+}
+
+func (rh *requestID) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("request_id", w, r)
+	defer end()
+
+	id := r.Header.Get(rh.header)
+	generated := id == "" || !rh.validator(id)
+	if generated {
+		id = rh.generator()
+	}
+	if lf, ok := Value[*logFields](r); ok {
+		lf.setRequestID(id)
+	}
+
+	w.Header().Set(rh.header, id)
+	ctx := context.WithValue(r.Context(), requestIDKey, id)
+	if generated {
+		// The headers of the request received are left untouched.
+		r = r.Clone(ctx)
+		r.Header.Set(rh.header, id)
+	} else {
+		r = r.WithContext(ctx)
+	}
+	rh.h.ServeHTTP(w, r)
+}
+
+// RequestID returns the ID assigned to the request by RequestIDHandler, or an
+// empty string if there is none.
+func RequestID(r *http.Request) string {
+	return RequestIDFromContext(r.Context())
+}
+
+// requestIDFor returns the request ID of r, falling back to the ID set on the
+// response by a RequestIDHandler further down the chain.
+func requestIDFor(w http.ResponseWriter, r *http.Request) string {
+	if id := RequestID(r); id != "" {
+		return id
+	}
+	return w.Header().Get(RequestIDHeader)
+}
+
+func isValidRequestID(id string) bool {
+	if len(id) > maxRequestIDLength {
+		return false
+	}
+	for i := 0; i < len(id); i++ {
+		if id[i] <= ' ' || id[i] > '~' {
+			return false
+		}
+	}
+	return true
+}
+
+// NewUUIDv4 returns a new random UUID (version 4, RFC 9562) in its canonical
+// string form.
+func NewUUIDv4() string {
+	var u [16]byte
+	if _, err := rand.Read(u[:]); err != nil {
+		panic(err)
+	}
+
+	u[6] = (u[6] & 0x0f) | 0x40 // version 4
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return formatUUID(u)
+}
+
+// NewUUIDv7 returns a new random, time-ordered UUID (version 7, RFC 9562) in
+// its canonical string form.
+func NewUUIDv7() string {
+	var u [16]byte
+	if _, err := rand.Read(u[6:]); err != nil {
+		panic(err)
+	}
+
+	var ts [8]byte
+	binary.BigEndian.PutUint64(ts[:], uint64(time.Now().UnixNano()/int64(time.Millisecond)))
+	copy(u[:6], ts[2:])
+
+	u[6] = (u[6] & 0x0f) | 0x70 // version 7
+	u[8] = (u[8] & 0x3f) | 0x80 // RFC 4122 variant
+
+	return formatUUID(u)
+}
+
+func formatUUID(u [16]byte) string {
+	var buf [36]byte
+	hex.Encode(buf[0:8], u[0:4])
+	buf[8] = '-'
+	hex.Encode(buf[9:13], u[4:6])
+	buf[13] = '-'
+	hex.Encode(buf[14:18], u[6:8])
+	buf[18] = '-'
+	hex.Encode(buf[19:23], u[8:10])
+	buf[23] = '-'
+	hex.Encode(buf[24:], u[10:])
+	return string(buf[:])
+}
@@ -0,0 +1,179 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"regexp"
+	"strings"
+	"testing"
+)
+
+var uuidv7Regex = regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-7[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+
+func TestRequestIDHandler(t *testing.T) {
+	var got, gotHeader string
+	handler := RequestIDHandler()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = RequestID(r)
+		gotHeader = r.Header.Get(RequestIDHeader)
+	}))
+
+	tests := []struct {
+		name     string
+		incoming string
+		keep     bool
+	}{
+		{"generated", "", false},
+		{"honored", "abc-123", true},
+		{"invalid", "abc 123", false},
+		{"too long", strings.Repeat("a", maxRequestIDLength+1), false},
+	}
+
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			r := newRequest("GET", "/")
+			if test.incoming != "" {
+				r.Header.Set(RequestIDHeader, test.incoming)
+			}
+			rec := httptest.NewRecorder()
+			handler.ServeHTTP(rec, r)
+
+			if test.keep && got != test.incoming {
+				t.Fatalf("bad request ID: got %q want %q", got, test.incoming)
+			}
+			if !test.keep && !uuidv7Regex.MatchString(got) {
+				t.Fatalf("bad generated request ID: %q", got)
+			}
+			if h := rec.Header().Get(RequestIDHeader); h != got {
+				t.Fatalf("bad response header: got %q want %q", h, got)
+			}
+			if gotHeader != got {
+				t.Fatalf("bad request header: got %q want %q", gotHeader, got)
+			}
+			if h := r.Header.Get(RequestIDHeader); h != test.incoming {
+				t.Fatalf("incoming request modified: got %q want %q", h, test.incoming)
+			}
+		})
+	}
+}
+
+func TestRequestIDGenerator(t *testing.T) {
+	handler := RequestIDHandler(RequestIDGenerator(func() string { return "fixed" }))(okHandler)
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+
+	if got, want := rec.Header().Get(RequestIDHeader), "fixed"; got != want {
+		t.Fatalf("bad request ID: got %q want %q", got, want)
+	}
+}
+
+func TestRequestIDWithoutHandler(t *testing.T) {
+	if id := RequestID(newRequest("GET", "/")); id != "" {
+		t.Fatalf("expected empty request ID, got %q", id)
+	}
+}
+
+func TestRequestIDLogging(t *testing.T) {
+	var params LogFormatterParams
+	formatter := func(_ io.Writer, p LogFormatterParams) { params = p }
+	generator := RequestIDGenerator(func() string { return "fixed" })
+
+	// The ID is found whether the logging handler wraps the request ID
+	// handler or the other way around.
+	handlers := []http.Handler{
+		RequestIDHandler(generator)(CustomLoggingHandler(io.Discard, okHandler, formatter)),
+		CustomLoggingHandler(io.Discard, RequestIDHandler(generator)(okHandler), formatter),
+	}
+	for i, h := range handlers {
+		params = LogFormatterParams{}
+		h.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+		if params.RequestID != "fixed" {
+			t.Fatalf("%d: bad logged request ID: got %q want %q", i, params.RequestID, "fixed")
+		}
+	}
+}
+
+func TestRequestIDRecovery(t *testing.T) {
+	var buf bytes.Buffer
+	logger := log.New(&buf, "", 0)
+
+	handler := RequestIDHandler(RequestIDGenerator(func() string { return "fixed" }))(
+		RecoveryHandler(RecoveryLogger(logger))(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			panic("Unexpected error!")
+		})),
+	)
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+
+	if got, want := buf.String(), "request_id=fixed Unexpected error!\n"; got != want {
+		t.Fatalf("bad log: got %q want %q", got, want)
+	}
+}
+
+func TestNewUUIDv7(t *testing.T) {
+	a, b := NewUUIDv7(), NewUUIDv7()
+	if !uuidv7Regex.MatchString(a) {
+		t.Fatalf("bad UUIDv7: %q", a)
+	}
+	if a == b {
+		t.Fatalf("expected distinct UUIDs, got %q twice", a)
+	}
+}
+
+func TestNewRequestID(t *testing.T) {
+	if _, err := NewRequestID(RequestIDGenerator(NewUUIDv7)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewRequestID(RequestIDGenerator(nil)); err == nil {
+		t.Fatal("expected an error for a nil generator")
+	}
+	if _, err := NewRequestID(RequestIDValidator(nil)); err == nil {
+		t.Fatal("expected an error for a nil validator")
+	}
+}
+
+func TestRequestIDHeaderName(t *testing.T) {
+	var got string
+	var params LogFormatterParams
+	formatter := func(_ io.Writer, p LogFormatterParams) { params = p }
+	handler := CustomLoggingHandler(io.Discard, RequestIDHandler(RequestIDHeaderName("x-correlation-id"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			got = RequestIDFromContext(r.Context())
+		}),
+	), formatter)
+
+	r := newRequest("GET", "/")
+	r.Header.Set("X-Correlation-Id", "abc-123")
+	r.Header.Set(RequestIDHeader, "ignored")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	if got != "abc-123" {
+		t.Fatalf("bad request ID: got %q want %q", got, "abc-123")
+	}
+	if h := rec.Header().Get("X-Correlation-Id"); h != got {
+		t.Fatalf("bad response header: got %q want %q", h, got)
+	}
+	if h := rec.Header().Get(RequestIDHeader); h != "" {
+		t.Fatalf("unexpected %s header %q", RequestIDHeader, h)
+	}
+	if params.RequestID != got {
+		t.Fatalf("bad logged request ID: got %q want %q", params.RequestID, got)
+	}
+
+	if _, err := NewRequestID(RequestIDHeaderName("X Request")); err == nil {
+		t.Fatal("expected an error for an invalid header name")
+	}
+}
+
+func TestNewUUIDv4(t *testing.T) {
+	uuidv4Regex := regexp.MustCompile(`^[0-9a-f]{8}-[0-9a-f]{4}-4[0-9a-f]{3}-[89ab][0-9a-f]{3}-[0-9a-f]{12}$`)
+	a, b := NewUUIDv4(), NewUUIDv4()
+	if !uuidv4Regex.MatchString(a) {
+		t.Fatalf("bad UUIDv4: %q", a)
+	}
+	if a == b {
+		t.Fatalf("expected distinct UUIDs, got %q twice", a)
+	}
+}
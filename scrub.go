@@ -0,0 +1,189 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"path"
+	"strings"
+)
+
+// defaultScrubbedHeaders are the response headers ScrubHeaders removes by
+// default, which reveal the software, backends or internals of a service.
+var defaultScrubbedHeaders = []string{
+	"Server",
+	"X-Powered-By",
+	"X-AspNet-Version",
+	"X-AspNetMvc-Version",
+	"X-Runtime",
+	"X-Debug-*",
+	"X-Backend-*",
+	"X-Upstream-*",
+	"X-Stack-*",
+}
+
+// scrubKeptHeaders are the response headers kept in allowlist mode whatever
+// the allowlist, as HTTP doesn't work without them.
+var scrubKeptHeaders = []string{
+	"Accept-Ranges",
+	"Age",
+	"Allow",
+	"Cache-Control",
+	"Connection",
+	"Content-*",
+	"Date",
+	"ETag",
+	"Expires",
+	"Last-Modified",
+	"Location",
+	"Retry-After",
+	"Set-Cookie",
+	"Trailer",
+	"Transfer-Encoding",
+	"Upgrade",
+	"Vary",
+	"WWW-Authenticate",
+}
+
+// ScrubOption represents a functional option for configuring ScrubHeaders.
+type ScrubOption func(*scrubber) error
+
+type scrubber struct {
+	h          http.Handler
+	deny       []string
+	allow      []string
+	exceptions []scrubException
+}
+
+type scrubException struct {
+	match   Matcher
+	headers []string
+}
+
+// ScrubDeny removes the response headers matching one of patterns, in
+// addition to the default ones. Patterns are header names, case-insensitive,
+// which may contain path.Match wildcards, e.g. "X-Debug-*".
+func ScrubDeny(patterns ...string) ScrubOption {
+	return func(s *scrubber) error {
+		s.deny = append(s.deny, lowerPatterns(patterns)...)
+		return validHeaderPatterns(patterns)
+	}
+}
+
+// ScrubAllow switches ScrubHeaders to allowlist mode: only the response
+// headers matching one of patterns, or essential to HTTP such as Content-Type,
+// Location or Set-Cookie, are kept. Denied headers are removed even if they
+// are allowed.
+func ScrubAllow(patterns ...string) ScrubOption {
+	return func(s *scrubber) error {
+		if s.allow == nil {
+			s.allow = lowerPatterns(scrubKeptHeaders)
+		}
+		s.allow = append(s.allow, lowerPatterns(patterns)...)
+		return validHeaderPatterns(patterns)
+	}
+}
+
+// ScrubExcept keeps the response headers matching one of patterns on the
+// requests matched by m, e.g. the Server-Timing header of an internal
+// dashboard. A nil m matches all requests.
+func ScrubExcept(m Matcher, patterns ...string) ScrubOption {
+	return func(s *scrubber) error {
+		s.exceptions = append(s.exceptions, scrubException{match: m, headers: lowerPatterns(patterns)})
+		return validHeaderPatterns(patterns)
+	}
+}
+
+// ScrubHeaders is HTTP middleware removing response headers which leak
+// internal details, right before the response headers are sent, and again
+// from the trailers once the handler returned. It should wrap the whole
+// application, so that it sees the headers set by all other handlers.
+//
+// By default it removes Server, X-Powered-By, X-AspNet-Version,
+// X-AspNetMvc-Version, X-Runtime, and the X-Debug-*, X-Backend-*,
+// X-Upstream-* and X-Stack-* headers.
+//
+// Example:
+//
+//	scrub := handlers.ScrubHeaders(
+//		handlers.ScrubDeny("X-Cache-Key", "X-Db-*"),
+//		handlers.ScrubExcept(handlers.MatchPathPrefix("/internal/"), "X-Debug-*"),
+//	)
+//	http.ListenAndServe(":1123", scrub(r))
+func ScrubHeaders(opts ...ScrubOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		s := &scrubber{h: h, deny: lowerPatterns(defaultScrubbedHeaders)}
+		for _, option := range opts {
+			option(s)
+		}
+		return s
+	}
+}
+
+// NewScrubHeaders is like ScrubHeaders, but returns an error if an option is
+// invalid.
+func NewScrubHeaders(opts ...ScrubOption) (func(http.Handler) http.Handler, error) {
+	s := &scrubber{}
+	for _, option := range opts {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	return ScrubHeaders(opts...), nil
+}
+
+func (s *scrubber) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("scrub", w, r)
+	defer end()
+
+	var except []string
+	for _, e := range s.exceptions {
+		if e.match == nil || e.match(r) {
+			except = append(except, e.headers...)
+		}
+	}
+	scrub := func(int) { s.scrub(w.Header(), except) }
+	ww, finish := beforeWriteHeader(w, scrub)
+	s.h.ServeHTTP(ww, r)
+	finish()
+	scrub(0)
+}
+
+// scrub removes the headers of h the policy doesn't let through, unless they
+// match one of the except patterns.
+func (s *scrubber) scrub(h http.Header, except []string) {
+	for name := range h {
+		key := strings.ToLower(strings.TrimPrefix(name, http.TrailerPrefix))
+		if matchHeaderPattern(except, key) {
+			continue
+		}
+		if matchHeaderPattern(s.deny, key) || (s.allow != nil && !matchHeaderPattern(s.allow, key)) {
+			delete(h, name)
+		}
+	}
+}
+
+func matchHeaderPattern(patterns []string, name string) bool {
+	for _, pattern := range patterns {
+		if ok, _ := path.Match(pattern, name); ok {
+			return true
+		}
+	}
+	return false
+}
+
+func lowerPatterns(patterns []string) []string {
+	lower := make([]string, len(patterns))
+	for i, pattern := range patterns {
+		lower[i] = strings.ToLower(pattern)
+	}
+	return lower
+}
+
+func validHeaderPatterns(patterns []string) error {
+	for _, pattern := range patterns {
+		if _, err := path.Match(pattern, ""); err != nil || pattern == "" {
+			return fmt.Errorf("handlers: invalid header pattern %q", pattern)
+		}
+	}
+	return nil
+}
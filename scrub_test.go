@@ -0,0 +1,82 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"reflect"
+	"sort"
+	"testing"
+)
+
+func scrubbedHeaders(t *testing.T, h http.Handler, url string) []string {
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", url))
+	res := rec.Result()
+	var names []string
+	for name := range res.Header {
+		names = append(names, name)
+	}
+	for name := range res.Trailer {
+		names = append(names, "Trailer:"+name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+func TestScrubHeaders(t *testing.T) {
+	app := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		h := w.Header()
+		h.Set("Content-Type", "text/plain")
+		h.Set("Server", "app/1.2")
+		h.Set("X-Powered-By", "Go")
+		h.Set("X-Debug-Sql", "SELECT 1")
+		h.Set("x-backend-host", "10.0.0.12")
+		h.Set("X-Cache-Key", "items")
+		h.Set("X-Request-Id", "42")
+		h.Set("Trailer", "X-Debug-Time, X-Checksum")
+		w.Write([]byte("ok"))
+		h.Set("X-Debug-Time", "3ms")
+		h.Set("X-Checksum", "abc")
+	})
+
+	tests := []struct {
+		opts []ScrubOption
+		url  string
+		want []string
+	}{
+		{nil, "/", []string{"Content-Type", "Trailer", "X-Cache-Key", "X-Request-Id", "Trailer:X-Checksum"}},
+		{[]ScrubOption{ScrubDeny("x-cache-*")}, "/", []string{"Content-Type", "Trailer", "X-Request-Id", "Trailer:X-Checksum"}},
+		{[]ScrubOption{ScrubExcept(MatchPathPrefix("/internal/"), "X-Debug-*")}, "/", []string{"Content-Type", "Trailer", "X-Cache-Key", "X-Request-Id", "Trailer:X-Checksum"}},
+		{[]ScrubOption{ScrubExcept(MatchPathPrefix("/internal/"), "X-Debug-*")}, "/internal/stats", []string{"Content-Type", "Trailer", "X-Cache-Key", "X-Debug-Sql", "X-Request-Id", "Trailer:X-Checksum", "Trailer:X-Debug-Time"}},
+		{[]ScrubOption{ScrubAllow("X-Request-Id", "X-Debug-Sql")}, "/", []string{"Content-Type", "Trailer", "X-Request-Id"}},
+		{[]ScrubOption{ScrubAllow("X-Request-Id"), ScrubExcept(nil, "Server")}, "/", []string{"Content-Type", "Server", "Trailer", "X-Request-Id"}},
+	}
+	for i, test := range tests {
+		got := scrubbedHeaders(t, ScrubHeaders(test.opts...)(app), test.url)
+		sort.Strings(test.want)
+		if !reflect.DeepEqual(got, test.want) {
+			t.Errorf("%d: got %v want %v", i, got, test.want)
+		}
+	}
+}
+
+func TestScrubHeadersNoBody(t *testing.T) {
+	h := ScrubHeaders()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Powered-By", "Go")
+	}))
+	if got := scrubbedHeaders(t, h, "/"); len(got) != 0 {
+		t.Fatalf("headers not scrubbed: %v", got)
+	}
+}
+
+func TestNewScrubHeaders(t *testing.T) {
+	if _, err := NewScrubHeaders(ScrubDeny("X-Internal-*"), ScrubAllow("X-Request-Id")); err != nil {
+		t.Error(err)
+	}
+	if _, err := NewScrubHeaders(ScrubDeny("X-[")); err == nil {
+		t.Error("no error for invalid pattern")
+	}
+	if _, err := NewScrubHeaders(ScrubExcept(nil, "")); err == nil {
+		t.Error("no error for empty pattern")
+	}
+}
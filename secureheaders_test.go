@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"crypto/tls"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSecureHeaders(t *testing.T) {
+	handler := SecureHeaders()(okHandler)
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	for _, name := range []string{"Content-Security-Policy", "X-Content-Type-Options", "X-Frame-Options", "Referrer-Policy", "Permissions-Policy"} {
+		if rec.Header().Get(name) == "" {
+			t.Errorf("no %s header", name)
+		}
+	}
+	if got := rec.Header().Get("Strict-Transport-Security"); got != "" {
+		t.Errorf("Strict-Transport-Security over HTTP: %q", got)
+	}
+
+	r := newRequest("GET", "/")
+	r.TLS = &tls.ConnectionState{}
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if got, want := rec.Header().Get("Strict-Transport-Security"), "max-age=63072000; includeSubDomains"; got != want {
+		t.Errorf("bad Strict-Transport-Security: got %q want %q", got, want)
+	}
+}
+
+func TestSecureHeadersOptions(t *testing.T) {
+	handler := SecureHeaders(
+		SecureHeadersHSTS(365*24*time.Hour, false, true),
+		SecureHeadersFrameOptions("SAMEORIGIN"),
+		SecureHeadersReferrerPolicy("no-referrer"),
+		SecureHeadersPermissionsPolicy(""),
+		SecureHeadersContentTypeOptions(""),
+		SecureHeadersHeader("Cross-Origin-Opener-Policy", "same-origin"),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.Header().Set("X-Frame-Options", "DENY")
+	}))
+
+	r := newRequest("GET", "https://example.com/")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+
+	want := map[string]string{
+		"Strict-Transport-Security":  "max-age=31536000; preload",
+		"X-Frame-Options":            "DENY",
+		"Referrer-Policy":            "no-referrer",
+		"Permissions-Policy":         "",
+		"X-Content-Type-Options":     "",
+		"Cross-Origin-Opener-Policy": "same-origin",
+	}
+	for name, value := range want {
+		if got := rec.Header().Get(name); got != value {
+			t.Errorf("bad %s header: got %q want %q", name, got, value)
+		}
+	}
+}
+
+func TestSecureHeadersCSPNonce(t *testing.T) {
+	var nonces []string
+	handler := SecureHeaders(SecureHeadersCSP("script-src 'nonce-{nonce}'; style-src 'nonce-{nonce}'"))(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			nonces = append(nonces, CSPNonce(r))
+		}),
+	)
+
+	for i := 0; i < 2; i++ {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", "/"))
+		nonce := nonces[i]
+		if len(nonce) != 24 {
+			t.Fatalf("bad nonce: %q", nonce)
+		}
+		want := "script-src 'nonce-" + nonce + "'; style-src 'nonce-" + nonce + "'"
+		if got := rec.Header().Get("Content-Security-Policy"); got != want {
+			t.Fatalf("bad Content-Security-Policy: got %q want %q", got, want)
+		}
+	}
+	if nonces[0] == nonces[1] {
+		t.Fatalf("nonce reused: %q", nonces[0])
+	}
+
+	// No nonce is generated for policies without placeholder.
+	SecureHeaders()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if nonce := CSPNonce(r); nonce != "" {
+			t.Errorf("unexpected nonce %q", nonce)
+		}
+	})).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+}
+
+func TestNewSecureHeaders(t *testing.T) {
+	if _, err := NewSecureHeaders(SecureHeadersHSTS(0, false, false), SecureHeadersCSP("default-src 'self'")); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewSecureHeaders(SecureHeadersHSTS(-time.Second, false, false)); err == nil {
+		t.Fatal("expected an error for a negative max age")
+	}
+	if _, err := NewSecureHeaders(SecureHeadersCSP("default-src 'self'\r\nX-Injected: 1")); err == nil || !strings.Contains(err.Error(), "Content-Security-Policy") {
+		t.Fatalf("expected an error for a header value with a newline, got %v", err)
+	}
+}
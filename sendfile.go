@@ -0,0 +1,230 @@
+package handlers
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strings"
+
+	"github.com/felixge/httpsnoop"
+)
+
+const xSendfile = "X-Sendfile"
+
+// SendfileOption represents a functional option for configuring Sendfile.
+type SendfileOption func(*sendfile) error
+
+type sendfile struct {
+	h           http.Handler
+	root        string
+	header      string
+	accel       string
+	passthrough bool
+}
+
+// SendfileHeader sets the response header through which handlers name the
+// file to send, X-Sendfile by default.
+func SendfileHeader(name string) SendfileOption {
+	return func(s *sendfile) error {
+		s.header = http.CanonicalHeaderKey(name)
+		if name == "" {
+			return errors.New("handlers: empty sendfile header")
+		}
+		return nil
+	}
+}
+
+// SendfileAccelRedirect offloads the files to nginx: responses get an
+// X-Accel-Redirect header with the file path under location, an internal
+// location of nginx serving the root directory, e.g.:
+//
+//	location /protected/ {
+//		internal;
+//		alias /var/app/files/;
+//	}
+func SendfileAccelRedirect(location string) SendfileOption {
+	return func(s *sendfile) error {
+		s.accel = strings.TrimSuffix(location, "/")
+		if !strings.HasPrefix(location, "/") {
+			return fmt.Errorf("handlers: invalid X-Accel-Redirect location %q", location)
+		}
+		return nil
+	}
+}
+
+// SendfilePassthrough offloads the files to a front server supporting the
+// X-Sendfile header, such as Apache with mod_xsendfile or lighttpd: responses
+// get an X-Sendfile header with the absolute path of the file.
+func SendfilePassthrough() SendfileOption {
+	return func(s *sendfile) error {
+		s.passthrough = true
+		return nil
+	}
+}
+
+// Sendfile is HTTP middleware serving files named by handlers in a response
+// header, X-Sendfile by default, so that handlers of protected downloads only
+// check access and leave the transfer to the server.
+//
+// The header holds a slash-separated path relative to root, which can't
+// escape it. By default Sendfile serves the file itself when the handler
+// replies with 200 OK, discarding the handler's body, with support for
+// conditional and range requests: headers set by the handler, such as
+// Content-Type or Content-Disposition, are kept. Missing files are answered
+// with 404 Not Found. Behind nginx, or Apache, SendfileAccelRedirect or
+// SendfilePassthrough hand the file over to the front server instead, without
+// changing the handlers.
+//
+// Example:
+//
+//	func invoice(w http.ResponseWriter, r *http.Request) {
+//		if !allowed(r) {
+//			http.Error(w, "Forbidden", http.StatusForbidden)
+//			return
+//		}
+//		w.Header().Set("Content-Disposition", `attachment; filename="invoice.pdf"`)
+//		w.Header().Set("X-Sendfile", "invoices/"+id+".pdf")
+//	}
+//
+//	http.Handle("/invoices/", handlers.Sendfile("/var/app/files")(http.HandlerFunc(invoice)))
+func Sendfile(root string, opts ...SendfileOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		s := &sendfile{h: h, root: root, header: xSendfile}
+		for _, option := range opts {
+			option(s)
+		}
+		return s
+	}
+}
+
+// NewSendfile is like Sendfile, but returns an error if root is empty or an
+// option is invalid.
+func NewSendfile(root string, opts ...SendfileOption) (func(http.Handler) http.Handler, error) {
+	if root == "" {
+		return nil, errors.New("handlers: empty sendfile root")
+	}
+	s := &sendfile{}
+	for _, option := range opts {
+		if err := option(s); err != nil {
+			return nil, err
+		}
+	}
+	return Sendfile(root, opts...), nil
+}
+
+// sendfilePath returns the cleaned, slash-separated path of the file named in
+// h, with a leading slash, or "" if there is none.
+func (s *sendfile) sendfilePath(h http.Header) string {
+	name := h.Get(s.header)
+	if name == "" {
+		return ""
+	}
+	h.Del(s.header)
+	return path.Clean("/" + name)
+}
+
+func (s *sendfile) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("sendfile", w, r)
+	defer end()
+
+	if s.accel != "" || s.passthrough {
+		ww, finish := beforeWriteHeader(w, func(int) {
+			name := s.sendfilePath(w.Header())
+			switch {
+			case name == "":
+			case s.accel != "":
+				w.Header().Set("X-Accel-Redirect", s.accel+name)
+			default:
+				w.Header().Set(xSendfile, filepath.Join(s.root, filepath.FromSlash(name)))
+			}
+		})
+		s.h.ServeHTTP(ww, r)
+		finish()
+		return
+	}
+
+	// name is set once the handler replied 200 OK with a file to send,
+	// whose body is then discarded.
+	var name string
+	wroteHeader := false
+	begin := func(code int) {
+		if !wroteHeader {
+			wroteHeader = true
+			if code == http.StatusOK {
+				name = s.sendfilePath(w.Header())
+			} else {
+				w.Header().Del(s.header)
+			}
+		}
+	}
+	ww := httpsnoop.Wrap(w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if code >= 200 || code == http.StatusSwitchingProtocols {
+					begin(code)
+				}
+				if name == "" {
+					next(code)
+				}
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				begin(http.StatusOK)
+				if name != "" {
+					return len(b), nil
+				}
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				begin(http.StatusOK)
+				if name != "" {
+					return io.Copy(ioutil.Discard, src)
+				}
+				return next(src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				begin(http.StatusOK)
+				if name == "" {
+					next()
+				}
+			}
+		},
+	})
+	s.h.ServeHTTP(ww, r)
+	begin(http.StatusOK)
+	if name != "" {
+		s.serveFile(w, r, name)
+	}
+}
+
+// serveFile replies with the file at the slash-separated path name under the
+// root directory.
+func (s *sendfile) serveFile(w http.ResponseWriter, r *http.Request, name string) {
+	w.Header().Del("Content-Length")
+	f, err := os.Open(filepath.Join(s.root, filepath.FromSlash(name)))
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil || fi.IsDir() {
+		http.NotFound(w, r)
+		return
+	}
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
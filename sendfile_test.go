@@ -0,0 +1,102 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func newSendfileTest(t *testing.T, opts ...SendfileOption) (string, http.Handler) {
+	root := t.TempDir()
+	if err := os.MkdirAll(filepath.Join(root, "invoices"), 0755); err != nil {
+		t.Fatal(err)
+	}
+	if err := ioutil.WriteFile(filepath.Join(root, "invoices", "42.pdf"), []byte("%PDF-1.7 invoice"), 0644); err != nil {
+		t.Fatal(err)
+	}
+	return root, Sendfile(root, opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("deny") != "" {
+			w.Header().Set("X-Sendfile", "invoices/42.pdf")
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		w.Header().Set("Content-Type", "application/pdf")
+		w.Header().Set("X-Sendfile", r.URL.Query().Get("file"))
+		w.Write([]byte("ignored"))
+	}))
+}
+
+func TestSendfile(t *testing.T) {
+	_, h := newSendfileTest(t)
+
+	tests := []struct {
+		url, rangeHeader string
+		code             int
+		body             string
+	}{
+		{"/?file=invoices/42.pdf", "", http.StatusOK, "%PDF-1.7 invoice"},
+		{"/?file=/invoices/../invoices/42.pdf", "bytes=0-3", http.StatusPartialContent, "%PDF"},
+		{"/?file=../../invoices/42.pdf", "", http.StatusOK, "%PDF-1.7 invoice"},
+		{"/?file=invoices/43.pdf", "", http.StatusNotFound, "404 page not found\n"},
+		{"/?file=invoices", "", http.StatusNotFound, "404 page not found\n"},
+		{"/?file=", "", http.StatusOK, "ignored"},
+		{"/?deny=1", "", http.StatusForbidden, "Forbidden\n"},
+	}
+	for _, test := range tests {
+		r := newRequest("GET", test.url)
+		if test.rangeHeader != "" {
+			r.Header.Set("Range", test.rangeHeader)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != test.code || rec.Body.String() != test.body {
+			t.Errorf("%s: got %d %q want %d %q", test.url, rec.Code, rec.Body.String(), test.code, test.body)
+		}
+		if rec.Header().Get("X-Sendfile") != "" {
+			t.Errorf("%s: X-Sendfile header leaked: %q", test.url, rec.Header().Get("X-Sendfile"))
+		}
+		if test.code == http.StatusOK && test.body != "ignored" && rec.Header().Get("Content-Type") != "application/pdf" {
+			t.Errorf("%s: handler headers not kept: %v", test.url, rec.Header())
+		}
+	}
+}
+
+func TestSendfileOffloading(t *testing.T) {
+	root, h := newSendfileTest(t, SendfileAccelRedirect("/protected/"))
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/?file=invoices/42.pdf"))
+	if got := rec.Header().Get("X-Accel-Redirect"); got != "/protected/invoices/42.pdf" {
+		t.Errorf("wrong X-Accel-Redirect: %q", got)
+	}
+	if rec.Header().Get("X-Sendfile") != "" {
+		t.Errorf("X-Sendfile header leaked: %v", rec.Header())
+	}
+
+	root, h = newSendfileTest(t, SendfilePassthrough())
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/?file=../invoices/42.pdf"))
+	if got, want := rec.Header().Get("X-Sendfile"), filepath.Join(root, "invoices", "42.pdf"); got != want {
+		t.Errorf("wrong X-Sendfile: got %q want %q", got, want)
+	}
+}
+
+func TestNewSendfile(t *testing.T) {
+	tests := []struct {
+		root string
+		opts []SendfileOption
+		ok   bool
+	}{
+		{"/srv", []SendfileOption{SendfileHeader("X-Internal-File"), SendfileAccelRedirect("/protected")}, true},
+		{"", nil, false},
+		{"/srv", []SendfileOption{SendfileHeader("")}, false},
+		{"/srv", []SendfileOption{SendfileAccelRedirect("protected")}, false},
+	}
+	for i, test := range tests {
+		if _, err := NewSendfile(test.root, test.opts...); (err == nil) != test.ok {
+			t.Errorf("%d: got error %v, want ok=%v", i, err, test.ok)
+		}
+	}
+}
@@ -0,0 +1,175 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/felixge/httpsnoop"
+)
+
+const serverTimingHeader = "Server-Timing"
+
+// ServerTiming collects the metrics reported in the Server-Timing header of a
+// response. A collector is attached to each request by ServerTimingHandler and
+// is retrieved with Timing.
+//
+// All methods are safe for concurrent use and are no-ops on a nil
+// *ServerTiming, so handlers may report metrics unconditionally.
+type ServerTiming struct {
+	mu      sync.Mutex
+	metrics []timingMetric
+	// sent is the number of metrics already written in the response header.
+	sent int
+}
+
+type timingMetric struct {
+	name string
+	dur  time.Duration
+	desc string
+}
+
+// Add records a metric with the given name, duration and (optional)
+// description.
+func (st *ServerTiming) Add(name string, d time.Duration, desc string) {
+	if st == nil {
+		return
+	}
+	st.mu.Lock()
+	st.metrics = append(st.metrics, timingMetric{name: name, dur: d, desc: desc})
+	st.mu.Unlock()
+}
+
+// Start begins timing a metric and returns a function that records it when
+// called.
+//
+// Example:
+//
+//	defer handlers.Timing(r).Start("db", "query")()
+func (st *ServerTiming) Start(name, desc string) func() {
+	t := time.Now()
+	return func() {
+		st.Add(name, time.Since(t), desc)
+	}
+}
+
+// flush returns the header value for the metrics that haven't been sent yet
+// and marks them as sent.
+func (st *ServerTiming) flush() string {
+	st.mu.Lock()
+	defer st.mu.Unlock()
+
+	pending := st.metrics[st.sent:]
+	st.sent = len(st.metrics)
+	if len(pending) == 0 {
+		return ""
+	}
+
+	values := make([]string, 0, len(pending))
+	for _, m := range pending {
+		values = append(values, m.String())
+	}
+	return strings.Join(values, ", ")
+}
+
+func (m timingMetric) String() string {
+	buf := []byte(m.name)
+	if m.desc != "" {
+		buf = append(buf, `;desc="`...)
+		buf = append(buf, strings.NewReplacer(`\`, `\\`, `"`, `\"`).Replace(m.desc)...)
+		buf = append(buf, '"')
+	}
+	buf = append(buf, ";dur="...)
+	buf = strconv.AppendFloat(buf, float64(m.dur)/float64(time.Millisecond), 'f', -1, 64)
+	return string(buf)
+}
+
+// Timing returns the Server-Timing collector for the request, or nil if the
+// request was not served through ServerTimingHandler.
+func Timing(r *http.Request) *ServerTiming {
+	return ServerTimingFromContext(r.Context())
+}
+
+// ServerTimingHandler attaches a Server-Timing collector to each request and
+// reports its metrics to the client, where browsers' developer tools display
+// them alongside the request.
+//
+// Metrics added before the response headers are written are sent in the
+// Server-Timing header. Metrics added afterwards, e.g. by handlers streaming
+// their response, are sent as a Server-Timing trailer.
+//
+// Example:
+//
+//	r := http.NewServeMux()
+//	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+//		t := time.Now()
+//		rows := queryDatabase()
+//		handlers.Timing(r).Add("db", time.Since(t), "query")
+//		render(w, rows)
+//	})
+//
+//	http.ListenAndServe(":1123", handlers.ServerTimingHandler(r))
+func ServerTimingHandler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("server_timing", w, r)
+		defer end()
+
+		st := &ServerTiming{}
+		wroteHeader := false
+
+		writeHeader := func() {
+			if wroteHeader {
+				return
+			}
+			wroteHeader = true
+			if v := st.flush(); v != "" {
+				w.Header().Add(serverTimingHeader, v)
+			}
+		}
+
+		sw := httpsnoop.Wrap(w, httpsnoop.Hooks{
+			WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+				return func(code int) {
+					if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+						// Interim responses don't carry the final headers.
+						next(code)
+						return
+					}
+					writeHeader()
+					next(code)
+				}
+			},
+			Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+				return func(b []byte) (int, error) {
+					writeHeader()
+					return next(b)
+				}
+			},
+			Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+				return func() {
+					writeHeader()
+					next()
+				}
+			},
+			ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+				return func(src io.Reader) (int64, error) {
+					writeHeader()
+					return next(src)
+				}
+			},
+		})
+
+		h.ServeHTTP(sw, WithValue(r, st))
+
+		if !wroteHeader {
+			writeHeader()
+			return
+		}
+		if v := st.flush(); v != "" {
+			w.Header().Set(http.TrailerPrefix+serverTimingHeader, v)
+		}
+	})
+}
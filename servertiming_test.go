@@ -0,0 +1,68 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestServerTimingHeader(t *testing.T) {
+	handler := ServerTimingHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Timing(r).Add("db", 12*time.Millisecond, "query")
+		Timing(r).Add("cache", 1500*time.Microsecond, "")
+		io.WriteString(w, ok)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+
+	want := `db;desc="query";dur=12, cache;dur=1.5`
+	if got := rec.Header().Get(serverTimingHeader); got != want {
+		t.Fatalf("bad Server-Timing header: got %q want %q", got, want)
+	}
+}
+
+func TestServerTimingTrailer(t *testing.T) {
+	handler := ServerTimingHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Timing(r).Add("setup", time.Millisecond, "")
+		w.(http.Flusher).Flush()
+		io.WriteString(w, ok)
+		Timing(r).Add("stream", 2*time.Millisecond, `the "body"`)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+
+	res := rec.Result()
+	if got, want := res.Header.Get(serverTimingHeader), "setup;dur=1"; got != want {
+		t.Fatalf("bad Server-Timing header: got %q want %q", got, want)
+	}
+	if got, want := res.Trailer.Get(serverTimingHeader), `stream;desc="the \"body\"";dur=2`; got != want {
+		t.Fatalf("bad Server-Timing trailer: got %q want %q", got, want)
+	}
+}
+
+func TestServerTimingNoWrite(t *testing.T) {
+	handler := ServerTimingHandler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		Timing(r).Add("noop", 0, "")
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+
+	if got, want := rec.Header().Get(serverTimingHeader), "noop;dur=0"; got != want {
+		t.Fatalf("bad Server-Timing header: got %q want %q", got, want)
+	}
+}
+
+func TestTimingWithoutHandler(t *testing.T) {
+	r := newRequest("GET", "/")
+	if st := Timing(r); st != nil {
+		t.Fatalf("expected nil collector, got %v", st)
+	}
+	// Must not panic.
+	Timing(r).Add("db", time.Second, "")
+	Timing(r).Start("db", "")()
+}
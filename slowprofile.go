@@ -0,0 +1,234 @@
+package handlers
+
+import (
+	"fmt"
+	"net/http"
+	"os"
+	"path/filepath"
+	"runtime/pprof"
+	"runtime/trace"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// ProfileKind selects the kind of profile captured for slow requests.
+type ProfileKind int
+
+const (
+	// ProfileCPU captures a CPU profile.
+	ProfileCPU ProfileKind = iota
+	// ProfileGoroutine captures a snapshot of all goroutine stacks.
+	ProfileGoroutine
+	// ProfileTrace captures an execution trace.
+	ProfileTrace
+)
+
+func (k ProfileKind) String() string {
+	switch k {
+	case ProfileCPU:
+		return "cpu"
+	case ProfileGoroutine:
+		return "goroutine"
+	case ProfileTrace:
+		return "trace"
+	}
+	return fmt.Sprintf("ProfileKind(%d)", int(k))
+}
+
+// SlowProfileOption represents a functional option for configuring the slow
+// request profiler.
+type SlowProfileOption func(*slowProfiler) error
+
+type slowProfiler struct {
+	h         http.Handler
+	threshold time.Duration
+	dir       string
+	kind      ProfileKind
+	duration  time.Duration
+	cooldown  time.Duration
+	callback  func(path string, r *http.Request)
+
+	mu   sync.Mutex
+	last time.Time
+}
+
+// profiling guards the process-wide CPU profiler and tracer, only one of
+// which may run at a time.
+var profiling int32
+
+var profileSeq uint64
+
+const (
+	defaultSlowProfileDuration = time.Second
+	defaultSlowProfileCooldown = time.Minute
+)
+
+// ProfileSlowRequests is HTTP middleware capturing a profile when a request
+// has been running for longer than threshold, so tail latency investigations
+// have concrete artifacts. Profiles are written to dir and named after the
+// request ID assigned by RequestIDHandler, which should therefore wrap this
+// middleware, or after the capture time otherwise, e.g. if the ID has other
+// characters than letters, digits, '_' and '-'.
+//
+// The capture starts when the threshold is crossed, while the slow request is
+// still running. Only one CPU profile or trace can be captured at a time in
+// the process, and captures are spaced by a cooldown (one minute by default)
+// to bound their overhead.
+//
+// Example:
+//
+//	profiler := handlers.ProfileSlowRequests(2*time.Second, "/var/tmp/profiles",
+//		handlers.SlowProfileKind(handlers.ProfileTrace))
+//	http.ListenAndServe(":1123", handlers.RequestIDHandler()(profiler(r)))
+func ProfileSlowRequests(threshold time.Duration, dir string, opts ...SlowProfileOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		p := &slowProfiler{
+			h:         h,
+			threshold: threshold,
+			dir:       dir,
+			duration:  defaultSlowProfileDuration,
+			cooldown:  defaultSlowProfileCooldown,
+		}
+		for _, option := range opts {
+			option(p)
+		}
+		return p
+	}
+}
+
+// SlowProfileKind sets the kind of profile captured. The default is
+// ProfileCPU.
+func SlowProfileKind(kind ProfileKind) SlowProfileOption {
+	return func(p *slowProfiler) error {
+		p.kind = kind
+		return nil
+	}
+}
+
+// SlowProfileDuration sets for how long CPU profiles and traces are
+// captured. The default is one second.
+func SlowProfileDuration(d time.Duration) SlowProfileOption {
+	return func(p *slowProfiler) error {
+		if d > 0 {
+			p.duration = d
+		}
+		return nil
+	}
+}
+
+// SlowProfileCooldown sets the minimum delay between two captures. The
+// default is one minute.
+func SlowProfileCooldown(d time.Duration) SlowProfileOption {
+	return func(p *slowProfiler) error {
+		p.cooldown = d
+		return nil
+	}
+}
+
+// SlowProfileCallback sets a function called with the path of every profile
+// written, e.g. to upload it or log its location.
+func SlowProfileCallback(fn func(path string, r *http.Request)) SlowProfileOption {
+	return func(p *slowProfiler) error {
+		p.callback = fn
+		return nil
+	}
+}
+
+func (p *slowProfiler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("slow_profile", w, r)
+	defer end()
+
+	timer := time.AfterFunc(p.threshold, func() { p.capture(r) })
+	defer timer.Stop()
+
+	p.h.ServeHTTP(w, r)
+}
+
+func (p *slowProfiler) capture(r *http.Request) {
+	now := time.Now()
+	p.mu.Lock()
+	if !p.last.IsZero() && now.Sub(p.last) < p.cooldown {
+		p.mu.Unlock()
+		return
+	}
+	p.last = now
+	p.mu.Unlock()
+
+	name := RequestID(r)
+	if !isSafeFileName(name) {
+		name = fmt.Sprintf("%s-%d", now.UTC().Format("20060102T150405.000"), atomic.AddUint64(&profileSeq, 1))
+	}
+	path := filepath.Join(p.dir, fmt.Sprintf("%s.%s.pprof", name, p.kind))
+	if p.kind == ProfileTrace {
+		path = filepath.Join(p.dir, fmt.Sprintf("%s.trace", name))
+	}
+	if filepath.Dir(path) != filepath.Clean(p.dir) {
+		return
+	}
+
+	if err := p.write(path); err != nil {
+		return
+	}
+	if p.callback != nil {
+		p.callback(path, r)
+	}
+}
+
+// isSafeFileName reports whether name is a non-empty file name made of
+// letters, digits, '_' and '-' only. Request IDs may come from clients, and
+// must not lead profiles out of their directory.
+func isSafeFileName(name string) bool {
+	if name == "" {
+		return false
+	}
+	for i := 0; i < len(name); i++ {
+		c := name[i]
+		if !('a' <= c && c <= 'z' || 'A' <= c && c <= 'Z' || '0' <= c && c <= '9' || c == '_' || c == '-') {
+			return false
+		}
+	}
+	return true
+}
+
+func (p *slowProfiler) write(path string) error {
+	if p.kind != ProfileGoroutine {
+		if !atomic.CompareAndSwapInt32(&profiling, 0, 1) {
+			return fmt.Errorf("handlers: a profile is already being captured")
+		}
+		defer atomic.StoreInt32(&profiling, 0)
+	}
+
+	// The file of a profile captured for another request with the same ID
+	// is neither overwritten nor removed.
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_EXCL, 0644)
+	if err != nil {
+		return err
+	}
+	if err := p.writeProfile(f); err != nil {
+		f.Close()
+		os.Remove(path)
+		return err
+	}
+	return f.Close()
+}
+
+func (p *slowProfiler) writeProfile(f *os.File) error {
+	switch p.kind {
+	case ProfileGoroutine:
+		return pprof.Lookup("goroutine").WriteTo(f, 0)
+	case ProfileTrace:
+		if err := trace.Start(f); err != nil {
+			return err
+		}
+		time.Sleep(p.duration)
+		trace.Stop()
+	default:
+		if err := pprof.StartCPUProfile(f); err != nil {
+			return err
+		}
+		time.Sleep(p.duration)
+		pprof.StopCPUProfile()
+	}
+	return nil
+}
@@ -0,0 +1,130 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+func TestProfileSlowRequests(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	captured := make(chan string, 1)
+	profiler := ProfileSlowRequests(20*time.Millisecond, dir,
+		SlowProfileKind(ProfileGoroutine),
+		SlowProfileCallback(func(path string, r *http.Request) { captured <- path }),
+	)
+	sleep := make(chan time.Duration, 1)
+	handler := RequestIDHandler(RequestIDGenerator(func() string { return "slow" }))(profiler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(<-sleep)
+	})))
+
+	// Fast requests aren't profiled.
+	sleep <- 0
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+
+	sleep <- 100 * time.Millisecond
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+
+	select {
+	case path := <-captured:
+		if want := filepath.Join(dir, "slow.goroutine.pprof"); path != want {
+			t.Fatalf("bad profile path: got %q want %q", path, want)
+		}
+		if fi, err := os.Stat(path); err != nil || fi.Size() == 0 {
+			t.Fatalf("bad profile file: %v", err)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no profile captured")
+	}
+
+	// The cooldown prevents a second capture.
+	sleep <- 100 * time.Millisecond
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+	select {
+	case path := <-captured:
+		t.Fatalf("unexpected capture during cooldown: %s", path)
+	default:
+	}
+}
+
+func TestProfileSlowRequestsUnsafeRequestID(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	captured := make(chan string, 1)
+	profiler := ProfileSlowRequests(10*time.Millisecond, filepath.Join(dir, "profiles"),
+		SlowProfileKind(ProfileGoroutine),
+		SlowProfileCallback(func(path string, r *http.Request) { captured <- path }),
+	)
+	if err := os.Mkdir(filepath.Join(dir, "profiles"), 0o755); err != nil {
+		t.Fatal(err)
+	}
+	handler := RequestIDHandler()(profiler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		time.Sleep(50 * time.Millisecond)
+	})))
+
+	r := newRequest("GET", "/")
+	r.Header.Set(RequestIDHeader, "../evil")
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	select {
+	case path := <-captured:
+		if filepath.Dir(path) != filepath.Join(dir, "profiles") || strings.Contains(filepath.Base(path), "evil") {
+			t.Fatalf("bad profile path: %q", path)
+		}
+	case <-time.After(time.Second):
+		t.Fatal("no profile captured")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "evil.goroutine.pprof")); err == nil {
+		t.Fatal("profile written outside its directory")
+	}
+}
+
+func TestProfileSlowRequestsExistingProfile(t *testing.T) {
+	dir, err := ioutil.TempDir("", "profiles")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	// A profile captured for an earlier request with the same ID.
+	existing := filepath.Join(dir, "abc.cpu.pprof")
+	if err := ioutil.WriteFile(existing, []byte("profile"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	done := make(chan struct{})
+	profiler := ProfileSlowRequests(time.Millisecond, dir, SlowProfileKind(ProfileCPU))
+	handler := RequestIDHandler()(profiler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-done
+	})))
+
+	// Another profile is being captured, so this one fails.
+	atomic.StoreInt32(&profiling, 1)
+	defer atomic.StoreInt32(&profiling, 0)
+	r := newRequest("GET", "/")
+	r.Header.Set(RequestIDHeader, "abc")
+	go func() {
+		time.Sleep(50 * time.Millisecond)
+		close(done)
+	}()
+	handler.ServeHTTP(httptest.NewRecorder(), r)
+
+	if b, err := ioutil.ReadFile(existing); err != nil || string(b) != "profile" {
+		t.Fatalf("existing profile changed: %q %v", b, err)
+	}
+}
@@ -0,0 +1,154 @@
+package handlers
+
+import (
+	"net/http"
+	"os"
+	"path"
+	"regexp"
+	"strings"
+)
+
+// defaultFingerprint matches file names containing a hash of their content,
+// as generated by most bundlers, e.g. "app.3f2a1b9c.js" or
+// "chunk-3F2A1B9C.css".
+var defaultFingerprint = regexp.MustCompile(`[.-][0-9a-fA-F]{8,}\.[^/]+$`)
+
+// SPAOption represents a functional option for configuring SPAHandler.
+type SPAOption func(*spa) error
+
+type spa struct {
+	root        http.FileSystem
+	files       http.Handler
+	index       string
+	extensions  map[string]bool
+	fingerprint *regexp.Regexp
+}
+
+// SPAHandler returns a handler serving the static files of a single-page
+// application from root, with http.FileServer.
+//
+// Requests for paths which don't exist are served the index page (by default
+// "index.html"), so that the application can handle client-side routes,
+// unless they look like a request for an asset, i.e. the last path segment
+// has an extension (see SPAAssetExtensions): missing assets get a 404 rather
+// than the HTML shell, which would break loudly in the browser.
+//
+// Fingerprinted assets, whose file name contains a hash of their content, are
+// served with CacheImmutable; the index page with CacheRevalidate so new
+// deployments are picked up.
+//
+// Example:
+//
+//	http.Handle("/", handlers.SPAHandler(http.Dir("./dist")))
+func SPAHandler(root http.FileSystem, opts ...SPAOption) http.Handler {
+	s := &spa{
+		root:        root,
+		files:       http.FileServer(root),
+		index:       "index.html",
+		fingerprint: defaultFingerprint,
+	}
+	for _, option := range opts {
+		option(s)
+	}
+	return s
+}
+
+// SPAIndex sets the name of the index page, "index.html" by default.
+func SPAIndex(name string) SPAOption {
+	return func(s *spa) error {
+		s.index = strings.TrimPrefix(name, "/")
+		return nil
+	}
+}
+
+// SPAAssetExtensions sets the extensions (e.g. ".js") identifying requests for
+// assets, which get a 404 when missing. Other paths fall back to the index
+// page. By default, any extension identifies an asset.
+func SPAAssetExtensions(exts ...string) SPAOption {
+	return func(s *spa) error {
+		s.extensions = map[string]bool{}
+		for _, ext := range exts {
+			s.extensions[strings.ToLower(ext)] = true
+		}
+		return nil
+	}
+}
+
+// SPAFingerprint sets the pattern matching the paths of fingerprinted assets.
+// A nil pattern disables long-term caching.
+func SPAFingerprint(re *regexp.Regexp) SPAOption {
+	return func(s *spa) error {
+		s.fingerprint = re
+		return nil
+	}
+}
+
+func (s *spa) isAsset(p string) bool {
+	ext := strings.ToLower(path.Ext(p))
+	if s.extensions == nil {
+		return ext != ""
+	}
+	return s.extensions[ext]
+}
+
+func (s *spa) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("spa", w, r)
+	defer end()
+
+	p := path.Clean("/" + r.URL.Path)
+
+	if ok, dir := s.exists(p); ok {
+		switch {
+		case s.fingerprint != nil && s.fingerprint.MatchString(p):
+			w.Header().Set("Cache-Control", CacheImmutable)
+		case dir || path.Base(p) == s.index:
+			w.Header().Set("Cache-Control", CacheRevalidate)
+		}
+		s.files.ServeHTTP(w, r)
+		return
+	}
+
+	if s.isAsset(p) || (r.Method != "GET" && r.Method != "HEAD") {
+		http.NotFound(w, r)
+		return
+	}
+	s.serveIndex(w, r)
+}
+
+// exists reports whether p is a file, or a directory with an index page.
+func (s *spa) exists(p string) (ok, dir bool) {
+	f, err := s.root.Open(p)
+	if err != nil {
+		return false, false
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		return false, false
+	}
+	if !fi.IsDir() {
+		return true, false
+	}
+	ok, _ = s.exists(path.Join(p, s.index))
+	return ok, true
+}
+
+func (s *spa) serveIndex(w http.ResponseWriter, r *http.Request) {
+	f, err := s.root.Open("/" + s.index)
+	if err != nil {
+		if os.IsNotExist(err) {
+			http.NotFound(w, r)
+			return
+		}
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	defer f.Close()
+	fi, err := f.Stat()
+	if err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.Header().Set("Cache-Control", CacheRevalidate)
+	http.ServeContent(w, r, fi.Name(), fi.ModTime(), f)
+}
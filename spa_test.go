@@ -0,0 +1,79 @@
+package handlers
+
+import (
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestSPAHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorilla_spa")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	files := map[string]string{
+		"index.html":                         "<html>shell</html>",
+		"assets/app.3f2a1b9c.js":             "app()",
+		"robots.txt":                         "User-agent: *",
+		"docs/index.html":                    "<html>docs</html>",
+		"assets/logo.svg":                    "<svg/>",
+		"assets/vendor-0123456789abcdef.css": "body{}",
+	}
+	for name, content := range files {
+		p := filepath.Join(dir, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0755); err != nil {
+			t.Fatal(err)
+		}
+		if err := ioutil.WriteFile(p, []byte(content), 0644); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := SPAHandler(http.Dir(dir))
+	tests := []struct {
+		path         string
+		code         int
+		body         string
+		cacheControl string
+	}{
+		{"/", http.StatusOK, "shell", CacheRevalidate},
+		{"/users/42", http.StatusOK, "shell", CacheRevalidate},
+		{"/assets/", http.StatusOK, "shell", CacheRevalidate},
+		{"/docs/", http.StatusOK, "docs", CacheRevalidate},
+		{"/robots.txt", http.StatusOK, "User-agent", ""},
+		{"/assets/app.3f2a1b9c.js", http.StatusOK, "app()", CacheImmutable},
+		{"/assets/vendor-0123456789abcdef.css", http.StatusOK, "body{}", CacheImmutable},
+		{"/assets/logo.svg", http.StatusOK, "<svg/>", ""},
+		{"/assets/app.00000000.js", http.StatusNotFound, "", ""},
+		{"/favicon.ico", http.StatusNotFound, "", ""},
+	}
+
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", test.path))
+		if rec.Code != test.code {
+			t.Errorf("%s: bad status: got %d want %d", test.path, rec.Code, test.code)
+			continue
+		}
+		if !strings.Contains(rec.Body.String(), test.body) {
+			t.Errorf("%s: bad body: got %q want %q", test.path, rec.Body.String(), test.body)
+		}
+		if got := rec.Header().Get("Cache-Control"); test.code == http.StatusOK && got != test.cacheControl {
+			t.Errorf("%s: bad Cache-Control: got %q want %q", test.path, got, test.cacheControl)
+		}
+	}
+
+	// With explicit asset extensions, other extensions fall back to the shell.
+	handler = SPAHandler(http.Dir(dir), SPAAssetExtensions(".js", ".css"))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/users/jane.doe"))
+	if rec.Code != http.StatusOK || !strings.Contains(rec.Body.String(), "shell") {
+		t.Errorf("bad fallback: %d %q", rec.Code, rec.Body.String())
+	}
+}
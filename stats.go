@@ -0,0 +1,144 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"runtime"
+	"sort"
+	"sync"
+	"sync/atomic"
+	"time"
+)
+
+// inFlightCounter counts the requests currently being served by one of the
+// middlewares of this package. Counters are reported by StatsHandler.
+type inFlightCounter struct {
+	n int64
+}
+
+var (
+	inFlightMu       sync.Mutex
+	inFlightCounters = map[string]*inFlightCounter{}
+
+	startTime = time.Now()
+)
+
+// newInFlightCounter returns the counter registered under name, creating it
+// if necessary.
+func newInFlightCounter(name string) *inFlightCounter {
+	inFlightMu.Lock()
+	defer inFlightMu.Unlock()
+
+	c, ok := inFlightCounters[name]
+	if !ok {
+		c = &inFlightCounter{}
+		inFlightCounters[name] = c
+	}
+	return c
+}
+
+// track increments the counter and returns a function decrementing it.
+func (c *inFlightCounter) track() func() {
+	atomic.AddInt64(&c.n, 1)
+	return func() { atomic.AddInt64(&c.n, -1) }
+}
+
+func (c *inFlightCounter) load() int64 {
+	return atomic.LoadInt64(&c.n)
+}
+
+// Stats is the document served by StatsHandler.
+type Stats struct {
+	Time       time.Time        `json:"time"`
+	Uptime     string           `json:"uptime"`
+	GoVersion  string           `json:"go_version"`
+	NumCPU     int              `json:"num_cpu"`
+	Goroutines int              `json:"goroutines"`
+	Memory     MemoryStats      `json:"memory"`
+	InFlight   map[string]int64 `json:"in_flight"`
+	// Caches reports the response caches registered with CacheName.
+	Caches map[string]CacheStats `json:"caches,omitempty"`
+	// Canaries reports the canaries registered with CanaryName.
+	Canaries map[string]CanaryStats `json:"canaries,omitempty"`
+}
+
+// MemoryStats is the subset of runtime.MemStats reported by StatsHandler.
+type MemoryStats struct {
+	Alloc        uint64 `json:"alloc"`
+	TotalAlloc   uint64 `json:"total_alloc"`
+	Sys          uint64 `json:"sys"`
+	HeapAlloc    uint64 `json:"heap_alloc"`
+	HeapInuse    uint64 `json:"heap_inuse"`
+	HeapObjects  uint64 `json:"heap_objects"`
+	NumGC        uint32 `json:"num_gc"`
+	PauseTotalNs uint64 `json:"pause_total_ns"`
+}
+
+// ReadStats returns a snapshot of the runtime statistics and of the number of
+// requests in flight in each middleware of this package.
+func ReadStats() Stats {
+	var ms runtime.MemStats
+	runtime.ReadMemStats(&ms)
+
+	now := time.Now()
+	s := Stats{
+		Time:       now,
+		Uptime:     now.Sub(startTime).Round(time.Second).String(),
+		GoVersion:  runtime.Version(),
+		NumCPU:     runtime.NumCPU(),
+		Goroutines: runtime.NumGoroutine(),
+		Memory: MemoryStats{
+			Alloc:        ms.Alloc,
+			TotalAlloc:   ms.TotalAlloc,
+			Sys:          ms.Sys,
+			HeapAlloc:    ms.HeapAlloc,
+			HeapInuse:    ms.HeapInuse,
+			HeapObjects:  ms.HeapObjects,
+			NumGC:        ms.NumGC,
+			PauseTotalNs: ms.PauseTotalNs,
+		},
+		InFlight: map[string]int64{},
+		Caches:   ReadCacheStats(),
+		Canaries: ReadCanaryStats(),
+	}
+
+	inFlightMu.Lock()
+	names := make([]string, 0, len(inFlightCounters))
+	for name := range inFlightCounters {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		s.InFlight[name] = inFlightCounters[name].load()
+	}
+	inFlightMu.Unlock()
+
+	return s
+}
+
+// StatsHandler returns a http.Handler serving runtime statistics as JSON:
+// goroutines, memory usage and the number of requests currently in flight in
+// the middlewares of this package.
+//
+// Access is restricted by the given options. Without any option only loopback
+// clients are allowed.
+//
+// Example:
+//
+//	mux := http.NewServeMux()
+//	mux.Handle("/debug/stats", handlers.StatsHandler(
+//		handlers.GuardAllowedIPs([]string{"10.0.0.0/8"}),
+//		handlers.GuardBasicAuth("ops", os.Getenv("STATS_PASSWORD")),
+//	))
+func StatsHandler(opts ...GuardOption) http.Handler {
+	return newGuard(http.HandlerFunc(serveStats), opts...)
+}
+
+func serveStats(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Header().Set("Cache-Control", "no-store")
+
+	enc := json.NewEncoder(w)
+	enc.SetIndent("", "  ")
+	enc.Encode(ReadStats())
+}
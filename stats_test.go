@@ -0,0 +1,47 @@
+package handlers
+
+import (
+	"encoding/json"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func TestStatsHandler(t *testing.T) {
+	var stats Stats
+	handler := LoggingHandler(ioutil.Discard, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		rec := httptest.NewRecorder()
+		r.RemoteAddr = "127.0.0.1:1234"
+		StatsHandler().ServeHTTP(rec, r)
+
+		if got, want := rec.Header().Get("Content-Type"), "application/json"; got != want {
+			t.Fatalf("bad content type: got %q want %q", got, want)
+		}
+		if err := json.Unmarshal(rec.Body.Bytes(), &stats); err != nil {
+			t.Fatal(err)
+		}
+	}))
+	handler.ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+
+	if stats.Goroutines == 0 {
+		t.Fatal("expected goroutines to be reported")
+	}
+	if got := stats.InFlight["logging"]; got != 1 {
+		t.Fatalf("bad in-flight count for logging: got %d want 1", got)
+	}
+	if got := ReadStats().InFlight["logging"]; got != 0 {
+		t.Fatalf("bad in-flight count after request: got %d want 0", got)
+	}
+}
+
+func TestStatsHandlerForbidden(t *testing.T) {
+	r := newRequest("GET", "/")
+	r.RemoteAddr = "192.0.2.1:1234"
+	rec := httptest.NewRecorder()
+	StatsHandler().ServeHTTP(rec, r)
+
+	if rec.Code != http.StatusForbidden {
+		t.Fatalf("bad status: got %d want %d", rec.Code, http.StatusForbidden)
+	}
+}
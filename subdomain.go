@@ -0,0 +1,160 @@
+package handlers
+
+import (
+	"net"
+	"net/http"
+	"net/http/cookiejar"
+	"strings"
+)
+
+// SubdomainOption represents a functional option for configuring the
+// Subdomains middleware.
+type SubdomainOption func(*subdomains) error
+
+type subdomains struct {
+	h           http.Handler
+	list        cookiejar.PublicSuffixList
+	baseDomains []string
+	ignore      map[string]bool
+}
+
+// hostParts is stored in the request context by Subdomains.
+type hostParts struct {
+	domain string
+	labels []string
+}
+
+// SubdomainSuffixList sets the public suffix list used to find the
+// registrable domain of hosts, typically publicsuffix.List from
+// golang.org/x/net/publicsuffix. Without it, only the last label of host names
+// is considered a public suffix, so "a.example.co.uk" is parsed as subdomain
+// "a.example" of "co.uk".
+func SubdomainSuffixList(list cookiejar.PublicSuffixList) SubdomainOption {
+	return func(s *subdomains) error {
+		s.list = list
+		return nil
+	}
+}
+
+// SubdomainBaseDomains sets the domains under which the application is
+// served, e.g. "app.example.com" for tenants at "acme.app.example.com". They
+// take precedence over the public suffix list: the subdomain of a host under
+// one of them is what precedes the base domain.
+func SubdomainBaseDomains(domains ...string) SubdomainOption {
+	return func(s *subdomains) error {
+		for _, d := range domains {
+			s.baseDomains = append(s.baseDomains, normalizeHost(d))
+		}
+		return nil
+	}
+}
+
+// SubdomainIgnore drops the given labels when they are the leftmost label of
+// the subdomain, e.g. "www", so that "www.acme.example.com" has subdomain
+// "acme".
+func SubdomainIgnore(labels ...string) SubdomainOption {
+	return func(s *subdomains) error {
+		for _, l := range labels {
+			s.ignore[strings.ToLower(l)] = true
+		}
+		return nil
+	}
+}
+
+// Subdomains is HTTP middleware splitting the Host of requests into the
+// registrable domain and the subdomain labels, and storing them in the
+// request's context, where they can be retrieved with RegistrableDomain,
+// Subdomain and SubdomainLabels. Multi-tenant applications can thus resolve
+// the tenant before routing.
+//
+// Requests addressed to an IP address have neither domain nor subdomain.
+//
+// Example:
+//
+//	tenants := handlers.Subdomains(
+//		handlers.SubdomainBaseDomains("example.com"),
+//		handlers.SubdomainIgnore("www"),
+//	)
+//	r.HandleFunc("/", func(w http.ResponseWriter, r *http.Request) {
+//		tenant := handlers.Subdomain(r) // "acme" for acme.example.com
+//		...
+//	})
+//	http.ListenAndServe(":1123", tenants(r))
+func Subdomains(opts ...SubdomainOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		s := &subdomains{h: h, ignore: map[string]bool{}}
+		for _, option := range opts {
+			option(s)
+		}
+		return s
+	}
+}
+
+func (s *subdomains) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("subdomains", w, r)
+	defer end()
+
+	parts := s.split(normalizeHost(r.Host))
+	s.h.ServeHTTP(w, WithValue(r, parts))
+}
+
+// split splits host into its registrable domain and subdomain labels.
+func (s *subdomains) split(host string) *hostParts {
+	if host == "" || net.ParseIP(strings.Trim(host, "[]")) != nil {
+		return &hostParts{}
+	}
+
+	domain := ""
+	for _, base := range s.baseDomains {
+		if host == base || strings.HasSuffix(host, "."+base) {
+			if len(base) > len(domain) {
+				domain = base
+			}
+		}
+	}
+	if domain == "" {
+		suffix := host[strings.LastIndexByte(host, '.')+1:]
+		if s.list != nil {
+			suffix = s.list.PublicSuffix(host)
+		}
+		if suffix == host {
+			// The host is a public suffix itself.
+			return &hostParts{}
+		}
+		rest := strings.TrimSuffix(host, "."+suffix)
+		domain = rest[strings.LastIndexByte(rest, '.')+1:] + "." + suffix
+	}
+
+	parts := &hostParts{domain: domain}
+	if host != domain {
+		parts.labels = strings.Split(strings.TrimSuffix(host, "."+domain), ".")
+		for len(parts.labels) > 0 && s.ignore[parts.labels[0]] {
+			parts.labels = parts.labels[1:]
+		}
+	}
+	return parts
+}
+
+// RegistrableDomain returns the registrable domain of the host the request is
+// addressed to, e.g. "example.com" for "api.eu.example.com", as parsed by
+// Subdomains. It returns an empty string if there is none.
+func RegistrableDomain(r *http.Request) string {
+	return RegistrableDomainFromContext(r.Context())
+}
+
+// Subdomain returns the subdomain of the host the request is addressed to,
+// e.g. "api.eu" for "api.eu.example.com", as parsed by Subdomains. It returns
+// an empty string if there is none.
+func Subdomain(r *http.Request) string {
+	return strings.Join(SubdomainLabels(r), ".")
+}
+
+// SubdomainLabels returns the labels of the subdomain of the host the request
+// is addressed to, leftmost first, e.g. ["api", "eu"] for
+// "api.eu.example.com", as parsed by Subdomains.
+func SubdomainLabels(r *http.Request) []string {
+	if p, ok := Value[*hostParts](r); ok {
+		return append([]string(nil), p.labels...)
+	}
+	return nil
+}
@@ -0,0 +1,74 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+// testSuffixList knows the public suffixes used in the tests.
+type testSuffixList struct{}
+
+func (testSuffixList) PublicSuffix(domain string) string {
+	for _, suffix := range []string{"co.uk", "github.io"} {
+		if domain == suffix || strings.HasSuffix(domain, "."+suffix) {
+			return suffix
+		}
+	}
+	return domain[strings.LastIndexByte(domain, '.')+1:]
+}
+
+func (testSuffixList) String() string { return "test" }
+
+func TestSubdomains(t *testing.T) {
+	tests := []struct {
+		opts      []SubdomainOption
+		host      string
+		domain    string
+		subdomain string
+	}{
+		{nil, "example.com", "example.com", ""},
+		{nil, "API.eu.example.com:8080", "example.com", "api.eu"},
+		{nil, "a.example.co.uk", "co.uk", "a.example"},
+		{nil, "localhost", "", ""},
+		{nil, "127.0.0.1:8080", "", ""},
+		{nil, "[::1]:8080", "", ""},
+		{[]SubdomainOption{SubdomainSuffixList(testSuffixList{})}, "a.example.co.uk", "example.co.uk", "a"},
+		{[]SubdomainOption{SubdomainSuffixList(testSuffixList{})}, "user.github.io", "user.github.io", ""},
+		{[]SubdomainOption{SubdomainSuffixList(testSuffixList{})}, "co.uk", "", ""},
+		{[]SubdomainOption{SubdomainBaseDomains("app.example.com")}, "acme.app.example.com", "app.example.com", "acme"},
+		{[]SubdomainOption{SubdomainBaseDomains("app.example.com")}, "www.example.com", "example.com", "www"},
+		{[]SubdomainOption{SubdomainIgnore("www")}, "www.acme.example.com", "example.com", "acme"},
+		{[]SubdomainOption{SubdomainIgnore("www")}, "www.example.com", "example.com", ""},
+	}
+	for _, test := range tests {
+		var domain, subdomain string
+		handler := Subdomains(test.opts...)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			domain = RegistrableDomain(r)
+			subdomain = Subdomain(r)
+		}))
+		r := newRequest("GET", "/")
+		r.Host = test.host
+		handler.ServeHTTP(httptest.NewRecorder(), r)
+		if domain != test.domain || subdomain != test.subdomain {
+			t.Errorf("%q: got (%q, %q) want (%q, %q)", test.host, domain, subdomain, test.domain, test.subdomain)
+		}
+	}
+}
+
+func TestSubdomainLabels(t *testing.T) {
+	r := newRequest("GET", "/")
+	if labels := SubdomainLabels(r); labels != nil {
+		t.Fatalf("labels without middleware: %v", labels)
+	}
+
+	r.Host = "a.b.example.com"
+	var labels []string
+	Subdomains()(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		labels = SubdomainLabels(r)
+	})).ServeHTTP(httptest.NewRecorder(), r)
+	if len(labels) != 2 || labels[0] != "a" || labels[1] != "b" {
+		t.Fatalf("wrong labels: %v", labels)
+	}
+}
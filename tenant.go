@@ -0,0 +1,287 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+var (
+	// ErrTenantNotFound is returned by TenantResolver implementations for
+	// unknown tenants. Tenants answers such requests with 404 Not Found.
+	ErrTenantNotFound = errors.New("handlers: tenant not found")
+	// ErrTenantForbidden is returned by TenantResolver implementations for
+	// tenants which may not be served, e.g. suspended ones. Tenants answers
+	// such requests with 403 Forbidden.
+	ErrTenantForbidden = errors.New("handlers: tenant forbidden")
+)
+
+// TenantResolver looks up tenants of type T by ID, typically in a database.
+type TenantResolver[T any] interface {
+	// ResolveTenant returns the tenant with the given ID. It returns
+	// ErrTenantNotFound or ErrTenantForbidden, possibly wrapped, for tenants
+	// which can't be served.
+	ResolveTenant(ctx context.Context, id string) (T, error)
+}
+
+// TenantResolverFunc is an adapter to use a function as a TenantResolver.
+type TenantResolverFunc[T any] func(ctx context.Context, id string) (T, error)
+
+// ResolveTenant calls fn(ctx, id).
+func (fn TenantResolverFunc[T]) ResolveTenant(ctx context.Context, id string) (T, error) {
+	return fn(ctx, id)
+}
+
+// TenantOption represents a functional option for configuring the Tenants
+// middleware.
+type TenantOption func(*tenantConfig) error
+
+type tenantConfig struct {
+	sources   []func(*http.Request) (id, prefix string)
+	optional  bool
+	cacheTTL  time.Duration
+	cacheSize int
+}
+
+// tenantID is stored in the request context by Tenants.
+type tenantID string
+
+// TenantFromSubdomain takes the tenant ID from the subdomain of the request
+// host, as parsed by the Subdomains middleware, which must run first. It is
+// the default source.
+func TenantFromSubdomain() TenantOption {
+	return TenantFromFunc(Subdomain)
+}
+
+// TenantFromHost takes the tenant ID from the request host, without port, for
+// tenants with their own domains.
+func TenantFromHost() TenantOption {
+	return TenantFromFunc(func(r *http.Request) string {
+		return normalizeHost(r.Host)
+	})
+}
+
+// TenantFromHeader takes the tenant ID from the named request header, for
+// services behind a gateway which authenticates tenants.
+func TenantFromHeader(name string) TenantOption {
+	return TenantFromFunc(func(r *http.Request) string {
+		return strings.TrimSpace(r.Header.Get(name))
+	})
+}
+
+// TenantFromPath takes the tenant ID from the first segment of the request
+// path, which is then stripped as by StripPrefix: "/acme/users" is served as
+// "/users" for tenant "acme".
+func TenantFromPath() TenantOption {
+	return func(c *tenantConfig) error {
+		c.sources = append(c.sources, func(r *http.Request) (string, string) {
+			p := strings.TrimPrefix(r.URL.Path, "/")
+			if i := strings.IndexByte(p, '/'); i >= 0 {
+				p = p[:i]
+			}
+			if p == "" {
+				return "", ""
+			}
+			return p, "/" + p
+		})
+		return nil
+	}
+}
+
+// TenantFromFunc takes the tenant ID from the result of fn.
+func TenantFromFunc(fn func(r *http.Request) string) TenantOption {
+	return func(c *tenantConfig) error {
+		c.sources = append(c.sources, func(r *http.Request) (string, string) {
+			return fn(r), ""
+		})
+		return nil
+	}
+}
+
+// TenantOptional lets requests without a tenant ID through, without tenant.
+// By default they are answered with 404 Not Found.
+func TenantOptional() TenantOption {
+	return func(c *tenantConfig) error {
+		c.optional = true
+		return nil
+	}
+}
+
+// TenantCache caches up to size lookups, successful or not, for ttl. By
+// default every request is resolved.
+func TenantCache(size int, ttl time.Duration) TenantOption {
+	return func(c *tenantConfig) error {
+		c.cacheSize = size
+		c.cacheTTL = ttl
+		if size < 0 || ttl < 0 {
+			return fmt.Errorf("handlers: invalid tenant cache size %d or TTL %v", size, ttl)
+		}
+		return nil
+	}
+}
+
+type tenants[T any] struct {
+	h        http.Handler
+	resolver TenantResolver[T]
+	tenantConfig
+
+	mu    sync.Mutex
+	cache map[string]tenantEntry[T]
+}
+
+type tenantEntry[T any] struct {
+	tenant  T
+	err     error
+	expires time.Time
+}
+
+// Tenants is HTTP middleware resolving the tenant of each request with
+// resolver, from the ID found by the configured sources, tried in order until
+// one finds an ID. The tenant is stored in the request context, where it is
+// retrieved with Value[T], and its ID with TenantID.
+//
+// Requests for unknown tenants, or without a tenant ID, are answered with 404
+// Not Found, and those for forbidden tenants with 403 Forbidden. Other
+// resolver errors are answered with 500 Internal Server Error.
+//
+// Example:
+//
+//	resolve := handlers.TenantResolverFunc[*Tenant](func(ctx context.Context, id string) (*Tenant, error) {
+//		t, err := db.FindTenant(ctx, id)
+//		if errors.Is(err, sql.ErrNoRows) {
+//			return nil, handlers.ErrTenantNotFound
+//		}
+//		return t, err
+//	})
+//	stack := handlers.Chain(
+//		handlers.Subdomains(handlers.SubdomainBaseDomains("example.com")),
+//		handlers.Tenants[*Tenant](resolve, handlers.TenantCache(1000, time.Minute)),
+//	)
+//
+//	// In a handler:
+//	tenant, _ := handlers.Value[*Tenant](r)
+func Tenants[T any](resolver TenantResolver[T], opts ...TenantOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		t := &tenants[T]{h: h, resolver: resolver}
+		for _, option := range opts {
+			option(&t.tenantConfig)
+		}
+		if len(t.sources) == 0 {
+			TenantFromSubdomain()(&t.tenantConfig)
+		}
+		return t
+	}
+}
+
+// NewTenants is like Tenants, but returns an error if resolver is nil or an
+// option is invalid.
+func NewTenants[T any](resolver TenantResolver[T], opts ...TenantOption) (func(http.Handler) http.Handler, error) {
+	if resolver == nil {
+		return nil, errors.New("handlers: nil tenant resolver")
+	}
+	c := &tenantConfig{}
+	for _, option := range opts {
+		if err := option(c); err != nil {
+			return nil, err
+		}
+	}
+	return Tenants(resolver, opts...), nil
+}
+
+func (t *tenants[T]) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("tenant", w, r)
+	defer end()
+
+	var id, prefix string
+	for _, source := range t.sources {
+		if id, prefix = source(r); id != "" {
+			break
+		}
+	}
+	if id == "" {
+		if t.optional {
+			t.h.ServeHTTP(w, r)
+			return
+		}
+		tenantError(w, r, http.StatusNotFound)
+		return
+	}
+
+	tenant, err := t.resolve(r.Context(), id)
+	switch {
+	case errors.Is(err, ErrTenantNotFound):
+		tenantError(w, r, http.StatusNotFound)
+		return
+	case errors.Is(err, ErrTenantForbidden):
+		tenantError(w, r, http.StatusForbidden)
+		return
+	case err != nil:
+		tenantError(w, r, http.StatusInternalServerError)
+		return
+	}
+
+	SetLogField(r, "tenant", id)
+	r = WithValue(WithValue(r, tenantID(id)), tenant)
+	if prefix != "" {
+		StripPrefix(prefix, t.h).ServeHTTP(w, r)
+		return
+	}
+	t.h.ServeHTTP(w, r)
+}
+
+// resolve resolves id, through the cache if enabled.
+func (t *tenants[T]) resolve(ctx context.Context, id string) (T, error) {
+	if t.cacheSize == 0 || t.cacheTTL == 0 {
+		return t.resolver.ResolveTenant(ctx, id)
+	}
+
+	now := time.Now()
+	t.mu.Lock()
+	e, ok := t.cache[id]
+	t.mu.Unlock()
+	if ok && now.Before(e.expires) {
+		return e.tenant, e.err
+	}
+
+	tenant, err := t.resolver.ResolveTenant(ctx, id)
+	if err != nil && !errors.Is(err, ErrTenantNotFound) && !errors.Is(err, ErrTenantForbidden) {
+		// Don't cache transient failures.
+		return tenant, err
+	}
+	t.mu.Lock()
+	defer t.mu.Unlock()
+	if t.cache == nil {
+		t.cache = make(map[string]tenantEntry[T], t.cacheSize)
+	}
+	if len(t.cache) >= t.cacheSize {
+		for k, e := range t.cache {
+			if !now.Before(e.expires) {
+				delete(t.cache, k)
+			}
+		}
+		for k := range t.cache {
+			if len(t.cache) < t.cacheSize {
+				break
+			}
+			delete(t.cache, k)
+		}
+	}
+	t.cache[id] = tenantEntry[T]{tenant: tenant, err: err, expires: now.Add(t.cacheTTL)}
+	return tenant, err
+}
+
+func tenantError(w http.ResponseWriter, r *http.Request, code int) {
+	if !writeProblem(w, r, code, "") {
+		http.Error(w, http.StatusText(code), code)
+	}
+}
+
+// TenantID returns the ID of the tenant resolved by Tenants, or an empty
+// string.
+func TenantID(r *http.Request) string {
+	return TenantIDFromContext(r.Context())
+}
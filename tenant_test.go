@@ -0,0 +1,108 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+type testTenant struct {
+	Name string
+}
+
+func testTenantResolver(calls *int32) TenantResolver[*testTenant] {
+	return TenantResolverFunc[*testTenant](func(ctx context.Context, id string) (*testTenant, error) {
+		atomic.AddInt32(calls, 1)
+		switch id {
+		case "acme":
+			return &testTenant{Name: "Acme"}, nil
+		case "banned":
+			return nil, ErrTenantForbidden
+		case "broken":
+			return nil, errors.New("database down")
+		}
+		return nil, ErrTenantNotFound
+	})
+}
+
+func TestTenants(t *testing.T) {
+	var calls int32
+	var name, id, path string
+	h := Chain(
+		Subdomains(SubdomainBaseDomains("example.com")),
+		Tenants(testTenantResolver(&calls), TenantFromHeader("X-Tenant"), TenantFromSubdomain(), TenantCache(10, time.Minute)),
+	)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		tenant, _ := Value[*testTenant](r)
+		name, id, path = tenant.Name, TenantID(r), r.URL.Path
+	}))
+
+	tests := []struct {
+		host, header string
+		code         int
+	}{
+		{"acme.example.com", "", http.StatusOK},
+		{"example.com", "acme", http.StatusOK},
+		{"banned.example.com", "", http.StatusForbidden},
+		{"unknown.example.com", "", http.StatusNotFound},
+		{"unknown.example.com", "", http.StatusNotFound},
+		{"broken.example.com", "", http.StatusInternalServerError},
+		{"example.com", "", http.StatusNotFound},
+	}
+	for _, test := range tests {
+		name, id = "", ""
+		r := newRequest("GET", "/users")
+		r.Host = test.host
+		if test.header != "" {
+			r.Header.Set("X-Tenant", test.header)
+		}
+		rec := httptest.NewRecorder()
+		h.ServeHTTP(rec, r)
+		if rec.Code != test.code {
+			t.Errorf("%s %s: wrong status: got %d want %d", test.host, test.header, rec.Code, test.code)
+		}
+		if test.code == http.StatusOK && (name != "Acme" || id != "acme" || path != "/users") {
+			t.Errorf("%s %s: wrong tenant: %q %q %q", test.host, test.header, name, id, path)
+		}
+	}
+	// acme, banned and unknown are cached; broken isn't.
+	if calls != 4 {
+		t.Errorf("wrong number of lookups: got %d want 4", calls)
+	}
+}
+
+func TestTenantsFromPath(t *testing.T) {
+	var calls int32
+	var id, path, prefix string
+	h := Tenants(testTenantResolver(&calls), TenantFromPath(), TenantOptional())(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id, path, prefix = TenantID(r), r.URL.Path, MountPrefix(r)
+	}))
+
+	rec := httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/acme/users"))
+	if rec.Code != http.StatusOK || id != "acme" || path != "/users" || prefix != "/acme" {
+		t.Fatalf("wrong request: %d %q %q %q", rec.Code, id, path, prefix)
+	}
+
+	rec = httptest.NewRecorder()
+	h.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Code != http.StatusOK || id != "" {
+		t.Fatalf("optional tenant: wrong request: %d %q", rec.Code, id)
+	}
+}
+
+func TestNewTenants(t *testing.T) {
+	var calls int32
+	if _, err := NewTenants[*testTenant](nil); err == nil {
+		t.Error("no error for a nil resolver")
+	}
+	if _, err := NewTenants(testTenantResolver(&calls), TenantCache(-1, time.Minute)); err == nil {
+		t.Error("no error for an invalid cache size")
+	}
+	if _, err := NewTenants(testTenantResolver(&calls), TenantCache(10, time.Minute)); err != nil {
+		t.Error(err)
+	}
+}
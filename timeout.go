@@ -0,0 +1,291 @@
+package handlers
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"sync"
+	"time"
+)
+
+// TimeoutOption represents a functional option for configuring Timeout.
+type TimeoutOption func(*timeout) error
+
+type timeout struct {
+	h       http.Handler
+	d       time.Duration
+	status  int
+	message string
+	exempt  []func(r *http.Request) bool
+}
+
+// TimeoutStatus sets the status of the responses to requests which time out,
+// 503 Service Unavailable by default. 504 Gateway Timeout suits services
+// timing out because of their own upstreams.
+func TimeoutStatus(code int) TimeoutOption {
+	return func(t *timeout) error {
+		t.status = code
+		if code < 500 || code > 599 {
+			return fmt.Errorf("handlers: invalid timeout status %d", code)
+		}
+		return nil
+	}
+}
+
+// TimeoutMessage sets the body of the responses to requests which time out,
+// the status text by default. It is the detail of the problem document when
+// the request is served through ProblemResponses.
+func TimeoutMessage(msg string) TimeoutOption {
+	return func(t *timeout) error {
+		t.message = msg
+		return nil
+	}
+}
+
+// TimeoutExempt exempts the requests for which fn returns true from the time
+// limit, e.g. those accepting text/event-stream. They are served as if
+// Timeout wasn't there.
+func TimeoutExempt(fn func(r *http.Request) bool) TimeoutOption {
+	return func(t *timeout) error {
+		if fn == nil {
+			return errors.New("handlers: nil timeout exemption")
+		}
+		t.exempt = append(t.exempt, fn)
+		return nil
+	}
+}
+
+// TimeoutExemptPaths exempts the requests whose path starts with one of the
+// given prefixes from the time limit, e.g. streaming or long-polling
+// endpoints.
+func TimeoutExemptPaths(prefixes []string) TimeoutOption {
+	prefixes = append([]string(nil), prefixes...)
+	return TimeoutExempt(func(r *http.Request) bool {
+		for _, prefix := range prefixes {
+			if strings.HasPrefix(r.URL.Path, prefix) {
+				return true
+			}
+		}
+		return false
+	})
+}
+
+// Timeout is HTTP middleware limiting the time handlers take to serve a
+// request to d. The request context of the handler gets a deadline, and a
+// request still being served when it expires is answered with 503 Service
+// Unavailable, see TimeoutStatus and TimeoutMessage. The handler keeps
+// running until it returns, but its writes then fail with
+// http.ErrHandlerTimeout, so it should give up once its context is done.
+//
+// Unlike http.TimeoutHandler, Timeout doesn't buffer responses: they are
+// passed on as the handler writes and flushes them. If a response is under
+// way when the deadline expires, the connection is aborted instead, so that
+// clients don't take the truncated response for a complete one.
+//
+// Upgrade requests aren't subject to the time limit, nor are requests exempted
+// with TimeoutExempt or TimeoutExemptPaths. RPC calls, such as gRPC-Web ones,
+// only get the context deadline, their status being reported in trailers.
+//
+// Example:
+//
+//	timeout := handlers.Timeout(5*time.Second,
+//		handlers.TimeoutStatus(http.StatusGatewayTimeout),
+//		handlers.TimeoutExemptPaths([]string{"/events"}),
+//	)
+//	http.ListenAndServe(":1123", timeout(r))
+func Timeout(d time.Duration, opts ...TimeoutOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		t := &timeout{h: h, d: d, status: http.StatusServiceUnavailable}
+		for _, option := range opts {
+			option(t)
+		}
+		return t
+	}
+}
+
+// NewTimeout is like Timeout, but returns an error if d isn't positive or an
+// option is invalid.
+func NewTimeout(d time.Duration, opts ...TimeoutOption) (func(http.Handler) http.Handler, error) {
+	if d <= 0 {
+		return nil, fmt.Errorf("handlers: invalid timeout %v", d)
+	}
+	t := &timeout{status: http.StatusServiceUnavailable}
+	for _, option := range opts {
+		if err := option(t); err != nil {
+			return nil, err
+		}
+	}
+	return Timeout(d, opts...), nil
+}
+
+func (t *timeout) isExempt(r *http.Request) bool {
+	if IsUpgradeRequest(r) {
+		return true
+	}
+	for _, exempt := range t.exempt {
+		if exempt(r) {
+			return true
+		}
+	}
+	return false
+}
+
+func (t *timeout) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("timeout", w, r)
+	defer end()
+
+	if t.d <= 0 || t.isExempt(r) {
+		t.h.ServeHTTP(w, r)
+		return
+	}
+
+	ctx, cancel := context.WithTimeout(r.Context(), t.d)
+	defer cancel()
+	r = r.WithContext(ctx)
+	if IsRPCRequest(r) {
+		t.h.ServeHTTP(w, r)
+		return
+	}
+
+	tw := &timeoutWriter{w: w, h: w.Header().Clone()}
+	done := make(chan struct{})
+	panicked := make(chan interface{}, 1)
+	go func() {
+		defer func() {
+			if p := recover(); p != nil {
+				panicked <- p
+				return
+			}
+			close(done)
+		}()
+		t.h.ServeHTTP(tw, r)
+	}()
+
+	select {
+	case p := <-panicked:
+		panic(p)
+	case <-done:
+		tw.finish()
+	case <-ctx.Done():
+		tw.mu.Lock()
+		tw.timedOut = true
+		started := tw.wroteHeader
+		tw.mu.Unlock()
+		if started {
+			panic(http.ErrAbortHandler)
+		}
+		if ctx.Err() != context.DeadlineExceeded {
+			// The client is gone.
+			w.WriteHeader(t.status)
+			return
+		}
+		msg := t.message
+		if msg == "" {
+			msg = http.StatusText(t.status)
+		}
+		if !writeProblem(w, r, t.status, msg) {
+			http.Error(w, msg, t.status)
+		}
+	}
+}
+
+// timeoutWriter is the http.ResponseWriter of the handlers run by Timeout. It
+// passes the response on to w until the deadline expires, and fails writes
+// afterwards, the response being sent by Timeout. The handler modifies its
+// own copy of the headers, applied to w when the status is written.
+type timeoutWriter struct {
+	w           http.ResponseWriter
+	mu          sync.Mutex
+	h           http.Header
+	wroteHeader bool
+	timedOut    bool
+}
+
+func (tw *timeoutWriter) Header() http.Header {
+	return tw.h
+}
+
+func (tw *timeoutWriter) WriteHeader(code int) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut || tw.wroteHeader {
+		return
+	}
+	tw.writeHeader(code)
+}
+
+func (tw *timeoutWriter) Write(b []byte) (int, error) {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return 0, http.ErrHandlerTimeout
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	return tw.w.Write(b)
+}
+
+func (tw *timeoutWriter) Flush() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if tw.timedOut {
+		return
+	}
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+	}
+	if f, ok := tw.w.(http.Flusher); ok {
+		f.Flush()
+	}
+}
+
+// writeHeader applies the headers of the handler to w and writes the status.
+// Interim responses are passed on without ending the header phase.
+func (tw *timeoutWriter) writeHeader(code int) {
+	tw.copyHeader()
+	tw.w.WriteHeader(code)
+	if code >= 200 || code == http.StatusSwitchingProtocols {
+		tw.wroteHeader = true
+	}
+}
+
+func (tw *timeoutWriter) copyHeader() {
+	dst := tw.w.Header()
+	for name := range dst {
+		if _, ok := tw.h[name]; !ok {
+			delete(dst, name)
+		}
+	}
+	for name, values := range tw.h {
+		dst[name] = values
+	}
+}
+
+// finish completes the response once the handler has returned in time: the
+// status is written if the handler didn't, and trailers are passed on.
+func (tw *timeoutWriter) finish() {
+	tw.mu.Lock()
+	defer tw.mu.Unlock()
+	if !tw.wroteHeader {
+		tw.writeHeader(http.StatusOK)
+		return
+	}
+	dst := tw.w.Header()
+	declared := dst.Values("Trailer")
+	for name, values := range tw.h {
+		if strings.HasPrefix(name, http.TrailerPrefix) {
+			dst[name] = values
+			continue
+		}
+		for _, list := range declared {
+			for _, trailer := range strings.Split(list, ",") {
+				if http.CanonicalHeaderKey(strings.TrimSpace(trailer)) == name {
+					dst[name] = values
+				}
+			}
+		}
+	}
+}
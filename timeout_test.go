@@ -0,0 +1,145 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTimeout(t *testing.T) {
+	slow := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+	})
+	fast := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); !ok {
+			t.Error("no deadline")
+		}
+		w.Header().Set("Content-Type", "text/plain")
+		w.WriteHeader(http.StatusCreated)
+		io.WriteString(w, ok)
+	})
+
+	tests := []struct {
+		name    string
+		opts    []TimeoutOption
+		handler http.Handler
+		code    int
+		body    string
+	}{
+		{"in time", nil, fast, http.StatusCreated, ok},
+		{"timed out", nil, slow, http.StatusServiceUnavailable, "Service Unavailable\n"},
+		{"status and message", []TimeoutOption{TimeoutStatus(http.StatusGatewayTimeout), TimeoutMessage("too slow")}, slow, http.StatusGatewayTimeout, "too slow\n"},
+	}
+	for _, test := range tests {
+		t.Run(test.name, func(t *testing.T) {
+			rec := httptest.NewRecorder()
+			Timeout(20*time.Millisecond, test.opts...)(test.handler).ServeHTTP(rec, newRequest("GET", "/"))
+
+			if rec.Code != test.code || rec.Body.String() != test.body {
+				t.Fatalf("bad response: got %d %q want %d %q", rec.Code, rec.Body.String(), test.code, test.body)
+			}
+		})
+	}
+}
+
+func TestTimeoutLateWrite(t *testing.T) {
+	written := make(chan error)
+	handler := Timeout(10 * time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		<-r.Context().Done()
+		time.Sleep(10 * time.Millisecond)
+		w.Header().Set("X-Late", "1")
+		_, err := io.WriteString(w, "late")
+		written <- err
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if err := <-written; err != http.ErrHandlerTimeout {
+		t.Fatalf("bad late write error: got %v want %v", err, http.ErrHandlerTimeout)
+	}
+	if rec.Code != http.StatusServiceUnavailable || strings.Contains(rec.Body.String(), "late") || rec.Header().Get("X-Late") != "" {
+		t.Fatalf("late write reached the response: %d %v %q", rec.Code, rec.Header(), rec.Body.String())
+	}
+}
+
+func TestTimeoutStreaming(t *testing.T) {
+	rec := httptest.NewRecorder()
+	var sent string
+	Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data: 1\n\n")
+		w.(http.Flusher).Flush()
+		sent = rec.Body.String()
+	})).ServeHTTP(rec, newRequest("GET", "/"))
+
+	if sent != "data: 1\n\n" || !rec.Flushed {
+		t.Fatalf("response buffered: sent %q", sent)
+	}
+
+	// A response under way when the deadline expires is aborted.
+	defer func() {
+		if p := recover(); p != http.ErrAbortHandler {
+			t.Fatalf("bad panic: got %v want %v", p, http.ErrAbortHandler)
+		}
+	}()
+	Timeout(10*time.Millisecond)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		io.WriteString(w, "data: 1\n\n")
+		<-r.Context().Done()
+	})).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+}
+
+func TestTimeoutExempt(t *testing.T) {
+	handler := http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if _, ok := r.Context().Deadline(); ok {
+			t.Error("unexpected deadline")
+		}
+		if _, ok := w.(*timeoutWriter); ok {
+			t.Error("response writer wrapped")
+		}
+	})
+	timeout := Timeout(time.Second,
+		TimeoutExemptPaths([]string{"/events"}),
+		TimeoutExempt(func(r *http.Request) bool {
+			return r.Header.Get("Accept") == "text/event-stream"
+		}),
+	)
+
+	requests := []*http.Request{newRequest("GET", "/events/1"), newRequest("GET", "/")}
+	requests[1].Header.Set("Accept", "text/event-stream")
+	upgrade := newRequest("GET", "/")
+	upgrade.Header.Set("Connection", "Upgrade")
+	upgrade.Header.Set("Upgrade", "websocket")
+	requests = append(requests, upgrade)
+
+	for _, r := range requests {
+		timeout(handler).ServeHTTP(httptest.NewRecorder(), r)
+	}
+}
+
+func TestTimeoutPanic(t *testing.T) {
+	defer func() {
+		if p := recover(); p != "boom" {
+			t.Fatalf("bad panic: got %v want %q", p, "boom")
+		}
+	}()
+	Timeout(time.Second)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		panic("boom")
+	})).ServeHTTP(httptest.NewRecorder(), newRequest("GET", "/"))
+}
+
+func TestNewTimeout(t *testing.T) {
+	if _, err := NewTimeout(time.Second, TimeoutStatus(http.StatusGatewayTimeout)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTimeout(0); err == nil {
+		t.Fatal("expected an error for a zero timeout")
+	}
+	if _, err := NewTimeout(time.Second, TimeoutStatus(http.StatusOK)); err == nil {
+		t.Fatal("expected an error for a non-5xx status")
+	}
+	if _, err := NewTimeout(time.Second, TimeoutExempt(nil)); err == nil {
+		t.Fatal("expected an error for a nil exemption")
+	}
+}
@@ -0,0 +1,166 @@
+package handlers
+
+import (
+	"io"
+	"net/http"
+
+	"github.com/felixge/httpsnoop"
+)
+
+// TransformRule associates a response body transformation with the responses
+// matching a path pattern and/or a content type.
+type TransformRule struct {
+	// Path and ContentType are matched as in CachePolicy. Empty values match
+	// all responses.
+	Path        string
+	ContentType string
+
+	// Transform returns a reader of the transformed body, reading the
+	// original body from r. It is called once per response.
+	Transform func(r io.Reader) io.Reader
+}
+
+// TransformResponse is HTTP middleware applying the transformations of the
+// rules matching a response to its body as it is streamed, e.g. to inject a
+// snippet into HTML pages or rewrite URLs. When several rules match, their
+// transformations are chained in order.
+//
+// The middleware takes care of the headers invalidated by the
+// transformation: Content-Length and digests are removed, byte ranges are
+// disabled, and a strong ETag is made weak. Responses which aren't
+// successful, have no body, or are encoded (e.g. compressed) are passed
+// through untouched, so the middleware must wrap CompressHandler rather than
+// the other way around. Flushing transformed responses is not supported.
+//
+// Example:
+//
+//	inject := handlers.TransformResponse(handlers.TransformRule{
+//		ContentType: "text/html",
+//		Transform: func(r io.Reader) io.Reader {
+//			return io.MultiReader(r, strings.NewReader(analyticsSnippet))
+//		},
+//	})
+//	http.ListenAndServe(":1123", inject(r))
+func TransformResponse(rules ...TransformRule) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w, r, end := beginRequestEvent("transform", w, r)
+			defer end()
+
+			var candidates []TransformRule
+			for _, rule := range rules {
+				if rule.Transform != nil && (CachePolicy{Path: rule.Path}).matchPath(r.URL.Path) {
+					candidates = append(candidates, rule)
+				}
+			}
+			if len(candidates) == 0 || r.Method == "HEAD" || isStreamingRequest(r) {
+				h.ServeHTTP(w, r)
+				return
+			}
+
+			t := &responseTransformer{w: w, rules: candidates}
+			h.ServeHTTP(t.wrap(), r)
+			t.close()
+		})
+	}
+}
+
+type responseTransformer struct {
+	w     http.ResponseWriter
+	rules []TransformRule
+
+	decided bool
+	pw      *io.PipeWriter
+	done    chan struct{}
+}
+
+// decide sets up the transformation of the response, if it applies, when its
+// headers are written.
+func (t *responseTransformer) decide(code int) {
+	if t.decided {
+		return
+	}
+	t.decided = true
+
+	h := t.w.Header()
+	if code < 200 || code >= 300 || code == http.StatusNoContent || h.Get("Content-Encoding") != "" {
+		return
+	}
+	var transforms []func(io.Reader) io.Reader
+	for _, rule := range t.rules {
+		if (CachePolicy{ContentType: rule.ContentType}).matchContentType(h.Get("Content-Type")) {
+			transforms = append(transforms, rule.Transform)
+		}
+	}
+	if len(transforms) == 0 {
+		return
+	}
+	transformedHeaders(h)
+
+	pr, pw := io.Pipe()
+	t.pw = pw
+	t.done = make(chan struct{})
+	go func() {
+		defer close(t.done)
+		// Transformations may read their input right away, so they must be
+		// set up concurrently with the handler.
+		var out io.Reader = pr
+		for _, transform := range transforms {
+			out = transform(out)
+		}
+		_, err := io.Copy(t.w, out)
+		// Unblock the handler if the transformation stopped reading early or
+		// the client went away.
+		pr.CloseWithError(err)
+	}()
+}
+
+func (t *responseTransformer) wrap() http.ResponseWriter {
+	var tw http.ResponseWriter
+	tw = httpsnoop.Wrap(t.w, httpsnoop.Hooks{
+		WriteHeader: func(next httpsnoop.WriteHeaderFunc) httpsnoop.WriteHeaderFunc {
+			return func(code int) {
+				if code >= 100 && code < 200 && code != http.StatusSwitchingProtocols {
+					next(code)
+					return
+				}
+				if !t.decided {
+					t.decide(code)
+					next(code)
+				}
+			}
+		},
+		Write: func(next httpsnoop.WriteFunc) httpsnoop.WriteFunc {
+			return func(b []byte) (int, error) {
+				if !t.decided {
+					t.decide(http.StatusOK)
+				}
+				if t.pw != nil {
+					return t.pw.Write(b)
+				}
+				return next(b)
+			}
+		},
+		ReadFrom: func(next httpsnoop.ReadFromFunc) httpsnoop.ReadFromFunc {
+			return func(src io.Reader) (int64, error) {
+				return io.Copy(writerFunc(tw.Write), src)
+			}
+		},
+		Flush: func(next httpsnoop.FlushFunc) httpsnoop.FlushFunc {
+			return func() {
+				if t.pw == nil {
+					next()
+				}
+			}
+		},
+	})
+	return tw
+}
+
+// close ends the transformed body and waits for it to be sent.
+func (t *responseTransformer) close() {
+	if t.pw != nil {
+		t.pw.Close()
+		<-t.done
+	}
+}
@@ -0,0 +1,101 @@
+package handlers
+
+import (
+	"bytes"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+)
+
+func upperTransform(r io.Reader) io.Reader {
+	b, err := ioutil.ReadAll(r)
+	if err != nil {
+		return r
+	}
+	return bytes.NewReader(bytes.ToUpper(b))
+}
+
+func TestTransformResponse(t *testing.T) {
+	transform := TransformResponse(
+		TransformRule{ContentType: "text/html", Transform: func(r io.Reader) io.Reader {
+			return io.MultiReader(r, strings.NewReader("<script></script>"))
+		}},
+		TransformRule{Path: "/loud/", Transform: upperTransform},
+	)
+
+	tests := []struct {
+		path        string
+		contentType string
+		status      int
+		want        string
+		transformed bool
+	}{
+		{"/", "text/html", http.StatusOK, "<p>ok</p><script></script>", true},
+		{"/loud/page", "text/html", http.StatusOK, "<P>OK</P><SCRIPT></SCRIPT>", true},
+		{"/loud/data", "application/json", http.StatusOK, "<P>OK</P>", true},
+		{"/data", "application/json", http.StatusOK, "<p>ok</p>", false},
+		{"/missing", "text/html", http.StatusNotFound, "<p>ok</p>", false},
+	}
+
+	for _, test := range tests {
+		handler := transform(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", test.contentType)
+			w.Header().Set("Content-Length", "9")
+			w.Header().Set(etagHeader, `"v1"`)
+			w.WriteHeader(test.status)
+			io.WriteString(w, "<p>")
+			io.Copy(w, strings.NewReader("ok</p>"))
+		}))
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", test.path))
+
+		if rec.Code != test.status || rec.Body.String() != test.want {
+			t.Errorf("%s: bad response: %d %q, want %q", test.path, rec.Code, rec.Body.String(), test.want)
+		}
+		if transformed := rec.Header().Get("Content-Length") == ""; transformed != test.transformed {
+			t.Errorf("%s: bad Content-Length: %q", test.path, rec.Header().Get("Content-Length"))
+		}
+		if test.transformed && rec.Header().Get(etagHeader) != `W/"v1"` {
+			t.Errorf("%s: bad ETag: %q", test.path, rec.Header().Get(etagHeader))
+		}
+	}
+}
+
+func TestTransformResponseEarlyEOF(t *testing.T) {
+	// A transformation which stops reading mustn't block the handler.
+	handler := TransformResponse(TransformRule{Transform: func(r io.Reader) io.Reader {
+		return io.LimitReader(r, 4)
+	}})(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		for i := 0; i < 1000; i++ {
+			io.WriteString(w, "0123456789")
+		}
+	}))
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/"))
+	if rec.Body.String() != "0123" {
+		t.Fatalf("bad body: %q", rec.Body.String())
+	}
+}
+
+func TestTransformResponseReadFrom(t *testing.T) {
+	ts := httptest.NewServer(TransformResponse(TransformRule{Transform: upperTransform})(
+		http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			w.Header().Set("Content-Type", "text/plain")
+			io.Copy(w, io.LimitReader(strings.NewReader("hello"), 5))
+		}),
+	))
+	defer ts.Close()
+
+	res, err := http.Get(ts.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer res.Body.Close()
+	b, err := ioutil.ReadAll(res.Body)
+	if err != nil || string(b) != "HELLO" {
+		t.Fatalf("bad body: %q, %v", b, err)
+	}
+}
@@ -0,0 +1,540 @@
+package handlers
+
+import (
+	"context"
+	"encoding/base64"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"io/ioutil"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+)
+
+const (
+	tusVersion           = "1.0.0"
+	tusExtensions        = "creation,expiration,termination"
+	tusContentType       = "application/offset+octet-stream"
+	defaultTusExpiration = 24 * time.Hour
+)
+
+// ErrUploadNotFound is returned by a TusStore for unknown uploads.
+var ErrUploadNotFound = errors.New("handlers: upload not found")
+
+// TusUpload describes a resumable upload.
+type TusUpload struct {
+	ID string `json:"id"`
+	// Length is the total size of the upload, and Offset the number of
+	// bytes received so far.
+	Length int64 `json:"length"`
+	Offset int64 `json:"offset"`
+	// Metadata holds the decoded Upload-Metadata sent by the client, e.g.
+	// the file name.
+	Metadata  map[string]string `json:"metadata,omitempty"`
+	ExpiresAt time.Time         `json:"expires_at"`
+}
+
+// Complete reports whether all the bytes of the upload have been received.
+func (u TusUpload) Complete() bool {
+	return u.Offset == u.Length
+}
+
+// TusStore is the storage backend of TusHandler. Implementations may store
+// uploads on disk (see NewTusDiskStore), in an S3-compatible object store
+// with multipart uploads, etc. The handler serializes calls for a given
+// upload.
+type TusStore interface {
+	// Create stores a new, empty upload.
+	Create(ctx context.Context, upload TusUpload) error
+	// Get returns an upload, or ErrUploadNotFound.
+	Get(ctx context.Context, id string) (TusUpload, error)
+	// Append writes the data read from r at the given offset, which is the
+	// current offset of the upload, and returns the number of bytes
+	// written. The bytes written must be kept, and the offset of the upload
+	// advanced, even if reading r fails: this is what makes uploads
+	// resumable.
+	Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error)
+	// SetExpiresAt changes the expiry of an upload, renewed as data is
+	// appended.
+	SetExpiresAt(ctx context.Context, id string, expiresAt time.Time) error
+	// Delete removes an upload.
+	Delete(ctx context.Context, id string) error
+}
+
+// TusOption represents a functional option for configuring TusHandler.
+type TusOption func(*tusHandler) error
+
+type tusHandler struct {
+	basePath   string
+	store      TusStore
+	maxSize    int64
+	expiration time.Duration
+	onComplete func(TusUpload)
+
+	mu    sync.Mutex
+	locks map[string]*tusLock
+}
+
+// TusHandler returns a handler implementing the tus resumable upload protocol
+// (https://tus.io/protocols/resumable-upload) version 1.0.0, with the
+// creation, expiration and termination extensions, so that large uploads
+// survive flaky connections: clients create an upload with a POST request
+// to basePath, then send its bytes with PATCH requests to the returned
+// location, resuming from the offset returned by HEAD after a failure.
+//
+// Uploads are stored in store. Incomplete uploads expire after 24 hours by
+// default, after which they are removed when accessed. Invalid options are
+// ignored: use NewTusHandler to have them reported.
+//
+// Example:
+//
+//	store, err := handlers.NewTusDiskStore("/var/uploads")
+//	if err != nil {
+//		log.Fatal(err)
+//	}
+//	uploads := handlers.TusHandler("/files/", store, handlers.TusOnComplete(process))
+//	http.Handle("/files/", uploads)
+func TusHandler(basePath string, store TusStore, opts ...TusOption) http.Handler {
+	t := &tusHandler{
+		basePath:   strings.TrimSuffix(basePath, "/") + "/",
+		store:      store,
+		expiration: defaultTusExpiration,
+		locks:      map[string]*tusLock{},
+	}
+	for _, option := range opts {
+		option(t)
+	}
+	return t
+}
+
+// NewTusHandler is like TusHandler, but returns an error if store is nil or
+// an option is invalid.
+func NewTusHandler(basePath string, store TusStore, opts ...TusOption) (http.Handler, error) {
+	if store == nil {
+		return nil, errors.New("handlers: nil tus store")
+	}
+	t := &tusHandler{}
+	for _, option := range opts {
+		if err := option(t); err != nil {
+			return nil, err
+		}
+	}
+	return TusHandler(basePath, store, opts...), nil
+}
+
+// TusMaxSize sets the maximum size of an upload. Zero, the default, means no
+// limit; a negative size is invalid.
+func TusMaxSize(n int64) TusOption {
+	return func(t *tusHandler) error {
+		if n < 0 {
+			return fmt.Errorf("handlers: invalid tus max size %d", n)
+		}
+		t.maxSize = n
+		return nil
+	}
+}
+
+// TusExpiration sets for how long incomplete uploads are kept after their
+// creation or last PATCH request. Zero disables expiration; a negative
+// duration is invalid.
+func TusExpiration(d time.Duration) TusOption {
+	return func(t *tusHandler) error {
+		if d < 0 {
+			return fmt.Errorf("handlers: invalid tus expiration %v", d)
+		}
+		t.expiration = d
+		return nil
+	}
+}
+
+// TusOnComplete sets a function called when an upload is complete, from the
+// request sending its last bytes.
+func TusOnComplete(fn func(TusUpload)) TusOption {
+	return func(t *tusHandler) error {
+		t.onComplete = fn
+		return nil
+	}
+}
+
+func (t *tusHandler) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("tus", w, r)
+	defer end()
+
+	h := w.Header()
+	h.Set("Tus-Resumable", tusVersion)
+
+	if r.Method == "OPTIONS" {
+		h.Set("Tus-Version", tusVersion)
+		h.Set("Tus-Extension", tusExtensions)
+		if t.maxSize > 0 {
+			h.Set("Tus-Max-Size", strconv.FormatInt(t.maxSize, 10))
+		}
+		w.WriteHeader(http.StatusNoContent)
+		return
+	}
+	if r.Header.Get("Tus-Resumable") != tusVersion {
+		h.Set("Tus-Version", tusVersion)
+		http.Error(w, "Unsupported tus version", http.StatusPreconditionFailed)
+		return
+	}
+
+	id := strings.TrimPrefix(path.Clean(r.URL.Path), strings.TrimSuffix(t.basePath, "/"))
+	id = strings.Trim(id, "/")
+	switch {
+	case id == "" && r.Method == "POST":
+		t.create(w, r)
+	case id == "" || strings.Contains(id, "/"):
+		http.NotFound(w, r)
+	case r.Method == "HEAD":
+		t.head(w, r, id)
+	case r.Method == "PATCH":
+		t.patch(w, r, id)
+	case r.Method == "DELETE":
+		t.delete(w, r, id)
+	default:
+		h.Set("Allow", "HEAD, PATCH, DELETE, OPTIONS")
+		http.Error(w, http.StatusText(http.StatusMethodNotAllowed), http.StatusMethodNotAllowed)
+	}
+}
+
+// tusLock is the lock of an upload, with the number of requests holding or
+// waiting for it.
+type tusLock struct {
+	sync.Mutex
+	refs int
+}
+
+// lock serializes the requests for an upload. The lock is removed once no
+// request holds or waits for it.
+func (t *tusHandler) lock(id string) func() {
+	t.mu.Lock()
+	l, ok := t.locks[id]
+	if !ok {
+		l = &tusLock{}
+		t.locks[id] = l
+	}
+	l.refs++
+	t.mu.Unlock()
+
+	l.Lock()
+	return func() {
+		l.Unlock()
+		t.mu.Lock()
+		l.refs--
+		if l.refs == 0 {
+			delete(t.locks, id)
+		}
+		t.mu.Unlock()
+	}
+}
+
+func (t *tusHandler) create(w http.ResponseWriter, r *http.Request) {
+	length, err := strconv.ParseInt(r.Header.Get("Upload-Length"), 10, 64)
+	if err != nil || length < 0 {
+		http.Error(w, "Invalid Upload-Length", http.StatusBadRequest)
+		return
+	}
+	if t.maxSize > 0 && length > t.maxSize {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+	metadata, err := parseTusMetadata(r.Header.Get("Upload-Metadata"))
+	if err != nil {
+		http.Error(w, "Invalid Upload-Metadata", http.StatusBadRequest)
+		return
+	}
+
+	upload := TusUpload{
+		ID:       strings.Replace(NewUUIDv7(), "-", "", -1),
+		Length:   length,
+		Metadata: metadata,
+	}
+	if t.expiration > 0 {
+		upload.ExpiresAt = time.Now().Add(t.expiration)
+	}
+	if err := t.store.Create(r.Context(), upload); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+
+	h := w.Header()
+	h.Set("Location", t.basePath+upload.ID)
+	setUploadExpires(h, upload)
+	w.WriteHeader(http.StatusCreated)
+	if length == 0 && t.onComplete != nil {
+		t.onComplete(upload)
+	}
+}
+
+// get returns an upload, removing it and replying with an error if it
+// doesn't exist or expired.
+func (t *tusHandler) get(w http.ResponseWriter, r *http.Request, id string) (TusUpload, bool) {
+	upload, err := t.store.Get(r.Context(), id)
+	switch {
+	case err == ErrUploadNotFound:
+		http.NotFound(w, r)
+		return upload, false
+	case err != nil:
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return upload, false
+	case !upload.Complete() && !upload.ExpiresAt.IsZero() && time.Now().After(upload.ExpiresAt):
+		t.store.Delete(r.Context(), id)
+		http.Error(w, "Upload expired", http.StatusGone)
+		return upload, false
+	}
+	return upload, true
+}
+
+func (t *tusHandler) head(w http.ResponseWriter, r *http.Request, id string) {
+	defer t.lock(id)()
+	upload, ok := t.get(w, r, id)
+	if !ok {
+		return
+	}
+
+	h := w.Header()
+	h.Set("Cache-Control", "no-store")
+	h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	h.Set("Upload-Length", strconv.FormatInt(upload.Length, 10))
+	if len(upload.Metadata) > 0 {
+		h.Set("Upload-Metadata", formatTusMetadata(upload.Metadata))
+	}
+	setUploadExpires(h, upload)
+	w.WriteHeader(http.StatusOK)
+}
+
+func (t *tusHandler) patch(w http.ResponseWriter, r *http.Request, id string) {
+	if r.Header.Get("Content-Type") != tusContentType {
+		http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		return
+	}
+	offset, err := strconv.ParseInt(r.Header.Get("Upload-Offset"), 10, 64)
+	if err != nil || offset < 0 {
+		http.Error(w, "Invalid Upload-Offset", http.StatusBadRequest)
+		return
+	}
+
+	defer t.lock(id)()
+	upload, ok := t.get(w, r, id)
+	if !ok {
+		return
+	}
+	if offset != upload.Offset {
+		http.Error(w, "Mismatched Upload-Offset", http.StatusConflict)
+		return
+	}
+	remaining := upload.Length - upload.Offset
+	if r.ContentLength > remaining {
+		http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		return
+	}
+
+	n, err := t.store.Append(r.Context(), id, offset, io.LimitReader(r.Body, remaining))
+	upload.Offset += n
+	if err != nil && n == 0 {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	if t.expiration > 0 && !upload.Complete() {
+		upload.ExpiresAt = time.Now().Add(t.expiration)
+		if err := t.store.SetExpiresAt(r.Context(), id, upload.ExpiresAt); err != nil {
+			http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+			return
+		}
+	}
+
+	h := w.Header()
+	h.Set("Upload-Offset", strconv.FormatInt(upload.Offset, 10))
+	setUploadExpires(h, upload)
+	w.WriteHeader(http.StatusNoContent)
+	if upload.Complete() && n > 0 && t.onComplete != nil {
+		t.onComplete(upload)
+	}
+}
+
+func (t *tusHandler) delete(w http.ResponseWriter, r *http.Request, id string) {
+	defer t.lock(id)()
+	if _, ok := t.get(w, r, id); !ok {
+		return
+	}
+	if err := t.store.Delete(r.Context(), id); err != nil {
+		http.Error(w, http.StatusText(http.StatusInternalServerError), http.StatusInternalServerError)
+		return
+	}
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func setUploadExpires(h http.Header, upload TusUpload) {
+	if !upload.ExpiresAt.IsZero() && !upload.Complete() {
+		h.Set("Upload-Expires", upload.ExpiresAt.UTC().Format(http.TimeFormat))
+	}
+}
+
+// parseTusMetadata decodes an Upload-Metadata header: comma-separated keys,
+// each followed by a space and its base64 encoded value, if any.
+func parseTusMetadata(v string) (map[string]string, error) {
+	if strings.TrimSpace(v) == "" {
+		return nil, nil
+	}
+	metadata := map[string]string{}
+	for _, pair := range strings.Split(v, ",") {
+		fields := strings.Fields(pair)
+		switch len(fields) {
+		case 1:
+			metadata[fields[0]] = ""
+		case 2:
+			value, err := base64.StdEncoding.DecodeString(fields[1])
+			if err != nil {
+				return nil, err
+			}
+			metadata[fields[0]] = string(value)
+		default:
+			return nil, errors.New("handlers: invalid upload metadata")
+		}
+	}
+	return metadata, nil
+}
+
+func formatTusMetadata(metadata map[string]string) string {
+	pairs := make([]string, 0, len(metadata))
+	for k, v := range metadata {
+		pairs = append(pairs, k+" "+base64.StdEncoding.EncodeToString([]byte(v)))
+	}
+	return strings.Join(pairs, ",")
+}
+
+// TusDiskStore is a TusStore keeping uploads in a directory: the data of an
+// upload is stored in a file named after its ID, and its description in the
+// same file with a .json extension.
+type TusDiskStore struct {
+	dir string
+}
+
+// NewTusDiskStore returns a TusStore keeping uploads in dir, creating it if
+// necessary.
+func NewTusDiskStore(dir string) (*TusDiskStore, error) {
+	if err := os.MkdirAll(dir, 0755); err != nil {
+		return nil, err
+	}
+	return &TusDiskStore{dir: dir}, nil
+}
+
+// Path returns the path of the file holding the data of an upload.
+func (s *TusDiskStore) Path(id string) string {
+	return filepath.Join(s.dir, filepath.Base(id))
+}
+
+func (s *TusDiskStore) writeInfo(upload TusUpload) error {
+	b, err := json.Marshal(upload)
+	if err != nil {
+		return err
+	}
+	tmp := s.Path(upload.ID) + ".json.tmp"
+	if err := ioutil.WriteFile(tmp, b, 0644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.Path(upload.ID)+".json")
+}
+
+// Create implements TusStore.
+func (s *TusDiskStore) Create(ctx context.Context, upload TusUpload) error {
+	f, err := os.OpenFile(s.Path(upload.ID), os.O_CREATE|os.O_EXCL|os.O_WRONLY, 0644)
+	if err != nil {
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+	return s.writeInfo(upload)
+}
+
+// Get implements TusStore.
+func (s *TusDiskStore) Get(ctx context.Context, id string) (TusUpload, error) {
+	var upload TusUpload
+	b, err := ioutil.ReadFile(s.Path(id) + ".json")
+	if os.IsNotExist(err) {
+		return upload, ErrUploadNotFound
+	}
+	if err != nil {
+		return upload, err
+	}
+	err = json.Unmarshal(b, &upload)
+	return upload, err
+}
+
+// SetExpiresAt implements TusStore.
+func (s *TusDiskStore) SetExpiresAt(ctx context.Context, id string, expiresAt time.Time) error {
+	upload, err := s.Get(ctx, id)
+	if err != nil {
+		return err
+	}
+	upload.ExpiresAt = expiresAt
+	return s.writeInfo(upload)
+}
+
+// Append implements TusStore.
+func (s *TusDiskStore) Append(ctx context.Context, id string, offset int64, r io.Reader) (int64, error) {
+	upload, err := s.Get(ctx, id)
+	if err != nil {
+		return 0, err
+	}
+	f, err := os.OpenFile(s.Path(id), os.O_WRONLY, 0644)
+	if err != nil {
+		return 0, err
+	}
+	defer f.Close()
+	if _, err := f.Seek(offset, io.SeekStart); err != nil {
+		return 0, err
+	}
+
+	n, copyErr := io.Copy(f, r)
+	if n > 0 {
+		upload.Offset = offset + n
+		if err := s.writeInfo(upload); err != nil {
+			return 0, err
+		}
+	}
+	return n, copyErr
+}
+
+// Delete implements TusStore.
+func (s *TusDiskStore) Delete(ctx context.Context, id string) error {
+	err := os.Remove(s.Path(id) + ".json")
+	if os.IsNotExist(err) {
+		return ErrUploadNotFound
+	}
+	if err != nil {
+		return err
+	}
+	return os.Remove(s.Path(id))
+}
+
+// RemoveExpired removes the incomplete uploads which expired, e.g. to be run
+// periodically.
+func (s *TusDiskStore) RemoveExpired() error {
+	matches, err := filepath.Glob(filepath.Join(s.dir, "*.json"))
+	if err != nil {
+		return err
+	}
+	now := time.Now()
+	for _, m := range matches {
+		id := strings.TrimSuffix(filepath.Base(m), ".json")
+		upload, err := s.Get(context.Background(), id)
+		if err != nil {
+			continue
+		}
+		if !upload.Complete() && !upload.ExpiresAt.IsZero() && now.After(upload.ExpiresAt) {
+			if err := s.Delete(context.Background(), id); err != nil {
+				return err
+			}
+		}
+	}
+	return nil
+}
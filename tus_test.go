@@ -0,0 +1,231 @@
+package handlers
+
+import (
+	"context"
+	"io/ioutil"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestTusHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorilla_tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewTusDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var completed []TusUpload
+	handler := TusHandler("/files", store, TusMaxSize(100), TusOnComplete(func(u TusUpload) {
+		completed = append(completed, u)
+	}))
+	do := func(method, target string, header map[string]string, body string) *httptest.ResponseRecorder {
+		r := httptest.NewRequest(method, target, strings.NewReader(body))
+		r.Header.Set("Tus-Resumable", "1.0.0")
+		for k, v := range header {
+			r.Header.Set(k, v)
+		}
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, r)
+		return rec
+	}
+
+	rec := do("OPTIONS", "/files/", nil, "")
+	if rec.Code != http.StatusNoContent || rec.Header().Get("Tus-Version") != "1.0.0" || rec.Header().Get("Tus-Max-Size") != "100" {
+		t.Fatalf("bad OPTIONS response: %d %v", rec.Code, rec.Header())
+	}
+
+	rec = do("POST", "/files/", map[string]string{"Upload-Length": "1000"}, "")
+	if rec.Code != http.StatusRequestEntityTooLarge {
+		t.Fatalf("bad status for a large upload: %d", rec.Code)
+	}
+
+	rec = do("POST", "/files/", map[string]string{
+		"Upload-Length":   "11",
+		"Upload-Metadata": "filename d29ybGQudHh0,is_confidential",
+	}, "")
+	location := rec.Header().Get("Location")
+	if rec.Code != http.StatusCreated || !strings.HasPrefix(location, "/files/") || rec.Header().Get("Upload-Expires") == "" {
+		t.Fatalf("bad creation response: %d %v", rec.Code, rec.Header())
+	}
+
+	patch := map[string]string{"Content-Type": tusContentType, "Upload-Offset": "0"}
+	if rec = do("PATCH", location, patch, "hello "); rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "6" {
+		t.Fatalf("bad PATCH response: %d %v", rec.Code, rec.Header())
+	}
+	if rec = do("PATCH", location, patch, "again"); rec.Code != http.StatusConflict {
+		t.Fatalf("bad status for a mismatched offset: %d", rec.Code)
+	}
+
+	rec = do("HEAD", location, nil, "")
+	if rec.Code != http.StatusOK || rec.Header().Get("Upload-Offset") != "6" || rec.Header().Get("Upload-Length") != "11" || rec.Header().Get("Cache-Control") != "no-store" {
+		t.Fatalf("bad HEAD response: %d %v", rec.Code, rec.Header())
+	}
+
+	patch["Upload-Offset"] = "6"
+	if rec = do("PATCH", location, patch, "world"); rec.Code != http.StatusNoContent || rec.Header().Get("Upload-Offset") != "11" {
+		t.Fatalf("bad PATCH response: %d %v", rec.Code, rec.Header())
+	}
+	if len(completed) != 1 || completed[0].Metadata["filename"] != "world.txt" {
+		t.Fatalf("bad completion: %+v", completed)
+	}
+	data, err := ioutil.ReadFile(store.Path(completed[0].ID))
+	if err != nil || string(data) != "hello world" {
+		t.Fatalf("bad upload data: %q %v", data, err)
+	}
+
+	if rec = do("DELETE", location, nil, ""); rec.Code != http.StatusNoContent {
+		t.Fatalf("bad DELETE response: %d", rec.Code)
+	}
+	if rec = do("HEAD", location, nil, ""); rec.Code != http.StatusNotFound {
+		t.Fatalf("bad status for a deleted upload: %d", rec.Code)
+	}
+
+	r := httptest.NewRequest("HEAD", location, nil)
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusPreconditionFailed {
+		t.Fatalf("bad status without Tus-Resumable: %d", rec.Code)
+	}
+}
+
+func TestTusExpiration(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorilla_tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewTusDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	expired := TusUpload{ID: "expired", Length: 10, ExpiresAt: time.Now().Add(-time.Minute)}
+	live := TusUpload{ID: "live", Length: 10, ExpiresAt: time.Now().Add(time.Minute)}
+	for _, u := range []TusUpload{expired, live} {
+		if err := store.Create(ctx, u); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	handler := TusHandler("/files/", store)
+	r := httptest.NewRequest("HEAD", "/files/expired", nil)
+	r.Header.Set("Tus-Resumable", "1.0.0")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusGone {
+		t.Fatalf("bad status for an expired upload: %d", rec.Code)
+	}
+	if _, err := store.Get(ctx, "expired"); err != ErrUploadNotFound {
+		t.Fatalf("expired upload not removed: %v", err)
+	}
+
+	if err := store.Create(ctx, expired); err != nil {
+		t.Fatal(err)
+	}
+	if err := store.RemoveExpired(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := store.Get(ctx, "expired"); err != ErrUploadNotFound {
+		t.Fatalf("expired upload not removed: %v", err)
+	}
+	if _, err := store.Get(ctx, "live"); err != nil {
+		t.Fatalf("live upload removed: %v", err)
+	}
+}
+
+func TestTusExpirationRenewed(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorilla_tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewTusDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	ctx := context.Background()
+	expiresAt := time.Now().Add(time.Minute)
+	if err := store.Create(ctx, TusUpload{ID: "upload", Length: 10, ExpiresAt: expiresAt}); err != nil {
+		t.Fatal(err)
+	}
+
+	handler := TusHandler("/files/", store, TusExpiration(time.Hour))
+	r := httptest.NewRequest("PATCH", "/files/upload", strings.NewReader("hello"))
+	r.Header.Set("Tus-Resumable", "1.0.0")
+	r.Header.Set("Content-Type", tusContentType)
+	r.Header.Set("Upload-Offset", "0")
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNoContent {
+		t.Fatalf("bad PATCH response: %d", rec.Code)
+	}
+	upload, err := store.Get(ctx, "upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !upload.ExpiresAt.After(expiresAt.Add(30 * time.Minute)) {
+		t.Fatalf("expiry not renewed: %v", upload.ExpiresAt)
+	}
+}
+
+func TestTusLock(t *testing.T) {
+	h := TusHandler("/files/", nil).(*tusHandler)
+
+	unlock := h.lock("upload")
+	locked := make(chan func())
+	go func() { locked <- h.lock("upload") }()
+	// Let the request wait for the lock.
+	time.Sleep(10 * time.Millisecond)
+	unlock()
+	unlock = <-locked
+
+	// A request arriving while the lock is held by one which waited for it
+	// must wait too.
+	go func() { locked <- h.lock("upload") }()
+	select {
+	case <-locked:
+		t.Fatal("lock held twice")
+	case <-time.After(10 * time.Millisecond):
+	}
+	unlock()
+	(<-locked)()
+
+	if len(h.locks) != 0 {
+		t.Fatalf("locks not removed: %v", h.locks)
+	}
+}
+
+func TestNewTusHandler(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorilla_tus")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+	store, err := NewTusDiskStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := NewTusHandler("/files/", store, TusMaxSize(100), TusExpiration(time.Hour)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := NewTusHandler("/files/", nil); err == nil {
+		t.Fatal("no error for a nil store")
+	}
+	if _, err := NewTusHandler("/files/", store, TusMaxSize(-1)); err == nil {
+		t.Fatal("no error for a negative max size")
+	}
+	if _, err := NewTusHandler("/files/", store, TusExpiration(-time.Hour)); err == nil {
+		t.Fatal("no error for a negative expiration")
+	}
+}
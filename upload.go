@@ -0,0 +1,276 @@
+package handlers
+
+import (
+	"bytes"
+	"context"
+	"errors"
+	"io"
+	"io/ioutil"
+	"mime"
+	"net/http"
+	"net/textproto"
+	"net/url"
+	"os"
+)
+
+const (
+	defaultUploadMaxValueSize = 1 << 20
+)
+
+var (
+	errUploadTooLarge = errors.New("handlers: upload too large")
+	errUploadType     = errors.New("handlers: upload type not allowed")
+)
+
+// UploadedFile describes a file part of a multipart upload.
+type UploadedFile struct {
+	FieldName string
+	FileName  string
+	// ContentType is sniffed from the content of the file, with
+	// http.DetectContentType, rather than taken from the client.
+	ContentType string
+	Size        int64
+	Header      textproto.MIMEHeader
+	// Path is the path of the file written by UploadToDir.
+	Path string
+}
+
+// MultipartUpload holds the parsed parts of a multipart upload.
+type MultipartUpload struct {
+	Files  []*UploadedFile
+	Values url.Values
+}
+
+// UploadDestination returns the writer receiving the content of an uploaded
+// file, which is closed once the file has been received. It may set fields
+// of file, e.g. Path.
+type UploadDestination func(ctx context.Context, file *UploadedFile) (io.WriteCloser, error)
+
+// UploadToDir returns an UploadDestination writing files to new temporary
+// files in dir (os.TempDir() if empty), whose path is set in UploadedFile.Path.
+// The wrapped handler is responsible for moving or removing them.
+func UploadToDir(dir string) UploadDestination {
+	return func(ctx context.Context, file *UploadedFile) (io.WriteCloser, error) {
+		f, err := ioutil.TempFile(dir, "upload-")
+		if err != nil {
+			return nil, err
+		}
+		file.Path = f.Name()
+		return f, nil
+	}
+}
+
+// UploadOption represents a functional option for configuring the multipart
+// upload middleware.
+type UploadOption func(*multipartUpload) error
+
+type multipartUpload struct {
+	h            http.Handler
+	dest         UploadDestination
+	maxFileSize  int64
+	maxTotalSize int64
+	maxValueSize int64
+	allowedTypes []string
+}
+
+// StreamMultipartUploads is HTTP middleware parsing multipart/form-data
+// requests as they are received: file parts are streamed to dest, without
+// holding whole files in memory as Request.ParseMultipartForm does, and the
+// wrapped handler gets the parsed metadata and form values with
+// MultipartUploads. Other requests are passed through untouched.
+//
+// Requests exceeding the size limits get a 413 Request Entity Too Large
+// response, and requests with files of a type which isn't allowed a 415
+// Unsupported Media Type response; files received before are removed when
+// they were written with UploadToDir.
+//
+// Example:
+//
+//	uploads := handlers.StreamMultipartUploads(handlers.UploadToDir("/var/uploads"),
+//		handlers.UploadMaxFileSize(100<<20),
+//		handlers.UploadAllowedTypes("image/*", "application/pdf"))
+//	http.Handle("/upload", uploads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+//		for _, f := range handlers.MultipartUploads(r).Files {
+//			log.Printf("received %s (%d bytes) in %s", f.FileName, f.Size, f.Path)
+//		}
+//	})))
+func StreamMultipartUploads(dest UploadDestination, opts ...UploadOption) func(http.Handler) http.Handler {
+	return func(h http.Handler) http.Handler {
+		u := &multipartUpload{h: h, dest: dest, maxValueSize: defaultUploadMaxValueSize}
+		for _, option := range opts {
+			option(u)
+		}
+		return u
+	}
+}
+
+// UploadMaxFileSize sets the maximum size of each uploaded file.
+func UploadMaxFileSize(n int64) UploadOption {
+	return func(u *multipartUpload) error {
+		u.maxFileSize = n
+		return nil
+	}
+}
+
+// UploadMaxTotalSize sets the maximum total size of the uploaded files.
+func UploadMaxTotalSize(n int64) UploadOption {
+	return func(u *multipartUpload) error {
+		u.maxTotalSize = n
+		return nil
+	}
+}
+
+// UploadMaxValueSize sets the maximum total size of the non-file form values,
+// held in memory. The default is 1MiB.
+func UploadMaxValueSize(n int64) UploadOption {
+	return func(u *multipartUpload) error {
+		u.maxValueSize = n
+		return nil
+	}
+}
+
+// UploadAllowedTypes restricts the media types of uploaded files, e.g.
+// "application/pdf" or "image/*". By default, all types are allowed.
+func UploadAllowedTypes(types ...string) UploadOption {
+	return func(u *multipartUpload) error {
+		u.allowedTypes = append(u.allowedTypes, types...)
+		return nil
+	}
+}
+
+// MultipartUploads returns the multipart upload parsed by the
+// StreamMultipartUploads middleware, or nil.
+func MultipartUploads(r *http.Request) *MultipartUpload {
+	return MultipartUploadFromContext(r.Context())
+}
+
+func (u *multipartUpload) allowed(contentType string) bool {
+	if len(u.allowedTypes) == 0 {
+		return true
+	}
+	for _, t := range u.allowedTypes {
+		if (CachePolicy{ContentType: t}).matchContentType(contentType) {
+			return true
+		}
+	}
+	return false
+}
+
+func (u *multipartUpload) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("upload", w, r)
+	defer end()
+
+	mt, _, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+	if mt != "multipart/form-data" {
+		u.h.ServeHTTP(w, r)
+		return
+	}
+
+	upload, err := u.parse(r)
+	if err != nil {
+		for _, f := range upload.Files {
+			if f.Path != "" {
+				os.Remove(f.Path)
+			}
+		}
+		switch err {
+		case errUploadTooLarge:
+			http.Error(w, http.StatusText(http.StatusRequestEntityTooLarge), http.StatusRequestEntityTooLarge)
+		case errUploadType:
+			http.Error(w, http.StatusText(http.StatusUnsupportedMediaType), http.StatusUnsupportedMediaType)
+		default:
+			http.Error(w, http.StatusText(http.StatusBadRequest), http.StatusBadRequest)
+		}
+		return
+	}
+
+	u.h.ServeHTTP(w, WithValue(r, upload))
+}
+
+func (u *multipartUpload) parse(r *http.Request) (*MultipartUpload, error) {
+	upload := &MultipartUpload{Values: url.Values{}}
+	mr, err := r.MultipartReader()
+	if err != nil {
+		return upload, err
+	}
+
+	var total, values int64
+	for {
+		part, err := mr.NextPart()
+		if err == io.EOF {
+			return upload, nil
+		}
+		if err != nil {
+			return upload, err
+		}
+
+		if part.FileName() == "" {
+			b, err := ioutil.ReadAll(io.LimitReader(part, u.maxValueSize-values+1))
+			if err != nil {
+				return upload, err
+			}
+			values += int64(len(b))
+			if values > u.maxValueSize {
+				return upload, errUploadTooLarge
+			}
+			upload.Values.Add(part.FormName(), string(b))
+			continue
+		}
+
+		file := &UploadedFile{
+			FieldName: part.FormName(),
+			FileName:  part.FileName(),
+			Header:    part.Header,
+		}
+		n, err := u.receive(r.Context(), upload, file, part, total)
+		total += n
+		if err != nil {
+			return upload, err
+		}
+	}
+}
+
+// receive copies a file part to its destination, enforcing the limits.
+// total is the size of the files received before.
+func (u *multipartUpload) receive(ctx context.Context, upload *MultipartUpload, file *UploadedFile, part io.Reader, total int64) (int64, error) {
+	head := make([]byte, 512)
+	n, err := io.ReadFull(part, head)
+	if err != nil && err != io.ErrUnexpectedEOF && err != io.EOF {
+		return 0, err
+	}
+	head = head[:n]
+	file.ContentType = http.DetectContentType(head)
+	if !u.allowed(file.ContentType) {
+		return 0, errUploadType
+	}
+
+	limit := int64(-1)
+	if u.maxFileSize > 0 {
+		limit = u.maxFileSize
+	}
+	if u.maxTotalSize > 0 && (limit < 0 || u.maxTotalSize-total < limit) {
+		limit = u.maxTotalSize - total
+	}
+
+	dst, err := u.dest(ctx, file)
+	if err != nil {
+		return 0, err
+	}
+	upload.Files = append(upload.Files, file)
+
+	src := io.MultiReader(bytes.NewReader(head), part)
+	if limit >= 0 {
+		src = io.LimitReader(src, limit+1)
+	}
+	file.Size, err = io.Copy(dst, src)
+	if closeErr := dst.Close(); err == nil {
+		err = closeErr
+	}
+	if err != nil {
+		return file.Size, err
+	}
+	if limit >= 0 && file.Size > limit {
+		return file.Size, errUploadTooLarge
+	}
+	return file.Size, nil
+}
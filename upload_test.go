@@ -0,0 +1,99 @@
+package handlers
+
+import (
+	"bytes"
+	"io/ioutil"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func multipartRequest(t *testing.T, values map[string]string, files map[string][]byte) *http.Request {
+	var body bytes.Buffer
+	mw := multipart.NewWriter(&body)
+	for k, v := range values {
+		mw.WriteField(k, v)
+	}
+	for name, content := range files {
+		fw, err := mw.CreateFormFile("file", name)
+		if err != nil {
+			t.Fatal(err)
+		}
+		fw.Write(content)
+	}
+	mw.Close()
+
+	r := httptest.NewRequest("POST", "/upload", &body)
+	r.Header.Set("Content-Type", mw.FormDataContentType())
+	return r
+}
+
+func TestStreamMultipartUploads(t *testing.T) {
+	dir, err := ioutil.TempDir("", "gorilla_upload")
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer os.RemoveAll(dir)
+
+	var upload *MultipartUpload
+	uploads := StreamMultipartUploads(UploadToDir(dir),
+		UploadMaxFileSize(1000),
+		UploadMaxTotalSize(1500),
+		UploadAllowedTypes("text/*", "image/png"))
+	handler := uploads(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		upload = MultipartUploads(r)
+	}))
+
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, multipartRequest(t, map[string]string{"title": "notes"}, map[string][]byte{
+		"notes.txt": []byte("some notes"),
+	}))
+	if rec.Code != http.StatusOK || upload == nil {
+		t.Fatalf("bad response: %d %q", rec.Code, rec.Body.String())
+	}
+	if upload.Values.Get("title") != "notes" || len(upload.Files) != 1 {
+		t.Fatalf("bad upload: %+v", upload)
+	}
+	f := upload.Files[0]
+	if f.FileName != "notes.txt" || f.FieldName != "file" || f.Size != 10 || !strings.HasPrefix(f.ContentType, "text/plain") {
+		t.Fatalf("bad file: %+v", f)
+	}
+	if b, err := ioutil.ReadFile(f.Path); err != nil || string(b) != "some notes" {
+		t.Fatalf("bad file content: %q %v", b, err)
+	}
+
+	tests := []struct {
+		name  string
+		files map[string][]byte
+		code  int
+	}{
+		{"large file", map[string][]byte{"a.txt": bytes.Repeat([]byte("a"), 1001)}, http.StatusRequestEntityTooLarge},
+		{"large total", map[string][]byte{"a.txt": bytes.Repeat([]byte("a"), 800), "b.txt": bytes.Repeat([]byte("b"), 800)}, http.StatusRequestEntityTooLarge},
+		{"bad type", map[string][]byte{"a.pdf": []byte("%PDF-1.4 ...")}, http.StatusUnsupportedMediaType},
+	}
+	for _, test := range tests {
+		entries, _ := ioutil.ReadDir(dir)
+		before := len(entries)
+
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, multipartRequest(t, nil, test.files))
+		if rec.Code != test.code {
+			t.Errorf("%s: bad status: got %d want %d", test.name, rec.Code, test.code)
+		}
+		if entries, _ = ioutil.ReadDir(dir); len(entries) != before {
+			t.Errorf("%s: rejected files not removed from %s", test.name, filepath.Base(dir))
+		}
+	}
+
+	// Other requests are passed through.
+	upload = nil
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, httptest.NewRequest("POST", "/upload", strings.NewReader("{}")))
+	if rec.Code != http.StatusOK || upload != nil {
+		t.Fatalf("bad response to a non-multipart request: %d %+v", rec.Code, upload)
+	}
+}
@@ -0,0 +1,53 @@
+package handlers
+
+import (
+	"net/http"
+	"strings"
+)
+
+// ValidationError describes an invalid part of a request, or of a response.
+type ValidationError struct {
+	// In is the part of the message holding the invalid value: "path",
+	// "query", "header", "cookie" or "body" for requests, and "response"
+	// for responses.
+	In string `json:"in"`
+	// Pointer is a RFC 6901 JSON pointer to the invalid value, e.g.
+	// "/items/0/quantity" in the body, or "/limit" for the limit query
+	// parameter. It is empty when the part as a whole is invalid.
+	Pointer string `json:"pointer"`
+	// Message explains the error.
+	Message string `json:"message"`
+}
+
+func (e ValidationError) Error() string {
+	return e.In + e.Pointer + ": " + e.Message
+}
+
+// ValidationErrors lists the validation errors of a request, in the order
+// they were found.
+type ValidationErrors []ValidationError
+
+func (errs ValidationErrors) Error() string {
+	msgs := make([]string, len(errs))
+	for i, e := range errs {
+		msgs[i] = e.Error()
+	}
+	return strings.Join(msgs, "; ")
+}
+
+func (errs *ValidationErrors) add(in, pointer, message string) {
+	*errs = append(*errs, ValidationError{In: in, Pointer: pointer, Message: message})
+}
+
+// writeValidationErrors answers an invalid request with a problem whose
+// errors extension member lists errs.
+func writeValidationErrors(w http.ResponseWriter, r *http.Request, code int, errs ValidationErrors) {
+	writeProblemDocument(w, r, Problem{Status: code, Detail: "invalid request"}, errs)
+}
+
+// jsonPointer appends the reference token of a member or element to the JSON
+// pointer p.
+func jsonPointer(p, token string) string {
+	token = strings.ReplaceAll(token, "~", "~0")
+	return p + "/" + strings.ReplaceAll(token, "/", "~1")
+}
@@ -0,0 +1,134 @@
+package handlers
+
+import (
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+)
+
+// wellKnownPrefix is the path prefix of well-known URIs (RFC 8615).
+const wellKnownPrefix = "/.well-known/"
+
+// wellKnownTypes are the content types of common well-known resources whose
+// names don't tell them.
+var wellKnownTypes = map[string]string{
+	"apple-app-site-association": "application/json",
+	"assetlinks.json":            "application/json",
+	"openid-configuration":       "application/json",
+	"oauth-authorization-server": "application/json",
+	"security.txt":               "text/plain; charset=utf-8",
+	"mta-sts.txt":                "text/plain; charset=utf-8",
+	"host-meta":                  "application/xrd+xml; charset=utf-8",
+	"host-meta.json":             "application/json",
+	"webfinger":                  "application/jrd+json",
+	"nodeinfo":                   "application/json",
+}
+
+// WellKnown serves the resources registered under /.well-known/, so that
+// they are managed in one place instead of scattered across the application.
+//
+// The WellKnown is itself a http.Handler, answering 404 Not Found for
+// unregistered names, and can be put in front of another handler with
+// Handler.
+type WellKnown struct {
+	mu      sync.RWMutex
+	entries map[string]http.Handler
+}
+
+// NewWellKnown returns an empty WellKnown.
+//
+// Example:
+//
+//	wk := handlers.NewWellKnown()
+//	wk.ChangePassword("/account/password")
+//	wk.JSON("assetlinks.json", assetLinks)
+//	wk.Content("security.txt", "", securityTxt)
+//	http.ListenAndServe(":1123", wk.Handler(r))
+func NewWellKnown() *WellKnown {
+	return &WellKnown{entries: map[string]http.Handler{}}
+}
+
+// Handle registers h for /.well-known/name, replacing any previous
+// registration.
+func (wk *WellKnown) Handle(name string, h http.Handler) {
+	wk.mu.Lock()
+	defer wk.mu.Unlock()
+	wk.entries[strings.Trim(name, "/")] = h
+}
+
+// Content registers static content for /.well-known/name. If contentType is
+// empty it is derived from the name, and defaults to
+// application/octet-stream.
+func (wk *WellKnown) Content(name, contentType string, content []byte) {
+	name = strings.Trim(name, "/")
+	if contentType == "" {
+		contentType = wellKnownTypes[name]
+	}
+	wk.Handle(name, InlineAsset(name, content, InlineAssetContentType(contentType), InlineAssetCacheControl("")))
+}
+
+// JSON registers the JSON encoding of v for /.well-known/name, e.g. for
+// assetlinks.json or apple-app-site-association.
+func (wk *WellKnown) JSON(name string, v interface{}) error {
+	b, err := json.Marshal(v)
+	if err != nil {
+		return err
+	}
+	wk.Content(name, "application/json", b)
+	return nil
+}
+
+// ChangePassword registers the /.well-known/change-password redirect to the
+// page where users change their password, as used by password managers.
+func (wk *WellKnown) ChangePassword(url string) {
+	wk.Handle("change-password", http.RedirectHandler(url, http.StatusFound))
+}
+
+// Passthrough registers a proxy for /.well-known/name forwarding requests to
+// target, e.g. the openid-configuration of an external identity provider.
+func (wk *WellKnown) Passthrough(name string, target *url.URL, opts ...ReverseProxyOption) {
+	base := &url.URL{Scheme: target.Scheme, Host: target.Host}
+	proxy := ReverseProxy(base, opts...)
+	wk.Handle(name, http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r2 := r.Clone(r.Context())
+		r2.Host = target.Host
+		r2.URL.Path = target.Path
+		r2.URL.RawPath = ""
+		r2.URL.RawQuery = target.RawQuery
+		proxy.ServeHTTP(w, r2)
+	}))
+}
+
+// Handler returns HTTP middleware serving the registered well-known
+// resources, and passing all other requests, including those for
+// unregistered well-known names, to h.
+func (wk *WellKnown) Handler(h http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w, r, end := beginRequestEvent("well_known", w, r)
+		defer end()
+
+		if entry := wk.lookup(r.URL.Path); entry != nil {
+			entry.ServeHTTP(w, r)
+			return
+		}
+		h.ServeHTTP(w, r)
+	})
+}
+
+func (wk *WellKnown) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	w, r, end := beginRequestEvent("well_known", w, r)
+	defer end()
+
+	wk.Handler(http.NotFoundHandler()).ServeHTTP(w, r)
+}
+
+func (wk *WellKnown) lookup(p string) http.Handler {
+	if !strings.HasPrefix(p, wellKnownPrefix) {
+		return nil
+	}
+	wk.mu.RLock()
+	defer wk.mu.RUnlock()
+	return wk.entries[strings.TrimSuffix(p[len(wellKnownPrefix):], "/")]
+}
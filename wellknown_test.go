@@ -0,0 +1,90 @@
+package handlers
+
+import (
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"testing"
+)
+
+func TestWellKnown(t *testing.T) {
+	wk := NewWellKnown()
+	wk.ChangePassword("/account/password")
+	if err := wk.JSON("assetlinks.json", []map[string]string{{"relation": "x"}}); err != nil {
+		t.Fatal(err)
+	}
+	wk.Content("apple-app-site-association", "", []byte(`{"applinks":{}}`))
+	wk.Content("security.txt", "", []byte("Contact: mailto:security@example.com\n"))
+	handler := wk.Handler(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusTeapot)
+	}))
+
+	tests := []struct {
+		path        string
+		code        int
+		contentType string
+		body        string
+	}{
+		{"/.well-known/change-password", http.StatusFound, "", ""},
+		{"/.well-known/assetlinks.json", http.StatusOK, "application/json", `[{"relation":"x"}]`},
+		{"/.well-known/apple-app-site-association", http.StatusOK, "application/json", `{"applinks":{}}`},
+		{"/.well-known/security.txt", http.StatusOK, "text/plain; charset=utf-8", "Contact: mailto:security@example.com\n"},
+		{"/.well-known/unknown", http.StatusTeapot, "", ""},
+		{"/other", http.StatusTeapot, "", ""},
+	}
+	for _, test := range tests {
+		rec := httptest.NewRecorder()
+		handler.ServeHTTP(rec, newRequest("GET", test.path))
+		if rec.Code != test.code {
+			t.Errorf("%s: wrong status, got %d want %d", test.path, rec.Code, test.code)
+		}
+		if test.contentType != "" && rec.Header().Get("Content-Type") != test.contentType {
+			t.Errorf("%s: wrong content type, got %q want %q", test.path, rec.Header().Get("Content-Type"), test.contentType)
+		}
+		if test.body != "" && rec.Body.String() != test.body {
+			t.Errorf("%s: wrong body, got %q want %q", test.path, rec.Body.String(), test.body)
+		}
+	}
+
+	// Conditional requests are answered from the ETag.
+	rec := httptest.NewRecorder()
+	handler.ServeHTTP(rec, newRequest("GET", "/.well-known/security.txt"))
+	r := newRequest("GET", "/.well-known/security.txt")
+	r.Header.Set("If-None-Match", rec.Header().Get(etagHeader))
+	rec = httptest.NewRecorder()
+	handler.ServeHTTP(rec, r)
+	if rec.Code != http.StatusNotModified {
+		t.Errorf("wrong conditional status: got %d want %d", rec.Code, http.StatusNotModified)
+	}
+
+	rec = httptest.NewRecorder()
+	wk.ServeHTTP(rec, newRequest("GET", "/.well-known/unknown"))
+	if rec.Code != http.StatusNotFound {
+		t.Errorf("wrong status for unknown name: got %d want %d", rec.Code, http.StatusNotFound)
+	}
+}
+
+func TestWellKnownPassthrough(t *testing.T) {
+	var path, host string
+	idp := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		path, host = r.URL.Path, r.Host
+		w.Header().Set("Content-Type", "application/json")
+		w.Write([]byte(`{"issuer":"idp"}`))
+	}))
+	defer idp.Close()
+	target, _ := url.Parse(idp.URL + "/realms/main/.well-known/openid-configuration")
+
+	wk := NewWellKnown()
+	wk.Passthrough("openid-configuration", target)
+	front := httptest.NewServer(wk)
+	defer front.Close()
+
+	res, err := http.Get(front.URL + "/.well-known/openid-configuration")
+	if err != nil {
+		t.Fatal(err)
+	}
+	res.Body.Close()
+	if res.StatusCode != http.StatusOK || path != target.Path || host != target.Host {
+		t.Fatalf("got status %d, upstream path %q host %q", res.StatusCode, path, host)
+	}
+}